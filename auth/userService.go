@@ -0,0 +1,277 @@
+// Package auth holds the user account service shared by the authentication,
+// account and admin handlers.
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email is already in use")
+	ErrInvalidRole  = errors.New("role must be member, staff or admin")
+)
+
+// CacheTime is how long users stay in the Redis cache.
+const CacheTime = 7 * 24 * time.Hour
+
+// UserService stores user accounts. Lookups return nil without an error when
+// the user does not exist; updates return ErrUserNotFound instead.
+type UserService interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, userID int64) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	UpdatePassword(ctx context.Context, userID int64, password string) error
+	UpdateEmail(ctx context.Context, user *models.User, email string) error
+	UpdateStatus(ctx context.Context, userID int64, status string) error
+	UpdateRole(ctx context.Context, userID int64, role string) error
+	Delete(ctx context.Context, userID int64) error
+	// Forget drops the cached copy of a user, e.g. after a failed login of a
+	// suspended account.
+	Forget(ctx context.Context, username string) error
+}
+
+// PostgresUserService keeps users in Postgres and caches them in Redis by
+// username, which is how logins look them up.
+type PostgresUserService struct {
+	DB    *sql.DB
+	Redis *redis.Client
+}
+
+// NewUserService returns a UserService backed by the given database and cache.
+func NewUserService(db *sql.DB, redisClient *redis.Client) *PostgresUserService {
+	return &PostgresUserService{DB: db, Redis: redisClient}
+}
+
+// Create hashes the user's password and inserts the user.
+func (s *PostgresUserService) Create(ctx context.Context, user *models.User) error {
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, role, status, created_at`
+	err := s.DB.QueryRowContext(ctx, query, user.Username, user.Email, user.Password).Scan(&user.ID, &user.Role, &user.Status, &user.CreatedAt)
+	if err != nil {
+		return errors.New("failed to insert user into database: " + err.Error())
+	}
+
+	if err := s.setCache(ctx, user); err != nil {
+		return errors.New("failed to set user cache: " + err.Error())
+	}
+
+	return nil
+}
+
+func (s *PostgresUserService) GetByID(ctx context.Context, userID int64) (*models.User, error) {
+	var user models.User
+	query := `SELECT id, username, email, password, role, status, created_at FROM users WHERE id = $1`
+	err := s.DB.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.Status, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.New("failed to query user by ID: " + err.Error())
+	}
+
+	return &user, nil
+}
+
+func (s *PostgresUserService) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	user, err := s.getCache(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	var userFromDB models.User
+	query := `SELECT id, username, email, password, role, status, created_at FROM users WHERE username = $1`
+	err = s.DB.QueryRowContext(ctx, query, username).Scan(&userFromDB.ID, &userFromDB.Username, &userFromDB.Email, &userFromDB.Password, &userFromDB.Role, &userFromDB.Status, &userFromDB.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.New("failed to query user by username: " + err.Error())
+	}
+
+	if err := s.setCache(ctx, &userFromDB); err != nil {
+		return nil, errors.New("failed to set user cache: " + err.Error())
+	}
+
+	return &userFromDB, nil
+}
+
+// UpdatePassword hashes and stores a new password.
+func (s *PostgresUserService) UpdatePassword(ctx context.Context, userID int64, password string) error {
+	user, err := s.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	user.Password = password
+	if err := user.HashPassword(); err != nil {
+		return errors.New("failed to hash password: " + err.Error())
+	}
+
+	if err := s.Forget(ctx, user.Username); err != nil {
+		return errors.New("failed to delete user cache: " + err.Error())
+	}
+
+	_, err = s.DB.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, user.Password, userID)
+	if err != nil {
+		return errors.New("failed to update user password: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateEmail changes the email address of a user and purges the cached user.
+func (s *PostgresUserService) UpdateEmail(ctx context.Context, user *models.User, email string) error {
+	var taken bool
+	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)`, email, user.ID).Scan(&taken)
+	if err != nil {
+		return errors.New("failed to check email: " + err.Error())
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	if err := s.Forget(ctx, user.Username); err != nil {
+		return errors.New("failed to delete user cache: " + err.Error())
+	}
+
+	_, err = s.DB.ExecContext(ctx, `UPDATE users SET email = $1 WHERE id = $2`, email, user.ID)
+	if err != nil {
+		return errors.New("failed to update user email: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateStatus sets the account status of a user and purges the cached
+// copies of the user so that the new status takes effect immediately.
+// Suspending a user also revokes their refresh tokens.
+func (s *PostgresUserService) UpdateStatus(ctx context.Context, userID int64, status string) error {
+	user, err := s.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	_, err = s.DB.ExecContext(ctx, `UPDATE users SET status = $1 WHERE id = $2`, status, userID)
+	if err != nil {
+		return errors.New("failed to update user status: " + err.Error())
+	}
+	if status == models.UserStatusSuspended {
+		_, err = s.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+		if err != nil {
+			return errors.New("failed to revoke refresh tokens: " + err.Error())
+		}
+	}
+
+	if err := s.Forget(ctx, user.Username); err != nil {
+		return errors.New("failed to delete user cache: " + err.Error())
+	}
+	if err := middlewares.DeleteUserStatusCache(ctx, userID); err != nil {
+		return errors.New("failed to delete user status cache: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateRole sets the role of a user, which StaffOnly and AdminOnly read on
+// every request, and purges the cached copy of the user.
+func (s *PostgresUserService) UpdateRole(ctx context.Context, userID int64, role string) error {
+	if !middlewares.IsRole(role) {
+		return ErrInvalidRole
+	}
+	user, err := s.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	_, err = s.DB.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID)
+	if err != nil {
+		return errors.New("failed to update user role: " + err.Error())
+	}
+
+	if err := s.Forget(ctx, user.Username); err != nil {
+		return errors.New("failed to delete user cache: " + err.Error())
+	}
+	return nil
+}
+
+// Delete removes a user together with their avatar.
+func (s *PostgresUserService) Delete(ctx context.Context, userID int64) error {
+	user, err := s.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.Forget(ctx, user.Username); err != nil {
+		return errors.New("failed to delete user cache: " + err.Error())
+	}
+
+	var avatarID uuid.NullUUID
+	err = s.DB.QueryRowContext(ctx, `DELETE FROM users WHERE id = $1 RETURNING avatar_media_id`, userID).Scan(&avatarID)
+	if err != nil {
+		return errors.New("failed to delete user: " + err.Error())
+	}
+	if avatarID.Valid {
+		if err := media.DeleteItem(ctx, avatarID.UUID); err != nil && !errors.Is(err, media.ErrItemNotFound) {
+			log.Printf("Failed to delete avatar %s: %v", avatarID.UUID, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresUserService) Forget(ctx context.Context, username string) error {
+	return s.Redis.Del(ctx, "user:"+username).Err()
+}
+
+func (s *PostgresUserService) setCache(ctx context.Context, user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	return s.Redis.Set(ctx, "user:"+user.Username, data, CacheTime).Err()
+}
+
+func (s *PostgresUserService) getCache(ctx context.Context, username string) (*models.User, error) {
+	data, err := s.Redis.Get(ctx, "user:"+username).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var user models.User
+	err = json.Unmarshal(data, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
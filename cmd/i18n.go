@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"jsmi-api/controllers"
+	"jsmi-api/db"
+	"jsmi-api/validation"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The i18n commands round-trip the strings of the built-in emails with
+// translation platforms, as flat JSON ({"key": "text"}) or XLIFF 1.2:
+//
+//	jsmi-api i18n-export [-format json|xliff] [-lang sw] [-o file]
+//	jsmi-api i18n-import [-format json|xliff] file
+//
+// The format defaults to the file's extension, or JSON.
+
+const commandTimeout = 5 * time.Minute
+
+// xliffDocument is the subset of XLIFF 1.2 the commands read and write.
+type xliffDocument struct {
+	XMLName xml.Name  `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr,omitempty"`
+	Datatype       string      `xml:"datatype,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source"`
+	Target string `xml:"target,omitempty"`
+	Note   string `xml:"note,omitempty"`
+}
+
+// runCommand runs the command named by args[0]. It reports whether there was
+// such a command.
+func runCommand(args []string) bool {
+	var err error
+	switch args[0] {
+	case "i18n-export":
+		err = exportCatalog(args[1:])
+	case "i18n-import":
+		err = importCatalog(args[1:])
+	case "grant-role":
+		err = grantRole(args[1:])
+	default:
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		var validationErr *validation.ValidationError
+		if errors.As(err, &validationErr) {
+			for _, fieldError := range validationErr.Errors {
+				fmt.Fprintf(os.Stderr, "  %s\n", fieldError.Message)
+			}
+		}
+		os.Exit(1)
+	}
+	return true
+}
+
+func connectDB(ctx context.Context) error {
+	config, err := db.LoadDBConfig()
+	if err != nil {
+		return err
+	}
+	return db.InitDB(ctx, config.DBURL)
+}
+
+// catalogFormat returns the format flag, or the one the file name implies.
+func catalogFormat(format, path string) (string, error) {
+	if format == "" {
+		format = "json"
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".xlf" || ext == ".xliff" {
+			format = "xliff"
+		}
+	}
+	if format != "json" && format != "xliff" {
+		return "", fmt.Errorf("unknown format %q, use json or xliff", format)
+	}
+	return format, nil
+}
+
+func exportCatalog(args []string) error {
+	flags := flag.NewFlagSet("i18n-export", flag.ExitOnError)
+	format := flags.String("format", "", "json or xliff")
+	lang := flags.String("lang", "", "target language of the XLIFF file, e.g. sw")
+	output := flags.String("o", "", "file to write, standard output by default")
+	flags.Parse(args)
+
+	f, err := catalogFormat(*format, *output)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	messages, err := controllers.ExportMessageCatalog(ctx)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if f == "json" {
+		catalog := map[string]string{}
+		for _, message := range messages {
+			catalog[message.Key] = message.Source
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(catalog)
+	}
+
+	document := xliffDocument{
+		Version: "1.2",
+		File:    xliffFile{Original: "emails", SourceLanguage: "en", TargetLanguage: *lang, Datatype: "plaintext"},
+	}
+	for _, message := range messages {
+		unit := xliffUnit{ID: message.Key, Source: message.Source}
+		if len(message.Variables) > 0 {
+			unit.Note = "Keep every {{...}} placeholder. Variables: " + strings.Join(message.Variables, ", ")
+		}
+		document.File.Units = append(document.File.Units, unit)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+func importCatalog(args []string) error {
+	flags := flag.NewFlagSet("i18n-import", flag.ExitOnError)
+	format := flags.String("format", "", "json or xliff")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: i18n-import [-format json|xliff] file")
+	}
+	path := flags.Arg(0)
+
+	f, err := catalogFormat(*format, path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	translations := map[string]string{}
+	if f == "json" {
+		if err := json.Unmarshal(data, &translations); err != nil {
+			return fmt.Errorf("invalid JSON catalog: %w", err)
+		}
+	} else {
+		var document xliffDocument
+		if err := xml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("invalid XLIFF file: %w", err)
+		}
+		for _, unit := range document.File.Units {
+			translations[unit.ID] = unit.Target
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	saved, err := controllers.ImportMessageCatalog(ctx, translations)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported translations of %d emails.\n", saved)
+	return nil
+}
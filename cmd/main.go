@@ -3,21 +3,35 @@ package main
 import (
 	"context"
 	"errors"
+	"jsmi-api/controllers"
 	"jsmi-api/db"
+	"jsmi-api/events"
+	"jsmi-api/jobs"
+	"jsmi-api/mailer"
+	"jsmi-api/media"
+	"jsmi-api/metrics"
 	"jsmi-api/middlewares"
 	"jsmi-api/routes"
+	"jsmi-api/storage"
 	"jsmi-api/utils"
+	"jsmi-api/validation"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 )
 
 func main() {
+	// Maintenance commands, e.g. i18n-export, run instead of the server
+	if len(os.Args) > 1 && runCommand(os.Args[1:]) {
+		return
+	}
+
 	// Load configuration
 	config, err := db.LoadDBConfig()
 	if err != nil {
@@ -31,6 +45,17 @@ func main() {
 		log.Fatalf("Error initializing Redis: %v", err)
 	}
 
+	// Initialize file storage
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Error initializing storage: %v", err)
+	}
+
+	// Start the background mail dispatcher
+	if err := mailer.Init(2); err != nil {
+		log.Fatalf("Error initializing mailer: %v", err)
+	}
+	mailer.SetContentSource(controllers.LoadEmailTemplateContent)
+
 	// Migrate the database
 	migrateCfg := db.MigrateConfig{
 		DBURL: config.DBURL,
@@ -40,11 +65,24 @@ func main() {
 		log.Fatalf("Error migrating database: %v", err)
 	}
 
+	// Start background jobs
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	scheduler := jobs.NewScheduler()
+	registerJobs(scheduler)
+	scheduler.Start(jobsCtx)
+
+	events.Start(jobsCtx)
+	metrics.Start(jobsCtx)
+
+	queue := jobs.NewQueue(2)
+	registerTaskHandlers(queue)
+	queue.Start(jobsCtx)
+
 	// Set up routes and middlewares
 	handler := routes.SetupRoutes(config)
 
 	// Wrap the handler with the bearer token middleware
-	handler = middlewares.ValidateBearerToken()(handler)
+	handler = middlewares.ValidateBearerToken(controllers.PublicPaths()...)(handler)
 
 	srv := &http.Server{
 		Addr:           ":8000",
@@ -80,10 +118,72 @@ func main() {
 		log.Fatalf("Server shutdown failed: %+v", err)
 	}
 
+	cancelJobs()
+	scheduler.Wait()
+	queue.Wait()
+
+	// Flush what the last requests buffered; batches are claimed, so this is
+	// safe next to another instance's flush, which picks up anything left over.
+	if err := db.FlushWriteBuffers(shutdownCtx); err != nil {
+		log.Printf("Failed to flush write buffers: %v", err)
+	}
+	if err := metrics.Flush(shutdownCtx); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+	mailer.Shutdown()
+
 	wg.Wait() // Wait for all goroutines to finish before exiting
 	log.Println("Server exited gracefully")
 }
 
+// registerJobs schedules the recurring background jobs.
+func registerJobs(scheduler *jobs.Scheduler) {
+	consistencyHour := 3
+	if value := os.Getenv("CONSISTENCY_CHECK_HOUR"); value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil || hour < 0 || hour > 23 {
+			log.Fatalf("CONSISTENCY_CHECK_HOUR must be an hour between 0 and 23")
+		}
+		consistencyHour = hour
+	}
+	scheduler.Daily("cache-consistency", consistencyHour, 0, controllers.RunConsistencyCheck)
+	scheduler.Daily("content-integrity", consistencyHour, 30, controllers.RunIntegrityCheck)
+	scheduler.Daily("refresh-token-cleanup", consistencyHour, 45, controllers.PurgeExpiredRefreshTokens)
+	scheduler.Daily("content-tombstone-cleanup", consistencyHour, 50, controllers.PurgeContentTombstones)
+	scheduler.Daily("post-trash-cleanup", consistencyHour, 52, controllers.PurgeTrashedPosts)
+	scheduler.Daily("post-image-cleanup", consistencyHour, 55, controllers.PurgeUnusedPostImages)
+	scheduler.Daily("webhook-delivery-cleanup", consistencyHour, 57, controllers.PurgeWebhookDeliveries)
+	scheduler.Daily("partition-maintenance", consistencyHour, 10, controllers.MaintainPartitions)
+	scheduler.Daily("care-follow-up-reminders", 7, 0, controllers.RunCareReminders)
+	scheduler.Daily("announcement-reminders", 8, 0, controllers.RunAnnouncementReminders)
+	scheduler.Weekly("celebration-digest", time.Monday, 7, 5, controllers.RunCelebrationDigest)
+	scheduler.Weekly("operations-report", time.Monday, 6, 0, controllers.RunOpsReport)
+	scheduler.Monthly("content-freshness-report", 1, consistencyHour, 15, controllers.RunFreshnessReport)
+	scheduler.Every("api-usage-rollup", 10*time.Minute, controllers.RollupAPIClientUsage)
+	scheduler.Every("post-views-flush", 5*time.Minute, controllers.FlushPostViews)
+	scheduler.Every("summary-refresh", 5*time.Minute, controllers.RefreshSummaries)
+	scheduler.Every("trending-refresh", 10*time.Minute, controllers.RefreshTrendingPosts)
+	scheduler.Every("live-archival", 5*time.Minute, controllers.ArchiveEndedLives)
+	scheduler.Every("youtube-sync", 2*time.Minute, controllers.SyncYouTubeBroadcasts)
+	scheduler.Every("live-status-events", 15*time.Second, controllers.PublishLiveStatusChanges)
+	scheduler.Every("live-viewer-rollup", time.Minute, controllers.RollupLiveViewers)
+	scheduler.Every("write-buffer-flush", 10*time.Second, db.FlushWriteBuffers)
+	scheduler.Every("pending-donation-reconciliation", time.Minute, controllers.ReconcilePendingDonations)
+}
+
+// registerTaskHandlers registers the handlers of queued jobs.
+func registerTaskHandlers(queue *jobs.Queue) {
+	queue.Handle(controllers.JobRenderPDF, controllers.RenderPDF)
+	queue.Handle(controllers.JobCourseCertificate, controllers.RenderCourseCertificate)
+	queue.Handle(controllers.JobEmailCampaign, controllers.DeliverEmailCampaign)
+	queue.Handle(controllers.JobExtractDocumentText, controllers.ExtractDocumentText)
+	queue.Handle(controllers.JobNotifySearchEngines, controllers.NotifySearchEngines)
+	queue.Handle(controllers.JobPurgeCDN, controllers.PurgeCDN)
+	queue.Handle(controllers.JobDeliverWebhook, controllers.DeliverWebhook)
+	queue.Handle(controllers.JobExportPosts, controllers.ExportPosts)
+	queue.Handle(controllers.JobGivingStatement, controllers.RenderGivingStatement)
+}
+
 func envCheck() {
 	// Check bearer token environment variable
 	if _, err := middlewares.LoadBearerTokenConfig(); err != nil {
@@ -99,10 +199,132 @@ func envCheck() {
 		log.Println("Redis configuration environment variable is set.")
 	}
 
-	// Check PASETO secret environment variable
-	if _, err := utils.GetPasetoSecret(); err != nil {
-		log.Fatalf("Error retrieving PASETO secret: %v", err)
+	// Check token signing keys for the configured token format
+	if format, err := utils.CheckTokenConfig(); err != nil {
+		log.Fatalf("Error loading token configuration: %v", err)
+	} else {
+		log.Printf("Token signing keys are set (format: %s).", format)
+	}
+
+	// Check auth cookie attributes
+	if _, err := middlewares.LoadAuthCookieConfig(); err != nil {
+		log.Fatalf("Error loading auth cookie config: %v", err)
+	}
+
+	// Check refresh token lifetimes for the remember-me option
+	if _, err := utils.LoadRefreshTokenLifetimes(); err != nil {
+		log.Fatalf("Error loading refresh token lifetimes: %v", err)
+	}
+
+	// Check the public configuration served to the frontend
+	if _, err := controllers.LoadPublicConfig(); err != nil {
+		log.Fatalf("Error loading public config: %v", err)
+	}
+
+	// Check the optional alt text provider configuration
+	if provider, err := media.LoadAltTextProvider(); err != nil {
+		log.Fatalf("Error loading alt text provider: %v", err)
+	} else if provider != nil {
+		log.Printf("Alt text suggestions enabled (%s).", provider.Name())
+	}
+
+	// Check the optional email tracking URL
+	if baseURL, err := controllers.LoadEmailTrackingBaseURL(); err != nil {
+		log.Fatalf("Error loading email tracking config: %v", err)
+	} else if baseURL != "" {
+		log.Println("Email open and click tracking enabled.")
+	}
+
+	// Check the optional short link URL
+	if baseURL, err := controllers.LoadShortLinkBaseURL(); err != nil {
+		log.Fatalf("Error loading short link config: %v", err)
+	} else if baseURL != "" {
+		log.Printf("Short links enabled at %s.", baseURL)
+	}
+
+	// Check the optional live chat secret
+	if config, err := controllers.LoadChatConfig(); err != nil {
+		log.Fatalf("Error loading chat config: %v", err)
+	} else if len(config.Secret) > 0 {
+		log.Println("Live chat tokens enabled.")
+	}
+	if config, err := controllers.LoadStripeConfig(); err != nil {
+		log.Fatalf("Error loading Stripe config: %v", err)
+	} else if config.SecretKey != "" {
+		log.Println("Online giving through Stripe enabled.")
+	}
+	if config, err := controllers.LoadMpesaConfig(); err != nil {
+		log.Fatalf("Error loading M-Pesa config: %v", err)
+	} else if config.ConsumerKey != "" {
+		log.Println("Online giving through M-Pesa enabled.")
+	}
+	if config, err := controllers.LoadPayPalConfig(); err != nil {
+		log.Fatalf("Error loading PayPal config: %v", err)
+	} else if config.ClientID != "" {
+		log.Println("Online giving through PayPal enabled.")
+	}
+	if config, err := controllers.LoadStatementConfig(); err != nil {
+		log.Fatalf("Error loading giving statement config: %v", err)
+	} else if len(config.URLSecret) > 0 {
+		log.Println("Giving statements enabled.")
+	}
+
+	// Check the streaming sites live links may point to
+	if _, err := validation.LoadLiveStreamHosts(); err != nil {
+		log.Fatalf("Error loading live stream hosts: %v", err)
+	}
+
+	// Check the document text extractor; without one PDFs are not searchable
+	if extractor, err := media.LoadTextExtractor(); err != nil {
+		log.Fatalf("Error loading text extractor: %v", err)
 	} else {
-		log.Println("PASETO secret environment variable is set.")
+		log.Printf("Document text extraction: %s.", extractor.Name())
+	}
+
+	// Check when posts count as stale in the freshness report
+	if _, err := controllers.LoadStaleMonths(); err != nil {
+		log.Fatalf("Error loading freshness report config: %v", err)
+	}
+
+	// Check who gets the weekly operations report
+	if _, err := controllers.LoadOpsReportRecipients(); err != nil {
+		log.Fatalf("Error loading operations report config: %v", err)
+	}
+
+	// Check search engine notifications; they stay off outside production
+	if config, err := controllers.LoadSearchNotifyConfig(); err != nil {
+		log.Fatalf("Error loading search engine notification config: %v", err)
+	} else if config.Enabled {
+		log.Printf("Search engine notifications enabled for %s.", config.SiteURL)
+	}
+
+	// Check how long partitioned audit tables are kept
+	if err := controllers.CheckPartitionRetention(); err != nil {
+		log.Fatalf("Error loading partition retention config: %v", err)
+	}
+
+	// Check the optional safeguarding encryption key; without one reports
+	// cannot be submitted or read
+	if key, err := controllers.LoadSafeguardingKey(); err != nil {
+		log.Fatalf("Error loading safeguarding config: %v", err)
+	} else if key != nil {
+		log.Println("Safeguarding reports enabled.")
+	}
+
+	// Check the optional YouTube integration, which finds the recordings of
+	// archived lives and, with a channel, creates lives from its broadcasts
+	if config, err := controllers.LoadYouTubeConfig(); err != nil {
+		log.Fatalf("Error loading YouTube config: %v", err)
+	} else if config.ChannelID != "" {
+		log.Printf("YouTube broadcasts of channel %s are synced to lives.", config.ChannelID)
+	} else if config.APIKey != "" {
+		log.Println("YouTube integration enabled.")
+	}
+
+	// Check CDN purges; responses are tagged with surrogate keys either way
+	if config, err := controllers.LoadCDNConfig(); err != nil {
+		log.Fatalf("Error loading CDN config: %v", err)
+	} else if config.Provider != "" {
+		log.Printf("CDN purges by surrogate key enabled (%s).", config.Provider)
 	}
 }
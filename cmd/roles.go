@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jsmi-api/auth"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+)
+
+// grantRole gives a user a role, e.g. to appoint the first admin, who can
+// then manage roles through PUT /admin/users/role:
+//
+//	jsmi-api grant-role username member|staff|admin
+func grantRole(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: grant-role username member|staff|admin")
+	}
+	username, role := args[0], args[1]
+	if !middlewares.IsRole(role) {
+		return auth.ErrInvalidRole
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	if err := db.InitRedis(); err != nil {
+		return err
+	}
+
+	users := auth.NewUserService(db.DB, db.RedisClient)
+	user, err := users.GetByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("%w: %s", auth.ErrUserNotFound, username)
+	}
+	if err := users.UpdateRole(ctx, user.ID, role); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", username, role)
+	return nil
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"jsmi-api/auth"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupAdminRoutes registers the admin endpoints. Account changes go through
+// the auth handler's user service.
+func SetupAdminRoutes(r *mux.Router, h *AuthHandler) {
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middlewares.TokenAuthMiddleware, middlewares.AdminOnly)
+	adminRouter.HandleFunc("/stats", GetAdminStats).Methods("GET")
+	adminRouter.HandleFunc("/posts/stats", GetPostStats).Methods("GET")
+	adminRouter.HandleFunc("/runbook", GetRunbookActions).Methods("GET")
+	adminRouter.HandleFunc("/runbook/{action}", RunRunbookAction).Methods("POST")
+	adminRouter.HandleFunc("/media/quotas", SetMediaQuota).Methods("PUT").Queries("namespace", "{namespace}")
+	adminRouter.HandleFunc("/users/status", h.SetUserStatus).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/users/role", h.SetUserRole).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/impersonate", h.ImpersonateUser).Methods("POST")
+	adminRouter.HandleFunc("/users/tags", SetUserTags).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/tags", GetTags).Methods("GET")
+	adminRouter.HandleFunc("/consents", GetUserConsents).Methods("GET").Queries("user_id", "{user_id}")
+	adminRouter.HandleFunc("/consents", SetUserConsents).Methods("PUT").Queries("user_id", "{user_id}")
+	adminRouter.HandleFunc("/corrections", GetDataCorrections).Methods("GET")
+	adminRouter.HandleFunc("/corrections/apply", ApplyDataCorrection).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("/corrections/reject", RejectDataCorrection).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("/safeguarding/officers", GetSafeguardingOfficers).Methods("GET")
+	adminRouter.HandleFunc("/safeguarding/officers", AppointSafeguardingOfficer).Methods("POST").Queries("user_id", "{user_id}")
+	adminRouter.HandleFunc("/safeguarding/officers", RemoveSafeguardingOfficer).Methods("DELETE").Queries("user_id", "{user_id}")
+	adminRouter.HandleFunc("/safeguarding/audit", GetSafeguardingAudit).Methods("GET")
+	adminRouter.HandleFunc("/segments", GetEmailSegments).Methods("GET")
+	adminRouter.HandleFunc("/segments", CreateEmailSegment).Methods("POST")
+	adminRouter.HandleFunc("/segments", UpdateEmailSegment).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/segments", DeleteEmailSegment).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/segments/members", GetEmailSegmentMembers).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/campaigns", GetEmailCampaigns).Methods("GET")
+	adminRouter.HandleFunc("/campaigns", CreateEmailCampaign).Methods("POST")
+	adminRouter.HandleFunc("/campaigns/send", SendEmailCampaign).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("/campaigns/report", GetEmailCampaignReport).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/api-clients", GetAPIClients).Methods("GET")
+	adminRouter.HandleFunc("/api-clients", RevokeAPIClient).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/api-clients/usage", GetAPIClientUsage).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/api-clients/limits", SetAPIClientLimits).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/devices", GetDisplayDevices).Methods("GET")
+	adminRouter.HandleFunc("/devices/approve", ApproveDisplayDevice).Methods("POST")
+	adminRouter.HandleFunc("/devices", RevokeDisplayDevice).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/devices/mode", SetDisplayDeviceMode).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/donations", GetDonations).Methods("GET")
+	adminRouter.HandleFunc("/check-ins", GetCheckIns).Methods("GET")
+	adminRouter.HandleFunc("/signage/playlists", GetSignagePlaylists).Methods("GET")
+	adminRouter.HandleFunc("/signage/playlists", CreateSignagePlaylist).Methods("POST")
+	adminRouter.HandleFunc("/signage/playlists", UpdateSignagePlaylist).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/signage/playlists", DeleteSignagePlaylist).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/webhooks", GetWebhooks).Methods("GET")
+	adminRouter.HandleFunc("/webhooks", CreateWebhook).Methods("POST")
+	adminRouter.HandleFunc("/webhooks", UpdateWebhook).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/webhooks", DeleteWebhook).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/webhooks/secret", RotateWebhookSecret).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("/webhooks/deliveries", GetWebhookDeliveries).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/email-templates", GetEmailTemplates).Methods("GET")
+	adminRouter.HandleFunc("/email-templates", CreateEmailTemplate).Methods("POST")
+	adminRouter.HandleFunc("/email-templates", UpdateEmailTemplate).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("/email-templates", DeleteEmailTemplate).Methods("DELETE").Queries("id", "{id}")
+	adminRouter.HandleFunc("/email-templates/versions", GetEmailTemplateVersions).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/email-templates/restore", RestoreEmailTemplateVersion).Methods("POST").Queries("id", "{id}", "version", "{version}")
+	adminRouter.HandleFunc("/email-templates/preview", PreviewEmailTemplate).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("/audit", GetAdminAuditLog).Methods("GET")
+	adminRouter.HandleFunc("/pdf", CreatePDF).Methods("POST")
+	adminRouter.HandleFunc("/exports/posts", CreatePostExport).Methods("POST")
+	adminRouter.HandleFunc("/jobs", GetJob).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/media/download", DownloadMedia).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/consistency", GetConsistencyReport).Methods("GET")
+	adminRouter.HandleFunc("/consistency", RunConsistencyCheckNow).Methods("POST")
+	adminRouter.HandleFunc("/cache/invalidate", InvalidateEntityCache).Methods("POST").Queries("entity", "{entity}")
+	adminRouter.HandleFunc("/integrity", RunIntegrityCheckNow).Methods("POST")
+	adminRouter.HandleFunc("/reports/freshness", GetFreshnessReport).Methods("GET")
+	adminRouter.HandleFunc("/reports/freshness", RunFreshnessReportNow).Methods("POST")
+	adminRouter.HandleFunc("/reports/operations", GetOpsReport).Methods("GET")
+	adminRouter.HandleFunc("/redirects", GetRedirects).Methods("GET")
+	adminRouter.HandleFunc("/redirects", SaveRedirect).Methods("POST")
+	adminRouter.HandleFunc("/redirects", DeleteRedirect).Methods("DELETE").Queries("from_path", "{from_path}")
+	adminRouter.HandleFunc("/integrity/alerts", GetIntegrityAlerts).Methods("GET")
+	adminRouter.HandleFunc("/integrity/alerts", ResolveIntegrityAlert).Methods("PUT").Queries("id", "{id}")
+}
+
+// SetUserStatus suspends or reactivates a user account.
+func (h *AuthHandler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if payload.Status != models.UserStatusActive && payload.Status != models.UserStatusSuspended {
+		http.Error(w, "status must be either active or suspended", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if adminID, _ := middlewares.UserIDFromContext(ctx); adminID == userID {
+		http.Error(w, "Admins cannot change their own status", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Users.UpdateStatus(ctx, userID, payload.Status); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update user status", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]interface{}{"id": userID, "status": payload.Status}, http.StatusOK)
+}
+
+// SetUserRole makes a user a member, staff member or admin. The first admin
+// is appointed with the grant-role command.
+func (h *AuthHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if !middlewares.IsRole(payload.Role) {
+		http.Error(w, "role must be member, staff or admin", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	// Admins cannot lock themselves, possibly the last admin, out.
+	if adminID, _ := middlewares.UserIDFromContext(ctx); adminID == userID {
+		http.Error(w, "Admins cannot change their own role", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Users.UpdateRole(ctx, userID, payload.Role); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update user role", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]interface{}{"id": userID, "role": payload.Role}, http.StatusOK)
+}
+
+// AdminStats is the payload of GET /admin/stats.
+type AdminStats struct {
+	Media []media.NamespaceUsage `json:"media"`
+	// Email summarizes campaigns sent in the last 30 days.
+	Email models.EmailStats `json:"email"`
+}
+
+func GetAdminStats(w http.ResponseWriter, r *http.Request) {
+	usage, err := media.ListNamespaceUsage(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch media usage", http.StatusInternalServerError, err)
+		return
+	}
+
+	email, err := queryEmailStats(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch email stats", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, AdminStats{Media: usage, Email: email}, http.StatusOK)
+}
+
+func SetMediaQuota(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+
+	var payload struct {
+		// QuotaMB is the new quota in megabytes; null restores the default quota.
+		QuotaMB *int64 `json:"quota_mb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	var quotaBytes *int64
+	if payload.QuotaMB != nil {
+		if *payload.QuotaMB < 0 {
+			http.Error(w, "quota_mb must not be negative", http.StatusBadRequest)
+			return
+		}
+		bytes := *payload.QuotaMB << 20
+		quotaBytes = &bytes
+	}
+
+	ctx := r.Context()
+	if err := media.SetQuota(ctx, namespace, quotaBytes); err != nil {
+		if errors.Is(err, media.ErrInvalidNamespace) {
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to set quota", http.StatusInternalServerError, err)
+		return
+	}
+
+	usage, err := media.GetNamespaceUsage(ctx, namespace)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch media usage", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, usage, http.StatusOK)
+}
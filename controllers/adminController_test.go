@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetUserRoleRejectsUnknownRoles(t *testing.T) {
+	mockDB(t)
+	handler := &AuthHandler{}
+	for _, role := range []string{"", "Admin", "owner", " staff"} {
+		recorder := serve(handler.SetUserRole, http.MethodPut, "/admin/users/role?id=7", `{"role": "`+role+`"}`)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("role %q: status = %d, want %d", role, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	emailAnnouncementReminder = "announcement_acknowledgement_reminder"
+	// announcementReminderInterval is how often staff are reminded of a
+	// critical announcement they have not acknowledged.
+	announcementReminderInterval = 20 * time.Hour
+	// announcementReminderWindow is how long after it was made an
+	// announcement is reminded of.
+	announcementReminderWindow = 30 * 24 * time.Hour
+)
+
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// SetupAnnouncementRoutes registers the staff announcement endpoints. Staff
+// read and acknowledge announcements; admins make them and see who has
+// acknowledged them.
+func SetupAnnouncementRoutes(r *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.AdminOnly(h))
+	}
+
+	announcementsRouter := r.PathPrefix("/announcements").Subrouter()
+	announcementsRouter.Handle("", staff(GetStaffAnnouncement)).Methods("GET").Queries("id", "{id}")
+	announcementsRouter.Handle("", staff(GetStaffAnnouncements)).Methods("GET")
+	announcementsRouter.Handle("", admin(CreateStaffAnnouncement)).Methods("POST")
+	announcementsRouter.Handle("", admin(DeleteStaffAnnouncement)).Methods("DELETE").Queries("id", "{id}")
+	announcementsRouter.Handle("/acknowledge", staff(AcknowledgeStaffAnnouncement)).Methods("POST").Queries("id", "{id}")
+	announcementsRouter.Handle("/receipts", admin(GetAnnouncementReceipts)).Methods("GET").Queries("id", "{id}")
+}
+
+// announcementColumns are the columns scanAnnouncement reads; the
+// acknowledgement is the one of the user in $1.
+const announcementColumns = `a.id, a.title, a.body, a.critical, a.created_by, a.created_at, k.acknowledged_at`
+
+const announcementJoin = `FROM staff_announcements a
+	LEFT JOIN staff_announcement_acknowledgements k ON k.announcement_id = a.id AND k.user_id = $1`
+
+func scanAnnouncement(row rowScanner) (models.StaffAnnouncement, error) {
+	var announcement models.StaffAnnouncement
+	err := row.Scan(&announcement.ID, &announcement.Title, &announcement.Body, &announcement.Critical,
+		&announcement.CreatedBy, &announcement.CreatedAt, &announcement.AcknowledgedAt)
+	return announcement, err
+}
+
+func queryAnnouncement(ctx context.Context, id uuid.UUID, userID int64) (models.StaffAnnouncement, error) {
+	announcement, err := scanAnnouncement(db.DB.QueryRowContext(ctx, "SELECT "+announcementColumns+" "+announcementJoin+" WHERE a.id = $2", userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.StaffAnnouncement{}, ErrAnnouncementNotFound
+	}
+	if err != nil {
+		return models.StaffAnnouncement{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return announcement, nil
+}
+
+func respondAnnouncementError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, ErrAnnouncementNotFound) {
+		middlewares.HttpError(w, "Announcement not found", http.StatusNotFound, err)
+		return
+	}
+	middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+}
+
+// GetStaffAnnouncements lists announcements, newest first, each with when
+// the caller acknowledged it. ?pending=true lists only the critical ones the
+// caller has yet to acknowledge.
+func GetStaffAnnouncements(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	pending := r.URL.Query().Get("pending") == "true"
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	const filter = `(NOT $2 OR (a.critical AND k.acknowledged_at IS NULL))`
+
+	var total int
+	err = db.DB.QueryRowContext(ctx, "SELECT COUNT(*) "+announcementJoin+" WHERE "+filter, userID, pending).Scan(&total)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch announcements", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+announcementColumns+" "+announcementJoin+`
+		WHERE `+filter+`
+		ORDER BY a.created_at DESC, a.id
+		LIMIT $3 OFFSET $4`, userID, pending, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch announcements", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	announcements := []models.StaffAnnouncement{}
+	for rows.Next() {
+		announcement, err := scanAnnouncement(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch announcements", http.StatusInternalServerError, err)
+			return
+		}
+		announcements = append(announcements, announcement)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch announcements", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.StaffAnnouncement]{
+		Items:   announcements,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetStaffAnnouncement returns an announcement with when the caller
+// acknowledged it.
+func GetStaffAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	announcement, err := queryAnnouncement(ctx, id, userID)
+	if err != nil {
+		respondAnnouncementError(w, "Failed to fetch announcement", err)
+		return
+	}
+	middlewares.RespondJSON(w, announcement, http.StatusOK)
+}
+
+// CreateStaffAnnouncement makes an announcement to staff. Staff who have not
+// acknowledged a critical one are reminded by RunAnnouncementReminders.
+func CreateStaffAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var announcement models.StaffAnnouncement
+	if err := json.NewDecoder(r.Body).Decode(&announcement); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateStaffAnnouncement(&announcement); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	err := db.DB.QueryRowContext(ctx, `INSERT INTO staff_announcements (title, body, critical, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_by, created_at`,
+		announcement.Title, announcement.Body, announcement.Critical, userID).
+		Scan(&announcement.ID, &announcement.CreatedBy, &announcement.CreatedAt)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create announcement", http.StatusInternalServerError, err)
+		return
+	}
+	announcement.AcknowledgedAt = nil
+
+	middlewares.RespondCreated(w, "/announcements?id="+announcement.ID.String(), announcement)
+}
+
+// DeleteStaffAnnouncement removes an announcement and its acknowledgements.
+func DeleteStaffAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM staff_announcements WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete announcement", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		respondAnnouncementError(w, "", ErrAnnouncementNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcknowledgeStaffAnnouncement records that the caller has read an
+// announcement. Acknowledging it again keeps the first time.
+func AcknowledgeStaffAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO staff_announcement_acknowledgements (announcement_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, id, userID)
+	if isForeignKeyViolation(err) {
+		respondAnnouncementError(w, "", ErrAnnouncementNotFound)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to acknowledge announcement", http.StatusInternalServerError, err)
+		return
+	}
+
+	announcement, err := queryAnnouncement(ctx, id, userID)
+	if err != nil {
+		respondAnnouncementError(w, "Failed to fetch announcement", err)
+		return
+	}
+	middlewares.RespondJSON(w, announcement, http.StatusOK)
+}
+
+// GetAnnouncementReceipts reports which active staff members have
+// acknowledged an announcement and which have not. Former staff who
+// acknowledged it are still listed.
+func GetAnnouncementReceipts(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var exists bool
+	if err := db.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM staff_announcements WHERE id = $1)", id).Scan(&exists); err != nil {
+		middlewares.HttpError(w, "Failed to fetch receipts", http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		respondAnnouncementError(w, "", ErrAnnouncementNotFound)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT u.id, u.username, k.acknowledged_at
+		FROM users u
+		LEFT JOIN staff_announcement_acknowledgements k ON k.user_id = u.id AND k.announcement_id = $1
+		WHERE k.user_id IS NOT NULL OR (u.role IN ($2, $3) AND u.status = $4)
+		ORDER BY k.acknowledged_at NULLS LAST, u.username`,
+		id, middlewares.RoleStaff, middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch receipts", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	receipts := models.AnnouncementReceipts{
+		AnnouncementID: id,
+		Acknowledged:   []models.AnnouncementReceipt{},
+		Pending:        []models.AnnouncementReceipt{},
+	}
+	for rows.Next() {
+		var receipt models.AnnouncementReceipt
+		if err := rows.Scan(&receipt.UserID, &receipt.Username, &receipt.AcknowledgedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch receipts", http.StatusInternalServerError, err)
+			return
+		}
+		if receipt.AcknowledgedAt != nil {
+			receipts.Acknowledged = append(receipts.Acknowledged, receipt)
+		} else {
+			receipts.Pending = append(receipts.Pending, receipt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch receipts", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, receipts, http.StatusOK)
+}
+
+type pendingAnnouncement struct {
+	ID        uuid.UUID
+	Title     string
+	CreatedAt time.Time
+}
+
+type announcementReminderEmailData struct {
+	Username      string
+	Announcements []pendingAnnouncement
+}
+
+// RunAnnouncementReminders is the daily job that emails each active staff
+// member the critical announcements of the last 30 days they have not
+// acknowledged. An announcement is reminded of at most once a day.
+func RunAnnouncementReminders(ctx context.Context) error {
+	rows, err := db.DB.QueryContext(ctx, `SELECT a.id, a.title, a.created_at, u.id, u.username, u.email
+		FROM staff_announcements a
+		CROSS JOIN users u
+		WHERE a.critical AND a.created_at > NOW() - $1 * INTERVAL '1 second'
+			AND (a.reminded_at IS NULL OR a.reminded_at < NOW() - $2 * INTERVAL '1 second')
+			AND u.role IN ($3, $4) AND u.status = $5
+			AND NOT EXISTS (SELECT 1 FROM staff_announcement_acknowledgements k WHERE k.announcement_id = a.id AND k.user_id = u.id)
+		ORDER BY u.id, a.created_at`,
+		announcementReminderWindow.Seconds(), announcementReminderInterval.Seconds(),
+		middlewares.RoleStaff, middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	type recipient struct {
+		email string
+		data  announcementReminderEmailData
+	}
+	recipients := map[int64]*recipient{}
+	var order []int64
+	reminded := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var (
+			announcement pendingAnnouncement
+			userID       int64
+			username     string
+			email        string
+		)
+		if err := rows.Scan(&announcement.ID, &announcement.Title, &announcement.CreatedAt, &userID, &username, &email); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if recipients[userID] == nil {
+			recipients[userID] = &recipient{email: email, data: announcementReminderEmailData{Username: username}}
+			order = append(order, userID)
+		}
+		recipients[userID].data.Announcements = append(recipients[userID].data.Announcements, announcement)
+		reminded[announcement.ID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, userID := range order {
+		recipient := recipients[userID]
+		if err := mailer.SendTemplate(emailAnnouncementReminder, recipient.email, recipient.data); err != nil {
+			log.Printf("Failed to queue announcement reminder for %s: %v", recipient.data.Username, err)
+		}
+	}
+
+	if len(reminded) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(reminded))
+	for id := range reminded {
+		ids = append(ids, id.String())
+	}
+	if _, err := db.DB.ExecContext(ctx, "UPDATE staff_announcements SET reminded_at = NOW() WHERE id = ANY($1::uuid[])", pq.Array(ids)); err != nil {
+		return fmt.Errorf("error updating announcements: %w", err)
+	}
+	return nil
+}
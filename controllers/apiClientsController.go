@@ -0,0 +1,466 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// PublicAPIPrefix is the path of the public API. Clients authenticate with
+// their own token instead of the site's bearer token.
+const PublicAPIPrefix = "/public/v1/"
+
+const (
+	maxClientsPerUser     = 5
+	maxClientRateLimit    = 600
+	maxClientMonthlyQuota = 10_000_000
+	// clientTokenPrefixLength keeps "jsmi_" and six hex digits of a token so
+	// that developers can tell their clients apart.
+	clientTokenPrefixLength = 11
+	// clientUsageDays is how much daily usage the usage endpoints return.
+	clientUsageDays = 30
+)
+
+var (
+	ErrAPIClientNotFound = errors.New("API client not found")
+	ErrTooManyAPIClients = fmt.Errorf("at most %d API clients can be registered", maxClientsPerUser)
+)
+
+// SetupPublicAPIRoutes registers the read-only public API and the endpoints
+// developers use to manage their clients.
+func SetupPublicAPIRoutes(router, protected *mux.Router) {
+	publicRouter := router.PathPrefix(strings.TrimSuffix(PublicAPIPrefix, "/")).Subrouter()
+	publicRouter.Use(middlewares.ClientTokenAuth)
+	publicRouter.HandleFunc("/posts", GetPost).Methods("GET").Queries("id", "{id}")
+	publicRouter.HandleFunc("/posts", GetPostBySlug).Methods("GET").Queries("slug", "{slug}")
+	publicRouter.HandleFunc("/posts/{slug:[a-z0-9-]+}", GetPostBySlug).Methods("GET")
+	publicRouter.HandleFunc("/posts", GetPosts).Methods("GET")
+	publicRouter.HandleFunc("/lives", GetLive).Methods("GET").Queries("id", "{id}")
+	publicRouter.HandleFunc("/lives", GetLives).Methods("GET")
+
+	developerRouter := protected.PathPrefix("/developer/clients").Subrouter()
+	developerRouter.Use(middlewares.TokenAuthMiddleware, middlewares.NoImpersonation)
+	developerRouter.HandleFunc("", GetMyAPIClients).Methods("GET")
+	developerRouter.HandleFunc("", CreateAPIClient).Methods("POST")
+	developerRouter.HandleFunc("", RevokeMyAPIClient).Methods("DELETE").Queries("id", "{id}")
+	developerRouter.HandleFunc("/usage", GetMyAPIClientUsage).Methods("GET").Queries("id", "{id}")
+}
+
+const apiClientColumns = "id, user_id, name, token_prefix, rate_limit, monthly_quota, revoked_at, last_used_at, created_at"
+
+func scanAPIClient(row rowScanner) (models.APIClient, error) {
+	var client models.APIClient
+	err := row.Scan(&client.ID, &client.UserID, &client.Name, &client.TokenPrefix, &client.RateLimit, &client.MonthlyQuota,
+		&client.RevokedAt, &client.LastUsedAt, &client.CreatedAt)
+	return client, err
+}
+
+func queryAPIClients(ctx context.Context, userID *int64) ([]models.APIClient, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+apiClientColumns+` FROM api_clients
+		WHERE $1::integer IS NULL OR user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []models.APIClient{}
+	for rows.Next() {
+		client, err := scanAPIClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return clients, nil
+}
+
+// GetMyAPIClients lists the clients registered by the current user.
+func GetMyAPIClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	clients, err := queryAPIClients(ctx, &userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch API clients", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, clients, http.StatusOK)
+}
+
+// CreateAPIClient registers a public API client. The token is only returned
+// in this response.
+func CreateAPIClient(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateAPIClientName(payload.Name); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	client, err := createAPIClient(ctx, userID, strings.TrimSpace(payload.Name))
+	if err != nil {
+		if errors.Is(err, ErrTooManyAPIClients) {
+			middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create API client", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, client, http.StatusCreated)
+}
+
+func createAPIClient(ctx context.Context, userID int64, name string) (models.APIClient, error) {
+	token, hash, err := middlewares.GenerateClientToken()
+	if err != nil {
+		return models.APIClient{}, err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIClient{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so that concurrent requests cannot exceed the limit.
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return models.APIClient{}, fmt.Errorf("error querying database: %w", err)
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_clients WHERE user_id = $1 AND revoked_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return models.APIClient{}, fmt.Errorf("error counting API clients: %w", err)
+	}
+	if count >= maxClientsPerUser {
+		return models.APIClient{}, ErrTooManyAPIClients
+	}
+
+	client, err := scanAPIClient(tx.QueryRowContext(ctx, `INSERT INTO api_clients (user_id, name, token_hash, token_prefix)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+apiClientColumns, userID, name, hash, token[:clientTokenPrefixLength]))
+	if err != nil {
+		return models.APIClient{}, fmt.Errorf("error creating API client: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.APIClient{}, err
+	}
+
+	client.Token = token
+	return client, nil
+}
+
+// RevokeMyAPIClient revokes one of the current user's clients.
+func RevokeMyAPIClient(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	if err := revokeAPIClient(ctx, id, &userID); err != nil {
+		if errors.Is(err, ErrAPIClientNotFound) {
+			middlewares.HttpError(w, "API client not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to revoke API client", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAPIClient revokes a client; with a non-nil userID only if it belongs
+// to that user.
+func revokeAPIClient(ctx context.Context, id uuid.UUID, userID *int64) error {
+	var hash string
+	err := db.DB.QueryRowContext(ctx, `UPDATE api_clients SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND ($2::integer IS NULL OR user_id = $2)
+		RETURNING token_hash`, id, userID).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAPIClientNotFound
+		}
+		return fmt.Errorf("error revoking API client: %w", err)
+	}
+
+	middlewares.ForgetClientToken(ctx, hash)
+	return nil
+}
+
+// GetMyAPIClientUsage returns the quota and daily usage of one of the current
+// user's clients.
+func GetMyAPIClientUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	usage, err := queryAPIClientUsage(ctx, id, &userID)
+	if err != nil {
+		if errors.Is(err, ErrAPIClientNotFound) {
+			middlewares.HttpError(w, "API client not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch usage", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, usage, http.StatusOK)
+}
+
+func queryAPIClientUsage(ctx context.Context, id uuid.UUID, userID *int64) (*models.APIClientUsageReport, error) {
+	report := models.APIClientUsageReport{Days: []models.APIClientUsage{}}
+	err := db.DB.QueryRowContext(ctx, `SELECT monthly_quota FROM api_clients
+		WHERE id = $1 AND ($2::integer IS NULL OR user_id = $2)`, id, userID).Scan(&report.Quota.Limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIClientNotFound
+		}
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+
+	now := time.Now()
+	used, err := db.RedisClient.Get(ctx, middlewares.ClientQuotaKey(id, now)).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error fetching quota usage from Redis: %w", err)
+	}
+	report.Quota.Used = used
+	report.Quota.Remaining = max(report.Quota.Limit-used, 0)
+	report.Quota.ResetsAt = middlewares.QuotaReset(now)
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT TO_CHAR(day, 'YYYY-MM-DD'), requests, rejected, bytes
+		FROM api_client_usage
+		WHERE client_id = $1 AND day > CURRENT_DATE - $2::integer
+		ORDER BY day DESC`, id, clientUsageDays)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day models.APIClientUsage
+		if err := rows.Scan(&day.Day, &day.Requests, &day.Rejected, &day.Bytes); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		report.Days = append(report.Days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return &report, nil
+}
+
+// GetAPIClients lists every registered client for admins.
+func GetAPIClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := queryAPIClients(r.Context(), nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch API clients", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, clients, http.StatusOK)
+}
+
+// GetAPIClientUsage returns the quota and daily usage of any client.
+func GetAPIClientUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	usage, err := queryAPIClientUsage(r.Context(), id, nil)
+	if err != nil {
+		if errors.Is(err, ErrAPIClientNotFound) {
+			middlewares.HttpError(w, "API client not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch usage", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, usage, http.StatusOK)
+}
+
+// SetAPIClientLimits changes the per-minute rate limit and monthly quota of a
+// client, e.g. to grant a trusted partner more than the default. Omitted
+// limits are left unchanged.
+func SetAPIClientLimits(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		RateLimit    *int `json:"rate_limit"`
+		MonthlyQuota *int `json:"monthly_quota"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if payload.RateLimit != nil && (*payload.RateLimit < 1 || *payload.RateLimit > maxClientRateLimit) {
+		http.Error(w, fmt.Sprintf("rate_limit must be between 1 and %d", maxClientRateLimit), http.StatusBadRequest)
+		return
+	}
+	if payload.MonthlyQuota != nil && (*payload.MonthlyQuota < 1 || *payload.MonthlyQuota > maxClientMonthlyQuota) {
+		http.Error(w, fmt.Sprintf("monthly_quota must be between 1 and %d", maxClientMonthlyQuota), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	client, err := scanAPIClient(db.DB.QueryRowContext(ctx, `UPDATE api_clients
+		SET rate_limit = COALESCE($1, rate_limit), monthly_quota = COALESCE($2, monthly_quota)
+		WHERE id = $3
+		RETURNING `+apiClientColumns, payload.RateLimit, payload.MonthlyQuota, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "API client not found", http.StatusNotFound, ErrAPIClientNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update API client", http.StatusInternalServerError, err)
+		return
+	}
+
+	var hash string
+	if err := db.DB.QueryRowContext(ctx, "SELECT token_hash FROM api_clients WHERE id = $1", id).Scan(&hash); err == nil {
+		middlewares.ForgetClientToken(ctx, hash)
+	}
+
+	middlewares.RespondJSON(w, client, http.StatusOK)
+}
+
+// RevokeAPIClient revokes any client, e.g. one that misuses the API.
+func RevokeAPIClient(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	if err := revokeAPIClient(r.Context(), id, nil); err != nil {
+		if errors.Is(err, ErrAPIClientNotFound) {
+			middlewares.HttpError(w, "API client not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to revoke API client", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RollupAPIClientUsage copies the usage counted in Redis into
+// api_client_usage. Redis holds each day's running totals, so the rollup can
+// run any number of times; days before today are removed from Redis once
+// they are stored.
+func RollupAPIClientUsage(ctx context.Context) error {
+	today := middlewares.ClientUsageKey(time.Now())
+	iter := db.RedisClient.Scan(ctx, 0, "api_usage:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		day, err := time.Parse(time.DateOnly, strings.TrimPrefix(key, "api_usage:"))
+		if err != nil {
+			continue
+		}
+		if err := rollupClientUsageDay(ctx, key, day); err != nil {
+			return err
+		}
+		if key != today {
+			if err := db.RedisClient.Del(ctx, key).Err(); err != nil {
+				return fmt.Errorf("error removing rolled up usage: %w", err)
+			}
+		}
+	}
+	return iter.Err()
+}
+
+func rollupClientUsageDay(ctx context.Context, key string, day time.Time) error {
+	fields, err := db.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("error fetching usage from Redis: %w", err)
+	}
+
+	type counters struct {
+		requests, rejected, bytes, lastUsed int64
+	}
+	usage := map[uuid.UUID]*counters{}
+	for field, value := range fields {
+		idStr, name, ok := strings.Cut(field, ":")
+		id, err := uuid.Parse(idStr)
+		if !ok || err != nil {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if usage[id] == nil {
+			usage[id] = &counters{}
+		}
+		switch name {
+		case "requests":
+			usage[id].requests = n
+		case "rejected":
+			usage[id].rejected = n
+		case "bytes":
+			usage[id].bytes = n
+		case "last_used":
+			usage[id].lastUsed = n
+		}
+	}
+
+	for id, c := range usage {
+		// GREATEST keeps the rollup from lowering counts if Redis lost data.
+		// Clients deleted since are skipped.
+		_, err := db.DB.ExecContext(ctx, `INSERT INTO api_client_usage (client_id, day, requests, rejected, bytes)
+			SELECT $1, $2, $3, $4, $5 WHERE EXISTS (SELECT 1 FROM api_clients WHERE id = $1)
+			ON CONFLICT (client_id, day) DO UPDATE SET
+				requests = GREATEST(api_client_usage.requests, EXCLUDED.requests),
+				rejected = GREATEST(api_client_usage.rejected, EXCLUDED.rejected),
+				bytes = GREATEST(api_client_usage.bytes, EXCLUDED.bytes)`,
+			id, day, c.requests, c.rejected, c.bytes)
+		if err != nil {
+			return fmt.Errorf("error storing usage of client %s: %w", id, err)
+		}
+		if c.lastUsed > 0 {
+			_, err := db.DB.ExecContext(ctx, `UPDATE api_clients SET last_used_at = GREATEST(last_used_at, $1) WHERE id = $2`,
+				time.Unix(c.lastUsed, 0).UTC(), id)
+			if err != nil {
+				return fmt.Errorf("error updating client %s: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
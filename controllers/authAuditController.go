@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxUserAgentLength keeps oversized User-Agent headers out of the audit log.
+const maxUserAgentLength = 512
+
+// authEventsBuffer batches auth_events writes; see db.WriteBuffer.
+var authEventsBuffer = db.NewWriteBuffer("auth_events", "user_id", "username", "event", "ip_address", "user_agent", "created_at")
+
+// recordAuthEvent writes an entry to the auth audit log. Entries are buffered
+// and reach the table with the next write buffer flush. Failing to write the
+// log must not block the authentication flow, so errors are only logged.
+func recordAuthEvent(r *http.Request, userID *int64, username, event string) {
+	err := authEventsBuffer.Add(context.WithoutCancel(r.Context()), userID, username, event,
+		middlewares.ClientIP(r), truncateUserAgent(r.UserAgent()), time.Now())
+	if err != nil {
+		log.Printf("Failed to record auth event %s for %q: %v", event, username, err)
+	}
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
+
+// GetMyLogins returns a page of the authenticated user's login attempts, newest first.
+func (h *AuthHandler) GetMyLogins(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	logins, total, err := fetchLoginHistory(ctx, userID, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch login history", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.AuthEvent]{
+		Items:   logins,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+func fetchLoginHistory(ctx context.Context, userID int64, page Page) ([]models.AuthEvent, int, error) {
+	var total int
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM auth_events
+		WHERE user_id = $1 AND event IN ($2, $3)`,
+		userID, models.AuthEventLoginSucceeded, models.AuthEventLoginFailed).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting login history: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, event, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM auth_events
+		WHERE user_id = $1 AND event IN ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5`,
+		userID, models.AuthEventLoginSucceeded, models.AuthEventLoginFailed, page.PerPage, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	logins := []models.AuthEvent{}
+	for rows.Next() {
+		var event models.AuthEvent
+		if err := rows.Scan(&event.ID, &event.Event, &event.IPAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		logins = append(logins, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return logins, total, nil
+}
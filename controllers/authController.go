@@ -1,24 +1,30 @@
 package controllers
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
+	"jsmi-api/auth"
 	"jsmi-api/db"
 	"jsmi-api/middlewares"
 	"jsmi-api/models"
+	"jsmi-api/serializers"
 	"jsmi-api/utils"
 	"jsmi-api/validation"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// AuthHandler serves the authentication and account endpoints. Account data
+// is read and written through Users.
 type AuthHandler struct {
 	Config *db.Config
+	Users  auth.UserService
 }
 
 func (h *AuthHandler) SetupUserRoutes(r *mux.Router) {
@@ -26,41 +32,101 @@ func (h *AuthHandler) SetupUserRoutes(r *mux.Router) {
 	usersRouter.HandleFunc("/register", h.Register).Methods("POST")
 	usersRouter.HandleFunc("/login", h.Login).Methods("POST")
 	usersRouter.HandleFunc("/logoff", h.Logoff).Methods("POST")
-	usersRouter.HandleFunc("/delete-account", h.DeleteAccount).Methods("DELETE")
-	usersRouter.Handle("/change-password", middlewares.TokenAuthMiddleware(http.HandlerFunc(h.ChangePassword))).Methods("POST")
+	usersRouter.Handle("/delete-account", middlewares.TokenAuthMiddleware(http.HandlerFunc(h.DeleteAccount))).Methods("DELETE")
+	usersRouter.Handle("/change-password", middlewares.TokenAuthMiddleware(middlewares.NoImpersonation(http.HandlerFunc(h.ChangePassword)))).Methods("POST")
+	usersRouter.Handle("/change-email", middlewares.TokenAuthMiddleware(middlewares.NoImpersonation(http.HandlerFunc(h.ChangeEmail)))).Methods("POST")
 	usersRouter.HandleFunc("/refresh-token", h.RefreshToken).Methods("POST")
+	usersRouter.Handle("/me", middlewares.TokenAuthMiddleware(http.HandlerFunc(h.GetMe))).Methods("GET")
+	usersRouter.Handle("/me/email-tracking", middlewares.TokenAuthMiddleware(http.HandlerFunc(SetEmailTrackingOptOut))).Methods("PUT")
+	usersRouter.Handle("/me/celebrations", middlewares.TokenAuthMiddleware(http.HandlerFunc(SetMyCelebrations))).Methods("PUT")
+	usersRouter.Handle("/me/consents", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetMyConsents))).Methods("GET")
+	usersRouter.Handle("/me/consents", middlewares.TokenAuthMiddleware(http.HandlerFunc(SetMyConsents))).Methods("PUT")
+	usersRouter.Handle("/me/consents/history", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetMyConsentHistory))).Methods("GET")
+	usersRouter.Handle("/me/corrections", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetMyDataCorrections))).Methods("GET")
+	usersRouter.Handle("/me/corrections", middlewares.TokenAuthMiddleware(middlewares.NoImpersonation(http.HandlerFunc(RequestDataCorrection)))).Methods("POST")
+	usersRouter.Handle("/me/avatar", middlewares.TokenAuthMiddleware(http.HandlerFunc(h.UploadAvatar))).Methods("POST")
+	usersRouter.HandleFunc("/avatar", h.GetAvatar).Methods("GET").Queries("id", "{id}")
+	usersRouter.Handle("/me/logins", middlewares.TokenAuthMiddleware(http.HandlerFunc(h.GetMyLogins))).Methods("GET")
 }
 
+// RefreshToken rotates the refresh token and issues a new access token. The
+// refresh token is read from the request body or, failing that, the refresh
+// cookie. Every failure responds 401 with an error code telling the frontend
+// to send the user back to the login page.
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var refreshTokenRequest struct {
 		RefreshToken string `json:"refreshToken"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&refreshTokenRequest); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&refreshTokenRequest); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if refreshTokenRequest.RefreshToken == "" {
+		if cookie, err := r.Cookie(middlewares.AuthCookies().RefreshName); err == nil {
+			refreshTokenRequest.RefreshToken = cookie.Value
+		}
+	}
 
-	claims, err := utils.ValidatePASETO(refreshTokenRequest.RefreshToken)
+	claims, err := utils.ValidateToken(refreshTokenRequest.RefreshToken)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		respondRefreshError(w, "Invalid refresh token", RefreshErrorInvalid)
 		return
 	}
 
-	accessToken, err := utils.GeneratePASETO(claims.UserID, 15*time.Minute)
+	ctx := r.Context()
+	rotated, err := rotateRefreshToken(ctx, claims)
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		log.Printf("SECURITY: refresh token reuse for user %d; revoked token family", rotated.UserID)
+		recordAuthEvent(r, &rotated.UserID, rotated.Username, models.AuthEventRefreshTokenReused)
+		clearAuthCookies(w)
+		respondRefreshError(w, "Refresh token reuse detected; please log in again", RefreshErrorReused)
+		return
+	case errors.Is(err, ErrRefreshTokenRevoked):
+		clearAuthCookies(w)
+		respondRefreshError(w, "Refresh token has been revoked", RefreshErrorRevoked)
+		return
+	case errors.Is(err, ErrAccountSuspended):
+		clearAuthCookies(w)
+		respondRefreshError(w, "Account suspended", RefreshErrorSuspended)
+		return
+	case errors.Is(err, ErrRefreshTokenUnknown):
+		respondRefreshError(w, "Invalid refresh token", RefreshErrorInvalid)
+		return
+	case err != nil:
+		middlewares.HttpError(w, "Failed to refresh token", http.StatusInternalServerError, err)
+		return
+	}
+
+	accessToken, err := utils.GenerateToken(rotated.UserID, 15*time.Minute)
 	if err != nil {
 		http.Error(w, "Failed to generate new access token", http.StatusInternalServerError)
 		return
 	}
 
+	csrfToken, err := middlewares.GenerateCSRFToken()
+	if err != nil {
+		middlewares.HttpError(w, "Failed to generate CSRF token", http.StatusInternalServerError, err)
+		return
+	}
+
+	setAuthCookies(w, accessToken, rotated.Token, csrfToken, time.Until(rotated.ExpiresAt))
+
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]string{
-		"accessToken": accessToken,
+		"accessToken":  accessToken,
+		"refreshToken": rotated.Token,
+		"csrfToken":    csrfToken,
 	}); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
+func respondRefreshError(w http.ResponseWriter, message, code string) {
+	middlewares.RespondJSON(w, map[string]string{"error": message, "code": code}, http.StatusUnauthorized)
+}
+
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 
@@ -70,41 +136,24 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := validation.ValidateUserData(user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondValidationError(w, err)
 		return
 	}
 
 	ctx := r.Context()
-	if err := CreateUser(ctx, db.DB, &user); err != nil {
+	if err := h.Users.Create(ctx, &user); err != nil {
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-}
-
-func CreateUser(ctx context.Context, db *sql.DB, user *models.User) error {
-	if err := user.HashPassword(); err != nil {
-		return err
-	}
-
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := db.QueryRowContext(ctx, query, user.Username, user.Email, user.Password).Scan(&user.ID, &user.CreatedAt)
-	if err != nil {
-		return errors.New("failed to insert user into database: " + err.Error())
-	}
-
-	if err := SetUserCache(ctx, user); err != nil {
-		return errors.New("failed to set user cache: " + err.Error())
-	}
-
-	return nil
+	middlewares.RespondJSON(w, serializers.FromUser(user), http.StatusCreated)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var credentials struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		RememberMe bool   `json:"remember_me"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
@@ -113,160 +162,144 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	user, err := GetUserByUsername(ctx, db.DB, credentials.Username)
+	user, err := h.Users.GetByUsername(ctx, credentials.Username)
 	if err != nil {
 		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
 		return
 	}
 	if user == nil {
+		recordAuthEvent(r, nil, credentials.Username, models.AuthEventLoginFailed)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
 	if !user.CheckPassword(credentials.Password) {
+		recordAuthEvent(r, &user.ID, user.Username, models.AuthEventLoginFailed)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
-	accessToken, err := utils.GeneratePASETO(user.ID, 15*time.Minute)
+	if user.Status == models.UserStatusSuspended {
+		recordAuthEvent(r, &user.ID, user.Username, models.AuthEventLoginFailed)
+		if err := h.Users.Forget(ctx, user.Username); err != nil {
+			middlewares.HttpError(w, "Failed to clear user cache", http.StatusInternalServerError, err)
+			return
+		}
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	accessToken, err := utils.GenerateToken(user.ID, 15*time.Minute)
 	if err != nil {
 		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
 		return
 	}
 
-	refreshToken, err := utils.GeneratePASETO(user.ID, 7*24*time.Hour)
+	lifetimes, err := utils.LoadRefreshTokenLifetimes()
+	if err != nil {
+		middlewares.HttpError(w, "Failed to load token configuration", http.StatusInternalServerError, err)
+		return
+	}
+	refreshTTL := lifetimes.For(credentials.RememberMe)
+
+	// Each login starts a new refresh token family.
+	refreshToken, err := issueRefreshToken(ctx, user.ID, uuid.New(), time.Now().Add(refreshTTL))
 	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		middlewares.HttpError(w, "Failed to generate refresh token", http.StatusInternalServerError, err)
 		return
 	}
 
-	setAuthCookies(w, accessToken, refreshToken)
+	newDevice, err := isNewDevice(ctx, user.ID, r.UserAgent())
+	if err != nil {
+		log.Printf("Failed to check device for %s: %v", user.Username, err)
+	}
+
+	csrfToken, err := middlewares.GenerateCSRFToken()
+	if err != nil {
+		middlewares.HttpError(w, "Failed to generate CSRF token", http.StatusInternalServerError, err)
+		return
+	}
+
+	setAuthCookies(w, accessToken, refreshToken, csrfToken, refreshTTL)
+	recordAuthEvent(r, &user.ID, user.Username, models.AuthEventLoginSucceeded)
+	if newDevice {
+		notifySecurityEvent(r, emailNewDeviceLogin, user.Email, securityEmailData{Username: user.Username})
+	}
 
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"accessToken":  accessToken,
 		"refreshToken": refreshToken,
+		"csrfToken":    csrfToken,
 	}); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
-func setAuthCookies(w http.ResponseWriter, accessToken, refreshToken string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(15 * time.Minute),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
-	})
+func setAuthCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string, refreshTTL time.Duration) {
+	cookies := middlewares.AuthCookies()
+	http.SetCookie(w, cookies.NewCookie(cookies.AccessName, accessToken, time.Now().Add(15*time.Minute), true))
+	http.SetCookie(w, cookies.NewCookie(cookies.RefreshName, refreshToken, time.Now().Add(refreshTTL), true))
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
-	})
+	// The CSRF cookie must be readable by the frontend so it can echo it back
+	// in the X-CSRF-Token header.
+	http.SetCookie(w, cookies.NewCookie(cookies.CSRFName, csrfToken, time.Now().Add(refreshTTL), false))
 }
 
-func GetUserByUsername(ctx context.Context, db *sql.DB, username string) (*models.User, error) {
-	user, err := GetUserCache(ctx, username)
-	if err != nil {
-		return nil, err
-	}
-	if user != nil {
-		return user, nil
-	}
-
-	var userFromDB models.User
-	query := `SELECT id, username, email, password, created_at FROM users WHERE username = $1`
-	err = db.QueryRowContext(ctx, query, username).Scan(&userFromDB.ID, &userFromDB.Username, &userFromDB.Email, &userFromDB.Password, &userFromDB.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+func (h *AuthHandler) Logoff(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session's refresh tokens so a copied token stops working too.
+	if cookie, err := r.Cookie(middlewares.AuthCookies().RefreshName); err == nil {
+		if claims, err := utils.ValidateToken(cookie.Value); err == nil && claims.TokenID != "" {
+			if err := revokeRefreshTokenFamily(r.Context(), claims.TokenID); err != nil {
+				log.Printf("Failed to revoke refresh tokens on logoff: %v", err)
+			}
 		}
-		return nil, errors.New("failed to query user by username: " + err.Error())
 	}
 
-	if err := SetUserCache(ctx, &userFromDB); err != nil {
-		return nil, errors.New("failed to set user cache: " + err.Error())
-	}
-
-	return &userFromDB, nil
-}
-
-func (h *AuthHandler) Logoff(w http.ResponseWriter, _ *http.Request) {
 	clearAuthCookies(w)
 	w.WriteHeader(http.StatusOK)
 }
 
 func clearAuthCookies(w http.ResponseWriter) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "access_token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
-	})
+	cookies := middlewares.AuthCookies()
+	expired := time.Now().Add(-1 * time.Hour)
+	http.SetCookie(w, cookies.NewCookie(cookies.AccessName, "", expired, true))
+	http.SetCookie(w, cookies.NewCookie(cookies.RefreshName, "", expired, true))
+	http.SetCookie(w, cookies.NewCookie(cookies.CSRFName, "", expired, false))
 }
 
 func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("access_token")
+	cookie, err := r.Cookie(middlewares.AuthCookies().AccessName)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	claims, err := utils.ValidatePASETO(cookie.Value)
+	claims, err := utils.ValidateAccessToken(cookie.Value)
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
 	userID := claims.UserID
-	if err := DeleteUser(r.Context(), db.DB, userID); err != nil {
-		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
-		return
-	}
-
-	clearAuthCookies(w)
-	w.WriteHeader(http.StatusOK)
-}
-
-func DeleteUser(ctx context.Context, db *sql.DB, userID int64) error {
-	user, err := GetUserByID(ctx, db, userID)
+	user, err := h.Users.GetByID(r.Context(), userID)
 	if err != nil {
-		return err
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
 	}
 	if user == nil {
-		return errors.New("user not found")
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
 	}
 
-	if err := DeleteUserCache(ctx, user.Username); err != nil {
-		return errors.New("failed to delete user cache: " + err.Error())
+	if err := h.Users.Delete(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
 	}
 
-	_, err = db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
-	if err != nil {
-		return errors.New("failed to delete user: " + err.Error())
-	}
-	return nil
+	clearAuthCookies(w)
+	notifySecurityEvent(r, emailAccountDeleted, user.Email, securityEmailData{Username: user.Username})
+	w.WriteHeader(http.StatusOK)
 }
 
 func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
@@ -279,13 +312,13 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("access_token")
+	cookie, err := r.Cookie(middlewares.AuthCookies().AccessName)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	claims, err := utils.ValidatePASETO(cookie.Value)
+	claims, err := utils.ValidateAccessToken(cookie.Value)
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
@@ -293,7 +326,7 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	userID := claims.UserID
 	ctx := r.Context()
-	user, err := GetUserByID(ctx, db.DB, userID)
+	user, err := h.Users.GetByID(ctx, userID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
 		return
@@ -313,82 +346,66 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user.Password = data.NewPassword
-	if err := user.HashPassword(); err != nil {
-		http.Error(w, "Failed to hash new password", http.StatusInternalServerError)
-		return
-	}
-
-	if err := UpdateUserPassword(ctx, db.DB, userID, user.Password); err != nil {
+	if err := h.Users.UpdatePassword(ctx, userID, data.NewPassword); err != nil {
 		http.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
 
+	notifySecurityEvent(r, emailPasswordChanged, user.Email, securityEmailData{Username: user.Username})
 	w.WriteHeader(http.StatusOK)
 }
 
-func GetUserByID(ctx context.Context, db *sql.DB, userID int64) (*models.User, error) {
-	var user models.User
-	query := `SELECT id, username, email, password, created_at FROM users WHERE id = $1`
-	err := db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, errors.New("failed to query user by ID: " + err.Error())
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Password string `json:"password"`
+		NewEmail string `json:"new_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	return &user, nil
-}
+	if err := validation.ValidateEmail(data.NewEmail); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-func UpdateUserPassword(ctx context.Context, db *sql.DB, userID int64, hashedPassword string) error {
-	user, err := GetUserByID(ctx, db, userID)
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	user, err := h.Users.GetByID(ctx, userID)
 	if err != nil {
-		return err
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
 	}
 	if user == nil {
-		return errors.New("user not found")
-	}
-
-	if err := DeleteUserCache(ctx, user.Username); err != nil {
-		return errors.New("failed to delete user cache: " + err.Error())
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
 	}
 
-	_, err = db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, hashedPassword, userID)
-	if err != nil {
-		return errors.New("failed to update user password: " + err.Error())
+	if !user.CheckPassword(data.Password) {
+		http.Error(w, "Password is incorrect", http.StatusUnauthorized)
+		return
 	}
-	return nil
-}
 
-func SetUserCache(ctx context.Context, user *models.User) error {
-	data, err := json.Marshal(user)
-	if err != nil {
-		return err
+	if strings.EqualFold(user.Email, data.NewEmail) {
+		http.Error(w, "New email must be different from the current email", http.StatusBadRequest)
+		return
 	}
 
-	const CacheTime = 7 * 24 * time.Hour
-	return db.RedisClient.Set(ctx, "user:"+user.Username, data, CacheTime).Err()
-}
-
-func GetUserCache(ctx context.Context, username string) (*models.User, error) {
-	data, err := db.RedisClient.Get(ctx, "user:"+username).Bytes()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, nil
+	if err := h.Users.UpdateEmail(ctx, user, data.NewEmail); err != nil {
+		if errors.Is(err, auth.ErrEmailTaken) {
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
 		}
-		return nil, err
-	}
-
-	var user models.User
-	err = json.Unmarshal(data, &user)
-	if err != nil {
-		return nil, err
+		middlewares.HttpError(w, "Failed to update email", http.StatusInternalServerError, err)
+		return
 	}
 
-	return &user, nil
-}
-
-func DeleteUserCache(ctx context.Context, username string) error {
-	return db.RedisClient.Del(ctx, "user:"+username).Err()
+	// The notice goes to the old address so a hijacked account is noticed.
+	notifySecurityEvent(r, emailEmailChanged, user.Email, securityEmailData{
+		Username: user.Username,
+		OldEmail: user.Email,
+		NewEmail: data.NewEmail,
+	})
+	w.WriteHeader(http.StatusOK)
 }
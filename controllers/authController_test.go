@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"jsmi-api/middlewares"
+	"jsmi-api/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRefreshTokenIsNotAnAccessToken checks that a refresh token put in the
+// access cookie does not authenticate, so revoking it ends the session.
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	t.Setenv("TOKEN_FORMAT", "")
+	t.Setenv("PASETO_SECRET", strings.Repeat("k", 32))
+	mockDB(t)
+
+	refreshToken, _, err := utils.GenerateRefreshToken(7, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	handler := &AuthHandler{}
+	routes := map[string]http.Handler{
+		"protected route": middlewares.TokenAuthMiddleware(http.HandlerFunc(GetGivingHistory)),
+		"DeleteAccount":   http.HandlerFunc(handler.DeleteAccount),
+		"ChangePassword":  http.HandlerFunc(handler.ChangePassword),
+	}
+	for name, route := range routes {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"old_password":"a","new_password":"b"}`))
+			request.AddCookie(&http.Cookie{Name: middlewares.AuthCookies().AccessName, Value: refreshToken})
+			recorder := httptest.NewRecorder()
+			route.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d; body: %s", recorder.Code, http.StatusUnauthorized, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"jsmi-api/auth"
+	"jsmi-api/db"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/storage"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const avatarNamespace = "avatars"
+
+// avatarProcessor bounds how many avatar uploads are decoded at once.
+var avatarProcessor = media.NewProcessor(2)
+
+// GetMe returns the authenticated user's profile.
+func (h *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	profile, err := getProfile(ctx, userID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to retrieve user", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, profile, http.StatusOK)
+}
+
+func getProfile(ctx context.Context, userID int64) (*models.Profile, error) {
+	var (
+		profile   models.Profile
+		avatarID  uuid.NullUUID
+		avatarKey sql.NullString
+	)
+	err := db.DB.QueryRowContext(ctx, `SELECT u.id, u.username, u.email, u.role, u.status, u.email_tracking_opt_out, u.created_at,
+			to_char(u.birthday, 'YYYY-MM-DD'), to_char(u.anniversary, 'YYYY-MM-DD'), u.share_celebrations, m.id, m.storage_key
+		FROM users u
+		LEFT JOIN media_items m ON m.id = u.avatar_media_id
+		WHERE u.id = $1`, userID).
+		Scan(&profile.ID, &profile.Username, &profile.Email, &profile.Role, &profile.Status, &profile.EmailTrackingOptOut,
+			&profile.CreatedAt, &profile.Birthday, &profile.Anniversary, &profile.ShareCelebrations, &avatarID, &avatarKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, auth.ErrUserNotFound
+		}
+		return nil, errors.New("failed to query user by ID: " + err.Error())
+	}
+
+	if avatarID.Valid {
+		url := avatarURL(avatarID.UUID, avatarKey.String)
+		profile.AvatarURL = &url
+	}
+	return &profile, nil
+}
+
+// avatarURL points at the storage's public URL when one is configured and at
+// GetAvatar otherwise.
+func avatarURL(id uuid.UUID, key string) string {
+	if url := storage.PublicURL(key); url != "" {
+		return url
+	}
+	return "/auth/avatar?id=" + id.String()
+}
+
+// UploadAvatar accepts a multipart form with an avatar image. The image is
+// cropped to a square, scaled down, stripped of metadata and replaces the
+// user's previous avatar.
+func (h *AuthHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadBytes+1<<20)
+	if err := r.ParseMultipartForm(media.MaxUploadBytes); err != nil {
+		middlewares.HttpError(w, "Invalid multipart form", http.StatusBadRequest, err)
+		return
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		middlewares.HttpError(w, "avatar file is required", http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	image, err := avatarProcessor.Process(ctx, file, media.UsageAvatar)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrImageTooLarge):
+			middlewares.HttpError(w, err.Error(), http.StatusRequestEntityTooLarge, err)
+		case errors.Is(err, media.ErrUnsupportedFormat):
+			middlewares.HttpError(w, "avatar must be a JPEG or PNG file", http.StatusUnsupportedMediaType, err)
+		case errors.Is(err, media.ErrInvalidDimensions):
+			middlewares.HttpError(w, err.Error(), http.StatusUnprocessableEntity, err)
+		default:
+			middlewares.HttpError(w, "Failed to process avatar", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	item, err := media.Store(ctx, avatarNamespace, "avatar."+image.Format, image.ContentType, image.Data, &userID)
+	if err != nil {
+		var quotaErr *media.QuotaError
+		if errors.As(err, &quotaErr) {
+			middlewares.HttpError(w, "Avatar storage is full", http.StatusInsufficientStorage, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to store avatar", http.StatusInternalServerError, err)
+		return
+	}
+
+	var previous uuid.NullUUID
+	err = db.DB.QueryRowContext(ctx, `UPDATE users u SET avatar_media_id = $1
+		FROM (SELECT id, avatar_media_id FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.avatar_media_id`, item.ID, userID).Scan(&previous)
+	if err != nil {
+		deleteAvatar(context.WithoutCancel(ctx), item.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, auth.ErrUserNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update avatar", http.StatusInternalServerError, err)
+		return
+	}
+	if previous.Valid {
+		deleteAvatar(context.WithoutCancel(ctx), previous.UUID)
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"avatar_url": avatarURL(item.ID, item.StorageKey)}, http.StatusOK)
+}
+
+// GetAvatar serves an avatar when the storage has no public URL. Avatar IDs
+// change on every upload, so responses can be cached indefinitely.
+func (h *AuthHandler) GetAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := media.GetItem(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, media.ErrItemNotFound) {
+			middlewares.HttpError(w, "Avatar not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch avatar", http.StatusInternalServerError, err)
+		return
+	}
+	// Only avatars are public; other media items stay behind their own endpoints.
+	if item.Namespace != avatarNamespace {
+		http.Error(w, "Avatar not found", http.StatusNotFound)
+		return
+	}
+
+	reader, err := storage.Default().Open(r.Context(), item.StorageKey)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to open avatar", http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", item.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to stream avatar %s: %v", item.ID, err)
+	}
+}
+
+func deleteAvatar(ctx context.Context, id uuid.UUID) {
+	if err := media.DeleteItem(ctx, id); err != nil && !errors.Is(err, media.ErrItemNotFound) {
+		log.Printf("Failed to delete avatar %s: %v", id, err)
+	}
+}
@@ -0,0 +1,484 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	emailCareFollowUps = "care_follow_ups_overdue"
+	// careReminderInterval is how often an overdue follow-up is reminded of.
+	careReminderInterval = 20 * time.Hour
+)
+
+var (
+	ErrCareRecordNotFound = errors.New("care record not found")
+	ErrCareForbidden      = errors.New("only the author, the assignee or an admin can change this record")
+	ErrCareMemberNotFound = errors.New("member or assignee not found")
+)
+
+// SetupCareRoutes registers the pastoral care endpoints. They are for staff
+// only; members never see what is recorded about them.
+func SetupCareRoutes(r *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+
+	careRouter := r.PathPrefix("/care").Subrouter()
+	careRouter.Handle("/records", staff(GetCareRecord)).Methods("GET").Queries("id", "{id}")
+	careRouter.Handle("/records", staff(GetCareRecords)).Methods("GET")
+	careRouter.Handle("/records", staff(CreateCareRecord)).Methods("POST")
+	careRouter.Handle("/records", staff(UpdateCareRecord)).Methods("PUT").Queries("id", "{id}")
+	careRouter.Handle("/records", staff(DeleteCareRecord)).Methods("DELETE").Queries("id", "{id}")
+	careRouter.Handle("/records/complete", staff(CompleteCareRecord)).Methods("POST").Queries("id", "{id}")
+}
+
+// careViewer is the staff member a care record is read or changed by.
+type careViewer struct {
+	id    int64
+	admin bool
+}
+
+func careViewerFromRequest(r *http.Request) (careViewer, error) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	role, err := middlewares.UserRole(r.Context(), userID)
+	if err != nil {
+		return careViewer{}, err
+	}
+	return careViewer{id: userID, admin: role == middlewares.RoleAdmin}, nil
+}
+
+// isAuthor reports whether the viewer may see the private notes of record.
+func (v careViewer) isAuthor(record models.CareRecord) bool {
+	return v.admin || (record.CreatedBy != nil && *record.CreatedBy == v.id)
+}
+
+// canEdit reports whether the viewer may change record.
+func (v careViewer) canEdit(record models.CareRecord) bool {
+	return v.isAuthor(record) || (record.AssignedTo != nil && *record.AssignedTo == v.id)
+}
+
+// careVisibleClause limits care records to those the viewer, $2, may see;
+// $1 is whether the viewer is an admin.
+const careVisibleClause = `($1 OR c.visibility = 'team' OR c.created_by = $2 OR c.assigned_to = $2)`
+
+const careRecordColumns = `c.id, c.member_id, u.username, c.kind, c.visibility, c.summary, c.notes, c.private_notes,
+	c.assigned_to, c.created_by, c.occurred_at, c.due_at, c.completed_at, c.created_at, c.updated_at`
+
+// scanCareRecord scans a record and drops the private notes the viewer may
+// not see.
+func scanCareRecord(row rowScanner, viewer careViewer) (models.CareRecord, error) {
+	var record models.CareRecord
+	var privateNotes string
+	err := row.Scan(&record.ID, &record.MemberID, &record.MemberName, &record.Kind, &record.Visibility, &record.Summary,
+		&record.Notes, &privateNotes, &record.AssignedTo, &record.CreatedBy, &record.OccurredAt, &record.DueAt,
+		&record.CompletedAt, &record.CreatedAt, &record.UpdatedAt)
+	if err == nil && viewer.isAuthor(record) {
+		record.PrivateNotes = &privateNotes
+	}
+	return record, err
+}
+
+func queryCareRecord(ctx context.Context, id uuid.UUID, viewer careViewer) (models.CareRecord, error) {
+	record, err := scanCareRecord(db.DB.QueryRowContext(ctx, "SELECT "+careRecordColumns+`
+		FROM care_records c
+		JOIN users u ON u.id = c.member_id
+		WHERE `+careVisibleClause+` AND c.id = $3`, viewer.admin, viewer.id, id), viewer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CareRecord{}, ErrCareRecordNotFound
+	}
+	if err != nil {
+		return models.CareRecord{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return record, nil
+}
+
+func respondCareError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrCareRecordNotFound):
+		middlewares.HttpError(w, "Care record not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrCareForbidden):
+		middlewares.HttpError(w, err.Error(), http.StatusForbidden, err)
+	case errors.Is(err, ErrCareMemberNotFound):
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// GetCareRecords lists the care records the caller may see, newest first.
+// They can be narrowed to ?member_id=, ?assigned_to=, ?kind= and, with
+// ?overdue=true, to follow-ups past their due date.
+func GetCareRecords(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	var memberID, assignedTo *int64
+	for name, target := range map[string]**int64{"member_id": &memberID, "assigned_to": &assignedTo} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				middlewares.HttpError(w, "Invalid "+name+" parameter", http.StatusBadRequest, err)
+				return
+			}
+			*target = &id
+		}
+	}
+	kind := query.Get("kind")
+	overdue := query.Get("overdue") == "true"
+
+	ctx := r.Context()
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch care records", http.StatusInternalServerError, err)
+		return
+	}
+
+	filter := careVisibleClause + ` AND ($3::integer IS NULL OR c.member_id = $3)
+		AND ($4::integer IS NULL OR c.assigned_to = $4)
+		AND ($5 = '' OR c.kind = $5)
+		AND (NOT $6 OR (c.kind = 'follow_up' AND c.completed_at IS NULL AND c.due_at < NOW()))`
+	args := []any{viewer.admin, viewer.id, memberID, assignedTo, kind, overdue}
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM care_records c WHERE "+filter, args...).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch care records", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+careRecordColumns+`
+		FROM care_records c
+		JOIN users u ON u.id = c.member_id
+		WHERE `+filter+`
+		ORDER BY c.created_at DESC, c.id
+		LIMIT $7 OFFSET $8`, append(args, page.PerPage, page.Offset())...)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch care records", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	records := []models.CareRecord{}
+	for rows.Next() {
+		record, err := scanCareRecord(rows, viewer)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch care records", http.StatusInternalServerError, err)
+			return
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch care records", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.CareRecord]{
+		Items:   records,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetCareRecord returns a care record. Records the caller may not see are
+// answered as not found.
+func GetCareRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	record, err := queryCareRecord(r.Context(), id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to fetch care record", err)
+		return
+	}
+	middlewares.RespondJSON(w, record, http.StatusOK)
+}
+
+// decodeCareRecord reads and validates a care record from the request body.
+func decodeCareRecord(w http.ResponseWriter, r *http.Request) (models.CareRecord, bool) {
+	var record models.CareRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return models.CareRecord{}, false
+	}
+	if record.Visibility == "" {
+		record.Visibility = models.CareVisibilityTeam
+	}
+	if err := validation.ValidateCareRecord(record); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return models.CareRecord{}, false
+	}
+	return record, true
+}
+
+// CreateCareRecord logs a visit, call or follow-up. The caller is its author.
+func CreateCareRecord(w http.ResponseWriter, r *http.Request) {
+	record, ok := decodeCareRecord(w, r)
+	if !ok {
+		return
+	}
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create care record", http.StatusInternalServerError, err)
+		return
+	}
+	privateNotes := ""
+	if record.PrivateNotes != nil {
+		privateNotes = *record.PrivateNotes
+	}
+
+	ctx := r.Context()
+	var id uuid.UUID
+	err = db.DB.QueryRowContext(ctx, `INSERT INTO care_records (member_id, kind, visibility, summary, notes, private_notes,
+			assigned_to, created_by, occurred_at, due_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		record.MemberID, record.Kind, record.Visibility, record.Summary, record.Notes, privateNotes,
+		record.AssignedTo, viewer.id, record.OccurredAt, record.DueAt).Scan(&id)
+	if isForeignKeyViolation(err) {
+		respondCareError(w, "", ErrCareMemberNotFound)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to fetch care record", err)
+		return
+	}
+	middlewares.RespondCreated(w, "/care/records?id="+id.String(), created)
+}
+
+// UpdateCareRecord replaces a care record. Only the author, the assignee and
+// admins may change it, and only the author and admins its private notes;
+// for anyone else they are kept as stored.
+func UpdateCareRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	record, ok := decodeCareRecord(w, r)
+	if !ok {
+		return
+	}
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	current, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to update care record", err)
+		return
+	}
+	if !viewer.canEdit(current) {
+		respondCareError(w, "", ErrCareForbidden)
+		return
+	}
+	if !viewer.isAuthor(current) {
+		record.PrivateNotes = nil
+	}
+
+	// A new due date is reminded of again once it has passed.
+	_, err = db.DB.ExecContext(ctx, `UPDATE care_records
+		SET member_id = $1, kind = $2, visibility = $3, summary = $4, notes = $5, private_notes = COALESCE($6, private_notes),
+			assigned_to = $7, occurred_at = $8, due_at = $9::timestamp,
+			reminded_at = CASE WHEN due_at IS DISTINCT FROM $9::timestamp THEN NULL ELSE reminded_at END, updated_at = NOW()
+		WHERE id = $10`,
+		record.MemberID, record.Kind, record.Visibility, record.Summary, record.Notes, record.PrivateNotes,
+		record.AssignedTo, record.OccurredAt, record.DueAt, id)
+	if isForeignKeyViolation(err) {
+		respondCareError(w, "", ErrCareMemberNotFound)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to fetch care record", err)
+		return
+	}
+	middlewares.RespondJSON(w, updated, http.StatusOK)
+}
+
+// CompleteCareRecord marks a follow-up as done.
+func CompleteCareRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to complete care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	current, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to complete care record", err)
+		return
+	}
+	if !viewer.canEdit(current) {
+		respondCareError(w, "", ErrCareForbidden)
+		return
+	}
+
+	_, err = db.DB.ExecContext(ctx, `UPDATE care_records SET completed_at = COALESCE(completed_at, NOW()), updated_at = NOW()
+		WHERE id = $1`, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to complete care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	completed, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to fetch care record", err)
+		return
+	}
+	middlewares.RespondJSON(w, completed, http.StatusOK)
+}
+
+// DeleteCareRecord deletes a care record. Only its author and admins may.
+func DeleteCareRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	viewer, err := careViewerFromRequest(r)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete care record", http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	current, err := queryCareRecord(ctx, id, viewer)
+	if err != nil {
+		respondCareError(w, "Failed to delete care record", err)
+		return
+	}
+	if !viewer.isAuthor(current) {
+		middlewares.HttpError(w, "Only the author or an admin can delete this record", http.StatusForbidden, ErrCareForbidden)
+		return
+	}
+
+	if _, err := db.DB.ExecContext(ctx, "DELETE FROM care_records WHERE id = $1", id); err != nil {
+		middlewares.HttpError(w, "Failed to delete care record", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// overdueFollowUp is a follow-up in a reminder email. The email only names
+// the member; the record itself stays behind the API's access checks.
+type overdueFollowUp struct {
+	ID         uuid.UUID
+	MemberName string
+	DueAt      time.Time
+}
+
+// careReminderEmailData is the data available to the care_follow_ups_overdue
+// template.
+type careReminderEmailData struct {
+	Username  string
+	FollowUps []overdueFollowUp
+}
+
+// RunCareReminders is the daily job that emails staff about their overdue
+// follow-ups: the assignee, or the author of unassigned ones. A follow-up is
+// reminded of at most once per careReminderInterval until it is completed.
+func RunCareReminders(ctx context.Context) error {
+	rows, err := db.DB.QueryContext(ctx, `SELECT c.id, m.username, c.due_at, r.id, r.username, r.email
+		FROM care_records c
+		JOIN users m ON m.id = c.member_id
+		JOIN users r ON r.id = COALESCE(c.assigned_to, c.created_by)
+		WHERE c.kind = 'follow_up' AND c.completed_at IS NULL AND c.due_at < NOW()
+			AND (c.reminded_at IS NULL OR c.reminded_at < NOW() - $1 * INTERVAL '1 second')
+			AND r.role IN ($2, $3) AND r.status = $4
+		ORDER BY r.id, c.due_at`,
+		careReminderInterval.Seconds(), middlewares.RoleStaff, middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	type recipient struct {
+		email string
+		data  careReminderEmailData
+	}
+	recipients := map[int64]*recipient{}
+	var order []int64
+	for rows.Next() {
+		var (
+			followUp overdueFollowUp
+			userID   int64
+			username string
+			email    string
+		)
+		if err := rows.Scan(&followUp.ID, &followUp.MemberName, &followUp.DueAt, &userID, &username, &email); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if recipients[userID] == nil {
+			recipients[userID] = &recipient{email: email, data: careReminderEmailData{Username: username}}
+			order = append(order, userID)
+		}
+		recipients[userID].data.FollowUps = append(recipients[userID].data.FollowUps, followUp)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, userID := range order {
+		recipient := recipients[userID]
+		if err := mailer.SendTemplate(emailCareFollowUps, recipient.email, recipient.data); err != nil {
+			log.Printf("Failed to queue care reminder for %s: %v", recipient.data.Username, err)
+			continue
+		}
+		ids := make([]string, len(recipient.data.FollowUps))
+		for i, followUp := range recipient.data.FollowUps {
+			ids[i] = followUp.ID.String()
+		}
+		if _, err := db.DB.ExecContext(ctx, "UPDATE care_records SET reminded_at = NOW() WHERE id = ANY($1::uuid[])", pq.Array(ids)); err != nil {
+			return fmt.Errorf("error updating care records: %w", err)
+		}
+	}
+	return nil
+}
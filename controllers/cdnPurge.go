@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobPurgeCDN purges responses tagged with surrogate keys from the CDN.
+const JobPurgeCDN = "cdn.purge"
+
+// CDN providers supported by CDN_PROVIDER.
+const (
+	CDNProviderFastly     = "fastly"
+	CDNProviderCloudflare = "cloudflare"
+)
+
+// Surrogate keys of content responses. A list is tagged with its entity,
+// an item with its entity and ID, and both with the entity's "-all" key, so
+// a purge can hit one item, the lists, or everything of an entity.
+const (
+	surrogateKeyPosts      = "posts"
+	surrogateKeyPostsAll   = "posts-all"
+	surrogateKeyLives      = "lives"
+	surrogateKeyLivesAll   = "lives-all"
+	surrogateKeySermons    = "sermons"
+	surrogateKeySermonsAll = "sermons-all"
+)
+
+const (
+	defaultFastlyAPIURL     = "https://api.fastly.com"
+	defaultCloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+	// Cloudflare purges at most 30 tags per request.
+	cloudflarePurgeBatch = 30
+)
+
+// CDNConfig configures purges by surrogate key.
+type CDNConfig struct {
+	// Provider is "" when no CDN is configured; responses are still tagged.
+	Provider string
+	APIURL   string
+	APIToken string
+	// ServiceID is the Fastly service or the Cloudflare zone.
+	ServiceID string
+}
+
+// CDNPurgeRequest is the payload of a JobPurgeCDN job.
+type CDNPurgeRequest struct {
+	Keys []string `json:"keys"`
+}
+
+var (
+	cdnConfig     *CDNConfig
+	cdnConfigOnce sync.Once
+	cdnClient     = &http.Client{Timeout: 30 * time.Second}
+)
+
+// LoadCDNConfig reads the CDN settings: CDN_PROVIDER (fastly or cloudflare),
+// CDN_API_TOKEN, CDN_SERVICE_ID (the Fastly service or Cloudflare zone ID)
+// and optionally CDN_API_URL.
+func LoadCDNConfig() (*CDNConfig, error) {
+	config := &CDNConfig{
+		Provider:  os.Getenv("CDN_PROVIDER"),
+		APIURL:    strings.TrimSuffix(os.Getenv("CDN_API_URL"), "/"),
+		APIToken:  os.Getenv("CDN_API_TOKEN"),
+		ServiceID: os.Getenv("CDN_SERVICE_ID"),
+	}
+	switch config.Provider {
+	case "":
+		return config, nil
+	case CDNProviderFastly:
+		if config.APIURL == "" {
+			config.APIURL = defaultFastlyAPIURL
+		}
+	case CDNProviderCloudflare:
+		if config.APIURL == "" {
+			config.APIURL = defaultCloudflareAPIURL
+		}
+	default:
+		return nil, errors.New("CDN_PROVIDER must be fastly or cloudflare")
+	}
+	if config.APIToken == "" || config.ServiceID == "" {
+		return nil, fmt.Errorf("CDN_API_TOKEN and CDN_SERVICE_ID are required with CDN_PROVIDER=%s", config.Provider)
+	}
+	return config, nil
+}
+
+func cdn() *CDNConfig {
+	cdnConfigOnce.Do(func() {
+		config, err := LoadCDNConfig()
+		if err != nil {
+			log.Printf("CDN purges disabled: %v", err)
+			config = &CDNConfig{}
+		}
+		cdnConfig = config
+	})
+	return cdnConfig
+}
+
+// setSurrogateKeys tags a response for purges by key. Fastly reads
+// Surrogate-Key, Cloudflare reads Cache-Tag.
+func setSurrogateKeys(w http.ResponseWriter, keys ...string) {
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+	w.Header().Set("Cache-Tag", strings.Join(keys, ","))
+}
+
+func postSurrogateKey(id string) string {
+	return "post-" + id
+}
+
+func liveSurrogateKey(id string) string {
+	return "live-" + id
+}
+
+func sermonSurrogateKey(id string) string {
+	return "sermon-" + id
+}
+
+// queueCDNPurge queues a purge of the given surrogate keys. It is best
+// effort: the change is already saved, so failures are only logged.
+func queueCDNPurge(ctx context.Context, keys ...string) {
+	if cdn().Provider == "" || len(keys) == 0 {
+		return
+	}
+	if _, err := jobs.Enqueue(ctx, db.DB, JobPurgeCDN, CDNPurgeRequest{Keys: keys}); err != nil {
+		log.Printf("Failed to queue CDN purge of %v: %v", keys, err)
+	}
+}
+
+// PurgeCDN is the job handler for JobPurgeCDN. Failed purges are retried by
+// the job queue.
+func PurgeCDN(ctx context.Context, task *jobs.Task) (any, error) {
+	var req CDNPurgeRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	config := cdn()
+	switch config.Provider {
+	case CDNProviderFastly:
+		if err := purgeFastly(ctx, config, req.Keys); err != nil {
+			return nil, err
+		}
+	case CDNProviderCloudflare:
+		for start := 0; start < len(req.Keys); start += cloudflarePurgeBatch {
+			end := min(start+cloudflarePurgeBatch, len(req.Keys))
+			if err := purgeCloudflare(ctx, config, req.Keys[start:end]); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		// The CDN may have been switched off since the job was queued.
+		return map[string]bool{"skipped": true}, nil
+	}
+	return map[string][]string{"purged": req.Keys}, nil
+}
+
+// purgeFastly purges keys with the Fastly batch purge API.
+func purgeFastly(ctx context.Context, config *CDNConfig, keys []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.APIURL+"/service/"+config.ServiceID+"/purge", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", config.APIToken)
+	req.Header.Set("Surrogate-Key", strings.Join(keys, " "))
+	return doCDNRequest(req)
+}
+
+// purgeCloudflare purges keys with the Cloudflare purge by tag API.
+func purgeCloudflare(ctx context.Context, config *CDNConfig, keys []string) error {
+	body, err := json.Marshal(map[string][]string{"tags": keys})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.APIURL+"/zones/"+config.ServiceID+"/purge_cache", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	return doCDNRequest(req)
+}
+
+func doCDNRequest(req *http.Request) error {
+	resp, err := cdnClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling CDN purge API: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CDN purge API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
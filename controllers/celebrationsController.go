@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	emailCelebrations = "celebrations_upcoming"
+	// celebrationDigestDays is how far ahead the weekly digest looks.
+	celebrationDigestDays   = 7
+	defaultCelebrationDays  = 14
+	maxCelebrationLookahead = 60
+)
+
+// SetupCelebrationRoutes registers the staff feed of upcoming birthdays and
+// anniversaries. Members set their own dates with PUT /auth/me/celebrations.
+func SetupCelebrationRoutes(r *mux.Router) {
+	r.Handle("/celebrations/upcoming", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(GetUpcomingCelebrations)))).Methods("GET")
+}
+
+// SetMyCelebrations stores the caller's birthday and anniversary and whether
+// staff may see them.
+func SetMyCelebrations(w http.ResponseWriter, r *http.Request) {
+	var settings models.CelebrationSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	birthday, anniversary, err := validation.ParseCelebrationSettings(settings, time.Now().UTC())
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	_, err = db.DB.ExecContext(ctx, "UPDATE users SET birthday = $1, anniversary = $2, share_celebrations = $3 WHERE id = $4",
+		birthday, anniversary, settings.ShareCelebrations, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update celebrations", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, settings, http.StatusOK)
+}
+
+// GetUpcomingCelebrations lists the birthdays and anniversaries of the next
+// ?days= days (14 by default), today included, of active members who share
+// them.
+func GetUpcomingCelebrations(w http.ResponseWriter, r *http.Request) {
+	days := defaultCelebrationDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCelebrationLookahead {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxCelebrationLookahead), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	celebrations, err := queryUpcomingCelebrations(r.Context(), time.Now().UTC(), days)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch celebrations", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, celebrations, http.StatusOK)
+}
+
+// queryUpcomingCelebrations returns the celebrations in the days days from
+// now's date, soonest first.
+func queryUpcomingCelebrations(ctx context.Context, now time.Time, days int) ([]models.Celebration, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, username, birthday, anniversary FROM users
+		WHERE share_celebrations AND status = $1 AND (birthday IS NOT NULL OR anniversary IS NOT NULL)`,
+		models.UserStatusActive)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	end := today.AddDate(0, 0, days)
+	celebrations := []models.Celebration{}
+	for rows.Next() {
+		var (
+			userID                int64
+			username              string
+			birthday, anniversary *time.Time
+		)
+		if err := rows.Scan(&userID, &username, &birthday, &anniversary); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if birthday != nil {
+			if next := nextOccurrence(*birthday, today); next.Before(end) {
+				celebrations = append(celebrations, models.Celebration{
+					UserID: userID, Username: username, Kind: models.CelebrationBirthday, Date: next.Format(time.DateOnly),
+				})
+			}
+		}
+		if anniversary != nil {
+			if next := nextOccurrence(*anniversary, today); next.Before(end) {
+				years := next.Year() - anniversary.Year()
+				celebrations = append(celebrations, models.Celebration{
+					UserID: userID, Username: username, Kind: models.CelebrationAnniversary, Date: next.Format(time.DateOnly),
+					Years: &years,
+				})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	sort.Slice(celebrations, func(i, j int) bool {
+		a, b := celebrations[i], celebrations[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.Kind < b.Kind
+	})
+	return celebrations, nil
+}
+
+// nextOccurrence returns the next anniversary of date on or after today.
+// 29 February is celebrated on the 28th in other years.
+func nextOccurrence(date, today time.Time) time.Time {
+	for year := today.Year(); ; year++ {
+		day := date.Day()
+		if date.Month() == time.February && day == 29 && !isLeapYear(year) {
+			day = 28
+		}
+		next := time.Date(year, date.Month(), day, 0, 0, 0, 0, time.UTC)
+		if !next.Before(today) {
+			return next
+		}
+	}
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// celebrationEmailData is the data available to the celebrations_upcoming
+// template.
+type celebrationEmailData struct {
+	Username     string
+	Celebrations []models.Celebration
+}
+
+// RunCelebrationDigest is the weekly job that emails active staff and admins
+// the celebrations of the coming week. Nothing is sent when there are none.
+func RunCelebrationDigest(ctx context.Context) error {
+	celebrations, err := queryUpcomingCelebrations(ctx, time.Now().UTC(), celebrationDigestDays)
+	if err != nil {
+		return err
+	}
+	if len(celebrations) == 0 {
+		return nil
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT username, email FROM users
+		WHERE role IN ($1, $2) AND status = $3`,
+		middlewares.RoleStaff, middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	data := celebrationEmailData{Celebrations: celebrations}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&data.Username, &email); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if err := mailer.SendTemplate(emailCelebrations, email, data); err != nil {
+			log.Printf("Failed to queue celebration digest for %s: %v", data.Username, err)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"jsmi-api/db"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// respondConditional writes data as JSON with an ETag computed from the
+// response body and, when lastModified is set, a Last-Modified header.
+// Requests whose If-None-Match or, without it, If-Modified-Since still match
+// get a 304 with no body.
+func respondConditional(w http.ResponseWriter, r *http.Request, data interface{}, lastModified time.Time) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// queryLastChange returns when content of an entity last changed, for one
+// item when id is set, as recorded in content_changes. Counters like post
+// views are not content changes; clients that need them revalidate with
+// If-None-Match.
+func queryLastChange(ctx context.Context, entity string, id *uuid.UUID) (time.Time, error) {
+	var changedAt sql.NullTime
+	err := db.DB.QueryRowContext(ctx, `SELECT MAX(changed_at) FROM content_changes
+		WHERE entity = $1 AND ($2::uuid IS NULL OR entity_id = $2::uuid)`, entity, id).Scan(&changedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return changedAt.Time, nil
+}
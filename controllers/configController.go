@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+const (
+	publicConfigCacheKey  = "config:public"
+	publicConfigCacheTime = 5 * time.Minute
+	defaultPublicConfig   = "config/public.json"
+)
+
+func SetupConfigRoutes(r *mux.Router) {
+	configRouter := r.PathPrefix("/config").Subrouter()
+	configRouter.Handle("/public", middlewares.Coalesce(http.HandlerFunc(GetPublicConfig))).Methods("GET")
+}
+
+// GetPublicConfig serves the public configuration with its version as ETag,
+// so clients can revalidate cheaply.
+func GetPublicConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := fetchPublicConfig(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to load public configuration", http.StatusInternalServerError, err)
+		return
+	}
+
+	etag := `"` + config.Version + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicConfigCacheTime.Seconds())))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	middlewares.RespondJSON(w, config, http.StatusOK)
+}
+
+func fetchPublicConfig(ctx context.Context) (*models.PublicConfig, error) {
+	cachedData, err := db.RedisClient.Get(ctx, publicConfigCacheKey).Bytes()
+	if err == nil {
+		var config models.PublicConfig
+		if err := json.Unmarshal(cachedData, &config); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cached public config: %w", err)
+		}
+		return &config, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error fetching public config from Redis cache: %w", err)
+	}
+
+	config, err := LoadPublicConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(config)
+	if err == nil {
+		db.RedisClient.Set(ctx, publicConfigCacheKey, jsonData, publicConfigCacheTime)
+	}
+
+	return config, nil
+}
+
+// LoadPublicConfig reads the public configuration from the JSON file at
+// PUBLIC_CONFIG_PATH (default config/public.json), falling back to built-in
+// defaults when the file does not exist. The version is a hash of the content.
+func LoadPublicConfig() (*models.PublicConfig, error) {
+	config := &models.PublicConfig{
+		Branding: models.Branding{
+			Name: "Jehovah Shammah Ministries International",
+		},
+		FeatureFlags:   map[string]bool{},
+		ServiceTimes:   []models.ServiceTime{},
+		EnabledModules: []string{"posts", "lives"},
+	}
+
+	path := os.Getenv("PUBLIC_CONFIG_PATH")
+	if path == "" {
+		path = defaultPublicConfig
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !(errors.Is(err, os.ErrNotExist) && os.Getenv("PUBLIC_CONFIG_PATH") == "") {
+		return nil, fmt.Errorf("error reading public config %s: %w", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("error parsing public config %s: %w", path, err)
+		}
+	}
+
+	config.Environment = middlewares.Environment()
+	config.PreviewBanner = middlewares.PreviewBanner()
+
+	config.Version = ""
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	config.Version = hex.EncodeToString(sum[:8])
+
+	return config, nil
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"errors"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrVersionConflict = errors.New("the resource was changed since the version you edited")
+	ErrIDTaken         = errors.New("a different resource already exists with this ID")
+)
+
+// fieldPair is one field of a write compared with the stored resource.
+type fieldPair struct {
+	Field  string
+	Yours  any
+	Theirs any
+}
+
+// conflictingFields returns the fields whose values differ.
+func conflictingFields(pairs ...fieldPair) []models.FieldConflict {
+	fields := []models.FieldConflict{}
+	for _, pair := range pairs {
+		if pair.Yours != pair.Theirs {
+			fields = append(fields, models.FieldConflict{Field: pair.Field, Yours: pair.Yours, Theirs: pair.Theirs})
+		}
+	}
+	return fields
+}
+
+// respondConflict answers a rejected write with the stored resource and the
+// fields that differ, so the client can merge instead of losing either edit.
+func respondConflict(w http.ResponseWriter, err error, yourVersion, currentVersion int, current any, fields []models.FieldConflict) {
+	middlewares.RespondJSON(w, models.WriteConflict{
+		Error:          err.Error(),
+		YourVersion:    yourVersion,
+		CurrentVersion: currentVersion,
+		Current:        current,
+		Fields:         fields,
+	}, http.StatusConflict)
+}
+
+// isPrimaryKeyViolation reports whether err is a duplicate ID in table.
+func isPrimaryKeyViolation(err error, table string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == table+"_pkey"
+}
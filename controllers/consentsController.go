@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// maxConsentCheckUsers bounds the users of one consent check.
+const maxConsentCheckUsers = 200
+
+var ErrConsentUserNotFound = errors.New("user not found")
+
+// SetupConsentRoutes registers the staff consent check. Users manage their
+// own consents under /auth/me/consents; admins record paper forms under
+// /admin/consents.
+func SetupConsentRoutes(r *mux.Router) {
+	r.Handle("/consents/check", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(CheckConsents)))).
+		Methods("GET").Queries("purpose", "{purpose}", "user_ids", "{user_ids}")
+}
+
+// consentClause is a boolean SQL expression for whether the user in
+// userColumn consents to purpose, which must be one of the constants in
+// models.ConsentPurposes. It is how other modules enforce consent in their
+// queries, e.g. the email campaign audience.
+func consentClause(userColumn, purpose string) string {
+	return fmt.Sprintf(`COALESCE((SELECT uc.granted FROM user_consents uc WHERE uc.user_id = %s AND uc.purpose = %s), %t)`,
+		userColumn, pq.QuoteLiteral(purpose), models.ConsentPurposes[purpose])
+}
+
+// queryConsents returns a user's answers for every purpose, sorted by
+// purpose.
+func queryConsents(ctx context.Context, userID int64) ([]models.Consent, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT purpose, granted, updated_at FROM user_consents WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	answered := map[string]models.Consent{}
+	for rows.Next() {
+		var (
+			consent   models.Consent
+			updatedAt time.Time
+		)
+		if err := rows.Scan(&consent.Purpose, &consent.Granted, &updatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		consent.UpdatedAt = &updatedAt
+		answered[consent.Purpose] = consent
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	consents := make([]models.Consent, 0, len(models.ConsentPurposes))
+	for purpose, granted := range models.ConsentPurposes {
+		if consent, ok := answered[purpose]; ok {
+			consents = append(consents, consent)
+			continue
+		}
+		consents = append(consents, models.Consent{Purpose: purpose, Granted: granted})
+	}
+	sort.Slice(consents, func(i, j int) bool { return consents[i].Purpose < consents[j].Purpose })
+	return consents, nil
+}
+
+// recordConsents stores the answers that differ from the current ones and
+// records each change. Answers equal to the current ones are not recorded
+// again.
+func recordConsents(ctx context.Context, userID int64, changes map[string]bool, source string, r *http.Request) error {
+	current, err := queryConsents(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var recordedBy *int64
+	if source == models.ConsentSourceStaff {
+		staffID, _ := middlewares.UserIDFromContext(ctx)
+		recordedBy = &staffID
+	}
+	for _, consent := range current {
+		granted, ok := changes[consent.Purpose]
+		if !ok || (granted == consent.Granted && consent.UpdatedAt != nil) {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO consent_records (user_id, purpose, granted, source, ip_address, user_agent, recorded_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			userID, consent.Purpose, granted, source, middlewares.ClientIP(r), truncateUserAgent(r.UserAgent()), recordedBy)
+		if isForeignKeyViolation(err) {
+			return ErrConsentUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error recording consent: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_consents (user_id, purpose, granted) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, purpose) DO UPDATE SET granted = EXCLUDED.granted, updated_at = NOW()`,
+			userID, consent.Purpose, granted)
+		if err != nil {
+			return fmt.Errorf("error updating consent: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func queryConsentRecords(ctx context.Context, userID int64) ([]models.ConsentRecord, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, user_id, purpose, granted, source, ip_address, user_agent, recorded_by, recorded_at
+		FROM consent_records
+		WHERE user_id = $1
+		ORDER BY recorded_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	records := []models.ConsentRecord{}
+	for rows.Next() {
+		var record models.ConsentRecord
+		if err := rows.Scan(&record.ID, &record.UserID, &record.Purpose, &record.Granted, &record.Source, &record.IPAddress,
+			&record.UserAgent, &record.RecordedBy, &record.RecordedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return records, nil
+}
+
+// decodeConsentChanges reads answers keyed by purpose, e.g. {"sms": true}.
+func decodeConsentChanges(w http.ResponseWriter, r *http.Request) (map[string]bool, bool) {
+	var changes map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return nil, false
+	}
+	if err := validation.ValidateConsentChanges(changes); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return nil, false
+	}
+	return changes, true
+}
+
+// GetMyConsents returns the caller's answers for every purpose.
+func GetMyConsents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	consents, err := queryConsents(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consents", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, consents, http.StatusOK)
+}
+
+// SetMyConsents gives or withdraws the caller's consents.
+func SetMyConsents(w http.ResponseWriter, r *http.Request) {
+	changes, ok := decodeConsentChanges(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	if err := recordConsents(ctx, userID, changes, models.ConsentSourceUser, r); err != nil {
+		middlewares.HttpError(w, "Failed to update consents", http.StatusInternalServerError, err)
+		return
+	}
+	GetMyConsents(w, r)
+}
+
+// GetMyConsentHistory lists the caller's consent records, newest first.
+func GetMyConsentHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	records, err := queryConsentRecords(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consent history", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, records, http.StatusOK)
+}
+
+// GetUserConsents returns a user's current consents and their history.
+func GetUserConsents(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	consents, err := queryConsents(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consents", http.StatusInternalServerError, err)
+		return
+	}
+	records, err := queryConsentRecords(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consents", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, map[string]interface{}{"consents": consents, "history": records}, http.StatusOK)
+}
+
+// SetUserConsents records consents a user gave outside the app, e.g. on a
+// paper form. The records name the admin who entered them.
+func SetUserConsents(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+	changes, ok := decodeConsentChanges(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := recordConsents(ctx, userID, changes, models.ConsentSourceStaff, r); err != nil {
+		if errors.Is(err, ErrConsentUserNotFound) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update consents", http.StatusInternalServerError, err)
+		return
+	}
+	consents, err := queryConsents(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consents", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, consents, http.StatusOK)
+}
+
+// CheckConsents tells staff which of ?user_ids= consent to ?purpose=, e.g.
+// before publishing a photo of them. Unknown users are reported as not
+// consenting.
+func CheckConsents(w http.ResponseWriter, r *http.Request) {
+	purpose := r.URL.Query().Get("purpose")
+	if err := validation.ValidateConsentPurpose(purpose); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	var userIDs []int64
+	for _, value := range strings.Split(r.URL.Query().Get("user_ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid user_ids parameter", http.StatusBadRequest, err)
+			return
+		}
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) > maxConsentCheckUsers {
+		http.Error(w, fmt.Sprintf("at most %d users can be checked at once", maxConsentCheckUsers), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT u.id, "+consentClause("u.id", purpose)+`
+		FROM users u WHERE u.id = ANY($1)`, pq.Array(userIDs))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to check consents", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	granted := map[string]bool{}
+	for _, id := range userIDs {
+		granted[strconv.FormatInt(id, 10)] = false
+	}
+	for rows.Next() {
+		var (
+			id int64
+			ok bool
+		)
+		if err := rows.Scan(&id, &ok); err != nil {
+			middlewares.HttpError(w, "Failed to check consents", http.StatusInternalServerError, err)
+			return
+		}
+		granted[strconv.FormatInt(id, 10)] = ok
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to check consents", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]interface{}{"purpose": purpose, "granted": granted}, http.StatusOK)
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const consistencyReportKey = "consistency:last_report"
+
+// EntityConsistency describes how the cached copies of one entity type
+// compare with Postgres.
+type EntityConsistency struct {
+	Entity       string     `json:"entity"`
+	DBCount      int        `json:"db_count"`
+	CachedCount  *int       `json:"cached_count"`
+	DBLatest     *time.Time `json:"db_latest"`
+	CachedLatest *time.Time `json:"cached_latest"`
+	ListStale    bool       `json:"list_stale"`
+	ItemsChecked int        `json:"items_checked"`
+	StaleItems   []string   `json:"stale_items"`
+}
+
+// ConsistencyReport is the result of one consistency check run.
+type ConsistencyReport struct {
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	AutoHeal   bool                `json:"auto_heal"`
+	Drift      bool                `json:"drift"`
+	Entities   []EntityConsistency `json:"entities"`
+}
+
+// RunConsistencyCheck is the nightly job entry point. It checks every cached
+// entity, heals drift unless CACHE_CONSISTENCY_AUTO_HEAL=false and stores the report.
+func RunConsistencyCheck(ctx context.Context) error {
+	_, err := runConsistencyCheck(ctx)
+	return err
+}
+
+func runConsistencyCheck(ctx context.Context) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{
+		StartedAt: time.Now(),
+		AutoHeal:  os.Getenv("CACHE_CONSISTENCY_AUTO_HEAL") != "false",
+	}
+
+	posts, err := checkEntityConsistency(ctx, postsCacheEntity, queryPosts,
+		func(p models.Post) string { return p.ID.String() },
+		func(p models.Post) time.Time { return p.CreatedAt },
+		report.AutoHeal)
+	if err != nil {
+		return nil, err
+	}
+
+	lives, err := checkEntityConsistency(ctx, livesCacheEntity, queryLives,
+		func(l models.Live) string { return l.ID.String() },
+		func(l models.Live) time.Time { return l.CreatedAt },
+		report.AutoHeal)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Entities = []EntityConsistency{posts, lives}
+	for _, entity := range report.Entities {
+		if entity.ListStale || len(entity.StaleItems) > 0 {
+			report.Drift = true
+			log.Printf("Cache drift detected for %s: list stale=%t, stale items=%v (healed=%t)",
+				entity.Entity, entity.ListStale, entity.StaleItems, report.AutoHeal)
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	const CacheTime = 30 * 24 * time.Hour
+	if err := db.RedisClient.Set(ctx, consistencyReportKey, jsonData, CacheTime).Err(); err != nil {
+		return nil, fmt.Errorf("error storing consistency report: %w", err)
+	}
+
+	return report, nil
+}
+
+// checkEntityConsistency compares the cached list and the cached single items
+// of an entity with the database. Only keys of the current cache version are
+// checked. Stale keys are deleted when heal is set, so the next read
+// repopulates them from Postgres.
+func checkEntityConsistency[T any](
+	ctx context.Context,
+	entity string,
+	query func(context.Context) ([]T, error),
+	idOf func(T) string,
+	timeOf func(T) time.Time,
+	heal bool,
+) (EntityConsistency, error) {
+	result := EntityConsistency{Entity: entity, StaleItems: []string{}}
+
+	listKey, err := db.CacheKey(ctx, entity, "")
+	if err != nil {
+		return result, err
+	}
+	itemPrefix := listKey + ":"
+
+	rows, err := query(ctx)
+	if err != nil {
+		return result, err
+	}
+	fromDB := make(map[string][]byte, len(rows))
+	for _, row := range rows {
+		canonical, err := json.Marshal(row)
+		if err != nil {
+			return result, err
+		}
+		fromDB[idOf(row)] = canonical
+	}
+	result.DBCount = len(rows)
+	result.DBLatest = latestOf(rows, timeOf)
+
+	var staleKeys []string
+
+	cachedList, err := db.RedisClient.Get(ctx, listKey).Bytes()
+	if err == nil {
+		var cached []T
+		if err := json.Unmarshal(cachedList, &cached); err != nil {
+			result.ListStale = true
+		} else {
+			count := len(cached)
+			result.CachedCount = &count
+			result.CachedLatest = latestOf(cached, timeOf)
+			result.ListStale = count != result.DBCount || !sameTime(result.CachedLatest, result.DBLatest)
+			for _, item := range cached {
+				if !matchesDB(item, fromDB[idOf(item)]) {
+					result.ListStale = true
+					break
+				}
+			}
+		}
+		if result.ListStale {
+			staleKeys = append(staleKeys, listKey)
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		return result, fmt.Errorf("error fetching %s from Redis cache: %w", listKey, err)
+	}
+
+	iter := db.RedisClient.Scan(ctx, 0, itemPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		cachedItem, err := db.RedisClient.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("error fetching %s from Redis cache: %w", key, err)
+		}
+
+		result.ItemsChecked++
+		var item T
+		if err := json.Unmarshal(cachedItem, &item); err != nil || !matchesDB(item, fromDB[key[len(itemPrefix):]]) {
+			result.StaleItems = append(result.StaleItems, key)
+			staleKeys = append(staleKeys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return result, fmt.Errorf("error scanning %s cache keys: %w", entity, err)
+	}
+
+	if heal && len(staleKeys) > 0 {
+		// Filtered lists cannot be checked one by one; they go with any
+		// stale entry.
+		staleKeys = append(staleKeys, db.FilteredListsKey(listKey))
+		if err := db.RedisClient.Del(ctx, staleKeys...).Err(); err != nil {
+			return result, fmt.Errorf("error deleting stale %s cache keys: %w", entity, err)
+		}
+	}
+
+	return result, nil
+}
+
+func matchesDB[T any](cached T, fromDB []byte) bool {
+	if fromDB == nil {
+		return false
+	}
+	canonical, err := json.Marshal(cached)
+	return err == nil && bytes.Equal(canonical, fromDB)
+}
+
+func latestOf[T any](items []T, timeOf func(T) time.Time) *time.Time {
+	var latest *time.Time
+	for _, item := range items {
+		t := timeOf(item)
+		if latest == nil || t.After(*latest) {
+			latest = &t
+		}
+	}
+	return latest
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func GetConsistencyReport(w http.ResponseWriter, r *http.Request) {
+	data, err := db.RedisClient.Get(r.Context(), consistencyReportKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		http.Error(w, "No consistency check has run yet", http.StatusNotFound)
+		return
+	} else if err != nil {
+		middlewares.HttpError(w, "Failed to fetch consistency report", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func RunConsistencyCheckNow(w http.ResponseWriter, r *http.Request) {
+	report, err := runConsistencyCheck(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to run consistency check", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
+
+// cachedEntities maps the entity types whose cache versions can be bumped to
+// the surrogate key that tags all their responses.
+var cachedEntities = map[string]string{
+	postsCacheEntity:   surrogateKeyPostsAll,
+	livesCacheEntity:   surrogateKeyLivesAll,
+	sermonsCacheEntity: surrogateKeySermonsAll,
+}
+
+// InvalidateEntityCache drops every cached key of an entity type at once by
+// bumping its cache version, e.g. after a bulk import, and purges the
+// entity's responses from the CDN.
+func InvalidateEntityCache(w http.ResponseWriter, r *http.Request) {
+	entity := r.URL.Query().Get("entity")
+	surrogateKey, ok := cachedEntities[entity]
+	if !ok {
+		http.Error(w, "Unknown cached entity", http.StatusBadRequest)
+		return
+	}
+
+	version, err := db.BumpCacheVersion(r.Context(), entity)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to invalidate cache", http.StatusInternalServerError, err)
+		return
+	}
+	queueCDNPurge(r.Context(), surrogateKey)
+
+	middlewares.RespondJSON(w, map[string]interface{}{"entity": entity, "version": version}, http.StatusOK)
+}
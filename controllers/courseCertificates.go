@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/pdf"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// JobCourseCertificate renders a completion certificate into the media library.
+	JobCourseCertificate = "course_certificate"
+	certificateNamespace = "certificates"
+)
+
+// courseCertificatePayload is the payload of a JobCourseCertificate job.
+type courseCertificatePayload struct {
+	CertificateID uuid.UUID `json:"certificate_id"`
+}
+
+// GetCourseCertificate downloads the current user's completion certificate.
+// While the job queue has not rendered it yet, it responds 202 Accepted.
+func GetCourseCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var status string
+	var mediaID uuid.NullUUID
+	err = db.DB.QueryRowContext(r.Context(), "SELECT status, media_id FROM course_certificates WHERE course_id = $1 AND user_id = $2",
+		courseID, userID).Scan(&status, &mediaID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Course is not completed", http.StatusNotFound, ErrCertificateNotYet)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch certificate", http.StatusInternalServerError, err)
+		return
+	}
+
+	switch {
+	case status == models.CertificateReady && mediaID.Valid:
+		serveMedia(w, r, mediaID.UUID, "certificate-"+courseID.String()+".pdf")
+	case status == models.CertificateFailed:
+		http.Error(w, "Certificate could not be generated", http.StatusInternalServerError)
+	default:
+		middlewares.RespondJSON(w, map[string]string{"status": models.CertificatePending}, http.StatusAccepted)
+	}
+}
+
+// serveMedia streams a media library item as an attachment.
+func serveMedia(w http.ResponseWriter, r *http.Request, id uuid.UUID, filename string) {
+	item, reader, err := media.Open(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, media.ErrItemNotFound) {
+			middlewares.HttpError(w, "File not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to open file", http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+
+	if filename == "" {
+		filename = item.Filename
+	}
+	w.Header().Set("Content-Type", item.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to stream media %s: %v", item.ID, err)
+	}
+}
+
+// enqueueCourseCertificate queues the certificate job in the transaction that
+// completed the course, so a completion is never left without a certificate.
+func enqueueCourseCertificate(ctx context.Context, tx *sql.Tx, courseID uuid.UUID, userID int64) error {
+	var certificateID uuid.UUID
+	err := tx.QueryRowContext(ctx, `INSERT INTO course_certificates (course_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (course_id, user_id) DO NOTHING
+		RETURNING id`, courseID, userID).Scan(&certificateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The certificate was issued on an earlier completion.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = jobs.Enqueue(ctx, tx, JobCourseCertificate, courseCertificatePayload{CertificateID: certificateID})
+	return err
+}
+
+// RenderCourseCertificate is the job handler for JobCourseCertificate.
+func RenderCourseCertificate(ctx context.Context, task *jobs.Task) (any, error) {
+	var payload courseCertificatePayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	mediaID, err := renderCourseCertificate(ctx, payload.CertificateID)
+	if err != nil {
+		if task.LastAttempt() {
+			_, dbErr := db.DB.ExecContext(context.WithoutCancel(ctx),
+				"UPDATE course_certificates SET status = 'failed' WHERE id = $1", payload.CertificateID)
+			if dbErr != nil {
+				log.Printf("Failed to mark certificate %s as failed: %v", payload.CertificateID, dbErr)
+			}
+		}
+		return nil, err
+	}
+
+	return map[string]uuid.UUID{"media_id": mediaID}, nil
+}
+
+func renderCourseCertificate(ctx context.Context, certificateID uuid.UUID) (uuid.UUID, error) {
+	var (
+		data     pdf.CertificateData
+		userID   int64
+		existing uuid.NullUUID
+	)
+	err := db.DB.QueryRowContext(ctx, `SELECT c.title, u.username, u.id, COALESCE(e.completed_at, cc.created_at), cc.media_id
+		FROM course_certificates cc
+		JOIN courses c ON c.id = cc.course_id
+		JOIN users u ON u.id = cc.user_id
+		LEFT JOIN enrollments e ON e.course_id = cc.course_id AND e.user_id = cc.user_id
+		WHERE cc.id = $1`, certificateID).
+		Scan(&data.CourseTitle, &data.Name, &userID, &data.CompletedAt, &existing)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The course or the user was deleted; there is nothing to render.
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, fmt.Errorf("error querying database: %w", err)
+	}
+	if existing.Valid {
+		return existing.UUID, nil
+	}
+
+	document, err := json.Marshal(data)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	rendered, err := pdf.Render(pdf.TemplateCourseCertificate, document)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	item, err := media.Store(ctx, certificateNamespace, "certificate.pdf", "application/pdf", rendered, &userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := db.DB.ExecContext(ctx, `UPDATE course_certificates
+		SET status = 'ready', media_id = $1, generated_at = $2
+		WHERE id = $3 AND media_id IS NULL`, item.ID, time.Now(), certificateID)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 1 {
+			return item.ID, nil
+		}
+	}
+
+	// Another worker finished first or the certificate is gone; drop this copy.
+	if delErr := media.DeleteItem(context.WithoutCancel(ctx), item.ID); delErr != nil {
+		log.Printf("Failed to delete unused certificate %s: %v", item.ID, delErr)
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error updating certificate: %w", err)
+	}
+	return uuid.Nil, nil
+}
@@ -0,0 +1,742 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCourseNotFound    = errors.New("course not found")
+	ErrLessonNotFound    = errors.New("lesson not found")
+	ErrNotEnrolled       = errors.New("not enrolled in this course")
+	ErrInvalidLessonIDs  = errors.New("lesson_ids must list every lesson of the course exactly once")
+	ErrCertificateNotYet = errors.New("course is not completed")
+)
+
+// SetupCourseRoutes registers the courses endpoints. Anyone can browse
+// courses, signed-in users can enroll and track progress, and staff manage
+// the course content.
+func SetupCourseRoutes(r *mux.Router) {
+	user := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(h)
+	}
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+
+	coursesRouter := r.PathPrefix("/courses").Subrouter()
+	coursesRouter.HandleFunc("", GetCourses).Methods("GET")
+	coursesRouter.Handle("", staff(CreateCourse)).Methods("POST")
+	coursesRouter.Handle("", staff(UpdateCourse)).Methods("PUT").Queries("id", "{id}")
+	coursesRouter.Handle("", staff(DeleteCourse)).Methods("DELETE").Queries("id", "{id}")
+
+	coursesRouter.Handle("/lessons", staff(CreateLesson)).Methods("POST").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/lessons", staff(UpdateLesson)).Methods("PUT").Queries("id", "{id}")
+	coursesRouter.Handle("/lessons", staff(DeleteLesson)).Methods("DELETE").Queries("id", "{id}")
+	coursesRouter.Handle("/lessons/order", staff(ReorderLessons)).Methods("PUT").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/lessons/complete", user(CompleteLesson)).Methods("POST").Queries("id", "{id}")
+
+	coursesRouter.Handle("/enrollments", user(GetMyEnrollments)).Methods("GET")
+	coursesRouter.Handle("/enroll", user(EnrollInCourse)).Methods("POST").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/enroll", user(UnenrollFromCourse)).Methods("DELETE").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/progress", user(GetCourseProgress)).Methods("GET").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/certificate", user(GetCourseCertificate)).Methods("GET").Queries("course_id", "{course_id}")
+	setupQuizRoutes(coursesRouter)
+}
+
+// GetCourses lists courses, or returns one course with its lessons when an id
+// is given.
+func GetCourses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		course, err := queryCourse(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrCourseNotFound) {
+				middlewares.HttpError(w, "Course not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch course", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, course, http.StatusOK)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, title, description, created_at, updated_at FROM courses ORDER BY title")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch courses", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	courses := []models.Course{}
+	for rows.Next() {
+		var course models.Course
+		if err := rows.Scan(&course.ID, &course.Title, &course.Description, &course.CreatedAt, &course.UpdatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch courses", http.StatusInternalServerError, err)
+			return
+		}
+		courses = append(courses, course)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch courses", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, courses, http.StatusOK)
+}
+
+func queryCourse(ctx context.Context, id uuid.UUID) (models.Course, error) {
+	var course models.Course
+	err := db.DB.QueryRowContext(ctx, "SELECT id, title, description, created_at, updated_at FROM courses WHERE id = $1", id).
+		Scan(&course.ID, &course.Title, &course.Description, &course.CreatedAt, &course.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Course{}, ErrCourseNotFound
+		}
+		return models.Course{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, course_id, position, title, content, created_at, updated_at
+		FROM lessons WHERE course_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return models.Course{}, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	course.Lessons = []models.Lesson{}
+	for rows.Next() {
+		var lesson models.Lesson
+		if err := rows.Scan(&lesson.ID, &lesson.CourseID, &lesson.Position, &lesson.Title, &lesson.Content,
+			&lesson.CreatedAt, &lesson.UpdatedAt); err != nil {
+			return models.Course{}, fmt.Errorf("error scanning row: %w", err)
+		}
+		course.Lessons = append(course.Lessons, lesson)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Course{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return course, nil
+}
+
+func CreateCourse(w http.ResponseWriter, r *http.Request) {
+	var course models.Course
+	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateCourse(&course); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	course.ID = uuid.New()
+	course.CreatedAt = time.Now()
+	course.UpdatedAt = course.CreatedAt
+	course.Lessons = nil
+
+	_, err := db.DB.ExecContext(r.Context(), `INSERT INTO courses (id, title, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)`, course.ID, course.Title, course.Description, course.CreatedAt, course.UpdatedAt)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create course", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, course, http.StatusCreated)
+}
+
+func UpdateCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var course models.Course
+	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateCourse(&course); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	course.Lessons = nil
+	err = db.DB.QueryRowContext(r.Context(), `UPDATE courses SET title = $1, description = $2, updated_at = NOW()
+		WHERE id = $3 RETURNING id, created_at, updated_at`, course.Title, course.Description, id).
+		Scan(&course.ID, &course.CreatedAt, &course.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Course not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update course", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, course, http.StatusOK)
+}
+
+func DeleteCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM courses WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete course", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Course not found", http.StatusNotFound, ErrCourseNotFound)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Course deleted"}, http.StatusOK)
+}
+
+// CreateLesson adds a lesson, appended unless a position is given.
+func CreateLesson(w http.ResponseWriter, r *http.Request) {
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var lesson models.Lesson
+	if err := json.NewDecoder(r.Body).Decode(&lesson); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateLesson(&lesson); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	lesson.ID = uuid.New()
+	lesson.CourseID = courseID
+	lesson.CreatedAt = time.Now()
+	lesson.UpdatedAt = lesson.CreatedAt
+
+	if err := insertLesson(r.Context(), &lesson); err != nil {
+		if errors.Is(err, ErrCourseNotFound) {
+			middlewares.HttpError(w, "Course not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create lesson", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, lesson, http.StatusCreated)
+}
+
+func insertLesson(ctx context.Context, lesson *models.Lesson) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the course so concurrent edits of its lessons are serialised.
+	var exists bool
+	err = tx.QueryRowContext(ctx, "SELECT true FROM courses WHERE id = $1 FOR UPDATE", lesson.CourseID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCourseNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM lessons WHERE course_id = $1", lesson.CourseID).Scan(&count); err != nil {
+		return err
+	}
+	if lesson.Position < 1 || lesson.Position > count {
+		lesson.Position = count + 1
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE lessons SET position = position + 1 WHERE course_id = $1 AND position >= $2",
+			lesson.CourseID, lesson.Position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO lessons (id, course_id, position, title, content, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		lesson.ID, lesson.CourseID, lesson.Position, lesson.Title, lesson.Content, lesson.CreatedAt, lesson.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateLesson edits a lesson's content. Use the order endpoint to move it.
+func UpdateLesson(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var lesson models.Lesson
+	if err := json.NewDecoder(r.Body).Decode(&lesson); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateLesson(&lesson); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	err = db.DB.QueryRowContext(r.Context(), `UPDATE lessons SET title = $1, content = $2, updated_at = NOW()
+		WHERE id = $3 RETURNING id, course_id, position, created_at, updated_at`, lesson.Title, lesson.Content, id).
+		Scan(&lesson.ID, &lesson.CourseID, &lesson.Position, &lesson.CreatedAt, &lesson.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Lesson not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update lesson", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, lesson, http.StatusOK)
+}
+
+// DeleteLesson removes a lesson and closes the gap in the positions.
+func DeleteLesson(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete lesson", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var courseID uuid.UUID
+	err = tx.QueryRowContext(ctx, "DELETE FROM lessons WHERE id = $1 RETURNING course_id", id).Scan(&courseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Lesson not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to delete lesson", http.StatusInternalServerError, err)
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE lessons l SET position = o.rn
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position) AS rn FROM lessons WHERE course_id = $1) o
+		WHERE l.id = o.id`, courseID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete lesson", http.StatusInternalServerError, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		middlewares.HttpError(w, "Failed to delete lesson", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Lesson deleted"}, http.StatusOK)
+}
+
+// ReorderLessons sets the order of all lessons of a course at once.
+func ReorderLessons(w http.ResponseWriter, r *http.Request) {
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		LessonIDs []uuid.UUID `json:"lesson_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := reorderLessons(ctx, courseID, payload.LessonIDs); err != nil {
+		if errors.Is(err, ErrInvalidLessonIDs) {
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to reorder lessons", http.StatusInternalServerError, err)
+		return
+	}
+
+	course, err := queryCourse(ctx, courseID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch course", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, course, http.StatusOK)
+}
+
+func reorderLessons(ctx context.Context, courseID uuid.UUID, lessonIDs []uuid.UUID) error {
+	ids := make([]string, len(lessonIDs))
+	seen := make(map[uuid.UUID]bool, len(lessonIDs))
+	for i, id := range lessonIDs {
+		if seen[id] {
+			return ErrInvalidLessonIDs
+		}
+		seen[id] = true
+		ids[i] = id.String()
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM lessons WHERE course_id = $1", courseID).Scan(&count); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE lessons l SET position = o.ord, updated_at = NOW()
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, ord)
+		WHERE l.id = o.id AND l.course_id = $1`, courseID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(affected) != count || len(ids) != count {
+		return ErrInvalidLessonIDs
+	}
+
+	return tx.Commit()
+}
+
+func EnrollInCourse(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO enrollments (course_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (course_id, user_id) DO NOTHING`, courseID, userID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			middlewares.HttpError(w, "Course not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to enroll", http.StatusInternalServerError, err)
+		return
+	}
+	clearDashboardSection(ctx, userID, dashboardCourses)
+
+	progress, err := queryCourseProgress(ctx, courseID, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch progress", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, progress, http.StatusCreated)
+}
+
+// UnenrollFromCourse leaves a course. Lesson completions are kept so that
+// re-enrolling resumes where the user left off.
+func UnenrollFromCourse(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM enrollments WHERE course_id = $1 AND user_id = $2", courseID, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to unenroll", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Not enrolled in this course", http.StatusNotFound, ErrNotEnrolled)
+		return
+	}
+	clearDashboardSection(r.Context(), userID, dashboardCourses)
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Unenrolled"}, http.StatusOK)
+}
+
+func GetMyEnrollments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	enrollments, err := queryEnrollments(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch enrollments", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, enrollments, http.StatusOK)
+}
+
+// queryEnrollments returns the user's progress in every course they are
+// enrolled in, most recent enrollment first.
+func queryEnrollments(ctx context.Context, userID int64) ([]models.CourseProgress, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT course_id FROM enrollments WHERE user_id = $1 ORDER BY enrolled_at DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	var courseIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		courseIDs = append(courseIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	enrollments := make([]models.CourseProgress, 0, len(courseIDs))
+	for _, courseID := range courseIDs {
+		progress, err := queryCourseProgress(ctx, courseID, userID)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, progress)
+	}
+	return enrollments, nil
+}
+
+func GetCourseProgress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	progress, err := queryCourseProgress(r.Context(), courseID, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotEnrolled) {
+			middlewares.HttpError(w, "Not enrolled in this course", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch progress", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, progress, http.StatusOK)
+}
+
+func queryCourseProgress(ctx context.Context, courseID uuid.UUID, userID int64) (models.CourseProgress, error) {
+	progress := models.CourseProgress{CourseID: courseID, CompletedLessonIDs: []uuid.UUID{}, PassedQuizIDs: []uuid.UUID{}}
+	var certificateStatus sql.NullString
+	err := db.DB.QueryRowContext(ctx, `SELECT c.title, e.enrolled_at, e.completed_at,
+			(SELECT COUNT(*) FROM lessons WHERE course_id = c.id), cc.status
+		FROM enrollments e
+		JOIN courses c ON c.id = e.course_id
+		LEFT JOIN course_certificates cc ON cc.course_id = e.course_id AND cc.user_id = e.user_id
+		WHERE e.course_id = $1 AND e.user_id = $2`, courseID, userID).
+		Scan(&progress.CourseTitle, &progress.EnrolledAt, &progress.CompletedAt, &progress.TotalLessons, &certificateStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return progress, ErrNotEnrolled
+		}
+		return progress, fmt.Errorf("error querying database: %w", err)
+	}
+	progress.CertificateStatus = certificateStatus.String
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT l.id FROM lesson_completions lc
+		JOIN lessons l ON l.id = lc.lesson_id
+		WHERE l.course_id = $1 AND lc.user_id = $2 ORDER BY l.position`, courseID, userID)
+	if err != nil {
+		return progress, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return progress, fmt.Errorf("error scanning row: %w", err)
+		}
+		progress.CompletedLessonIDs = append(progress.CompletedLessonIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return progress, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	rows, err = db.DB.QueryContext(ctx, `SELECT q.id, EXISTS (
+			SELECT 1 FROM quiz_attempts qa WHERE qa.quiz_id = q.id AND qa.user_id = $2 AND qa.passed)
+		FROM quizzes q WHERE q.course_id = $1 ORDER BY q.created_at`, courseID, userID)
+	if err != nil {
+		return progress, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var passed bool
+		if err := rows.Scan(&id, &passed); err != nil {
+			return progress, fmt.Errorf("error scanning row: %w", err)
+		}
+		progress.TotalQuizzes++
+		if passed {
+			progress.PassedQuizIDs = append(progress.PassedQuizIDs, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return progress, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if total := progress.TotalLessons + progress.TotalQuizzes; total > 0 {
+		progress.PercentComplete = (len(progress.CompletedLessonIDs) + len(progress.PassedQuizIDs)) * 100 / total
+	}
+
+	return progress, nil
+}
+
+// CompleteLesson marks a lesson as done for the current user. Completing the
+// last lesson, with every quiz passed, completes the course and queues the
+// user's certificate.
+func CompleteLesson(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	lessonID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	courseID, err := completeLesson(ctx, lessonID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrLessonNotFound):
+			middlewares.HttpError(w, "Lesson not found", http.StatusNotFound, err)
+		case errors.Is(err, ErrNotEnrolled):
+			middlewares.HttpError(w, "Not enrolled in this course", http.StatusForbidden, err)
+		default:
+			middlewares.HttpError(w, "Failed to complete lesson", http.StatusInternalServerError, err)
+		}
+		return
+	}
+	clearDashboardSection(ctx, userID, dashboardCourses)
+
+	progress, err := queryCourseProgress(ctx, courseID, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch progress", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, progress, http.StatusOK)
+}
+
+func completeLesson(ctx context.Context, lessonID uuid.UUID, userID int64) (uuid.UUID, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var courseID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT course_id FROM lessons WHERE id = $1", lessonID).Scan(&courseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrLessonNotFound
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+
+	completed, err := lockEnrollment(ctx, tx, courseID, userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO lesson_completions (lesson_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (lesson_id, user_id) DO NOTHING`, lessonID, userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !completed {
+		if err := completeCourseIfDone(ctx, tx, courseID, userID); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	return courseID, tx.Commit()
+}
+
+// lockEnrollment locks a user's enrollment for the rest of the transaction, so
+// that two concurrent completions cannot both miss the course completion. It
+// reports whether the course is already completed.
+func lockEnrollment(ctx context.Context, tx *sql.Tx, courseID uuid.UUID, userID int64) (bool, error) {
+	var completedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, "SELECT completed_at FROM enrollments WHERE course_id = $1 AND user_id = $2 FOR UPDATE",
+		courseID, userID).Scan(&completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotEnrolled
+	} else if err != nil {
+		return false, err
+	}
+	return completedAt.Valid, nil
+}
+
+// completeCourseIfDone completes the enrollment and queues the certificate
+// once every lesson is completed and every quiz is passed. The enrollment
+// must be locked with lockEnrollment.
+func completeCourseIfDone(ctx context.Context, tx *sql.Tx, courseID uuid.UUID, userID int64) error {
+	var remaining int
+	err := tx.QueryRowContext(ctx, `SELECT
+			(SELECT COUNT(*) FROM lessons l
+				WHERE l.course_id = $1 AND NOT EXISTS (
+					SELECT 1 FROM lesson_completions lc WHERE lc.lesson_id = l.id AND lc.user_id = $2))
+			+ (SELECT COUNT(*) FROM quizzes q
+				WHERE q.course_id = $1 AND NOT EXISTS (
+					SELECT 1 FROM quiz_attempts qa WHERE qa.quiz_id = q.id AND qa.user_id = $2 AND qa.passed))`,
+		courseID, userID).Scan(&remaining)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE enrollments SET completed_at = NOW() WHERE course_id = $1 AND user_id = $2",
+		courseID, userID)
+	if err != nil {
+		return err
+	}
+	return enqueueCourseCertificate(ctx, tx, courseID, userID)
+}
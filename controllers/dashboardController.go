@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// Dashboard section names.
+const (
+	dashboardCourses = "courses"
+)
+
+// dashboardSection is one part of the member dashboard. Sections are loaded
+// concurrently and cached per user for ttl.
+type dashboardSection struct {
+	name string
+	ttl  time.Duration
+	load func(ctx context.Context, userID int64) (any, error)
+}
+
+var dashboardSections = []dashboardSection{
+	{name: dashboardCourses, ttl: 10 * time.Minute, load: func(ctx context.Context, userID int64) (any, error) {
+		return queryEnrollments(ctx, userID)
+	}},
+}
+
+func dashboardCacheKey(userID int64, section string) string {
+	return fmt.Sprintf("dashboard:%d:%s", userID, section)
+}
+
+// clearDashboardSection drops a user's cached section after it changed.
+func clearDashboardSection(ctx context.Context, userID int64, section string) {
+	if err := db.RedisClient.Del(ctx, dashboardCacheKey(userID, section)).Err(); err != nil {
+		log.Printf("Failed to clear dashboard section %s of user %d: %v", section, userID, err)
+	}
+}
+
+func SetupDashboardRoutes(r *mux.Router) {
+	r.Handle("/me/dashboard", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetMyDashboard))).Methods("GET")
+}
+
+// GetMyDashboard returns everything the member app shows on its home screen
+// in one response. A section that fails to load is listed as unavailable
+// instead of failing the whole dashboard.
+func GetMyDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	dashboard := models.Dashboard{Sections: map[string]json.RawMessage{}, Unavailable: []string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, section := range dashboardSections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := fetchDashboardSection(ctx, userID, section)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Failed to load dashboard section %s of user %d: %v", section.name, userID, err)
+				dashboard.Unavailable = append(dashboard.Unavailable, section.name)
+				return
+			}
+			dashboard.Sections[section.name] = data
+		}()
+	}
+	wg.Wait()
+	sort.Strings(dashboard.Unavailable)
+
+	middlewares.RespondJSON(w, dashboard, http.StatusOK)
+}
+
+func fetchDashboardSection(ctx context.Context, userID int64, section dashboardSection) (json.RawMessage, error) {
+	key := dashboardCacheKey(userID, section.name)
+	cachedData, err := db.RedisClient.Get(ctx, key).Bytes()
+	if err == nil {
+		return cachedData, nil
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("Failed to read %s from Redis cache: %v", key, err)
+	}
+
+	value, err := section.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	db.RedisClient.Set(ctx, key, jsonData, section.ttl)
+	return jsonData, nil
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"jsmi-api/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+func TestDashboardRoute(t *testing.T) {
+	router := mux.NewRouter()
+	SetupDashboardRoutes(router)
+	var match mux.RouteMatch
+	if !router.Match(httptest.NewRequest(http.MethodGet, "/me/dashboard", nil), &match) {
+		t.Fatal("GET /me/dashboard matches no route")
+	}
+}
+
+// TestDashboardSectionSkipsUnavailableCache checks that a section is loaded
+// from Postgres when Redis cannot be reached.
+func TestDashboardSectionSkipsUnavailableCache(t *testing.T) {
+	previous := db.RedisClient
+	db.RedisClient = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() {
+		db.RedisClient.Close()
+		db.RedisClient = previous
+	})
+
+	section := dashboardSection{name: "test", ttl: time.Minute, load: func(ctx context.Context, userID int64) (any, error) {
+		return map[string]int64{"user_id": userID}, nil
+	}}
+	data, err := fetchDashboardSection(context.Background(), 7, section)
+	if err != nil {
+		t.Fatalf("fetchDashboardSection() = %v", err)
+	}
+	if string(data) != `{"user_id":7}` {
+		t.Errorf("fetchDashboardSection() = %s, want the loaded section", data)
+	}
+}
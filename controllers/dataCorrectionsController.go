@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const emailCorrectionReviewed = "data_correction_reviewed"
+
+var (
+	ErrCorrectionNotFound = errors.New("correction request not found")
+	ErrCorrectionPending  = errors.New("a correction of this field is already pending")
+	ErrCorrectionReviewed = errors.New("the correction request has already been reviewed")
+)
+
+// correctionCurrentValue is the stored value of a request's field, as text.
+// It must cover validation.CorrectableFields.
+const correctionCurrentValue = `CASE d.field
+		WHEN 'username' THEN u.username
+		WHEN 'birthday' THEN COALESCE(to_char(u.birthday, 'YYYY-MM-DD'), '')
+		WHEN 'anniversary' THEN COALESCE(to_char(u.anniversary, 'YYYY-MM-DD'), '')
+	END`
+
+// correctionUpdates set a user's field to the proposed value, $1.
+var correctionUpdates = map[string]string{
+	"username":    "username = $1",
+	"birthday":    "birthday = NULLIF($1, '')::date",
+	"anniversary": "anniversary = NULLIF($1, '')::date",
+}
+
+const dataCorrectionColumns = `d.id, d.user_id, u.username, d.field, ` + correctionCurrentValue + `, d.value_at_request,
+	d.proposed_value, d.reason, d.status, d.review_note, d.applied_over, d.reviewed_by, d.reviewed_at, d.created_at`
+
+func scanDataCorrection(row rowScanner) (models.DataCorrectionRequest, error) {
+	var request models.DataCorrectionRequest
+	err := row.Scan(&request.ID, &request.UserID, &request.Username, &request.Field, &request.CurrentValue,
+		&request.ValueAtRequest, &request.ProposedValue, &request.Reason, &request.Status, &request.ReviewNote,
+		&request.AppliedOver, &request.ReviewedBy, &request.ReviewedAt, &request.CreatedAt)
+	return request, err
+}
+
+func queryDataCorrection(ctx context.Context, id uuid.UUID) (models.DataCorrectionRequest, error) {
+	request, err := scanDataCorrection(db.DB.QueryRowContext(ctx, "SELECT "+dataCorrectionColumns+`
+		FROM data_correction_requests d
+		JOIN users u ON u.id = d.user_id
+		WHERE d.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DataCorrectionRequest{}, ErrCorrectionNotFound
+	}
+	if err != nil {
+		return models.DataCorrectionRequest{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return request, nil
+}
+
+func respondCorrectionError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrCorrectionNotFound):
+		middlewares.HttpError(w, "Correction request not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrCorrectionPending), errors.Is(err, ErrCorrectionReviewed):
+		middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// RequestDataCorrection lets members ask for a field of their data to be
+// corrected. The request waits for an admin to review it.
+func RequestDataCorrection(w http.ResponseWriter, r *http.Request) {
+	var request models.DataCorrectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateDataCorrectionRequest(&request, time.Now().UTC()); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	var id uuid.UUID
+	err := db.DB.QueryRowContext(ctx, `INSERT INTO data_correction_requests (user_id, field, value_at_request, proposed_value, reason)
+		SELECT u.id, d.field, `+correctionCurrentValue+`, $3, $4
+		FROM users u, (SELECT $2::VARCHAR AS field) d
+		WHERE u.id = $1
+		RETURNING id`, userID, request.Field, request.ProposedValue, request.Reason).Scan(&id)
+	if isUniqueViolation(err) {
+		respondCorrectionError(w, "", ErrCorrectionPending)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to request correction", http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := queryDataCorrection(ctx, id)
+	if err != nil {
+		respondCorrectionError(w, "Failed to fetch correction request", err)
+		return
+	}
+	middlewares.RespondCreated(w, "/auth/me/corrections", created)
+}
+
+// GetMyDataCorrections lists the caller's correction requests, newest first.
+func GetMyDataCorrections(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	listDataCorrections(w, r, "d.user_id = $1", "d.created_at DESC, d.id", userID)
+}
+
+// GetDataCorrections lists correction requests with ?status= (pending by
+// default), oldest first, each with the stored and the proposed value side
+// by side.
+func GetDataCorrections(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.CorrectionPending
+	case models.CorrectionPending, models.CorrectionApplied, models.CorrectionRejected:
+	default:
+		http.Error(w, "status must be pending, applied or rejected", http.StatusBadRequest)
+		return
+	}
+	listDataCorrections(w, r, "d.status = $1", "d.created_at, d.id", status)
+}
+
+func listDataCorrections(w http.ResponseWriter, r *http.Request, filter, order string, arg any) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM data_correction_requests d WHERE "+filter, arg).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch correction requests", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+dataCorrectionColumns+`
+		FROM data_correction_requests d
+		JOIN users u ON u.id = d.user_id
+		WHERE `+filter+`
+		ORDER BY `+order+`
+		LIMIT $2 OFFSET $3`, arg, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch correction requests", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.DataCorrectionRequest{}
+	for rows.Next() {
+		request, err := scanDataCorrection(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch correction requests", http.StatusInternalServerError, err)
+			return
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch correction requests", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.DataCorrectionRequest]{
+		Items:   requests,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// decodeReviewNote reads the optional {"note": ...} of a review.
+func decodeReviewNote(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var payload struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return "", false
+	}
+	note := validation.SanitizeText(payload.Note)
+	if err := validation.ValidateLength("note", note, 2000); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return "", false
+	}
+	return note, true
+}
+
+// ApplyDataCorrection writes the proposed value of a pending request to the
+// member's data and tells them. The value it replaced is kept on the request.
+func ApplyDataCorrection(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	note, ok := decodeReviewNote(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+	if err := applyDataCorrection(ctx, id, adminID, note); err != nil {
+		respondCorrectionError(w, "Failed to apply correction", err)
+		return
+	}
+	reviewDataCorrectionDone(w, r, id)
+}
+
+func applyDataCorrection(ctx context.Context, id uuid.UUID, adminID int64, note string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID                        int64
+		field, status, proposed, over string
+	)
+	err = tx.QueryRowContext(ctx, `SELECT d.user_id, d.field, d.status, d.proposed_value, `+correctionCurrentValue+`
+		FROM data_correction_requests d
+		JOIN users u ON u.id = d.user_id
+		WHERE d.id = $1
+		FOR UPDATE OF d, u`, id).Scan(&userID, &field, &status, &proposed, &over)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCorrectionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	if status != models.CorrectionPending {
+		return ErrCorrectionReviewed
+	}
+	update, ok := correctionUpdates[field]
+	if !ok {
+		return fmt.Errorf("field %q cannot be corrected", field)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET "+update+" WHERE id = $2", proposed, userID); err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE data_correction_requests
+		SET status = $1, applied_over = $2, review_note = $3, reviewed_by = $4, reviewed_at = NOW()
+		WHERE id = $5`, models.CorrectionApplied, over, note, adminID, id)
+	if err != nil {
+		return fmt.Errorf("error updating correction request: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RejectDataCorrection closes a pending request without changing the data.
+// The note, which the member is sent, should say why.
+func RejectDataCorrection(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	note, ok := decodeReviewNote(w, r)
+	if !ok {
+		return
+	}
+	if note == "" {
+		http.Error(w, "note is required to reject a correction", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+	result, err := db.DB.ExecContext(ctx, `UPDATE data_correction_requests
+		SET status = $1, review_note = $2, reviewed_by = $3, reviewed_at = NOW()
+		WHERE id = $4 AND status = $5`, models.CorrectionRejected, note, adminID, id, models.CorrectionPending)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to reject correction", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		// Tell a missing request from one that was already reviewed.
+		if _, err := queryDataCorrection(ctx, id); err != nil {
+			respondCorrectionError(w, "Failed to reject correction", err)
+			return
+		}
+		respondCorrectionError(w, "", ErrCorrectionReviewed)
+		return
+	}
+	reviewDataCorrectionDone(w, r, id)
+}
+
+type correctionEmailData struct {
+	Username      string
+	Field         string
+	ProposedValue string
+	Applied       bool
+	Note          string
+}
+
+// reviewDataCorrectionDone tells the member how their request was decided
+// and answers with the reviewed request.
+func reviewDataCorrectionDone(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	ctx := r.Context()
+	request, err := queryDataCorrection(ctx, id)
+	if err != nil {
+		respondCorrectionError(w, "Failed to fetch correction request", err)
+		return
+	}
+
+	var email string
+	if err := db.DB.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1", request.UserID).Scan(&email); err != nil {
+		log.Printf("Failed to look up the email of user %d: %v", request.UserID, err)
+	} else {
+		err := mailer.SendTemplate(emailCorrectionReviewed, email, correctionEmailData{
+			Username:      request.Username,
+			Field:         request.Field,
+			ProposedValue: request.ProposedValue,
+			Applied:       request.Status == models.CorrectionApplied,
+			Note:          request.ReviewNote,
+		})
+		if err != nil {
+			log.Printf("Failed to queue correction notice for %s: %v", request.Username, err)
+		}
+	}
+
+	middlewares.RespondJSON(w, request, http.StatusOK)
+}
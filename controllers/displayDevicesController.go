@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// DisplayPrefix is the path of the API for kiosk and signage screens. Devices authenticate with the token they get when paired instead
+// of the site's bearer token.
+const DisplayPrefix = "/display/v1/"
+
+const (
+	// pairingTTL is how long a pairing code can be approved and redeemed.
+	pairingTTL = 10 * time.Minute
+	// pairingInterval is how often, in seconds, a device should poll for its
+	// token while it waits for approval.
+	pairingInterval = 5
+	// userCodeAlphabet leaves out vowels and look-alikes, so that codes read
+	// off a screen are easy to type and never spell words.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var (
+	ErrDisplayDeviceNotFound = errors.New("display device not found")
+	ErrPairingNotFound       = errors.New("pairing code not found or expired")
+	ErrPairingApproved       = errors.New("pairing code already approved")
+	ErrPairingPending        = errors.New("pairing not approved yet")
+)
+
+// SetupDisplayRoutes registers device pairing and the endpoints of paired
+// devices: read-only content for every device, uploads for kiosks.
+func SetupDisplayRoutes(router *mux.Router) {
+	displayRouter := router.PathPrefix(strings.TrimSuffix(DisplayPrefix, "/")).Subrouter()
+	displayRouter.HandleFunc("/pair", StartDevicePairing).Methods("POST")
+	displayRouter.HandleFunc("/pair/token", RedeemDevicePairing).Methods("POST")
+
+	deviceRouter := displayRouter.NewRoute().Subrouter()
+	deviceRouter.Use(middlewares.DeviceTokenAuth)
+	deviceRouter.HandleFunc("/lives", GetLive).Methods("GET").Queries("id", "{id}")
+	deviceRouter.HandleFunc("/lives", GetLives).Methods("GET")
+	deviceRouter.HandleFunc("/posts", GetPosts).Methods("GET")
+	deviceRouter.HandleFunc("/signage", GetSignageFeed).Methods("GET")
+	deviceRouter.HandleFunc("/kiosk/batches", SubmitKioskBatch).Methods("POST")
+}
+
+func pairingKey(userCode string) string {
+	return "device_pairing:" + userCode
+}
+
+func pairingDeviceKey(deviceCode string) string {
+	return "device_pairing_device:" + middlewares.HashClientToken(deviceCode)
+}
+
+// newUserCode returns a random code formatted as XXXX-XXXX.
+func newUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	buf := make([]byte, 1)
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// Skip the bytes that would favour the first letters.
+		if int(buf[0]) >= 256-256%len(userCodeAlphabet) {
+			continue
+		}
+		code = append(code, userCodeAlphabet[int(buf[0])%len(userCodeAlphabet)])
+	}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// normalizeUserCode accepts a code typed in any case, with or without the dash.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != userCodeLength {
+		return ""
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// StartDevicePairing starts pairing a display. The device shows the user
+// code for an admin to approve and polls RedeemDevicePairing with the device
+// code meanwhile.
+func StartDevicePairing(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateDeviceName(payload.Name); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	pairing, err := startDevicePairing(r.Context(), strings.TrimSpace(payload.Name))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to start pairing", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, pairing, http.StatusCreated)
+}
+
+func startDevicePairing(ctx context.Context, name string) (models.DevicePairing, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return models.DevicePairing{}, err
+	}
+	deviceCode := hex.EncodeToString(buf)
+
+	// A fresh user code is drawn until it is not in use by another pairing.
+	for attempt := 0; attempt < 5; attempt++ {
+		userCode, err := newUserCode()
+		if err != nil {
+			return models.DevicePairing{}, err
+		}
+		ok, err := db.RedisClient.SetNX(ctx, pairingDeviceKey(deviceCode), userCode, pairingTTL).Result()
+		if err != nil {
+			return models.DevicePairing{}, fmt.Errorf("error storing pairing in Redis: %w", err)
+		}
+		if !ok {
+			return models.DevicePairing{}, errors.New("device code already in use")
+		}
+
+		key := pairingKey(userCode)
+		created, err := db.RedisClient.HSetNX(ctx, key, "name", name).Result()
+		if err != nil {
+			return models.DevicePairing{}, fmt.Errorf("error storing pairing in Redis: %w", err)
+		}
+		if !created {
+			db.RedisClient.Del(ctx, pairingDeviceKey(deviceCode))
+			continue
+		}
+		if err := db.RedisClient.Expire(ctx, key, pairingTTL).Err(); err != nil {
+			return models.DevicePairing{}, fmt.Errorf("error storing pairing in Redis: %w", err)
+		}
+
+		return models.DevicePairing{
+			DeviceCode: deviceCode,
+			UserCode:   userCode,
+			ExpiresIn:  int(pairingTTL.Seconds()),
+			Interval:   pairingInterval,
+		}, nil
+	}
+	return models.DevicePairing{}, errors.New("no free pairing code")
+}
+
+// RedeemDevicePairing answers a device polling with its device code: 202
+// while the pairing waits for approval, then the device token, once.
+func RedeemDevicePairing(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		DeviceCode string `json:"device_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if payload.DeviceCode == "" {
+		http.Error(w, "device_code is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := redeemDevicePairing(r.Context(), payload.DeviceCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPairingPending):
+			w.Header().Set("Retry-After", fmt.Sprint(pairingInterval))
+			middlewares.RespondJSON(w, map[string]string{"status": "pending"}, http.StatusAccepted)
+		case errors.Is(err, ErrPairingNotFound):
+			middlewares.HttpError(w, err.Error(), http.StatusGone, err)
+		default:
+			middlewares.HttpError(w, "Failed to redeem pairing", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, token, http.StatusOK)
+}
+
+func redeemDevicePairing(ctx context.Context, deviceCode string) (models.DeviceToken, error) {
+	userCode, err := db.RedisClient.Get(ctx, pairingDeviceKey(deviceCode)).Result()
+	if errors.Is(err, redis.Nil) {
+		return models.DeviceToken{}, ErrPairingNotFound
+	}
+	if err != nil {
+		return models.DeviceToken{}, fmt.Errorf("error fetching pairing from Redis: %w", err)
+	}
+
+	deviceID, err := db.RedisClient.HGet(ctx, pairingKey(userCode), "device_id").Result()
+	if errors.Is(err, redis.Nil) {
+		return models.DeviceToken{}, ErrPairingPending
+	}
+	if err != nil {
+		return models.DeviceToken{}, fmt.Errorf("error fetching pairing from Redis: %w", err)
+	}
+	id, err := uuid.Parse(deviceID)
+	if err != nil {
+		return models.DeviceToken{}, ErrPairingNotFound
+	}
+
+	token, hash, err := middlewares.GenerateDeviceToken()
+	if err != nil {
+		return models.DeviceToken{}, err
+	}
+	// Only the first poll after approval gets the token; the device may also
+	// have been revoked before it picked it up.
+	result, err := db.DB.ExecContext(ctx, `UPDATE display_devices SET token_hash = $1, last_seen_at = NOW()
+		WHERE id = $2 AND token_hash IS NULL AND revoked_at IS NULL`, hash, id)
+	if err != nil {
+		return models.DeviceToken{}, fmt.Errorf("error storing device token: %w", err)
+	}
+	db.RedisClient.Del(ctx, pairingKey(userCode), pairingDeviceKey(deviceCode))
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return models.DeviceToken{}, ErrPairingNotFound
+	}
+
+	return models.DeviceToken{DeviceID: id, Token: token}, nil
+}
+
+const displayDeviceColumns = "id, name, mode, approved_by, last_seen_at, revoked_at, created_at"
+
+func scanDisplayDevice(row rowScanner) (models.DisplayDevice, error) {
+	var device models.DisplayDevice
+	err := row.Scan(&device.ID, &device.Name, &device.Mode, &device.ApprovedBy, &device.LastSeenAt, &device.RevokedAt, &device.CreatedAt)
+	return device, err
+}
+
+// GetDisplayDevices lists the paired devices for admins.
+func GetDisplayDevices(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT "+displayDeviceColumns+" FROM display_devices ORDER BY created_at DESC")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch display devices", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	devices := []models.DisplayDevice{}
+	for rows.Next() {
+		device, err := scanDisplayDevice(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch display devices", http.StatusInternalServerError, err)
+			return
+		}
+		devices = append(devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch display devices", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, devices, http.StatusOK)
+}
+
+// ApproveDisplayDevice approves the pairing code a device shows. The device
+// is created right away and gets its token on its next poll.
+func ApproveDisplayDevice(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	userCode := normalizeUserCode(payload.Code)
+	if userCode == "" {
+		http.Error(w, "code must be the 8 letters shown on the device", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	device, err := approveDisplayDevice(ctx, userCode, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPairingNotFound):
+			middlewares.HttpError(w, err.Error(), http.StatusNotFound, err)
+		case errors.Is(err, ErrPairingApproved):
+			middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to approve display device", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, device, http.StatusCreated)
+}
+
+func approveDisplayDevice(ctx context.Context, userCode string, userID int64) (models.DisplayDevice, error) {
+	key := pairingKey(userCode)
+	name, err := db.RedisClient.HGet(ctx, key, "name").Result()
+	if errors.Is(err, redis.Nil) {
+		return models.DisplayDevice{}, ErrPairingNotFound
+	}
+	if err != nil {
+		return models.DisplayDevice{}, fmt.Errorf("error fetching pairing from Redis: %w", err)
+	}
+
+	// Claim the pairing first so that two admins approving the same code
+	// do not create two devices.
+	claimed, err := db.RedisClient.HSetNX(ctx, key, "approved_by", userID).Result()
+	if err != nil {
+		return models.DisplayDevice{}, fmt.Errorf("error updating pairing in Redis: %w", err)
+	}
+	if !claimed {
+		return models.DisplayDevice{}, ErrPairingApproved
+	}
+
+	device, err := scanDisplayDevice(db.DB.QueryRowContext(ctx, `INSERT INTO display_devices (name, approved_by)
+		VALUES ($1, $2)
+		RETURNING `+displayDeviceColumns, name, userID))
+	if err != nil {
+		db.RedisClient.HDel(ctx, key, "approved_by")
+		return models.DisplayDevice{}, fmt.Errorf("error creating display device: %w", err)
+	}
+
+	if err := db.RedisClient.HSet(ctx, key, "device_id", device.ID.String()).Err(); err != nil {
+		return models.DisplayDevice{}, fmt.Errorf("error updating pairing in Redis: %w", err)
+	}
+	return device, nil
+}
+
+// SetDisplayDeviceMode switches a device between display and kiosk mode.
+func SetDisplayDeviceMode(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if payload.Mode != models.DeviceModeDisplay && payload.Mode != models.DeviceModeKiosk {
+		http.Error(w, "mode must be display or kiosk", http.StatusBadRequest)
+		return
+	}
+
+	device, err := scanDisplayDevice(db.DB.QueryRowContext(r.Context(), `UPDATE display_devices SET mode = $1
+		WHERE id = $2
+		RETURNING `+displayDeviceColumns, payload.Mode, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Display device not found", http.StatusNotFound, ErrDisplayDeviceNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update display device", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, device, http.StatusOK)
+}
+
+// RevokeDisplayDevice revokes a device, e.g. a screen that was replaced or lost.
+func RevokeDisplayDevice(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var hash sql.NullString
+	err = db.DB.QueryRowContext(ctx, `UPDATE display_devices SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+		RETURNING token_hash`, id).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Display device not found", http.StatusNotFound, ErrDisplayDeviceNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to revoke display device", http.StatusInternalServerError, err)
+		return
+	}
+	if hash.Valid {
+		middlewares.ForgetDeviceToken(ctx, hash.String)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
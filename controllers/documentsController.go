@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// JobExtractDocumentText extracts and indexes the text of a document.
+	JobExtractDocumentText = "document.extract"
+
+	documentsNamespace = "documents"
+)
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ExtractDocumentRequest is the payload of a JobExtractDocumentText job.
+type ExtractDocumentRequest struct {
+	DocumentID uuid.UUID `json:"document_id"`
+}
+
+func SetupDocumentRoutes(r *mux.Router) {
+	documentsRouter := r.PathPrefix("/documents").Subrouter()
+	documentsRouter.Use(middlewares.TokenAuthMiddleware, middlewares.StaffOnly)
+	documentsRouter.HandleFunc("", GetDocuments).Methods("GET")
+	documentsRouter.HandleFunc("", UploadDocument).Methods("POST")
+	documentsRouter.HandleFunc("", DeleteDocument).Methods("DELETE").Queries("id", "{id}")
+	documentsRouter.HandleFunc("/download", DownloadDocument).Methods("GET").Queries("id", "{id}")
+	documentsRouter.HandleFunc("/reindex", ReindexDocument).Methods("POST").Queries("id", "{id}")
+}
+
+const documentColumns = `d.id, d.media_id, d.title, m.filename, m.content_type, m.size_bytes,
+	d.extraction_status, d.extraction_error, d.created_by, d.created_at`
+
+func scanDocument(row rowScanner) (models.Document, error) {
+	var document models.Document
+	err := row.Scan(&document.ID, &document.MediaID, &document.Title, &document.Filename, &document.ContentType,
+		&document.SizeBytes, &document.ExtractionStatus, &document.ExtractionError, &document.CreatedBy, &document.CreatedAt)
+	return document, err
+}
+
+func queryDocument(ctx context.Context, id uuid.UUID) (models.Document, error) {
+	document, err := scanDocument(db.DB.QueryRowContext(ctx, `SELECT `+documentColumns+`
+		FROM documents d JOIN media_items m ON m.id = d.media_id
+		WHERE d.id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Document{}, ErrDocumentNotFound
+		}
+		return models.Document{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return document, nil
+}
+
+// GetDocuments returns a page of the document library, newest first.
+func GetDocuments(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM documents").Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch documents", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+documentColumns+`
+		FROM documents d JOIN media_items m ON m.id = d.media_id
+		ORDER BY d.created_at DESC, d.id
+		LIMIT $1 OFFSET $2`, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch documents", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		document, err := scanDocument(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch documents", http.StatusInternalServerError, err)
+			return
+		}
+		documents = append(documents, document)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch documents", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.Document]{
+		Items:   documents,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// UploadDocument accepts a multipart form with a PDF or DOCX file and a
+// title. The text is extracted by a background job, so the document shows up
+// in search shortly after the upload.
+func UploadDocument(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxDocumentBytes+1<<20)
+	if err := r.ParseMultipartForm(media.MaxDocumentBytes); err != nil {
+		middlewares.HttpError(w, "Invalid multipart form", http.StatusBadRequest, err)
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if err := validation.ValidateDocumentTitle(title); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		middlewares.HttpError(w, "file is required", http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxDocumentBytes+1))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to read file", http.StatusBadRequest, err)
+		return
+	}
+	if len(data) > media.MaxDocumentBytes {
+		http.Error(w, "file must be at most 20 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+	contentType, err := media.DetectDocumentType(data, header.Filename)
+	if err != nil {
+		middlewares.HttpError(w, "file must be a PDF or DOCX document", http.StatusUnsupportedMediaType, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	item, err := media.Store(ctx, documentsNamespace, header.Filename, contentType, data, &userID)
+	if err != nil {
+		var quotaErr *media.QuotaError
+		if errors.As(err, &quotaErr) {
+			middlewares.HttpError(w, "Document storage is full", http.StatusInsufficientStorage, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to store document", http.StatusInternalServerError, err)
+		return
+	}
+
+	id, err := createDocument(ctx, item.ID, title, userID)
+	if err != nil {
+		if delErr := media.DeleteItem(context.WithoutCancel(ctx), item.ID); delErr != nil {
+			log.Printf("Failed to delete orphaned document file %s: %v", item.ID, delErr)
+		}
+		middlewares.HttpError(w, "Failed to create document", http.StatusInternalServerError, err)
+		return
+	}
+
+	document, err := queryDocument(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch document", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, document, http.StatusCreated)
+}
+
+// createDocument records a document and queues its text extraction in one
+// transaction.
+func createDocument(ctx context.Context, mediaID uuid.UUID, title string, createdBy int64) (uuid.UUID, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var id uuid.UUID
+	if err := tx.QueryRowContext(ctx, `INSERT INTO documents (media_id, title, created_by) VALUES ($1, $2, $3) RETURNING id`,
+		mediaID, title, createdBy).Scan(&id); err != nil {
+		return uuid.Nil, fmt.Errorf("error inserting document: %w", err)
+	}
+	if _, err := jobs.Enqueue(ctx, tx, JobExtractDocumentText, ExtractDocumentRequest{DocumentID: id}); err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, tx.Commit()
+}
+
+// ReindexDocument queues the text extraction of a document again, e.g. after
+// a failure or once a PDF extractor has been installed.
+func ReindexDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to reindex document", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE documents SET extraction_status = 'pending', extraction_error = NULL
+		WHERE id = $1`, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to reindex document", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		middlewares.HttpError(w, "Document not found", http.StatusNotFound, ErrDocumentNotFound)
+		return
+	}
+
+	jobID, err := jobs.Enqueue(ctx, tx, JobExtractDocumentText, ExtractDocumentRequest{DocumentID: id})
+	if err != nil {
+		middlewares.HttpError(w, "Failed to reindex document", http.StatusInternalServerError, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		middlewares.HttpError(w, "Failed to reindex document", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]uuid.UUID{"job_id": jobID}, http.StatusAccepted)
+}
+
+// DownloadDocument streams the original file of a document.
+func DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	document, err := queryDocument(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDocumentNotFound) {
+			middlewares.HttpError(w, "Document not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch document", http.StatusInternalServerError, err)
+		return
+	}
+
+	_, reader, err := media.Open(ctx, document.MediaID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to open document", http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", document.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.Filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to stream document %s: %v", document.ID, err)
+	}
+}
+
+// DeleteDocument removes a document and its file.
+func DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var mediaID uuid.UUID
+	err = db.DB.QueryRowContext(ctx, "DELETE FROM documents WHERE id = $1 RETURNING media_id", id).Scan(&mediaID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Document not found", http.StatusNotFound, ErrDocumentNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to delete document", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := media.DeleteItem(ctx, mediaID); err != nil && !errors.Is(err, media.ErrItemNotFound) {
+		log.Printf("Failed to delete document file %s: %v", mediaID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExtractDocumentText is the job handler for JobExtractDocumentText. A
+// document without a usable extractor is marked failed instead of retried.
+func ExtractDocumentText(ctx context.Context, task *jobs.Task) (any, error) {
+	var req ExtractDocumentRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	document, err := queryDocument(ctx, req.DocumentID)
+	if err != nil {
+		if errors.Is(err, ErrDocumentNotFound) {
+			// Deleted before the job ran.
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	extractor, err := media.LoadTextExtractor()
+	if err != nil {
+		return nil, err
+	}
+
+	_, reader, err := media.Open(ctx, document.MediaID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+
+	text, err := extractor.ExtractText(ctx, data, document.ContentType)
+	if err != nil {
+		permanent := errors.Is(err, media.ErrNoPDFExtractor) || errors.Is(err, media.ErrUnsupportedDocument)
+		if permanent || task.LastAttempt() {
+			if _, dbErr := db.DB.ExecContext(ctx, `UPDATE documents SET extraction_status = 'failed', extraction_error = $2
+				WHERE id = $1`, document.ID, err.Error()); dbErr != nil {
+				return nil, fmt.Errorf("error recording extraction failure: %w", dbErr)
+			}
+		}
+		if permanent {
+			return map[string]string{"status": models.ExtractionFailed, "error": err.Error()}, nil
+		}
+		return nil, err
+	}
+
+	_, err = db.DB.ExecContext(ctx, `UPDATE documents SET content_text = $2, extraction_status = 'done', extraction_error = NULL
+		WHERE id = $1`, document.ID, text)
+	if err != nil {
+		return nil, fmt.Errorf("error saving document text: %w", err)
+	}
+	return map[string]interface{}{"extractor": extractor.Name(), "characters": len([]rune(text))}, nil
+}
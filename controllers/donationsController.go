@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// maxPaymentWebhookBytes bounds the body of a payment provider's webhook.
+const maxPaymentWebhookBytes = 1 << 20
+
+// PaymentWebhookPrefix is where payment providers deliver their webhooks.
+const PaymentWebhookPrefix = "/donations/webhooks/"
+
+var ErrPaymentsDisabled = errors.New("online giving is not enabled")
+
+// SetupDonationRoutes registers online giving. Anyone can give; signed-in
+// donors' gifts are added to their giving history.
+func SetupDonationRoutes(r *mux.Router) {
+	donationsRouter := r.PathPrefix("/donations").Subrouter()
+	donationsRouter.Handle("/intents", middlewares.OptionalTokenAuth(http.HandlerFunc(CreateDonationIntent))).Methods("POST")
+	donationsRouter.Handle("/paypal/orders/{id}/capture", middlewares.OptionalTokenAuth(http.HandlerFunc(CapturePayPalOrder))).Methods("POST")
+	donationsRouter.Handle("/statements", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetGivingStatements))).Methods("GET")
+	donationsRouter.Handle("/statements", middlewares.TokenAuthMiddleware(http.HandlerFunc(RequestGivingStatement))).Methods("POST")
+	donationsRouter.Handle("/me", middlewares.TokenAuthMiddleware(http.HandlerFunc(GetGivingHistory))).Methods("GET")
+}
+
+// SetupPaymentWebhookRoutes registers the webhooks payment providers call.
+// They authenticate with signatures instead of the bearer token.
+func SetupPaymentWebhookRoutes(r *mux.Router) {
+	r.HandleFunc(PaymentWebhookPrefix+"stripe", HandleStripeWebhook).Methods("POST")
+	// The token is in the query, which request logs leave out.
+	r.HandleFunc(PaymentWebhookPrefix+"mpesa", HandleMpesaCallback).Methods("POST").Queries("token", "{token}")
+}
+
+const donationColumns = `id, user_id, donor_name, amount_cents, currency, fund, method, status, reference, provider,
+	receipt, device_id, given_at, recorded_at`
+
+func scanDonation(row rowScanner) (models.Donation, error) {
+	var d models.Donation
+	err := row.Scan(&d.ID, &d.UserID, &d.DonorName, &d.AmountCents, &d.Currency, &d.Fund, &d.Method, &d.Status,
+		&d.Reference, &d.Provider, &d.Receipt, &d.DeviceID, &d.GivenAt, &d.RecordedAt)
+	return d, err
+}
+
+// PaymentProvider takes the payments of online gifts.
+type PaymentProvider interface {
+	// Enabled reports whether the provider is configured.
+	Enabled() bool
+	// Method is how gifts through the provider are paid.
+	Method() string
+	// Currency is the currency of gifts that do not name one.
+	Currency() string
+	// Start asks the provider to take the payment of a pending gift. The
+	// intent's Reference identifies the payment in the provider's reports.
+	Start(ctx context.Context, donationID uuid.UUID, request models.DonationIntentRequest) (models.DonationIntent, error)
+}
+
+// paymentProviders are the providers gifts can be given through, by name.
+var paymentProviders = map[string]PaymentProvider{
+	models.PaymentProviderStripe: stripeProvider{},
+	models.PaymentProviderMpesa:  mpesaProvider{},
+	models.PaymentProviderPayPal: payPalProvider{},
+}
+
+// defaultCurrencies returns the currency of each provider's gifts.
+func defaultCurrencies() map[string]string {
+	currencies := make(map[string]string, len(paymentProviders))
+	for name, provider := range paymentProviders {
+		currencies[name] = provider.Currency()
+	}
+	return currencies
+}
+
+// CreateDonationIntent starts an online gift: it records a pending donation
+// and asks the provider to take the payment. Stripe returns a client secret
+// the page pays with; M-Pesa prompts the donor's phone; PayPal returns an
+// order for the donor to approve. The donation is completed when the
+// provider reports back, or when the PayPal order is captured.
+func CreateDonationIntent(w http.ResponseWriter, r *http.Request) {
+	var request models.DonationIntentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateDonationIntent(&request, defaultCurrencies()); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	provider := paymentProviders[request.Provider]
+	if !provider.Enabled() {
+		middlewares.HttpError(w, "Giving through "+request.Provider+" is not enabled", http.StatusServiceUnavailable, ErrPaymentsDisabled)
+		return
+	}
+
+	ctx := r.Context()
+	var userID *int64
+	if id, ok := middlewares.UserIDFromContext(ctx); ok {
+		userID = &id
+	}
+	donationID := uuid.New()
+	_, err := db.DB.ExecContext(ctx, `INSERT INTO donations
+			(id, user_id, donor_name, amount_cents, currency, fund, method, status, provider, given_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		donationID, userID, request.DonorName, request.AmountCents, request.Currency, request.Fund,
+		provider.Method(), models.DonationStatusPending, request.Provider, time.Now().UTC())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to record donation", http.StatusInternalServerError, err)
+		return
+	}
+
+	intent, err := provider.Start(ctx, donationID, request)
+	if err == nil {
+		_, err = db.DB.ExecContext(ctx, "UPDATE donations SET reference = $2 WHERE id = $1", donationID, intent.Reference)
+	}
+	if err != nil {
+		setDonationFailed(ctx, donationID)
+		middlewares.HttpError(w, "Failed to start the payment", http.StatusBadGateway, err)
+		return
+	}
+
+	intent.DonationID = donationID
+	intent.Provider = request.Provider
+	intent.AmountCents = request.AmountCents
+	intent.Currency = request.Currency
+	intent.Fund = request.Fund
+	middlewares.RespondJSON(w, intent, http.StatusCreated)
+}
+
+// setDonationFailed marks a gift whose payment could not be started. It is
+// best effort: a pending gift without a reference is never completed anyway.
+func setDonationFailed(ctx context.Context, id uuid.UUID) {
+	_, err := db.DB.ExecContext(ctx, "UPDATE donations SET status = $2 WHERE id = $1 AND status = $3",
+		id, models.DonationStatusFailed, models.DonationStatusPending)
+	if err != nil {
+		log.Printf("Failed to mark donation %s as failed: %v", id, err)
+	}
+}
+
+// donationTransitions lists the statuses a gift may move to a status from,
+// so that webhooks delivered late or twice cannot undo a later change.
+var donationTransitions = map[string][]string{
+	models.DonationStatusCompleted: {models.DonationStatusPending, models.DonationStatusFailed},
+	models.DonationStatusFailed:    {models.DonationStatusPending},
+	models.DonationStatusRefunded:  {models.DonationStatusCompleted},
+}
+
+// setDonationStatus moves the online gift with the provider's reference to
+// status. A completed gift is dated givenAt and keeps receipt, when the
+// provider issued one. It reports whether the gift changed; a statement
+// already made for the gift's year is then rendered again.
+func setDonationStatus(ctx context.Context, provider, reference, status string, givenAt time.Time, receipt *string) (bool, error) {
+	from := donationTransitions[status]
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE donations
+		SET status = $3,
+			given_at = CASE WHEN $3 = 'completed' THEN $4 ELSE given_at END,
+			receipt = COALESCE($6, receipt)
+		WHERE provider = $1 AND reference = $2 AND status = ANY($5)`,
+		provider, reference, status, givenAt.UTC(), pq.Array(from), receipt)
+	if err != nil {
+		return false, fmt.Errorf("error updating donation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reading affected rows: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	staleMedia, err := resetGivingStatements(ctx, tx, provider, reference)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	deleteStatementMedia(ctx, staleMedia)
+	return true, nil
+}
+
+// HandleStripeWebhook records the outcome of Stripe payments. Only events
+// signed with the webhook secret are accepted. Events of other types are
+// acknowledged and ignored, so Stripe does not retry them.
+func HandleStripeWebhook(w http.ResponseWriter, r *http.Request) {
+	config := stripe()
+	if config.SecretKey == "" {
+		middlewares.HttpError(w, "Online giving is not enabled", http.StatusServiceUnavailable, ErrPaymentsDisabled)
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPaymentWebhookBytes))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to read webhook", http.StatusBadRequest, err)
+		return
+	}
+	if err := verifyStripeSignature(payload, r.Header.Get("Stripe-Signature"), config.WebhookSecret, time.Now()); err != nil {
+		middlewares.HttpError(w, "Invalid signature", http.StatusBadRequest, err)
+		return
+	}
+
+	var event struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object struct {
+				ID            string `json:"id"`
+				PaymentIntent string `json:"payment_intent"`
+				Refunded      bool   `json:"refunded"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	reference, status := event.Data.Object.ID, ""
+	switch event.Type {
+	case "payment_intent.succeeded":
+		status = models.DonationStatusCompleted
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		status = models.DonationStatusFailed
+	case "charge.refunded":
+		// Partial refunds leave the gift completed.
+		if event.Data.Object.Refunded {
+			reference, status = event.Data.Object.PaymentIntent, models.DonationStatusRefunded
+		}
+	}
+	if status == "" || reference == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	changed, err := setDonationStatus(r.Context(), models.PaymentProviderStripe, reference, status, time.Unix(event.Created, 0), nil)
+	if err != nil {
+		// Stripe retries failed deliveries.
+		middlewares.HttpError(w, "Failed to record payment", http.StatusInternalServerError, err)
+		return
+	}
+	if changed {
+		log.Printf("Stripe event %s: donation %s is %s", event.ID, reference, status)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGivingHistory lists the caller's gifts, newest first, with what they
+// gave to each fund. ?from= and ?to= bound the date given, e.g. to a tax
+// year.
+func GetGivingHistory(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseListTime(r.URL.Query().Get("from"), false)
+	if err != nil {
+		http.Error(w, "from must be a date or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseListTime(r.URL.Query().Get("to"), true)
+	if err != nil {
+		http.Error(w, "to must be a date or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	const filter = `user_id = $1
+		AND ($2::timestamp IS NULL OR given_at >= $2::timestamp)
+		AND ($3::timestamp IS NULL OR given_at < $3::timestamp)`
+
+	history := models.GivingHistory{Items: []models.Donation{}, Totals: []models.FundTotal{}, Page: page.Number, PerPage: page.PerPage}
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM donations WHERE "+filter, userID, from, to).Scan(&history.Total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+donationColumns+` FROM donations
+		WHERE `+filter+`
+		ORDER BY given_at DESC, id
+		LIMIT $4 OFFSET $5`, userID, from, to, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		donation, err := scanDonation(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+			return
+		}
+		history.Items = append(history.Items, donation)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+		return
+	}
+
+	totals, err := db.DB.QueryContext(ctx, `SELECT fund, currency, SUM(amount_cents), COUNT(*)
+		FROM donations
+		WHERE `+filter+` AND status = 'completed'
+		GROUP BY fund, currency
+		ORDER BY fund, currency`, userID, from, to)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+		return
+	}
+	defer totals.Close()
+	for totals.Next() {
+		var total models.FundTotal
+		if err := totals.Scan(&total.Fund, &total.Currency, &total.AmountCents, &total.Count); err != nil {
+			middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+			return
+		}
+		history.Totals = append(history.Totals, total)
+	}
+	if err := totals.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch giving history", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, history, http.StatusOK)
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"jsmi-api/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+func TestDonationTransitions(t *testing.T) {
+	tests := []struct {
+		current, event string
+		applies        bool
+	}{
+		{models.DonationStatusPending, models.DonationStatusCompleted, true},
+		{models.DonationStatusFailed, models.DonationStatusCompleted, true},
+		{models.DonationStatusPending, models.DonationStatusFailed, true},
+		{models.DonationStatusCompleted, models.DonationStatusRefunded, true},
+		{models.DonationStatusCompleted, models.DonationStatusCompleted, false},
+		{models.DonationStatusCompleted, models.DonationStatusFailed, false},
+		{models.DonationStatusRefunded, models.DonationStatusFailed, false},
+		{models.DonationStatusRefunded, models.DonationStatusCompleted, false},
+		{models.DonationStatusPending, models.DonationStatusRefunded, false},
+		{models.DonationStatusPending, models.DonationStatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := slices.Contains(donationTransitions[tt.event], tt.current); got != tt.applies {
+			t.Errorf("%s gift on %s event: applies = %v, want %v", tt.current, tt.event, got, tt.applies)
+		}
+	}
+}
+
+// TestSetDonationStatusIgnoresOutOfOrderEvents also checks that a gift that
+// changes sends the statement of its year, if any, back to be rendered.
+func TestSetDonationStatusIgnoresOutOfOrderEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    string
+		from      []string
+		affected  int64
+		statement bool
+	}{
+		{"completion", models.DonationStatusCompleted, []string{models.DonationStatusPending, models.DonationStatusFailed}, 1, false},
+		{"failure after completion", models.DonationStatusFailed, []string{models.DonationStatusPending}, 0, false},
+		{"completion after refund", models.DonationStatusCompleted, []string{models.DonationStatusPending, models.DonationStatusFailed}, 0, false},
+		{"refund", models.DonationStatusRefunded, []string{models.DonationStatusCompleted}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE donations\\s+SET status").
+				WithArgs(models.PaymentProviderStripe, "pi_1", tt.status, sqlmock.AnyArg(), pq.Array(tt.from), nil).
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+			if tt.affected == 0 {
+				mock.ExpectRollback()
+			} else {
+				statements := sqlmock.NewRows([]string{"id", "media_id"})
+				if tt.statement {
+					statements.AddRow(uuid.New(), nil)
+				}
+				mock.ExpectQuery("UPDATE giving_statements s").
+					WithArgs(models.PaymentProviderStripe, "pi_1").
+					WillReturnRows(statements)
+				if tt.statement {
+					mock.ExpectExec("INSERT INTO jobs").
+						WithArgs(sqlmock.AnyArg(), JobGivingStatement, sqlmock.AnyArg(), sqlmock.AnyArg()).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			}
+
+			changed, err := setDonationStatus(context.Background(), models.PaymentProviderStripe, "pi_1", tt.status, time.Now(), nil)
+			if err != nil {
+				t.Fatalf("setDonationStatus() = %v", err)
+			}
+			if changed != (tt.affected > 0) {
+				t.Errorf("setDonationStatus() = %v, want %v", changed, tt.affected > 0)
+			}
+		})
+	}
+}
+
+// TestMpesaCallbackIgnoresOutOfOrderEvents checks that callbacks arriving
+// after a gift moved on are acknowledged without changing it.
+func TestMpesaCallbackIgnoresOutOfOrderEvents(t *testing.T) {
+	mpesaConfigOnce.Do(func() {})
+	previous := mpesaConfig
+	mpesaConfig = &MpesaConfig{ConsumerKey: "key", CallbackToken: "callback-token"}
+	t.Cleanup(func() { mpesaConfig = previous })
+
+	router := mux.NewRouter()
+	SetupPaymentWebhookRoutes(router)
+	callback := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, PaymentWebhookPrefix+"mpesa?token=callback-token", strings.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("token in the path", func(t *testing.T) {
+		mockDB(t)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, PaymentWebhookPrefix+"mpesa/callback-token", strings.NewReader("{}")))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("failure after completion", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE donations\\s+SET status").
+			WithArgs(models.PaymentProviderMpesa, "ws_CO_1", models.DonationStatusFailed, sqlmock.AnyArg(),
+				pq.Array([]string{models.DonationStatusPending}), nil).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		recorder := callback(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d; body: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+	})
+
+	t.Run("repeated completion", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE donations\\s+SET status").
+			WithArgs(models.PaymentProviderMpesa, "ws_CO_1", models.DonationStatusCompleted, sqlmock.AnyArg(),
+				pq.Array([]string{models.DonationStatusPending, models.DonationStatusFailed}), "QJK1ABC2DE").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		mock.ExpectExec("UPDATE donations SET receipt").
+			WithArgs(models.PaymentProviderMpesa, "ws_CO_1", "QJK1ABC2DE", models.DonationStatusCompleted).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		recorder := callback(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0,"ResultDesc":"Processed",
+			"CallbackMetadata":{"Item":[{"Name":"MpesaReceiptNumber","Value":"QJK1ABC2DE"},{"Name":"TransactionDate","Value":20261016093000}]}}}}`)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d; body: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+	})
+}
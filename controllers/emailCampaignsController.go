@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobEmailCampaign sends an email campaign to its audience.
+const JobEmailCampaign = "email.campaign"
+
+const (
+	// campaignBatchSize is how many recipients are loaded at a time while sending.
+	campaignBatchSize = 500
+	// campaignDeadlineMargin is the time left before the job's deadline at
+	// which sending stops and continues in a new job.
+	campaignDeadlineMargin = time.Minute
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrCampaignNotDraft = errors.New("campaign has already been sent")
+)
+
+type emailCampaignPayload struct {
+	CampaignID uuid.UUID `json:"campaign_id"`
+}
+
+type campaignRecipient struct {
+	ID       int64
+	Email    string
+	Token    uuid.UUID
+	OptedOut bool
+}
+
+const campaignColumns = `id, subject, text_body, html_body, segment_id, status, recipient_count, last_error,
+	created_by, created_at, sent_at`
+
+func scanCampaign(row rowScanner) (models.EmailCampaign, error) {
+	var campaign models.EmailCampaign
+	err := row.Scan(&campaign.ID, &campaign.Subject, &campaign.TextBody, &campaign.HTMLBody, &campaign.SegmentID,
+		&campaign.Status, &campaign.RecipientCount, &campaign.LastError, &campaign.CreatedBy, &campaign.CreatedAt,
+		&campaign.SentAt)
+	return campaign, err
+}
+
+func queryEmailCampaign(ctx context.Context, id uuid.UUID) (*models.EmailCampaign, error) {
+	campaign, err := scanCampaign(db.DB.QueryRowContext(ctx, "SELECT "+campaignColumns+" FROM email_campaigns WHERE id = $1", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCampaignNotFound
+		}
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	return &campaign, nil
+}
+
+func GetEmailCampaigns(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		campaign, err := queryEmailCampaign(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrCampaignNotFound) {
+				middlewares.HttpError(w, "Campaign not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch campaign", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, campaign, http.StatusOK)
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	campaigns, total, err := fetchEmailCampaigns(ctx, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch campaigns", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.EmailCampaign]{
+		Items:   campaigns,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+func fetchEmailCampaigns(ctx context.Context, page Page) ([]models.EmailCampaign, int, error) {
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM email_campaigns").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting campaigns: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+campaignColumns+` FROM email_campaigns
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2`, page.PerPage, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	campaigns := []models.EmailCampaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return campaigns, total, nil
+}
+
+// CreateEmailCampaign saves a campaign as a draft. Without a segment_id the
+// campaign goes to every active member.
+func CreateEmailCampaign(w http.ResponseWriter, r *http.Request) {
+	var campaign models.EmailCampaign
+	if err := json.NewDecoder(r.Body).Decode(&campaign); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateEmailCampaign(campaign); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	created, err := scanCampaign(db.DB.QueryRowContext(ctx, `INSERT INTO email_campaigns
+		(subject, text_body, html_body, segment_id, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+campaignColumns, campaign.Subject, campaign.TextBody, campaign.HTMLBody, campaign.SegmentID, userID))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			middlewares.HttpError(w, "Segment not found", http.StatusBadRequest, ErrEmailSegmentNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create campaign", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, created, http.StatusCreated)
+}
+
+// SendEmailCampaign queues a draft campaign for sending.
+func SendEmailCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, err := queueEmailCampaign(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCampaignNotFound):
+			middlewares.HttpError(w, "Campaign not found", http.StatusNotFound, err)
+		case errors.Is(err, ErrCampaignNotDraft):
+			middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to queue campaign", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]uuid.UUID{"job_id": jobID}, http.StatusAccepted)
+}
+
+func queueEmailCampaign(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM email_campaigns WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrCampaignNotFound
+	} else if err != nil {
+		return uuid.Nil, fmt.Errorf("error querying database: %w", err)
+	}
+	if status != models.CampaignDraft {
+		return uuid.Nil, ErrCampaignNotDraft
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE email_campaigns SET status = 'queued' WHERE id = $1", id); err != nil {
+		return uuid.Nil, fmt.Errorf("error updating campaign: %w", err)
+	}
+	jobID, err := jobs.Enqueue(ctx, tx, JobEmailCampaign, emailCampaignPayload{CampaignID: id})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return jobID, tx.Commit()
+}
+
+// DeliverEmailCampaign is the job handler for JobEmailCampaign. The audience is
+// evaluated once, when sending starts; a retried job continues with the
+// recipients that were not handed to the mailer yet.
+func DeliverEmailCampaign(ctx context.Context, task *jobs.Task) (any, error) {
+	var payload emailCampaignPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	sent, done, err := deliverEmailCampaign(ctx, payload.CampaignID)
+	if err == nil && !done {
+		// Large audiences are sent in several jobs so that none runs into
+		// the queue's task timeout.
+		_, err = jobs.Enqueue(ctx, db.DB, JobEmailCampaign, payload)
+	}
+	if err != nil {
+		if task.LastAttempt() {
+			_, dbErr := db.DB.ExecContext(context.WithoutCancel(ctx),
+				"UPDATE email_campaigns SET status = 'failed', last_error = $1 WHERE id = $2", err.Error(), payload.CampaignID)
+			if dbErr != nil {
+				log.Printf("Failed to mark campaign %s as failed: %v", payload.CampaignID, dbErr)
+			}
+		}
+		return nil, err
+	}
+
+	return map[string]interface{}{"sent": sent, "continued": !done}, nil
+}
+
+// deliverEmailCampaign sends to the remaining recipients until the audience is
+// exhausted (done) or the job is close to its deadline.
+func deliverEmailCampaign(ctx context.Context, id uuid.UUID) (sent int, done bool, err error) {
+	campaign, err := queryEmailCampaign(ctx, id)
+	if err != nil {
+		return 0, false, err
+	}
+	switch campaign.Status {
+	case models.CampaignSent:
+		return 0, true, nil
+	case models.CampaignQueued:
+		if err := snapshotCampaignRecipients(ctx, campaign); err != nil {
+			return 0, false, err
+		}
+	}
+
+	tracking := emailTrackingBaseURL() != ""
+	var links map[string]int
+	if tracking {
+		if links, err = queryCampaignLinks(ctx, id); err != nil {
+			return 0, false, err
+		}
+	}
+
+	for {
+		rows, err := db.DB.QueryContext(ctx, `SELECT u.id, u.email, r.token, u.email_tracking_opt_out
+			FROM email_campaign_recipients r
+			JOIN users u ON u.id = r.user_id
+			WHERE r.campaign_id = $1 AND r.queued_at IS NULL AND `+consentClause("u.id", models.ConsentEmail)+`
+			ORDER BY u.id
+			LIMIT $2`, id, campaignBatchSize)
+		if err != nil {
+			return sent, false, fmt.Errorf("error querying database: %w", err)
+		}
+		var batch []campaignRecipient
+		for rows.Next() {
+			var member campaignRecipient
+			if err := rows.Scan(&member.ID, &member.Email, &member.Token, &member.OptedOut); err != nil {
+				rows.Close()
+				return sent, false, fmt.Errorf("error scanning row: %w", err)
+			}
+			batch = append(batch, member)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return sent, false, fmt.Errorf("error iterating over rows: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, member := range batch {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < campaignDeadlineMargin {
+				return sent, false, nil
+			}
+			msg := mailer.Message{
+				To:       member.Email,
+				Subject:  campaign.Subject,
+				TextBody: campaign.TextBody,
+				HTMLBody: campaign.HTMLBody,
+			}
+			tracked := tracking && !member.OptedOut
+			if tracked {
+				msg = trackedMessage(msg, links, member.Token)
+			}
+			if err := mailer.Send(ctx, msg); err != nil {
+				return sent, false, fmt.Errorf("error queuing email: %w", err)
+			}
+			_, err := db.DB.ExecContext(ctx, `UPDATE email_campaign_recipients SET queued_at = NOW(), tracked = $3
+				WHERE campaign_id = $1 AND user_id = $2`, id, member.ID, tracked)
+			if err != nil {
+				return sent, false, fmt.Errorf("error recording recipient: %w", err)
+			}
+			sent++
+		}
+	}
+
+	_, err = db.DB.ExecContext(ctx, "UPDATE email_campaigns SET status = 'sent', last_error = NULL, sent_at = NOW() WHERE id = $1", id)
+	if err != nil {
+		return sent, false, fmt.Errorf("error updating campaign: %w", err)
+	}
+	return sent, true, nil
+}
+
+// snapshotCampaignRecipients fixes the audience of a campaign and marks it as sending.
+func snapshotCampaignRecipients(ctx context.Context, campaign *models.EmailCampaign) error {
+	var rules models.SegmentRules
+	if campaign.SegmentID != nil {
+		segment, err := queryEmailSegment(ctx, *campaign.SegmentID)
+		if err != nil {
+			return err
+		}
+		rules = segment.Rules
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	filter, args := segmentFilter(rules, []any{campaign.ID})
+	result, err := tx.ExecContext(ctx, `INSERT INTO email_campaign_recipients (campaign_id, user_id)
+		SELECT $1, u.id FROM users u WHERE `+filter+`
+		ON CONFLICT DO NOTHING`, args...)
+	if err != nil {
+		return fmt.Errorf("error evaluating audience: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if err := saveCampaignLinks(ctx, tx, campaign); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE email_campaigns SET status = 'sending', recipient_count = $1 WHERE id = $2",
+		count, campaign.ID)
+	if err != nil {
+		return fmt.Errorf("error updating campaign: %w", err)
+	}
+
+	return tx.Commit()
+}
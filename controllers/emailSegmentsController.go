@@ -0,0 +1,388 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/auth"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrEmailSegmentNotFound  = errors.New("segment not found")
+	ErrEmailSegmentNameTaken = errors.New("a segment with this name already exists")
+	ErrEmailSegmentInUse     = errors.New("segment is used by a campaign")
+)
+
+// segmentFilter turns segment rules into a WHERE clause over users u. Values
+// are appended to args as parameters, so the clause is safe to concatenate.
+func segmentFilter(rules models.SegmentRules, args []any) (string, []any) {
+	// Members who withdrew their consent to email are never in an audience.
+	conditions := []string{"u.status = 'active'", consentClause("u.id", models.ConsentEmail)}
+	param := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(rules.Tags) > 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM user_tags t WHERE t.user_id = u.id AND t.tag = ANY(`+param(pq.Array(rules.Tags))+`))`)
+	}
+	if len(rules.ExcludeTags) > 0 {
+		conditions = append(conditions, `NOT EXISTS (SELECT 1 FROM user_tags t WHERE t.user_id = u.id AND t.tag = ANY(`+param(pq.Array(rules.ExcludeTags))+`))`)
+	}
+	if len(rules.Roles) > 0 {
+		conditions = append(conditions, `u.role = ANY(`+param(pq.Array(rules.Roles))+`)`)
+	}
+	if len(rules.EnrolledCourseIDs) > 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM enrollments e WHERE e.user_id = u.id AND e.course_id = ANY(`+param(pq.Array(rules.EnrolledCourseIDs))+`))`)
+	}
+	if len(rules.CompletedCourseIDs) > 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM enrollments e WHERE e.user_id = u.id AND e.completed_at IS NOT NULL AND e.course_id = ANY(`+param(pq.Array(rules.CompletedCourseIDs))+`))`)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// SetUserTags replaces the tags of a user.
+func SetUserTags(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	for i, tag := range payload.Tags {
+		payload.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	if err := validation.ValidateTags(payload.Tags); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	if err := replaceUserTags(r.Context(), userID, payload.Tags); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update tags", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]interface{}{"id": userID, "tags": payload.Tags}, http.StatusOK)
+}
+
+func replaceUserTags(ctx context.Context, userID int64, tags []string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	if !exists {
+		return auth.ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_tags WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("error deleting tags: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_tags (user_id, tag)
+		SELECT $1, tag FROM UNNEST($2::text[]) AS tag
+		ON CONFLICT DO NOTHING`, userID, pq.Array(tags))
+	if err != nil {
+		return fmt.Errorf("error inserting tags: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetTags lists every tag in use with the number of users carrying it.
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT tag, COUNT(*) FROM user_tags GROUP BY tag ORDER BY tag")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch tags", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Users); err != nil {
+			middlewares.HttpError(w, "Failed to fetch tags", http.StatusInternalServerError, err)
+			return
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch tags", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, tags, http.StatusOK)
+}
+
+func GetEmailSegments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		segment, err := queryEmailSegment(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrEmailSegmentNotFound) {
+				middlewares.HttpError(w, "Segment not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch segment", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, segment, http.StatusOK)
+		return
+	}
+
+	segments, err := queryEmailSegments(ctx, "", nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch segments", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, segments, http.StatusOK)
+}
+
+func queryEmailSegment(ctx context.Context, id uuid.UUID) (*models.EmailSegment, error) {
+	segments, err := queryEmailSegments(ctx, "WHERE id = $1", []any{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, ErrEmailSegmentNotFound
+	}
+	return &segments[0], nil
+}
+
+func queryEmailSegments(ctx context.Context, where string, args []any) ([]models.EmailSegment, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, name, description, rules, created_by, created_at, updated_at
+		FROM email_segments `+where+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	segments := []models.EmailSegment{}
+	for rows.Next() {
+		var segment models.EmailSegment
+		var rules []byte
+		if err := rows.Scan(&segment.ID, &segment.Name, &segment.Description, &rules, &segment.CreatedBy,
+			&segment.CreatedAt, &segment.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if err := json.Unmarshal(rules, &segment.Rules); err != nil {
+			return nil, fmt.Errorf("error decoding rules of segment %s: %w", segment.ID, err)
+		}
+		segments = append(segments, segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return segments, nil
+}
+
+func decodeEmailSegment(w http.ResponseWriter, r *http.Request) (models.EmailSegment, bool) {
+	var segment models.EmailSegment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return segment, false
+	}
+	segment.Name = strings.TrimSpace(segment.Name)
+	if err := validation.ValidateEmailSegment(segment); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return segment, false
+	}
+	return segment, true
+}
+
+func CreateEmailSegment(w http.ResponseWriter, r *http.Request) {
+	segment, ok := decodeEmailSegment(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	rules, err := json.Marshal(segment.Rules)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to encode rules", http.StatusInternalServerError, err)
+		return
+	}
+	err = db.DB.QueryRowContext(ctx, `INSERT INTO email_segments (name, description, rules, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_by, created_at, updated_at`, segment.Name, segment.Description, rules, userID).
+		Scan(&segment.ID, &segment.CreatedBy, &segment.CreatedAt, &segment.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			middlewares.HttpError(w, ErrEmailSegmentNameTaken.Error(), http.StatusConflict, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, segment, http.StatusCreated)
+}
+
+func UpdateEmailSegment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	segment, ok := decodeEmailSegment(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := json.Marshal(segment.Rules)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to encode rules", http.StatusInternalServerError, err)
+		return
+	}
+	segment.ID = id
+	err = db.DB.QueryRowContext(r.Context(), `UPDATE email_segments
+		SET name = $1, description = $2, rules = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING created_by, created_at, updated_at`, segment.Name, segment.Description, rules, id).
+		Scan(&segment.CreatedBy, &segment.CreatedAt, &segment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			middlewares.HttpError(w, "Segment not found", http.StatusNotFound, ErrEmailSegmentNotFound)
+		case isUniqueViolation(err):
+			middlewares.HttpError(w, ErrEmailSegmentNameTaken.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to update segment", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, segment, http.StatusOK)
+}
+
+func DeleteEmailSegment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM email_segments WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			middlewares.HttpError(w, ErrEmailSegmentInUse.Error(), http.StatusConflict, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to delete segment", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Segment not found", http.StatusNotFound, ErrEmailSegmentNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEmailSegmentMembers evaluates a segment and returns a page of its
+// members, so admins can check the audience before sending a campaign.
+func GetEmailSegmentMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	segment, err := queryEmailSegment(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrEmailSegmentNotFound) {
+			middlewares.HttpError(w, "Segment not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	members, total, err := fetchSegmentMembers(ctx, segment.Rules, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to evaluate segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.SegmentMember]{
+		Items:   members,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+func fetchSegmentMembers(ctx context.Context, rules models.SegmentRules, page Page) ([]models.SegmentMember, int, error) {
+	filter, args := segmentFilter(rules, nil)
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users u WHERE "+filter, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting segment members: %w", err)
+	}
+
+	args = append(args, page.PerPage, page.Offset())
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf(`SELECT u.id, u.username, u.email FROM users u
+		WHERE %s
+		ORDER BY u.username
+		LIMIT $%d OFFSET $%d`, filter, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.SegmentMember{}
+	for rows.Next() {
+		var member models.SegmentMember
+		if err := rows.Scan(&member.ID, &member.Username, &member.Email); err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return members, total, nil
+}
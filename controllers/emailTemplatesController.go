@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrEmailTemplateNotFound  = errors.New("email template not found")
+	ErrEmailTemplateNameTaken = errors.New("an email template with this name already exists")
+	ErrTemplateVersionMissing = errors.New("email template version not found")
+)
+
+const emailTemplateColumns = `t.id, t.name, t.description, t.variables, t.current_version, v.subject, v.text_body,
+	v.html_body, t.created_at, t.updated_at`
+
+func scanEmailTemplate(row rowScanner) (models.EmailTemplate, error) {
+	var template models.EmailTemplate
+	err := row.Scan(&template.ID, &template.Name, &template.Description, pq.Array(&template.Variables),
+		&template.CurrentVersion, &template.Subject, &template.TextBody, &template.HTMLBody,
+		&template.CreatedAt, &template.UpdatedAt)
+	template.Builtin = slices.Contains(mailer.BuiltinTemplates(), template.Name)
+	return template, err
+}
+
+func queryEmailTemplates(ctx context.Context, where string, args ...any) ([]models.EmailTemplate, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+emailTemplateColumns+`
+		FROM email_templates t
+		JOIN email_template_versions v ON v.template_id = t.id AND v.version = t.current_version
+		`+where+`
+		ORDER BY t.name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.EmailTemplate{}
+	for rows.Next() {
+		template, err := scanEmailTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return templates, nil
+}
+
+func queryEmailTemplate(ctx context.Context, id uuid.UUID) (*models.EmailTemplate, error) {
+	templates, err := queryEmailTemplates(ctx, "WHERE t.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrEmailTemplateNotFound
+	}
+	return &templates[0], nil
+}
+
+// LoadEmailTemplateContent is the mailer's content source: it returns the
+// current version of an edited template, or nil if the template has not
+// been edited.
+func LoadEmailTemplateContent(ctx context.Context, name string) (*mailer.Content, error) {
+	templates, err := queryEmailTemplates(ctx, "WHERE t.name = $1", name)
+	if err != nil || len(templates) == 0 {
+		return nil, err
+	}
+	return &mailer.Content{Subject: templates[0].Subject, Text: templates[0].TextBody, HTML: templates[0].HTMLBody}, nil
+}
+
+// GetEmailTemplates lists the edited templates, or returns one with ?id=.
+// ?builtin=true lists the built-in templates that can be edited instead.
+func GetEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	if query.Get("builtin") == "true" {
+		builtins := []map[string]interface{}{}
+		for _, name := range mailer.BuiltinTemplates() {
+			builtins = append(builtins, map[string]interface{}{"name": name, "variables": mailer.BuiltinVariables(name)})
+		}
+		middlewares.RespondJSON(w, builtins, http.StatusOK)
+		return
+	}
+
+	if idStr := query.Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		template, err := queryEmailTemplate(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrEmailTemplateNotFound) {
+				middlewares.HttpError(w, "Email template not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, template, http.StatusOK)
+		return
+	}
+
+	templates, err := queryEmailTemplates(ctx, "")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch email templates", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, templates, http.StatusOK)
+}
+
+// decodeEmailTemplate reads and validates a template. Templates replacing a
+// built-in email always get the built-in's variables, because that is the
+// data the email is rendered with.
+func decodeEmailTemplate(w http.ResponseWriter, r *http.Request) (models.EmailTemplate, bool) {
+	var template models.EmailTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return template, false
+	}
+	template.Name = strings.TrimSpace(template.Name)
+	if builtin := mailer.BuiltinVariables(template.Name); builtin != nil {
+		template.Variables = builtin
+	}
+	if template.Variables == nil {
+		template.Variables = []string{}
+	}
+
+	if err := validation.ValidateEmailTemplate(template); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return template, false
+	}
+	content := mailer.Content{Subject: template.Subject, Text: template.TextBody, HTML: template.HTMLBody}
+	if _, err := mailer.ParseContent(content, template.Variables); err != nil {
+		middlewares.HttpError(w, "Invalid template: "+err.Error(), http.StatusBadRequest, err)
+		return template, false
+	}
+	return template, true
+}
+
+func CreateEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := decodeEmailTemplate(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create email template", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO email_templates (name, description, variables)
+		VALUES ($1, $2, $3)
+		RETURNING id`, template.Name, template.Description, pq.Array(template.Variables)).Scan(&template.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			middlewares.HttpError(w, ErrEmailTemplateNameTaken.Error(), http.StatusConflict, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create email template", http.StatusInternalServerError, err)
+		return
+	}
+	if err := insertEmailTemplateVersion(ctx, tx, template.ID, 1, template, userID); err != nil {
+		middlewares.HttpError(w, "Failed to create email template", http.StatusInternalServerError, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		middlewares.HttpError(w, "Failed to create email template", http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := queryEmailTemplate(ctx, template.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, created, http.StatusCreated)
+}
+
+// UpdateEmailTemplate saves the content as a new version of the template.
+func UpdateEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	template, ok := decodeEmailTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	if err := saveEmailTemplateVersion(ctx, id, &template, userID); err != nil {
+		switch {
+		case errors.Is(err, ErrEmailTemplateNotFound):
+			middlewares.HttpError(w, "Email template not found", http.StatusNotFound, err)
+		case isUniqueViolation(err):
+			middlewares.HttpError(w, ErrEmailTemplateNameTaken.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to update email template", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	updated, err := queryEmailTemplate(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, updated, http.StatusOK)
+}
+
+// saveEmailTemplateVersion updates the template's fields and adds its content
+// as the next version.
+func saveEmailTemplateVersion(ctx context.Context, id uuid.UUID, template *models.EmailTemplate, userID int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRowContext(ctx, `UPDATE email_templates
+		SET name = $1, description = $2, variables = $3, current_version = current_version + 1, updated_at = NOW()
+		WHERE id = $4
+		RETURNING current_version`, template.Name, template.Description, pq.Array(template.Variables), id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEmailTemplateNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := insertEmailTemplateVersion(ctx, tx, id, version, *template, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertEmailTemplateVersion adds a version of the template. A userID of 0
+// records a version that no user made, e.g. one imported from the command line.
+func insertEmailTemplateVersion(ctx context.Context, tx *sql.Tx, id uuid.UUID, version int, template models.EmailTemplate, userID int64) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO email_template_versions
+		(template_id, version, subject, text_body, html_body, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))`,
+		id, version, strings.TrimSpace(template.Subject), template.TextBody, template.HTMLBody, userID)
+	if err != nil {
+		return fmt.Errorf("error inserting template version: %w", err)
+	}
+	return nil
+}
+
+// DeleteEmailTemplate deletes a template with its versions. Deleting the
+// edited copy of a built-in email restores the built-in text.
+func DeleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM email_templates WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete email template", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Email template not found", http.StatusNotFound, ErrEmailTemplateNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEmailTemplateVersions lists the versions of a template, newest first.
+func GetEmailTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := queryEmailTemplate(ctx, id); err != nil {
+		if errors.Is(err, ErrEmailTemplateNotFound) {
+			middlewares.HttpError(w, "Email template not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT version, subject, text_body, html_body, created_by, created_at
+		FROM email_template_versions WHERE template_id = $1 ORDER BY version DESC`, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch versions", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.EmailTemplateVersion{}
+	for rows.Next() {
+		var version models.EmailTemplateVersion
+		if err := rows.Scan(&version.Version, &version.Subject, &version.TextBody, &version.HTMLBody,
+			&version.CreatedBy, &version.CreatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch versions", http.StatusInternalServerError, err)
+			return
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch versions", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, versions, http.StatusOK)
+}
+
+// loadEmailTemplateVersion replaces the template's content with that of an
+// earlier version.
+func loadEmailTemplateVersion(ctx context.Context, template *models.EmailTemplate, version int) error {
+	err := db.DB.QueryRowContext(ctx, `SELECT subject, text_body, html_body FROM email_template_versions
+		WHERE template_id = $1 AND version = $2`, template.ID, version).
+		Scan(&template.Subject, &template.TextBody, &template.HTMLBody)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTemplateVersionMissing
+	} else if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	return nil
+}
+
+// RestoreEmailTemplateVersion saves an earlier version as the newest one, so
+// the history keeps a record of the restore.
+func RestoreEmailTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid version parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	template, err := queryEmailTemplate(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrEmailTemplateNotFound) {
+			middlewares.HttpError(w, "Email template not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := loadEmailTemplateVersion(ctx, template, version); err != nil {
+		if errors.Is(err, ErrTemplateVersionMissing) {
+			middlewares.HttpError(w, "Version not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch version", http.StatusInternalServerError, err)
+		return
+	}
+
+	// The variables may have changed since the version was saved.
+	content := mailer.Content{Subject: template.Subject, Text: template.TextBody, HTML: template.HTMLBody}
+	if _, err := mailer.ParseContent(content, template.Variables); err != nil {
+		middlewares.HttpError(w, "Version cannot be restored: "+err.Error(), http.StatusConflict, err)
+		return
+	}
+
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	if err := saveEmailTemplateVersion(ctx, id, template, userID); err != nil {
+		middlewares.HttpError(w, "Failed to restore version", http.StatusInternalServerError, err)
+		return
+	}
+
+	restored, err := queryEmailTemplate(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, restored, http.StatusOK)
+}
+
+// PreviewEmailTemplate renders a template with the given data. Variables
+// without a value are shown as [Name]. ?version= previews an older version.
+func PreviewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	template, err := queryEmailTemplate(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrEmailTemplateNotFound) {
+			middlewares.HttpError(w, "Email template not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch email template", http.StatusInternalServerError, err)
+		return
+	}
+
+	if versionStr := r.URL.Query().Get("version"); versionStr != "" {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid version parameter", http.StatusBadRequest, err)
+			return
+		}
+		if err := loadEmailTemplateVersion(ctx, template, version); err != nil {
+			if errors.Is(err, ErrTemplateVersionMissing) {
+				middlewares.HttpError(w, "Version not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch version", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	data := map[string]interface{}{}
+	for _, variable := range template.Variables {
+		data[variable] = "[" + variable + "]"
+	}
+	for key, value := range payload.Data {
+		data[key] = value
+	}
+
+	content := mailer.Content{Subject: template.Subject, Text: template.TextBody, HTML: template.HTMLBody}
+	msg, err := mailer.RenderContent(content, "", data)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, models.RenderedEmail{
+		Subject:  msg.Subject,
+		TextBody: msg.TextBody,
+		HTMLBody: msg.HTMLBody,
+	}, http.StatusOK)
+}
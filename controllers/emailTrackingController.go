@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// emailTrackingPaths are opened by mail clients, which cannot send the API's
+// bearer token.
+var emailTrackingPaths = []string{"/email/open", "/email/click"}
+
+const maxCampaignLinks = 100
+
+var (
+	htmlLinkRegex = regexp.MustCompile(`href="(https?://[^"\s]+)"`)
+	// Trailing punctuation is left out so that "see https://example.org." links
+	// to the site rather than a URL ending in a period.
+	textLinkRegex = regexp.MustCompile(`https?://[^\s<>"]*[^\s<>".,;:!?)']`)
+
+	// transparentGIF is a 1x1 transparent GIF served as the open pixel.
+	transparentGIF = []byte{
+		0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+	}
+
+	trackingBaseURL     string
+	trackingBaseURLOnce sync.Once
+)
+
+// LoadEmailTrackingBaseURL returns EMAIL_TRACKING_BASE_URL, the public URL of
+// this API used in tracking pixels and links. Tracking is disabled when it is
+// not set.
+func LoadEmailTrackingBaseURL() (string, error) {
+	value := strings.TrimSuffix(os.Getenv("EMAIL_TRACKING_BASE_URL"), "/")
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", errors.New("EMAIL_TRACKING_BASE_URL must be an http(s) URL")
+	}
+	return value, nil
+}
+
+func emailTrackingBaseURL() string {
+	trackingBaseURLOnce.Do(func() {
+		trackingBaseURL, _ = LoadEmailTrackingBaseURL()
+	})
+	return trackingBaseURL
+}
+
+// SetupEmailTrackingRoutes registers the open pixel and click redirect. They
+// must be reachable without the bearer token; see PublicPaths.
+func SetupEmailTrackingRoutes(r *mux.Router) {
+	r.HandleFunc("/email/open", TrackEmailOpen).Methods("GET").Queries("t", "{t}")
+	r.HandleFunc("/email/click", TrackEmailClick).Methods("GET").Queries("t", "{t}", "l", "{l}")
+}
+
+// saveCampaignLinks records the links of a campaign so that tracked links can
+// refer to them by position.
+func saveCampaignLinks(ctx context.Context, tx *sql.Tx, campaign *models.EmailCampaign) error {
+	seen := map[string]bool{}
+	var links []string
+	for _, match := range htmlLinkRegex.FindAllStringSubmatch(campaign.HTMLBody, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			links = append(links, match[1])
+		}
+	}
+	for _, link := range textLinkRegex.FindAllString(campaign.TextBody, -1) {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	if len(links) > maxCampaignLinks {
+		links = links[:maxCampaignLinks]
+	}
+
+	for i, link := range links {
+		_, err := tx.ExecContext(ctx, `INSERT INTO email_campaign_links (campaign_id, position, url) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`, campaign.ID, i, link)
+		if err != nil {
+			return fmt.Errorf("error saving campaign link: %w", err)
+		}
+	}
+	return nil
+}
+
+func queryCampaignLinks(ctx context.Context, campaignID uuid.UUID) (map[string]int, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT position, url FROM email_campaign_links WHERE campaign_id = $1", campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	links := map[string]int{}
+	for rows.Next() {
+		var position int
+		var link string
+		if err := rows.Scan(&position, &link); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		links[link] = position
+	}
+	return links, rows.Err()
+}
+
+// trackedMessage rewrites the campaign's links to go through the click
+// redirect and adds the open pixel to the HTML body.
+func trackedMessage(msg mailer.Message, links map[string]int, token uuid.UUID) mailer.Message {
+	base := emailTrackingBaseURL()
+	clickURL := func(link string) string {
+		position, ok := links[link]
+		if !ok {
+			return link
+		}
+		return base + "/email/click?t=" + token.String() + "&l=" + strconv.Itoa(position)
+	}
+
+	msg.TextBody = textLinkRegex.ReplaceAllStringFunc(msg.TextBody, clickURL)
+	if msg.HTMLBody != "" {
+		msg.HTMLBody = htmlLinkRegex.ReplaceAllStringFunc(msg.HTMLBody, func(attr string) string {
+			link := htmlLinkRegex.FindStringSubmatch(attr)[1]
+			// & must be escaped inside an HTML attribute.
+			return `href="` + strings.ReplaceAll(clickURL(link), "&", "&amp;") + `"`
+		})
+		pixel := `<img src="` + base + `/email/open?t=` + token.String() + `" width="1" height="1" alt="" style="display:none">`
+		if i := strings.LastIndex(strings.ToLower(msg.HTMLBody), "</body>"); i >= 0 {
+			msg.HTMLBody = msg.HTMLBody[:i] + pixel + msg.HTMLBody[i:]
+		} else {
+			msg.HTMLBody += pixel
+		}
+	}
+	return msg
+}
+
+// TrackEmailOpen records that a tracked campaign email was opened and serves
+// a transparent pixel. It never fails visibly, so mail clients show nothing.
+func TrackEmailOpen(w http.ResponseWriter, r *http.Request) {
+	if token, err := uuid.Parse(r.URL.Query().Get("t")); err == nil {
+		_, err := db.DB.ExecContext(r.Context(), `UPDATE email_campaign_recipients r
+			SET open_count = open_count + 1, opened_at = COALESCE(opened_at, NOW())
+			FROM users u
+			WHERE r.token = $1 AND r.tracked AND u.id = r.user_id AND NOT u.email_tracking_opt_out`, token)
+		if err != nil {
+			log.Printf("Failed to record email open: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(transparentGIF)
+}
+
+// TrackEmailClick records a click on a tracked link and redirects to it.
+func TrackEmailClick(w http.ResponseWriter, r *http.Request) {
+	token, err := uuid.Parse(r.URL.Query().Get("t"))
+	if err != nil {
+		http.Error(w, "Invalid link", http.StatusBadRequest)
+		return
+	}
+	position, err := strconv.Atoi(r.URL.Query().Get("l"))
+	if err != nil {
+		http.Error(w, "Invalid link", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var (
+		campaignID uuid.UUID
+		userID     int64
+		optedOut   bool
+		link       string
+	)
+	err = db.DB.QueryRowContext(ctx, `SELECT r.campaign_id, r.user_id, u.email_tracking_opt_out, l.url
+		FROM email_campaign_recipients r
+		JOIN users u ON u.id = r.user_id
+		JOIN email_campaign_links l ON l.campaign_id = r.campaign_id AND l.position = $2
+		WHERE r.token = $1`, token, position).Scan(&campaignID, &userID, &optedOut, &link)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Link not found", http.StatusNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to resolve link", http.StatusInternalServerError, err)
+		return
+	}
+
+	if !optedOut {
+		if err := recordEmailClick(ctx, campaignID, userID, position); err != nil {
+			log.Printf("Failed to record email click: %v", err)
+		}
+	}
+
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
+func recordEmailClick(ctx context.Context, campaignID uuid.UUID, userID int64, position int) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A click implies the email was opened, even if images were blocked.
+	_, err = tx.ExecContext(ctx, `UPDATE email_campaign_recipients
+		SET click_count = click_count + 1, clicked_at = COALESCE(clicked_at, NOW()), opened_at = COALESCE(opened_at, NOW())
+		WHERE campaign_id = $1 AND user_id = $2`, campaignID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE email_campaign_links SET clicks = clicks + 1 WHERE campaign_id = $1 AND position = $2",
+		campaignID, position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetEmailTrackingOptOut lets members turn open and click tracking off or on.
+func SetEmailTrackingOptOut(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		OptOut *bool `json:"opt_out"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.OptOut == nil {
+		http.Error(w, "opt_out must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	if _, err := db.DB.ExecContext(ctx, "UPDATE users SET email_tracking_opt_out = $1 WHERE id = $2", *payload.OptOut, userID); err != nil {
+		middlewares.HttpError(w, "Failed to update tracking preference", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]bool{"opt_out": *payload.OptOut}, http.StatusOK)
+}
+
+// GetEmailCampaignReport returns delivery and engagement figures of a campaign.
+// Rates are relative to tracked recipients, since opens and clicks of
+// untracked messages are unknown.
+func GetEmailCampaignReport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := queryEmailCampaign(ctx, id); err != nil {
+		if errors.Is(err, ErrCampaignNotFound) {
+			middlewares.HttpError(w, "Campaign not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch campaign", http.StatusInternalServerError, err)
+		return
+	}
+
+	report := models.EmailCampaignReport{CampaignID: id, Links: []models.EmailLinkStats{}}
+	if err := queryCampaignStats(ctx, id, &report); err != nil {
+		middlewares.HttpError(w, "Failed to build report", http.StatusInternalServerError, err)
+		return
+	}
+	if report.Tracked > 0 {
+		report.OpenRate = float64(report.UniqueOpens) / float64(report.Tracked)
+		report.ClickRate = float64(report.UniqueClicks) / float64(report.Tracked)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT url, clicks FROM email_campaign_links
+		WHERE campaign_id = $1 ORDER BY clicks DESC, position`, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build report", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var link models.EmailLinkStats
+		if err := rows.Scan(&link.URL, &link.Clicks); err != nil {
+			middlewares.HttpError(w, "Failed to build report", http.StatusInternalServerError, err)
+			return
+		}
+		report.Links = append(report.Links, link)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to build report", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
+
+// queryCampaignStats reads a campaign's counts from email_campaign_stats, or
+// counts them directly when the campaign has not been summarized yet.
+func queryCampaignStats(ctx context.Context, id uuid.UUID, report *models.EmailCampaignReport) error {
+	err := db.DB.QueryRowContext(ctx, `SELECT sent, tracked, unique_opens, opens, unique_clicks, clicks
+		FROM email_campaign_stats WHERE campaign_id = $1`, id).
+		Scan(&report.Sent, &report.Tracked, &report.UniqueOpens, &report.Opens, &report.UniqueClicks, &report.Clicks)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FILTER (WHERE queued_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE tracked),
+			COUNT(*) FILTER (WHERE opened_at IS NOT NULL),
+			COALESCE(SUM(open_count), 0),
+			COUNT(*) FILTER (WHERE clicked_at IS NOT NULL),
+			COALESCE(SUM(click_count), 0)
+		FROM email_campaign_recipients WHERE campaign_id = $1`, id).
+		Scan(&report.Sent, &report.Tracked, &report.UniqueOpens, &report.Opens, &report.UniqueClicks, &report.Clicks)
+}
+
+// queryEmailStats summarizes campaign engagement over the last 30 days for
+// the admin dashboard, from email_campaign_stats.
+func queryEmailStats(ctx context.Context) (models.EmailStats, error) {
+	var stats models.EmailStats
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(c.id),
+			COALESCE(SUM(s.sent), 0),
+			COALESCE(SUM(s.tracked), 0),
+			COALESCE(SUM(s.unique_opens), 0),
+			COALESCE(SUM(s.unique_clicks), 0)
+		FROM email_campaigns c
+		LEFT JOIN email_campaign_stats s ON s.campaign_id = c.id
+		WHERE c.sent_at > NOW() - INTERVAL '30 days'`).
+		Scan(&stats.Campaigns, &stats.Sent, &stats.Tracked, &stats.UniqueOpens, &stats.UniqueClicks)
+	if err != nil {
+		return stats, fmt.Errorf("error querying email stats: %w", err)
+	}
+	if stats.Tracked > 0 {
+		stats.OpenRate = float64(stats.UniqueOpens) / float64(stats.Tracked)
+		stats.ClickRate = float64(stats.UniqueClicks) / float64(stats.Tracked)
+	}
+	return stats, nil
+}
@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxCalendarRange bounds the range of GET /events/calendar, since
+// recurring events are expanded into their occurrences.
+const maxCalendarRange = 366 * 24 * time.Hour
+
+var ErrEventNotFound = errors.New("event not found")
+
+// SetupEventRoutes registers the church event endpoints. Anyone can read
+// events; staff manage them.
+func SetupEventRoutes(r *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+
+	eventsRouter := r.PathPrefix("/events").Subrouter()
+	eventsRouter.HandleFunc("", GetEvent).Methods("GET").Queries("id", "{id}")
+	eventsRouter.HandleFunc("", GetEvents).Methods("GET")
+	eventsRouter.HandleFunc("/calendar", GetEventCalendar).Methods("GET")
+	eventsRouter.Handle("", staff(CreateEvent)).Methods("POST")
+	eventsRouter.Handle("", staff(UpdateEvent)).Methods("PUT").Queries("id", "{id}")
+	eventsRouter.Handle("", staff(DeleteEvent)).Methods("DELETE").Queries("id", "{id}")
+}
+
+const eventColumns = `id, title, description, location, starts_at, ends_at, registration_required,
+	registration_url, recurrence_frequency, recurrence_interval, recurrence_count, recurrence_until,
+	created_at, updated_at`
+
+func scanEvent(row rowScanner) (models.Event, error) {
+	var (
+		event     models.Event
+		frequency sql.NullString
+		interval  int
+		count     sql.NullInt64
+		until     *time.Time
+	)
+	err := row.Scan(&event.ID, &event.Title, &event.Description, &event.Location, &event.StartsAt, &event.EndsAt,
+		&event.RegistrationRequired, &event.RegistrationURL, &frequency, &interval, &count, &until,
+		&event.CreatedAt, &event.UpdatedAt)
+	if err != nil {
+		return models.Event{}, err
+	}
+	if frequency.Valid {
+		event.Recurrence = &models.EventRecurrence{
+			Frequency: frequency.String,
+			Interval:  interval,
+			Count:     int(count.Int64),
+			Until:     until,
+		}
+	}
+	return event, nil
+}
+
+// withNextOccurrence sets the occurrence of event that is on or comes next.
+// It depends on the clock, so it is set on every response.
+func withNextOccurrence(event models.Event, now time.Time) models.Event {
+	event.NextOccurrence = event.OccurrenceAt(now)
+	return event
+}
+
+func queryEvent(ctx context.Context, id uuid.UUID) (models.Event, error) {
+	event, err := scanEvent(db.DB.QueryRowContext(ctx, "SELECT "+eventColumns+" FROM events WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Event{}, ErrEventNotFound
+	}
+	if err != nil {
+		return models.Event{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return event, nil
+}
+
+func respondEventError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, ErrEventNotFound) {
+		middlewares.HttpError(w, "Event not found", http.StatusNotFound, err)
+		return
+	}
+	middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+}
+
+// GetEvents lists events one page at a time. ?when=upcoming keeps the events
+// with an occurrence still to come, by first occurrence; ?when=past keeps
+// the events that are over, most recent first. Without ?when= all events are
+// listed by first occurrence.
+func GetEvents(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	where, orderBy, args := "TRUE", "starts_at, id", []any{}
+	switch r.URL.Query().Get("when") {
+	case "":
+	case "upcoming":
+		where, args = "(last_ends_at IS NULL OR last_ends_at > $1)", []any{now}
+	case "past":
+		where, orderBy, args = "last_ends_at <= $1", "last_ends_at DESC, id", []any{now}
+	default:
+		http.Error(w, "when must be upcoming or past", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM events WHERE "+where, args...).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+		return
+	}
+
+	args = append(args, page.PerPage, page.Offset())
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM events
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, eventColumns, where, orderBy, len(args)-1, len(args)), args...)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+			return
+		}
+		list = append(list, withNextOccurrence(event, now))
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.Event]{
+		Items:   list,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetEvent returns an event with its next occurrence.
+func GetEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	event, err := queryEvent(r.Context(), id)
+	if err != nil {
+		respondEventError(w, "Failed to fetch event", err)
+		return
+	}
+	middlewares.RespondJSON(w, withNextOccurrence(event, time.Now()), http.StatusOK)
+}
+
+// GetEventCalendar returns the occurrences of every event between ?from=
+// and ?to=, in order, with recurring events expanded. The range defaults to
+// the next 31 days and may span at most a year.
+func GetEventCalendar(w http.ResponseWriter, r *http.Request) {
+	from, err := parseListTime(r.URL.Query().Get("from"), false)
+	if err != nil {
+		http.Error(w, "from must be a date or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseListTime(r.URL.Query().Get("to"), true)
+	if err != nil {
+		http.Error(w, "to must be a date or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if from == nil {
+		now := time.Now().UTC()
+		from = &now
+	}
+	if to == nil {
+		end := from.AddDate(0, 0, 31)
+		to = &end
+	}
+	if !from.Before(*to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(*from) > maxCalendarRange {
+		http.Error(w, "The calendar can span at most a year", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT "+eventColumns+` FROM events
+		WHERE starts_at < $2 AND (last_ends_at IS NULL OR last_ends_at > $1)`, *from, *to)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.CalendarEntry{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+			return
+		}
+		for _, occurrence := range event.OccurrencesBetween(*from, *to) {
+			entries = append(entries, models.CalendarEntry{
+				EventID:  event.ID,
+				Title:    event.Title,
+				Location: event.Location,
+				StartsAt: occurrence.StartsAt,
+				EndsAt:   occurrence.EndsAt,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch events", http.StatusInternalServerError, err)
+		return
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartsAt.Before(entries[j].StartsAt)
+	})
+	middlewares.RespondJSON(w, entries, http.StatusOK)
+}
+
+func CreateEvent(w http.ResponseWriter, r *http.Request) {
+	var event models.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateEvent(&event); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+
+	event.ID = uuid.New()
+	recurrence := eventRecurrenceArgs(event)
+	saved, err := scanEvent(db.DB.QueryRowContext(r.Context(), `INSERT INTO events (id, title, description, location,
+			starts_at, ends_at, registration_required, registration_url, recurrence_frequency, recurrence_interval,
+			recurrence_count, recurrence_until, last_ends_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING `+eventColumns,
+		event.ID, event.Title, event.Description, event.Location, event.StartsAt, event.EndsAt,
+		event.RegistrationRequired, event.RegistrationURL, recurrence.frequency, recurrence.interval,
+		recurrence.count, recurrence.until, event.LastEndsAt()))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create event", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondCreated(w, "/events?id="+saved.ID.String(), withNextOccurrence(saved, time.Now()))
+}
+
+func UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	var event models.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateEvent(&event); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+
+	recurrence := eventRecurrenceArgs(event)
+	saved, err := scanEvent(db.DB.QueryRowContext(r.Context(), `UPDATE events SET title = $1, description = $2,
+			location = $3, starts_at = $4, ends_at = $5, registration_required = $6, registration_url = $7,
+			recurrence_frequency = $8, recurrence_interval = $9, recurrence_count = $10, recurrence_until = $11,
+			last_ends_at = $12, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $13
+		RETURNING `+eventColumns,
+		event.Title, event.Description, event.Location, event.StartsAt, event.EndsAt,
+		event.RegistrationRequired, event.RegistrationURL, recurrence.frequency, recurrence.interval,
+		recurrence.count, recurrence.until, event.LastEndsAt(), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondEventError(w, "Failed to update event", ErrEventNotFound)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update event", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, withNextOccurrence(saved, time.Now()), http.StatusOK)
+}
+
+func DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM events WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete event", http.StatusInternalServerError, err)
+		return
+	}
+	if err := requireAffected(result); err != nil {
+		respondEventError(w, "Failed to delete event", ErrEventNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// eventRecurrence holds the recurrence columns of an event, NULL when it
+// does not repeat.
+type eventRecurrence struct {
+	frequency sql.NullString
+	interval  int
+	count     sql.NullInt64
+	until     *time.Time
+}
+
+func eventRecurrenceArgs(event models.Event) eventRecurrence {
+	args := eventRecurrence{interval: 1}
+	if r := event.Recurrence; r != nil {
+		args.frequency = sql.NullString{String: r.Frequency, Valid: true}
+		args.interval = r.Interval
+		args.count = sql.NullInt64{Int64: int64(r.Count), Valid: r.Count > 0}
+		args.until = r.Until
+	}
+	return args
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	freshnessReportKey  = "freshness:last_report"
+	emailContentReport  = "content_freshness"
+	defaultStaleMonths  = 12
+	maxReportEmailItems = 50
+)
+
+// StalePost is a published post that has not been edited for a while.
+type StalePost struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// BrokenMediaReference is a link in a post to a media item that no longer
+// exists.
+type BrokenMediaReference struct {
+	PostID    uuid.UUID `json:"post_id"`
+	PostTitle string    `json:"post_title"`
+	PostSlug  string    `json:"post_slug"`
+	MediaID   uuid.UUID `json:"media_id"`
+}
+
+// FreshnessReport lists content that editors should review.
+type FreshnessReport struct {
+	GeneratedAt           time.Time              `json:"generated_at"`
+	StaleMonths           int                    `json:"stale_months"`
+	StalePosts            []StalePost            `json:"stale_posts"`
+	BrokenMediaReferences []BrokenMediaReference `json:"broken_media_references"`
+}
+
+// freshnessEmailData is the data available to the content_freshness template.
+// The lists are cut to maxReportEmailItems; the full report is in the admin API.
+type freshnessEmailData struct {
+	Username    string
+	StaleMonths int
+	StaleCount  int
+	BrokenCount int
+	StalePosts  []StalePost
+	BrokenLinks []BrokenMediaReference
+	MoreStale   int
+	MoreBroken  int
+	GeneratedAt string
+}
+
+// LoadStaleMonths returns FRESHNESS_STALE_MONTHS, the number of months after
+// which an unedited post counts as stale.
+func LoadStaleMonths() (int, error) {
+	value := os.Getenv("FRESHNESS_STALE_MONTHS")
+	if value == "" {
+		return defaultStaleMonths, nil
+	}
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 1 {
+		return 0, errors.New("FRESHNESS_STALE_MONTHS must be a positive integer")
+	}
+	return months, nil
+}
+
+// RunFreshnessReport is the monthly job entry point. It builds the report,
+// stores it for GET /admin/reports/freshness and emails it to editors.
+func RunFreshnessReport(ctx context.Context) error {
+	months, err := LoadStaleMonths()
+	if err != nil {
+		return err
+	}
+	report, err := buildFreshnessReport(ctx, months)
+	if err != nil {
+		return err
+	}
+	return emailFreshnessReport(ctx, report)
+}
+
+func buildFreshnessReport(ctx context.Context, months int) (*FreshnessReport, error) {
+	report := &FreshnessReport{GeneratedAt: time.Now(), StaleMonths: months}
+
+	stale, err := queryStalePosts(ctx, months)
+	if err != nil {
+		return nil, err
+	}
+	report.StalePosts = stale
+
+	broken, err := queryBrokenMediaReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.BrokenMediaReferences = broken
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	const CacheTime = 62 * 24 * time.Hour
+	if err := db.RedisClient.Set(ctx, freshnessReportKey, jsonData, CacheTime).Err(); err != nil {
+		return nil, fmt.Errorf("error storing freshness report: %w", err)
+	}
+
+	return report, nil
+}
+
+// queryStalePosts returns published posts last changed more than months ago,
+// oldest first. The last change is tracked in content_changes.
+func queryStalePosts(ctx context.Context, months int) ([]StalePost, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT p.id, p.title, p.slug, COALESCE(c.changed_at, p.created_at) AS last_updated
+		FROM posts p
+		LEFT JOIN content_changes c ON c.entity = 'posts' AND c.entity_id = p.id
+		WHERE p.status = 'published' AND p.deleted_at IS NULL
+			AND COALESCE(c.changed_at, p.created_at) < NOW() - $1 * INTERVAL '1 month'
+		ORDER BY last_updated, p.id`, months)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []StalePost{}
+	for rows.Next() {
+		var post StalePost
+		if err := rows.Scan(&post.ID, &post.Title, &post.Slug, &post.LastUpdated); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return posts, nil
+}
+
+// queryBrokenMediaReferences finds links in posts that are neither archived
+// nor trashed to media items that no longer exist, in both URL forms of post
+// images.
+func queryBrokenMediaReferences(ctx context.Context) ([]BrokenMediaReference, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT DISTINCT p.id, p.title, p.slug, m[2]::uuid AS media_id
+		FROM posts p,
+			regexp_matches(lower(COALESCE(p.body, '')),
+				'(/media/images/file\?id=|post-images/)([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})', 'g') AS m
+		WHERE p.status <> 'archived' AND p.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM media_items mi WHERE mi.id = m[2]::uuid)
+		ORDER BY p.title, p.id, media_id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	references := []BrokenMediaReference{}
+	for rows.Next() {
+		var reference BrokenMediaReference
+		if err := rows.Scan(&reference.PostID, &reference.PostTitle, &reference.PostSlug, &reference.MediaID); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		references = append(references, reference)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return references, nil
+}
+
+// emailFreshnessReport sends the report to every active staff member and
+// admin. Nothing is sent when there is nothing to review.
+func emailFreshnessReport(ctx context.Context, report *FreshnessReport) error {
+	if len(report.StalePosts) == 0 && len(report.BrokenMediaReferences) == 0 {
+		return nil
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT username, email FROM users
+		WHERE role IN ($1, $2) AND status = $3`,
+		middlewares.RoleStaff, middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	data := freshnessEmailData{
+		StaleMonths: report.StaleMonths,
+		StaleCount:  len(report.StalePosts),
+		BrokenCount: len(report.BrokenMediaReferences),
+		StalePosts:  report.StalePosts,
+		BrokenLinks: report.BrokenMediaReferences,
+		GeneratedAt: report.GeneratedAt.UTC().Format("2 Jan 2006"),
+	}
+	if len(data.StalePosts) > maxReportEmailItems {
+		data.MoreStale = len(data.StalePosts) - maxReportEmailItems
+		data.StalePosts = data.StalePosts[:maxReportEmailItems]
+	}
+	if len(data.BrokenLinks) > maxReportEmailItems {
+		data.MoreBroken = len(data.BrokenLinks) - maxReportEmailItems
+		data.BrokenLinks = data.BrokenLinks[:maxReportEmailItems]
+	}
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&data.Username, &email); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if err := mailer.SendTemplate(emailContentReport, email, data); err != nil {
+			log.Printf("Failed to queue freshness report for %s: %v", data.Username, err)
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetFreshnessReport returns the latest freshness report.
+func GetFreshnessReport(w http.ResponseWriter, r *http.Request) {
+	data, err := db.RedisClient.Get(r.Context(), freshnessReportKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		http.Error(w, "No freshness report has been generated yet", http.StatusNotFound)
+		return
+	} else if err != nil {
+		middlewares.HttpError(w, "Failed to fetch freshness report", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// RunFreshnessReportNow builds a fresh report without emailing it. months
+// overrides FRESHNESS_STALE_MONTHS for this run.
+func RunFreshnessReportNow(w http.ResponseWriter, r *http.Request) {
+	months, err := LoadStaleMonths()
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusInternalServerError, err)
+		return
+	}
+	if value := r.URL.Query().Get("months"); value != "" {
+		months, err = strconv.Atoi(value)
+		if err != nil || months < 1 {
+			http.Error(w, "months must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := buildFreshnessReport(r.Context(), months)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build freshness report", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
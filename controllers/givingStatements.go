@@ -0,0 +1,446 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/pdf"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// JobGivingStatement renders a year-end giving statement into the media library.
+	JobGivingStatement = "giving_statement"
+	statementNamespace = "statements"
+	// StatementDownloadPath serves statements to holders of a signed URL.
+	StatementDownloadPath = "/donations/statements/download"
+	// firstStatementYear is the first year with online giving records.
+	firstStatementYear = 2000
+)
+
+var (
+	ErrStatementsDisabled     = errors.New("giving statements are not enabled")
+	ErrInvalidStatementURL    = errors.New("invalid or expired statement URL")
+	ErrStatementYearNotClosed = errors.New("statements are issued for years that have ended")
+)
+
+// StatementConfig configures giving statements.
+type StatementConfig struct {
+	// URLSecret signs download URLs. Statements are off without it.
+	URLSecret []byte
+	URLTTL    time.Duration
+	// Letterhead is printed under the ministry's name, e.g. its address.
+	Letterhead []string
+}
+
+var (
+	statementConfig     StatementConfig
+	statementConfigOnce sync.Once
+)
+
+// givingStatementPayload is the payload of a JobGivingStatement job.
+type givingStatementPayload struct {
+	StatementID uuid.UUID `json:"statement_id"`
+}
+
+// LoadStatementConfig reads STATEMENT_URL_SECRET, and optionally
+// STATEMENT_URL_TTL, which defaults to 15 minutes, and STATEMENT_LETTERHEAD,
+// up to three lines separated by "|".
+func LoadStatementConfig() (StatementConfig, error) {
+	config := StatementConfig{
+		URLSecret: []byte(os.Getenv("STATEMENT_URL_SECRET")),
+		URLTTL:    15 * time.Minute,
+	}
+	if len(config.URLSecret) == 0 {
+		return StatementConfig{}, nil
+	}
+	if len(config.URLSecret) < 32 {
+		return StatementConfig{}, errors.New("STATEMENT_URL_SECRET must be at least 32 characters")
+	}
+	if value := os.Getenv("STATEMENT_URL_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > 24*time.Hour {
+			return StatementConfig{}, errors.New("STATEMENT_URL_TTL must be a positive duration of at most 24h")
+		}
+		config.URLTTL = ttl
+	}
+	if value := strings.TrimSpace(os.Getenv("STATEMENT_LETTERHEAD")); value != "" {
+		for _, line := range strings.Split(value, "|") {
+			config.Letterhead = append(config.Letterhead, strings.TrimSpace(line))
+		}
+		if len(config.Letterhead) > 3 {
+			return StatementConfig{}, errors.New("STATEMENT_LETTERHEAD has at most 3 lines")
+		}
+	}
+	return config, nil
+}
+
+func statements() StatementConfig {
+	statementConfigOnce.Do(func() {
+		statementConfig, _ = LoadStatementConfig()
+	})
+	return statementConfig
+}
+
+// SetupStatementDownloadRoutes registers the download of giving statements,
+// which is authorized by the URL's signature instead of the bearer token.
+func SetupStatementDownloadRoutes(r *mux.Router) {
+	r.HandleFunc(StatementDownloadPath, DownloadGivingStatement).Methods("GET")
+}
+
+// statementSignature signs a statement's download URL until expires.
+func statementSignature(secret []byte, id uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s.%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signStatementURL sets the signed download URL of a ready statement.
+func signStatementURL(statement *models.GivingStatement, now time.Time) {
+	config := statements()
+	expires := now.Add(config.URLTTL).Truncate(time.Second)
+	query := url.Values{
+		"id":        {statement.ID.String()},
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {statementSignature(config.URLSecret, statement.ID, expires.Unix())},
+	}
+	statement.DownloadURL = StatementDownloadPath + "?" + query.Encode()
+	statement.DownloadExpiresAt = &expires
+}
+
+// verifyStatementURL checks the signature and expiry of a download URL and
+// returns the statement it is for.
+func verifyStatementURL(query url.Values, now time.Time) (uuid.UUID, error) {
+	id, err := uuid.Parse(query.Get("id"))
+	if err != nil {
+		return uuid.Nil, ErrInvalidStatementURL
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return uuid.Nil, ErrInvalidStatementURL
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	expected, _ := hex.DecodeString(statementSignature(statements().URLSecret, id, expires))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return uuid.Nil, ErrInvalidStatementURL
+	}
+	return id, nil
+}
+
+// RequestGivingStatement queues the rendering of the caller's statement for
+// a year that has ended. A statement that is already ready is returned with
+// its download URL; one that failed is queued again.
+func RequestGivingStatement(w http.ResponseWriter, r *http.Request) {
+	if len(statements().URLSecret) == 0 {
+		middlewares.HttpError(w, "Giving statements are not enabled", http.StatusServiceUnavailable, ErrStatementsDisabled)
+		return
+	}
+	var request models.GivingStatementRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	now := time.Now().UTC()
+	if request.Year < firstStatementYear || request.Year >= now.Year() {
+		middlewares.HttpError(w, fmt.Sprintf("year must be between %d and %d", firstStatementYear, now.Year()-1),
+			http.StatusBadRequest, ErrStatementYearNotClosed)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to request statement", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var statement models.GivingStatement
+	err = tx.QueryRowContext(ctx, `INSERT INTO giving_statements (id, user_id, year) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, year) DO UPDATE
+			SET status = 'pending', requested_at = CURRENT_TIMESTAMP
+			WHERE giving_statements.status = 'failed'
+		RETURNING id, year, status, requested_at, generated_at`, uuid.New(), userID, request.Year).
+		Scan(&statement.ID, &statement.Year, &statement.Status, &statement.RequestedAt, &statement.GeneratedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The statement is pending or ready; there is nothing to queue.
+		err = tx.QueryRowContext(ctx, `SELECT id, year, status, requested_at, generated_at
+			FROM giving_statements WHERE user_id = $1 AND year = $2`, userID, request.Year).
+			Scan(&statement.ID, &statement.Year, &statement.Status, &statement.RequestedAt, &statement.GeneratedAt)
+	} else if err == nil {
+		_, err = jobs.Enqueue(ctx, tx, JobGivingStatement, givingStatementPayload{StatementID: statement.ID})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to request statement", http.StatusInternalServerError, err)
+		return
+	}
+
+	if statement.Status == models.StatementReady {
+		signStatementURL(&statement, now)
+		middlewares.RespondJSON(w, statement, http.StatusOK)
+		return
+	}
+	middlewares.RespondJSON(w, statement, http.StatusAccepted)
+}
+
+// GetGivingStatements lists the caller's statements, latest year first,
+// with fresh download URLs for those that are ready.
+func GetGivingStatements(w http.ResponseWriter, r *http.Request) {
+	if len(statements().URLSecret) == 0 {
+		middlewares.HttpError(w, "Giving statements are not enabled", http.StatusServiceUnavailable, ErrStatementsDisabled)
+		return
+	}
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, year, status, requested_at, generated_at
+		FROM giving_statements WHERE user_id = $1
+		ORDER BY year DESC`, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch statements", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	list := []models.GivingStatement{}
+	for rows.Next() {
+		var statement models.GivingStatement
+		if err := rows.Scan(&statement.ID, &statement.Year, &statement.Status, &statement.RequestedAt, &statement.GeneratedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch statements", http.StatusInternalServerError, err)
+			return
+		}
+		if statement.Status == models.StatementReady {
+			signStatementURL(&statement, now)
+		}
+		list = append(list, statement)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch statements", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, list, http.StatusOK)
+}
+
+// DownloadGivingStatement streams a statement to the holder of its signed
+// URL. The PDF is private, so it must not be cached on the way.
+func DownloadGivingStatement(w http.ResponseWriter, r *http.Request) {
+	if len(statements().URLSecret) == 0 {
+		middlewares.HttpError(w, "Giving statements are not enabled", http.StatusServiceUnavailable, ErrStatementsDisabled)
+		return
+	}
+	id, err := verifyStatementURL(r.URL.Query(), time.Now())
+	if err != nil {
+		middlewares.HttpError(w, "Invalid or expired link", http.StatusForbidden, err)
+		return
+	}
+
+	var (
+		year    int
+		mediaID uuid.NullUUID
+	)
+	err = db.DB.QueryRowContext(r.Context(), "SELECT year, media_id FROM giving_statements WHERE id = $1 AND status = 'ready'", id).
+		Scan(&year, &mediaID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !mediaID.Valid) {
+		respondNotFound(w, "statement", "Statement not found", id.String(), err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch statement", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	serveMedia(w, r, mediaID.UUID, fmt.Sprintf("giving-statement-%d.pdf", year))
+}
+
+// RenderGivingStatement is the job handler for JobGivingStatement.
+func RenderGivingStatement(ctx context.Context, task *jobs.Task) (any, error) {
+	var payload givingStatementPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	mediaID, err := renderGivingStatement(ctx, payload.StatementID)
+	if err != nil {
+		if task.LastAttempt() {
+			_, dbErr := db.DB.ExecContext(context.WithoutCancel(ctx),
+				"UPDATE giving_statements SET status = 'failed' WHERE id = $1", payload.StatementID)
+			if dbErr != nil {
+				log.Printf("Failed to mark statement %s as failed: %v", payload.StatementID, dbErr)
+			}
+		}
+		return nil, err
+	}
+
+	return map[string]uuid.UUID{"media_id": mediaID}, nil
+}
+
+// resetGivingStatements sends the statement that covers the gift with the
+// provider's reference back to be rendered, after the gift changed within tx.
+// It returns the media of the statements replaced, to delete once tx is
+// committed. Failed statements are rendered again when next requested.
+func resetGivingStatements(ctx context.Context, tx *sql.Tx, provider, reference string) ([]uuid.UUID, error) {
+	// Joining the statement to itself reads the media it had before the update.
+	rows, err := tx.QueryContext(ctx, `UPDATE giving_statements s
+		SET status = 'pending', media_id = NULL, generated_at = NULL, requested_at = clock_timestamp()
+		FROM donations d, giving_statements old
+		WHERE d.provider = $1 AND d.reference = $2
+			AND s.user_id = d.user_id AND s.year = EXTRACT(YEAR FROM d.given_at)
+			AND old.id = s.id AND s.status <> 'failed'
+		RETURNING s.id, old.media_id`, provider, reference)
+	if err != nil {
+		return nil, fmt.Errorf("error resetting statements: %w", err)
+	}
+	defer rows.Close()
+	var (
+		statementIDs []uuid.UUID
+		staleMedia   []uuid.UUID
+	)
+	for rows.Next() {
+		var (
+			id      uuid.UUID
+			mediaID uuid.NullUUID
+		)
+		if err := rows.Scan(&id, &mediaID); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		statementIDs = append(statementIDs, id)
+		if mediaID.Valid {
+			staleMedia = append(staleMedia, mediaID.UUID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, id := range statementIDs {
+		if _, err := jobs.Enqueue(ctx, tx, JobGivingStatement, givingStatementPayload{StatementID: id}); err != nil {
+			return nil, err
+		}
+	}
+	return staleMedia, nil
+}
+
+// deleteStatementMedia deletes the files of replaced statements. It is best
+// effort: an undeleted file is no longer linked to any statement.
+func deleteStatementMedia(ctx context.Context, mediaIDs []uuid.UUID) {
+	for _, id := range mediaIDs {
+		if err := media.DeleteItem(context.WithoutCancel(ctx), id); err != nil {
+			log.Printf("Failed to delete replaced statement %s: %v", id, err)
+		}
+	}
+}
+
+// renderGivingStatement itemizes the donor's completed gifts of the year,
+// by date given in UTC. A statement reset while it renders, because one of
+// the gifts changed, is left to the job queued by the reset.
+func renderGivingStatement(ctx context.Context, statementID uuid.UUID) (uuid.UUID, error) {
+	var (
+		userID      int64
+		year        int
+		existing    uuid.NullUUID
+		requestedAt time.Time
+	)
+	data := pdf.GivingStatementData{Currency: stripe().Currency, Letterhead: statements().Letterhead}
+	err := db.DB.QueryRowContext(ctx, `SELECT s.user_id, s.year, s.media_id, s.requested_at, u.username
+		FROM giving_statements s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1`, statementID).
+		Scan(&userID, &year, &existing, &requestedAt, &data.DonorName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The donor was deleted; there is nothing to render.
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, fmt.Errorf("error querying database: %w", err)
+	}
+	if existing.Valid {
+		return existing.UUID, nil
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+	data.From = from.Format("2 January 2006")
+	data.To = to.AddDate(0, 0, -1).Format("2 January 2006")
+	rows, err := db.DB.QueryContext(ctx, `SELECT given_at, fund, method, COALESCE(receipt, reference, ''), currency, amount_cents
+		FROM donations
+		WHERE user_id = $1 AND status = 'completed' AND given_at >= $2 AND given_at < $3
+		ORDER BY given_at, id`, userID, from, to)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			line    pdf.GivingLine
+			givenAt time.Time
+		)
+		if err := rows.Scan(&givenAt, &line.Fund, &line.Method, &line.Receipt, &line.Currency, &line.Amount); err != nil {
+			return uuid.Nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		line.Date = givenAt.Format(time.DateOnly)
+		data.Lines = append(data.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	document, err := json.Marshal(data)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	rendered, err := pdf.Render(pdf.TemplateGivingStatement, document)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	item, err := media.Store(ctx, statementNamespace, fmt.Sprintf("giving-statement-%d.pdf", year), "application/pdf", rendered, &userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := db.DB.ExecContext(ctx, `UPDATE giving_statements
+		SET status = 'ready', media_id = $1, generated_at = $2
+		WHERE id = $3 AND media_id IS NULL AND requested_at = $4`, item.ID, time.Now(), statementID, requestedAt)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 1 {
+			return item.ID, nil
+		}
+	}
+
+	// Another worker finished first, or the statement was reset or is gone;
+	// drop this copy.
+	if delErr := media.DeleteItem(context.WithoutCancel(ctx), item.ID); delErr != nil {
+		log.Printf("Failed to delete unused statement %s: %v", item.ID, delErr)
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error updating statement: %w", err)
+	}
+	return uuid.Nil, nil
+}
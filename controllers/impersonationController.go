@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/auth"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// impersonationTTL keeps impersonation sessions short; admins request a new
+// token if they need more time.
+const impersonationTTL = 15 * time.Minute
+
+// ImpersonateUser issues a short-lived token that lets an admin act as a
+// member to debug a reported issue. The token must be sent in the
+// X-Impersonation-Token header and every request made with it is audited.
+func (h *AuthHandler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+	if adminID == userID {
+		http.Error(w, "Admins cannot impersonate themselves", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Users.GetByID(ctx, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to retrieve user", http.StatusInternalServerError, err)
+		return
+	}
+	if user == nil {
+		middlewares.HttpError(w, "User not found", http.StatusNotFound, auth.ErrUserNotFound)
+		return
+	}
+	// Impersonating another admin would let an admin act with someone else's
+	// privileges without their own name on the change.
+	if user.Role == middlewares.RoleAdmin {
+		http.Error(w, "Admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+	if user.Status != models.UserStatusActive {
+		http.Error(w, "Suspended users cannot be impersonated", http.StatusBadRequest)
+		return
+	}
+
+	token, err := utils.GenerateImpersonationToken(user.ID, adminID, impersonationTTL)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to generate impersonation token", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RecordAdminAudit(r, adminID, user.ID, middlewares.AuditImpersonationStarted, http.StatusCreated)
+
+	middlewares.RespondJSON(w, map[string]interface{}{
+		"token":      token,
+		"header":     middlewares.ImpersonationHeaderName,
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"expires_at": time.Now().Add(impersonationTTL),
+	}, http.StatusCreated)
+}
+
+// GetAdminAuditLog returns a page of the admin audit log, newest first,
+// optionally filtered by admin_id or user_id.
+func GetAdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var adminID, userID *int64
+	for param, target := range map[string]**int64{"admin_id": &adminID, "user_id": &userID} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid "+param+" parameter", http.StatusBadRequest, err)
+			return
+		}
+		*target = &id
+	}
+
+	entries, total, err := fetchAdminAuditLog(r.Context(), adminID, userID, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch audit log", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.AdminAuditEntry]{
+		Items:   entries,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+func fetchAdminAuditLog(ctx context.Context, adminID, userID *int64, page Page) ([]models.AdminAuditEntry, int, error) {
+	const filter = `($1::integer IS NULL OR admin_id = $1) AND ($2::integer IS NULL OR user_id = $2)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_audit_log WHERE "+filter, adminID, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting audit log: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, admin_id, user_id, action, method, path, status,
+			COALESCE(ip_address, ''), created_at
+		FROM admin_audit_log
+		WHERE `+filter+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`, adminID, userID, page.PerPage, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AdminAuditEntry{}
+	for rows.Next() {
+		var entry models.AdminAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.AdminID, &entry.UserID, &entry.Action, &entry.Method, &entry.Path,
+			&entry.Status, &entry.IPAddress, &entry.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// IntegrityCheckResult summarises one verification run.
+type IntegrityCheckResult struct {
+	Checked    int                     `json:"checked"`
+	Mismatches int                     `json:"mismatches"`
+	Alerts     []models.IntegrityAlert `json:"alerts"`
+}
+
+// RunIntegrityCheck is the scheduled job entry point for content verification.
+func RunIntegrityCheck(ctx context.Context) error {
+	_, err := verifyPostIntegrity(ctx)
+	return err
+}
+
+// verifyPostIntegrity recomputes the content hash of every post and opens an
+// alert for each post whose stored hash does not match its content, which
+// means the row was changed outside the API.
+func verifyPostIntegrity(ctx context.Context) (*IntegrityCheckResult, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, title, excerpt, body, content_hash FROM posts")
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	type mismatch struct {
+		id       uuid.UUID
+		expected *string
+		actual   string
+	}
+	var mismatches []mismatch
+	result := &IntegrityCheckResult{}
+
+	for rows.Next() {
+		var post models.Post
+		var storedHash sql.NullString
+		if err := rows.Scan(&post.ID, &post.Title, &post.Excerpt, &post.Body, &storedHash); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		result.Checked++
+
+		actual := post.ComputeContentHash()
+		if !storedHash.Valid || storedHash.String != actual {
+			m := mismatch{id: post.ID, actual: actual}
+			if storedHash.Valid {
+				m.expected = &storedHash.String
+			}
+			mismatches = append(mismatches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	result.Mismatches = len(mismatches)
+	result.Alerts = []models.IntegrityAlert{}
+	for _, m := range mismatches {
+		var alert models.IntegrityAlert
+		err := db.DB.QueryRowContext(ctx, `INSERT INTO integrity_alerts (entity, entity_id, expected_hash, actual_hash)
+			VALUES ('post', $1, $2, $3)
+			ON CONFLICT (entity, entity_id) WHERE resolved_at IS NULL
+			DO UPDATE SET actual_hash = EXCLUDED.actual_hash, detected_at = NOW()
+			RETURNING id, entity, entity_id, expected_hash, actual_hash, detected_at`,
+			m.id, m.expected, m.actual).
+			Scan(&alert.ID, &alert.Entity, &alert.EntityID, &alert.ExpectedHash, &alert.ActualHash, &alert.DetectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error recording integrity alert: %w", err)
+		}
+		result.Alerts = append(result.Alerts, alert)
+		log.Printf("ALERT: content integrity mismatch for post %s (alert %d): content changed outside the API", m.id, alert.ID)
+	}
+
+	return result, nil
+}
+
+func RunIntegrityCheckNow(w http.ResponseWriter, r *http.Request) {
+	result, err := verifyPostIntegrity(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to verify content integrity", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, result, http.StatusOK)
+}
+
+// GetIntegrityAlerts lists integrity alerts; ?resolved=true includes resolved ones.
+func GetIntegrityAlerts(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT id, entity, entity_id, expected_hash, actual_hash, detected_at, resolved_at, resolved_by, changes_accepted
+		FROM integrity_alerts`
+	if r.URL.Query().Get("resolved") != "true" {
+		query += " WHERE resolved_at IS NULL"
+	}
+	query += " ORDER BY detected_at DESC"
+
+	rows, err := db.DB.QueryContext(r.Context(), query)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch integrity alerts", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.IntegrityAlert{}
+	for rows.Next() {
+		var a models.IntegrityAlert
+		if err := rows.Scan(&a.ID, &a.Entity, &a.EntityID, &a.ExpectedHash, &a.ActualHash, &a.DetectedAt, &a.ResolvedAt, &a.ResolvedBy, &a.ChangesAccepted); err != nil {
+			middlewares.HttpError(w, "Failed to fetch integrity alerts", http.StatusInternalServerError, err)
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch integrity alerts", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, alerts, http.StatusOK)
+}
+
+// ResolveIntegrityAlert closes an alert. With accept_changes the current
+// content is re-stamped as legitimate; otherwise the alert is only dismissed
+// and the mismatch will be reported again by the next run.
+func ResolveIntegrityAlert(w http.ResponseWriter, r *http.Request) {
+	alertID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		AcceptChanges bool `json:"accept_changes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to resolve alert", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var alert models.IntegrityAlert
+	err = tx.QueryRowContext(ctx, `UPDATE integrity_alerts
+		SET resolved_at = NOW(), resolved_by = $2, changes_accepted = $3
+		WHERE id = $1 AND resolved_at IS NULL
+		RETURNING id, entity, entity_id, expected_hash, actual_hash, detected_at, resolved_at, resolved_by, changes_accepted`,
+		alertID, adminID, payload.AcceptChanges).
+		Scan(&alert.ID, &alert.Entity, &alert.EntityID, &alert.ExpectedHash, &alert.ActualHash, &alert.DetectedAt, &alert.ResolvedAt, &alert.ResolvedBy, &alert.ChangesAccepted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Open alert not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to resolve alert", http.StatusInternalServerError, err)
+		return
+	}
+
+	if payload.AcceptChanges && alert.Entity == "post" {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET content_hash = $1 WHERE id = $2", alert.ActualHash, alert.EntityID); err != nil {
+			middlewares.HttpError(w, "Failed to accept content changes", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		middlewares.HttpError(w, "Failed to resolve alert", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, alert, http.StatusOK)
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxKioskBatchItems bounds a batch; kiosks with more upload in several.
+const maxKioskBatchItems = 500
+
+var ErrNotKiosk = errors.New("device is not in kiosk mode")
+
+// SubmitKioskBatch records the gifts and check-ins a kiosk collected while
+// offline. Items are stored independently under their client-generated IDs,
+// so a kiosk that lost the response simply uploads the batch again: items
+// already stored come back as duplicates. The response lists the outcome of
+// every item so that the kiosk knows which ones to keep for review.
+func SubmitKioskBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deviceID, _ := middlewares.DeviceIDFromContext(ctx)
+
+	var mode string
+	if err := db.DB.QueryRowContext(ctx, "SELECT mode FROM display_devices WHERE id = $1", deviceID).Scan(&mode); err != nil {
+		middlewares.HttpError(w, "Failed to check device", http.StatusInternalServerError, err)
+		return
+	}
+	if mode != models.DeviceModeKiosk {
+		middlewares.HttpError(w, ErrNotKiosk.Error(), http.StatusForbidden, ErrNotKiosk)
+		return
+	}
+
+	var batch models.KioskBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if len(batch.Donations)+len(batch.CheckIns) > maxKioskBatchItems {
+		http.Error(w, fmt.Sprintf("a batch holds at most %d items", maxKioskBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	result := models.KioskBatchResult{
+		Donations: make([]models.KioskItemResult, 0, len(batch.Donations)),
+		CheckIns:  make([]models.KioskItemResult, 0, len(batch.CheckIns)),
+	}
+	now := time.Now()
+	for _, donation := range batch.Donations {
+		item, err := recordKioskDonation(ctx, deviceID, donation, now)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to record donations", http.StatusInternalServerError, err)
+			return
+		}
+		result.Donations = append(result.Donations, item)
+	}
+	for _, checkIn := range batch.CheckIns {
+		item, err := recordKioskCheckIn(ctx, deviceID, checkIn, now)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to record check-ins", http.StatusInternalServerError, err)
+			return
+		}
+		result.CheckIns = append(result.CheckIns, item)
+	}
+
+	middlewares.RespondJSON(w, result, http.StatusOK)
+}
+
+func rejectedKioskItem(id uuid.UUID, err error) models.KioskItemResult {
+	return models.KioskItemResult{ID: id, Status: models.KioskItemRejected, Error: err.Error()}
+}
+
+// recordKioskDonation stores a gift unless its ID is taken. Only database
+// failures are returned as errors; a bad item is rejected on its own.
+func recordKioskDonation(ctx context.Context, deviceID uuid.UUID, donation models.Donation, now time.Time) (models.KioskItemResult, error) {
+	if donation.ID == uuid.Nil {
+		return rejectedKioskItem(donation.ID, errors.New("id is required")), nil
+	}
+	if donation.Fund == "" {
+		donation.Fund = "general"
+	}
+	donation.Currency = strings.ToUpper(donation.Currency)
+	if err := validation.ValidateDonation(donation, now); err != nil {
+		return rejectedKioskItem(donation.ID, err), nil
+	}
+	// TIMESTAMP columns drop the offset, so times are stored in UTC.
+	donation.GivenAt = donation.GivenAt.UTC().Truncate(time.Microsecond)
+
+	result, err := db.DB.ExecContext(ctx, `INSERT INTO donations
+		(id, user_id, donor_name, amount_cents, currency, fund, method, status, reference, device_id, given_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING`,
+		donation.ID, donation.UserID, strings.TrimSpace(donation.DonorName), donation.AmountCents, donation.Currency,
+		donation.Fund, donation.Method, models.DonationStatusCompleted, donation.Reference, deviceID, donation.GivenAt)
+	if isForeignKeyViolation(err) {
+		return rejectedKioskItem(donation.ID, errors.New("user_id does not exist")), nil
+	}
+	if err != nil {
+		return models.KioskItemResult{}, fmt.Errorf("error recording donation: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return models.KioskItemResult{}, err
+	} else if affected == 1 {
+		return models.KioskItemResult{ID: donation.ID, Status: models.KioskItemAccepted}, nil
+	}
+
+	var stored models.Donation
+	var storedDevice *uuid.UUID
+	err = db.DB.QueryRowContext(ctx, "SELECT amount_cents, currency, fund, method, device_id, given_at FROM donations WHERE id = $1", donation.ID).
+		Scan(&stored.AmountCents, &stored.Currency, &stored.Fund, &stored.Method, &storedDevice, &stored.GivenAt)
+	if err != nil {
+		return models.KioskItemResult{}, fmt.Errorf("error querying database: %w", err)
+	}
+	if storedDevice == nil || *storedDevice != deviceID || stored.AmountCents != donation.AmountCents ||
+		stored.Currency != donation.Currency || stored.Fund != donation.Fund || stored.Method != donation.Method ||
+		!stored.GivenAt.Equal(donation.GivenAt) {
+		return models.KioskItemResult{ID: donation.ID, Status: models.KioskItemConflict, Error: "id belongs to a different donation"}, nil
+	}
+	return models.KioskItemResult{ID: donation.ID, Status: models.KioskItemDuplicate}, nil
+}
+
+// recordKioskCheckIn stores a check-in. A member who already checked in to
+// the same service that day, e.g. at another kiosk, is a duplicate.
+func recordKioskCheckIn(ctx context.Context, deviceID uuid.UUID, checkIn models.CheckIn, now time.Time) (models.KioskItemResult, error) {
+	if checkIn.ID == uuid.Nil {
+		return rejectedKioskItem(checkIn.ID, errors.New("id is required")), nil
+	}
+	if err := validation.ValidateCheckIn(checkIn, now); err != nil {
+		return rejectedKioskItem(checkIn.ID, err), nil
+	}
+	checkIn.CheckedInAt = checkIn.CheckedInAt.UTC().Truncate(time.Microsecond)
+	checkIn.Service = strings.TrimSpace(checkIn.Service)
+
+	result, err := db.DB.ExecContext(ctx, `INSERT INTO check_ins (id, user_id, name, service, device_id, checked_in_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING`,
+		checkIn.ID, checkIn.UserID, strings.TrimSpace(checkIn.Name), checkIn.Service, deviceID, checkIn.CheckedInAt)
+	if isForeignKeyViolation(err) {
+		return rejectedKioskItem(checkIn.ID, errors.New("user_id does not exist")), nil
+	}
+	if err != nil {
+		return models.KioskItemResult{}, fmt.Errorf("error recording check-in: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return models.KioskItemResult{}, err
+	} else if affected == 1 {
+		return models.KioskItemResult{ID: checkIn.ID, Status: models.KioskItemAccepted}, nil
+	}
+
+	var (
+		storedUser    *int64
+		storedService string
+	)
+	err = db.DB.QueryRowContext(ctx, "SELECT user_id, service FROM check_ins WHERE id = $1", checkIn.ID).Scan(&storedUser, &storedService)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The ID is new, so the member's earlier check-in is the conflict.
+		return models.KioskItemResult{ID: checkIn.ID, Status: models.KioskItemDuplicate}, nil
+	}
+	if err != nil {
+		return models.KioskItemResult{}, fmt.Errorf("error querying database: %w", err)
+	}
+	sameUser := storedUser == nil && checkIn.UserID == nil || storedUser != nil && checkIn.UserID != nil && *storedUser == *checkIn.UserID
+	if !sameUser || storedService != checkIn.Service {
+		return models.KioskItemResult{ID: checkIn.ID, Status: models.KioskItemConflict, Error: "id belongs to a different check-in"}, nil
+	}
+	return models.KioskItemResult{ID: checkIn.ID, Status: models.KioskItemDuplicate}, nil
+}
+
+// kioskRecordFilter reads ?from=, ?to= and ?device_id= of the admin lists.
+func kioskRecordFilter(r *http.Request) (from, to *time.Time, deviceID *uuid.UUID, err error) {
+	query := r.URL.Query()
+	if from, err = parseListTime(query.Get("from"), false); err != nil {
+		return nil, nil, nil, errors.New("from must be a date or an RFC 3339 time")
+	}
+	if to, err = parseListTime(query.Get("to"), true); err != nil {
+		return nil, nil, nil, errors.New("to must be a date or an RFC 3339 time")
+	}
+	if value := query.Get("device_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, nil, nil, errors.New("device_id must be a UUID")
+		}
+		deviceID = &id
+	}
+	return from, to, deviceID, nil
+}
+
+// GetDonations lists gifts, newest first, optionally by date and device.
+func GetDonations(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	from, to, deviceID, err := kioskRecordFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	const filter = `($1::timestamp IS NULL OR given_at >= $1::timestamp)
+		AND ($2::timestamp IS NULL OR given_at < $2::timestamp)
+		AND ($3::uuid IS NULL OR device_id = $3::uuid)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM donations WHERE "+filter, from, to, deviceID).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch donations", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+donationColumns+` FROM donations
+		WHERE `+filter+`
+		ORDER BY given_at DESC, id
+		LIMIT $4 OFFSET $5`, from, to, deviceID, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch donations", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	donations := []models.Donation{}
+	for rows.Next() {
+		d, err := scanDonation(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch donations", http.StatusInternalServerError, err)
+			return
+		}
+		donations = append(donations, d)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch donations", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.Donation]{
+		Items:   donations,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetCheckIns lists check-ins, newest first, optionally by date and device.
+func GetCheckIns(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	from, to, deviceID, err := kioskRecordFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	const filter = `($1::timestamp IS NULL OR checked_in_at >= $1::timestamp)
+		AND ($2::timestamp IS NULL OR checked_in_at < $2::timestamp)
+		AND ($3::uuid IS NULL OR device_id = $3::uuid)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM check_ins WHERE "+filter, from, to, deviceID).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch check-ins", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, user_id, name, service, device_id, checked_in_at, recorded_at
+		FROM check_ins
+		WHERE `+filter+`
+		ORDER BY checked_in_at DESC, id
+		LIMIT $4 OFFSET $5`, from, to, deviceID, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch check-ins", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	checkIns := []models.CheckIn{}
+	for rows.Next() {
+		var c models.CheckIn
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.Service, &c.DeviceID, &c.CheckedInAt, &c.RecordedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch check-ins", http.StatusInternalServerError, err)
+			return
+		}
+		checkIns = append(checkIns, c)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch check-ins", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.CheckIn]{
+		Items:   checkIns,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/metrics"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const maxListQueryLength = 100
+
+// listSortOrders maps the accepted ?sort= values to their ORDER BY clauses.
+// Only these fixed clauses ever reach the SQL; the id keeps the order stable.
+var listSortOrders = map[string]string{
+	"created_at":  "created_at, id",
+	"-created_at": "created_at DESC, id",
+	"title":       "title, id",
+	"-title":      "title DESC, id",
+}
+
+// listFilterClause filters by listFilter.Args, in this order.
+const listFilterClause = `($1::timestamp IS NULL OR created_at >= $1::timestamp)
+	AND ($2::timestamp IS NULL OR created_at < $2::timestamp)
+	AND ($3 = '' OR title ILIKE '%' || $3 || '%' ESCAPE '\')`
+
+// ListFilter holds the sorting and filtering parameters of a list request.
+type ListFilter struct {
+	Sort string
+	// From and To bound created_at; To is exclusive.
+	From  *time.Time
+	To    *time.Time
+	Query string
+}
+
+// parseListFilter reads ?sort=, ?from=, ?to= and ?q=. from and to are RFC
+// 3339 times or dates; a date as to includes the whole day.
+func parseListFilter(r *http.Request) (ListFilter, error) {
+	return parseListQuery(r.URL.Query(), listSortOrders,
+		errors.New("sort must be created_at, -created_at, title or -title"))
+}
+
+// parseListQuery parses a ListFilter that may be sorted by the keys of
+// sortOrders; other sorts fail with errSort.
+func parseListQuery(query url.Values, sortOrders map[string]string, errSort error) (ListFilter, error) {
+	var filter ListFilter
+
+	filter.Sort = query.Get("sort")
+	if _, ok := sortOrders[filter.Sort]; filter.Sort != "" && !ok {
+		return ListFilter{}, errSort
+	}
+
+	var err error
+	if filter.From, err = parseListTime(query.Get("from"), false); err != nil {
+		return ListFilter{}, errors.New("from must be a date or an RFC 3339 time")
+	}
+	if filter.To, err = parseListTime(query.Get("to"), true); err != nil {
+		return ListFilter{}, errors.New("to must be a date or an RFC 3339 time")
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return ListFilter{}, errors.New("from must be before to")
+	}
+
+	filter.Query = strings.TrimSpace(query.Get("q"))
+	if len(filter.Query) > maxListQueryLength {
+		return ListFilter{}, errors.New("q is too long")
+	}
+
+	return filter, nil
+}
+
+func parseListTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		t = t.UTC()
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// IsZero reports whether the request asked for the plain, unfiltered list.
+func (f ListFilter) IsZero() bool {
+	return f == ListFilter{}
+}
+
+// OrderBy returns the ORDER BY clause of the requested sort, or fallback.
+func (f ListFilter) OrderBy(fallback string) string {
+	if order, ok := listSortOrders[f.Sort]; ok {
+		return order
+	}
+	return fallback
+}
+
+// Args returns the parameters of listFilterClause. The title query is
+// matched literally, so % and _ are escaped.
+func (f ListFilter) Args() []any {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Query)
+	return []any{f.From, f.To, escaped}
+}
+
+// CacheField is a canonical form of the filter, used as its cache key, so
+// that the same filter in a different parameter order shares the cache.
+func (f ListFilter) CacheField() string {
+	return f.cacheValues().Encode()
+}
+
+func (f ListFilter) cacheValues() url.Values {
+	values := url.Values{}
+	if f.Sort != "" {
+		values.Set("sort", f.Sort)
+	}
+	if f.From != nil {
+		values.Set("from", f.From.Format(time.RFC3339))
+	}
+	if f.To != nil {
+		values.Set("to", f.To.Format(time.RFC3339))
+	}
+	if f.Query != "" {
+		values.Set("q", strings.ToLower(f.Query))
+	}
+	return values
+}
+
+// fetchFilteredList returns a filtered list of an entity type from the cache,
+// or queries and caches it. Filtered lists are cleared together with the
+// entity's full list, see db.DeleteCacheKeys.
+func fetchFilteredList[T any](ctx context.Context, entity string, filter ListFilter,
+	query func(context.Context, ListFilter) ([]T, error)) ([]T, error) {
+	field := filter.CacheField()
+	cachedData, err := db.GetFilteredList(ctx, entity, field)
+	metrics.ObserveCache(err)
+	if err == nil {
+		var items []T
+		if err := json.Unmarshal(cachedData, &items); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cached %s data: %w", entity, err)
+		}
+		return items, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error fetching %s from Redis cache: %w", entity, err)
+	}
+
+	items, err := query(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(items)
+	if err == nil {
+		const CacheTime = 24 * time.Hour
+		db.SetFilteredList(ctx, entity, field, jsonData, CacheTime)
+	}
+
+	return items, nil
+}
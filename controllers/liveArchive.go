@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// liveArchiveDelay keeps a live in the main list for a while after it
+	// ends, for latecomers and so that YouTube can finish the recording.
+	liveArchiveDelay = time.Hour
+	// liveArchiveBatch bounds the lives archived by one run.
+	liveArchiveBatch = 50
+)
+
+// ArchiveEndedLives is the periodic job that archives lives that ended more
+// than liveArchiveDelay ago. When the YouTube integration is on, YouTube
+// links are replaced by the recording of their broadcast. A link whose
+// recording cannot be looked up is archived unchanged.
+func ArchiveEndedLives(ctx context.Context) error {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+liveColumns+` FROM lives
+		WHERE archived_at IS NULL AND ends_at <= $1
+		ORDER BY ends_at, id
+		LIMIT $2`, time.Now().UTC().Add(-liveArchiveDelay), liveArchiveBatch)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	var lives []models.Live
+	for rows.Next() {
+		live, err := scanLive(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		lives = append(lives, live)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, live := range lives {
+		links := slices.Clone(live.Links)
+		for i, link := range links {
+			if youTube().APIKey == "" || link.Platform != models.LivePlatformYouTube {
+				continue
+			}
+			// Broadcasts are published when scheduled, which can be well
+			// before they start.
+			recording, err := youTubeRecordingURL(ctx, link.URL, live.StartsAt.Add(-24*time.Hour))
+			if err != nil {
+				log.Printf("Failed to look up the recording of live %s: %v", live.ID, err)
+			} else if recording != "" {
+				links[i].URL = recording
+			}
+		}
+		encoded, err := json.Marshal(links)
+		if err != nil {
+			return err
+		}
+
+		archived, err := scanLive(db.DB.QueryRowContext(ctx, `UPDATE lives
+			SET archived_at = $2, links = $3, version = version + 1
+			WHERE id = $1 AND archived_at IS NULL
+			RETURNING `+liveColumns, live.ID, time.Now().UTC(), encoded))
+		if err != nil {
+			return fmt.Errorf("error archiving live %s: %w", live.ID, err)
+		}
+		if err := liveUpdated(ctx, archived); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLiveArchive lists archived lives one page at a time, newest first. It
+// takes the filters of GET /lives except ?status=.
+func GetLiveArchive(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	filter, err := parseLiveFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	archive, err := fetchLivePage(ctx, true, filter, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch archived lives", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeyLives, surrogateKeyLivesAll)
+	middlewares.RespondJSON(w, PaginatedResponse[serializers.Live]{
+		Items:   serializers.Lives(archive.Items),
+		Page:    archive.Page,
+		PerPage: archive.PerPage,
+		Total:   archive.Total,
+	}, http.StatusOK)
+}
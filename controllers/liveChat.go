@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Chat roles carried by chat tokens. Staff moderate the chat of every live.
+const (
+	ChatRoleMember    = "member"
+	ChatRoleModerator = "moderator"
+)
+
+var ErrChatDisabled = errors.New("live chat is not enabled")
+
+// ChatConfig is the shared secret of the embedded chat, which verifies the
+// tokens we issue so that chat identity matches site identity.
+type ChatConfig struct {
+	Secret []byte
+	// Audience, when set, is the aud claim the chat provider expects, such
+	// as its app ID.
+	Audience string
+	TTL      time.Duration
+}
+
+var (
+	chatConfig     ChatConfig
+	chatConfigOnce sync.Once
+)
+
+// LoadChatConfig reads CHAT_TOKEN_SECRET, CHAT_TOKEN_AUDIENCE and
+// CHAT_TOKEN_TTL. Chat tokens are not issued when the secret is not set.
+func LoadChatConfig() (ChatConfig, error) {
+	config := ChatConfig{
+		Secret:   []byte(os.Getenv("CHAT_TOKEN_SECRET")),
+		Audience: os.Getenv("CHAT_TOKEN_AUDIENCE"),
+		TTL:      15 * time.Minute,
+	}
+	if len(config.Secret) == 0 {
+		return ChatConfig{}, nil
+	}
+	if len(config.Secret) < 32 {
+		return ChatConfig{}, errors.New("CHAT_TOKEN_SECRET must be at least 32 characters")
+	}
+	if value := os.Getenv("CHAT_TOKEN_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > time.Hour {
+			return ChatConfig{}, errors.New("CHAT_TOKEN_TTL must be a positive duration of at most 1h")
+		}
+		config.TTL = ttl
+	}
+	return config, nil
+}
+
+func chat() ChatConfig {
+	chatConfigOnce.Do(func() {
+		chatConfig, _ = LoadChatConfig()
+	})
+	return chatConfig
+}
+
+// chatClaims are the claims of a chat token. The chat joins the user to
+// Room under Name, with the rights of Role.
+type chatClaims struct {
+	Subject   string `json:"sub"`
+	Name      string `json:"name"`
+	Room      string `json:"room"`
+	Role      string `json:"role"`
+	Audience  string `json:"aud,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// liveChatRoom is the chat room of a live.
+func liveChatRoom(liveID uuid.UUID) string {
+	return "live:" + liveID.String()
+}
+
+// CreateLiveChatToken issues a short-lived token that signs the
+// authenticated user into the chat room of a live. Clients ask for a new
+// one before it expires. Chat closes when the live ends, and admins
+// impersonating a user get no token, so nobody chats under another name.
+func CreateLiveChatToken(w http.ResponseWriter, r *http.Request) {
+	config := chat()
+	if len(config.Secret) == 0 {
+		middlewares.HttpError(w, "Live chat is not enabled", http.StatusServiceUnavailable, ErrChatDisabled)
+		return
+	}
+	ctx := r.Context()
+	userID, ok := middlewares.UserIDFromContext(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, impersonating := middlewares.ActingAdminFromContext(ctx); impersonating {
+		http.Error(w, "Chat is not available while impersonating", http.StatusForbidden)
+		return
+	}
+
+	idStr := mux.Vars(r)["id"]
+	liveID, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	live, err := scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+" FROM lives WHERE id = $1", liveID))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "live", "Live not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to retrieve live", http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	if live.StatusAt(now) == models.LiveStatusEnded {
+		http.Error(w, "Chat is closed for this live", http.StatusConflict)
+		return
+	}
+
+	var username, role string
+	err = db.DB.QueryRowContext(ctx, "SELECT username, role FROM users WHERE id = $1", userID).Scan(&username, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to retrieve user", http.StatusInternalServerError, err)
+		return
+	}
+
+	chatToken := models.LiveChatToken{
+		Room:      liveChatRoom(liveID),
+		UserID:    userID,
+		Name:      username,
+		Role:      ChatRoleMember,
+		ExpiresAt: now.Add(config.TTL).UTC(),
+	}
+	if role == middlewares.RoleStaff || role == middlewares.RoleAdmin {
+		chatToken.Role = ChatRoleModerator
+	}
+	chatToken.Token, err = utils.SignHS256JWT(config.Secret, chatClaims{
+		Subject:   strconv.FormatInt(userID, 10),
+		Name:      chatToken.Name,
+		Room:      chatToken.Room,
+		Role:      chatToken.Role,
+		Audience:  config.Audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: chatToken.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		middlewares.HttpError(w, "Failed to issue chat token", http.StatusInternalServerError,
+			fmt.Errorf("error signing chat token: %w", err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	middlewares.RespondJSON(w, chatToken, http.StatusOK)
+}
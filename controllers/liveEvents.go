@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// liveStatusChannel is the Redis channel of live_started and live_ended
+	// events.
+	liveStatusChannel = "lives:status"
+	// livesOnAirKey holds the IDs of the lives on air at the last check.
+	livesOnAirKey = "lives_on_air"
+)
+
+// Live status event names.
+const (
+	liveEventStatus  = "live_status"
+	liveEventStarted = "live_started"
+	liveEventEnded   = "live_ended"
+)
+
+// LiveStatusEvent is the data of a live_started or live_ended event. Live is
+// null when an ended live has since been deleted.
+type LiveStatusEvent struct {
+	Event string            `json:"event"`
+	ID    string            `json:"id"`
+	Live  *serializers.Live `json:"live"`
+}
+
+// StreamLiveEvents sends the live on air, as in GET /lives/current, as a
+// live_status event, then live_started and live_ended events as lives go on
+// and off air.
+func StreamLiveEvents(w http.ResponseWriter, r *http.Request) {
+	schedule, _, err := fetchLiveSchedule(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch the current live", http.StatusInternalServerError, err)
+		return
+	}
+	var current CurrentLive
+	if schedule.Current != nil {
+		live := serializers.FromLive(*schedule.Current)
+		current.Live = &live
+		current.EndsInSeconds = secondsUntil(schedule.Current.EndsAt)
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to encode the current live", http.StatusInternalServerError, err)
+		return
+	}
+
+	streamRedisEvents(w, r, liveStatusChannel, func(payload string) SSEEvent {
+		var event LiveStatusEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("Invalid live status event %q: %v", payload, err)
+		}
+		return SSEEvent{Name: event.Event, Data: []byte(payload)}
+	}, SSEEvent{Name: liveEventStatus, Data: data})
+}
+
+// PublishLiveStatusChanges is the periodic job that compares the lives on
+// air with the previous run and publishes live_started and live_ended
+// events. Status follows the clock, so changes are found by checking rather
+// than on writes; edits to a schedule show up on the next run.
+func PublishLiveStatusChanges(ctx context.Context) error {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+liveColumns+` FROM lives
+		WHERE starts_at <= $1 AND ends_at > $1`, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	onAir := map[string]models.Live{}
+	for rows.Next() {
+		live, err := scanLive(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		onAir[live.ID.String()] = live
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	previous, err := db.RedisClient.SMembers(ctx, livesOnAirKey).Result()
+	if err != nil {
+		return fmt.Errorf("error reading lives on air: %w", err)
+	}
+	wasOnAir := map[string]bool{}
+	for _, id := range previous {
+		wasOnAir[id] = true
+	}
+
+	var ids []any
+	for id, live := range onAir {
+		ids = append(ids, id)
+		if !wasOnAir[id] {
+			serialized := serializers.FromLive(live)
+			publishLiveStatus(ctx, LiveStatusEvent{Event: liveEventStarted, ID: id, Live: &serialized})
+		}
+	}
+	for id := range wasOnAir {
+		if _, ok := onAir[id]; ok {
+			continue
+		}
+		event := LiveStatusEvent{Event: liveEventEnded, ID: id}
+		if live, err := queryLive(ctx, id); err == nil {
+			serialized := serializers.FromLive(live)
+			event.Live = &serialized
+		}
+		publishLiveStatus(ctx, event)
+	}
+
+	pipe := db.RedisClient.TxPipeline()
+	pipe.Del(ctx, livesOnAirKey)
+	if len(ids) > 0 {
+		pipe.SAdd(ctx, livesOnAirKey, ids...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error storing lives on air: %w", err)
+	}
+	return nil
+}
+
+// publishLiveStatus is best effort: clients that miss an event catch up
+// from the live_status event when they reconnect.
+func publishLiveStatus(ctx context.Context, event LiveStatusEvent) {
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = db.RedisClient.Publish(ctx, liveStatusChannel, data).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event for live %s: %v", event.Event, event.ID, err)
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/metrics"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+const (
+	liveScheduleCacheKey = "lives_schedule"
+	// liveScheduleCacheTime is how stale the homepage banner may be after a
+	// live is edited. The cache never outlives the next start or end.
+	liveScheduleCacheTime = 30 * time.Second
+)
+
+// liveSchedule is the live on air, if any, and the next one to start.
+type liveSchedule struct {
+	Current *models.Live `json:"current"`
+	Next    *models.Live `json:"next"`
+}
+
+// CurrentLive is the payload of GET /lives/current. Live is null when
+// nothing is on air.
+type CurrentLive struct {
+	Live          *serializers.Live `json:"live"`
+	EndsInSeconds int64             `json:"ends_in_seconds,omitempty"`
+}
+
+// NextLive is the payload of GET /lives/next. Live is null when nothing is
+// scheduled.
+type NextLive struct {
+	Live            *serializers.Live `json:"live"`
+	StartsInSeconds int64             `json:"starts_in_seconds,omitempty"`
+}
+
+func setupLiveScheduleRoutes(livesRouter *mux.Router) {
+	livesRouter.HandleFunc("/current", GetCurrentLive).Methods("GET")
+	livesRouter.HandleFunc("/next", GetNextLive).Methods("GET")
+}
+
+// GetCurrentLive returns the live on air now and the seconds until it ends.
+func GetCurrentLive(w http.ResponseWriter, r *http.Request) {
+	schedule, ttl, err := fetchLiveSchedule(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch the current live", http.StatusInternalServerError, err)
+		return
+	}
+
+	var payload CurrentLive
+	if schedule.Current != nil {
+		live := serializers.FromLive(*schedule.Current)
+		payload.Live = &live
+		payload.EndsInSeconds = secondsUntil(schedule.Current.EndsAt)
+	}
+	setSurrogateKeys(w, surrogateKeyLivesAll)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	middlewares.RespondJSON(w, payload, http.StatusOK)
+}
+
+// GetNextLive returns the next scheduled live and a countdown to its start.
+func GetNextLive(w http.ResponseWriter, r *http.Request) {
+	schedule, ttl, err := fetchLiveSchedule(r.Context())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch the next live", http.StatusInternalServerError, err)
+		return
+	}
+
+	var payload NextLive
+	if schedule.Next != nil {
+		live := serializers.FromLive(*schedule.Next)
+		payload.Live = &live
+		payload.StartsInSeconds = secondsUntil(schedule.Next.StartsAt)
+	}
+	setSurrogateKeys(w, surrogateKeyLivesAll)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	middlewares.RespondJSON(w, payload, http.StatusOK)
+}
+
+// secondsUntil rounds up, so a countdown only reaches zero at t.
+func secondsUntil(t time.Time) int64 {
+	return int64(time.Until(t).Seconds() + 0.999)
+}
+
+// fetchLiveSchedule returns the cached schedule and how much longer it may
+// be cached.
+func fetchLiveSchedule(ctx context.Context) (liveSchedule, time.Duration, error) {
+	var schedule liveSchedule
+	cachedData, err := db.RedisClient.Get(ctx, liveScheduleCacheKey).Bytes()
+	metrics.ObserveCache(err)
+	if err == nil {
+		if err := json.Unmarshal(cachedData, &schedule); err != nil {
+			return schedule, 0, fmt.Errorf("error unmarshalling cached live schedule: %w", err)
+		}
+		ttl, err := db.RedisClient.PTTL(ctx, liveScheduleCacheKey).Result()
+		if err != nil || ttl <= 0 {
+			ttl = time.Second
+		}
+		return schedule, ttl, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return schedule, 0, fmt.Errorf("error fetching live schedule from Redis cache: %w", err)
+	}
+
+	now := time.Now()
+	schedule, err = queryLiveSchedule(ctx, now)
+	if err != nil {
+		return schedule, 0, err
+	}
+
+	ttl := liveScheduleCacheTime
+	if schedule.Current != nil {
+		ttl = min(ttl, schedule.Current.EndsAt.Sub(now))
+	}
+	if schedule.Next != nil {
+		ttl = min(ttl, schedule.Next.StartsAt.Sub(now))
+	}
+	ttl = max(ttl, time.Second)
+
+	jsonData, err := json.Marshal(schedule)
+	if err == nil {
+		if err := db.RedisClient.Set(ctx, liveScheduleCacheKey, jsonData, ttl).Err(); err != nil {
+			return schedule, 0, fmt.Errorf("error setting live schedule cache: %w", err)
+		}
+	}
+	return schedule, ttl, nil
+}
+
+// queryLiveSchedule loads the live on air at now, the latest to start if
+// several overlap, and the next live to start after now.
+func queryLiveSchedule(ctx context.Context, now time.Time) (liveSchedule, error) {
+	var schedule liveSchedule
+	now = now.UTC()
+
+	current, err := scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+` FROM lives
+		WHERE starts_at <= $1 AND ends_at > $1
+		ORDER BY starts_at DESC LIMIT 1`, now))
+	if err == nil {
+		schedule.Current = &current
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return schedule, fmt.Errorf("error querying database: %w", err)
+	}
+
+	next, err := scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+` FROM lives
+		WHERE starts_at > $1
+		ORDER BY starts_at LIMIT 1`, now))
+	if err == nil {
+		schedule.Next = &next
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return schedule, fmt.Errorf("error querying database: %w", err)
+	}
+	return schedule, nil
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// shortLinkAlphabet is lower case and leaves out look-alikes, so codes
+	// survive being read out or retyped from an SMS.
+	shortLinkAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	shortLinkLength   = 7
+)
+
+// ShortLinkPrefix is where short links are followed.
+const ShortLinkPrefix = "/l/"
+
+var ErrShortLinksDisabled = errors.New("short links are not enabled")
+
+var (
+	shortLinkBaseURL     string
+	shortLinkBaseURLOnce sync.Once
+)
+
+// SetupShortLinkRoutes registers the short link redirect. Short links are
+// opened from chat apps without the bearer token.
+func SetupShortLinkRoutes(r *mux.Router) {
+	r.HandleFunc(ShortLinkPrefix+"{code}", FollowShortLink).Methods("GET")
+}
+
+// LoadShortLinkBaseURL returns SHORT_LINK_BASE_URL, the public URL that
+// serves GET /l/{code}. Short links cannot be created when it is not set.
+func LoadShortLinkBaseURL() (string, error) {
+	value := strings.TrimSuffix(os.Getenv("SHORT_LINK_BASE_URL"), "/")
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", errors.New("SHORT_LINK_BASE_URL must be an http(s) URL")
+	}
+	return value, nil
+}
+
+func shortLinkBase() string {
+	shortLinkBaseURLOnce.Do(func() {
+		shortLinkBaseURL, _ = LoadShortLinkBaseURL()
+	})
+	return shortLinkBaseURL
+}
+
+// newShortLinkCode returns a random code of shortLinkLength characters.
+func newShortLinkCode() (string, error) {
+	code := make([]byte, 0, shortLinkLength)
+	buf := make([]byte, 1)
+	for len(code) < shortLinkLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// Skip the bytes that would favour the first characters.
+		if int(buf[0]) >= 256-256%len(shortLinkAlphabet) {
+			continue
+		}
+		code = append(code, shortLinkAlphabet[int(buf[0])%len(shortLinkAlphabet)])
+	}
+	return string(code), nil
+}
+
+// CreateLiveShortLink returns the short link of a live, creating it on the
+// first call. The link follows the live, so it stays valid when the link
+// of the live changes, such as to the recording.
+func CreateLiveShortLink(w http.ResponseWriter, r *http.Request) {
+	base := shortLinkBase()
+	if base == "" {
+		middlewares.HttpError(w, "Short links are not enabled", http.StatusServiceUnavailable, ErrShortLinksDisabled)
+		return
+	}
+	idStr := mux.Vars(r)["id"]
+	liveID, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	link, created, err := ensureLiveShortLink(ctx, liveID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "live", "Live not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create short link", http.StatusInternalServerError, err)
+		return
+	}
+	link.URL = base + ShortLinkPrefix + link.Code
+
+	if created {
+		middlewares.RespondCreated(w, link.URL, link)
+		return
+	}
+	middlewares.RespondJSON(w, link, http.StatusOK)
+}
+
+// ensureLiveShortLink returns the short link of a live and whether it was
+// just created. sql.ErrNoRows is returned when there is no such live.
+func ensureLiveShortLink(ctx context.Context, liveID uuid.UUID) (models.LiveShortLink, bool, error) {
+	var createdBy *int64
+	if userID, ok := middlewares.UserIDFromContext(ctx); ok {
+		createdBy = &userID
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		link := models.LiveShortLink{LiveID: liveID}
+		err := db.DB.QueryRowContext(ctx, "SELECT code, clicks, created_at FROM live_short_links WHERE live_id = $1", liveID).
+			Scan(&link.Code, &link.Clicks, &link.CreatedAt)
+		if err == nil {
+			return link, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return link, false, fmt.Errorf("error querying database: %w", err)
+		}
+
+		code, err := newShortLinkCode()
+		if err != nil {
+			return link, false, err
+		}
+		err = db.DB.QueryRowContext(ctx, `INSERT INTO live_short_links (code, live_id, created_by)
+			VALUES ($1, $2, $3)
+			RETURNING code, clicks, created_at`, code, liveID, createdBy).
+			Scan(&link.Code, &link.Clicks, &link.CreatedAt)
+		switch {
+		case err == nil:
+			return link, true, nil
+		case isForeignKeyViolation(err):
+			return link, false, fmt.Errorf("live %s not found: %w", liveID, sql.ErrNoRows)
+		case isUniqueViolation(err):
+			// The code is taken, or the live got its link concurrently;
+			// the next attempt finds out which.
+			continue
+		default:
+			return link, false, fmt.Errorf("error inserting short link: %w", err)
+		}
+	}
+	return models.LiveShortLink{}, false, errors.New("no free short link code found")
+}
+
+// FollowShortLink counts a click and redirects to the live's primary link.
+func FollowShortLink(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToLower(mux.Vars(r)["code"])
+	if len(code) != shortLinkLength || strings.Trim(code, shortLinkAlphabet) != "" {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	var (
+		live  models.Live
+		links []byte
+	)
+	err := db.DB.QueryRowContext(r.Context(), `UPDATE live_short_links s SET clicks = s.clicks + 1
+		FROM lives l
+		WHERE s.code = $1 AND l.id = s.live_id
+		RETURNING l.links`, code).Scan(&links)
+	if err == nil {
+		err = json.Unmarshal(links, &live.Links)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Link not found", http.StatusNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to resolve link", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, live.PrimaryLink(), http.StatusFound)
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// liveViewerMinuteTTL keeps per-minute counts in Redis until the rollup
+	// has saved them, with room for a few missed runs.
+	liveViewerMinuteTTL = 15 * time.Minute
+	// liveViewerTTL keeps the unique viewers of a live in Redis.
+	liveViewerTTL = 7 * 24 * time.Hour
+	// liveViewerRollupWindow is how far back the rollup recounts minutes,
+	// and how long after a live ends it keeps rolling it up.
+	liveViewerRollupWindow = 10 * time.Minute
+)
+
+func setupLiveViewerRoutes(livesRouter *mux.Router) {
+	livesRouter.HandleFunc("/{id}/heartbeat", RecordLiveHeartbeat).Methods("POST")
+	livesRouter.Handle("/{id}/viewers", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(GetLiveViewerStats)))).Methods("GET")
+}
+
+func liveViewersKey(liveID uuid.UUID) string {
+	return "live_viewers:" + liveID.String()
+}
+
+func liveViewersMinuteKey(liveID uuid.UUID, minute time.Time) string {
+	return fmt.Sprintf("live_viewers:%s:%d", liveID, minute.Unix())
+}
+
+// RecordLiveHeartbeat counts a viewer of a live on air. Players send one
+// about every 30 seconds with a viewer_id, a UUID they keep for the
+// browser, so that reloads are not counted as new viewers.
+func RecordLiveHeartbeat(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	liveID, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	var payload struct {
+		ViewerID uuid.UUID `json:"viewer_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.ViewerID == uuid.Nil {
+		middlewares.HttpError(w, "viewer_id must be a UUID", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	live, err := fetchLive(ctx, idStr)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "live", "Live not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch live", http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	if live.StatusAt(now) != models.LiveStatusLive {
+		http.Error(w, "The live is not on air", http.StatusConflict)
+		return
+	}
+
+	minuteKey := liveViewersMinuteKey(liveID, now.Truncate(time.Minute))
+	pipe := db.RedisClient.Pipeline()
+	pipe.PFAdd(ctx, liveViewersKey(liveID), payload.ViewerID.String())
+	pipe.Expire(ctx, liveViewersKey(liveID), liveViewerTTL)
+	pipe.PFAdd(ctx, minuteKey, payload.ViewerID.String())
+	pipe.Expire(ctx, minuteKey, liveViewerMinuteTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		middlewares.HttpError(w, "Failed to record heartbeat", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RollupLiveViewers is the periodic job that saves the viewer counts of the
+// lives on air, and of those that just ended, from Redis to Postgres.
+// Recent minutes are recounted, so a run that is missed or comes early
+// corrects itself.
+func RollupLiveViewers(ctx context.Context) error {
+	now := time.Now().UTC()
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, starts_at FROM lives
+		WHERE starts_at <= $1 AND ends_at > $2`, now, now.Add(-liveViewerRollupWindow))
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	type onAir struct {
+		id       uuid.UUID
+		startsAt time.Time
+	}
+	var lives []onAir
+	for rows.Next() {
+		var live onAir
+		if err := rows.Scan(&live.id, &live.startsAt); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		lives = append(lives, live)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, live := range lives {
+		if err := rollupLiveViewers(ctx, live.id, live.startsAt, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollupLiveViewers(ctx context.Context, liveID uuid.UUID, startsAt, now time.Time) error {
+	first := later(startsAt.Truncate(time.Minute), now.Add(-liveViewerRollupWindow).Truncate(time.Minute))
+	for minute := first; minute.Before(now.Truncate(time.Minute)); minute = minute.Add(time.Minute) {
+		viewers, err := db.RedisClient.PFCount(ctx, liveViewersMinuteKey(liveID, minute)).Result()
+		if err != nil {
+			return fmt.Errorf("error counting viewers of live %s: %w", liveID, err)
+		}
+		if viewers == 0 {
+			continue
+		}
+		_, err = db.DB.ExecContext(ctx, `INSERT INTO live_viewer_minutes (live_id, minute, viewers)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (live_id, minute) DO UPDATE SET viewers = EXCLUDED.viewers`, liveID, minute, viewers)
+		if err != nil {
+			return fmt.Errorf("error saving viewers of live %s: %w", liveID, err)
+		}
+	}
+
+	unique, err := db.RedisClient.PFCount(ctx, liveViewersKey(liveID)).Result()
+	if err != nil {
+		return fmt.Errorf("error counting viewers of live %s: %w", liveID, err)
+	}
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO live_viewer_totals (live_id, unique_viewers)
+		VALUES ($1, $2)
+		ON CONFLICT (live_id) DO UPDATE SET unique_viewers = EXCLUDED.unique_viewers, updated_at = CURRENT_TIMESTAMP`,
+		liveID, unique)
+	if err != nil {
+		return fmt.Errorf("error saving viewers of live %s: %w", liveID, err)
+	}
+	return nil
+}
+
+// GetLiveViewerStats returns the viewer statistics of a live for the media
+// team: saved minutes from Postgres, and from Redis the current minute and
+// the unique viewers while they are still there.
+func GetLiveViewerStats(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	liveID, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	live, err := fetchLive(ctx, idStr)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "live", "Live not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch live", http.StatusInternalServerError, err)
+		return
+	}
+
+	stats, err := queryLiveViewerStats(ctx, liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch viewer stats", http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	if live.StatusAt(now) == models.LiveStatusLive {
+		if stats.ConcurrentNow, err = db.RedisClient.PFCount(ctx, liveViewersMinuteKey(liveID, now.Truncate(time.Minute))).Result(); err != nil {
+			middlewares.HttpError(w, "Failed to fetch viewer stats", http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if unique, err := db.RedisClient.PFCount(ctx, liveViewersKey(liveID)).Result(); err == nil {
+		stats.UniqueViewers = max(stats.UniqueViewers, unique)
+	}
+
+	middlewares.RespondJSON(w, stats, http.StatusOK)
+}
+
+func queryLiveViewerStats(ctx context.Context, liveID uuid.UUID) (models.LiveViewerStats, error) {
+	stats := models.LiveViewerStats{LiveID: liveID, Minutes: []models.LiveViewerMinute{}}
+
+	err := db.DB.QueryRowContext(ctx, "SELECT unique_viewers FROM live_viewer_totals WHERE live_id = $1", liveID).
+		Scan(&stats.UniqueViewers)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return stats, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT minute, viewers FROM live_viewer_minutes
+		WHERE live_id = $1 ORDER BY minute`, liveID)
+	if err != nil {
+		return stats, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	for rows.Next() {
+		var minute models.LiveViewerMinute
+		if err := rows.Scan(&minute.Minute, &minute.Viewers); err != nil {
+			return stats, fmt.Errorf("error scanning row: %w", err)
+		}
+		if minute.Viewers > stats.PeakConcurrent {
+			stats.PeakConcurrent = minute.Viewers
+			stats.PeakAt = &minute.Minute
+		}
+		total += minute.Viewers
+		stats.Minutes = append(stats.Minutes, minute)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	if len(stats.Minutes) > 0 {
+		stats.AverageConcurrent = float64(total) / float64(len(stats.Minutes))
+	}
+	return stats, nil
+}
@@ -7,10 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"jsmi-api/db"
+	"jsmi-api/events"
+	"jsmi-api/metrics"
 	"jsmi-api/middlewares"
 	"jsmi-api/models"
+	"jsmi-api/serializers"
 	"jsmi-api/validation"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -18,15 +24,29 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// livesCacheEntity versions the Redis keys of cached lives, see db.CacheKey.
+const livesCacheEntity = "lives"
+
 func SetupLiveRoutes(r *mux.Router) {
 	livesRouter := r.PathPrefix("/lives").Subrouter()
-	livesRouter.HandleFunc("", GetLives).Methods("GET")
-	livesRouter.HandleFunc("", GetLive).Methods("GET").Queries("id", "{id}")
+	livesRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetLives))).Methods("GET")
+	livesRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetLive))).Methods("GET").Queries("id", "{id}")
 	livesRouter.HandleFunc("", CreateLive).Methods("POST")
 	livesRouter.HandleFunc("", UpdateLive).Methods("PUT").Queries("id", "{id}")
+	livesRouter.HandleFunc("", PatchLive).Methods("PATCH").Queries("id", "{id}")
 	livesRouter.HandleFunc("", DeleteLive).Methods("DELETE").Queries("id", "{id}")
+	livesRouter.HandleFunc("/archive", GetLiveArchive).Methods("GET")
+	livesRouter.HandleFunc("/events", StreamLiveEvents).Methods("GET")
+	livesRouter.HandleFunc("/{id}/shortlink", CreateLiveShortLink).Methods("POST")
+	livesRouter.Handle("/{id}/chat/token", middlewares.TokenAuthMiddleware(http.HandlerFunc(CreateLiveChatToken))).Methods("POST")
+	setupLiveScheduleRoutes(livesRouter)
+	setupLiveViewerRoutes(livesRouter)
+	setupRundownRoutes(livesRouter)
 }
 
+// GetLives lists the lives that are not archived one page at a time, by
+// start time unless ?sort= asks for another order. ?from= and ?to= bound the
+// start time and ?status= keeps upcoming, live or ended lives.
 func GetLives(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
 	if id != "" {
@@ -34,29 +54,185 @@ func GetLives(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	filter, err := parseLiveFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains(liveStatuses, status) {
+		http.Error(w, "status must be upcoming, live or ended", http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
-	lives, err := fetchLives(ctx)
+	var lives PaginatedResponse[models.Live]
+	if status == "" {
+		lives, err = fetchLivePage(ctx, false, filter, page)
+	} else {
+		// Status depends on the clock, so these pages are not cached.
+		lives, err = queryLivePage(ctx, false, filter, page, status, time.Now())
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch lives", http.StatusInternalServerError, err)
+		return
+	}
+
+	lastModified, err := queryLastChange(ctx, "lives", nil)
 	if err != nil {
 		middlewares.HttpError(w, "Failed to fetch lives", http.StatusInternalServerError, err)
 		return
 	}
 
-	middlewares.RespondJSON(w, lives, http.StatusOK)
+	setSurrogateKeys(w, surrogateKeyLives, surrogateKeyLivesAll)
+	respondConditional(w, r, PaginatedResponse[serializers.Live]{
+		Items:   serializers.Lives(lives.Items),
+		Page:    lives.Page,
+		PerPage: lives.PerPage,
+		Total:   lives.Total,
+	}, lastModified)
 }
 
-func fetchLives(ctx context.Context) ([]models.Live, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "lives").Result()
+var liveStatuses = []string{models.LiveStatusUpcoming, models.LiveStatusLive, models.LiveStatusEnded}
+
+// liveStatusClause keeps the lives with the status $6 at $7, see
+// models.Live.StatusAt; an empty status keeps all of them.
+const liveStatusClause = `($6 = ''
+	OR ($6 = 'upcoming' AND starts_at > $7)
+	OR ($6 = 'live' AND starts_at <= $7 AND ends_at > $7)
+	OR ($6 = 'ended' AND ends_at <= $7))`
+
+// fetchLivePage returns a page of the main list, or of the archive when
+// archived is set, from the lives' filtered list cache, or queries and
+// caches it.
+func fetchLivePage(ctx context.Context, archived bool, filter LiveFilter, page Page) (PaginatedResponse[models.Live], error) {
+	values, _ := url.ParseQuery(filter.CacheField())
+	values.Set("page", strconv.Itoa(page.Number))
+	values.Set("per_page", strconv.Itoa(page.PerPage))
+	if archived {
+		values.Set("archived", "true")
+	}
+	field := values.Encode()
+
+	var lives PaginatedResponse[models.Live]
+	cachedData, err := db.GetFilteredList(ctx, livesCacheEntity, field)
+	metrics.ObserveCache(err)
 	if err == nil {
-		var lives []models.Live
-		if err := json.Unmarshal([]byte(cachedData), &lives); err != nil {
-			return nil, fmt.Errorf("error unmarshalling cached lives data: %w", err)
+		if err := json.Unmarshal(cachedData, &lives); err != nil {
+			return lives, fmt.Errorf("error unmarshalling cached lives data: %w", err)
 		}
 		return lives, nil
 	} else if !errors.Is(err, redis.Nil) {
-		return nil, fmt.Errorf("error fetching lives from Redis cache: %w", err)
+		return lives, fmt.Errorf("error fetching lives from Redis cache: %w", err)
 	}
 
-	rows, err := db.DB.QueryContext(ctx, "SELECT id, title, link, created_at FROM lives")
+	lives, err = queryLivePage(ctx, archived, filter, page, "", time.Now())
+	if err != nil {
+		return lives, err
+	}
+
+	jsonData, err := json.Marshal(lives)
+	if err == nil {
+		const CacheTime = 24 * time.Hour
+		db.SetFilteredList(ctx, livesCacheEntity, field, jsonData, CacheTime)
+	}
+	return lives, nil
+}
+
+// queryLivePage loads a page of the lives that match filter and have status
+// at now. The main list runs by start time, the archive newest first.
+func queryLivePage(ctx context.Context, archived bool, filter LiveFilter, page Page, status string, now time.Time) (PaginatedResponse[models.Live], error) {
+	lives := PaginatedResponse[models.Live]{Items: []models.Live{}, Page: page.Number, PerPage: page.PerPage}
+	where, order := " FROM lives WHERE archived_at IS NULL", "starts_at, id"
+	if archived {
+		where, order = " FROM lives WHERE archived_at IS NOT NULL", "starts_at DESC, id"
+	}
+	where += " AND " + liveFilterClause + " AND " + liveStatusClause
+
+	args := append(filter.Args(), status, now.UTC())
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*)"+where, args...).Scan(&lives.Total); err != nil {
+		return lives, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+liveColumns+where+" ORDER BY "+filter.OrderBy(order)+
+		" LIMIT $8 OFFSET $9", append(args, page.PerPage, page.Offset())...)
+	if err != nil {
+		return lives, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		live, err := scanLive(rows)
+		if err != nil {
+			return lives, fmt.Errorf("error scanning row: %w", err)
+		}
+		lives.Items = append(lives.Items, live)
+	}
+	if err := rows.Err(); err != nil {
+		return lives, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return lives, nil
+}
+
+const liveColumns = "id, title, links, description, starts_at, ends_at, speaker, series_id, passage, archived_at, version, created_at"
+
+func scanLive(row rowScanner) (models.Live, error) {
+	var (
+		live  models.Live
+		links []byte
+	)
+	err := row.Scan(&live.ID, &live.Title, &links, &live.Description, &live.StartsAt, &live.EndsAt,
+		&live.Speaker, &live.SeriesID, &live.Passage, &live.ArchivedAt, &live.Version, &live.CreatedAt)
+	if err != nil {
+		return models.Live{}, err
+	}
+	if err := json.Unmarshal(links, &live.Links); err != nil {
+		return models.Live{}, fmt.Errorf("error decoding links: %w", err)
+	}
+	return live, nil
+}
+
+func liveConflictFields(yours, theirs models.Live) []models.FieldConflict {
+	fields := conflictingFields(
+		fieldPair{"title", yours.Title, theirs.Title},
+		fieldPair{"description", yours.Description, theirs.Description},
+		fieldPair{"starts_at", yours.StartsAt.UTC().Format(time.RFC3339Nano), theirs.StartsAt.UTC().Format(time.RFC3339Nano)},
+		fieldPair{"ends_at", yours.EndsAt.UTC().Format(time.RFC3339Nano), theirs.EndsAt.UTC().Format(time.RFC3339Nano)},
+		fieldPair{"speaker", yours.Speaker, theirs.Speaker},
+		fieldPair{"series_id", liveSeriesField(yours.SeriesID), liveSeriesField(theirs.SeriesID)},
+		fieldPair{"passage", yours.Passage, theirs.Passage},
+	)
+	// Slices are not comparable with !=, so links are compared here.
+	if !slices.Equal(yours.Links, theirs.Links) {
+		fields = append(fields, models.FieldConflict{Field: "links", Yours: yours.Links, Theirs: theirs.Links})
+	}
+	return fields
+}
+
+// liveSeriesField makes series IDs comparable by value in conflicts.
+func liveSeriesField(id *uuid.UUID) any {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
+
+// respondUnknownSeries answers a write whose series_id matches no
+// series, which the database reports as a foreign key violation.
+func respondUnknownSeries(w http.ResponseWriter) {
+	var errs validation.ValidationError
+	errs.Add("series_id", validation.RuleInvalid, "series_id does not match a series")
+	respondValidationError(w, errs.Err())
+}
+
+// queryLives loads all lives from the database, bypassing the cache.
+func queryLives(ctx context.Context) ([]models.Live, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+liveColumns+" FROM lives")
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -68,8 +244,8 @@ func fetchLives(ctx context.Context) ([]models.Live, error) {
 
 	var lives []models.Live
 	for rows.Next() {
-		var live models.Live
-		if err := rows.Scan(&live.ID, &live.Title, &live.Link, &live.CreatedAt); err != nil {
+		live, err := scanLive(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 		lives = append(lives, live)
@@ -79,15 +255,6 @@ func fetchLives(ctx context.Context) ([]models.Live, error) {
 		return nil, fmt.Errorf("error iterating over rows: %w", err)
 	}
 
-	jsonData, err := json.Marshal(lives)
-	if err == nil {
-		const CacheTime = 7 * 24 * time.Hour
-		err = db.RedisClient.Set(ctx, "lives", jsonData, CacheTime).Err()
-		if err != nil {
-			return nil, fmt.Errorf("error setting lives cache: %w", err)
-		}
-	}
-
 	return lives, nil
 }
 
@@ -107,11 +274,23 @@ func GetLive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	middlewares.RespondJSON(w, live, http.StatusOK)
+	lastModified, err := queryLastChange(ctx, "lives", &live.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch live", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, liveSurrogateKey(live.ID.String()), surrogateKeyLivesAll)
+	respondConditional(w, r, serializers.FromLive(live), lastModified)
 }
 
 func fetchLive(ctx context.Context, liveID string) (models.Live, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "live:"+liveID).Result()
+	cacheKey, err := db.CacheKey(ctx, livesCacheEntity, liveID)
+	if err != nil {
+		return models.Live{}, err
+	}
+	cachedData, err := db.RedisClient.Get(ctx, cacheKey).Result()
+	metrics.ObserveCache(err)
 	if err == nil {
 		var live models.Live
 		if err := json.Unmarshal([]byte(cachedData), &live); err != nil {
@@ -122,20 +301,15 @@ func fetchLive(ctx context.Context, liveID string) (models.Live, error) {
 		return models.Live{}, fmt.Errorf("error fetching live %s from Redis cache: %w", liveID, err)
 	}
 
-	var live models.Live
-	err = db.DB.QueryRowContext(ctx, "SELECT id, title, link, created_at FROM lives WHERE id = $1", liveID).
-		Scan(&live.ID, &live.Title, &live.Link, &live.CreatedAt)
+	live, err := queryLive(ctx, liveID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Live{}, fmt.Errorf("live %s not found: %w", liveID, sql.ErrNoRows)
-		}
-		return models.Live{}, fmt.Errorf("error querying database: %w", err)
+		return models.Live{}, err
 	}
 
 	jsonData, err := json.Marshal(live)
 	if err == nil {
 		const CacheTime = 7 * 24 * time.Hour
-		err = db.RedisClient.Set(ctx, "live:"+liveID, jsonData, CacheTime).Err()
+		err = db.RedisClient.Set(ctx, cacheKey, jsonData, CacheTime).Err()
 		if err != nil {
 			return models.Live{}, fmt.Errorf("error setting live cache: %w", err)
 		}
@@ -144,6 +318,19 @@ func fetchLive(ctx context.Context, liveID string) (models.Live, error) {
 	return live, nil
 }
 
+// queryLive loads a single live from the database, bypassing the cache.
+func queryLive(ctx context.Context, liveID string) (models.Live, error) {
+	live, err := scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+" FROM lives WHERE id = $1", liveID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Live{}, fmt.Errorf("live %s not found: %w", liveID, sql.ErrNoRows)
+		}
+		return models.Live{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	return live, nil
+}
+
 func CreateLive(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -153,31 +340,75 @@ func CreateLive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := validation.ValidateLives(live); err != nil {
-		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	if err := validation.ValidateLives(&live); err != nil {
+		respondValidationError(w, err)
 		return
 	}
 
-	live.ID = uuid.New()
+	// Offline clients pick the ID themselves, which makes retrying safe.
+	if live.ID == uuid.Nil {
+		live.ID = uuid.New()
+	}
 	live.CreatedAt = time.Now()
+	live.Version = 1
 
 	if err := insertLive(ctx, live); err != nil {
+		if isPrimaryKeyViolation(err, "lives") {
+			existing, qErr := queryLive(ctx, live.ID.String())
+			if qErr == nil {
+				fields := liveConflictFields(live, existing)
+				if len(fields) == 0 {
+					// The same create was retried after it had succeeded.
+					middlewares.RespondCreated(w, liveLocation(existing.ID), serializers.FromLive(existing))
+					return
+				}
+				respondConflict(w, ErrIDTaken, 0, existing.Version, serializers.FromLive(existing), fields)
+				return
+			}
+		}
+		if isForeignKeyViolation(err) {
+			respondUnknownSeries(w)
+			return
+		}
 		middlewares.HttpError(w, "Failed to create live", http.StatusInternalServerError, err)
 		return
 	}
 
-	err := db.RedisClient.Del(ctx, "lives").Err()
-	if err != nil {
+	if err := liveCreated(ctx, live); err != nil {
 		middlewares.HttpError(w, "Failed to clear lives cache", http.StatusInternalServerError, err)
 		return
 	}
+	middlewares.RespondCreated(w, liveLocation(live.ID), serializers.FromLive(live))
+}
 
-	middlewares.RespondJSON(w, live, http.StatusCreated)
+// liveCreated clears the cached lists of lives and tells subscribers and
+// webhooks about a new live.
+func liveCreated(ctx context.Context, live models.Live) error {
+	if err := db.DeleteCacheKeys(ctx, livesCacheEntity); err != nil {
+		return err
+	}
+	queueCDNPurge(ctx, surrogateKeyLives)
+
+	events.Publish(ctx, events.TypeLive, events.ActionCreated, live.ID.String())
+	fireLiveWebhook(ctx, "created", live)
+	return nil
+}
+
+// liveLocation is the URL of a live for Location headers.
+func liveLocation(id uuid.UUID) string {
+	return "/lives?id=" + id.String()
 }
 
 func insertLive(ctx context.Context, live models.Live) error {
-	_, err := db.DB.ExecContext(ctx, "INSERT INTO lives (id, title, link, created_at) VALUES ($1, $2, $3, $4)",
-		live.ID, live.Title, live.Link, live.CreatedAt)
+	links, err := json.Marshal(live.Links)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO lives (id, title, links, description, starts_at, ends_at,
+			speaker, series_id, passage, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		live.ID, live.Title, links, live.Description, live.StartsAt, live.EndsAt,
+		live.Speaker, live.SeriesID, live.Passage, live.CreatedAt)
 	return err
 }
 
@@ -201,37 +432,145 @@ func UpdateLive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := validation.ValidateLives(live); err != nil {
-		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	if err := validation.ValidateLives(&live); err != nil {
+		respondValidationError(w, err)
 		return
 	}
 
 	live.ID = id
 
-	if err := updateLive(ctx, live); err != nil {
-		middlewares.HttpError(w, "Failed to update live", http.StatusInternalServerError, err)
+	// A version makes the write conditional: it only applies if nobody else
+	// changed the live since the client read that version.
+	updated, err := updateLive(ctx, live, live.Version)
+	if errors.Is(err, sql.ErrNoRows) && live.Version > 0 {
+		current, err := queryLive(ctx, idStr)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondNotFound(w, "live", "Live not found", idStr, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to update live", http.StatusInternalServerError, err)
+			return
+		}
+		respondConflict(w, ErrVersionConflict, live.Version, current.Version, serializers.FromLive(current), liveConflictFields(live, current))
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "live", "Live not found", idStr, err)
+		return
+	}
+	if isForeignKeyViolation(err) {
+		respondUnknownSeries(w)
 		return
 	}
-
-	err = db.RedisClient.Del(ctx, "live:"+idStr).Err()
 	if err != nil {
-		middlewares.HttpError(w, "Failed to clear live cache", http.StatusInternalServerError, err)
+		middlewares.HttpError(w, "Failed to update live", http.StatusInternalServerError, err)
 		return
 	}
 
-	err = db.RedisClient.Del(ctx, "lives").Err()
-	if err != nil {
+	if err := liveUpdated(ctx, updated); err != nil {
 		middlewares.HttpError(w, "Failed to clear lives cache", http.StatusInternalServerError, err)
 		return
 	}
+	middlewares.RespondJSON(w, serializers.FromLive(updated), http.StatusOK)
+}
 
-	middlewares.RespondJSON(w, live, http.StatusOK)
+// liveUpdated clears the caches of a saved live and tells subscribers and
+// webhooks about the change.
+func liveUpdated(ctx context.Context, live models.Live) error {
+	idStr := live.ID.String()
+	if err := db.DeleteCacheKeys(ctx, livesCacheEntity, idStr); err != nil {
+		return err
+	}
+	queueCDNPurge(ctx, surrogateKeyLives, liveSurrogateKey(idStr))
+
+	events.Publish(ctx, events.TypeLive, events.ActionUpdated, idStr)
+	fireLiveWebhook(ctx, "updated", live)
+	return nil
 }
 
-func updateLive(ctx context.Context, live models.Live) error {
-	_, err := db.DB.ExecContext(ctx, "UPDATE lives SET title=$1, link=$2 WHERE id=$3",
-		live.Title, live.Link, live.ID)
-	return err
+// PatchLive updates only the fields present in the body, see
+// models.LivePatch. Like PatchPost, a patch without a version is retried on
+// top of concurrent changes instead of overwriting them.
+func PatchLive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := r.URL.Query().Get("id")
+	if _, err := uuid.Parse(idStr); err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var patch models.LivePatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		current, err := queryLive(ctx, idStr)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondNotFound(w, "live", "Live not found", idStr, err)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to update live", http.StatusInternalServerError, err)
+			return
+		}
+
+		live := current
+		patch.Apply(&live)
+		if err := validation.ValidateLives(&live); err != nil {
+			respondValidationError(w, err)
+			return
+		}
+
+		expectedVersion := patch.Version
+		if expectedVersion == 0 {
+			expectedVersion = current.Version
+		}
+		updated, err := updateLive(ctx, live, expectedVersion)
+		if errors.Is(err, sql.ErrNoRows) {
+			if patch.Version > 0 {
+				respondConflict(w, ErrVersionConflict, patch.Version, current.Version, serializers.FromLive(current), liveConflictFields(live, current))
+				return
+			}
+			continue
+		}
+		if isForeignKeyViolation(err) {
+			respondUnknownSeries(w)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to update live", http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := liveUpdated(ctx, updated); err != nil {
+			middlewares.HttpError(w, "Failed to clear lives cache", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, serializers.FromLive(updated), http.StatusOK)
+		return
+	}
+	http.Error(w, "The live keeps changing, try again", http.StatusConflict)
+}
+
+// updateLive saves a live and returns it. With a non-zero expectedVersion
+// nothing is written unless the stored version matches; sql.ErrNoRows is
+// returned when no live was updated.
+func updateLive(ctx context.Context, live models.Live, expectedVersion int) (models.Live, error) {
+	links, err := json.Marshal(live.Links)
+	if err != nil {
+		return models.Live{}, err
+	}
+	return scanLive(db.DB.QueryRowContext(ctx, `UPDATE lives SET title = $1, links = $2, description = $3,
+			starts_at = $4, ends_at = $5, speaker = $6, series_id = $7, passage = $8, version = version + 1
+		WHERE id = $9 AND ($10::integer = 0 OR version = $10::integer)
+		RETURNING `+liveColumns,
+		live.Title, links, live.Description, live.StartsAt, live.EndsAt,
+		live.Speaker, live.SeriesID, live.Passage, live.ID, expectedVersion))
 }
 
 func DeleteLive(w http.ResponseWriter, r *http.Request) {
@@ -249,26 +588,32 @@ func DeleteLive(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := deleteLive(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondNotFound(w, "live", "Live not found", idStr, err)
+			return
+		}
 		middlewares.HttpError(w, "Failed to delete live", http.StatusInternalServerError, err)
 		return
 	}
 
-	err = db.RedisClient.Del(ctx, "live:"+idStr).Err()
-	if err != nil {
-		middlewares.HttpError(w, "Failed to clear live cache", http.StatusInternalServerError, err)
-		return
-	}
-
-	err = db.RedisClient.Del(ctx, "lives").Err()
+	err = db.DeleteCacheKeys(ctx, livesCacheEntity, idStr)
 	if err != nil {
 		middlewares.HttpError(w, "Failed to clear lives cache", http.StatusInternalServerError, err)
 		return
 	}
+	queueCDNPurge(ctx, surrogateKeyLives, liveSurrogateKey(idStr))
 
+	events.Publish(ctx, events.TypeLive, events.ActionDeleted, idStr)
+	fireWebhook(ctx, "live.deleted", "Live deleted", map[string]string{"id": idStr})
 	middlewares.RespondJSON(w, map[string]string{"message": "Live deleted"}, http.StatusOK)
 }
 
+// deleteLive deletes a live. sql.ErrNoRows is returned when there is no such
+// live.
 func deleteLive(ctx context.Context, id uuid.UUID) error {
-	_, err := db.DB.ExecContext(ctx, "DELETE FROM lives WHERE id=$1", id)
-	return err
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM lives WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
 }
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+const missingLiveBody = `{"title": "Sunday service", "links": [{"url": "https://www.youtube.com/watch?v=abc"}],
+	"starts_at": "2026-10-18T09:00:00Z", "ends_at": "2026-10-18T11:00:00Z"}`
+
+func TestDeleteLiveReportsMissingRows(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name     string
+		affected int64
+		want     error
+	}{
+		{"missing", 0, sql.ErrNoRows},
+		{"deleted", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM lives WHERE id=$1")).
+				WithArgs(id).
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			if err := deleteLive(context.Background(), id); !errors.Is(err, tt.want) {
+				t.Errorf("deleteLive() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteLiveMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM lives WHERE id=$1")).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder := serve(DeleteLive, http.MethodDelete, "/lives?id="+id.String(), "")
+	assertNotFound(t, recorder, "live", id.String())
+}
+
+func TestUpdateLiveMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE lives SET title = $1")).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	recorder := serve(UpdateLive, http.MethodPut, "/lives?id="+id.String(), missingLiveBody)
+	assertNotFound(t, recorder, "live", id.String())
+}
+
+func TestPatchLiveMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM lives WHERE id = $1")).
+		WithArgs(id.String()).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	recorder := serve(PatchLive, http.MethodPatch, "/lives?id="+id.String(), `{"title": "New title"}`)
+	assertNotFound(t, recorder, "live", id.String())
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func SetupMediaRoutes(r *mux.Router) {
+	// Post images are shown to everyone, so their files are served without a login.
+	r.HandleFunc("/media/images/file", GetPostImageFile).Methods("GET").Queries("id", "{id}")
+
+	mediaRouter := r.PathPrefix("/media").Subrouter()
+	mediaRouter.Use(middlewares.TokenAuthMiddleware)
+	mediaRouter.HandleFunc("/images", GetPostImage).Methods("GET").Queries("id", "{id}")
+	mediaRouter.HandleFunc("/images", GetPostImages).Methods("GET")
+	mediaRouter.Handle("/images", middlewares.StaffOnly(http.HandlerFunc(UploadPostImage))).Methods("POST")
+	mediaRouter.Handle("/images", middlewares.StaffOnly(http.HandlerFunc(DeletePostImage))).Methods("DELETE").Queries("id", "{id}")
+	mediaRouter.HandleFunc("/alt-text", GetAltTextSuggestions).Methods("GET").Queries("media_key", "{media_key}")
+	mediaRouter.Handle("/alt-text", middlewares.StaffOnly(http.HandlerFunc(CreateAltTextSuggestion))).Methods("POST")
+	mediaRouter.Handle("/alt-text", middlewares.StaffOnly(http.HandlerFunc(ReviewAltTextSuggestion))).Methods("PUT").Queries("id", "{id}")
+}
+
+func GetAltTextSuggestions(w http.ResponseWriter, r *http.Request) {
+	suggestions, err := media.ListAltTextSuggestions(r.Context(), r.URL.Query().Get("media_key"))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch alt text suggestions", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, suggestions, http.StatusOK)
+}
+
+// CreateAltTextSuggestion accepts a multipart form with a media_key and an
+// image file and stores the provider's suggestion for editor review.
+func CreateAltTextSuggestion(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadBytes+1<<20)
+	if err := r.ParseMultipartForm(media.MaxUploadBytes); err != nil {
+		middlewares.HttpError(w, "Invalid multipart form", http.StatusBadRequest, err)
+		return
+	}
+
+	mediaKey := r.FormValue("media_key")
+	if mediaKey == "" {
+		http.Error(w, "media_key is required", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		middlewares.HttpError(w, "image file is required", http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadBytes))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to read image", http.StatusBadRequest, err)
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		http.Error(w, "image must be a JPEG or PNG file", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	suggestion, err := media.SuggestAltText(r.Context(), mediaKey, data, contentType)
+	if err != nil {
+		if errors.Is(err, media.ErrAltTextDisabled) {
+			middlewares.HttpError(w, "Alt text suggestions are not enabled", http.StatusServiceUnavailable, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to suggest alt text", http.StatusBadGateway, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, suggestion, http.StatusCreated)
+}
+
+// ReviewAltTextSuggestion lets an editor accept (optionally with edited
+// wording) or reject a suggestion.
+func ReviewAltTextSuggestion(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Status  string `json:"status"`
+		AltText string `json:"alt_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if payload.Status != media.AltTextAccepted && payload.Status != media.AltTextRejected {
+		http.Error(w, "status must be either accepted or rejected", http.StatusBadRequest)
+		return
+	}
+
+	suggestion, err := media.ReviewAltTextSuggestion(r.Context(), id, payload.Status, payload.AltText)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrSuggestionNotFound):
+			middlewares.HttpError(w, "Suggestion not found", http.StatusNotFound, err)
+		case errors.Is(err, media.ErrSuggestionNotPending):
+			middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to review suggestion", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, suggestion, http.StatusOK)
+}
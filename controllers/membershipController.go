@@ -0,0 +1,545 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// defaultStaleDays is how long someone may keep a status before the stale
+// report lists them, e.g. visitors who never came back.
+const defaultStaleDays = 30
+
+var (
+	ErrMembershipUserNotFound = errors.New("user not found")
+	ErrMembershipUnchanged    = errors.New("user already has this status")
+	ErrRequirementCourse      = errors.New("course_ids contains an unknown course")
+)
+
+// MissingCoursesError lists the required courses a user has not completed.
+type MissingCoursesError struct {
+	Courses []string
+}
+
+func (e *MissingCoursesError) Error() string {
+	return "required courses not completed: " + strings.Join(e.Courses, ", ")
+}
+
+// SetupMembershipRoutes registers the membership endpoints. Users see their
+// own status; staff move people between statuses and read the reports.
+func SetupMembershipRoutes(r *mux.Router) {
+	user := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(h)
+	}
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+
+	membershipRouter := r.PathPrefix("/membership").Subrouter()
+	membershipRouter.Handle("/me", user(GetMyMembership)).Methods("GET")
+	membershipRouter.Handle("", staff(GetMembership)).Methods("GET").Queries("user_id", "{user_id}")
+	membershipRouter.Handle("/status", staff(SetMembershipStatus)).Methods("PUT").Queries("user_id", "{user_id}")
+	membershipRouter.Handle("/requirements", staff(GetMembershipRequirements)).Methods("GET")
+	membershipRouter.Handle("/requirements", staff(SetMembershipRequirement)).Methods("PUT")
+	membershipRouter.Handle("/reports/summary", staff(GetMembershipSummary)).Methods("GET")
+	membershipRouter.Handle("/reports/transitions", staff(GetMembershipTransitions)).Methods("GET")
+	membershipRouter.Handle("/reports/stale", staff(GetStaleMemberships)).Methods("GET").Queries("status", "{status}")
+}
+
+// queryMembership returns a user's status with its history.
+func queryMembership(ctx context.Context, userID int64) (models.Membership, error) {
+	membership := models.Membership{History: []models.MembershipTransition{}}
+	err := db.DB.QueryRowContext(ctx, `SELECT u.id, u.username, u.email, COALESCE(m.status, 'visitor'), COALESCE(m.changed_at, u.created_at)
+		FROM users u
+		LEFT JOIN memberships m ON m.user_id = u.id
+		WHERE u.id = $1`, userID).
+		Scan(&membership.UserID, &membership.Username, &membership.Email, &membership.Status, &membership.Since)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Membership{}, ErrMembershipUserNotFound
+	}
+	if err != nil {
+		return models.Membership{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT user_id, from_status, to_status, reason, changed_by, changed_at
+		FROM membership_transitions
+		WHERE user_id = $1
+		ORDER BY changed_at DESC, id DESC`, userID)
+	if err != nil {
+		return models.Membership{}, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.MembershipTransition
+		if err := rows.Scan(&t.UserID, &t.FromStatus, &t.ToStatus, &t.Reason, &t.ChangedBy, &t.ChangedAt); err != nil {
+			return models.Membership{}, fmt.Errorf("error scanning row: %w", err)
+		}
+		membership.History = append(membership.History, t)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Membership{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return membership, nil
+}
+
+func respondMembershipError(w http.ResponseWriter, message string, err error) {
+	var missing *MissingCoursesError
+	switch {
+	case errors.Is(err, ErrMembershipUserNotFound):
+		middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrMembershipUnchanged):
+		middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+	case errors.As(err, &missing):
+		middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+	case errors.Is(err, ErrRequirementCourse):
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// GetMyMembership returns the current user's status and history.
+func GetMyMembership(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	membership, err := queryMembership(ctx, userID)
+	if err != nil {
+		respondMembershipError(w, "Failed to fetch membership", err)
+		return
+	}
+
+	middlewares.RespondJSON(w, membership, http.StatusOK)
+}
+
+// GetMembership returns any user's status and history.
+func GetMembership(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	membership, err := queryMembership(r.Context(), userID)
+	if err != nil {
+		respondMembershipError(w, "Failed to fetch membership", err)
+		return
+	}
+
+	middlewares.RespondJSON(w, membership, http.StatusOK)
+}
+
+// SetMembershipStatus moves a user to another status. Moving to a status
+// with required courses needs every one of them completed.
+func SetMembershipStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateMembershipStatus(payload.Status, payload.Reason); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	staffID, _ := middlewares.UserIDFromContext(ctx)
+	if err := setMembershipStatus(ctx, userID, payload.Status, strings.TrimSpace(payload.Reason), staffID); err != nil {
+		respondMembershipError(w, "Failed to update membership", err)
+		return
+	}
+
+	membership, err := queryMembership(ctx, userID)
+	if err != nil {
+		respondMembershipError(w, "Failed to fetch membership", err)
+		return
+	}
+	middlewares.RespondJSON(w, membership, http.StatusOK)
+}
+
+func setMembershipStatus(ctx context.Context, userID int64, status, reason string, changedBy int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so that concurrent changes apply one after the other.
+	var current string
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(m.status, 'visitor')
+		FROM users u
+		LEFT JOIN memberships m ON m.user_id = u.id
+		WHERE u.id = $1
+		FOR UPDATE OF u`, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMembershipUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	if current == status {
+		return ErrMembershipUnchanged
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT c.title
+		FROM membership_requirements mr
+		JOIN courses c ON c.id = mr.course_id
+		LEFT JOIN enrollments e ON e.course_id = mr.course_id AND e.user_id = $2 AND e.completed_at IS NOT NULL
+		WHERE mr.status = $1 AND e.user_id IS NULL
+		ORDER BY c.title`, status, userID)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	missing := &MissingCoursesError{}
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		missing.Courses = append(missing.Courses, title)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+	if len(missing.Courses) > 0 {
+		return missing
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO memberships (user_id, status) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET status = EXCLUDED.status, changed_at = NOW()`, userID, status)
+	if err != nil {
+		return fmt.Errorf("error updating membership: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO membership_transitions (user_id, from_status, to_status, reason, changed_by)
+		VALUES ($1, $2, $3, $4, $5)`, userID, current, status, reason, changedBy)
+	if err != nil {
+		return fmt.Errorf("error recording membership change: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetMembershipRequirements lists the required courses of every status.
+func GetMembershipRequirements(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT status, course_id FROM membership_requirements ORDER BY status, course_id")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch requirements", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	requirements := []models.MembershipRequirement{}
+	for rows.Next() {
+		var (
+			status   string
+			courseID uuid.UUID
+		)
+		if err := rows.Scan(&status, &courseID); err != nil {
+			middlewares.HttpError(w, "Failed to fetch requirements", http.StatusInternalServerError, err)
+			return
+		}
+		if n := len(requirements); n == 0 || requirements[n-1].Status != status {
+			requirements = append(requirements, models.MembershipRequirement{Status: status})
+		}
+		last := &requirements[len(requirements)-1]
+		last.CourseIDs = append(last.CourseIDs, courseID)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch requirements", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, requirements, http.StatusOK)
+}
+
+// SetMembershipRequirement replaces the required courses of a status. It
+// applies to future changes; nobody loses a status they already have.
+func SetMembershipRequirement(w http.ResponseWriter, r *http.Request) {
+	var requirement models.MembershipRequirement
+	if err := json.NewDecoder(r.Body).Decode(&requirement); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateMembershipStatus(requirement.Status, ""); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if requirement.CourseIDs == nil {
+		requirement.CourseIDs = []uuid.UUID{}
+	}
+
+	if err := setMembershipRequirement(r.Context(), requirement); err != nil {
+		respondMembershipError(w, "Failed to update requirements", err)
+		return
+	}
+	middlewares.RespondJSON(w, requirement, http.StatusOK)
+}
+
+func setMembershipRequirement(ctx context.Context, requirement models.MembershipRequirement) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM membership_requirements WHERE status = $1", requirement.Status); err != nil {
+		return fmt.Errorf("error updating requirements: %w", err)
+	}
+	ids := make([]string, len(requirement.CourseIDs))
+	for i, id := range requirement.CourseIDs {
+		ids[i] = id.String()
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO membership_requirements (status, course_id)
+		SELECT DISTINCT $1, id FROM unnest($2::uuid[]) AS id`, requirement.Status, pq.Array(ids))
+	if isForeignKeyViolation(err) {
+		return ErrRequirementCourse
+	}
+	if err != nil {
+		return fmt.Errorf("error updating requirements: %w", err)
+	}
+	return tx.Commit()
+}
+
+// membershipPeriod reads ?from= and ?to=, by default the last 30 days.
+func membershipPeriod(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	from, err := parseListTime(query.Get("from"), false)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be a date or an RFC 3339 time")
+	}
+	to, err := parseListTime(query.Get("to"), true)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be a date or an RFC 3339 time")
+	}
+	end := time.Now().UTC()
+	if to != nil {
+		end = *to
+	}
+	start := end.AddDate(0, 0, -30)
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return start, end, nil
+}
+
+// GetMembershipSummary counts users by status and the status changes in a
+// period, keyed "<from>-><to>".
+func GetMembershipSummary(w http.ResponseWriter, r *http.Request) {
+	from, to, err := membershipPeriod(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	summary := models.MembershipSummary{Counts: map[string]int{}, Transitions: map[string]int{}, From: from, To: to}
+	for status := range validation.MembershipStatuses {
+		summary.Counts[status] = 0
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT COALESCE(m.status, 'visitor'), COUNT(*)
+		FROM users u
+		LEFT JOIN memberships m ON m.user_id = u.id
+		GROUP BY 1`)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+			return
+		}
+		summary.Counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+		return
+	}
+
+	transitions, err := db.DB.QueryContext(ctx, `SELECT from_status || '->' || to_status, COUNT(*)
+		FROM membership_transitions
+		WHERE changed_at >= $1 AND changed_at < $2
+		GROUP BY 1`, from, to)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+		return
+	}
+	defer transitions.Close()
+	for transitions.Next() {
+		var (
+			change string
+			count  int
+		)
+		if err := transitions.Scan(&change, &count); err != nil {
+			middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+			return
+		}
+		summary.Transitions[change] = count
+	}
+	if err := transitions.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership summary", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, summary, http.StatusOK)
+}
+
+// GetMembershipTransitions lists the status changes in a period, newest
+// first, optionally only those to ?to_status=, e.g. everyone who became
+// inactive this month.
+func GetMembershipTransitions(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	from, to, err := membershipPeriod(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	toStatus := r.URL.Query().Get("to_status")
+
+	ctx := r.Context()
+	const filter = `t.changed_at >= $1 AND t.changed_at < $2 AND ($3 = '' OR t.to_status = $3)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM membership_transitions t WHERE "+filter, from, to, toStatus).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership changes", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT t.user_id, u.username, t.from_status, t.to_status, t.reason, t.changed_by, t.changed_at
+		FROM membership_transitions t
+		JOIN users u ON u.id = t.user_id
+		WHERE `+filter+`
+		ORDER BY t.changed_at DESC, t.id DESC
+		LIMIT $4 OFFSET $5`, from, to, toStatus, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership changes", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	changes := []models.MembershipTransition{}
+	for rows.Next() {
+		var t models.MembershipTransition
+		if err := rows.Scan(&t.UserID, &t.Username, &t.FromStatus, &t.ToStatus, &t.Reason, &t.ChangedBy, &t.ChangedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch membership changes", http.StatusInternalServerError, err)
+			return
+		}
+		changes = append(changes, t)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch membership changes", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.MembershipTransition]{
+		Items:   changes,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetStaleMemberships lists users who have had a status for longer than
+// ?days= (30 by default), longest first: visitors nobody followed up with,
+// or inactive members to reach out to.
+func GetStaleMemberships(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if err := validation.ValidateMembershipStatus(status, ""); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	days := defaultStaleDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 3650 {
+			http.Error(w, "days must be between 1 and 3650", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	const stale = `SELECT u.id, u.username, u.email, COALESCE(m.status, 'visitor') AS status, COALESCE(m.changed_at, u.created_at) AS since
+		FROM users u
+		LEFT JOIN memberships m ON m.user_id = u.id`
+	const filter = `status = $1 AND since < NOW() - $2 * INTERVAL '1 day'`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+stale+") s WHERE "+filter, status, days).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch memberships", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT * FROM ("+stale+") s WHERE "+filter+`
+		ORDER BY since, id
+		LIMIT $3 OFFSET $4`, status, days, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch memberships", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	memberships := []models.Membership{}
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Email, &m.Status, &m.Since); err != nil {
+			middlewares.HttpError(w, "Failed to fetch memberships", http.StatusInternalServerError, err)
+			return
+		}
+		memberships = append(memberships, m)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch memberships", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.Membership]{
+		Items:   memberships,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
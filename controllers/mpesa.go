@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultMpesaAPIURL = "https://api.safaricom.co.ke"
+	// mpesaQueryDelay is how long a prompt is left to the callback before
+	// the payment is looked up. Prompts expire on the phone after a minute.
+	mpesaQueryDelay = 90 * time.Second
+	// mpesaPendingTimeout is when a payment M-Pesa has no result for is
+	// given up on. A late callback still completes the gift.
+	mpesaPendingTimeout = 15 * time.Minute
+	// paymentStartTimeout is when a gift whose payment was never started,
+	// because the process stopped midway, is marked failed.
+	paymentStartTimeout = 10 * time.Minute
+	// pendingDonationBatch caps the payments looked up per run; Daraja
+	// rate-limits the query API.
+	pendingDonationBatch = 20
+)
+
+var (
+	ErrMpesaPending = errors.New("M-Pesa is still processing the payment")
+
+	// eastAfricaTime is the zone of Daraja timestamps. Kenya has no DST.
+	eastAfricaTime = time.FixedZone("EAT", 3*60*60)
+	digitsRegex    = regexp.MustCompile(`^[0-9]{5,7}$`)
+)
+
+// MpesaConfig configures giving through M-Pesa STK Push on the Daraja API.
+type MpesaConfig struct {
+	// ConsumerKey is "" when M-Pesa is off.
+	ConsumerKey    string
+	ConsumerSecret string
+	// ShortCode is the paybill, or the store number of a till, and PassKey
+	// its Lipa Na M-Pesa Online pass key.
+	ShortCode string
+	PassKey   string
+	// TillNumber is set when gifts are paid to a Buy Goods till.
+	TillNumber string
+	// CallbackURL is where Daraja reports payments. Its query carries the
+	// callback token, as Daraja does not sign callbacks.
+	CallbackURL   string
+	CallbackToken string
+	APIURL        string
+}
+
+var (
+	mpesaConfig     *MpesaConfig
+	mpesaConfigOnce sync.Once
+	mpesaClient     = &http.Client{Timeout: 30 * time.Second}
+
+	mpesaTokenMu      sync.Mutex
+	mpesaToken        string
+	mpesaTokenExpires time.Time
+)
+
+// LoadMpesaConfig reads MPESA_CONSUMER_KEY with MPESA_CONSUMER_SECRET,
+// MPESA_SHORTCODE, MPESA_PASSKEY, MPESA_CALLBACK_BASE_URL (the public URL of
+// this API) and MPESA_CALLBACK_TOKEN, and optionally MPESA_TILL_NUMBER and
+// MPESA_API_URL, e.g. https://sandbox.safaricom.co.ke for testing.
+func LoadMpesaConfig() (*MpesaConfig, error) {
+	config := &MpesaConfig{
+		ConsumerKey:    os.Getenv("MPESA_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("MPESA_CONSUMER_SECRET"),
+		ShortCode:      os.Getenv("MPESA_SHORTCODE"),
+		PassKey:        os.Getenv("MPESA_PASSKEY"),
+		TillNumber:     os.Getenv("MPESA_TILL_NUMBER"),
+		CallbackToken:  os.Getenv("MPESA_CALLBACK_TOKEN"),
+		APIURL:         strings.TrimSuffix(os.Getenv("MPESA_API_URL"), "/"),
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultMpesaAPIURL
+	}
+	parsed, err := url.Parse(config.APIURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("MPESA_API_URL must be an http(s) URL")
+	}
+	if config.ConsumerKey == "" {
+		return config, nil
+	}
+	if config.ConsumerSecret == "" || config.PassKey == "" {
+		return nil, errors.New("MPESA_CONSUMER_SECRET and MPESA_PASSKEY are required with MPESA_CONSUMER_KEY")
+	}
+	if !digitsRegex.MatchString(config.ShortCode) {
+		return nil, errors.New("MPESA_SHORTCODE must be a paybill or store number")
+	}
+	if config.TillNumber != "" && !digitsRegex.MatchString(config.TillNumber) {
+		return nil, errors.New("MPESA_TILL_NUMBER must be a till number")
+	}
+	if len(config.CallbackToken) < 32 {
+		return nil, errors.New("MPESA_CALLBACK_TOKEN must be at least 32 characters")
+	}
+	base := strings.TrimSuffix(os.Getenv("MPESA_CALLBACK_BASE_URL"), "/")
+	parsed, err = url.Parse(base)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, errors.New("MPESA_CALLBACK_BASE_URL must be an https URL")
+	}
+	config.CallbackURL = base + PaymentWebhookPrefix + "mpesa?" + url.Values{"token": {config.CallbackToken}}.Encode()
+	return config, nil
+}
+
+func mpesa() *MpesaConfig {
+	mpesaConfigOnce.Do(func() {
+		config, err := LoadMpesaConfig()
+		if err != nil {
+			log.Printf("M-Pesa integration disabled: %v", err)
+			config = &MpesaConfig{}
+		}
+		mpesaConfig = config
+	})
+	return mpesaConfig
+}
+
+// mpesaAccessToken returns an OAuth token for the Daraja API, reusing it
+// until shortly before it expires.
+func mpesaAccessToken(ctx context.Context) (string, error) {
+	mpesaTokenMu.Lock()
+	defer mpesaTokenMu.Unlock()
+	if mpesaToken != "" && time.Now().Before(mpesaTokenExpires) {
+		return mpesaToken, nil
+	}
+
+	config := mpesa()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.APIURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(config.ConsumerKey, config.ConsumerSecret)
+	resp, err := mpesaClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting M-Pesa token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("M-Pesa token request returned %s: %s", resp.Status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error decoding M-Pesa token: %w", err)
+	}
+	seconds, err := strconv.Atoi(token.ExpiresIn)
+	if err != nil || token.AccessToken == "" {
+		return "", errors.New("M-Pesa returned an invalid token")
+	}
+	mpesaToken = token.AccessToken
+	mpesaTokenExpires = time.Now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	return mpesaToken, nil
+}
+
+// mpesaPost calls a Daraja API and decodes the response into out. Errors
+// Daraja describes are returned with their code.
+func mpesaPost(ctx context.Context, path string, body, out any) error {
+	token, err := mpesaAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mpesa().APIURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := mpesaClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling M-Pesa %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure) == nil && failure.ErrorCode != "" {
+			if failure.ErrorCode == "500.001.1001" {
+				return ErrMpesaPending
+			}
+			return fmt.Errorf("M-Pesa %s returned %s: %s", path, failure.ErrorCode, failure.ErrorMessage)
+		}
+		return fmt.Errorf("M-Pesa %s returned %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding M-Pesa %s response: %w", path, err)
+	}
+	return nil
+}
+
+// mpesaPassword signs a Daraja request with the pass key.
+func mpesaPassword(config *MpesaConfig, timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(config.ShortCode + config.PassKey + timestamp))
+}
+
+// mpesaProvider takes M-Pesa payments by STK Push.
+type mpesaProvider struct{}
+
+func (mpesaProvider) Enabled() bool    { return mpesa().ConsumerKey != "" }
+func (mpesaProvider) Method() string   { return "mpesa" }
+func (mpesaProvider) Currency() string { return "KES" }
+
+// Start sends an STK Push to the donor's phone, which asks them to enter
+// their M-Pesa PIN to pay the gift.
+func (mpesaProvider) Start(ctx context.Context, donationID uuid.UUID, request models.DonationIntentRequest) (models.DonationIntent, error) {
+	config := mpesa()
+	timestamp := time.Now().In(eastAfricaTime).Format("20060102150405")
+	transactionType, partyB := "CustomerPayBillOnline", config.ShortCode
+	if config.TillNumber != "" {
+		transactionType, partyB = "CustomerBuyGoodsOnline", config.TillNumber
+	}
+
+	var response struct {
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+		ResponseCode      string `json:"ResponseCode"`
+		ResponseDesc      string `json:"ResponseDescription"`
+		CustomerMessage   string `json:"CustomerMessage"`
+	}
+	err := mpesaPost(ctx, "/mpesa/stkpush/v1/processrequest", map[string]any{
+		"BusinessShortCode": config.ShortCode,
+		"Password":          mpesaPassword(config, timestamp),
+		"Timestamp":         timestamp,
+		"TransactionType":   transactionType,
+		"Amount":            request.AmountCents / 100,
+		"PartyA":            request.Phone,
+		"PartyB":            partyB,
+		"PhoneNumber":       request.Phone,
+		"CallBackURL":       config.CallbackURL,
+		// The account reference is shown to the donor and limited to 12
+		// characters.
+		"AccountReference": strings.ToUpper(request.Fund),
+		"TransactionDesc":  "Gift " + donationID.String()[:8],
+	}, &response)
+	if err != nil {
+		return models.DonationIntent{}, err
+	}
+	if response.ResponseCode != "0" || response.CheckoutRequestID == "" {
+		return models.DonationIntent{}, fmt.Errorf("M-Pesa declined the request: %s", response.ResponseDesc)
+	}
+	return models.DonationIntent{Reference: response.CheckoutRequestID, Message: response.CustomerMessage}, nil
+}
+
+// queryMpesaPayment looks up the result of an STK Push. It returns
+// ErrMpesaPending while the donor has not answered the prompt.
+func queryMpesaPayment(ctx context.Context, checkoutRequestID string) (string, error) {
+	config := mpesa()
+	timestamp := time.Now().In(eastAfricaTime).Format("20060102150405")
+	var response struct {
+		ResultCode string `json:"ResultCode"`
+	}
+	err := mpesaPost(ctx, "/mpesa/stkpushquery/v1/query", map[string]string{
+		"BusinessShortCode": config.ShortCode,
+		"Password":          mpesaPassword(config, timestamp),
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": checkoutRequestID,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	if response.ResultCode == "" {
+		return "", ErrMpesaPending
+	}
+	return response.ResultCode, nil
+}
+
+// mpesaCallback is the result of an STK Push as Daraja posts it.
+type mpesaCallback struct {
+	Body struct {
+		StkCallback struct {
+			CheckoutRequestID string `json:"CheckoutRequestID"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []struct {
+					Name  string          `json:"Name"`
+					Value json.RawMessage `json:"Value"`
+				} `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+}
+
+// item returns the metadata item name as text, or "".
+func (c mpesaCallback) item(name string) string {
+	for _, item := range c.Body.StkCallback.CallbackMetadata.Item {
+		if item.Name != name {
+			continue
+		}
+		var text string
+		if json.Unmarshal(item.Value, &text) == nil {
+			return text
+		}
+		var number json.Number
+		decoder := json.NewDecoder(bytes.NewReader(item.Value))
+		decoder.UseNumber()
+		if decoder.Decode(&number) == nil {
+			return number.String()
+		}
+	}
+	return ""
+}
+
+// HandleMpesaCallback records the result of an STK Push. Daraja does not
+// sign callbacks, so the callback URL carries a secret token. Callbacks
+// are acknowledged once recorded; repeats change nothing.
+func HandleMpesaCallback(w http.ResponseWriter, r *http.Request) {
+	config := mpesa()
+	token := mux.Vars(r)["token"]
+	if config.ConsumerKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.CallbackToken)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	var callback mpesaCallback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPaymentWebhookBytes)).Decode(&callback); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	result := callback.Body.StkCallback
+	if result.CheckoutRequestID == "" {
+		http.Error(w, "CheckoutRequestID is required", http.StatusBadRequest)
+		return
+	}
+
+	status, givenAt, receipt := models.DonationStatusFailed, time.Now(), (*string)(nil)
+	if result.ResultCode == 0 {
+		status = models.DonationStatusCompleted
+		if number := callback.item("MpesaReceiptNumber"); number != "" {
+			receipt = &number
+		}
+		if t, err := time.ParseInLocation("20060102150405", callback.item("TransactionDate"), eastAfricaTime); err == nil {
+			givenAt = t
+		}
+	}
+
+	ctx := r.Context()
+	changed, err := setDonationStatus(ctx, models.PaymentProviderMpesa, result.CheckoutRequestID, status, givenAt, receipt)
+	if err == nil && !changed && receipt != nil {
+		// The gift may have been completed by a lookup, which has no receipt.
+		changed, err = addMpesaReceipt(ctx, result.CheckoutRequestID, *receipt)
+	}
+	if isUniqueViolation(err) {
+		// The receipt is already recorded against another gift.
+		log.Printf("M-Pesa receipt %s of %s is already recorded", *receipt, result.CheckoutRequestID)
+		err = nil
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to record payment", http.StatusInternalServerError, err)
+		return
+	}
+	if changed {
+		log.Printf("M-Pesa payment %s is %s: %s", result.CheckoutRequestID, status, result.ResultDesc)
+	} else if receipt != nil {
+		// Kept in the log so the treasurer can reconcile it by hand.
+		log.Printf("M-Pesa receipt %s of %s matched no pending gift", *receipt, result.CheckoutRequestID)
+	}
+	middlewares.RespondJSON(w, map[string]any{"ResultCode": 0, "ResultDesc": "Accepted"}, http.StatusOK)
+}
+
+// addMpesaReceipt records the receipt of a completed gift that has none.
+func addMpesaReceipt(ctx context.Context, checkoutRequestID, receipt string) (bool, error) {
+	result, err := db.DB.ExecContext(ctx, `UPDATE donations SET receipt = $3
+		WHERE provider = $1 AND reference = $2 AND status = $4 AND receipt IS NULL`,
+		models.PaymentProviderMpesa, checkoutRequestID, receipt, models.DonationStatusCompleted)
+	if err != nil {
+		return false, fmt.Errorf("error updating donation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reading affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReconcilePendingDonations is the periodic job that settles online gifts
+// whose provider never reported back. M-Pesa payments without a callback
+// are looked up, and given up on after mpesaPendingTimeout; PayPal orders
+// that were never captured fail after payPalOrderTimeout, and gifts whose
+// payment was never started are marked failed.
+func ReconcilePendingDonations(ctx context.Context) error {
+	now := time.Now().UTC()
+	_, err := db.DB.ExecContext(ctx, `UPDATE donations SET status = $1
+		WHERE status = $2 AND provider IS NOT NULL AND reference IS NULL AND recorded_at < $3`,
+		models.DonationStatusFailed, models.DonationStatusPending, now.Add(-paymentStartTimeout))
+	if err != nil {
+		return fmt.Errorf("error failing unstarted donations: %w", err)
+	}
+	_, err = db.DB.ExecContext(ctx, `UPDATE donations SET status = $1
+		WHERE status = $2 AND provider = $3 AND reference IS NOT NULL AND recorded_at < $4`,
+		models.DonationStatusFailed, models.DonationStatusPending, models.PaymentProviderPayPal, now.Add(-payPalOrderTimeout))
+	if err != nil {
+		return fmt.Errorf("error failing uncaptured PayPal donations: %w", err)
+	}
+	if mpesa().ConsumerKey == "" {
+		return nil
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT reference, recorded_at FROM donations
+		WHERE status = $1 AND provider = $2 AND reference IS NOT NULL AND recorded_at < $3
+		ORDER BY recorded_at
+		LIMIT $4`, models.DonationStatusPending, models.PaymentProviderMpesa, now.Add(-mpesaQueryDelay), pendingDonationBatch)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+	type pending struct {
+		reference  string
+		recordedAt time.Time
+	}
+	var payments []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.reference, &p.recordedAt); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, payment := range payments {
+		status := models.DonationStatusFailed
+		resultCode, err := queryMpesaPayment(ctx, payment.reference)
+		switch {
+		case err == nil && resultCode == "0":
+			status = models.DonationStatusCompleted
+		case err != nil && now.Sub(payment.recordedAt) < mpesaPendingTimeout:
+			if !errors.Is(err, ErrMpesaPending) {
+				log.Printf("Failed to look up M-Pesa payment %s: %v", payment.reference, err)
+			}
+			continue
+		}
+		// The query result carries no receipt; a late callback adds it.
+		if _, err := setDonationStatus(ctx, models.PaymentProviderMpesa, payment.reference, status, now, nil); err != nil {
+			return err
+		}
+		log.Printf("M-Pesa payment %s reconciled as %s", payment.reference, status)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"jsmi-api/middlewares"
+	"log"
+	"net/http"
+)
+
+// notFoundResponse is the body of a 404 for a resource that does not exist.
+type notFoundResponse struct {
+	Error    string `json:"error"`
+	Code     string `json:"code"`
+	Resource string `json:"resource"`
+	ID       string `json:"id"`
+}
+
+// respondNotFound answers a request for a missing resource, such as an update
+// or delete of an ID that does not exist, with 404 and a JSON body naming
+// the resource and ID.
+func respondNotFound(w http.ResponseWriter, resource, message, id string, err error) {
+	log.Printf("HTTP %d - %s: %v", http.StatusNotFound, message, err)
+	middlewares.RespondJSON(w, notFoundResponse{
+		Error:    message,
+		Code:     "not_found",
+		Resource: resource,
+		ID:       id,
+	}, http.StatusNotFound)
+}
+
+// requireAffected turns a write that matched no rows into sql.ErrNoRows, the
+// error a query for a missing row returns.
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error reading affected rows: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"jsmi-api/db"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// mockDB replaces db.DB with a mock for the duration of the test and checks
+// that every expected statement ran.
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet database expectations: %v", err)
+		}
+	})
+	return mock
+}
+
+// serve calls handler with a request and returns the recorded response.
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+// assertNotFound checks that a response is the structured 404 of
+// respondNotFound for resource and id.
+func assertNotFound(t *testing.T, recorder *httptest.ResponseRecorder, resource, id string) {
+	t.Helper()
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d; body: %s", recorder.Code, http.StatusNotFound, recorder.Body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	var body notFoundResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v; body: %s", err, recorder.Body)
+	}
+	if body.Code != "not_found" || body.Resource != resource || body.ID != id || body.Error == "" {
+		t.Errorf("body = %+v, want code not_found for %s %s", body, resource, id)
+	}
+}
+
+func TestRequireAffected(t *testing.T) {
+	tests := []struct {
+		name   string
+		result sql.Result
+		want   error
+	}{
+		{"no rows", sqlmock.NewResult(0, 0), sql.ErrNoRows},
+		{"one row", sqlmock.NewResult(0, 1), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := requireAffected(tt.result); !errors.Is(err, tt.want) {
+				t.Errorf("requireAffected() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	failing := sqlmock.NewErrorResult(errors.New("driver error"))
+	if err := requireAffected(failing); err == nil || errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("requireAffected() = %v, want the driver error", err)
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// openGraphDescriptionLength is where descriptions are cut; unfurlers show
+// about two lines.
+const openGraphDescriptionLength = 200
+
+func SetupOpenGraphRoutes(r *mux.Router) {
+	r.HandleFunc("/og", GetOpenGraph).Methods("GET").Queries("type", "{type}", "id", "{id}")
+}
+
+// siteURL is the public website, e.g. https://www.example.org, from SITE_URL.
+// Without it, previews carry paths instead of absolute URLs.
+func siteURL() string {
+	return strings.TrimSuffix(os.Getenv("SITE_URL"), "/")
+}
+
+// GetOpenGraph returns the social preview of a published post, a live or a
+// series (?type=post|live|series&id=), so that server-side rendering and link
+// unfurlers show the same title, description, image and URL. The site's logo
+// stands in for resources without an image.
+func GetOpenGraph(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	id, err := uuid.Parse(query.Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	config, err := fetchPublicConfig(ctx)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to load public configuration", http.StatusInternalServerError, err)
+		return
+	}
+
+	var (
+		preview      models.OpenGraph
+		surrogateKey string
+	)
+	switch query.Get("type") {
+	case "post":
+		preview, err = postOpenGraph(ctx, id)
+		surrogateKey = postSurrogateKey(id.String())
+	case "live":
+		preview, err = liveOpenGraph(ctx, id)
+		surrogateKey = liveSurrogateKey(id.String())
+	case "series":
+		preview, err = seriesOpenGraph(ctx, id)
+		surrogateKey = seriesSurrogateKey(id.String())
+	default:
+		http.Error(w, "type must be post, live or series", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrSeriesNotFound) {
+		middlewares.HttpError(w, "Not found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build preview", http.StatusInternalServerError, err)
+		return
+	}
+
+	preview.SiteName = config.Branding.Name
+	if preview.Description == "" {
+		preview.Description = config.Branding.Tagline
+	}
+	preview.Description = truncateDescription(preview.Description, openGraphDescriptionLength)
+	card := "summary_large_image"
+	if preview.Image == "" {
+		preview.Image = config.Branding.LogoURL
+		card = "summary"
+	}
+	preview.Twitter = models.TwitterCard{
+		Card:        card,
+		Title:       preview.Title,
+		Description: preview.Description,
+		Image:       preview.Image,
+	}
+
+	setSurrogateKeys(w, surrogateKey)
+	middlewares.RespondJSON(w, preview, http.StatusOK)
+}
+
+// postOpenGraph prefers the post's SEO fields over its title and excerpt.
+func postOpenGraph(ctx context.Context, id uuid.UUID) (models.OpenGraph, error) {
+	post, err := fetchPost(ctx, id.String())
+	if err != nil {
+		return models.OpenGraph{}, err
+	}
+	preview := models.OpenGraph{
+		Type:          "article",
+		Title:         cmp.Or(post.MetaTitle, post.Title),
+		Description:   cmp.Or(post.MetaDescription, post.Excerpt),
+		Image:         post.CoverImageURL,
+		URL:           cmp.Or(post.CanonicalURL, siteURL()+"/posts/"+post.Slug),
+		PublishedTime: post.PublishedAt,
+	}
+	if !post.UpdatedAt.IsZero() {
+		preview.ModifiedTime = &post.UpdatedAt
+	}
+	return preview, nil
+}
+
+func liveOpenGraph(ctx context.Context, id uuid.UUID) (models.OpenGraph, error) {
+	live, err := fetchLive(ctx, id.String())
+	if err != nil {
+		return models.OpenGraph{}, err
+	}
+	return models.OpenGraph{
+		Type:        "video.other",
+		Title:       live.Title,
+		Description: live.Description,
+		URL:         siteURL() + "/lives/" + live.ID.String(),
+	}, nil
+}
+
+func seriesOpenGraph(ctx context.Context, id uuid.UUID) (models.OpenGraph, error) {
+	series, err := querySeries(ctx, id)
+	if err != nil {
+		return models.OpenGraph{}, err
+	}
+	return models.OpenGraph{
+		Type:        "website",
+		Title:       series.Title,
+		Description: series.Description,
+		URL:         siteURL() + "/series/" + series.ID.String(),
+	}, nil
+}
+
+// truncateDescription cuts text to at most limit characters at a word
+// boundary, marking the cut with an ellipsis.
+func truncateDescription(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	cut := string([]rune(text)[:limit-1])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
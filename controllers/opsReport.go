@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/metrics"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	emailOpsReport = "operations_report"
+	// opsReportDays is the period of the weekly report.
+	opsReportDays = 7
+	// opsReportEndpoints is how many endpoints each ranking lists.
+	opsReportEndpoints = 10
+	// minRankedRequests keeps endpoints with a handful of requests out of the
+	// rankings, where one slow or failed request would top them.
+	minRankedRequests = 20
+)
+
+// JobQueueStats is the state of the background job queue.
+type JobQueueStats struct {
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+	// FailedInPeriod counts jobs that gave up during the report's period.
+	FailedInPeriod int `json:"failed_in_period"`
+	// OldestQueuedSeconds is how long the oldest due job has waited.
+	OldestQueuedSeconds int64 `json:"oldest_queued_seconds"`
+}
+
+// OpsReport is the API health over a period.
+type OpsReport struct {
+	GeneratedAt      time.Time          `json:"generated_at"`
+	Traffic          metrics.Summary    `json:"traffic"`
+	SlowestEndpoints []metrics.Endpoint `json:"slowest_endpoints"`
+	FailingEndpoints []metrics.Endpoint `json:"failing_endpoints"`
+	JobQueue         JobQueueStats      `json:"job_queue"`
+}
+
+// LoadOpsReportRecipients returns OPS_REPORT_RECIPIENTS, the comma-separated
+// addresses of the maintainers who get the weekly operations report. When
+// it is not set, the report goes to active admins.
+func LoadOpsReportRecipients() ([]string, error) {
+	var recipients []string
+	for _, address := range strings.Split(os.Getenv("OPS_REPORT_RECIPIENTS"), ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if err := validation.ValidateEmail(address); err != nil {
+			return nil, fmt.Errorf("OPS_REPORT_RECIPIENTS: %q is not a valid email address", address)
+		}
+		recipients = append(recipients, address)
+	}
+	return recipients, nil
+}
+
+// RunOpsReport is the weekly job that emails the operations report of the
+// last seven full days to the maintainers.
+func RunOpsReport(ctx context.Context) error {
+	recipients, err := LoadOpsReportRecipients()
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		if recipients, err = queryAdminEmails(ctx); err != nil {
+			return err
+		}
+	}
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	report, err := buildOpsReport(ctx, yesterday, opsReportDays)
+	if err != nil {
+		return err
+	}
+
+	data := newOpsReportEmailData(report)
+	for _, email := range recipients {
+		if err := mailer.SendTemplate(emailOpsReport, email, data); err != nil {
+			log.Printf("Failed to queue operations report for %s: %v", email, err)
+		}
+	}
+	return nil
+}
+
+func queryAdminEmails(ctx context.Context) ([]string, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT email FROM users WHERE role = $1 AND status = $2",
+		middlewares.RoleAdmin, models.UserStatusActive)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return emails, nil
+}
+
+// buildOpsReport reports on the days days up to and including the day of to.
+func buildOpsReport(ctx context.Context, to time.Time, days int) (*OpsReport, error) {
+	traffic, err := metrics.Summarize(ctx, to, days)
+	if err != nil {
+		return nil, err
+	}
+	report := &OpsReport{GeneratedAt: time.Now(), Traffic: traffic}
+
+	var ranked []metrics.Endpoint
+	for _, endpoint := range traffic.Endpoints {
+		if endpoint.Requests >= minRankedRequests {
+			ranked = append(ranked, endpoint)
+		}
+	}
+	report.SlowestEndpoints = topEndpoints(ranked, func(a, b metrics.Endpoint) bool { return a.AverageMs > b.AverageMs },
+		func(e metrics.Endpoint) bool { return e.AverageMs > 0 })
+	report.FailingEndpoints = topEndpoints(ranked, func(a, b metrics.Endpoint) bool { return a.ErrorRate > b.ErrorRate },
+		func(e metrics.Endpoint) bool { return e.Errors > 0 })
+
+	err = db.DB.QueryRowContext(ctx, `SELECT
+			COUNT(*) FILTER (WHERE status = 'queued'),
+			COUNT(*) FILTER (WHERE status = 'running'),
+			COUNT(*) FILTER (WHERE status = 'failed' AND updated_at >= $1),
+			COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(run_at) FILTER (WHERE status = 'queued' AND run_at <= NOW())), 0)::bigint
+		FROM jobs`, traffic.From).
+		Scan(&report.JobQueue.Queued, &report.JobQueue.Running, &report.JobQueue.FailedInPeriod, &report.JobQueue.OldestQueuedSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	return report, nil
+}
+
+// topEndpoints returns the first opsReportEndpoints endpoints that match
+// keep, ordered by before.
+func topEndpoints(endpoints []metrics.Endpoint, before func(a, b metrics.Endpoint) bool, keep func(metrics.Endpoint) bool) []metrics.Endpoint {
+	sorted := slices.Clone(endpoints)
+	slices.SortStableFunc(sorted, func(a, b metrics.Endpoint) int {
+		switch {
+		case before(a, b):
+			return -1
+		case before(b, a):
+			return 1
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	top := []metrics.Endpoint{}
+	for _, endpoint := range sorted {
+		if len(top) == opsReportEndpoints {
+			break
+		}
+		if keep(endpoint) {
+			top = append(top, endpoint)
+		}
+	}
+	return top
+}
+
+type opsReportEndpointLine struct {
+	Route    string
+	Requests int64
+	Average  string
+	Errors   int64
+	Rate     string
+}
+
+// opsReportEmailData is the data available to the operations_report
+// template; numbers are formatted for reading.
+type opsReportEmailData struct {
+	From             string
+	To               string
+	Requests         int64
+	Errors           int64
+	ErrorRate        string
+	RateLimited      int64
+	CacheHitRatio    string
+	CacheLookups     int64
+	SlowestEndpoints []opsReportEndpointLine
+	FailingEndpoints []opsReportEndpointLine
+	JobQueue         JobQueueStats
+	OldestQueued     string
+}
+
+func newOpsReportEmailData(report *OpsReport) opsReportEmailData {
+	percent := func(ratio float64) string { return strconv.FormatFloat(ratio*100, 'f', 2, 64) + "%" }
+	lines := func(endpoints []metrics.Endpoint) []opsReportEndpointLine {
+		result := make([]opsReportEndpointLine, len(endpoints))
+		for i, e := range endpoints {
+			result[i] = opsReportEndpointLine{
+				Route:    e.Route,
+				Requests: e.Requests,
+				Average:  strconv.FormatFloat(e.AverageMs, 'f', 0, 64) + " ms",
+				Errors:   e.Errors,
+				Rate:     percent(e.ErrorRate),
+			}
+		}
+		return result
+	}
+
+	traffic := report.Traffic
+	return opsReportEmailData{
+		From:             traffic.From.Format("2 Jan 2006"),
+		To:               traffic.To.Format("2 Jan 2006"),
+		Requests:         traffic.Requests,
+		Errors:           traffic.Errors,
+		ErrorRate:        percent(traffic.ErrorRate),
+		RateLimited:      traffic.RateLimited,
+		CacheHitRatio:    percent(traffic.CacheHitRatio),
+		CacheLookups:     traffic.CacheHits + traffic.CacheMisses,
+		SlowestEndpoints: lines(report.SlowestEndpoints),
+		FailingEndpoints: lines(report.FailingEndpoints),
+		JobQueue:         report.JobQueue,
+		OldestQueued:     (time.Duration(report.JobQueue.OldestQueuedSeconds) * time.Second).String(),
+	}
+}
+
+// GetOpsReport builds the operations report of the last ?days= days (7 by
+// default, at most 14) including today, without emailing it.
+func GetOpsReport(w http.ResponseWriter, r *http.Request) {
+	days := opsReportDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > 14 {
+			http.Error(w, "days must be between 1 and 14", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := buildOpsReport(r.Context(), time.Now(), days)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build operations report", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
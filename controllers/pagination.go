@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Page holds the pagination parameters of a list request.
+type Page struct {
+	Number  int
+	PerPage int
+}
+
+// Offset returns the number of rows to skip for this page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.PerPage
+}
+
+// PaginatedResponse wraps one page of a list endpoint.
+type PaginatedResponse[T any] struct {
+	Items   []T `json:"items"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// parsePage reads ?page= and ?per_page=, defaulting to the first page of 20 items.
+func parsePage(r *http.Request) (Page, error) {
+	page := Page{Number: 1, PerPage: defaultPerPage}
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return Page{}, errors.New("page must be a positive integer")
+		}
+		page.Number = number
+	}
+
+	if value := r.URL.Query().Get("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return Page{}, errors.New("per_page must be between 1 and 100")
+		}
+		page.PerPage = perPage
+	}
+
+	return page, nil
+}
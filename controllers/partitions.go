@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partitionsAhead is how many months of partitions are created in advance,
+// so rows never have to wait in the default partition.
+const partitionsAhead = 2
+
+// partitionedTable is a table partitioned by month of created_at. Partitions
+// older than its retention are dropped.
+type partitionedTable struct {
+	name             string
+	retentionEnv     string
+	defaultRetention int
+}
+
+var partitionedTables = []partitionedTable{
+	{name: "auth_events", retentionEnv: "AUTH_EVENTS_RETENTION_MONTHS", defaultRetention: 12},
+	{name: "admin_audit_log", retentionEnv: "AUDIT_LOG_RETENTION_MONTHS", defaultRetention: 24},
+}
+
+// LoadPartitionRetention returns how many months of a partitioned table are
+// kept, from its retention environment variable.
+func LoadPartitionRetention(table partitionedTable) (int, error) {
+	value := os.Getenv(table.retentionEnv)
+	if value == "" {
+		return table.defaultRetention, nil
+	}
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", table.retentionEnv)
+	}
+	return months, nil
+}
+
+// CheckPartitionRetention validates the retention settings of every
+// partitioned table.
+func CheckPartitionRetention() error {
+	var errs []error
+	for _, table := range partitionedTables {
+		if _, err := LoadPartitionRetention(table); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MaintainPartitions is the daily job entry point. It creates the partitions
+// of the coming months and drops those past retention.
+func MaintainPartitions(ctx context.Context) error {
+	month := time.Now().UTC()
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for _, table := range partitionedTables {
+		retention, err := LoadPartitionRetention(table)
+		if err != nil {
+			return err
+		}
+		for i := 0; i <= partitionsAhead; i++ {
+			if _, err := db.DB.ExecContext(ctx, "SELECT create_monthly_partition($1, $2)", table.name, month.AddDate(0, i, 0)); err != nil {
+				return fmt.Errorf("error creating %s partition: %w", table.name, err)
+			}
+		}
+		if err := dropExpiredPartitions(ctx, table.name, month.AddDate(0, -retention, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropExpiredPartitions drops the monthly partitions of a table that end
+// before cutoff, and deletes old rows that ended up in its default partition.
+func dropExpiredPartitions(ctx context.Context, table string, cutoff time.Time) error {
+	rows, err := db.DB.QueryContext(ctx, `SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = $1`, table)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	var expired []string
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		month, err := time.Parse("2006_01", strings.TrimPrefix(partition, table+"_"))
+		if err != nil {
+			// The default partition.
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, partition)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, partition := range expired {
+		// The names come from pg_class and match table_YYYY_MM.
+		if _, err := db.DB.ExecContext(ctx, fmt.Sprintf(`DROP TABLE "%s"`, partition)); err != nil {
+			return fmt.Errorf("error dropping partition %s: %w", partition, err)
+		}
+		log.Printf("Dropped expired partition %s", partition)
+	}
+
+	if _, err := db.DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s_default" WHERE created_at < $1`, table), cutoff); err != nil {
+		return fmt.Errorf("error pruning %s default partition: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPayPalAPIURL = "https://api-m.paypal.com"
+	// payPalOrderTimeout is when a PayPal gift whose order was never
+	// captured is given up on; PayPal voids orders after three hours.
+	payPalOrderTimeout = 3 * time.Hour
+)
+
+// ErrDonationNotOwned is returned for a signed-in donor's gift to anyone
+// else.
+var ErrDonationNotOwned = errors.New("donation belongs to another donor")
+
+// PayPalConfig configures giving through PayPal Checkout.
+type PayPalConfig struct {
+	// ClientID is "" when PayPal is off.
+	ClientID     string
+	ClientSecret string
+	APIURL       string
+	// Currency is the currency of PayPal gifts that do not name one.
+	Currency string
+	// ReturnURL and CancelURL are where donors who approve an order on
+	// PayPal's site are sent back to. Pages using PayPal's buttons need
+	// neither.
+	ReturnURL string
+	CancelURL string
+}
+
+// payPalError is an error response of the PayPal API. Issue names what
+// went wrong, such as INSTRUMENT_DECLINED.
+type payPalError struct {
+	Status  int
+	Issue   string
+	Message string
+}
+
+func (e *payPalError) Error() string {
+	return fmt.Sprintf("PayPal returned %d %s: %s", e.Status, e.Issue, e.Message)
+}
+
+var (
+	payPalConfig     *PayPalConfig
+	payPalConfigOnce sync.Once
+	payPalClient     = &http.Client{Timeout: 30 * time.Second}
+
+	payPalTokenMu      sync.Mutex
+	payPalToken        string
+	payPalTokenExpires time.Time
+)
+
+// LoadPayPalConfig reads PAYPAL_CLIENT_ID with PAYPAL_CLIENT_SECRET, and
+// optionally PAYPAL_CURRENCY, which defaults to USD, PAYPAL_RETURN_URL,
+// PAYPAL_CANCEL_URL and PAYPAL_API_URL, e.g.
+// https://api-m.sandbox.paypal.com for testing.
+func LoadPayPalConfig() (*PayPalConfig, error) {
+	config := &PayPalConfig{
+		ClientID:     os.Getenv("PAYPAL_CLIENT_ID"),
+		ClientSecret: os.Getenv("PAYPAL_CLIENT_SECRET"),
+		APIURL:       strings.TrimSuffix(os.Getenv("PAYPAL_API_URL"), "/"),
+		Currency:     strings.ToUpper(os.Getenv("PAYPAL_CURRENCY")),
+		ReturnURL:    os.Getenv("PAYPAL_RETURN_URL"),
+		CancelURL:    os.Getenv("PAYPAL_CANCEL_URL"),
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultPayPalAPIURL
+	}
+	if config.Currency == "" {
+		config.Currency = "USD"
+	}
+	parsed, err := url.Parse(config.APIURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("PAYPAL_API_URL must be an http(s) URL")
+	}
+	if !validation.PayPalCurrencies[config.Currency] {
+		return nil, errors.New("PAYPAL_CURRENCY must be a currency PayPal gifts can be given in")
+	}
+	for name, value := range map[string]string{"PAYPAL_RETURN_URL": config.ReturnURL, "PAYPAL_CANCEL_URL": config.CancelURL} {
+		if value != "" && !validation.IsValidURL(value) {
+			return nil, fmt.Errorf("%s must be a valid URL", name)
+		}
+	}
+	if config.ClientID != "" && config.ClientSecret == "" {
+		return nil, errors.New("PAYPAL_CLIENT_SECRET is required with PAYPAL_CLIENT_ID")
+	}
+	return config, nil
+}
+
+func payPal() *PayPalConfig {
+	payPalConfigOnce.Do(func() {
+		config, err := LoadPayPalConfig()
+		if err != nil {
+			log.Printf("PayPal integration disabled: %v", err)
+			config = &PayPalConfig{Currency: "USD"}
+		}
+		payPalConfig = config
+	})
+	return payPalConfig
+}
+
+// payPalAccessToken returns an OAuth token for the PayPal API, reusing it
+// until shortly before it expires.
+func payPalAccessToken(ctx context.Context) (string, error) {
+	payPalTokenMu.Lock()
+	defer payPalTokenMu.Unlock()
+	if payPalToken != "" && time.Now().Before(payPalTokenExpires) {
+		return payPalToken, nil
+	}
+
+	config := payPal()
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.APIURL+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(config.ClientID, config.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := payPalClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting PayPal token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("PayPal token request returned %s: %s", resp.Status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error decoding PayPal token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("PayPal returned an invalid token")
+	}
+	payPalToken = token.AccessToken
+	payPalTokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return payPalToken, nil
+}
+
+// payPalPost calls the PayPal API and decodes the response into out.
+// requestID makes retries of the same call safe.
+func payPalPost(ctx context.Context, path string, body any, requestID string, out any) error {
+	token, err := payPalAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, payPal().APIURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PayPal-Request-Id", requestID)
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := payPalClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling PayPal %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var failure struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+			Details []struct {
+				Issue string `json:"issue"`
+			} `json:"details"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+		issue := failure.Name
+		if len(failure.Details) > 0 {
+			issue = failure.Details[0].Issue
+		}
+		return &payPalError{Status: resp.StatusCode, Issue: issue, Message: failure.Message}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding PayPal %s response: %w", path, err)
+	}
+	return nil
+}
+
+// payPalAmount writes minor units as PayPal's decimal amount. Every
+// currency PayPal gifts can be given in has two decimals.
+func payPalAmount(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// payPalProvider takes payments through PayPal Checkout, for donors who
+// give from abroad or without a card.
+type payPalProvider struct{}
+
+func (payPalProvider) Enabled() bool    { return payPal().ClientID != "" }
+func (payPalProvider) Method() string   { return "paypal" }
+func (payPalProvider) Currency() string { return payPal().Currency }
+
+// Start creates the order of a pending gift. The donor approves it on
+// PayPal, then the page captures it with CapturePayPalOrder.
+func (payPalProvider) Start(ctx context.Context, donationID uuid.UUID, request models.DonationIntentRequest) (models.DonationIntent, error) {
+	config := payPal()
+	experience := map[string]string{"shipping_preference": "NO_SHIPPING", "user_action": "PAY_NOW"}
+	if config.ReturnURL != "" {
+		experience["return_url"] = config.ReturnURL
+	}
+	if config.CancelURL != "" {
+		experience["cancel_url"] = config.CancelURL
+	}
+
+	var order struct {
+		ID    string `json:"id"`
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"links"`
+	}
+	err := payPalPost(ctx, "/v2/checkout/orders", map[string]any{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]any{{
+			"reference_id": donationID.String(),
+			"custom_id":    donationID.String(),
+			"description":  "Gift to the " + request.Fund + " fund",
+			"amount": map[string]string{
+				"currency_code": request.Currency,
+				"value":         payPalAmount(request.AmountCents),
+			},
+		}},
+		"payment_source": map[string]any{"paypal": map[string]any{"experience_context": experience}},
+	}, donationID.String(), &order)
+	if err != nil {
+		return models.DonationIntent{}, err
+	}
+
+	intent := models.DonationIntent{Reference: order.ID}
+	for _, link := range order.Links {
+		if link.Rel == "payer-action" || link.Rel == "approve" {
+			intent.ApprovalURL = link.Href
+		}
+	}
+	return intent, nil
+}
+
+// CapturePayPalOrder takes the payment of a PayPal order the donor has
+// approved and completes its gift. Capturing a gift that is no longer
+// pending returns it unchanged, so the page can safely retry. Order IDs
+// show up in return URLs, so only the outcome is returned, and a signed-in
+// donor's gift is only found by that donor.
+func CapturePayPalOrder(w http.ResponseWriter, r *http.Request) {
+	if !(payPalProvider{}).Enabled() {
+		middlewares.HttpError(w, "Giving through paypal is not enabled", http.StatusServiceUnavailable, ErrPaymentsDisabled)
+		return
+	}
+	ctx := r.Context()
+	orderID := mux.Vars(r)["id"]
+	query := "SELECT " + donationColumns + " FROM donations WHERE provider = $1 AND reference = $2"
+	donation, err := scanDonation(db.DB.QueryRowContext(ctx, query, models.PaymentProviderPayPal, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "donation", "Donation not found", orderID, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch donation", http.StatusInternalServerError, err)
+		return
+	}
+	if donation.UserID != nil {
+		if userID, ok := middlewares.UserIDFromContext(ctx); !ok || userID != *donation.UserID {
+			respondNotFound(w, "donation", "Donation not found", orderID, ErrDonationNotOwned)
+			return
+		}
+	}
+	if donation.Status != models.DonationStatusPending {
+		middlewares.RespondJSON(w, donationOutcome(donation), http.StatusOK)
+		return
+	}
+
+	var order struct {
+		PurchaseUnits []struct {
+			Payments struct {
+				Captures []struct {
+					ID         string    `json:"id"`
+					Status     string    `json:"status"`
+					CreateTime time.Time `json:"create_time"`
+				} `json:"captures"`
+			} `json:"payments"`
+		} `json:"purchase_units"`
+	}
+	err = payPalPost(ctx, "/v2/checkout/orders/"+url.PathEscape(orderID)+"/capture", struct{}{}, "capture-"+donation.ID.String(), &order)
+	var payPalErr *payPalError
+	if errors.As(err, &payPalErr) && payPalErr.Issue == "ORDER_NOT_APPROVED" {
+		middlewares.HttpError(w, "The order has not been approved yet", http.StatusConflict, err)
+		return
+	}
+	if errors.As(err, &payPalErr) && payPalErr.Issue == "INSTRUMENT_DECLINED" {
+		// The donor can approve the order again with another funding source.
+		middlewares.HttpError(w, "The payment was declined", http.StatusPaymentRequired, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to capture the payment", http.StatusBadGateway, err)
+		return
+	}
+
+	for _, unit := range order.PurchaseUnits {
+		for _, capture := range unit.Payments.Captures {
+			status := ""
+			switch capture.Status {
+			case "COMPLETED":
+				status = models.DonationStatusCompleted
+			case "DECLINED", "FAILED":
+				status = models.DonationStatusFailed
+			}
+			if status == "" {
+				// Pending captures, such as eChecks, are left pending.
+				continue
+			}
+			givenAt := capture.CreateTime
+			if givenAt.IsZero() {
+				givenAt = time.Now()
+			}
+			receipt := capture.ID
+			if _, err := setDonationStatus(ctx, models.PaymentProviderPayPal, orderID, status, givenAt, &receipt); err != nil {
+				middlewares.HttpError(w, "Failed to record payment", http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	donation, err = scanDonation(db.DB.QueryRowContext(ctx, query, models.PaymentProviderPayPal, orderID))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch donation", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, donationOutcome(donation), http.StatusOK)
+}
+
+func donationOutcome(donation models.Donation) models.DonationOutcome {
+	return models.DonationOutcome{
+		DonationID:  donation.ID,
+		Status:      donation.Status,
+		AmountCents: donation.AmountCents,
+		Currency:    donation.Currency,
+		Fund:        donation.Fund,
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"encoding/json"
+	"jsmi-api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// TestCapturePayPalOrderHidesDonors checks that an order ID, which shows up
+// in return URLs, reveals nothing about who gave.
+func TestCapturePayPalOrderHidesDonors(t *testing.T) {
+	payPalConfigOnce.Do(func() {})
+	previous := payPalConfig
+	payPalConfig = &PayPalConfig{ClientID: "client", Currency: "USD"}
+	t.Cleanup(func() { payPalConfig = previous })
+
+	router := mux.NewRouter()
+	SetupDonationRoutes(router)
+	capture := func(mock sqlmock.Sqlmock, userID any) *httptest.ResponseRecorder {
+		columns := []string{"id", "user_id", "donor_name", "amount_cents", "currency", "fund", "method", "status",
+			"reference", "provider", "receipt", "device_id", "given_at", "recorded_at"}
+		mock.ExpectQuery("FROM donations WHERE provider = \\$1 AND reference = \\$2").
+			WithArgs(models.PaymentProviderPayPal, "ORDER-1").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(uuid.New(), userID, "Achieng Otieno", int64(5000), "USD", "missions",
+				"paypal", models.DonationStatusCompleted, "ORDER-1", models.PaymentProviderPayPal, "CAPTURE-1", nil, time.Now(), time.Now()))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/donations/paypal/orders/ORDER-1/capture", nil))
+		return recorder
+	}
+
+	t.Run("signed-in donor's gift", func(t *testing.T) {
+		recorder := capture(mockDB(t), int64(7))
+		assertNotFound(t, recorder, "donation", "ORDER-1")
+	})
+
+	t.Run("anonymous gift", func(t *testing.T) {
+		recorder := capture(mockDB(t), nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d; body: %s", recorder.Code, http.StatusOK, recorder.Body)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("body is not JSON: %v", err)
+		}
+		if body["status"] != models.DonationStatusCompleted || body["amount_cents"] != float64(5000) {
+			t.Errorf("body = %v, want the completed gift of 5000", body)
+		}
+		for _, field := range []string{"user_id", "donor_name", "receipt", "device_id"} {
+			if _, ok := body[field]; ok {
+				t.Errorf("body has %s: %v", field, body)
+			}
+		}
+	})
+}
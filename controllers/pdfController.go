@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/pdf"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// JobRenderPDF renders a PDF template into the media library.
+const JobRenderPDF = "pdf.render"
+
+// PDFRenderRequest is the payload of a JobRenderPDF job.
+type PDFRenderRequest struct {
+	Template  string          `json:"template"`
+	Data      json.RawMessage `json:"data"`
+	Namespace string          `json:"namespace"`
+	Filename  string          `json:"filename"`
+	CreatedBy *int64          `json:"created_by,omitempty"`
+}
+
+// RenderPDF is the job handler for JobRenderPDF.
+func RenderPDF(ctx context.Context, task *jobs.Task) (any, error) {
+	var req PDFRenderRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	rendered, err := pdf.Render(req.Template, req.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := media.Store(ctx, req.Namespace, req.Filename, "application/pdf", rendered, req.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]uuid.UUID{"media_id": item.ID}, nil
+}
+
+// QueuePDF validates a render request and queues it.
+func QueuePDF(ctx context.Context, req PDFRenderRequest) (uuid.UUID, error) {
+	if !pdf.HasTemplate(req.Template) {
+		return uuid.Nil, fmt.Errorf("%w: %q", pdf.ErrUnknownTemplate, req.Template)
+	}
+	if err := media.ValidateNamespace(req.Namespace); err != nil {
+		return uuid.Nil, err
+	}
+	if req.Filename == "" {
+		req.Filename = req.Template + ".pdf"
+	} else if !strings.HasSuffix(strings.ToLower(req.Filename), ".pdf") {
+		req.Filename += ".pdf"
+	}
+	return jobs.Enqueue(ctx, db.DB, JobRenderPDF, req)
+}
+
+// CreatePDF queues a PDF render and responds with the job to poll.
+func CreatePDF(w http.ResponseWriter, r *http.Request) {
+	var req PDFRenderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middlewares.HttpError(w, "Invalid request payload", http.StatusBadRequest, err)
+		return
+	}
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	req.CreatedBy = &userID
+
+	jobID, err := QueuePDF(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, pdf.ErrUnknownTemplate) || errors.Is(err, media.ErrInvalidNamespace) {
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to queue PDF", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]uuid.UUID{"job_id": jobID}, http.StatusAccepted)
+}
+
+// GetJob returns the status and result of a background job.
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	task, err := jobs.GetTask(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			middlewares.HttpError(w, "Job not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch job", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, task, http.StatusOK)
+}
+
+// DownloadMedia downloads a file from the media library.
+func DownloadMedia(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	serveMedia(w, r, id, "")
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// PostAccessibilityReport lists the accessibility warnings of a post.
+type PostAccessibilityReport struct {
+	ID       uuid.UUID               `json:"id"`
+	Title    string                  `json:"title"`
+	Slug     string                  `json:"slug"`
+	Status   string                  `json:"status"`
+	Warnings []validation.FieldError `json:"warnings"`
+}
+
+func postAccessibilityReport(post models.Post) PostAccessibilityReport {
+	warnings := validation.CheckPostAccessibility(post)
+	if warnings == nil {
+		warnings = []validation.FieldError{}
+	}
+	return PostAccessibilityReport{ID: post.ID, Title: post.Title, Slug: post.Slug, Status: post.Status, Warnings: warnings}
+}
+
+// GetPostAccessibilityReport returns the accessibility warnings of a post
+// with ?id=, whatever its status, so editors can check a draft before
+// publishing it. Without an ID it lists the published posts that have
+// warnings, most recently published first.
+func GetPostAccessibilityReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		post, err := queryPostByID(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Post not found", http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, postAccessibilityReport(post), http.StatusOK)
+		return
+	}
+
+	// Bodies are checked in Go, so every published post is read; there are
+	// few enough of them for that.
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+` FROM posts
+		WHERE status = $1 AND deleted_at IS NULL
+		ORDER BY published_at DESC NULLS LAST, id`, models.PostStatusPublished)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build accessibility report", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	reports := []PostAccessibilityReport{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to build accessibility report", http.StatusInternalServerError, err)
+			return
+		}
+		if report := postAccessibilityReport(post); len(report.Warnings) > 0 {
+			reports = append(reports, report)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to build accessibility report", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, reports, http.StatusOK)
+}
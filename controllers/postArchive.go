@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/metrics"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// postArchiveCacheTime is how long archive responses stay cached. Post writes
+// clear them earlier, together with the post lists.
+const postArchiveCacheTime = 24 * time.Hour
+
+// GetPostArchive counts the published posts of every month, newest month
+// first. Posts belong to the month they were first published in, in UTC.
+func GetPostArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	months, err := fetchPostArchive(ctx, "archive", queryPostArchive)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch post archive", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeyPosts, surrogateKeyPostsAll)
+	middlewares.RespondJSON(w, months, http.StatusOK)
+}
+
+// GetPostArchiveMonth lists the published posts of a month, newest first.
+func GetPostArchiveMonth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil || year < 1 {
+		middlewares.HttpError(w, "Invalid year", http.StatusBadRequest, err)
+		return
+	}
+	month, err := strconv.Atoi(vars["month"])
+	if err != nil || month < 1 || month > 12 {
+		middlewares.HttpError(w, "month must be between 1 and 12", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	posts, err := fetchPostArchive(ctx, "archive="+start.Format("2006-01"), func(ctx context.Context) ([]models.Post, error) {
+		return queryPostArchiveMonth(ctx, start)
+	})
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeyPosts, surrogateKeyPostsAll)
+	middlewares.RespondJSON(w, serializers.Posts(posts), http.StatusOK)
+}
+
+// fetchPostArchive returns archive data from the posts' filtered list cache,
+// or queries and caches it.
+func fetchPostArchive[T any](ctx context.Context, field string, query func(context.Context) (T, error)) (T, error) {
+	var data T
+	cachedData, err := db.GetFilteredList(ctx, postsCacheEntity, field)
+	metrics.ObserveCache(err)
+	if err == nil {
+		if err := json.Unmarshal(cachedData, &data); err != nil {
+			return data, fmt.Errorf("error unmarshalling cached post archive data: %w", err)
+		}
+		return data, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return data, fmt.Errorf("error fetching post archive from Redis cache: %w", err)
+	}
+
+	data, err = query(ctx)
+	if err != nil {
+		return data, err
+	}
+
+	if jsonData, err := json.Marshal(data); err == nil {
+		db.SetFilteredList(ctx, postsCacheEntity, field, jsonData, postArchiveCacheTime)
+	}
+	return data, nil
+}
+
+func queryPostArchive(ctx context.Context) ([]models.PostArchiveMonth, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT EXTRACT(YEAR FROM month)::int, EXTRACT(MONTH FROM month)::int, COUNT(*)
+		FROM (
+			SELECT date_trunc('month', COALESCE(published_at, created_at)) AS month
+			FROM posts
+			WHERE status = 'published' AND deleted_at IS NULL
+		) p
+		GROUP BY month
+		ORDER BY month DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	months := []models.PostArchiveMonth{}
+	for rows.Next() {
+		var month models.PostArchiveMonth
+		if err := rows.Scan(&month.Year, &month.Month, &month.Count); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		months = append(months, month)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return months, nil
+}
+
+func queryPostArchiveMonth(ctx context.Context, start time.Time) ([]models.Post, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+` FROM posts
+		WHERE status = 'published' AND deleted_at IS NULL
+			AND COALESCE(published_at, created_at) >= $1 AND COALESCE(published_at, created_at) < $2
+		ORDER BY COALESCE(published_at, created_at) DESC, id`, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return posts, nil
+}
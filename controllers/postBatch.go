@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxBatchPosts bounds how many posts one batch request may ask for.
+const maxBatchPosts = 50
+
+// GetPostsBatch serves several published posts in one response, for pages
+// that stitch curated posts together. The IDs are given as ?ids=a,b,c or,
+// with POST, as a JSON array. Posts come back in the order asked for; IDs
+// that are not published posts are listed as missing. Batch reads do not
+// count as views.
+func GetPostsBatch(w http.ResponseWriter, r *http.Request) {
+	var raw []string
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+			return
+		}
+	} else if value := r.URL.Query().Get("ids"); value != "" {
+		raw = strings.Split(value, ",")
+	}
+
+	ids, err := parseBatchPostIDs(raw)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	posts, err := fetchPostsByIDs(ctx, ids)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+
+	batch := serializers.PostBatch{Posts: serializers.Posts(posts), Missing: []string{}}
+	found := map[uuid.UUID]bool{}
+	keys := []string{surrogateKeyPostsAll}
+	for _, post := range posts {
+		found[post.ID] = true
+		keys = append(keys, postSurrogateKey(post.ID.String()))
+	}
+	for _, id := range ids {
+		if !found[id] {
+			batch.Missing = append(batch.Missing, id.String())
+		}
+	}
+
+	setSurrogateKeys(w, keys...)
+	middlewares.RespondJSON(w, batch, http.StatusOK)
+}
+
+// parseBatchPostIDs parses and deduplicates post IDs, keeping their order.
+func parseBatchPostIDs(raw []string) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, value := range raw {
+		id, err := uuid.Parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid post ID %q", value)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("ids is required")
+	}
+	if len(ids) > maxBatchPosts {
+		return nil, fmt.Errorf("at most %d posts can be fetched at once", maxBatchPosts)
+	}
+	return ids, nil
+}
+
+// fetchPostsByIDs returns the published posts with the given IDs, in that
+// order. Posts are read from their item cache like fetchPost does; the ones
+// not cached are loaded in one query and cached.
+func fetchPostsByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	listKey, err := db.CacheKey(ctx, postsCacheEntity, "")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = listKey + ":" + id.String()
+	}
+	cached, err := db.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching posts from Redis cache: %w", err)
+	}
+
+	byID := map[uuid.UUID]models.Post{}
+	var missing []string
+	for i, value := range cached {
+		data, ok := value.(string)
+		if !ok {
+			missing = append(missing, ids[i].String())
+			continue
+		}
+		var post models.Post
+		if err := json.Unmarshal([]byte(data), &post); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cached post data: %w", err)
+		}
+		byID[post.ID] = post
+	}
+
+	if len(missing) > 0 {
+		loaded, err := queryPostsByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		const CacheTime = 7 * 24 * time.Hour
+		_, err = db.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, post := range loaded {
+				byID[post.ID] = post
+				if jsonData, err := json.Marshal(post); err == nil {
+					pipe.Set(ctx, listKey+":"+post.ID.String(), jsonData, CacheTime)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error caching posts: %w", err)
+		}
+	}
+
+	posts := []models.Post{}
+	for _, id := range ids {
+		if post, ok := byID[id]; ok {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// queryPostsByIDs loads the published posts with the given IDs, bypassing
+// the cache.
+func queryPostsByIDs(ctx context.Context, ids []string) ([]models.Post, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+` FROM posts
+		WHERE id = ANY($1::uuid[]) AND status = 'published' AND deleted_at IS NULL`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return posts, nil
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// JobExportPosts bundles every post into a ZIP of Markdown files in the
+// media library.
+const JobExportPosts = "posts.export"
+
+const exportsNamespace = "exports"
+
+// PostExportRequest is the payload of a JobExportPosts job.
+type PostExportRequest struct {
+	CreatedBy *int64 `json:"created_by,omitempty"`
+}
+
+// ExportedMedia is an entry of the bundle's media manifest: an image the
+// posts reference. The files themselves are not in the bundle.
+type ExportedMedia struct {
+	MediaID     uuid.UUID `json:"media_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	URL         string    `json:"url"`
+	Posts       []string  `json:"posts"`
+}
+
+// CreatePostExport queues an export of all posts and responds with the job to
+// poll. The job's result names the media item to download.
+func CreatePostExport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserIDFromContext(r.Context())
+	jobID, err := jobs.Enqueue(r.Context(), db.DB, JobExportPosts, PostExportRequest{CreatedBy: &userID})
+	if err != nil {
+		middlewares.HttpError(w, "Failed to queue export", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, map[string]uuid.UUID{"job_id": jobID}, http.StatusAccepted)
+}
+
+// ExportPosts is the job handler for JobExportPosts. The bundle holds
+// posts/<slug>.md for every post that is not in the trash, whatever its
+// status, with the metadata as YAML front matter, and media.json listing
+// the images they use. Bodies are kept as HTML, which Markdown allows, so
+// nothing is lost in conversion.
+func ExportPosts(ctx context.Context, task *jobs.Task) (any, error) {
+	var req PostExportRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	count, err := writePostFiles(ctx, archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeMediaManifest(ctx, archive); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("error writing archive: %w", err)
+	}
+
+	filename := "posts-" + time.Now().UTC().Format("20060102-150405") + ".zip"
+	item, err := media.Store(ctx, exportsNamespace, filename, "application/zip", buf.Bytes(), req.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"media_id": item.ID, "posts": count}, nil
+}
+
+func writePostFiles(ctx context.Context, archive *zip.Writer) (int, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+" FROM posts WHERE deleted_at IS NULL ORDER BY created_at, id")
+	if err != nil {
+		return 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     "posts/" + post.Slug + ".md",
+			Method:   zip.Deflate,
+			Modified: post.UpdatedAt,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error writing archive: %w", err)
+		}
+		if err := writePostMarkdown(file, post); err != nil {
+			return 0, fmt.Errorf("error writing archive: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return count, nil
+}
+
+// writePostMarkdown writes a post with YAML front matter. Strings are written
+// as JSON strings, which YAML reads as double-quoted scalars.
+func writePostMarkdown(w io.Writer, post models.Post) error {
+	var b strings.Builder
+	field := func(name string, value any) {
+		data, _ := json.Marshal(value)
+		fmt.Fprintf(&b, "%s: %s\n", name, data)
+	}
+
+	b.WriteString("---\n")
+	field("id", post.ID)
+	field("title", post.Title)
+	field("slug", post.Slug)
+	field("status", post.Status)
+	field("excerpt", post.Excerpt)
+	if post.PublishedAt != nil {
+		field("published_at", post.PublishedAt.UTC())
+	}
+	field("created_at", post.CreatedAt.UTC())
+	field("updated_at", post.UpdatedAt.UTC())
+	field("reading_time_minutes", post.ReadingTimeMinutes)
+	optional := []struct{ name, value string }{
+		{"cover_image_url", post.CoverImageURL},
+		{"meta_title", post.MetaTitle},
+		{"meta_description", post.MetaDescription},
+		{"canonical_url", post.CanonicalURL},
+	}
+	for _, o := range optional {
+		if o.value != "" {
+			field(o.name, o.value)
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(post.Body)
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMediaManifest(ctx context.Context, archive *zip.Writer) error {
+	rows, err := db.DB.QueryContext(ctx, `SELECT m.id, m.storage_key, m.filename, m.content_type, m.size_bytes,
+			ARRAY_AGG(p.slug ORDER BY p.slug)
+		FROM post_media pm
+		JOIN posts p ON p.id = pm.post_id AND p.deleted_at IS NULL
+		JOIN media_items m ON m.id = pm.media_id
+		GROUP BY m.id
+		ORDER BY m.created_at, m.id`)
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	manifest := []ExportedMedia{}
+	for rows.Next() {
+		var (
+			item ExportedMedia
+			key  string
+		)
+		if err := rows.Scan(&item.MediaID, &key, &item.Filename, &item.ContentType, &item.SizeBytes, pq.Array(&item.Posts)); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		item.URL = postImageURL(item.MediaID, key)
+		manifest = append(manifest, item)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	file, err := archive.Create("media.json")
+	if err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/media"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/storage"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	postImagesNamespace = "post-images"
+	// postImageThumbnailSize is the longest side of a thumbnail in pixels.
+	postImageThumbnailSize = 400
+	// unusedImageRetention is how long an image no post references is kept
+	// before PurgeUnusedPostImages deletes it.
+	unusedImageRetention = 30 * 24 * time.Hour
+)
+
+var (
+	ErrPostImageNotFound = errors.New("post image not found")
+	ErrPostImageInUse    = errors.New("post image is used by a post")
+
+	postImageProcessor = media.NewProcessor(2)
+)
+
+// postImageURL points at the storage's public URL when one is configured and
+// at GetPostImageFile otherwise.
+func postImageURL(id uuid.UUID, key string) string {
+	if url := storage.PublicURL(key); url != "" {
+		return url
+	}
+	return "/media/images/file?id=" + id.String()
+}
+
+const postImageColumns = `i.media_id, m.storage_key, i.thumbnail_media_id, t.storage_key, m.filename, m.content_type,
+	i.width, i.height, m.size_bytes, (SELECT COUNT(*) FROM post_media pm WHERE pm.media_id = i.media_id),
+	i.unused_since, m.created_by, m.created_at`
+
+const postImageTables = `post_images i
+	JOIN media_items m ON m.id = i.media_id
+	JOIN media_items t ON t.id = i.thumbnail_media_id`
+
+func scanPostImage(row rowScanner) (models.PostImage, error) {
+	var (
+		image             models.PostImage
+		key, thumbnailKey string
+	)
+	err := row.Scan(&image.ID, &key, &image.ThumbnailID, &thumbnailKey, &image.Filename, &image.ContentType,
+		&image.Width, &image.Height, &image.SizeBytes, &image.ReferenceCount, &image.UnusedSince, &image.CreatedBy,
+		&image.CreatedAt)
+	if err != nil {
+		return models.PostImage{}, err
+	}
+	image.URL = postImageURL(image.ID, key)
+	image.ThumbnailURL = postImageURL(image.ThumbnailID, thumbnailKey)
+	return image, nil
+}
+
+func queryPostImage(ctx context.Context, id uuid.UUID) (models.PostImage, error) {
+	image, err := scanPostImage(db.DB.QueryRowContext(ctx, `SELECT `+postImageColumns+`
+		FROM `+postImageTables+`
+		WHERE i.media_id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PostImage{}, ErrPostImageNotFound
+		}
+		return models.PostImage{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return image, nil
+}
+
+// GetPostImages returns a page of post images, newest first. unused=true
+// lists only images that no post references.
+func GetPostImages(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	unusedOnly := r.URL.Query().Get("unused") == "true"
+
+	ctx := r.Context()
+	const filter = `($1::boolean IS FALSE OR i.unused_since IS NOT NULL)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM post_images i WHERE "+filter, unusedOnly).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch images", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+postImageColumns+`
+		FROM `+postImageTables+`
+		WHERE `+filter+`
+		ORDER BY m.created_at DESC, i.media_id
+		LIMIT $2 OFFSET $3`, unusedOnly, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch images", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	images := []models.PostImage{}
+	for rows.Next() {
+		image, err := scanPostImage(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch images", http.StatusInternalServerError, err)
+			return
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch images", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.PostImage]{
+		Items:   images,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetPostImage returns a post image with its reference count.
+func GetPostImage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	image, err := queryPostImage(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrPostImageNotFound) {
+			middlewares.HttpError(w, "Image not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch image", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, image, http.StatusOK)
+}
+
+// UploadPostImage accepts a multipart form with a JPEG or PNG image and an
+// optional usage (gallery, the default, or cover). The image is sanitized,
+// checked against the usage's dimension rules and stored with a thumbnail.
+// Posts use it by linking to its URL.
+func UploadPostImage(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadBytes+1<<20)
+	if err := r.ParseMultipartForm(media.MaxUploadBytes); err != nil {
+		middlewares.HttpError(w, "Invalid multipart form", http.StatusBadRequest, err)
+		return
+	}
+
+	usage := media.UsageGallery
+	switch value := r.FormValue("usage"); value {
+	case "", string(media.UsageGallery):
+	case string(media.UsageCover):
+		usage = media.UsageCover
+	default:
+		http.Error(w, "usage must be either gallery or cover", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		middlewares.HttpError(w, "image file is required", http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+
+	image, err := postImageProcessor.Process(ctx, file, usage)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrImageTooLarge):
+			middlewares.HttpError(w, err.Error(), http.StatusRequestEntityTooLarge, err)
+		case errors.Is(err, media.ErrUnsupportedFormat):
+			middlewares.HttpError(w, "image must be a JPEG or PNG file", http.StatusUnsupportedMediaType, err)
+		case errors.Is(err, media.ErrInvalidDimensions):
+			middlewares.HttpError(w, err.Error(), http.StatusUnprocessableEntity, err)
+		default:
+			middlewares.HttpError(w, "Failed to process image", http.StatusInternalServerError, err)
+		}
+		return
+	}
+	thumbnail, err := media.Thumbnail(image, postImageThumbnailSize)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create thumbnail", http.StatusInternalServerError, err)
+		return
+	}
+
+	id, err := storePostImage(ctx, header.Filename, image, thumbnail, userID)
+	if err != nil {
+		var quotaErr *media.QuotaError
+		if errors.As(err, &quotaErr) {
+			middlewares.HttpError(w, "Image storage is full", http.StatusInsufficientStorage, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to store image", http.StatusInternalServerError, err)
+		return
+	}
+
+	stored, err := queryPostImage(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch image", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondCreated(w, "/media/images?id="+stored.ID.String(), stored)
+}
+
+// storePostImage stores an image and its thumbnail in the media library and
+// records them as a post image, cleaning up if any step fails.
+func storePostImage(ctx context.Context, filename string, image, thumbnail *media.ProcessedImage, createdBy int64) (uuid.UUID, error) {
+	filename = path.Base(filename)
+	base := strings.TrimSuffix(filename, path.Ext(filename))
+	if base == "" || base == "." || base == "/" {
+		base = "image"
+	}
+
+	item, err := media.Store(ctx, postImagesNamespace, base+"."+image.Format, image.ContentType, image.Data, &createdBy)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	thumbnailItem, err := media.Store(ctx, postImagesNamespace, base+"-thumbnail."+thumbnail.Format, thumbnail.ContentType,
+		thumbnail.Data, &createdBy)
+	if err != nil {
+		deletePostImageFile(context.WithoutCancel(ctx), item.ID)
+		return uuid.Nil, err
+	}
+
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO post_images (media_id, thumbnail_media_id, width, height)
+		VALUES ($1, $2, $3, $4)`, item.ID, thumbnailItem.ID, image.Width, image.Height)
+	if err != nil {
+		deletePostImageFile(context.WithoutCancel(ctx), item.ID)
+		deletePostImageFile(context.WithoutCancel(ctx), thumbnailItem.ID)
+		return uuid.Nil, fmt.Errorf("error inserting post image: %w", err)
+	}
+	return item.ID, nil
+}
+
+// GetPostImageFile serves a post image or thumbnail when the storage has no
+// public URL. Media IDs never change content, so responses can be cached
+// indefinitely.
+func GetPostImageFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	item, reader, err := media.Open(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, media.ErrItemNotFound) {
+			middlewares.HttpError(w, "Image not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to open image", http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+	// Only post images are public; other media items stay behind their own endpoints.
+	if item.Namespace != postImagesNamespace {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", item.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to stream image %s: %v", item.ID, err)
+	}
+}
+
+// DeletePostImage deletes an image and its thumbnail. Images that a post
+// still references are refused with 409.
+func DeletePostImage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	if err := deletePostImage(r.Context(), id, false); err != nil {
+		switch {
+		case errors.Is(err, ErrPostImageNotFound):
+			middlewares.HttpError(w, "Image not found", http.StatusNotFound, err)
+		case errors.Is(err, ErrPostImageInUse):
+			middlewares.HttpError(w, "Image is used by a post", http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to delete image", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePostImage removes a post image row and then its files. With
+// unusedOnly it only deletes images that have been unused for
+// unusedImageRetention, so an image that was linked again in the meantime is
+// kept.
+func deletePostImage(ctx context.Context, id uuid.UUID, unusedOnly bool) error {
+	var thumbnailID uuid.UUID
+	err := db.DB.QueryRowContext(ctx, `DELETE FROM post_images
+		WHERE media_id = $1 AND ($2::boolean IS FALSE OR unused_since < NOW() - $3 * INTERVAL '1 second')
+		RETURNING thumbnail_media_id`, id, unusedOnly, unusedImageRetention.Seconds()).Scan(&thumbnailID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPostImageNotFound
+		}
+		if isForeignKeyViolation(err) {
+			return ErrPostImageInUse
+		}
+		return fmt.Errorf("error deleting post image: %w", err)
+	}
+
+	deletePostImageFile(ctx, id)
+	deletePostImageFile(ctx, thumbnailID)
+	return nil
+}
+
+func deletePostImageFile(ctx context.Context, id uuid.UUID) {
+	if err := media.DeleteItem(ctx, id); err != nil && !errors.Is(err, media.ErrItemNotFound) {
+		log.Printf("Failed to delete post image file %s: %v", id, err)
+	}
+}
+
+// PurgeUnusedPostImages deletes images that no post has referenced for
+// unusedImageRetention, such as images uploaded for a post that was never
+// saved or removed from every post since.
+func PurgeUnusedPostImages(ctx context.Context) error {
+	rows, err := db.DB.QueryContext(ctx, `SELECT media_id FROM post_images
+		WHERE unused_since < NOW() - $1 * INTERVAL '1 second'`, unusedImageRetention.Seconds())
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		err := deletePostImage(ctx, id, true)
+		switch {
+		case err == nil:
+			purged++
+		case errors.Is(err, ErrPostImageNotFound), errors.Is(err, ErrPostImageInUse):
+			// Deleted or linked again since the query.
+		default:
+			return err
+		}
+	}
+	if purged > 0 {
+		log.Printf("Purged %d unused post images", purged)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	postStatsCacheKey = "post_stats"
+	postStatsTTL      = 5 * time.Minute
+	postStatsTopLimit = 10
+)
+
+// GetPostStats returns post counts for the admin dashboard. The aggregates
+// scan the whole posts table, so the result is cached briefly rather than
+// invalidated on every write.
+func GetPostStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cachedData, err := db.RedisClient.Get(ctx, postStatsCacheKey).Bytes()
+	if err == nil {
+		middlewares.RespondJSON(w, json.RawMessage(cachedData), http.StatusOK)
+		return
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("Failed to read post stats from Redis cache: %v", err)
+	}
+
+	stats, err := queryPostStats(ctx)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch post stats", http.StatusInternalServerError, err)
+		return
+	}
+
+	if jsonData, err := json.Marshal(stats); err == nil {
+		db.RedisClient.Set(ctx, postStatsCacheKey, jsonData, postStatsTTL)
+	}
+	middlewares.RespondJSON(w, stats, http.StatusOK)
+}
+
+func queryPostStats(ctx context.Context) (models.PostStats, error) {
+	stats := models.PostStats{
+		ByStatus:  map[string]int{},
+		PerMonth:  []models.PostMonthCount{},
+		TopSeries: []models.PostSeriesCount{},
+	}
+
+	// Words are counted as in the reading time backfill, matching
+	// validation.WordCount.
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*),
+			COALESCE(AVG((SELECT COUNT(*) FROM regexp_matches(body, '\w+', 'g'))), 0)
+		FROM posts WHERE deleted_at IS NULL`).Scan(&stats.Total, &stats.AverageWordCount)
+	if err != nil {
+		return stats, fmt.Errorf("error querying post totals: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT status, COUNT(*) FROM posts
+		WHERE deleted_at IS NULL GROUP BY status`)
+	if err != nil {
+		return stats, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return stats, fmt.Errorf("error scanning row: %w", err)
+		}
+		stats.ByStatus[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	rows, err = db.DB.QueryContext(ctx, `SELECT to_char(m.month, 'YYYY-MM'), COUNT(p.id)
+		FROM generate_series(date_trunc('month', NOW()) - INTERVAL '11 months', date_trunc('month', NOW()), INTERVAL '1 month') AS m (month)
+		LEFT JOIN posts p ON p.deleted_at IS NULL
+			AND date_trunc('month', COALESCE(p.published_at, p.created_at)) = m.month
+		GROUP BY m.month
+		ORDER BY m.month`)
+	if err != nil {
+		return stats, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var month models.PostMonthCount
+		if err := rows.Scan(&month.Month, &month.Posts); err != nil {
+			return stats, fmt.Errorf("error scanning row: %w", err)
+		}
+		stats.PerMonth = append(stats.PerMonth, month)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	rows, err = db.DB.QueryContext(ctx, `SELECT s.id, s.title, COUNT(*)
+		FROM series s
+		JOIN series_posts sp ON sp.series_id = s.id
+		JOIN posts p ON p.id = sp.post_id AND p.deleted_at IS NULL
+		GROUP BY s.id, s.title
+		ORDER BY COUNT(*) DESC, s.title
+		LIMIT $1`, postStatsTopLimit)
+	if err != nil {
+		return stats, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var series models.PostSeriesCount
+		if err := rows.Scan(&series.SeriesID, &series.Title, &series.Posts); err != nil {
+			return stats, fmt.Errorf("error scanning row: %w", err)
+		}
+		stats.TopSeries = append(stats.TopSeries, series)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return stats, nil
+}
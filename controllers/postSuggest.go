@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	postSuggestPrefix  = "post_suggest:"
+	maxPostSuggestions = 10
+	// postSuggestCacheTime is short: suggestions are not cleared on post
+	// writes, a new title shows up within it.
+	postSuggestCacheTime = time.Minute
+)
+
+// GetPostSuggestions returns up to 10 published posts whose title matches
+// ?q= as a search box types: titles starting with the query first, then
+// titles containing it, then close misspellings.
+func GetPostSuggestions(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(strings.Join(strings.Fields(r.URL.Query().Get("q")), " "))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	if len(query) > maxListQueryLength {
+		http.Error(w, "q is too long", http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := fetchPostSuggestions(r.Context(), query)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch suggestions", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeyPosts)
+	middlewares.RespondJSON(w, suggestions, http.StatusOK)
+}
+
+func fetchPostSuggestions(ctx context.Context, query string) ([]models.PostSuggestion, error) {
+	key := postSuggestPrefix + query
+	cachedData, err := db.RedisClient.Get(ctx, key).Bytes()
+	if err == nil {
+		var suggestions []models.PostSuggestion
+		if err := json.Unmarshal(cachedData, &suggestions); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cached suggestions: %w", err)
+		}
+		return suggestions, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error fetching suggestions from Redis cache: %w", err)
+	}
+
+	suggestions, err := queryPostSuggestions(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if jsonData, err := json.Marshal(suggestions); err == nil {
+		db.RedisClient.Set(ctx, key, jsonData, postSuggestCacheTime)
+	}
+	return suggestions, nil
+}
+
+// queryPostSuggestions matches lower-cased titles with the trigram index of
+// the add_post_title_trigram_index migration. The query is matched
+// literally, so % and _ are escaped.
+func queryPostSuggestions(ctx context.Context, query string) ([]models.PostSuggestion, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, title, slug
+		FROM posts
+		WHERE status = 'published' AND deleted_at IS NULL
+			AND (lower(title) LIKE '%' || $1 || '%' ESCAPE '\' OR lower(title) % $2)
+		ORDER BY lower(title) LIKE $1 || '%' ESCAPE '\' DESC, similarity(lower(title), $2) DESC, title, id
+		LIMIT $3`, escaped, query, maxPostSuggestions)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []models.PostSuggestion{}
+	for rows.Next() {
+		var suggestion models.PostSuggestion
+		if err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Slug); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return suggestions, nil
+}
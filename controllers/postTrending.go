@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/serializers"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	postTrendingKey = "posts:trending"
+	// trendingWindowDays is how far back views and reactions count.
+	trendingWindowDays = 14
+	// trendingHalfLifeHours is how fast activity loses weight: a view three
+	// days old counts half as much as one today.
+	trendingHalfLifeHours = 72
+	// trendingReactionWeight is how many views a reaction is worth.
+	trendingReactionWeight = 5
+	maxTrendingPosts       = 50
+	defaultTrendingPosts   = 10
+	// postTrendingCacheTime outlasts a few refresh intervals, so the ranking
+	// survives a refresh that failed.
+	postTrendingCacheTime = 2 * time.Hour
+)
+
+// trendingScores ranks published posts by their recent views and reactions.
+// Each day's views are weighted by the age of the day's middle, each
+// reaction by its own age.
+const trendingScores = `WITH activity AS (
+		SELECT post_id, views::float8 * power(0.5, EXTRACT(EPOCH FROM NOW() - (day + INTERVAL '12 hours')) / 3600 / $1) AS score
+		FROM post_view_days
+		WHERE day > CURRENT_DATE - $2::integer
+		UNION ALL
+		SELECT post_id, $3::float8 * power(0.5, EXTRACT(EPOCH FROM NOW() - created_at) / 3600 / $1)
+		FROM post_reactions
+		WHERE created_at > NOW() - $2::integer * INTERVAL '1 day'
+	)
+	SELECT a.post_id, SUM(a.score) AS score
+	FROM activity a
+	JOIN posts p ON p.id = a.post_id
+	WHERE p.status = 'published' AND p.deleted_at IS NULL
+	GROUP BY a.post_id
+	ORDER BY score DESC, a.post_id
+	LIMIT $4`
+
+// trendingPost is an entry of the cached ranking.
+type trendingPost struct {
+	ID    uuid.UUID `json:"id"`
+	Score float64   `json:"score"`
+}
+
+// RefreshTrendingPosts is the periodic job that recomputes the trending
+// ranking and caches it in Redis. It also drops view counts that have left
+// the window.
+func RefreshTrendingPosts(ctx context.Context) error {
+	if _, err := computeTrendingPosts(ctx); err != nil {
+		return err
+	}
+	_, err := db.DB.ExecContext(ctx, "DELETE FROM post_view_days WHERE day <= CURRENT_DATE - $1::integer", trendingWindowDays)
+	if err != nil {
+		return fmt.Errorf("error purging old post views: %w", err)
+	}
+	return nil
+}
+
+func computeTrendingPosts(ctx context.Context) ([]trendingPost, error) {
+	rows, err := db.DB.QueryContext(ctx, trendingScores, trendingHalfLifeHours, trendingWindowDays, trendingReactionWeight, maxTrendingPosts)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	ranking := []trendingPost{}
+	for rows.Next() {
+		var post trendingPost
+		if err := rows.Scan(&post.ID, &post.Score); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		ranking = append(ranking, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	jsonData, err := json.Marshal(ranking)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.RedisClient.Set(ctx, postTrendingKey, jsonData, postTrendingCacheTime).Err(); err != nil {
+		return nil, fmt.Errorf("error caching trending posts: %w", err)
+	}
+	return ranking, nil
+}
+
+// fetchTrendingPosts returns the cached ranking, computing it when the job
+// has not run yet.
+func fetchTrendingPosts(ctx context.Context) ([]trendingPost, error) {
+	cachedData, err := db.RedisClient.Get(ctx, postTrendingKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return computeTrendingPosts(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching trending posts from Redis cache: %w", err)
+	}
+	var ranking []trendingPost
+	if err := json.Unmarshal(cachedData, &ranking); err != nil {
+		return nil, fmt.Errorf("error unmarshalling cached trending posts: %w", err)
+	}
+	return ranking, nil
+}
+
+// GetTrendingPosts lists the posts with the most recent views and
+// reactions, limit of them (10 by default). The ranking is refreshed every
+// few minutes.
+func GetTrendingPosts(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTrendingPosts
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTrendingPosts {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxTrendingPosts), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	ranking, err := fetchTrendingPosts(ctx)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch trending posts", http.StatusInternalServerError, err)
+		return
+	}
+	ids := make([]uuid.UUID, 0, limit)
+	for _, entry := range ranking {
+		if len(ids) == limit {
+			break
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	posts, err := fetchPostsByIDs(ctx, ids)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch trending posts", http.StatusInternalServerError, err)
+		return
+	}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch trending posts", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeyPosts, surrogateKeyPostsAll)
+	middlewares.RespondJSON(w, serializers.Posts(posts), http.StatusOK)
+}
+
+// GetPostReactions counts the reactions of a post by kind.
+func GetPostReactions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT reaction, COUNT(*) FROM post_reactions WHERE post_id = $1 GROUP BY reaction", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch reactions", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for reaction := range validation.PostReactions {
+		counts[reaction] = 0
+	}
+	for rows.Next() {
+		var (
+			reaction string
+			count    int
+		)
+		if err := rows.Scan(&reaction, &count); err != nil {
+			middlewares.HttpError(w, "Failed to fetch reactions", http.StatusInternalServerError, err)
+			return
+		}
+		counts[reaction] = count
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch reactions", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, counts, http.StatusOK)
+}
+
+// AddPostReaction adds the caller's reaction to a published post. Adding it
+// again changes nothing.
+func AddPostReaction(w http.ResponseWriter, r *http.Request) {
+	id, reaction, ok := parsePostReaction(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	var published bool
+	err := db.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND status = 'published' AND deleted_at IS NULL)", id).
+		Scan(&published)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to add reaction", http.StatusInternalServerError, err)
+		return
+	}
+	if !published {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	_, err = db.DB.ExecContext(ctx, "INSERT INTO post_reactions (post_id, user_id, reaction) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		id, userID, reaction)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to add reaction", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemovePostReaction removes the caller's reaction from a post.
+func RemovePostReaction(w http.ResponseWriter, r *http.Request) {
+	id, reaction, ok := parsePostReaction(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	_, err := db.DB.ExecContext(ctx, "DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND reaction = $3", id, userID, reaction)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to remove reaction", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parsePostReaction(w http.ResponseWriter, r *http.Request) (uuid.UUID, string, bool) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return uuid.Nil, "", false
+	}
+	reaction := r.URL.Query().Get("reaction")
+	if err := validation.ValidatePostReaction(reaction); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return uuid.Nil, "", false
+	}
+	return id, reaction, true
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+)
+
+// Post views are counted in postViewsPendingKey and added to posts.views by
+// FlushPostViews. postViewsTotalKey caches the stored counts so responses can
+// show current views without querying Postgres.
+const (
+	postViewsPendingKey  = "post_views:pending"
+	postViewsFlushingKey = "post_views:flushing"
+	postViewsTotalKey    = "post_views:total"
+	// postViewWindow is how long repeated views by the same reader count once.
+	postViewWindow      = 30 * time.Minute
+	defaultPopularPosts = 10
+	maxPopularPosts     = 50
+)
+
+// recordPostView counts a view of a post, once per signed-in user or IP
+// address within postViewWindow. It is best effort: failures are only logged.
+func recordPostView(r *http.Request, postID string) {
+	ctx := r.Context()
+	viewer := "ip:" + middlewares.ClientIP(r)
+	if userID, ok := middlewares.UserIDFromContext(ctx); ok {
+		viewer = "user:" + strconv.FormatInt(userID, 10)
+	}
+
+	first, err := db.RedisClient.SetNX(ctx, "post_view:"+postID+":"+viewer, 1, postViewWindow).Result()
+	if err == nil && first {
+		err = db.RedisClient.HIncrBy(ctx, postViewsPendingKey, postID, 1).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to record view of post %s: %v", postID, err)
+	}
+}
+
+// fillPostViews sets the view counts of posts: the stored count plus the
+// views that have not been flushed yet. Cached posts carry no counts, so this
+// runs on every read.
+func fillPostViews(ctx context.Context, posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID.String()
+	}
+
+	pipe := db.RedisClient.Pipeline()
+	totalCmd := pipe.HMGet(ctx, postViewsTotalKey, ids...)
+	pendingCmd := pipe.HMGet(ctx, postViewsPendingKey, ids...)
+	flushingCmd := pipe.HMGet(ctx, postViewsFlushingKey, ids...)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("error fetching post views from Redis: %w", err)
+	}
+
+	totals := make(map[string]int64, len(ids))
+	var missing []string
+	for i, value := range totalCmd.Val() {
+		if count, ok := redisCount(value); ok {
+			totals[ids[i]] = count
+		} else {
+			missing = append(missing, ids[i])
+		}
+	}
+	if len(missing) > 0 {
+		stored, err := queryPostViews(ctx, missing)
+		if err != nil {
+			return err
+		}
+		for id, count := range stored {
+			totals[id] = count
+		}
+	}
+
+	for i := range posts {
+		pending, _ := redisCount(pendingCmd.Val()[i])
+		flushing, _ := redisCount(flushingCmd.Val()[i])
+		posts[i].Views = totals[ids[i]] + pending + flushing
+	}
+	return nil
+}
+
+// queryPostViews loads stored view counts and caches them in
+// postViewsTotalKey.
+func queryPostViews(ctx context.Context, ids []string) (map[string]int64, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, views FROM posts WHERE id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	views := map[string]int64{}
+	fields := []interface{}{}
+	for rows.Next() {
+		var id string
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		views[id] = count
+		fields = append(fields, id, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if len(fields) > 0 {
+		db.RedisClient.HSet(ctx, postViewsTotalKey, fields...)
+	}
+	return views, nil
+}
+
+func redisCount(value interface{}) (int64, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	count, err := strconv.ParseInt(s, 10, 64)
+	return count, err == nil
+}
+
+// FlushPostViews adds the views counted in Redis to posts.views and to the
+// day's count in post_view_days. The pending
+// counts are moved aside first, so views keep being counted during the flush;
+// a flush that failed halfway is finished by the next run.
+func FlushPostViews(ctx context.Context) error {
+	exists, err := db.RedisClient.Exists(ctx, postViewsFlushingKey).Result()
+	if err != nil {
+		return fmt.Errorf("error checking post views in Redis: %w", err)
+	}
+	if exists == 0 {
+		// RENAMENX fails without pending views, when nothing was viewed
+		// since the last flush.
+		if _, err := db.RedisClient.RenameNX(ctx, postViewsPendingKey, postViewsFlushingKey).Result(); err != nil {
+			if pending, existsErr := db.RedisClient.Exists(ctx, postViewsPendingKey).Result(); existsErr == nil && pending == 0 {
+				return nil
+			}
+			return fmt.Errorf("error moving pending post views: %w", err)
+		}
+	}
+
+	counts, err := db.RedisClient.HGetAll(ctx, postViewsFlushingKey).Result()
+	if err != nil {
+		return fmt.Errorf("error fetching pending post views: %w", err)
+	}
+
+	for id, value := range counts {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		var total int64
+		err = db.DB.QueryRowContext(ctx, `WITH updated AS (
+				UPDATE posts SET views = views + $1 WHERE id = $2 RETURNING id, views
+			), daily AS (
+				INSERT INTO post_view_days (post_id, day, views)
+				SELECT id, CURRENT_DATE, $1 FROM updated
+				ON CONFLICT (post_id, day) DO UPDATE SET views = post_view_days.views + EXCLUDED.views
+			)
+			SELECT views FROM updated`, count, id).Scan(&total)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error updating post views: %w", err)
+		}
+
+		// Moving the count from the flushing hash into the total at once
+		// keeps fillPostViews from counting it twice or not at all.
+		_, err = db.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if total > 0 {
+				pipe.HSet(ctx, postViewsTotalKey, id, total)
+			}
+			pipe.HDel(ctx, postViewsFlushingKey, id)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error storing post views in Redis: %w", err)
+		}
+	}
+
+	return db.RedisClient.Del(ctx, postViewsFlushingKey).Err()
+}
+
+// GetPopularPosts lists published posts by views, most viewed first. limit
+// defaults to 10.
+func GetPopularPosts(w http.ResponseWriter, r *http.Request) {
+	limit := defaultPopularPosts
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPopularPosts {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPopularPosts), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+` FROM posts
+		WHERE status = 'published' AND deleted_at IS NULL
+		ORDER BY views DESC, published_at DESC, id
+		LIMIT $1`, limit)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch popular posts", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch popular posts", http.StatusInternalServerError, err)
+			return
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch popular posts", http.StatusInternalServerError, err)
+		return
+	}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch popular posts", http.StatusInternalServerError, err)
+		return
+	}
+	// Views that are not flushed yet can change the order.
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Views > posts[j].Views })
+
+	setSurrogateKeys(w, surrogateKeyPosts, surrogateKeyPostsAll)
+	middlewares.RespondJSON(w, serializers.Posts(posts), http.StatusOK)
+}
@@ -7,9 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"jsmi-api/db"
+	"jsmi-api/events"
+	"jsmi-api/metrics"
 	"jsmi-api/middlewares"
 	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"jsmi-api/utils"
 	"jsmi-api/validation"
+	"log"
 	"net/http"
 	"time"
 
@@ -18,36 +23,87 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// trashRetention is how long deleted posts stay in the trash.
+const trashRetention = 30 * 24 * time.Hour
+
+// postsCacheEntity versions the Redis keys of cached posts, see db.CacheKey.
+const postsCacheEntity = "posts"
+
+// reservedPostSlugs are path segments under /posts that are not post slugs.
+var reservedPostSlugs = map[string]bool{"trash": true, "popular": true, "archive": true, "batch": true, "suggest": true, "trending": true, "reactions": true, "accessibility": true}
+
 func SetupPostRoutes(r *mux.Router) {
 	postsRouter := r.PathPrefix("/posts").Subrouter()
-	postsRouter.HandleFunc("", GetPosts).Methods("GET")
-	postsRouter.HandleFunc("", GetPost).Methods("GET").Queries("id", "{id}")
-	postsRouter.HandleFunc("", CreatePost).Methods("POST")
-	postsRouter.HandleFunc("", UpdatePost).Methods("PUT").Queries("id", "{id}")
-	postsRouter.HandleFunc("", DeletePost).Methods("DELETE").Queries("id", "{id}")
+	postsRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetPostsByStatus))).Methods("GET").Queries("status", "{status}")
+	// Routes with queries come before the bare list route, which matches any query.
+	postsRouter.Handle("", middlewares.OptionalTokenAuth(http.HandlerFunc(GetPost))).Methods("GET").Queries("id", "{id}")
+	postsRouter.Handle("", middlewares.OptionalTokenAuth(http.HandlerFunc(GetPostBySlug))).Methods("GET").Queries("slug", "{slug}")
+	postsRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetPosts))).Methods("GET")
+	postsRouter.Handle("/popular", middlewares.Coalesce(http.HandlerFunc(GetPopularPosts))).Methods("GET")
+	postsRouter.Handle("/trending", middlewares.Coalesce(http.HandlerFunc(GetTrendingPosts))).Methods("GET")
+	postsRouter.HandleFunc("/reactions", GetPostReactions).Methods("GET").Queries("id", "{id}")
+	postsRouter.Handle("/reactions", middlewares.TokenAuthMiddleware(http.HandlerFunc(AddPostReaction))).Methods("PUT").Queries("id", "{id}", "reaction", "{reaction}")
+	postsRouter.Handle("/reactions", middlewares.TokenAuthMiddleware(http.HandlerFunc(RemovePostReaction))).Methods("DELETE").Queries("id", "{id}", "reaction", "{reaction}")
+	postsRouter.Handle("/suggest", middlewares.Coalesce(http.HandlerFunc(GetPostSuggestions))).Methods("GET").Queries("q", "{q}")
+	postsRouter.Handle("/batch", middlewares.Coalesce(http.HandlerFunc(GetPostsBatch))).Methods("GET").Queries("ids", "{ids}")
+	postsRouter.HandleFunc("/batch", GetPostsBatch).Methods("POST")
+	postsRouter.Handle("/archive", middlewares.Coalesce(http.HandlerFunc(GetPostArchive))).Methods("GET")
+	postsRouter.Handle("/archive/{year:[0-9]{4}}/{month:[0-9]{1,2}}", middlewares.Coalesce(http.HandlerFunc(GetPostArchiveMonth))).Methods("GET")
+	postsRouter.Handle("/accessibility", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(GetPostAccessibilityReport)))).Methods("GET")
+	postsRouter.Handle("/trash", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(GetTrashedPosts)))).Methods("GET")
+	postsRouter.Handle("/{id}/restore", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(RestorePost)))).Methods("POST")
+	postsRouter.Handle("/{slug:[a-z0-9-]+}", middlewares.OptionalTokenAuth(http.HandlerFunc(GetPostBySlug))).Methods("GET")
+	postsRouter.Handle("", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(CreatePost)))).Methods("POST")
+	postsRouter.Handle("", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(UpdatePost)))).Methods("PUT").Queries("id", "{id}")
+	postsRouter.Handle("", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(PatchPost)))).Methods("PATCH").Queries("id", "{id}")
+	postsRouter.Handle("", middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(DeletePost)))).Methods("DELETE").Queries("id", "{id}")
 }
 
 func GetPosts(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-
-	if id != "" {
+	// The display and public APIs serve single posts from their list route.
+	if r.URL.Query().Get("id") != "" {
 		GetPost(w, r)
 		return
 	}
 
-	ctx := r.Context()
-	posts, err := fetchPosts(ctx)
+	filter, err := parseListFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
 
+	ctx := r.Context()
+	var posts []models.Post
+	if filter.IsZero() {
+		posts, err = fetchPosts(ctx)
+	} else {
+		posts, err = fetchFilteredList(ctx, postsCacheEntity, filter, queryFilteredPosts)
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
+	}
+	lastModified, err := queryLastChange(ctx, "posts", nil)
 	if err != nil {
 		middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
 		return
 	}
 
-	middlewares.RespondJSON(w, posts, http.StatusOK)
+	setSurrogateKeys(w, surrogateKeyPosts, surrogateKeyPostsAll)
+	respondConditional(w, r, serializers.Posts(posts), lastModified)
 }
 
 func fetchPosts(ctx context.Context) ([]models.Post, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "posts").Result()
+	cacheKey, err := db.CacheKey(ctx, postsCacheEntity, "")
+	if err != nil {
+		return nil, err
+	}
+	cachedData, err := db.RedisClient.Get(ctx, cacheKey).Result()
+	metrics.ObserveCache(err)
 	if err == nil {
 		var posts []models.Post
 		if err := json.Unmarshal([]byte(cachedData), &posts); err != nil {
@@ -58,7 +114,82 @@ func fetchPosts(ctx context.Context) ([]models.Post, error) {
 		return nil, fmt.Errorf("error fetching posts from Redis cache: %w", err)
 	}
 
-	rows, err := db.DB.QueryContext(ctx, "SELECT id, title, excerpt, body, created_at FROM posts")
+	posts, err := queryPosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(posts)
+	if err == nil {
+		const CacheTime = 7 * 24 * time.Hour
+		db.RedisClient.Set(ctx, cacheKey, jsonData, CacheTime)
+	}
+
+	return posts, nil
+}
+
+const postColumns = "id, title, slug, excerpt, body, status, version, reading_time_minutes, published_at, created_at, updated_at, deleted_at, " +
+	"cover_image_url, meta_title, meta_description, canonical_url"
+
+func scanPost(row rowScanner) (models.Post, error) {
+	var post models.Post
+	err := row.Scan(&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.Body, &post.Status, &post.Version,
+		&post.ReadingTimeMinutes, &post.PublishedAt, &post.CreatedAt, &post.UpdatedAt, &post.DeletedAt,
+		&post.CoverImageURL, &post.MetaTitle, &post.MetaDescription, &post.CanonicalURL)
+	return post, err
+}
+
+// queryPostByID loads a post of any status that is not in the trash.
+func queryPostByID(ctx context.Context, id uuid.UUID) (models.Post, error) {
+	return scanPost(db.DB.QueryRowContext(ctx, "SELECT "+postColumns+" FROM posts WHERE id = $1 AND deleted_at IS NULL", id))
+}
+
+func postConflictFields(yours, theirs models.Post) []models.FieldConflict {
+	return conflictingFields(
+		fieldPair{"title", yours.Title, theirs.Title},
+		fieldPair{"excerpt", yours.Excerpt, theirs.Excerpt},
+		fieldPair{"body", yours.Body, theirs.Body},
+		fieldPair{"status", yours.Status, theirs.Status},
+		fieldPair{"cover_image_url", yours.CoverImageURL, theirs.CoverImageURL},
+		fieldPair{"meta_title", yours.MetaTitle, theirs.MetaTitle},
+		fieldPair{"meta_description", yours.MetaDescription, theirs.MetaDescription},
+		fieldPair{"canonical_url", yours.CanonicalURL, theirs.CanonicalURL},
+	)
+}
+
+// queryPosts loads all published posts from the database, bypassing the cache.
+func queryPosts(ctx context.Context) ([]models.Post, error) {
+	return queryPostsByStatus(ctx, models.PostStatusPublished)
+}
+
+// queryFilteredPosts loads the published posts that match filter, newest
+// first unless it asks for another order.
+func queryFilteredPosts(ctx context.Context, filter ListFilter) ([]models.Post, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+" FROM posts WHERE status = 'published' AND deleted_at IS NULL AND "+
+		listFilterClause+" ORDER BY "+filter.OrderBy("created_at DESC, id"), filter.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return posts, nil
+}
+
+func queryPostsByStatus(ctx context.Context, status string) ([]models.Post, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+" FROM posts WHERE status = $1 AND deleted_at IS NULL", status)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -70,8 +201,8 @@ func fetchPosts(ctx context.Context) ([]models.Post, error) {
 
 	var posts []models.Post
 	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Excerpt, &post.Body, &post.CreatedAt); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 		posts = append(posts, post)
@@ -81,12 +212,6 @@ func fetchPosts(ctx context.Context) ([]models.Post, error) {
 		return nil, fmt.Errorf("error iterating over rows: %w", err)
 	}
 
-	jsonData, err := json.Marshal(posts)
-	if err == nil {
-		const CacheTime = 7 * 24 * time.Hour
-		db.RedisClient.Set(ctx, "posts", jsonData, CacheTime)
-	}
-
 	return posts, nil
 }
 
@@ -103,12 +228,78 @@ func GetPost(w http.ResponseWriter, r *http.Request) {
 		middlewares.HttpError(w, "Post not found", http.StatusNotFound, err)
 		return
 	}
+	respondPost(w, r, post)
+}
+
+// respondPost counts a view of a published post and serves it with its view
+// count and validators for conditional requests.
+func respondPost(w http.ResponseWriter, r *http.Request, post models.Post) {
+	ctx := r.Context()
+	recordPostView(r, post.ID.String())
+	posts := []models.Post{post}
+	if err := fillPostViews(ctx, posts); err != nil {
+		middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+		return
+	}
+	lastModified, err := queryLastChange(ctx, "posts", &post.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+		return
+	}
+
+	payload := serializers.FromPost(posts[0])
+	links, seriesUpdatedAt, err := querySeriesLinks(ctx, post.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+		return
+	}
+	if links != nil {
+		payload.Series = links
+		if seriesUpdatedAt.After(lastModified) {
+			lastModified = seriesUpdatedAt
+		}
+	}
+
+	setSurrogateKeys(w, postSurrogateKey(post.ID.String()), surrogateKeyPostsAll)
+	respondConditional(w, r, payload, lastModified)
+}
+
+// GetPostBySlug serves a published post by its slug, given as ?slug= or as
+// /posts/{slug}.
+func GetPostBySlug(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	if slug == "" {
+		http.Error(w, "Slug parameter is required", http.StatusBadRequest)
+		return
+	}
 
-	middlewares.RespondJSON(w, post, http.StatusOK)
+	ctx := r.Context()
+	var id string
+	err := db.DB.QueryRowContext(ctx, "SELECT id FROM posts WHERE slug = $1 AND status = 'published' AND deleted_at IS NULL", slug).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Post not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+		return
+	}
+
+	post, err := fetchPost(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Post not found", http.StatusNotFound, err)
+		return
+	}
+	respondPost(w, r, post)
 }
 
 func fetchPost(ctx context.Context, postID string) (models.Post, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "post:"+postID).Result()
+	cacheKey, err := db.CacheKey(ctx, postsCacheEntity, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+	cachedData, err := db.RedisClient.Get(ctx, cacheKey).Result()
+	metrics.ObserveCache(err)
 
 	if err == nil {
 		var post models.Post
@@ -120,9 +311,29 @@ func fetchPost(ctx context.Context, postID string) (models.Post, error) {
 		return models.Post{}, fmt.Errorf("error fetching post %s from Redis cache: %w", postID, err)
 	}
 
-	var post models.Post
-	err = db.DB.QueryRowContext(ctx, "SELECT id, title, excerpt, body, created_at FROM posts WHERE id = $1", postID).
-		Scan(&post.ID, &post.Title, &post.Excerpt, &post.Body, &post.CreatedAt)
+	post, err := queryPost(ctx, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	jsonData, err := json.Marshal(post)
+
+	if err == nil {
+		const CacheTime = 7 * 24 * time.Hour
+		db.RedisClient.Set(ctx, cacheKey, jsonData, CacheTime)
+	}
+
+	return post, nil
+}
+
+// queryPost loads a single published post from the database, bypassing the cache.
+func queryPost(ctx context.Context, postID string) (models.Post, error) {
+	return queryPostWithStatus(ctx, postID, models.PostStatusPublished)
+}
+
+func queryPostWithStatus(ctx context.Context, postID, status string) (models.Post, error) {
+	post, err := scanPost(db.DB.QueryRowContext(ctx, "SELECT "+postColumns+" FROM posts WHERE id = $1 AND status = $2 AND deleted_at IS NULL",
+		postID, status))
 
 	if err != nil {
 
@@ -132,14 +343,46 @@ func fetchPost(ctx context.Context, postID string) (models.Post, error) {
 		return models.Post{}, fmt.Errorf("error querying database: %w", err)
 	}
 
-	jsonData, err := json.Marshal(post)
+	return post, nil
+}
 
-	if err == nil {
-		const CacheTime = 7 * 24 * time.Hour
-		db.RedisClient.Set(ctx, "post:"+postID, jsonData, CacheTime)
+// GetPostsByStatus lets editors list posts of any status, e.g. ?status=draft,
+// and preview a single unpublished post with ?id=...&status=draft. Published
+// posts remain public.
+func GetPostsByStatus(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if err := validation.ValidatePostStatus(status); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if status == models.PostStatusPublished {
+		GetPosts(w, r)
+		return
 	}
 
-	return post, nil
+	middlewares.TokenAuthMiddleware(middlewares.StaffOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if id := r.URL.Query().Get("id"); id != "" {
+			if _, err := uuid.Parse(id); err != nil {
+				middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+				return
+			}
+			post, err := queryPostWithStatus(ctx, id, status)
+			if err != nil {
+				middlewares.HttpError(w, "Post not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.RespondJSON(w, serializers.FromPost(post), http.StatusOK)
+			return
+		}
+
+		posts, err := queryPostsByStatus(ctx, status)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, serializers.Posts(posts), http.StatusOK)
+	}))).ServeHTTP(w, r)
 }
 
 func CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -151,27 +394,139 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := validation.ValidatePost(post); err != nil {
-		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	// Clients written before drafts existed expect posts to go live.
+	if post.Status == "" {
+		post.Status = models.PostStatusPublished
+	}
+	if err := validation.ValidatePost(&post); err != nil {
+		respondValidationError(w, err)
 		return
 	}
 
-	post.ID = uuid.New()
+	// Offline clients pick the ID themselves, which makes retrying safe.
+	if post.ID == uuid.Nil {
+		post.ID = uuid.New()
+	}
 	post.CreatedAt = time.Now()
-
-	if err := insertPost(ctx, post); err != nil {
+	post.UpdatedAt = post.CreatedAt
+
+	if err := insertPost(ctx, &post); err != nil {
+		if isPrimaryKeyViolation(err, "posts") {
+			existing, qErr := queryPostByID(ctx, post.ID)
+			if errors.Is(qErr, sql.ErrNoRows) {
+				http.Error(w, "The ID belongs to a post in the trash", http.StatusConflict)
+				return
+			}
+			if qErr == nil {
+				fields := postConflictFields(post, existing)
+				if len(fields) == 0 {
+					// The same create was retried after it had succeeded.
+					middlewares.RespondCreated(w, postLocation(existing.ID), postWriteResponse(existing))
+					return
+				}
+				respondConflict(w, ErrIDTaken, 0, existing.Version, serializers.FromPost(existing), fields)
+				return
+			}
+		}
 		middlewares.HttpError(w, "Failed to create post", http.StatusInternalServerError, err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "posts")
-	middlewares.RespondJSON(w, nil, http.StatusCreated)
+	db.DeleteCacheKeys(ctx, postsCacheEntity)
+	queueCDNPurge(ctx, surrogateKeyPosts)
+	if post.Status == models.PostStatusPublished {
+		events.Publish(ctx, events.TypePost, events.ActionCreated, post.ID.String())
+		queuePostSearchNotification(ctx, post.Slug)
+	}
+
+	created, err := queryPostByID(ctx, post.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch post", http.StatusInternalServerError, err)
+		return
+	}
+	firePostWebhook(ctx, "created", created)
+	if created.Status == models.PostStatusPublished {
+		firePostWebhook(ctx, "published", created)
+	}
+	middlewares.RespondCreated(w, postLocation(created.ID), postWriteResponse(created))
+}
+
+// postWriteResponse serializes a saved post. Published posts come with their
+// accessibility warnings, which do not stop the write but tell the editor
+// what to fix.
+func postWriteResponse(post models.Post) serializers.Post {
+	response := serializers.FromPost(post)
+	if post.Status == models.PostStatusPublished {
+		response.AccessibilityWarnings = validation.CheckPostAccessibility(post)
+	}
+	return response
 }
 
-func insertPost(ctx context.Context, post models.Post) error {
-	_, err := db.DB.ExecContext(ctx, "INSERT INTO posts (id, title, excerpt, body, created_at) VALUES ($1, $2, $3, $4, $5)",
-		post.ID, post.Title, post.Excerpt, post.Body, post.CreatedAt)
-	return err
+// postLocation is the URL of a post for Location headers.
+func postLocation(id uuid.UUID) string {
+	return "/posts?id=" + id.String()
+}
+
+// insertPost stores a new post under a slug derived from its title. The slug
+// does not follow later title edits, so links keep working; editors can
+// still change it explicitly.
+func insertPost(ctx context.Context, post *models.Post) error {
+	var publishedAt *time.Time
+	if post.Status == models.PostStatusPublished {
+		publishedAt = &post.CreatedAt
+	}
+
+	base := utils.Slugify(post.Title, "post")
+	for attempt := 0; attempt < 3; attempt++ {
+		slug, err := freePostSlug(ctx, base)
+		if err != nil {
+			return err
+		}
+		_, err = db.DB.ExecContext(ctx, `INSERT INTO posts (id, title, slug, excerpt, body, status, published_at, content_hash, created_at,
+				updated_at, reading_time_minutes, cover_image_url, meta_title, meta_description, canonical_url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10, $11, $12, $13, $14)`,
+			post.ID, post.Title, slug, post.Excerpt, post.Body, post.Status, publishedAt, post.ComputeContentHash(), post.CreatedAt,
+			readingTimeMinutes(post.Body), post.CoverImageURL, post.MetaTitle, post.MetaDescription, post.CanonicalURL)
+		// Another post may have taken the slug since it was picked.
+		if isUniqueViolation(err) && !isPrimaryKeyViolation(err, "posts") {
+			continue
+		}
+		if err == nil {
+			post.Slug = slug
+		}
+		return err
+	}
+	return fmt.Errorf("error picking a slug for %q", base)
+}
+
+// freePostSlug returns base, or base-N with the lowest N that is not taken.
+func freePostSlug(ctx context.Context, base string) (string, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT slug FROM posts WHERE slug = $1 OR slug ~ ('^' || $1 || '-[0-9]+$')`, base)
+	if err != nil {
+		return "", fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for slug := range reservedPostSlugs {
+		taken[slug] = true
+	}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return "", fmt.Errorf("error scanning row: %w", err)
+		}
+		taken[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for n := 1; ; n++ {
+		if slug := utils.NumberedSlug(base, n); !taken[slug] {
+			return slug, nil
+		}
+	}
 }
 
 func UpdatePost(w http.ResponseWriter, r *http.Request) {
@@ -197,27 +552,199 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := validation.ValidatePost(post); err != nil {
-		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	// The stored status is kept when none is given, and tells whether this
+	// update publishes the post.
+	var previousStatus string
+	err = db.DB.QueryRowContext(ctx, "SELECT status FROM posts WHERE id = $1", id).Scan(&previousStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "post", "Post not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update post", http.StatusInternalServerError, err)
+		return
+	}
+
+	if post.Status == "" {
+		post.Status = previousStatus
+	}
+	if err := validation.ValidatePost(&post); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+	if err := validatePostSlug(post.Slug); err != nil {
+		respondValidationError(w, err)
 		return
 	}
 
 	post.ID = id
 
-	if err := updatePost(ctx, post); err != nil {
+	// A version makes the write conditional: it only applies if nobody else
+	// changed the post since the client read that version.
+	updated, err := updatePost(ctx, post, post.Version)
+	if errors.Is(err, sql.ErrNoRows) && post.Version > 0 {
+		current, err := queryPostByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondNotFound(w, "post", "Post not found", idStr, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to update post", http.StatusInternalServerError, err)
+			return
+		}
+		respondConflict(w, ErrVersionConflict, post.Version, current.Version, serializers.FromPost(current), postConflictFields(post, current))
+		return
+	}
+	if isUniqueViolation(err) {
+		middlewares.HttpError(w, "slug is already taken", http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "post", "Post not found", idStr, err)
+		return
+	}
+	if err != nil {
 		middlewares.HttpError(w, "Failed to update post", http.StatusInternalServerError, err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "post:"+idStr)
-	db.RedisClient.Del(ctx, "posts")
-	middlewares.RespondJSON(w, nil, http.StatusNoContent)
+	postUpdated(ctx, updated, previousStatus)
+	middlewares.RespondJSON(w, postWriteResponse(updated), http.StatusOK)
 }
 
-func updatePost(ctx context.Context, post models.Post) error {
-	_, err := db.DB.ExecContext(ctx, "UPDATE posts SET title = $1, excerpt = $2, body = $3, created_at = $4 WHERE id = $5",
-		post.Title, post.Excerpt, post.Body, post.CreatedAt, post.ID)
-	return err
+// updatePost saves a post and returns it. With a non-zero expectedVersion
+// nothing is written unless the stored version matches; sql.ErrNoRows is
+// returned when no post was updated. An empty slug keeps the current one; a
+// changed slug gets a redirect from the old path (see the redirects table).
+func updatePost(ctx context.Context, post models.Post, expectedVersion int) (models.Post, error) {
+	// published_at records the first publication and survives unpublishing.
+	// created_at never changes and updated_at is set by the posts_touch
+	// trigger.
+	return scanPost(db.DB.QueryRowContext(ctx, `UPDATE posts SET title = $1, excerpt = $2, body = $3, content_hash = $4,
+			status = $5::VARCHAR, published_at = CASE WHEN $5::VARCHAR = 'published' THEN COALESCE(published_at, NOW()) ELSE published_at END,
+			slug = COALESCE(NULLIF($8::VARCHAR, ''), slug), reading_time_minutes = $9, version = version + 1,
+			cover_image_url = $10, meta_title = $11, meta_description = $12, canonical_url = $13
+		WHERE id = $6 AND ($7::integer = 0 OR version = $7::integer) AND deleted_at IS NULL
+		RETURNING `+postColumns,
+		post.Title, post.Excerpt, post.Body, post.ComputeContentHash(), post.Status, post.ID, expectedVersion,
+		post.Slug, readingTimeMinutes(post.Body), post.CoverImageURL, post.MetaTitle, post.MetaDescription, post.CanonicalURL))
+}
+
+// readingWordsPerMinute is the reading speed behind reading time estimates.
+const readingWordsPerMinute = 200
+
+// readingTimeMinutes estimates how long body takes to read, at least a
+// minute. The add_reading_time_to_posts migration mirrors it in SQL.
+func readingTimeMinutes(body string) int {
+	words := validation.WordCount(body)
+	return max(1, (words+readingWordsPerMinute-1)/readingWordsPerMinute)
+}
+
+// validatePostSlug checks a slug an editor picked. An empty slug keeps the
+// current one.
+func validatePostSlug(slug string) error {
+	if slug == "" {
+		return nil
+	}
+	var errs validation.ValidationError
+	if err := validation.ValidateSlug(slug); err != nil {
+		errs.Add("slug", validation.RuleInvalid, err.Error())
+	} else if reservedPostSlugs[slug] {
+		errs.Add("slug", validation.RuleReserved, "slug is reserved")
+	}
+	return errs.Err()
+}
+
+// postUpdated clears the caches of a saved post and tells subscribers and
+// webhooks about the change. previousStatus is the status before the write.
+func postUpdated(ctx context.Context, post models.Post, previousStatus string) {
+	idStr := post.ID.String()
+	db.DeleteCacheKeys(ctx, postsCacheEntity, idStr)
+	queueCDNPurge(ctx, surrogateKeyPosts, postSurrogateKey(idStr))
+	// To readers, a post that is no longer published has been removed.
+	if post.Status == models.PostStatusPublished {
+		events.Publish(ctx, events.TypePost, events.ActionUpdated, idStr)
+		queuePostSearchNotification(ctx, post.Slug)
+	} else {
+		events.Publish(ctx, events.TypePost, events.ActionDeleted, idStr)
+	}
+
+	firePostWebhook(ctx, "updated", post)
+	if post.Status == models.PostStatusPublished && previousStatus != models.PostStatusPublished {
+		firePostWebhook(ctx, "published", post)
+	}
+}
+
+// PatchPost updates only the fields present in the body, see
+// models.PostPatch. Without a version in the body the patch applies to
+// whatever is stored, but it never overwrites a concurrent change to other
+// fields: it is retried on top of it instead.
+func PatchPost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var patch models.PostPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		current, err := queryPostByID(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondNotFound(w, "post", "Post not found", id.String(), err)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to update post", http.StatusInternalServerError, err)
+			return
+		}
+
+		post := current
+		patch.Apply(&post)
+		if err := validation.ValidatePost(&post); err != nil {
+			respondValidationError(w, err)
+			return
+		}
+		if patch.Slug != nil {
+			if err := validatePostSlug(post.Slug); err != nil {
+				respondValidationError(w, err)
+				return
+			}
+		}
+
+		expectedVersion := patch.Version
+		if expectedVersion == 0 {
+			expectedVersion = current.Version
+		}
+		updated, err := updatePost(ctx, post, expectedVersion)
+		if errors.Is(err, sql.ErrNoRows) {
+			if patch.Version > 0 {
+				respondConflict(w, ErrVersionConflict, patch.Version, current.Version, serializers.FromPost(current), postConflictFields(post, current))
+				return
+			}
+			continue
+		}
+		if isUniqueViolation(err) {
+			middlewares.HttpError(w, "slug is already taken", http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to update post", http.StatusInternalServerError, err)
+			return
+		}
+
+		postUpdated(ctx, updated, current.Status)
+		middlewares.RespondJSON(w, postWriteResponse(updated), http.StatusOK)
+		return
+	}
+	http.Error(w, "The post keeps changing, try again", http.StatusConflict)
 }
 
 func DeletePost(w http.ResponseWriter, r *http.Request) {
@@ -235,16 +762,120 @@ func DeletePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := deletePost(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondNotFound(w, "post", "Post not found", idStr, err)
+			return
+		}
 		middlewares.HttpError(w, "Failed to delete post", http.StatusInternalServerError, err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "post:"+idStr)
-	db.RedisClient.Del(ctx, "posts")
+	db.DeleteCacheKeys(ctx, postsCacheEntity, idStr)
+	queueCDNPurge(ctx, surrogateKeyPosts, postSurrogateKey(idStr))
+	events.Publish(ctx, events.TypePost, events.ActionDeleted, idStr)
+	fireWebhook(ctx, "post.deleted", "Post deleted", map[string]string{"id": idStr})
 	middlewares.RespondJSON(w, nil, http.StatusNoContent)
 }
 
+// deletePost moves a post to the trash. It keeps its slug, so restoring it
+// brings back its old links. sql.ErrNoRows is returned when there is no such
+// post, or it is already in the trash.
 func deletePost(ctx context.Context, id uuid.UUID) error {
-	_, err := db.DB.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
-	return err
+	result, err := db.DB.ExecContext(ctx, "UPDATE posts SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// GetTrashedPosts returns a page of the posts in the trash, most recently
+// deleted first.
+func GetTrashedPosts(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE deleted_at IS NOT NULL").Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch trash", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+postColumns+` FROM posts
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+		LIMIT $1 OFFSET $2`, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch trash", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch trash", http.StatusInternalServerError, err)
+			return
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch trash", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[serializers.Post]{
+		Items:   serializers.Posts(posts),
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// RestorePost takes a post out of the trash with the status it had.
+func RestorePost(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	post, err := scanPost(db.DB.QueryRowContext(ctx, `UPDATE posts SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+postColumns, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Post not found in trash", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to restore post", http.StatusInternalServerError, err)
+		return
+	}
+
+	db.DeleteCacheKeys(ctx, postsCacheEntity)
+	queueCDNPurge(ctx, surrogateKeyPosts)
+	if post.Status == models.PostStatusPublished {
+		events.Publish(ctx, events.TypePost, events.ActionCreated, post.ID.String())
+	}
+	firePostWebhook(ctx, "created", post)
+	middlewares.RespondJSON(w, serializers.FromPost(post), http.StatusOK)
+}
+
+// PurgeTrashedPosts permanently deletes posts that have been in the trash
+// longer than trashRetention.
+func PurgeTrashedPosts(ctx context.Context) error {
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM posts WHERE deleted_at < NOW() - $1 * INTERVAL '1 second'",
+		trashRetention.Seconds())
+	if err != nil {
+		return fmt.Errorf("error purging trash: %w", err)
+	}
+	if purged, err := result.RowsAffected(); err == nil && purged > 0 {
+		log.Printf("Purged %d posts from the trash", purged)
+	}
+	return nil
 }
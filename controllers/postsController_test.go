@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"jsmi-api/models"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const missingPostBody = `{"title": "Sunday service", "excerpt": "Highlights", "body": "<p>Text</p>", "status": "published"}`
+
+func TestDeletePostReportsMissingRows(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name     string
+		affected int64
+		want     error
+	}{
+		{"missing", 0, sql.ErrNoRows},
+		{"trashed", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE posts SET deleted_at = NOW()")).
+				WithArgs(id).
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			if err := deletePost(context.Background(), id); !errors.Is(err, tt.want) {
+				t.Errorf("deletePost() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeletePostMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE posts SET deleted_at = NOW()")).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder := serve(DeletePost, http.MethodDelete, "/posts?id="+id.String(), "")
+	assertNotFound(t, recorder, "post", id.String())
+}
+
+func TestDeletePostDatabaseErrorReturns500(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE posts SET deleted_at = NOW()")).
+		WithArgs(id).
+		WillReturnError(errors.New("connection reset"))
+
+	recorder := serve(DeletePost, http.MethodDelete, "/posts?id="+id.String(), "")
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestUpdatePostMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM posts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}))
+
+	recorder := serve(UpdatePost, http.MethodPut, "/posts?id="+id.String(), missingPostBody)
+	assertNotFound(t, recorder, "post", id.String())
+}
+
+func TestUpdatePostKeepsStatusWhenMissing(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM posts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.PostStatusDraft))
+	args := make([]driver.Value, 13)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[4], args[5] = models.PostStatusDraft, id
+	// No row comes back, so the test stops at the UPDATE and its arguments.
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE posts SET title = $1")).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	body := `{"title": "Sunday service", "excerpt": "Highlights", "body": "<p>Text</p>"}`
+	recorder := serve(UpdatePost, http.MethodPut, "/posts?id="+id.String(), body)
+	assertNotFound(t, recorder, "post", id.String())
+}
+
+func TestPatchPostMissingReturns404(t *testing.T) {
+	mock := mockDB(t)
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM posts WHERE id = $1 AND deleted_at IS NULL")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	recorder := serve(PatchPost, http.MethodPatch, "/posts?id="+id.String(), `{"title": "New title"}`)
+	assertNotFound(t, recorder, "post", id.String())
+}
+
+func TestPostRoutesDispatchQueries(t *testing.T) {
+	router := mux.NewRouter()
+	SetupPostRoutes(router)
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/posts?slug=sunday-service", []string{"slug={slug}"}},
+		{"/posts?id=" + uuid.NewString(), []string{"id={id}"}},
+		{"/posts?status=draft", []string{"status={status}"}},
+		{"/posts", nil},
+		{"/posts?tag=youth", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var match mux.RouteMatch
+			if !router.Match(httptest.NewRequest(http.MethodGet, tt.target, nil), &match) {
+				t.Fatalf("no route matches GET %s", tt.target)
+			}
+			queries, _ := match.Route.GetQueriesTemplates()
+			if !slices.Equal(queries, tt.want) {
+				t.Errorf("GET %s matched the route with queries %v, want %v", tt.target, queries, tt.want)
+			}
+		})
+	}
+}
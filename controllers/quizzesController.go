@@ -0,0 +1,484 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrQuizNotFound      = errors.New("quiz not found")
+	ErrNoAttemptsLeft    = errors.New("no attempts left for this quiz")
+	ErrIncompleteAnswers = errors.New("answers must cover every question")
+)
+
+// setupQuizRoutes registers the quiz endpoints under /courses. Admins manage
+// quizzes and are the only ones who see the answer key.
+func setupQuizRoutes(coursesRouter *mux.Router) {
+	user := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(h)
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.AdminOnly(h))
+	}
+
+	coursesRouter.Handle("/quizzes", user(GetQuizzes)).Methods("GET")
+	coursesRouter.Handle("/quizzes", admin(CreateQuiz)).Methods("POST").Queries("course_id", "{course_id}")
+	coursesRouter.Handle("/quizzes", admin(UpdateQuiz)).Methods("PUT").Queries("id", "{id}")
+	coursesRouter.Handle("/quizzes", admin(DeleteQuiz)).Methods("DELETE").Queries("id", "{id}")
+	coursesRouter.Handle("/quizzes/submit", user(SubmitQuiz)).Methods("POST").Queries("id", "{id}")
+	coursesRouter.Handle("/quizzes/results", user(GetQuizResults)).Methods("GET").Queries("id", "{id}")
+}
+
+// GetQuizzes returns one quiz with its questions when an id is given, or the
+// quizzes of a course when a course_id is given.
+func GetQuizzes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	if idStr := query.Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(ctx)
+		role, err := middlewares.UserRole(ctx, userID)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to check user role", http.StatusInternalServerError, err)
+			return
+		}
+
+		quiz, err := queryQuiz(ctx, db.DB, id, role == middlewares.RoleAdmin)
+		if err != nil {
+			if errors.Is(err, ErrQuizNotFound) {
+				middlewares.HttpError(w, "Quiz not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch quiz", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, quiz, http.StatusOK)
+		return
+	}
+
+	courseID, err := uuid.Parse(query.Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, course_id, title, pass_percent, max_attempts, created_at, updated_at
+		FROM quizzes WHERE course_id = $1 ORDER BY created_at`, courseID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch quizzes", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	quizzes := []models.Quiz{}
+	for rows.Next() {
+		var quiz models.Quiz
+		if err := rows.Scan(&quiz.ID, &quiz.CourseID, &quiz.Title, &quiz.PassPercent, &quiz.MaxAttempts,
+			&quiz.CreatedAt, &quiz.UpdatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch quizzes", http.StatusInternalServerError, err)
+			return
+		}
+		quizzes = append(quizzes, quiz)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch quizzes", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, quizzes, http.StatusOK)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queryQuiz loads a quiz and its questions. The answer key is only included
+// when withAnswers is set.
+func queryQuiz(ctx context.Context, q queryer, id uuid.UUID, withAnswers bool) (models.Quiz, error) {
+	var quiz models.Quiz
+	err := q.QueryRowContext(ctx, `SELECT id, course_id, title, pass_percent, max_attempts, created_at, updated_at
+		FROM quizzes WHERE id = $1`, id).
+		Scan(&quiz.ID, &quiz.CourseID, &quiz.Title, &quiz.PassPercent, &quiz.MaxAttempts, &quiz.CreatedAt, &quiz.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Quiz{}, ErrQuizNotFound
+		}
+		return models.Quiz{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT id, position, prompt, options, correct_option
+		FROM quiz_questions WHERE quiz_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return models.Quiz{}, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	quiz.Questions = []models.QuizQuestion{}
+	for rows.Next() {
+		var question models.QuizQuestion
+		var options []byte
+		var correct int
+		if err := rows.Scan(&question.ID, &question.Position, &question.Prompt, &options, &correct); err != nil {
+			return models.Quiz{}, fmt.Errorf("error scanning row: %w", err)
+		}
+		if err := json.Unmarshal(options, &question.Options); err != nil {
+			return models.Quiz{}, fmt.Errorf("error decoding options: %w", err)
+		}
+		if withAnswers {
+			question.CorrectOption = &correct
+		}
+		quiz.Questions = append(quiz.Questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Quiz{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return quiz, nil
+}
+
+func CreateQuiz(w http.ResponseWriter, r *http.Request) {
+	courseID, err := uuid.Parse(r.URL.Query().Get("course_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid course_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var quiz models.Quiz
+	if err := json.NewDecoder(r.Body).Decode(&quiz); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateQuiz(&quiz); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	quiz.ID = uuid.New()
+	quiz.CourseID = courseID
+	ctx := r.Context()
+	if err := saveQuiz(ctx, quiz, true); err != nil {
+		respondQuizError(w, "Failed to create quiz", err)
+		return
+	}
+
+	saved, err := queryQuiz(ctx, db.DB, quiz.ID, true)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch quiz", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, saved, http.StatusCreated)
+}
+
+// UpdateQuiz replaces a quiz's settings and questions. Past attempts keep the
+// score they were graded with.
+func UpdateQuiz(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var quiz models.Quiz
+	if err := json.NewDecoder(r.Body).Decode(&quiz); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateQuiz(&quiz); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	quiz.ID = id
+	ctx := r.Context()
+	if err := saveQuiz(ctx, quiz, false); err != nil {
+		respondQuizError(w, "Failed to update quiz", err)
+		return
+	}
+
+	saved, err := queryQuiz(ctx, db.DB, quiz.ID, true)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch quiz", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, saved, http.StatusOK)
+}
+
+func respondQuizError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrQuizNotFound):
+		middlewares.HttpError(w, "Quiz not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrCourseNotFound):
+		middlewares.HttpError(w, "Course not found", http.StatusNotFound, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// saveQuiz inserts or updates a quiz and replaces its questions.
+func saveQuiz(ctx context.Context, quiz models.Quiz, create bool) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if create {
+		_, err = tx.ExecContext(ctx, `INSERT INTO quizzes (id, course_id, title, pass_percent, max_attempts)
+			VALUES ($1, $2, $3, $4, $5)`, quiz.ID, quiz.CourseID, quiz.Title, quiz.PassPercent, quiz.MaxAttempts)
+		if isForeignKeyViolation(err) {
+			return ErrCourseNotFound
+		} else if err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.ExecContext(ctx, `UPDATE quizzes SET title = $1, pass_percent = $2, max_attempts = $3, updated_at = NOW()
+			WHERE id = $4`, quiz.Title, quiz.PassPercent, quiz.MaxAttempts, quiz.ID)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrQuizNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM quiz_questions WHERE quiz_id = $1", quiz.ID); err != nil {
+			return err
+		}
+	}
+
+	for i, question := range quiz.Questions {
+		options, err := json.Marshal(question.Options)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO quiz_questions (quiz_id, position, prompt, options, correct_option)
+			VALUES ($1, $2, $3, $4, $5)`, quiz.ID, i+1, question.Prompt, options, *question.CorrectOption)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func DeleteQuiz(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM quizzes WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete quiz", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Quiz not found", http.StatusNotFound, ErrQuizNotFound)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Quiz deleted"}, http.StatusOK)
+}
+
+// SubmitQuiz grades a submission. The body maps every question ID to the
+// index of the chosen option. Passing the last outstanding quiz or lesson
+// completes the course.
+func SubmitQuiz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	quizID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		Answers map[uuid.UUID]int `json:"answers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := gradeQuiz(ctx, quizID, userID, payload.Answers)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrQuizNotFound):
+			middlewares.HttpError(w, "Quiz not found", http.StatusNotFound, err)
+		case errors.Is(err, ErrNotEnrolled):
+			middlewares.HttpError(w, "Not enrolled in this course", http.StatusForbidden, err)
+		case errors.Is(err, ErrNoAttemptsLeft):
+			middlewares.HttpError(w, "No attempts left for this quiz", http.StatusConflict, err)
+		case errors.Is(err, ErrIncompleteAnswers):
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		default:
+			middlewares.HttpError(w, "Failed to submit quiz", http.StatusInternalServerError, err)
+		}
+		return
+	}
+	clearDashboardSection(ctx, userID, dashboardCourses)
+
+	progress, err := queryCourseProgress(ctx, result.courseID, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch progress", http.StatusInternalServerError, err)
+		return
+	}
+	result.Progress = &progress
+
+	middlewares.RespondJSON(w, result.QuizResult, http.StatusCreated)
+}
+
+type gradedQuiz struct {
+	models.QuizResult
+	courseID uuid.UUID
+}
+
+func gradeQuiz(ctx context.Context, quizID uuid.UUID, userID int64, answers map[uuid.UUID]int) (gradedQuiz, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return gradedQuiz{}, err
+	}
+	defer tx.Rollback()
+
+	quiz, err := queryQuiz(ctx, tx, quizID, true)
+	if err != nil {
+		return gradedQuiz{}, err
+	}
+
+	// The enrollment lock also serialises attempts, so the attempt limit
+	// cannot be bypassed with concurrent submissions.
+	completed, err := lockEnrollment(ctx, tx, quiz.CourseID, userID)
+	if err != nil {
+		return gradedQuiz{}, err
+	}
+
+	var used int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM quiz_attempts WHERE quiz_id = $1 AND user_id = $2",
+		quizID, userID).Scan(&used); err != nil {
+		return gradedQuiz{}, err
+	}
+	if quiz.MaxAttempts > 0 && used >= quiz.MaxAttempts {
+		return gradedQuiz{}, ErrNoAttemptsLeft
+	}
+
+	result := gradedQuiz{courseID: quiz.CourseID}
+	result.Correct = make(map[uuid.UUID]bool, len(quiz.Questions))
+	correctCount := 0
+	for _, question := range quiz.Questions {
+		answer, ok := answers[question.ID]
+		if !ok {
+			return gradedQuiz{}, ErrIncompleteAnswers
+		}
+		result.Correct[question.ID] = answer == *question.CorrectOption
+		if result.Correct[question.ID] {
+			correctCount++
+		}
+	}
+	if len(answers) != len(quiz.Questions) {
+		return gradedQuiz{}, ErrIncompleteAnswers
+	}
+
+	attempt := models.QuizAttempt{
+		ID:        uuid.New(),
+		QuizID:    quizID,
+		Answers:   answers,
+		CreatedAt: time.Now(),
+	}
+	if len(quiz.Questions) > 0 {
+		attempt.ScorePercent = correctCount * 100 / len(quiz.Questions)
+	}
+	attempt.Passed = attempt.ScorePercent >= quiz.PassPercent
+
+	answersJSON, err := json.Marshal(attempt.Answers)
+	if err != nil {
+		return gradedQuiz{}, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO quiz_attempts (id, quiz_id, user_id, score_percent, passed, answers, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		attempt.ID, attempt.QuizID, userID, attempt.ScorePercent, attempt.Passed, answersJSON, attempt.CreatedAt)
+	if err != nil {
+		return gradedQuiz{}, err
+	}
+
+	if attempt.Passed && !completed {
+		if err := completeCourseIfDone(ctx, tx, quiz.CourseID, userID); err != nil {
+			return gradedQuiz{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return gradedQuiz{}, err
+	}
+
+	result.Attempt = attempt
+	if quiz.MaxAttempts > 0 {
+		remaining := quiz.MaxAttempts - used - 1
+		result.AttemptsRemaining = &remaining
+	}
+	return result, nil
+}
+
+// GetQuizResults lists the current user's attempts at a quiz, newest first.
+func GetQuizResults(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	quizID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, quiz_id, score_percent, passed, answers, created_at
+		FROM quiz_attempts WHERE quiz_id = $1 AND user_id = $2 ORDER BY created_at DESC`, quizID, userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch quiz results", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	attempts := []models.QuizAttempt{}
+	for rows.Next() {
+		var attempt models.QuizAttempt
+		var answers []byte
+		if err := rows.Scan(&attempt.ID, &attempt.QuizID, &attempt.ScorePercent, &attempt.Passed, &answers,
+			&attempt.CreatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch quiz results", http.StatusInternalServerError, err)
+			return
+		}
+		if err := json.Unmarshal(answers, &attempt.Answers); err != nil {
+			middlewares.HttpError(w, "Failed to decode quiz answers", http.StatusInternalServerError, err)
+			return
+		}
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch quiz results", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, attempts, http.StatusOK)
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRedirectHops bounds how many redirects GET /resolve follows, in case
+// manual redirects form a chain or a loop.
+const maxRedirectHops = 5
+
+var ErrRedirectNotFound = errors.New("redirect not found")
+
+func SetupRedirectRoutes(r *mux.Router) {
+	r.Handle("/resolve", middlewares.Coalesce(http.HandlerFunc(ResolvePath))).Methods("GET").Queries("path", "{path}")
+}
+
+// ResolvePath tells the frontend what lives at a path: published content is
+// answered with 200 and its ID, a path that moved with its redirect. Content
+// wins over redirects, so a path that is in use again is never redirected.
+func ResolvePath(w http.ResponseWriter, r *http.Request) {
+	path, err := validation.NormalizePath(r.URL.Query().Get("path"))
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	resolved, err := resolvePath(ctx, path)
+	if err != nil {
+		if errors.Is(err, ErrRedirectNotFound) {
+			middlewares.HttpError(w, "Nothing found at "+path, http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to resolve path", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, resolved, http.StatusOK)
+}
+
+func resolvePath(ctx context.Context, path string) (models.ResolvedPath, error) {
+	resolved := models.ResolvedPath{Path: path}
+	current := path
+	for hop := 0; hop <= maxRedirectHops; hop++ {
+		if id, ok, err := contentAt(ctx, current); err != nil {
+			return models.ResolvedPath{}, err
+		} else if ok {
+			if current == path {
+				resolved.StatusCode = http.StatusOK
+				resolved.Type = "post"
+				resolved.ID = id
+			}
+			return resolved, nil
+		}
+
+		var redirect models.Redirect
+		err := db.DB.QueryRowContext(ctx, "SELECT to_path, status_code FROM redirects WHERE from_path = $1", current).
+			Scan(&redirect.ToPath, &redirect.StatusCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			// A redirect to a path that has nothing behind it is still
+			// followed, the frontend may serve it itself.
+			if current != path {
+				return resolved, nil
+			}
+			return models.ResolvedPath{}, ErrRedirectNotFound
+		}
+		if err != nil {
+			return models.ResolvedPath{}, fmt.Errorf("error querying database: %w", err)
+		}
+
+		// The first redirect decides whether the move is permanent.
+		if current == path {
+			resolved.StatusCode = redirect.StatusCode
+		}
+		resolved.Location = redirect.ToPath
+		current = redirect.ToPath
+	}
+	return resolved, nil
+}
+
+// contentAt returns the ID of the published content at a path.
+func contentAt(ctx context.Context, path string) (string, bool, error) {
+	slug, ok := strings.CutPrefix(path, "/posts/")
+	if !ok || validation.ValidateSlug(slug) != nil {
+		return "", false, nil
+	}
+	var id string
+	err := db.DB.QueryRowContext(ctx, "SELECT id FROM posts WHERE slug = $1 AND status = 'published' AND deleted_at IS NULL", slug).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error querying database: %w", err)
+	}
+	return id, true, nil
+}
+
+// GetRedirects lists redirects, newest first, optionally only those to_path
+// points at.
+func GetRedirects(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	toPath := r.URL.Query().Get("to_path")
+
+	ctx := r.Context()
+	const filter = `($1 = '' OR to_path = $1)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM redirects WHERE "+filter, toPath).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch redirects", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT from_path, to_path, status_code, automatic, created_by, created_at
+		FROM redirects
+		WHERE `+filter+`
+		ORDER BY created_at DESC, from_path
+		LIMIT $2 OFFSET $3`, toPath, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch redirects", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	redirects := []models.Redirect{}
+	for rows.Next() {
+		var redirect models.Redirect
+		if err := rows.Scan(&redirect.FromPath, &redirect.ToPath, &redirect.StatusCode, &redirect.Automatic,
+			&redirect.CreatedBy, &redirect.CreatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch redirects", http.StatusInternalServerError, err)
+			return
+		}
+		redirects = append(redirects, redirect)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch redirects", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.Redirect]{
+		Items:   redirects,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// SaveRedirect creates a redirect or replaces the one from the same path.
+func SaveRedirect(w http.ResponseWriter, r *http.Request) {
+	var redirect models.Redirect
+	if err := json.NewDecoder(r.Body).Decode(&redirect); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if redirect.StatusCode == 0 {
+		redirect.StatusCode = http.StatusMovedPermanently
+	}
+
+	var err error
+	if redirect.FromPath, err = validation.NormalizePath(redirect.FromPath); err != nil {
+		middlewares.HttpError(w, "from_path: "+err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if redirect.ToPath, err = validation.NormalizePath(redirect.ToPath); err != nil {
+		middlewares.HttpError(w, "to_path: "+err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateRedirect(redirect); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	err = db.DB.QueryRowContext(ctx, `INSERT INTO redirects (from_path, to_path, status_code, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (from_path) DO UPDATE SET to_path = EXCLUDED.to_path, status_code = EXCLUDED.status_code,
+			automatic = FALSE, created_by = EXCLUDED.created_by, created_at = CURRENT_TIMESTAMP
+		RETURNING automatic, created_by, created_at`,
+		redirect.FromPath, redirect.ToPath, redirect.StatusCode, userID).
+		Scan(&redirect.Automatic, &redirect.CreatedBy, &redirect.CreatedAt)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to save redirect", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, redirect, http.StatusOK)
+}
+
+// DeleteRedirect removes the redirect from a path.
+func DeleteRedirect(w http.ResponseWriter, r *http.Request) {
+	path, err := validation.NormalizePath(r.URL.Query().Get("from_path"))
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM redirects WHERE from_path = $1", path)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete redirect", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Redirect not found", http.StatusNotFound, ErrRedirectNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
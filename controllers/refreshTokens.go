@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/models"
+	"jsmi-api/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Error codes returned with 401 responses from /auth/refresh-token. On any of
+// them the frontend must send the user back to the login page.
+const (
+	RefreshErrorInvalid   = "invalid_refresh_token"
+	RefreshErrorRevoked   = "refresh_token_revoked"
+	RefreshErrorReused    = "refresh_token_reused"
+	RefreshErrorSuspended = "account_suspended"
+)
+
+var (
+	ErrRefreshTokenUnknown = errors.New("refresh token is not known")
+	ErrRefreshTokenRevoked = errors.New("refresh token has been revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+	ErrAccountSuspended    = errors.New("account is suspended")
+)
+
+// rotatedRefreshToken is the result of a successful refresh token rotation.
+type rotatedRefreshToken struct {
+	UserID    int64
+	Username  string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// issueRefreshToken creates and records a refresh token in the given family.
+func issueRefreshToken(ctx context.Context, userID int64, familyID uuid.UUID, expiresAt time.Time) (string, error) {
+	token, tokenID, err := utils.GenerateRefreshToken(userID, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO refresh_tokens (id, family_id, user_id, expires_at) VALUES ($1, $2, $3, $4)`,
+		tokenID, familyID, userID, expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("error storing refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// rotateRefreshToken exchanges a valid refresh token for a new one in the same
+// family. The new token keeps the family's expiry, so rotation never extends a
+// session beyond the lifetime chosen at login. If the token was already
+// rotated, it has leaked: the whole family is revoked and
+// ErrRefreshTokenReused is returned along with the owner for auditing.
+// Suspended users get ErrAccountSuspended instead of a new token.
+func rotateRefreshToken(ctx context.Context, claims *utils.CustomClaims) (rotatedRefreshToken, error) {
+	if claims.TokenID == "" {
+		return rotatedRefreshToken{}, ErrRefreshTokenUnknown
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return rotatedRefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		result    rotatedRefreshToken
+		familyID  uuid.UUID
+		status    string
+		rotatedAt sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `SELECT rt.family_id, rt.user_id, u.username, u.status, rt.expires_at, rt.rotated_at, rt.revoked_at
+		FROM refresh_tokens rt
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.id = $1
+		FOR UPDATE OF rt`, claims.TokenID).
+		Scan(&familyID, &result.UserID, &result.Username, &status, &result.ExpiresAt, &rotatedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && result.UserID != claims.UserID) {
+		return rotatedRefreshToken{}, ErrRefreshTokenUnknown
+	} else if err != nil {
+		return rotatedRefreshToken{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	if revokedAt.Valid {
+		return result, ErrRefreshTokenRevoked
+	}
+	if rotatedAt.Valid {
+		if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE family_id = $1 AND revoked_at IS NULL`, familyID); err != nil {
+			return rotatedRefreshToken{}, fmt.Errorf("error revoking token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return rotatedRefreshToken{}, err
+		}
+		return result, ErrRefreshTokenReused
+	}
+	if status == models.UserStatusSuspended {
+		return result, ErrAccountSuspended
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1", claims.TokenID); err != nil {
+		return rotatedRefreshToken{}, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	token, tokenID, err := utils.GenerateRefreshToken(result.UserID, result.ExpiresAt)
+	if err != nil {
+		return rotatedRefreshToken{}, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO refresh_tokens (id, family_id, user_id, expires_at) VALUES ($1, $2, $3, $4)`,
+		tokenID, familyID, result.UserID, result.ExpiresAt)
+	if err != nil {
+		return rotatedRefreshToken{}, fmt.Errorf("error storing refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return rotatedRefreshToken{}, err
+	}
+
+	result.Token = token
+	return result, nil
+}
+
+// revokeRefreshTokenFamily revokes the family of the given token, ending the
+// session on every device that shares it.
+func revokeRefreshTokenFamily(ctx context.Context, tokenID string) error {
+	_, err := db.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE id = $1) AND revoked_at IS NULL`, tokenID)
+	return err
+}
+
+// PurgeExpiredRefreshTokens deletes refresh tokens that can no longer be used.
+func PurgeExpiredRefreshTokens(ctx context.Context) error {
+	_, err := db.DB.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < NOW()")
+	return err
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"jsmi-api/models"
+	"jsmi-api/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// refreshTokenRow is the row rotateRefreshToken reads for a token of user 7.
+func refreshTokenRow(familyID uuid.UUID, rotatedAt, revokedAt any) *sqlmock.Rows {
+	return userRefreshTokenRow(familyID, models.UserStatusActive, rotatedAt, revokedAt)
+}
+
+// userRefreshTokenRow is refreshTokenRow for a user with the given status.
+func userRefreshTokenRow(familyID uuid.UUID, status string, rotatedAt, revokedAt any) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"family_id", "user_id", "username", "status", "expires_at", "rotated_at", "revoked_at"}).
+		AddRow(familyID, int64(7), "wanjiku", status, time.Now().Add(time.Hour), rotatedAt, revokedAt)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	t.Setenv("TOKEN_FORMAT", "")
+	t.Setenv("PASETO_SECRET", strings.Repeat("k", 32))
+	familyID := uuid.New()
+	claims := &utils.CustomClaims{UserID: 7, TokenID: "token-1"}
+
+	t.Run("rotates an unused token", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT rt.family_id").WithArgs("token-1").WillReturnRows(refreshTokenRow(familyID, nil, nil))
+		mock.ExpectExec("UPDATE refresh_tokens SET rotated_at").WithArgs("token-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO refresh_tokens").
+			WithArgs(sqlmock.AnyArg(), familyID, int64(7), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rotated, err := rotateRefreshToken(context.Background(), claims)
+		if err != nil {
+			t.Fatalf("rotateRefreshToken() = %v", err)
+		}
+		if rotated.Token == "" || rotated.UserID != 7 {
+			t.Errorf("rotateRefreshToken() = %+v, want a new token for user 7", rotated)
+		}
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT rt.family_id").WithArgs("token-1").
+			WillReturnRows(refreshTokenRow(familyID, time.Now().Add(-time.Minute), nil))
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)\\s+WHERE family_id = \\$1").
+			WithArgs(familyID).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		rotated, err := rotateRefreshToken(context.Background(), claims)
+		if !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("rotateRefreshToken() = %v, want %v", err, ErrRefreshTokenReused)
+		}
+		if rotated.Token != "" || rotated.UserID != 7 {
+			t.Errorf("rotateRefreshToken() = %+v, want no token and the owner for auditing", rotated)
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT rt.family_id").WithArgs("token-1").
+			WillReturnRows(refreshTokenRow(familyID, time.Now().Add(-time.Minute), time.Now()))
+		mock.ExpectRollback()
+
+		if _, err := rotateRefreshToken(context.Background(), claims); !errors.Is(err, ErrRefreshTokenRevoked) {
+			t.Fatalf("rotateRefreshToken() = %v, want %v", err, ErrRefreshTokenRevoked)
+		}
+	})
+
+	t.Run("suspended user", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT rt.family_id").WithArgs("token-1").
+			WillReturnRows(userRefreshTokenRow(familyID, models.UserStatusSuspended, nil, nil))
+		mock.ExpectRollback()
+
+		if _, err := rotateRefreshToken(context.Background(), claims); !errors.Is(err, ErrAccountSuspended) {
+			t.Fatalf("rotateRefreshToken() = %v, want %v", err, ErrAccountSuspended)
+		}
+	})
+
+	t.Run("token of another user", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT rt.family_id").WithArgs("token-1").WillReturnRows(refreshTokenRow(familyID, nil, nil))
+		mock.ExpectRollback()
+
+		other := &utils.CustomClaims{UserID: 8, TokenID: "token-1"}
+		if _, err := rotateRefreshToken(context.Background(), other); !errors.Is(err, ErrRefreshTokenUnknown) {
+			t.Fatalf("rotateRefreshToken() = %v, want %v", err, ErrRefreshTokenUnknown)
+		}
+	})
+}
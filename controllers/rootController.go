@@ -23,3 +23,11 @@ func SetupRootRoute(router *mux.Router) {
 	// Define routes here
 	router.HandleFunc("/", rootHandler).Methods("GET")
 }
+
+// PublicPaths are the paths served without the site's bearer token: email
+// tracking and short links, payment webhooks and statement downloads, which
+// are signed, and the public and display APIs, whose clients and devices
+// have their own tokens.
+func PublicPaths() []string {
+	return append([]string{PublicAPIPrefix, DisplayPrefix, ShortLinkPrefix, PaymentWebhookPrefix, StatementDownloadPath}, emailTrackingPaths...)
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/middlewares"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pressly/goose/v3"
+)
+
+// runbookConfirmTTL is how long a confirmation token is valid.
+const runbookConfirmTTL = 5 * time.Minute
+
+var (
+	ErrRunbookActionNotFound = errors.New("unknown runbook action")
+	ErrRunbookTokenInvalid   = errors.New("confirmation token is invalid or expired")
+)
+
+// RunbookParams are the options of a runbook action. Each action reads the
+// ones it documents and ignores the rest.
+type RunbookParams struct {
+	WebhookID *uuid.UUID `json:"webhook_id,omitempty"`
+	JobType   string     `json:"job_type,omitempty"`
+	Version   int64      `json:"version,omitempty"`
+}
+
+// runbookAction is a predefined operational action. Preview describes what
+// Run would do without changing anything. Read-only actions run without a
+// confirmation token.
+type runbookAction struct {
+	Description string
+	ReadOnly    bool
+	Preview     func(ctx context.Context, params RunbookParams) (any, error)
+	Run         func(ctx context.Context, params RunbookParams) (any, error)
+}
+
+var runbookActions = map[string]runbookAction{
+	"rebuild-search-index": {
+		Description: "Rebuild the full-text search indexes of posts and documents and refresh their statistics.",
+		Preview:     previewSearchIndexRebuild,
+		Run:         rebuildSearchIndex,
+	},
+	"replay-failed-webhooks": {
+		Description: "Queue webhook deliveries that failed every attempt within the delivery log retention again, optionally only those of webhook_id.",
+		Preview:     previewWebhookReplay,
+		Run:         replayFailedWebhooks,
+	},
+	"reprocess-stuck-jobs": {
+		Description: "Queue jobs stuck running, e.g. after an instance was killed, to run now; optionally only those of job_type.",
+		Preview:     previewStuckJobs,
+		Run:         reprocessStuckJobs,
+	},
+	"migration-check": {
+		Description: "Compare the applied database migrations with the migration files, or check a single migration with version.",
+		ReadOnly:    true,
+		Run:         checkMigrations,
+	},
+}
+
+// runbookConfirmation is what a confirmation token stands for. The action
+// runs with the previewed params, whatever the confirming request sends.
+type runbookConfirmation struct {
+	AdminID int64         `json:"admin_id"`
+	Action  string        `json:"action"`
+	Params  RunbookParams `json:"params"`
+}
+
+func runbookConfirmKey(token string) string {
+	return "runbook_confirm:" + token
+}
+
+// GetRunbookActions lists the runbook actions.
+func GetRunbookActions(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(runbookActions))
+	for name := range runbookActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	actions := []map[string]interface{}{}
+	for _, name := range names {
+		action := runbookActions[name]
+		actions = append(actions, map[string]interface{}{
+			"name":        name,
+			"description": action.Description,
+			"read_only":   action.ReadOnly,
+		})
+	}
+	middlewares.RespondJSON(w, actions, http.StatusOK)
+}
+
+// RunRunbookAction runs a runbook action in two steps, so that incidents can
+// be handled without shell access but not by a stray click. A request
+// without a confirmation_token returns a preview of the action and a token;
+// repeating the request with the token within five minutes runs it. Tokens
+// work once and only for the admin they were issued to. Every run is
+// recorded in the admin audit log.
+func RunRunbookAction(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["action"]
+	action, ok := runbookActions[name]
+	if !ok {
+		middlewares.HttpError(w, "Unknown runbook action", http.StatusNotFound, ErrRunbookActionNotFound)
+		return
+	}
+
+	var payload struct {
+		Params            RunbookParams `json:"params"`
+		ConfirmationToken string        `json:"confirmation_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+	params := payload.Params
+
+	if !action.ReadOnly {
+		if payload.ConfirmationToken == "" {
+			previewRunbookAction(w, r, adminID, name, action, params)
+			return
+		}
+		confirmed, err := redeemRunbookToken(ctx, payload.ConfirmationToken)
+		if err != nil && !errors.Is(err, ErrRunbookTokenInvalid) {
+			middlewares.HttpError(w, "Failed to check confirmation token", http.StatusInternalServerError, err)
+			return
+		}
+		if err != nil || confirmed.AdminID != adminID || confirmed.Action != name {
+			middlewares.HttpError(w, ErrRunbookTokenInvalid.Error(), http.StatusConflict, ErrRunbookTokenInvalid)
+			return
+		}
+		params = confirmed.Params
+	}
+
+	// Actions like a reindex outlast an impatient client; the audit entry
+	// should record how they ended.
+	result, err := action.Run(context.WithoutCancel(ctx), params)
+	if err != nil {
+		middlewares.RecordAdminAction(r, adminID, "runbook:"+name, http.StatusInternalServerError)
+		middlewares.HttpError(w, "Runbook action failed: "+err.Error(), http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RecordAdminAction(r, adminID, "runbook:"+name, http.StatusOK)
+	middlewares.RespondJSON(w, map[string]interface{}{
+		"action": name,
+		"params": params,
+		"result": result,
+	}, http.StatusOK)
+}
+
+func previewRunbookAction(w http.ResponseWriter, r *http.Request, adminID int64, name string, action runbookAction, params RunbookParams) {
+	ctx := r.Context()
+	preview, err := action.Preview(ctx, params)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to preview runbook action", http.StatusInternalServerError, err)
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		middlewares.HttpError(w, "Failed to issue confirmation token", http.StatusInternalServerError, err)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	data, err := json.Marshal(runbookConfirmation{AdminID: adminID, Action: name, Params: params})
+	if err == nil {
+		err = db.RedisClient.Set(ctx, runbookConfirmKey(token), data, runbookConfirmTTL).Err()
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to issue confirmation token", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]interface{}{
+		"action":             name,
+		"description":        action.Description,
+		"params":             params,
+		"preview":            preview,
+		"confirmation_token": token,
+		"expires_at":         time.Now().Add(runbookConfirmTTL).UTC(),
+	}, http.StatusOK)
+}
+
+// redeemRunbookToken consumes a confirmation token.
+func redeemRunbookToken(ctx context.Context, token string) (runbookConfirmation, error) {
+	var confirmation runbookConfirmation
+	data, err := db.RedisClient.GetDel(ctx, runbookConfirmKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return confirmation, ErrRunbookTokenInvalid
+	}
+	if err != nil {
+		return confirmation, fmt.Errorf("error fetching confirmation token: %w", err)
+	}
+	if err := json.Unmarshal(data, &confirmation); err != nil {
+		return confirmation, fmt.Errorf("error decoding confirmation token: %w", err)
+	}
+	return confirmation, nil
+}
+
+// searchIndexes are the full-text indexes behind GET /search.
+var searchIndexes = []string{"idx_posts_search_vector", "idx_documents_search_vector"}
+
+func previewSearchIndexRebuild(ctx context.Context, _ RunbookParams) (any, error) {
+	sizes := map[string]int64{}
+	for _, index := range searchIndexes {
+		var size int64
+		if err := db.DB.QueryRowContext(ctx, "SELECT pg_relation_size($1::regclass)", index).Scan(&size); err != nil {
+			return nil, fmt.Errorf("error querying database: %w", err)
+		}
+		sizes[index] = size
+	}
+	return map[string]interface{}{"index_bytes": sizes}, nil
+}
+
+// rebuildSearchIndex reindexes concurrently, so searches keep working while
+// it runs.
+func rebuildSearchIndex(ctx context.Context, _ RunbookParams) (any, error) {
+	start := time.Now()
+	for _, index := range searchIndexes {
+		if _, err := db.DB.ExecContext(ctx, "REINDEX INDEX CONCURRENTLY "+index); err != nil {
+			return nil, fmt.Errorf("error rebuilding %s: %w", index, err)
+		}
+	}
+	if _, err := db.DB.ExecContext(ctx, "ANALYZE posts, documents"); err != nil {
+		return nil, fmt.Errorf("error analyzing tables: %w", err)
+	}
+	return map[string]interface{}{"indexes": searchIndexes, "duration_ms": time.Since(start).Milliseconds()}, nil
+}
+
+// failedWebhooksFilter matches webhook jobs that used up their attempts
+// within the delivery log retention, of webhook $3 if set.
+const failedWebhooksFilter = `type = $1 AND status = 'failed' AND updated_at > NOW() - $2 * INTERVAL '1 second'
+	AND ($3::uuid IS NULL OR (payload->>'webhook_id')::uuid = $3::uuid)`
+
+func previewWebhookReplay(ctx context.Context, params RunbookParams) (any, error) {
+	var count int64
+	err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs WHERE "+failedWebhooksFilter,
+		JobDeliverWebhook, webhookDeliveryRetention.Seconds(), params.WebhookID).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	return map[string]int64{"deliveries": count}, nil
+}
+
+// replayFailedWebhooks gives the deliveries a fresh set of attempts. Each
+// delivery keeps its ID, so receivers can tell a replay from a new event.
+func replayFailedWebhooks(ctx context.Context, params RunbookParams) (any, error) {
+	result, err := db.DB.ExecContext(ctx, `UPDATE jobs SET status = 'queued', attempts = 0, last_error = NULL, run_at = NOW(), updated_at = NOW()
+		WHERE `+failedWebhooksFilter, JobDeliverWebhook, webhookDeliveryRetention.Seconds(), params.WebhookID)
+	if err != nil {
+		return nil, fmt.Errorf("error requeuing deliveries: %w", err)
+	}
+	count, _ := result.RowsAffected()
+	return map[string]int64{"requeued": count}, nil
+}
+
+func previewStuckJobs(ctx context.Context, params RunbookParams) (any, error) {
+	count, err := jobs.CountStuck(ctx, params.JobType)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"jobs": count}, nil
+}
+
+func reprocessStuckJobs(ctx context.Context, params RunbookParams) (any, error) {
+	count, err := jobs.RequeueStuck(ctx, params.JobType)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"requeued": count}, nil
+}
+
+// MigrationStatus is whether a migration file has been applied.
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Source    string     `json:"source"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// checkMigrations reports the migrations that are not applied, or the
+// status of the migration with params.Version.
+func checkMigrations(ctx context.Context, params RunbookParams) (any, error) {
+	dir, err := filepath.Abs("db/migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range migrations {
+		if params.Version != 0 && migration.Version != params.Version {
+			continue
+		}
+		status := MigrationStatus{Version: migration.Version, Source: filepath.Base(migration.Source)}
+		var appliedAt time.Time
+		err := db.DB.QueryRowContext(ctx, `SELECT is_applied, tstamp FROM goose_db_version
+			WHERE version_id = $1 ORDER BY id DESC LIMIT 1`, migration.Version).Scan(&status.Applied, &appliedAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error querying database: %w", err)
+		}
+		if status.Applied {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	if params.Version != 0 {
+		if len(statuses) == 0 {
+			return nil, fmt.Errorf("there is no migration %d", params.Version)
+		}
+		return statuses[0], nil
+	}
+
+	current, err := goose.GetDBVersionContext(ctx, db.DB)
+	if err != nil {
+		return nil, fmt.Errorf("error reading database version: %w", err)
+	}
+	pending := []MigrationStatus{}
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status)
+		}
+	}
+	return map[string]interface{}{
+		"current_version": current,
+		"latest_version":  migrations[len(migrations)-1].Version,
+		"pending":         pending,
+	}, nil
+}
@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrLiveNotFound     = errors.New("live not found")
+	ErrSegmentNotFound  = errors.New("segment not found")
+	ErrInvalidRundownID = errors.New("segment_ids must list every segment of the rundown exactly once")
+)
+
+// setupRundownRoutes registers the order of service endpoints. They are only
+// available to staff, including the realtime stream used by the production app.
+func setupRundownRoutes(livesRouter *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+	livesRouter.Handle("/rundown", staff(GetRundown)).Methods("GET").Queries("live_id", "{live_id}")
+	livesRouter.Handle("/rundown/events", staff(StreamRundown)).Methods("GET").Queries("live_id", "{live_id}")
+	livesRouter.Handle("/rundown", staff(CreateServiceSegment)).Methods("POST").Queries("live_id", "{live_id}")
+	livesRouter.Handle("/rundown", staff(UpdateServiceSegment)).Methods("PUT").Queries("id", "{id}")
+	livesRouter.Handle("/rundown", staff(DeleteServiceSegment)).Methods("DELETE").Queries("id", "{id}")
+	livesRouter.Handle("/rundown/order", staff(ReorderServiceSegments)).Methods("PUT").Queries("live_id", "{live_id}")
+}
+
+func rundownChannel(liveID uuid.UUID) string {
+	return "rundown:" + liveID.String()
+}
+
+func GetRundown(w http.ResponseWriter, r *http.Request) {
+	liveID, err := uuid.Parse(r.URL.Query().Get("live_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid live_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	rundown, err := fetchRundown(r.Context(), liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, rundown, http.StatusOK)
+}
+
+// StreamRundown sends the current rundown and then every update as SSE.
+func StreamRundown(w http.ResponseWriter, r *http.Request) {
+	liveID, err := uuid.Parse(r.URL.Query().Get("live_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid live_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	rundown, err := fetchRundown(r.Context(), liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch rundown", http.StatusInternalServerError, err)
+		return
+	}
+	data, err := json.Marshal(rundown)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to encode rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	streamRedisChannel(w, r, rundownChannel(liveID), "rundown", SSEEvent{Name: "rundown", Data: data})
+}
+
+func fetchRundown(ctx context.Context, liveID uuid.UUID) (*models.Rundown, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, live_id, position, title, owner, duration_seconds, notes, attachments, created_at, updated_at
+		FROM service_segments WHERE live_id = $1 ORDER BY position`, liveID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	rundown := &models.Rundown{LiveID: liveID, Segments: []models.ServiceSegment{}}
+	for rows.Next() {
+		var segment models.ServiceSegment
+		var attachments []byte
+		if err := rows.Scan(&segment.ID, &segment.LiveID, &segment.Position, &segment.Title, &segment.Owner,
+			&segment.DurationSeconds, &segment.Notes, &attachments, &segment.CreatedAt, &segment.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if err := json.Unmarshal(attachments, &segment.Attachments); err != nil {
+			return nil, fmt.Errorf("error decoding attachments: %w", err)
+		}
+		rundown.TotalDurationSeconds += segment.DurationSeconds
+		rundown.Segments = append(rundown.Segments, segment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return rundown, nil
+}
+
+// publishRundown pushes the current rundown to every connected stream.
+func publishRundown(ctx context.Context, liveID uuid.UUID) (*models.Rundown, error) {
+	rundown, err := fetchRundown(ctx, liveID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(rundown)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.RedisClient.Publish(ctx, rundownChannel(liveID), data).Err(); err != nil {
+		return nil, fmt.Errorf("error publishing rundown update: %w", err)
+	}
+	return rundown, nil
+}
+
+// CreateServiceSegment adds a segment, appended unless a position is given.
+func CreateServiceSegment(w http.ResponseWriter, r *http.Request) {
+	liveID, err := uuid.Parse(r.URL.Query().Get("live_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid live_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var segment models.ServiceSegment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateServiceSegment(&segment); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	segment.ID = uuid.New()
+	segment.LiveID = liveID
+	segment.CreatedAt = time.Now()
+	segment.UpdatedAt = segment.CreatedAt
+	if segment.Attachments == nil {
+		segment.Attachments = []models.Attachment{}
+	}
+
+	ctx := r.Context()
+	if err := insertServiceSegment(ctx, &segment); err != nil {
+		if errors.Is(err, ErrLiveNotFound) {
+			middlewares.HttpError(w, "Live not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	rundown, err := publishRundown(ctx, liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to publish rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, rundown, http.StatusCreated)
+}
+
+func insertServiceSegment(ctx context.Context, segment *models.ServiceSegment) error {
+	attachments, err := json.Marshal(segment.Attachments)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the live so concurrent edits of the same rundown are serialised.
+	var exists bool
+	err = tx.QueryRowContext(ctx, "SELECT true FROM lives WHERE id = $1 FOR UPDATE", segment.LiveID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLiveNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM service_segments WHERE live_id = $1", segment.LiveID).Scan(&count); err != nil {
+		return err
+	}
+	if segment.Position < 1 || segment.Position > count {
+		segment.Position = count + 1
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE service_segments SET position = position + 1 WHERE live_id = $1 AND position >= $2",
+			segment.LiveID, segment.Position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO service_segments
+		(id, live_id, position, title, owner, duration_seconds, notes, attachments, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		segment.ID, segment.LiveID, segment.Position, segment.Title, segment.Owner, segment.DurationSeconds,
+		segment.Notes, attachments, segment.CreatedAt, segment.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateServiceSegment edits a segment's content. Use the order endpoint to move it.
+func UpdateServiceSegment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var segment models.ServiceSegment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateServiceSegment(&segment); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if segment.Attachments == nil {
+		segment.Attachments = []models.Attachment{}
+	}
+	attachments, err := json.Marshal(segment.Attachments)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid attachments", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var liveID uuid.UUID
+	err = db.DB.QueryRowContext(ctx, `UPDATE service_segments
+		SET title = $1, owner = $2, duration_seconds = $3, notes = $4, attachments = $5, updated_at = NOW()
+		WHERE id = $6 RETURNING live_id`,
+		segment.Title, segment.Owner, segment.DurationSeconds, segment.Notes, attachments, id).Scan(&liveID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Segment not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	rundown, err := publishRundown(ctx, liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to publish rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, rundown, http.StatusOK)
+}
+
+func DeleteServiceSegment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	liveID, err := deleteServiceSegment(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSegmentNotFound) {
+			middlewares.HttpError(w, "Segment not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to delete segment", http.StatusInternalServerError, err)
+		return
+	}
+
+	rundown, err := publishRundown(ctx, liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to publish rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, rundown, http.StatusOK)
+}
+
+// deleteServiceSegment removes a segment and closes the gap in the positions.
+func deleteServiceSegment(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var liveID uuid.UUID
+	err = tx.QueryRowContext(ctx, "DELETE FROM service_segments WHERE id = $1 RETURNING live_id", id).Scan(&liveID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrSegmentNotFound
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE service_segments s SET position = o.rn
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position) AS rn FROM service_segments WHERE live_id = $1) o
+		WHERE s.id = o.id`, liveID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return liveID, tx.Commit()
+}
+
+// ReorderServiceSegments sets the order of all segments of a rundown at once.
+func ReorderServiceSegments(w http.ResponseWriter, r *http.Request) {
+	liveID, err := uuid.Parse(r.URL.Query().Get("live_id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid live_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var payload struct {
+		SegmentIDs []uuid.UUID `json:"segment_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := reorderServiceSegments(ctx, liveID, payload.SegmentIDs); err != nil {
+		if errors.Is(err, ErrInvalidRundownID) {
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to reorder segments", http.StatusInternalServerError, err)
+		return
+	}
+
+	rundown, err := publishRundown(ctx, liveID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to publish rundown", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, rundown, http.StatusOK)
+}
+
+func reorderServiceSegments(ctx context.Context, liveID uuid.UUID, segmentIDs []uuid.UUID) error {
+	ids := make([]string, len(segmentIDs))
+	seen := make(map[uuid.UUID]bool, len(segmentIDs))
+	for i, id := range segmentIDs {
+		if seen[id] {
+			return ErrInvalidRundownID
+		}
+		seen[id] = true
+		ids[i] = id.String()
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM service_segments WHERE live_id = $1", liveID).Scan(&count); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE service_segments s SET position = o.ord, updated_at = NOW()
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, ord)
+		WHERE s.id = o.id AND s.live_id = $1`, liveID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(affected) != count || len(ids) != count {
+		return ErrInvalidRundownID
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,508 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/utils"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxSafeguardingExportsPerDay is how many exports one officer may make in
+// 24 hours.
+const maxSafeguardingExportsPerDay = 5
+
+var (
+	ErrSafeguardingDisabled = errors.New("safeguarding reports are not configured")
+	ErrSafeguardingNotFound = errors.New("report not found")
+)
+
+// LoadSafeguardingKey returns SAFEGUARDING_ENCRYPTION_KEY, the key reports
+// are sealed with, or nil when safeguarding reports are disabled.
+func LoadSafeguardingKey() ([]byte, error) {
+	return utils.LoadEncryptionKey("SAFEGUARDING_ENCRYPTION_KEY")
+}
+
+// SetupSafeguardingRoutes registers the safeguarding endpoints. Any member
+// can submit a report; only appointed officers can read them, never while
+// impersonated, and every access is written to the audit log.
+func SetupSafeguardingRoutes(r *mux.Router) {
+	officer := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.NoImpersonation(SafeguardingOfficerOnly(h)))
+	}
+
+	safeguardingRouter := r.PathPrefix("/safeguarding").Subrouter()
+	safeguardingRouter.Handle("/reports", middlewares.TokenAuthMiddleware(http.HandlerFunc(SubmitSafeguardingReport))).Methods("POST")
+	safeguardingRouter.Handle("/reports", officer(GetSafeguardingReport)).Methods("GET").Queries("id", "{id}")
+	safeguardingRouter.Handle("/reports", officer(GetSafeguardingReports)).Methods("GET")
+	safeguardingRouter.Handle("/reports/status", officer(SetSafeguardingStatus)).Methods("PUT").Queries("id", "{id}")
+	safeguardingRouter.Handle("/reports/export", officer(ExportSafeguardingReport)).Methods("POST").Queries("id", "{id}")
+	safeguardingRouter.Handle("/audit", officer(GetSafeguardingAudit)).Methods("GET")
+}
+
+// SafeguardingOfficerOnly lets appointed safeguarding officers through and
+// keeps responses out of caches. It must run after TokenAuthMiddleware.
+func SafeguardingOfficerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		var officer bool
+		err := db.DB.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM safeguarding_officers WHERE user_id = $1)", userID).Scan(&officer)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to check safeguarding access", http.StatusInternalServerError, err)
+			return
+		}
+		if !officer {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditSafeguarding records an access. Handlers record it before they
+// respond, and fail the request when it cannot be recorded.
+func auditSafeguarding(r *http.Request, reportID *uuid.UUID, action, reason string) error {
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	_, err := db.DB.ExecContext(ctx, `INSERT INTO safeguarding_audit_log (report_id, user_id, action, reason, ip_address)
+		VALUES ($1, $2, $3, $4, $5)`, reportID, userID, action, reason, middlewares.ClientIP(r))
+	if err != nil {
+		return fmt.Errorf("error recording safeguarding access: %w", err)
+	}
+	return nil
+}
+
+// safeguardingKey returns the sealing key, answering 503 when there is none.
+func safeguardingKey(w http.ResponseWriter) ([]byte, bool) {
+	key, err := LoadSafeguardingKey()
+	if err != nil || key == nil {
+		middlewares.HttpError(w, ErrSafeguardingDisabled.Error(), http.StatusServiceUnavailable, err)
+		return nil, false
+	}
+	return key, true
+}
+
+// SubmitSafeguardingReport takes in a report. The reporter only gets its ID
+// back; reports cannot be read by whoever submitted them.
+func SubmitSafeguardingReport(w http.ResponseWriter, r *http.Request) {
+	key, ok := safeguardingKey(w)
+	if !ok {
+		return
+	}
+	var submission models.SafeguardingSubmission
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSafeguardingSubmission(submission, time.Now()); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	content, err := json.Marshal(submission.SafeguardingContent)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to submit report", http.StatusInternalServerError, err)
+		return
+	}
+	id := uuid.New()
+	sealed, err := utils.Seal(key, content, []byte(id.String()))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to submit report", http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	var createdAt time.Time
+	err = db.DB.QueryRowContext(ctx, `INSERT INTO safeguarding_reports (id, category, content, reported_by, occurred_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`, id, submission.Category, sealed, userID, submission.OccurredAt).Scan(&createdAt)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to submit report", http.StatusInternalServerError, err)
+		return
+	}
+	if err := auditSafeguarding(r, &id, models.SafeguardingActionSubmit, ""); err != nil {
+		middlewares.HttpError(w, "Failed to submit report", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	middlewares.RespondJSON(w, map[string]interface{}{"id": id, "created_at": createdAt}, http.StatusCreated)
+}
+
+const safeguardingReportColumns = "id, category, status, reported_by, occurred_at, created_at, updated_at"
+
+func scanSafeguardingReport(row rowScanner) (models.SafeguardingReport, error) {
+	var report models.SafeguardingReport
+	err := row.Scan(&report.ID, &report.Category, &report.Status, &report.ReportedBy, &report.OccurredAt,
+		&report.CreatedAt, &report.UpdatedAt)
+	return report, err
+}
+
+// querySafeguardingReport loads a report and opens its content.
+func querySafeguardingReport(ctx context.Context, key []byte, id uuid.UUID) (models.SafeguardingReport, error) {
+	var sealed []byte
+	var report models.SafeguardingReport
+	err := db.DB.QueryRowContext(ctx, "SELECT "+safeguardingReportColumns+", content FROM safeguarding_reports WHERE id = $1", id).
+		Scan(&report.ID, &report.Category, &report.Status, &report.ReportedBy, &report.OccurredAt,
+			&report.CreatedAt, &report.UpdatedAt, &sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.SafeguardingReport{}, ErrSafeguardingNotFound
+	}
+	if err != nil {
+		return models.SafeguardingReport{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	plaintext, err := utils.Open(key, sealed, []byte(id.String()))
+	if err != nil {
+		return models.SafeguardingReport{}, fmt.Errorf("error opening safeguarding report %s: %w", id, err)
+	}
+	var content models.SafeguardingContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return models.SafeguardingReport{}, fmt.Errorf("error decoding safeguarding report %s: %w", id, err)
+	}
+	report.Content = &content
+	return report, nil
+}
+
+// GetSafeguardingReports lists reports without their content, newest
+// first, optionally only those with ?status=.
+func GetSafeguardingReports(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" {
+		if err := validation.ValidateSafeguardingStatus(status); err != nil {
+			middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	const filter = `($1 = '' OR status = $1)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM safeguarding_reports WHERE "+filter, status).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch reports", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+safeguardingReportColumns+` FROM safeguarding_reports
+		WHERE `+filter+`
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3`, status, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch reports", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.SafeguardingReport{}
+	for rows.Next() {
+		report, err := scanSafeguardingReport(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch reports", http.StatusInternalServerError, err)
+			return
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch reports", http.StatusInternalServerError, err)
+		return
+	}
+	if err := auditSafeguarding(r, nil, models.SafeguardingActionList, ""); err != nil {
+		middlewares.HttpError(w, "Failed to fetch reports", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.SafeguardingReport]{
+		Items:   reports,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetSafeguardingReport returns a report with its content.
+func GetSafeguardingReport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	key, ok := safeguardingKey(w)
+	if !ok {
+		return
+	}
+
+	report, err := querySafeguardingReport(r.Context(), key, id)
+	if errors.Is(err, ErrSafeguardingNotFound) {
+		middlewares.HttpError(w, "Report not found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch report", http.StatusInternalServerError, err)
+		return
+	}
+	if err := auditSafeguarding(r, &id, models.SafeguardingActionView, ""); err != nil {
+		middlewares.HttpError(w, "Failed to fetch report", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
+
+// SetSafeguardingStatus moves a report to another status.
+func SetSafeguardingStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSafeguardingStatus(payload.Status); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := scanSafeguardingReport(db.DB.QueryRowContext(r.Context(), `UPDATE safeguarding_reports
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+safeguardingReportColumns, payload.Status, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		middlewares.HttpError(w, "Report not found", http.StatusNotFound, ErrSafeguardingNotFound)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update report", http.StatusInternalServerError, err)
+		return
+	}
+	if err := auditSafeguarding(r, &id, models.SafeguardingActionUpdate, "status: "+payload.Status); err != nil {
+		middlewares.HttpError(w, "Failed to update report", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, report, http.StatusOK)
+}
+
+// ExportSafeguardingReport downloads one report, e.g. for a referral to the
+// authorities. An export needs a reason, which is audited, and each officer
+// may only make a few a day.
+func ExportSafeguardingReport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateExportReason(payload.Reason); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	key, ok := safeguardingKey(w)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	userID, _ := middlewares.UserIDFromContext(ctx)
+	var exports int
+	err = db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM safeguarding_audit_log
+		WHERE user_id = $1 AND action = $2 AND created_at > NOW() - INTERVAL '1 day'`,
+		userID, models.SafeguardingActionExport).Scan(&exports)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to export report", http.StatusInternalServerError, err)
+		return
+	}
+	if exports >= maxSafeguardingExportsPerDay {
+		http.Error(w, fmt.Sprintf("at most %d reports can be exported a day", maxSafeguardingExportsPerDay), http.StatusTooManyRequests)
+		return
+	}
+
+	report, err := querySafeguardingReport(ctx, key, id)
+	if errors.Is(err, ErrSafeguardingNotFound) {
+		middlewares.HttpError(w, "Report not found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to export report", http.StatusInternalServerError, err)
+		return
+	}
+	if err := auditSafeguarding(r, &id, models.SafeguardingActionExport, payload.Reason); err != nil {
+		middlewares.HttpError(w, "Failed to export report", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "safeguarding-"+id.String()+".json"))
+	middlewares.RespondJSON(w, map[string]interface{}{
+		"report":      report,
+		"exported_by": userID,
+		"exported_at": time.Now().UTC(),
+		"reason":      payload.Reason,
+	}, http.StatusOK)
+}
+
+// GetSafeguardingAudit lists the audit log, newest first, optionally only
+// the entries of ?report_id=. Admins read it under /admin/safeguarding/audit
+// without being officers, so they can oversee access to reports they cannot
+// read themselves.
+func GetSafeguardingAudit(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	var reportID *uuid.UUID
+	if value := r.URL.Query().Get("report_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid report_id parameter", http.StatusBadRequest, err)
+			return
+		}
+		reportID = &id
+	}
+
+	ctx := r.Context()
+	const filter = `($1::uuid IS NULL OR report_id = $1::uuid)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM safeguarding_audit_log WHERE "+filter, reportID).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch audit log", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, report_id, user_id, action, reason, ip_address, created_at
+		FROM safeguarding_audit_log
+		WHERE `+filter+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, reportID, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch audit log", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.SafeguardingAccess{}
+	for rows.Next() {
+		var entry models.SafeguardingAccess
+		if err := rows.Scan(&entry.ID, &entry.ReportID, &entry.UserID, &entry.Action, &entry.Reason, &entry.IPAddress,
+			&entry.CreatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch audit log", http.StatusInternalServerError, err)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch audit log", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	middlewares.RespondJSON(w, PaginatedResponse[models.SafeguardingAccess]{
+		Items:   entries,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+// GetSafeguardingOfficers lists the appointed officers.
+func GetSafeguardingOfficers(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), `SELECT o.user_id, u.username, o.appointed_by, o.appointed_at
+		FROM safeguarding_officers o
+		JOIN users u ON u.id = o.user_id
+		ORDER BY u.username`)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch officers", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	officers := []models.SafeguardingOfficer{}
+	for rows.Next() {
+		var officer models.SafeguardingOfficer
+		if err := rows.Scan(&officer.UserID, &officer.Username, &officer.AppointedBy, &officer.AppointedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch officers", http.StatusInternalServerError, err)
+			return
+		}
+		officers = append(officers, officer)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch officers", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, officers, http.StatusOK)
+}
+
+// AppointSafeguardingOfficer gives a user access to the reports.
+func AppointSafeguardingOfficer(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	adminID, _ := middlewares.UserIDFromContext(ctx)
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO safeguarding_officers (user_id, appointed_by) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING`, userID, adminID)
+	if isForeignKeyViolation(err) {
+		middlewares.HttpError(w, "User not found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to appoint officer", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveSafeguardingOfficer takes a user's access to the reports away.
+func RemoveSafeguardingOfficer(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid user_id parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM safeguarding_officers WHERE user_id = $1", userID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to remove officer", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		http.Error(w, "Officer not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
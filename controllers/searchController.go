@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupSearchRoutes(r *mux.Router) {
+	r.Handle("/search", middlewares.OptionalTokenAuth(http.HandlerFunc(Search))).Methods("GET").Queries("q", "{q}")
+}
+
+// searchHeadline turns matches into plain text snippets; clients highlight
+// the query words themselves.
+const searchHeadline = `'StartSel="", StopSel="", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "'`
+
+// Search runs a full text search over published posts and, for staff, the
+// document library, best matches first. The query accepts web search syntax:
+// "quoted phrases", or, and -excluded words.
+func Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if err := validation.ValidateSearchQuery(query); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	includeDocuments := false
+	if userID, ok := middlewares.UserIDFromContext(ctx); ok {
+		role, err := middlewares.UserRole(ctx, userID)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to check user role", http.StatusInternalServerError, err)
+			return
+		}
+		includeDocuments = role == middlewares.RoleStaff || role == middlewares.RoleAdmin
+	}
+
+	results, total, err := querySearch(ctx, query, includeDocuments, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to search", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.SearchResult]{
+		Items:   results,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
+
+func querySearch(ctx context.Context, query string, includeDocuments bool, page Page) ([]models.SearchResult, int, error) {
+	const matches = `WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query),
+		matches AS (
+			SELECT 'post' AS type, p.id, p.title, p.slug, COALESCE(p.excerpt, '') || ' ' || COALESCE(p.body, '') AS content,
+				ts_rank(p.search_vector, q.query) AS rank
+			FROM posts p, q
+			WHERE p.status = 'published' AND p.deleted_at IS NULL AND p.search_vector @@ q.query
+			UNION ALL
+			SELECT 'document', d.id, d.title, '', d.content_text, ts_rank(d.search_vector, q.query)
+			FROM documents d, q
+			WHERE $2 AND d.search_vector @@ q.query
+		)`
+
+	var total int
+	if err := db.DB.QueryRowContext(ctx, matches+` SELECT COUNT(*) FROM matches`, query, includeDocuments).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	// Headlines are only built for the rows on the page; they are expensive.
+	rows, err := db.DB.QueryContext(ctx, matches+`,
+		ranked AS (SELECT * FROM matches ORDER BY rank DESC, title, id LIMIT $3 OFFSET $4)
+		SELECT ranked.type, ranked.id, ranked.title, ranked.slug,
+			ts_headline('english', ranked.content, q.query, `+searchHeadline+`), ranked.rank
+		FROM ranked, q
+		ORDER BY ranked.rank DESC, ranked.title, ranked.id`, query, includeDocuments, page.PerPage, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.Type, &result.ID, &result.Title, &result.Slug, &result.Snippet, &result.Rank); err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %w", err)
+		}
+		result.Snippet = strings.TrimSpace(result.Snippet)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return results, total, nil
+}
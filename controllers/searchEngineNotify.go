@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/middlewares"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobNotifySearchEngines tells search engines about published or changed URLs.
+const JobNotifySearchEngines = "search.notify"
+
+const defaultIndexNowEndpoint = "https://api.indexnow.org/indexnow"
+
+// SearchNotifyConfig configures IndexNow submissions and sitemap pings.
+type SearchNotifyConfig struct {
+	Enabled bool
+	// SiteURL is the public website, e.g. https://www.example.org. Post URLs
+	// are SiteURL/posts/<slug>.
+	SiteURL          string
+	IndexNowKey      string
+	IndexNowEndpoint string
+	// IndexNowKeyLocation is the URL of the key file when it is not served at
+	// SiteURL/<key>.txt.
+	IndexNowKeyLocation string
+	SitemapURL          string
+	// SitemapPingURLs are called with ?sitemap=<SitemapURL> appended.
+	SitemapPingURLs []string
+}
+
+// SearchNotifyRequest is the payload of a JobNotifySearchEngines job.
+type SearchNotifyRequest struct {
+	URLs []string `json:"urls"`
+}
+
+var (
+	searchNotifyConfig     *SearchNotifyConfig
+	searchNotifyConfigOnce sync.Once
+	searchNotifyClient     = &http.Client{Timeout: 30 * time.Second}
+)
+
+// LoadSearchNotifyConfig reads the search engine notification settings.
+// Notifications only ever run in production (see middlewares.IsProduction),
+// so staging and local environments never ping; SEARCH_NOTIFY=off also turns
+// them off there. Enabled notifications need SITE_URL and either
+// INDEXNOW_KEY or SITEMAP_URL with SITEMAP_PING_URLS.
+func LoadSearchNotifyConfig() (*SearchNotifyConfig, error) {
+	config := &SearchNotifyConfig{}
+	switch value := os.Getenv("SEARCH_NOTIFY"); value {
+	case "", "on":
+		config.Enabled = middlewares.IsProduction()
+	case "off":
+	default:
+		return nil, errors.New("SEARCH_NOTIFY must be on or off")
+	}
+
+	config.SiteURL = strings.TrimSuffix(os.Getenv("SITE_URL"), "/")
+	config.IndexNowKey = os.Getenv("INDEXNOW_KEY")
+	config.IndexNowEndpoint = os.Getenv("INDEXNOW_ENDPOINT")
+	if config.IndexNowEndpoint == "" {
+		config.IndexNowEndpoint = defaultIndexNowEndpoint
+	}
+	config.IndexNowKeyLocation = os.Getenv("INDEXNOW_KEY_LOCATION")
+	config.SitemapURL = os.Getenv("SITEMAP_URL")
+	for _, pingURL := range strings.Split(os.Getenv("SITEMAP_PING_URLS"), ",") {
+		if pingURL = strings.TrimSpace(pingURL); pingURL != "" {
+			config.SitemapPingURLs = append(config.SitemapPingURLs, pingURL)
+		}
+	}
+
+	// Without anything to notify there is nothing to enable, e.g. in a
+	// production deployment that has not set up IndexNow yet.
+	if config.IndexNowKey == "" && len(config.SitemapPingURLs) == 0 {
+		config.Enabled = false
+	}
+	if !config.Enabled {
+		return config, nil
+	}
+
+	for name, value := range map[string]string{
+		"SITE_URL":              config.SiteURL,
+		"INDEXNOW_ENDPOINT":     config.IndexNowEndpoint,
+		"INDEXNOW_KEY_LOCATION": config.IndexNowKeyLocation,
+		"SITEMAP_URL":           config.SitemapURL,
+	} {
+		if value == "" && name != "SITE_URL" {
+			continue
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("%s must be an http(s) URL", name)
+		}
+	}
+	if len(config.SitemapPingURLs) > 0 && config.SitemapURL == "" {
+		return nil, errors.New("SITEMAP_URL is required with SITEMAP_PING_URLS")
+	}
+	return config, nil
+}
+
+func searchNotify() *SearchNotifyConfig {
+	searchNotifyConfigOnce.Do(func() {
+		config, err := LoadSearchNotifyConfig()
+		if err != nil {
+			log.Printf("Search engine notifications disabled: %v", err)
+			config = &SearchNotifyConfig{}
+		}
+		searchNotifyConfig = config
+	})
+	return searchNotifyConfig
+}
+
+// queuePostSearchNotification queues a notification for a published post. It
+// is best effort: the post is already saved, so failures are only logged.
+func queuePostSearchNotification(ctx context.Context, slug string) {
+	config := searchNotify()
+	if !config.Enabled || slug == "" {
+		return
+	}
+	req := SearchNotifyRequest{URLs: []string{config.SiteURL + "/posts/" + slug}}
+	if _, err := jobs.Enqueue(ctx, db.DB, JobNotifySearchEngines, req); err != nil {
+		log.Printf("Failed to queue search engine notification for %s: %v", slug, err)
+	}
+}
+
+// NotifySearchEngines is the job handler for JobNotifySearchEngines. Failed
+// submissions are retried by the job queue; engines ignore repeats.
+func NotifySearchEngines(ctx context.Context, task *jobs.Task) (any, error) {
+	var req SearchNotifyRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	config := searchNotify()
+	// The environment may have been switched off since the job was queued.
+	if !config.Enabled {
+		return map[string]bool{"skipped": true}, nil
+	}
+
+	var errs []error
+	notified := []string{}
+	if config.IndexNowKey != "" {
+		if err := submitIndexNow(ctx, config, req.URLs); err != nil {
+			errs = append(errs, err)
+		} else {
+			notified = append(notified, "indexnow")
+		}
+	}
+	for _, pingURL := range config.SitemapPingURLs {
+		if err := pingSitemap(ctx, pingURL, config.SitemapURL); err != nil {
+			errs = append(errs, err)
+		} else {
+			notified = append(notified, pingURL)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return map[string][]string{"notified": notified}, nil
+}
+
+// submitIndexNow submits URLs with the IndexNow JSON API.
+func submitIndexNow(ctx context.Context, config *SearchNotifyConfig, urls []string) error {
+	site, err := url.Parse(config.SiteURL)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"host":    site.Host,
+		"key":     config.IndexNowKey,
+		"urlList": urls,
+	}
+	if config.IndexNowKeyLocation != "" {
+		payload["keyLocation"] = config.IndexNowKeyLocation
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.IndexNowEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return doSearchNotifyRequest(req, "IndexNow")
+}
+
+// pingSitemap asks a search engine to fetch the sitemap again.
+func pingSitemap(ctx context.Context, pingURL, sitemapURL string) error {
+	separator := "?"
+	if strings.Contains(pingURL, "?") {
+		separator = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pingURL+separator+"sitemap="+url.QueryEscape(sitemapURL), nil)
+	if err != nil {
+		return err
+	}
+	return doSearchNotifyRequest(req, "sitemap ping "+pingURL)
+}
+
+func doSearchNotifyRequest(req *http.Request, name string) error {
+	resp, err := searchNotifyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	// IndexNow answers 202 while it validates the key.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("%s returned status %d", name, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	emailPasswordChanged = "password_changed"
+	emailEmailChanged    = "email_changed"
+	emailNewDeviceLogin  = "new_device_login"
+	emailAccountDeleted  = "account_deleted"
+)
+
+// securityEmailData is the data available to the security email templates.
+type securityEmailData struct {
+	Username  string
+	Time      string
+	IPAddress string
+	UserAgent string
+	OldEmail  string
+	NewEmail  string
+}
+
+// notifySecurityEvent queues a security notification to the account owner.
+// Delivery happens in the background; failures are logged and never fail the
+// request that triggered them.
+func notifySecurityEvent(r *http.Request, template, to string, data securityEmailData) {
+	data.Time = time.Now().UTC().Format("2 Jan 2006 15:04 MST")
+	data.IPAddress = middlewares.ClientIP(r)
+	data.UserAgent = r.UserAgent()
+
+	if err := mailer.SendTemplate(template, to, data); err != nil {
+		log.Printf("Failed to queue %s notification for %s: %v", template, data.Username, err)
+	}
+}
+
+// isNewDevice reports whether the user has signed in before, but never with
+// this user agent. A user's very first sign-in is not treated as a new device.
+// Sign-ins still in authEventsBuffer are not counted, so two sign-ins from a
+// new device seconds apart may both be reported.
+func isNewDevice(ctx context.Context, userID int64, userAgent string) (bool, error) {
+	var previousLogins, sameDeviceLogins int
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE user_agent = $3)
+		FROM auth_events WHERE user_id = $1 AND event = $2`,
+		userID, models.AuthEventLoginSucceeded, truncateUserAgent(userAgent)).
+		Scan(&previousLogins, &sameDeviceLogins)
+	if err != nil {
+		return false, fmt.Errorf("error checking login history: %w", err)
+	}
+
+	return previousLogins > 0 && sameDeviceLogins == 0, nil
+}
@@ -0,0 +1,372 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrSeriesNotFound    = errors.New("series not found")
+	ErrSeriesPostUnknown = errors.New("post_ids contains an unknown post")
+	ErrPostInOtherSeries = errors.New("a post is already part of another series")
+)
+
+// SetupSeriesRoutes registers post series. Anyone can read them; staff
+// manage them.
+func SetupSeriesRoutes(r *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+	seriesRouter := r.PathPrefix("/series").Subrouter()
+	seriesRouter.HandleFunc("", GetSeriesList).Methods("GET")
+	seriesRouter.HandleFunc("/{id}", GetSeries).Methods("GET")
+	seriesRouter.Handle("", staff(CreateSeries)).Methods("POST")
+	seriesRouter.Handle("", staff(UpdateSeries)).Methods("PUT").Queries("id", "{id}")
+	seriesRouter.Handle("", staff(DeleteSeries)).Methods("DELETE").Queries("id", "{id}")
+}
+
+// seriesSurrogateKey tags CDN responses of a series.
+func seriesSurrogateKey(id string) string {
+	return "series-" + id
+}
+
+// GetSeriesList returns every series, most recently updated first, without
+// their posts.
+func GetSeriesList(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), `SELECT id, title, description, created_at, updated_at
+		FROM series ORDER BY updated_at DESC, id`)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Series{}
+	for rows.Next() {
+		series := models.Series{Posts: []models.SeriesPost{}}
+		if err := rows.Scan(&series.ID, &series.Title, &series.Description, &series.CreatedAt, &series.UpdatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+			return
+		}
+		list = append(list, series)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, list, http.StatusOK)
+}
+
+// GetSeries returns a series with its published posts in order.
+func GetSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	series, err := querySeries(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrSeriesNotFound) {
+			middlewares.HttpError(w, "Series not found", http.StatusNotFound, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, seriesSurrogateKey(id.String()), surrogateKeyPostsAll)
+	middlewares.RespondJSON(w, series, http.StatusOK)
+}
+
+// querySeries loads a series with its published posts in order.
+func querySeries(ctx context.Context, id uuid.UUID) (models.Series, error) {
+	series := models.Series{Posts: []models.SeriesPost{}}
+	err := db.DB.QueryRowContext(ctx, "SELECT id, title, description, created_at, updated_at FROM series WHERE id = $1", id).
+		Scan(&series.ID, &series.Title, &series.Description, &series.CreatedAt, &series.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Series{}, ErrSeriesNotFound
+	}
+	if err != nil {
+		return models.Series{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT p.id, p.title, p.slug, sp.position
+		FROM series_posts sp
+		JOIN posts p ON p.id = sp.post_id
+		WHERE sp.series_id = $1 AND p.status = 'published' AND p.deleted_at IS NULL
+		ORDER BY sp.position`, id)
+	if err != nil {
+		return models.Series{}, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post models.SeriesPost
+		if err := rows.Scan(&post.ID, &post.Title, &post.Slug, &post.Position); err != nil {
+			return models.Series{}, fmt.Errorf("error scanning row: %w", err)
+		}
+		series.Posts = append(series.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Series{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return series, nil
+}
+
+// querySeriesLinks returns the series of a post with its published
+// neighbours, or nil when the post is not part of a series. updatedAt is when
+// the series was last changed.
+func querySeriesLinks(ctx context.Context, postID uuid.UUID) (*models.SeriesLinks, time.Time, error) {
+	var (
+		links     models.SeriesLinks
+		updatedAt time.Time
+		position  int
+	)
+	err := db.DB.QueryRowContext(ctx, `SELECT s.id, s.title, s.updated_at, sp.position
+		FROM series_posts sp
+		JOIN series s ON s.id = sp.series_id
+		WHERE sp.post_id = $1`, postID).Scan(&links.ID, &links.Title, &updatedAt, &position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	neighbour := func(query string) (*models.SeriesPost, error) {
+		var post models.SeriesPost
+		err := db.DB.QueryRowContext(ctx, `SELECT p.id, p.title, p.slug, sp.position
+			FROM series_posts sp
+			JOIN posts p ON p.id = sp.post_id
+			WHERE sp.series_id = $1 AND p.status = 'published' AND p.deleted_at IS NULL AND `+query+`
+			LIMIT 1`, links.ID, position).Scan(&post.ID, &post.Title, &post.Slug, &post.Position)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error querying database: %w", err)
+		}
+		return &post, nil
+	}
+	if links.Previous, err = neighbour("sp.position < $2 ORDER BY sp.position DESC"); err != nil {
+		return nil, time.Time{}, err
+	}
+	if links.Next, err = neighbour("sp.position > $2 ORDER BY sp.position"); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return &links, updatedAt, nil
+}
+
+func CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var series models.Series
+	if err := json.NewDecoder(r.Body).Decode(&series); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSeries(&series); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	series.ID = uuid.New()
+	ctx := r.Context()
+	if err := saveSeries(ctx, series, true); err != nil {
+		respondSeriesError(w, "Failed to create series", err)
+		return
+	}
+
+	saved, err := querySeries(ctx, series.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondCreated(w, "/series/"+saved.ID.String(), saved)
+}
+
+// UpdateSeries replaces a series and its list of posts.
+func UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var series models.Series
+	if err := json.NewDecoder(r.Body).Decode(&series); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSeries(&series); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	series.ID = id
+	ctx := r.Context()
+	if err := saveSeries(ctx, series, false); err != nil {
+		respondSeriesError(w, "Failed to update series", err)
+		return
+	}
+
+	saved, err := querySeries(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch series", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, saved, http.StatusOK)
+}
+
+func DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	postIDs, err := querySeriesPostIDs(ctx, id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete series", http.StatusInternalServerError, err)
+		return
+	}
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM series WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete series", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Series not found", http.StatusNotFound, ErrSeriesNotFound)
+		return
+	}
+
+	purgeSeriesPosts(ctx, id, postIDs)
+	middlewares.RespondJSON(w, map[string]string{"message": "Series deleted"}, http.StatusOK)
+}
+
+func respondSeriesError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrSeriesNotFound):
+		middlewares.HttpError(w, "Series not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrSeriesPostUnknown):
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+	case errors.Is(err, ErrPostInOtherSeries):
+		middlewares.HttpError(w, err.Error(), http.StatusConflict, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// saveSeries inserts or updates a series and replaces its list of posts.
+// Posts dropped from the list and posts added to it show other neighbours
+// from now on, so their cached pages are purged.
+func saveSeries(ctx context.Context, series models.Series, create bool) error {
+	previous, err := querySeriesPostIDs(ctx, series.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if create {
+		_, err = tx.ExecContext(ctx, "INSERT INTO series (id, title, description) VALUES ($1, $2, $3)",
+			series.ID, series.Title, series.Description)
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.ExecContext(ctx, "UPDATE series SET title = $1, description = $2, updated_at = NOW() WHERE id = $3",
+			series.Title, series.Description, series.ID)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrSeriesNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM series_posts WHERE series_id = $1", series.ID); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]string, len(series.PostIDs))
+	for i, id := range series.PostIDs {
+		ids[i] = id.String()
+	}
+	result, err := tx.ExecContext(ctx, `INSERT INTO series_posts (series_id, post_id, position)
+		SELECT $1, p.id, o.ord
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, ord)
+		JOIN posts p ON p.id = o.id AND p.deleted_at IS NULL`, series.ID, pq.Array(ids))
+	if isUniqueViolation(err) {
+		return ErrPostInOtherSeries
+	}
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if int(affected) != len(ids) {
+		return ErrSeriesPostUnknown
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	purgeSeriesPosts(ctx, series.ID, append(previous, series.PostIDs...))
+	return nil
+}
+
+// querySeriesPostIDs returns the posts of a series in order.
+func querySeriesPostIDs(ctx context.Context, seriesID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT post_id FROM series_posts WHERE series_id = $1 ORDER BY position", seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return ids, nil
+}
+
+// purgeSeriesPosts purges the CDN pages of a series and of the posts whose
+// series links changed.
+func purgeSeriesPosts(ctx context.Context, seriesID uuid.UUID, postIDs []uuid.UUID) {
+	keys := []string{seriesSurrogateKey(seriesID.String())}
+	for _, id := range postIDs {
+		keys = append(keys, postSurrogateKey(id.String()))
+	}
+	queueCDNPurge(ctx, keys...)
+}
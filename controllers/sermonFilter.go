@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"jsmi-api/validation"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// sermonSortOrders adds sorting by the date preached to listSortOrders.
+var sermonSortOrders = func() map[string]string {
+	orders := maps.Clone(listSortOrders)
+	orders["preached_on"] = "preached_on, id"
+	orders["-preached_on"] = "preached_on DESC, id"
+	return orders
+}()
+
+// sermonFilterClause filters sermons by SermonFilter.Args, in this order.
+// From and to bound the date preached. Speakers match without regard to
+// case, like idx_sermons_speaker, and books use idx_sermons_books.
+const sermonFilterClause = `($1::timestamp IS NULL OR preached_on >= $1::timestamp)
+	AND ($2::timestamp IS NULL OR preached_on < $2::timestamp)
+	AND ($3 = '' OR title ILIKE '%' || $3 || '%' ESCAPE '\')
+	AND ($4 = '' OR lower(speaker) = lower($4))
+	AND ($5::uuid IS NULL OR series_id = $5::uuid)
+	AND ($6 = '' OR books @> ARRAY[$6::text])`
+
+// SermonFilter adds the speaker, series and book of sermons to a
+// ListFilter.
+type SermonFilter struct {
+	ListFilter
+	Speaker  string
+	SeriesID *uuid.UUID
+	// Book is the name of a book of the Bible, see validation.ScriptureBook.
+	Book string
+}
+
+// parseSermonFilter reads the ListFilter parameters, ?speaker=, ?series=,
+// the ID of a series, and ?book=, a book of the Bible by name or
+// abbreviation. Sermons can also be sorted by preached_on.
+func parseSermonFilter(r *http.Request) (SermonFilter, error) {
+	query := r.URL.Query()
+	base, err := parseListQuery(query, sermonSortOrders,
+		errors.New("sort must be preached_on, -preached_on, created_at, -created_at, title or -title"))
+	if err != nil {
+		return SermonFilter{}, err
+	}
+	filter := SermonFilter{ListFilter: base}
+
+	filter.Speaker = strings.TrimSpace(query.Get("speaker"))
+	if len(filter.Speaker) > maxListQueryLength {
+		return SermonFilter{}, errors.New("speaker is too long")
+	}
+	if series := query.Get("series"); series != "" {
+		id, err := uuid.Parse(series)
+		if err != nil {
+			return SermonFilter{}, errors.New("series must be a series ID")
+		}
+		filter.SeriesID = &id
+	}
+	if book := query.Get("book"); book != "" {
+		name, ok := validation.ScriptureBook(book)
+		if !ok {
+			return SermonFilter{}, errors.New("book must be a book of the Bible")
+		}
+		filter.Book = name
+	}
+	return filter, nil
+}
+
+// OrderBy returns the ORDER BY clause of the requested sort, or fallback.
+func (f SermonFilter) OrderBy(fallback string) string {
+	if order, ok := sermonSortOrders[f.Sort]; ok {
+		return order
+	}
+	return fallback
+}
+
+// Args returns the parameters of sermonFilterClause.
+func (f SermonFilter) Args() []any {
+	return append(f.ListFilter.Args(), f.Speaker, f.SeriesID, f.Book)
+}
+
+// CacheField extends ListFilter.CacheField with the sermon filters.
+func (f SermonFilter) CacheField() string {
+	values := f.ListFilter.cacheValues()
+	if f.Speaker != "" {
+		values.Set("speaker", strings.ToLower(f.Speaker))
+	}
+	if f.SeriesID != nil {
+		values.Set("series", f.SeriesID.String())
+	}
+	if f.Book != "" {
+		values.Set("book", f.Book)
+	}
+	return values.Encode()
+}
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/events"
+	"jsmi-api/metrics"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// sermonsCacheEntity versions the Redis keys of cached sermons, see
+// db.CacheKey.
+const sermonsCacheEntity = "sermons"
+
+var ErrSermonNotFound = errors.New("sermon not found")
+
+// SetupSermonRoutes registers the sermon endpoints. Anyone can listen to
+// sermons; staff publish them.
+func SetupSermonRoutes(r *mux.Router) {
+	staff := func(h http.HandlerFunc) http.Handler {
+		return middlewares.TokenAuthMiddleware(middlewares.StaffOnly(h))
+	}
+
+	sermonsRouter := r.PathPrefix("/sermons").Subrouter()
+	sermonsRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetSermon))).Methods("GET").Queries("id", "{id}")
+	sermonsRouter.Handle("", middlewares.Coalesce(http.HandlerFunc(GetSermons))).Methods("GET")
+	sermonsRouter.Handle("", staff(CreateSermon)).Methods("POST")
+	sermonsRouter.Handle("", staff(UpdateSermon)).Methods("PUT").Queries("id", "{id}")
+	sermonsRouter.Handle("", staff(DeleteSermon)).Methods("DELETE").Queries("id", "{id}")
+}
+
+const sermonColumns = `id, title, description, speaker, series_id, to_char(preached_on, 'YYYY-MM-DD'),
+	audio_url, video_url, duration_seconds, scripture_references, books, created_at, updated_at`
+
+func scanSermon(row rowScanner) (models.Sermon, error) {
+	var sermon models.Sermon
+	err := row.Scan(&sermon.ID, &sermon.Title, &sermon.Description, &sermon.Speaker, &sermon.SeriesID,
+		&sermon.PreachedOn, &sermon.AudioURL, &sermon.VideoURL, &sermon.DurationSeconds,
+		pq.Array(&sermon.ScriptureReferences), pq.Array(&sermon.Books), &sermon.CreatedAt, &sermon.UpdatedAt)
+	if sermon.ScriptureReferences == nil {
+		sermon.ScriptureReferences = []string{}
+	}
+	if sermon.Books == nil {
+		sermon.Books = []string{}
+	}
+	return sermon, err
+}
+
+// sermonLocation is the URL of a sermon for Location headers.
+func sermonLocation(id uuid.UUID) string {
+	return "/sermons?id=" + id.String()
+}
+
+// GetSermons lists sermons one page at a time, most recently preached first
+// unless ?sort= asks for another order. ?speaker=, ?series= and ?book=
+// narrow the list, and ?from= and ?to= bound the date preached.
+func GetSermons(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	filter, err := parseSermonFilter(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	sermons, err := fetchSermonPage(ctx, filter, page)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch sermons", http.StatusInternalServerError, err)
+		return
+	}
+
+	lastModified, err := queryLastChange(ctx, "sermons", nil)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch sermons", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, surrogateKeySermons, surrogateKeySermonsAll)
+	respondConditional(w, r, sermons, lastModified)
+}
+
+// fetchSermonPage returns a page of sermons from the filtered list cache, or
+// queries and caches it.
+func fetchSermonPage(ctx context.Context, filter SermonFilter, page Page) (PaginatedResponse[models.Sermon], error) {
+	values, _ := url.ParseQuery(filter.CacheField())
+	values.Set("page", strconv.Itoa(page.Number))
+	values.Set("per_page", strconv.Itoa(page.PerPage))
+	field := values.Encode()
+
+	var sermons PaginatedResponse[models.Sermon]
+	cachedData, err := db.GetFilteredList(ctx, sermonsCacheEntity, field)
+	metrics.ObserveCache(err)
+	if err == nil {
+		if err := json.Unmarshal(cachedData, &sermons); err != nil {
+			return sermons, fmt.Errorf("error unmarshalling cached sermons data: %w", err)
+		}
+		return sermons, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return sermons, fmt.Errorf("error fetching sermons from Redis cache: %w", err)
+	}
+
+	sermons, err = querySermonPage(ctx, filter, page)
+	if err != nil {
+		return sermons, err
+	}
+
+	jsonData, err := json.Marshal(sermons)
+	if err == nil {
+		const CacheTime = 24 * time.Hour
+		db.SetFilteredList(ctx, sermonsCacheEntity, field, jsonData, CacheTime)
+	}
+	return sermons, nil
+}
+
+// querySermonPage loads a page of the sermons that match filter.
+func querySermonPage(ctx context.Context, filter SermonFilter, page Page) (PaginatedResponse[models.Sermon], error) {
+	sermons := PaginatedResponse[models.Sermon]{Items: []models.Sermon{}, Page: page.Number, PerPage: page.PerPage}
+	where := " FROM sermons WHERE " + sermonFilterClause
+
+	args := filter.Args()
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*)"+where, args...).Scan(&sermons.Total); err != nil {
+		return sermons, fmt.Errorf("error querying database: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+sermonColumns+where+" ORDER BY "+filter.OrderBy("preached_on DESC, id")+
+		" LIMIT $7 OFFSET $8", append(args, page.PerPage, page.Offset())...)
+	if err != nil {
+		return sermons, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sermon, err := scanSermon(rows)
+		if err != nil {
+			return sermons, fmt.Errorf("error scanning row: %w", err)
+		}
+		sermons.Items = append(sermons.Items, sermon)
+	}
+	if err := rows.Err(); err != nil {
+		return sermons, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return sermons, nil
+}
+
+func GetSermon(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	sermon, err := fetchSermon(ctx, id)
+	if errors.Is(err, ErrSermonNotFound) {
+		respondNotFound(w, "sermon", "Sermon not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch sermon", http.StatusInternalServerError, err)
+		return
+	}
+
+	lastModified, err := queryLastChange(ctx, "sermons", &sermon.ID)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch sermon", http.StatusInternalServerError, err)
+		return
+	}
+
+	setSurrogateKeys(w, sermonSurrogateKey(idStr), surrogateKeySermonsAll)
+	respondConditional(w, r, sermon, lastModified)
+}
+
+// fetchSermon returns a sermon from the cache, or queries and caches it.
+func fetchSermon(ctx context.Context, id uuid.UUID) (models.Sermon, error) {
+	cacheKey, err := db.CacheKey(ctx, sermonsCacheEntity, id.String())
+	if err != nil {
+		return models.Sermon{}, err
+	}
+	cachedData, err := db.RedisClient.Get(ctx, cacheKey).Result()
+	metrics.ObserveCache(err)
+	if err == nil {
+		var sermon models.Sermon
+		if err := json.Unmarshal([]byte(cachedData), &sermon); err != nil {
+			return models.Sermon{}, fmt.Errorf("error unmarshalling cached sermon data: %w", err)
+		}
+		return sermon, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return models.Sermon{}, fmt.Errorf("error fetching sermon %s from Redis cache: %w", id, err)
+	}
+
+	sermon, err := scanSermon(db.DB.QueryRowContext(ctx, "SELECT "+sermonColumns+" FROM sermons WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sermon{}, fmt.Errorf("sermon %s: %w", id, ErrSermonNotFound)
+	}
+	if err != nil {
+		return models.Sermon{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	jsonData, err := json.Marshal(sermon)
+	if err == nil {
+		const CacheTime = 7 * 24 * time.Hour
+		if err := db.RedisClient.Set(ctx, cacheKey, jsonData, CacheTime).Err(); err != nil {
+			return models.Sermon{}, fmt.Errorf("error setting sermon cache: %w", err)
+		}
+	}
+	return sermon, nil
+}
+
+func CreateSermon(w http.ResponseWriter, r *http.Request) {
+	var sermon models.Sermon
+	if err := json.NewDecoder(r.Body).Decode(&sermon); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSermon(&sermon); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	sermon.ID = uuid.New()
+	saved, err := scanSermon(db.DB.QueryRowContext(ctx, `INSERT INTO sermons (id, title, description, speaker,
+			series_id, preached_on, audio_url, video_url, duration_seconds, scripture_references, books)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+sermonColumns,
+		sermon.ID, sermon.Title, sermon.Description, sermon.Speaker, sermon.SeriesID, sermon.PreachedOn,
+		sermon.AudioURL, sermon.VideoURL, sermon.DurationSeconds, pq.Array(sermon.ScriptureReferences),
+		pq.Array(sermon.Books)))
+	if isForeignKeyViolation(err) {
+		respondUnknownSeries(w)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create sermon", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := sermonChanged(ctx, events.ActionCreated, saved.ID); err != nil {
+		middlewares.HttpError(w, "Failed to clear sermon cache", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondCreated(w, sermonLocation(saved.ID), saved)
+}
+
+func UpdateSermon(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	var sermon models.Sermon
+	if err := json.NewDecoder(r.Body).Decode(&sermon); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSermon(&sermon); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	saved, err := scanSermon(db.DB.QueryRowContext(ctx, `UPDATE sermons SET title = $1, description = $2,
+			speaker = $3, series_id = $4, preached_on = $5, audio_url = $6, video_url = $7,
+			duration_seconds = $8, scripture_references = $9, books = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11
+		RETURNING `+sermonColumns,
+		sermon.Title, sermon.Description, sermon.Speaker, sermon.SeriesID, sermon.PreachedOn,
+		sermon.AudioURL, sermon.VideoURL, sermon.DurationSeconds, pq.Array(sermon.ScriptureReferences),
+		pq.Array(sermon.Books), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "sermon", "Sermon not found", idStr, err)
+		return
+	}
+	if isForeignKeyViolation(err) {
+		respondUnknownSeries(w)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to update sermon", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := sermonChanged(ctx, events.ActionUpdated, id); err != nil {
+		middlewares.HttpError(w, "Failed to clear sermon cache", http.StatusInternalServerError, err)
+		return
+	}
+	middlewares.RespondJSON(w, saved, http.StatusOK)
+}
+
+func DeleteSermon(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM sermons WHERE id = $1", id)
+	if err == nil {
+		err = requireAffected(result)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(w, "sermon", "Sermon not found", idStr, err)
+		return
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete sermon", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := sermonChanged(ctx, events.ActionDeleted, id); err != nil {
+		middlewares.HttpError(w, "Failed to clear sermon cache", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sermonChanged drops the cached lists and the cached sermon, purges them
+// from the CDN and announces the change.
+func sermonChanged(ctx context.Context, action string, id uuid.UUID) error {
+	idStr := id.String()
+	if err := db.DeleteCacheKeys(ctx, sermonsCacheEntity, idStr); err != nil {
+		return err
+	}
+	queueCDNPurge(ctx, surrogateKeySermons, sermonSurrogateKey(idStr))
+
+	events.Publish(ctx, events.TypeSermon, action, idStr)
+	return nil
+}
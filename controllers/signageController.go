@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultSlideDuration is how many seconds a slide without a duration shows.
+const defaultSlideDuration = 10
+
+var ErrSignagePlaylistNotFound = errors.New("signage playlist not found")
+
+const signagePlaylistColumns = "id, name, slides, starts_at, ends_at, created_at, updated_at"
+
+func scanSignagePlaylist(row rowScanner) (models.SignagePlaylist, error) {
+	var (
+		playlist models.SignagePlaylist
+		slides   []byte
+	)
+	err := row.Scan(&playlist.ID, &playlist.Name, &slides, &playlist.StartsAt, &playlist.EndsAt,
+		&playlist.CreatedAt, &playlist.UpdatedAt)
+	if err != nil {
+		return models.SignagePlaylist{}, err
+	}
+	if err := json.Unmarshal(slides, &playlist.Slides); err != nil {
+		return models.SignagePlaylist{}, fmt.Errorf("error decoding slides: %w", err)
+	}
+	return playlist, nil
+}
+
+// GetSignageFeed returns the slides displays should show now. Displays poll
+// it with If-None-Match. Slides start and stop on their schedules without
+// the playlist changing, so there is no Last-Modified to go by.
+func GetSignageFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := querySignageFeed(r.Context(), time.Now())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch signage", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondConditional(w, r, feed, time.Time{})
+}
+
+// querySignageFeed picks the active playlist: the scheduled playlist running
+// at now that started last, else the most recently updated default one.
+func querySignageFeed(ctx context.Context, now time.Time) (models.SignageFeed, error) {
+	feed := models.SignageFeed{Slides: []models.SignageSlide{}}
+	playlist, err := scanSignagePlaylist(db.DB.QueryRowContext(ctx, "SELECT "+signagePlaylistColumns+` FROM signage_playlists
+		WHERE (starts_at IS NULL OR starts_at <= $1) AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY starts_at DESC NULLS LAST, updated_at DESC
+		LIMIT 1`, now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return feed, nil
+	}
+	if err != nil {
+		return models.SignageFeed{}, fmt.Errorf("error querying database: %w", err)
+	}
+
+	feed.PlaylistID = &playlist.ID
+	for _, slide := range playlist.Slides {
+		if slide.StartsAt != nil && now.Before(*slide.StartsAt) || slide.EndsAt != nil && !now.Before(*slide.EndsAt) {
+			continue
+		}
+		feed.Slides = append(feed.Slides, slide)
+	}
+	return feed, nil
+}
+
+// GetSignagePlaylists lists every playlist, scheduled ones by start.
+func GetSignagePlaylists(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT "+signagePlaylistColumns+` FROM signage_playlists
+		ORDER BY starts_at NULLS FIRST, updated_at DESC`)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch signage playlists", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	playlists := []models.SignagePlaylist{}
+	for rows.Next() {
+		playlist, err := scanSignagePlaylist(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch signage playlists", http.StatusInternalServerError, err)
+			return
+		}
+		playlists = append(playlists, playlist)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch signage playlists", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, playlists, http.StatusOK)
+}
+
+// prepareSignagePlaylist fills in defaults, validates a playlist and encodes
+// its slides for storage.
+func prepareSignagePlaylist(playlist *models.SignagePlaylist) ([]byte, error) {
+	if playlist.Slides == nil {
+		playlist.Slides = []models.SignageSlide{}
+	}
+	for i := range playlist.Slides {
+		if playlist.Slides[i].DurationSeconds == 0 {
+			playlist.Slides[i].DurationSeconds = defaultSlideDuration
+		}
+	}
+	if err := validation.ValidateSignagePlaylist(playlist); err != nil {
+		return nil, err
+	}
+	return json.Marshal(playlist.Slides)
+}
+
+func CreateSignagePlaylist(w http.ResponseWriter, r *http.Request) {
+	var playlist models.SignagePlaylist
+	if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	slides, err := prepareSignagePlaylist(&playlist)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	saved, err := scanSignagePlaylist(db.DB.QueryRowContext(r.Context(), `INSERT INTO signage_playlists (name, slides, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+signagePlaylistColumns, playlist.Name, slides, playlist.StartsAt, playlist.EndsAt))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create signage playlist", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondCreated(w, "/admin/signage/playlists?id="+saved.ID.String(), saved)
+}
+
+// UpdateSignagePlaylist replaces a playlist and its slides.
+func UpdateSignagePlaylist(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var playlist models.SignagePlaylist
+	if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	slides, err := prepareSignagePlaylist(&playlist)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	saved, err := scanSignagePlaylist(db.DB.QueryRowContext(r.Context(), `UPDATE signage_playlists
+		SET name = $1, slides = $2, starts_at = $3, ends_at = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING `+signagePlaylistColumns, playlist.Name, slides, playlist.StartsAt, playlist.EndsAt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Signage playlist not found", http.StatusNotFound, ErrSignagePlaylistNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update signage playlist", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, saved, http.StatusOK)
+}
+
+func DeleteSignagePlaylist(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM signage_playlists WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete signage playlist", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Signage playlist not found", http.StatusNotFound, ErrSignagePlaylistNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
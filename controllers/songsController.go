@@ -0,0 +1,586 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrSongNotFound       = errors.New("song not found")
+	ErrSongInUse          = errors.New("song is used in a worship set")
+	ErrCCLINumberTaken    = errors.New("a song with this CCLI number already exists")
+	ErrWorshipSetNotFound = errors.New("worship set not found")
+)
+
+// maxCCLIReportDays bounds report periods; CCLI asks for reports covering at
+// most a year of services.
+const maxCCLIReportDays = 366
+
+// SetupSongRoutes registers the song library, worship sets and CCLI report.
+// They are only available to staff.
+func SetupSongRoutes(r *mux.Router) {
+	songsRouter := r.PathPrefix("/songs").Subrouter()
+	songsRouter.Use(middlewares.TokenAuthMiddleware, middlewares.StaffOnly)
+	songsRouter.HandleFunc("", GetSongs).Methods("GET")
+	songsRouter.HandleFunc("", CreateSong).Methods("POST")
+	songsRouter.HandleFunc("", UpdateSong).Methods("PUT").Queries("id", "{id}")
+	songsRouter.HandleFunc("", DeleteSong).Methods("DELETE").Queries("id", "{id}")
+	songsRouter.HandleFunc("/ccli-report", ExportCCLIReport).Methods("GET").Queries("from", "{from}", "to", "{to}")
+
+	setsRouter := r.PathPrefix("/worship-sets").Subrouter()
+	setsRouter.Use(middlewares.TokenAuthMiddleware, middlewares.StaffOnly)
+	setsRouter.HandleFunc("", GetWorshipSets).Methods("GET")
+	setsRouter.HandleFunc("", CreateWorshipSet).Methods("POST")
+	setsRouter.HandleFunc("", UpdateWorshipSet).Methods("PUT").Queries("id", "{id}")
+	setsRouter.HandleFunc("", DeleteWorshipSet).Methods("DELETE").Queries("id", "{id}")
+}
+
+func GetSongs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		song, err := querySong(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrSongNotFound) {
+				middlewares.HttpError(w, "Song not found", http.StatusNotFound, err)
+				return
+			}
+			middlewares.HttpError(w, "Failed to fetch song", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, song, http.StatusOK)
+		return
+	}
+
+	songs, err := querySongs(ctx)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch songs", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, songs, http.StatusOK)
+}
+
+const songColumns = "id, title, author, ccli_number, song_key, lyrics_reference, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSong(row rowScanner) (models.Song, error) {
+	var song models.Song
+	err := row.Scan(&song.ID, &song.Title, &song.Author, &song.CCLINumber, &song.Key,
+		&song.LyricsReference, &song.CreatedAt, &song.UpdatedAt)
+	return song, err
+}
+
+func querySongs(ctx context.Context) ([]models.Song, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+songColumns+" FROM songs ORDER BY title")
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	songs := []models.Song{}
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		songs = append(songs, song)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return songs, nil
+}
+
+func querySong(ctx context.Context, id uuid.UUID) (models.Song, error) {
+	song, err := scanSong(db.DB.QueryRowContext(ctx, "SELECT "+songColumns+" FROM songs WHERE id = $1", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Song{}, ErrSongNotFound
+		}
+		return models.Song{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return song, nil
+}
+
+func CreateSong(w http.ResponseWriter, r *http.Request) {
+	var song models.Song
+	if err := json.NewDecoder(r.Body).Decode(&song); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSong(&song); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	song.ID = uuid.New()
+	song.CreatedAt = time.Now()
+	song.UpdatedAt = song.CreatedAt
+
+	_, err := db.DB.ExecContext(r.Context(), `INSERT INTO songs
+		(id, title, author, ccli_number, song_key, lyrics_reference, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		song.ID, song.Title, song.Author, song.CCLINumber, song.Key, song.LyricsReference, song.CreatedAt, song.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			middlewares.HttpError(w, ErrCCLINumberTaken.Error(), http.StatusConflict, err)
+			return
+		}
+		middlewares.HttpError(w, "Failed to create song", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, song, http.StatusCreated)
+}
+
+func UpdateSong(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var song models.Song
+	if err := json.NewDecoder(r.Body).Decode(&song); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateSong(&song); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	err = db.DB.QueryRowContext(r.Context(), `UPDATE songs
+		SET title = $1, author = $2, ccli_number = $3, song_key = $4, lyrics_reference = $5, updated_at = NOW()
+		WHERE id = $6 RETURNING id, created_at, updated_at`,
+		song.Title, song.Author, song.CCLINumber, song.Key, song.LyricsReference, id).
+		Scan(&song.ID, &song.CreatedAt, &song.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			middlewares.HttpError(w, "Song not found", http.StatusNotFound, err)
+		case isUniqueViolation(err):
+			middlewares.HttpError(w, ErrCCLINumberTaken.Error(), http.StatusConflict, err)
+		default:
+			middlewares.HttpError(w, "Failed to update song", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	middlewares.RespondJSON(w, song, http.StatusOK)
+}
+
+// DeleteSong removes a song from the library. Songs used in a worship set are
+// kept so that past CCLI reports stay accurate.
+func DeleteSong(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM songs WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			middlewares.HttpError(w, "Song is used in a worship set", http.StatusConflict, ErrSongInUse)
+			return
+		}
+		middlewares.HttpError(w, "Failed to delete song", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Song not found", http.StatusNotFound, ErrSongNotFound)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Song deleted"}, http.StatusOK)
+}
+
+// GetWorshipSets lists worship sets, newest service first. It accepts an id to
+// fetch a single set, or a live_id to list the sets of one live.
+func GetWorshipSets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	if idStr := query.Get("id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+			return
+		}
+		sets, err := queryWorshipSets(ctx, "ws.id = $1", id)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch worship set", http.StatusInternalServerError, err)
+			return
+		}
+		if len(sets) == 0 {
+			middlewares.HttpError(w, "Worship set not found", http.StatusNotFound, ErrWorshipSetNotFound)
+			return
+		}
+		middlewares.RespondJSON(w, sets[0], http.StatusOK)
+		return
+	}
+
+	var (
+		sets []models.WorshipSet
+		err  error
+	)
+	if liveIDStr := query.Get("live_id"); liveIDStr != "" {
+		liveID, parseErr := uuid.Parse(liveIDStr)
+		if parseErr != nil {
+			middlewares.HttpError(w, "Invalid live_id parameter", http.StatusBadRequest, parseErr)
+			return
+		}
+		sets, err = queryWorshipSets(ctx, "ws.live_id = $1", liveID)
+	} else {
+		sets, err = queryWorshipSets(ctx, "TRUE")
+	}
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch worship sets", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, sets, http.StatusOK)
+}
+
+// queryWorshipSets loads the worship sets matching where, with their songs in order.
+func queryWorshipSets(ctx context.Context, where string, args ...any) ([]models.WorshipSet, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT ws.id, ws.live_id, to_char(ws.service_date, 'YYYY-MM-DD'), ws.notes,
+			ws.created_at, ws.updated_at,
+			s.id, s.title, s.author, s.ccli_number, s.song_key, s.lyrics_reference, s.created_at, s.updated_at
+		FROM worship_sets ws
+		LEFT JOIN worship_set_songs wss ON wss.worship_set_id = ws.id
+		LEFT JOIN songs s ON s.id = wss.song_id
+		WHERE `+where+`
+		ORDER BY ws.service_date DESC, ws.created_at DESC, wss.position`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	sets := []models.WorshipSet{}
+	for rows.Next() {
+		var (
+			set     models.WorshipSet
+			liveID  uuid.NullUUID
+			songID  uuid.NullUUID
+			title   sql.NullString
+			author  sql.NullString
+			ccli    sql.NullString
+			key     sql.NullString
+			lyrics  sql.NullString
+			created sql.NullTime
+			updated sql.NullTime
+		)
+		if err := rows.Scan(&set.ID, &liveID, &set.ServiceDate, &set.Notes, &set.CreatedAt, &set.UpdatedAt,
+			&songID, &title, &author, &ccli, &key, &lyrics, &created, &updated); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		if n := len(sets); n == 0 || sets[n-1].ID != set.ID {
+			if liveID.Valid {
+				set.LiveID = &liveID.UUID
+			}
+			set.Songs = []models.Song{}
+			sets = append(sets, set)
+		}
+		if songID.Valid {
+			current := &sets[len(sets)-1]
+			current.Songs = append(current.Songs, models.Song{
+				ID:              songID.UUID,
+				Title:           title.String,
+				Author:          author.String,
+				CCLINumber:      ccli.String,
+				Key:             key.String,
+				LyricsReference: lyrics.String,
+				CreatedAt:       created.Time,
+				UpdatedAt:       updated.Time,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return sets, nil
+}
+
+func CreateWorshipSet(w http.ResponseWriter, r *http.Request) {
+	var set models.WorshipSet
+	if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWorshipSet(set); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	set.ID = uuid.New()
+	ctx := r.Context()
+	if err := saveWorshipSet(ctx, set, true); err != nil {
+		respondWorshipSetError(w, "Failed to create worship set", err)
+		return
+	}
+
+	sets, err := queryWorshipSets(ctx, "ws.id = $1", set.ID)
+	if err != nil || len(sets) == 0 {
+		middlewares.HttpError(w, "Failed to fetch worship set", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, sets[0], http.StatusCreated)
+}
+
+func UpdateWorshipSet(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var set models.WorshipSet
+	if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWorshipSet(set); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	set.ID = id
+	ctx := r.Context()
+	if err := saveWorshipSet(ctx, set, false); err != nil {
+		respondWorshipSetError(w, "Failed to update worship set", err)
+		return
+	}
+
+	sets, err := queryWorshipSets(ctx, "ws.id = $1", set.ID)
+	if err != nil || len(sets) == 0 {
+		middlewares.HttpError(w, "Failed to fetch worship set", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, sets[0], http.StatusOK)
+}
+
+func respondWorshipSetError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, ErrWorshipSetNotFound):
+		middlewares.HttpError(w, "Worship set not found", http.StatusNotFound, err)
+	case errors.Is(err, ErrLiveNotFound):
+		middlewares.HttpError(w, "Live not found", http.StatusBadRequest, err)
+	case errors.Is(err, ErrSongNotFound):
+		middlewares.HttpError(w, "song_ids contains an unknown song", http.StatusBadRequest, err)
+	default:
+		middlewares.HttpError(w, message, http.StatusInternalServerError, err)
+	}
+}
+
+// saveWorshipSet inserts or updates a worship set and replaces its song list.
+func saveWorshipSet(ctx context.Context, set models.WorshipSet, create bool) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if set.LiveID != nil {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT true FROM lives WHERE id = $1", *set.LiveID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLiveNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if create {
+		_, err = tx.ExecContext(ctx, `INSERT INTO worship_sets (id, live_id, service_date, notes)
+			VALUES ($1, $2, $3, $4)`, set.ID, set.LiveID, set.ServiceDate, set.Notes)
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.ExecContext(ctx, `UPDATE worship_sets
+			SET live_id = $1, service_date = $2, notes = $3, updated_at = NOW() WHERE id = $4`,
+			set.LiveID, set.ServiceDate, set.Notes, set.ID)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrWorshipSetNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM worship_set_songs WHERE worship_set_id = $1", set.ID); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]string, len(set.SongIDs))
+	for i, id := range set.SongIDs {
+		ids[i] = id.String()
+	}
+	// A song may appear twice in a set (e.g. reprised), so the positions come
+	// from the request order rather than the song IDs.
+	result, err := tx.ExecContext(ctx, `INSERT INTO worship_set_songs (worship_set_id, song_id, position)
+		SELECT $1, s.id, o.ord
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, ord)
+		JOIN songs s ON s.id = o.id`, set.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if int(affected) != len(ids) {
+		return ErrSongNotFound
+	}
+
+	return tx.Commit()
+}
+
+func DeleteWorshipSet(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM worship_sets WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete worship set", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Worship set not found", http.StatusNotFound, ErrWorshipSetNotFound)
+		return
+	}
+
+	middlewares.RespondJSON(w, map[string]string{"message": "Worship set deleted"}, http.StatusOK)
+}
+
+// ExportCCLIReport reports how many services used each song with a CCLI
+// number between from and to (inclusive, YYYY-MM-DD). It returns CSV ready
+// for CCLI's reporting form, or JSON with format=json.
+func ExportCCLIReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := validation.ParseDate(query.Get("from"))
+	if err != nil {
+		middlewares.HttpError(w, "from must be formatted as YYYY-MM-DD", http.StatusBadRequest, err)
+		return
+	}
+	to, err := validation.ParseDate(query.Get("to"))
+	if err != nil {
+		middlewares.HttpError(w, "to must be formatted as YYYY-MM-DD", http.StatusBadRequest, err)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxCCLIReportDays*24*time.Hour {
+		http.Error(w, "Reporting period must not exceed a year", http.StatusBadRequest)
+		return
+	}
+
+	report, err := buildCCLIReport(r.Context(), from, to)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to build CCLI report", http.StatusInternalServerError, err)
+		return
+	}
+
+	if query.Get("format") == "json" {
+		middlewares.RespondJSON(w, report, http.StatusOK)
+		return
+	}
+
+	filename := fmt.Sprintf("ccli-report-%s-to-%s.csv", report.From, report.To)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"CCLI Song Number", "Title", "Author", "Uses", "First Used", "Last Used"})
+	for _, usage := range report.Songs {
+		_ = writer.Write([]string{usage.CCLINumber, usage.Title, usage.Author, strconv.Itoa(usage.Uses),
+			usage.FirstUsed, usage.LastUsed})
+	}
+	writer.Flush()
+}
+
+// buildCCLIReport counts each song once per worship set. Songs without a CCLI
+// number (e.g. public domain hymns) are not reportable and are left out.
+func buildCCLIReport(ctx context.Context, from, to time.Time) (models.CCLIReport, error) {
+	report := models.CCLIReport{
+		From:  from.Format(time.DateOnly),
+		To:    to.Format(time.DateOnly),
+		Songs: []models.CCLIUsage{},
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT s.ccli_number, s.title, s.author, COUNT(DISTINCT ws.id),
+			to_char(MIN(ws.service_date), 'YYYY-MM-DD'), to_char(MAX(ws.service_date), 'YYYY-MM-DD')
+		FROM worship_set_songs wss
+		JOIN worship_sets ws ON ws.id = wss.worship_set_id
+		JOIN songs s ON s.id = wss.song_id
+		WHERE ws.service_date BETWEEN $1 AND $2 AND s.ccli_number <> ''
+		GROUP BY s.id, s.ccli_number, s.title, s.author
+		ORDER BY COUNT(DISTINCT ws.id) DESC, s.title`, report.From, report.To)
+	if err != nil {
+		return report, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var usage models.CCLIUsage
+		if err := rows.Scan(&usage.CCLINumber, &usage.Title, &usage.Author, &usage.Uses,
+			&usage.FirstUsed, &usage.LastUsed); err != nil {
+			return report, fmt.Errorf("error scanning row: %w", err)
+		}
+		report.Songs = append(report.Songs, usage)
+	}
+
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return report, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
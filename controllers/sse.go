@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeatInterval keeps idle connections open through proxies.
+const sseHeartbeatInterval = 25 * time.Second
+
+// SSEEvent is a single Server-Sent Event. ID, if set, is sent back by
+// reconnecting clients in the Last-Event-ID header.
+type SSEEvent struct {
+	ID   string
+	Name string
+	Data []byte
+}
+
+// streamRedisChannel serves a Server-Sent Events stream. It first sends the
+// initial events, then forwards every message published on the Redis channel
+// as an event named eventName. Redis pub/sub makes updates from any API
+// instance reach clients connected to any other instance.
+func streamRedisChannel(w http.ResponseWriter, r *http.Request, channel, eventName string, initial ...SSEEvent) {
+	streamRedisEvents(w, r, channel, func(payload string) SSEEvent {
+		return SSEEvent{Name: eventName, Data: []byte(payload)}
+	}, initial...)
+}
+
+// streamRedisEvents is streamRedisChannel for channels that carry several
+// kinds of events; toEvent turns each message into its event.
+func streamRedisEvents(w http.ResponseWriter, r *http.Request, channel string, toEvent func(payload string) SSEEvent, initial ...SSEEvent) {
+	rc := http.NewResponseController(w)
+	// The server's WriteTimeout would otherwise cut long-lived streams.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		middlewares.HttpError(w, "Streaming is not supported", http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	pubsub := db.RedisClient.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		middlewares.HttpError(w, "Failed to subscribe to updates", http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSSEHeaders(w)
+
+	for _, event := range initial {
+		if writeSSEEvent(w, event) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	messages := pubsub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if writeSSEEvent(w, toEvent(msg.Payload)) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeSSEEvent(w http.ResponseWriter, event SSEEvent) error {
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+	return err
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultStripeAPIURL = "https://api.stripe.com/v1"
+	// stripeSignatureTolerance is how old a webhook may be, against replays.
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidStripeSignature = errors.New("invalid Stripe signature")
+
+// StripeConfig configures online giving through Stripe.
+type StripeConfig struct {
+	// SecretKey is "" when Stripe is off.
+	SecretKey string
+	// WebhookSecret verifies the signatures of Stripe's webhooks.
+	WebhookSecret string
+	APIURL        string
+	// Currency is the currency of gifts that do not name one.
+	Currency string
+}
+
+var (
+	stripeConfig     *StripeConfig
+	stripeConfigOnce sync.Once
+	stripeClient     = &http.Client{Timeout: 30 * time.Second}
+)
+
+// LoadStripeConfig reads STRIPE_SECRET_KEY with STRIPE_WEBHOOK_SECRET, and
+// optionally STRIPE_API_URL and DONATION_CURRENCY, which defaults to KES.
+func LoadStripeConfig() (*StripeConfig, error) {
+	config := &StripeConfig{
+		SecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
+		WebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		APIURL:        strings.TrimSuffix(os.Getenv("STRIPE_API_URL"), "/"),
+		Currency:      strings.ToUpper(os.Getenv("DONATION_CURRENCY")),
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultStripeAPIURL
+	}
+	if config.Currency == "" {
+		config.Currency = "KES"
+	}
+	parsed, err := url.Parse(config.APIURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("STRIPE_API_URL must be an http(s) URL")
+	}
+	if len(config.Currency) != 3 {
+		return nil, errors.New("DONATION_CURRENCY must be a three-letter ISO 4217 code")
+	}
+	if config.SecretKey == "" {
+		return config, nil
+	}
+	if !strings.HasPrefix(config.SecretKey, "sk_") && !strings.HasPrefix(config.SecretKey, "rk_") {
+		return nil, errors.New("STRIPE_SECRET_KEY must be a secret or restricted key")
+	}
+	// Without the webhook secret no gift would ever be confirmed.
+	if !strings.HasPrefix(config.WebhookSecret, "whsec_") {
+		return nil, errors.New("STRIPE_WEBHOOK_SECRET is required with STRIPE_SECRET_KEY")
+	}
+	return config, nil
+}
+
+func stripe() *StripeConfig {
+	stripeConfigOnce.Do(func() {
+		config, err := LoadStripeConfig()
+		if err != nil {
+			log.Printf("Stripe integration disabled: %v", err)
+			config = &StripeConfig{Currency: "KES"}
+		}
+		stripeConfig = config
+	})
+	return stripeConfig
+}
+
+// stripePost calls the Stripe API with a form body and decodes the
+// response into out. idempotencyKey makes retries of the same call safe.
+func stripePost(ctx context.Context, resource string, form url.Values, idempotencyKey string, out any) error {
+	config := stripe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.APIURL+"/"+resource, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(config.SecretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	resp, err := stripeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Stripe %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Stripe %s returned %s: %s", resource, resp.Status, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding Stripe %s response: %w", resource, err)
+	}
+	return nil
+}
+
+// stripeProvider takes card payments through Stripe.
+type stripeProvider struct{}
+
+func (stripeProvider) Enabled() bool    { return stripe().SecretKey != "" }
+func (stripeProvider) Method() string   { return "card" }
+func (stripeProvider) Currency() string { return stripe().Currency }
+
+// Start creates the PaymentIntent of a pending gift. The gift's ID is the
+// idempotency key, so a retry cannot charge twice.
+func (stripeProvider) Start(ctx context.Context, donationID uuid.UUID, request models.DonationIntentRequest) (models.DonationIntent, error) {
+	var intent struct {
+		ID           string `json:"id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	err := stripePost(ctx, "payment_intents", url.Values{
+		"amount":                             {strconv.FormatInt(request.AmountCents, 10)},
+		"currency":                           {strings.ToLower(request.Currency)},
+		"automatic_payment_methods[enabled]": {"true"},
+		"description":                        {"Gift to the " + request.Fund + " fund"},
+		"metadata[donation_id]":              {donationID.String()},
+		"metadata[fund]":                     {request.Fund},
+	}, donationID.String(), &intent)
+	if err != nil {
+		return models.DonationIntent{}, err
+	}
+	return models.DonationIntent{Reference: intent.ID, ClientSecret: intent.ClientSecret}, nil
+}
+
+// verifyStripeSignature checks the Stripe-Signature header of a webhook:
+// an HMAC-SHA256 of the timestamp and payload under the webhook secret,
+// made within stripeSignatureTolerance of now.
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var (
+		timestamp  string
+		signatures []string
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidStripeSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return fmt.Errorf("%w: timestamp is outside the tolerance", ErrInvalidStripeSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidStripeSignature
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// stripeSignature signs payload at t the way Stripe does.
+func stripeSignature(payload, secret string, t time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(t.Unix(), 10) + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	const (
+		payload = `{"type":"payment_intent.succeeded"}`
+		secret  = "whsec_test"
+	)
+	signedAt := time.Unix(1760000000, 0)
+	timestamp := "t=" + strconv.FormatInt(signedAt.Unix(), 10)
+	valid := stripeSignature(payload, secret, signedAt)
+
+	tests := []struct {
+		name    string
+		payload string
+		header  string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", payload, timestamp + ",v1=" + valid, signedAt, false},
+		{"within tolerance", payload, timestamp + ",v1=" + valid, signedAt.Add(stripeSignatureTolerance), false},
+		{"clock behind", payload, timestamp + ",v1=" + valid, signedAt.Add(-stripeSignatureTolerance), false},
+		{"too old", payload, timestamp + ",v1=" + valid, signedAt.Add(stripeSignatureTolerance + time.Second), true},
+		{"from the future", payload, timestamp + ",v1=" + valid, signedAt.Add(-stripeSignatureTolerance - time.Second), true},
+		{"one of several signatures", payload, timestamp + ",v1=" + stripeSignature(payload, "whsec_old", signedAt) + ",v1=" + valid, signedAt, false},
+		{"wrong secret", payload, timestamp + ",v1=" + stripeSignature(payload, "whsec_other", signedAt), signedAt, true},
+		{"altered payload", `{"type":"charge.refunded"}`, timestamp + ",v1=" + valid, signedAt, true},
+		{"replayed timestamp", payload, "t=" + strconv.FormatInt(signedAt.Unix()+1, 10) + ",v1=" + valid, signedAt, true},
+		{"not hex", payload, timestamp + ",v1=zz" + valid[2:], signedAt, true},
+		{"only v0 signatures", payload, timestamp + ",v0=" + valid, signedAt, true},
+		{"no timestamp", payload, "v1=" + valid, signedAt, true},
+		{"empty header", payload, "", signedAt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyStripeSignature([]byte(tt.payload), tt.header, secret, tt.now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidStripeSignature) {
+				t.Errorf("verifyStripeSignature() = %v, want %v", err, ErrInvalidStripeSignature)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("verifyStripeSignature() = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"time"
+)
+
+// Summary tables hold aggregates that are too expensive to compute per
+// request. RefreshSummaries updates them incrementally in the background.
+const (
+	summaryEmailCampaignStats = "email_campaign_stats"
+	// summaryOverlap re-reads rows changed shortly before the last refresh,
+	// in case they were committed after it had looked.
+	summaryOverlap = time.Minute
+)
+
+// RefreshSummaries is the job entry point that brings every summary table up
+// to date.
+func RefreshSummaries(ctx context.Context) error {
+	return refreshEmailCampaignStats(ctx)
+}
+
+// refreshEmailCampaignStats recounts the campaigns whose recipients changed
+// since the last refresh.
+func refreshEmailCampaignStats(ctx context.Context) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	since, err := lockSummary(ctx, tx, summaryEmailCampaignStats)
+	if err != nil {
+		return err
+	}
+	var started time.Time
+	if err := tx.QueryRowContext(ctx, "SELECT clock_timestamp()::timestamp").Scan(&started); err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO email_campaign_stats
+			(campaign_id, sent, tracked, unique_opens, opens, unique_clicks, clicks, refreshed_at)
+		SELECT campaign_id,
+			COUNT(*) FILTER (WHERE queued_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE tracked),
+			COUNT(*) FILTER (WHERE opened_at IS NOT NULL),
+			COALESCE(SUM(open_count), 0),
+			COUNT(*) FILTER (WHERE clicked_at IS NOT NULL),
+			COALESCE(SUM(click_count), 0),
+			$2
+		FROM email_campaign_recipients
+		WHERE campaign_id IN (SELECT DISTINCT campaign_id FROM email_campaign_recipients WHERE updated_at > $1)
+		GROUP BY campaign_id
+		ON CONFLICT (campaign_id) DO UPDATE SET sent = EXCLUDED.sent, tracked = EXCLUDED.tracked,
+			unique_opens = EXCLUDED.unique_opens, opens = EXCLUDED.opens,
+			unique_clicks = EXCLUDED.unique_clicks, clicks = EXCLUDED.clicks, refreshed_at = EXCLUDED.refreshed_at`,
+		since.Add(-summaryOverlap), started)
+	if err != nil {
+		return fmt.Errorf("error refreshing email campaign stats: %w", err)
+	}
+
+	if err := markSummaryRefreshed(ctx, tx, summaryEmailCampaignStats, started); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockSummary returns when a summary was last refreshed, the zero time if
+// never, and keeps other refreshes of it waiting until tx ends.
+func lockSummary(ctx context.Context, tx *sql.Tx, name string) (time.Time, error) {
+	var refreshedAt time.Time
+	err := tx.QueryRowContext(ctx, "SELECT refreshed_at FROM summary_refreshes WHERE name = $1 FOR UPDATE", name).Scan(&refreshedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return refreshedAt, nil
+}
+
+func markSummaryRefreshed(ctx context.Context, tx *sql.Tx, name string, refreshedAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO summary_refreshes (name, refreshed_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET refreshed_at = EXCLUDED.refreshed_at`, name, refreshedAt)
+	if err != nil {
+		return fmt.Errorf("error recording summary refresh: %w", err)
+	}
+	return nil
+}
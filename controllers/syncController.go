@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// syncOverlap widens every sync window so that changes committed by
+	// transactions that started before the previous sync are not missed.
+	// Clients apply changes idempotently, so the overlap only repeats work.
+	syncOverlap = time.Minute
+	// tombstoneRetention is how long deletions are remembered; clients that
+	// have not synced for longer must reload everything.
+	tombstoneRetention = 90 * 24 * time.Hour
+	maxSyncChanges     = 5000
+)
+
+// syncedEntities are the tables tracked in content_changes.
+var syncedEntities = []string{"posts", "lives", "sermons"}
+
+func SetupSyncRoutes(r *mux.Router) {
+	r.HandleFunc("/sync", GetSync).Methods("GET").Queries("since", "{since}")
+}
+
+// GetSync returns the IDs of content created, updated or deleted since the
+// given RFC 3339 time, so that offline clients can refresh only what changed.
+func GetSync(w http.ResponseWriter, r *http.Request) {
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		middlewares.HttpError(w, "since must be an RFC 3339 time", http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := querySync(r.Context(), since)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch changes", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, response, http.StatusOK)
+}
+
+func querySync(ctx context.Context, since time.Time) (*models.SyncResponse, error) {
+	response := &models.SyncResponse{Entities: map[string]models.EntityChanges{}}
+	for _, entity := range syncedEntities {
+		response.Entities[entity] = models.EntityChanges{Created: []uuid.UUID{}, Updated: []uuid.UUID{}, Deleted: []uuid.UUID{}}
+	}
+
+	// The database clock is the one the change times come from.
+	if err := db.DB.QueryRowContext(ctx, "SELECT clock_timestamp()").Scan(&response.ServerTime); err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	if response.ServerTime.Sub(since) > tombstoneRetention {
+		response.Reset = true
+		return response, nil
+	}
+
+	since = since.Add(-syncOverlap)
+	rows, err := db.DB.QueryContext(ctx, `SELECT entity, entity_id, deleted, first_seen_at > $1
+		FROM content_changes
+		WHERE changed_at > $1
+		ORDER BY changed_at
+		LIMIT $2`, since, maxSyncChanges+1)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var (
+			entity  string
+			id      uuid.UUID
+			deleted bool
+			created bool
+		)
+		if err := rows.Scan(&entity, &id, &deleted, &created); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if count++; count > maxSyncChanges {
+			response.Reset = true
+			response.Entities = map[string]models.EntityChanges{}
+			return response, nil
+		}
+
+		changes, ok := response.Entities[entity]
+		if !ok {
+			continue
+		}
+		switch {
+		case deleted:
+			changes.Deleted = append(changes.Deleted, id)
+		case created:
+			changes.Created = append(changes.Created, id)
+		default:
+			changes.Updated = append(changes.Updated, id)
+		}
+		response.Entities[entity] = changes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return response, nil
+}
+
+// PurgeContentTombstones forgets deletions older than tombstoneRetention.
+func PurgeContentTombstones(ctx context.Context) error {
+	_, err := db.DB.ExecContext(ctx, "DELETE FROM content_changes WHERE deleted AND changed_at < NOW() - $1 * INTERVAL '1 second'",
+		tombstoneRetention.Seconds())
+	return err
+}
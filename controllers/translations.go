@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/mailer"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// CatalogMessage is one translatable string: a block of a built-in email,
+// keyed template.part, e.g. password_changed.subject.
+type CatalogMessage struct {
+	Key       string
+	Source    string
+	Variables []string
+}
+
+// currentEmailContent returns the content a built-in email is sent with: the
+// edited version if there is one, otherwise the built-in text.
+func currentEmailContent(ctx context.Context, name string) (mailer.Content, error) {
+	edited, err := LoadEmailTemplateContent(ctx, name)
+	if err != nil {
+		return mailer.Content{}, err
+	}
+	if edited != nil {
+		return *edited, nil
+	}
+	content, _ := mailer.BuiltinContent(name)
+	return content, nil
+}
+
+// ExportMessageCatalog lists the strings of the built-in emails as they are
+// currently sent.
+func ExportMessageCatalog(ctx context.Context) ([]CatalogMessage, error) {
+	messages := []CatalogMessage{}
+	for _, name := range mailer.BuiltinTemplates() {
+		content, err := currentEmailContent(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		variables := mailer.BuiltinVariables(name)
+		for _, part := range mailer.TemplateParts {
+			messages = append(messages, CatalogMessage{Key: name + "." + part, Source: content.Part(part), Variables: variables})
+		}
+	}
+	return messages, nil
+}
+
+// ImportMessageCatalog saves translated strings, keyed as exported, as new
+// versions of the emails. Empty translations are skipped. Nothing is saved
+// unless every translation keeps the placeholders of its source, so that a
+// broken string cannot reach members. It returns the number of emails saved.
+func ImportMessageCatalog(ctx context.Context, translations map[string]string) (int, error) {
+	contents := map[string]mailer.Content{}
+	var errs validation.ValidationError
+
+	for key, translation := range translations {
+		if strings.TrimSpace(translation) == "" {
+			continue
+		}
+		name, part, _ := strings.Cut(key, ".")
+		variables := mailer.BuiltinVariables(name)
+		if variables == nil || !containsPart(part) {
+			errs.Add(key, validation.RuleInvalid, fmt.Sprintf("%s is not a message of the catalog", key))
+			continue
+		}
+
+		content, ok := contents[name]
+		if !ok {
+			current, err := currentEmailContent(ctx, name)
+			if err != nil {
+				return 0, err
+			}
+			content = current
+		}
+		if err := mailer.CheckPlaceholders(content.Part(part), translation); err != nil {
+			errs.Add(key, validation.RuleInvalid, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		content.SetPart(part, strings.TrimSpace(translation))
+		contents[name] = content
+	}
+
+	for name, content := range contents {
+		template := models.EmailTemplate{
+			Name:      name,
+			Variables: mailer.BuiltinVariables(name),
+			Subject:   content.Subject,
+			TextBody:  content.Text,
+			HTMLBody:  content.HTML,
+		}
+		if err := validation.ValidateEmailTemplate(template); err != nil {
+			errs.Add(name, validation.RuleInvalid, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if _, err := mailer.ParseContent(content, template.Variables); err != nil {
+			errs.Add(name, validation.RuleInvalid, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return 0, err
+	}
+
+	for name, content := range contents {
+		if err := saveImportedEmail(ctx, name, content); err != nil {
+			return 0, fmt.Errorf("error saving %s: %w", name, err)
+		}
+	}
+	return len(contents), nil
+}
+
+func containsPart(part string) bool {
+	return slices.Contains(mailer.TemplateParts, part)
+}
+
+// saveImportedEmail adds the content as the next version of the edited email,
+// creating the edited copy of the built-in email if there is none yet.
+func saveImportedEmail(ctx context.Context, name string, content mailer.Content) error {
+	template := models.EmailTemplate{
+		Name:      name,
+		Variables: mailer.BuiltinVariables(name),
+		Subject:   content.Subject,
+		TextBody:  content.Text,
+		HTMLBody:  content.HTML,
+	}
+
+	existing, err := queryEmailTemplates(ctx, "WHERE t.name = $1", name)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		template.Description = existing[0].Description
+		return saveEmailTemplateVersion(ctx, existing[0].ID, &template, 0)
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO email_templates (name, variables)
+		VALUES ($1, $2)
+		RETURNING id`, name, pq.Array(template.Variables)).Scan(&template.ID)
+	if err != nil {
+		return fmt.Errorf("error inserting template: %w", err)
+	}
+	if err := insertEmailTemplateVersion(ctx, tx, template.ID, 1, template, 0); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/events"
+	"jsmi-api/middlewares"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// longPollTimeout stays well below the server's write timeout and the
+	// idle timeouts of common proxies.
+	longPollTimeout  = 25 * time.Second
+	updatesBatchSize = 100
+)
+
+// UpdatesResponse is a batch of changes. Clients pass Cursor as since in
+// their next request. Reset means the client's cursor was too old and it
+// must reload all content before continuing from Cursor.
+type UpdatesResponse struct {
+	Cursor string         `json:"cursor"`
+	Events []events.Event `json:"events"`
+	Reset  bool           `json:"reset,omitempty"`
+}
+
+// SetupUpdateRoutes registers the change feed, as SSE for clients that
+// support it and as long polling for those that do not.
+func SetupUpdateRoutes(r *mux.Router) {
+	r.HandleFunc("/updates", GetUpdates).Methods("GET")
+	r.HandleFunc("/updates/stream", StreamUpdates).Methods("GET")
+}
+
+// GetUpdates returns the changes after ?since=cursor, waiting up to
+// longPollTimeout for one if there are none yet. Without since it returns
+// the current cursor right away.
+func GetUpdates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		latest, err := events.Latest(ctx)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch updates", http.StatusInternalServerError, err)
+			return
+		}
+		middlewares.RespondJSON(w, UpdatesResponse{Cursor: latest, Events: []events.Event{}}, http.StatusOK)
+		return
+	}
+	if !events.ValidCursor(since) {
+		http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.NewTimer(longPollTimeout)
+	defer timeout.Stop()
+	for {
+		// Take the channel before reading so that an event published in
+		// between still wakes us.
+		changed := events.Changed()
+		batch, err := events.Since(ctx, since, updatesBatchSize)
+		if errors.Is(err, events.ErrCursorExpired) {
+			latest, err := events.Latest(ctx)
+			if err != nil {
+				middlewares.HttpError(w, "Failed to fetch updates", http.StatusInternalServerError, err)
+				return
+			}
+			middlewares.RespondJSON(w, UpdatesResponse{Cursor: latest, Events: []events.Event{}, Reset: true}, http.StatusOK)
+			return
+		}
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch updates", http.StatusInternalServerError, err)
+			return
+		}
+		if len(batch) > 0 {
+			middlewares.RespondJSON(w, UpdatesResponse{Cursor: batch[len(batch)-1].Cursor, Events: batch}, http.StatusOK)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			middlewares.RespondJSON(w, UpdatesResponse{Cursor: since, Events: []events.Event{}}, http.StatusOK)
+			return
+		case <-changed:
+		}
+	}
+}
+
+// StreamUpdates sends the change feed as SSE. Reconnecting clients resume
+// from Last-Event-ID; a "reset" event tells them to reload all content.
+func StreamUpdates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("since")
+	}
+	if cursor != "" && !events.ValidCursor(cursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if cursor == "" {
+		latest, err := events.Latest(ctx)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch updates", http.StatusInternalServerError, err)
+			return
+		}
+		cursor = latest
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's WriteTimeout would otherwise cut long-lived streams.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		middlewares.HttpError(w, "Streaming is not supported", http.StatusInternalServerError, err)
+		return
+	}
+	writeSSEHeaders(w)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		changed := events.Changed()
+		batch, err := events.Since(ctx, cursor, updatesBatchSize)
+		if errors.Is(err, events.ErrCursorExpired) {
+			latest, latestErr := events.Latest(ctx)
+			if latestErr != nil {
+				return
+			}
+			cursor = latest
+			if writeSSEEvent(w, SSEEvent{ID: cursor, Name: "reset", Data: []byte("{}")}) != nil {
+				return
+			}
+		} else if err != nil {
+			return
+		}
+
+		for _, event := range batch {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if writeSSEEvent(w, SSEEvent{ID: event.Cursor, Name: event.Type, Data: data}) != nil {
+				return
+			}
+			cursor = event.Cursor
+		}
+		if rc.Flush() != nil {
+			return
+		}
+		if len(batch) == updatesBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
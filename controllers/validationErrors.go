@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"errors"
+	"jsmi-api/middlewares"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+)
+
+// validationErrorResponse is the body of a 400 for a failed validation.
+type validationErrorResponse struct {
+	Error  string                  `json:"error"`
+	Code   string                  `json:"code"`
+	Errors []validation.FieldError `json:"errors"`
+}
+
+// respondValidationError answers a failed validation with 400. A
+// *validation.ValidationError is sent as JSON listing each failing field and
+// its code, such as title.too_long; other errors as plain text.
+func respondValidationError(w http.ResponseWriter, err error) {
+	var validationErr *validation.ValidationError
+	if !errors.As(err, &validationErr) {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("HTTP %d - %v", http.StatusBadRequest, err)
+	middlewares.RespondJSON(w, validationErrorResponse{
+		Error:  "Validation failed",
+		Code:   "validation_failed",
+		Errors: validationErr.Errors,
+	}, http.StatusBadRequest)
+}
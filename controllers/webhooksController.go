@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/jobs"
+	"jsmi-api/middlewares"
+	"jsmi-api/models"
+	"jsmi-api/serializers"
+	"jsmi-api/utils"
+	"jsmi-api/validation"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// JobDeliverWebhook delivers an event to a webhook. Failed deliveries are
+// retried with backoff by the job queue.
+const JobDeliverWebhook = "webhook.deliver"
+
+// Headers of webhook deliveries. Receivers check the signature, the
+// hex-encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook's
+// secret, and reject old timestamps to stop replays.
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// webhookDeliveryRetention is how long the delivery log is kept.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	// maxWebhookErrorLength bounds the response excerpt stored with a failure.
+	maxWebhookErrorLength = 500
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// webhookClient refuses to connect to internal addresses, since webhook URLs
+// are entered by users.
+var webhookClient = utils.NewSafeHTTPClient(10 * time.Second)
+
+// WebhookDeliveryRequest is the payload of a JobDeliverWebhook job. The body
+// is built when the event happens, so retries send the same content.
+type WebhookDeliveryRequest struct {
+	WebhookID  uuid.UUID       `json:"webhook_id"`
+	DeliveryID uuid.UUID       `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// webhookPayload is the body of JSON deliveries.
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// fireWebhook queues a delivery of an event to every active webhook that
+// subscribes to it. summary is the message Discord webhooks get. Like
+// queueCDNPurge it is best effort, failures are only logged.
+func fireWebhook(ctx context.Context, event, summary string, data any) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, format FROM webhooks
+		WHERE active AND (events = '{}' OR $1 = ANY(events))`, event)
+	if err != nil {
+		log.Printf("Failed to fetch webhooks for %s: %v", event, err)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	for rows.Next() {
+		var (
+			req    WebhookDeliveryRequest
+			format string
+		)
+		if err := rows.Scan(&req.WebhookID, &format); err != nil {
+			log.Printf("Failed to fetch webhooks for %s: %v", event, err)
+			return
+		}
+		req.DeliveryID = uuid.New()
+		req.Event = event
+
+		var body any = webhookPayload{ID: req.DeliveryID, Event: event, CreatedAt: now, Data: data}
+		if format == models.WebhookFormatDiscord {
+			body = map[string]string{"content": summary}
+		}
+		if req.Body, err = json.Marshal(body); err != nil {
+			log.Printf("Failed to encode %s webhook: %v", event, err)
+			return
+		}
+
+		if _, err := jobs.Enqueue(ctx, db.DB, JobDeliverWebhook, req); err != nil {
+			log.Printf("Failed to queue %s webhook for %s: %v", event, req.WebhookID, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Failed to fetch webhooks for %s: %v", event, err)
+	}
+}
+
+// firePostWebhook fires "post.<action>" with the post as its data.
+func firePostWebhook(ctx context.Context, action string, post models.Post) {
+	fireWebhook(ctx, "post."+action, fmt.Sprintf("Post %s: %s", action, post.Title), serializers.FromPost(post))
+}
+
+// fireLiveWebhook fires "live.<action>" with the live as its data.
+func fireLiveWebhook(ctx context.Context, action string, live models.Live) {
+	fireWebhook(ctx, "live."+action, fmt.Sprintf("Live %s: %s %s", action, live.Title, live.PrimaryLink()), serializers.FromLive(live))
+}
+
+// signWebhook returns the signature of a delivery body sent at timestamp.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverWebhook is the job handler for JobDeliverWebhook. Every attempt is
+// recorded in the delivery log; a response other than 2xx fails the job so
+// that it is retried.
+func DeliverWebhook(ctx context.Context, task *jobs.Task) (any, error) {
+	var req WebhookDeliveryRequest
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	var (
+		url, secret string
+		active      bool
+	)
+	err := db.DB.QueryRowContext(ctx, "SELECT url, secret, active FROM webhooks WHERE id = $1", req.WebhookID).
+		Scan(&url, &secret, &active)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !active {
+		// The webhook was deleted or paused since the event.
+		return map[string]bool{"skipped": true}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+
+	start := time.Now()
+	statusCode, deliveryErr := postWebhook(ctx, url, secret, req)
+	duration := time.Since(start)
+
+	var errText *string
+	if deliveryErr != nil {
+		text := deliveryErr.Error()
+		errText = &text
+	}
+	_, err = db.DB.ExecContext(context.WithoutCancel(ctx), `INSERT INTO webhook_deliveries
+		(webhook_id, delivery_id, event, attempt, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		req.WebhookID, req.DeliveryID, req.Event, task.Attempts, statusCode, errText, duration.Milliseconds())
+	if err != nil {
+		log.Printf("Failed to log webhook delivery %s: %v", req.DeliveryID, err)
+	}
+
+	if deliveryErr != nil {
+		return nil, deliveryErr
+	}
+	return map[string]int{"status_code": *statusCode}, nil
+}
+
+// postWebhook sends a delivery and returns the response status, or nil when
+// there was no response.
+func postWebhook(ctx context.Context, url, secret string, req WebhookDeliveryRequest) (*int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "jsmi-api-webhooks")
+	httpReq.Header.Set(webhookEventHeader, req.Event)
+	httpReq.Header.Set(webhookDeliveryHeader, req.DeliveryID.String())
+	httpReq.Header.Set(webhookTimestampHeader, timestamp)
+	httpReq.Header.Set(webhookSignatureHeader, signWebhook(secret, timestamp, req.Body))
+
+	resp, err := webhookClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		return &statusCode, fmt.Errorf("webhook returned status %d: %s", statusCode, bytes.TrimSpace(excerpt))
+	}
+	return &statusCode, nil
+}
+
+// PurgeWebhookDeliveries removes delivery log entries older than
+// webhookDeliveryRetention.
+func PurgeWebhookDeliveries(ctx context.Context) error {
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE created_at < NOW() - $1 * INTERVAL '1 second'",
+		webhookDeliveryRetention.Seconds())
+	if err != nil {
+		return fmt.Errorf("error purging webhook deliveries: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		log.Printf("Purged %d webhook deliveries", affected)
+	}
+	return nil
+}
+
+const webhookColumns = "id, url, events, format, active, created_at, updated_at"
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Format, &webhook.Active,
+		&webhook.CreatedAt, &webhook.UpdatedAt)
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	return webhook, err
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// GetWebhooks lists the webhooks, without their secrets.
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.QueryContext(r.Context(), "SELECT "+webhookColumns+" FROM webhooks ORDER BY created_at DESC")
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			middlewares.HttpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+			return
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, webhooks, http.StatusOK)
+}
+
+// decodeWebhook reads a webhook from a request body. Omitted fields get
+// their defaults: every event, JSON format, active.
+func decodeWebhook(r *http.Request) (models.Webhook, error) {
+	var payload struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Format string   `json:"format"`
+		Active *bool    `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.Webhook{}, err
+	}
+
+	webhook := models.Webhook{URL: payload.URL, Events: payload.Events, Format: payload.Format, Active: true}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	if webhook.Format == "" {
+		webhook.Format = models.WebhookFormatJSON
+	}
+	if payload.Active != nil {
+		webhook.Active = *payload.Active
+	}
+	return webhook, nil
+}
+
+// CreateWebhook registers a webhook. Its secret is only returned here and
+// when it is rotated.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := decodeWebhook(r)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWebhook(webhook); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := scanWebhook(db.DB.QueryRowContext(r.Context(), `INSERT INTO webhooks (url, secret, events, format, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+webhookColumns, webhook.URL, secret, pq.Array(webhook.Events), webhook.Format, webhook.Active))
+	if err != nil {
+		middlewares.HttpError(w, "Failed to create webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	created.Secret = secret
+	middlewares.RespondCreated(w, "/admin/webhooks?id="+created.ID.String(), created)
+}
+
+// UpdateWebhook replaces a webhook's endpoint, events, format and state. The
+// secret stays the same.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	webhook, err := decodeWebhook(r)
+	if err != nil {
+		middlewares.HttpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validation.ValidateWebhook(webhook); err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	updated, err := scanWebhook(db.DB.QueryRowContext(r.Context(), `UPDATE webhooks
+		SET url = $1, events = $2, format = $3, active = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING `+webhookColumns, webhook.URL, pq.Array(webhook.Events), webhook.Format, webhook.Active, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Webhook not found", http.StatusNotFound, ErrWebhookNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to update webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, updated, http.StatusOK)
+}
+
+// RotateWebhookSecret gives a webhook a new secret. Deliveries already
+// queued are signed with the new one.
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		middlewares.HttpError(w, "Failed to rotate webhook secret", http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook, err := scanWebhook(db.DB.QueryRowContext(r.Context(), `UPDATE webhooks SET secret = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+webhookColumns, secret, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middlewares.HttpError(w, "Webhook not found", http.StatusNotFound, ErrWebhookNotFound)
+			return
+		}
+		middlewares.HttpError(w, "Failed to rotate webhook secret", http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook.Secret = secret
+	middlewares.RespondJSON(w, webhook, http.StatusOK)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.DB.ExecContext(r.Context(), "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		middlewares.HttpError(w, "Failed to delete webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		middlewares.HttpError(w, "Webhook not found", http.StatusNotFound, ErrWebhookNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		middlewares.HttpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		middlewares.HttpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = $1", id).Scan(&total); err != nil {
+		middlewares.HttpError(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT delivery_id, event, attempt, status_code, error, duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, id, page.PerPage, page.Offset())
+	if err != nil {
+		middlewares.HttpError(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := rows.Scan(&delivery.DeliveryID, &delivery.Event, &delivery.Attempt, &delivery.StatusCode, &delivery.Error,
+			&delivery.DurationMS, &delivery.CreatedAt); err != nil {
+			middlewares.HttpError(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError, err)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		middlewares.HttpError(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError, err)
+		return
+	}
+
+	middlewares.RespondJSON(w, PaginatedResponse[models.WebhookDelivery]{
+		Items:   deliveries,
+		Page:    page.Number,
+		PerPage: page.PerPage,
+		Total:   total,
+	}, http.StatusOK)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultYouTubeAPIURL = "https://www.googleapis.com/youtube/v3"
+
+// YouTubeConfig configures calls to the YouTube Data API.
+type YouTubeConfig struct {
+	// APIKey is "" when the integration is off.
+	APIKey string
+	APIURL string
+	// ChannelID is the channel whose broadcasts become lives, or "" to only
+	// look up recordings.
+	ChannelID string
+}
+
+var (
+	youTubeConfig     *YouTubeConfig
+	youTubeConfigOnce sync.Once
+	youTubeClient     = &http.Client{Timeout: 30 * time.Second}
+)
+
+// LoadYouTubeConfig reads YOUTUBE_API_KEY and optionally YOUTUBE_API_URL
+// and YOUTUBE_CHANNEL_ID, the channel to sync broadcasts from.
+func LoadYouTubeConfig() (*YouTubeConfig, error) {
+	config := &YouTubeConfig{
+		APIKey:    os.Getenv("YOUTUBE_API_KEY"),
+		APIURL:    strings.TrimSuffix(os.Getenv("YOUTUBE_API_URL"), "/"),
+		ChannelID: os.Getenv("YOUTUBE_CHANNEL_ID"),
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultYouTubeAPIURL
+	}
+	parsed, err := url.Parse(config.APIURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, fmt.Errorf("YOUTUBE_API_URL must be an http(s) URL")
+	}
+	if config.ChannelID != "" {
+		if config.APIKey == "" {
+			return nil, errors.New("YOUTUBE_API_KEY is required with YOUTUBE_CHANNEL_ID")
+		}
+		// Channel IDs start with UC; their uploads playlist starts with UU.
+		if !strings.HasPrefix(config.ChannelID, "UC") {
+			return nil, errors.New("YOUTUBE_CHANNEL_ID must be a channel ID starting with UC")
+		}
+	}
+	return config, nil
+}
+
+func youTube() *YouTubeConfig {
+	youTubeConfigOnce.Do(func() {
+		config, err := LoadYouTubeConfig()
+		if err != nil {
+			log.Printf("YouTube integration disabled: %v", err)
+			config = &YouTubeConfig{}
+		}
+		youTubeConfig = config
+	})
+	return youTubeConfig
+}
+
+// youTubeWatchURL is the canonical URL of a video.
+func youTubeWatchURL(videoID string) string {
+	return "https://www.youtube.com/watch?v=" + url.QueryEscape(videoID)
+}
+
+// parseYouTubeLink returns the video ID of a watch, youtu.be or /live/ link,
+// or the channel ID of a channel's /live link. Both are "" for other links.
+func parseYouTubeLink(link string) (videoID, channelID string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case host == "youtu.be" && len(parts) == 1:
+		return parts[0], ""
+	case host != "youtube.com":
+		return "", ""
+	case len(parts) == 1 && parts[0] == "watch":
+		return u.Query().Get("v"), ""
+	case len(parts) == 2 && parts[0] == "live":
+		return parts[1], ""
+	case len(parts) == 3 && parts[0] == "channel" && parts[2] == "live":
+		return "", parts[1]
+	}
+	return "", ""
+}
+
+// youTubeGet calls an API resource and decodes the JSON response into out.
+func youTubeGet(ctx context.Context, resource string, params url.Values, out any) error {
+	config := youTube()
+	params.Set("key", config.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.APIURL+"/"+resource+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := youTubeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling YouTube %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("YouTube %s returned %s: %s", resource, resp.Status, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding YouTube %s response: %w", resource, err)
+	}
+	return nil
+}
+
+// youTubeRecordingURL returns the URL of the recording of a finished
+// broadcast, or "" when the link is not a YouTube broadcast or the recording
+// is not ready yet. A channel's /live link is resolved to the channel's
+// latest completed broadcast that started after since.
+func youTubeRecordingURL(ctx context.Context, link string, since time.Time) (string, error) {
+	videoID, channelID := parseYouTubeLink(link)
+	if channelID != "" {
+		var search struct {
+			Items []struct {
+				ID struct {
+					VideoID string `json:"videoId"`
+				} `json:"id"`
+			} `json:"items"`
+		}
+		err := youTubeGet(ctx, "search", url.Values{
+			"part":           {"id"},
+			"channelId":      {channelID},
+			"eventType":      {"completed"},
+			"type":           {"video"},
+			"order":          {"date"},
+			"publishedAfter": {since.UTC().Format(time.RFC3339)},
+			"maxResults":     {"1"},
+		}, &search)
+		if err != nil {
+			return "", err
+		}
+		if len(search.Items) == 0 {
+			return "", nil
+		}
+		videoID = search.Items[0].ID.VideoID
+	}
+	if videoID == "" {
+		return "", nil
+	}
+
+	var videos struct {
+		Items []struct {
+			Status struct {
+				UploadStatus string `json:"uploadStatus"`
+			} `json:"status"`
+			LiveStreamingDetails struct {
+				ActualEndTime string `json:"actualEndTime"`
+			} `json:"liveStreamingDetails"`
+		} `json:"items"`
+	}
+	err := youTubeGet(ctx, "videos", url.Values{"part": {"status,liveStreamingDetails"}, "id": {videoID}}, &videos)
+	if err != nil {
+		return "", err
+	}
+	if len(videos.Items) == 0 {
+		return "", nil
+	}
+	video := videos.Items[0]
+	if video.LiveStreamingDetails.ActualEndTime == "" || video.Status.UploadStatus != "processed" {
+		return "", nil
+	}
+	return youTubeWatchURL(videoID), nil
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	// youTubeSyncVideos is how many of the channel's latest uploads are
+	// checked. Scheduled broadcasts show up there as soon as they are set up.
+	youTubeSyncVideos = 10
+	// youTubeDefaultDuration is the length assumed for a broadcast until it
+	// ends, when YouTube has no scheduled end time.
+	youTubeDefaultDuration = 2 * time.Hour
+	// youTubeOverrun keeps a broadcast that runs late on air between syncs.
+	youTubeOverrun = 10 * time.Minute
+	// youTubeTitleWords matches the word limit of validation.ValidateLives.
+	youTubeTitleWords = 15
+)
+
+// youTubeBroadcast is a video of the channel that is, was or will be live.
+type youTubeBroadcast struct {
+	VideoID     string
+	Title       string
+	Description string
+	// State is upcoming, live or none once the broadcast has ended.
+	State    string
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// SyncYouTubeBroadcasts is the periodic job that creates a live for every
+// upcoming or running broadcast of YOUTUBE_CHANNEL_ID and keeps the schedule
+// of synced lives in step with YouTube, so that nobody has to post the link.
+// Titles and descriptions are only set on creation; staff edits stick. It
+// polls the uploads playlist rather than searching, which costs two quota
+// units a run instead of a hundred.
+func SyncYouTubeBroadcasts(ctx context.Context) error {
+	config := youTube()
+	if config.ChannelID == "" {
+		return nil
+	}
+
+	broadcasts, err := fetchYouTubeBroadcasts(ctx, config.ChannelID, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, broadcast := range broadcasts {
+		if err := syncYouTubeBroadcast(ctx, broadcast); err != nil {
+			return fmt.Errorf("error syncing YouTube broadcast %s: %w", broadcast.VideoID, err)
+		}
+	}
+	return nil
+}
+
+// fetchYouTubeBroadcasts returns the broadcasts among the channel's latest
+// uploads.
+func fetchYouTubeBroadcasts(ctx context.Context, channelID string, now time.Time) ([]youTubeBroadcast, error) {
+	var playlist struct {
+		Items []struct {
+			ContentDetails struct {
+				VideoID string `json:"videoId"`
+			} `json:"contentDetails"`
+		} `json:"items"`
+	}
+	err := youTubeGet(ctx, "playlistItems", url.Values{
+		"part":       {"contentDetails"},
+		"playlistId": {"UU" + strings.TrimPrefix(channelID, "UC")},
+		"maxResults": {fmt.Sprint(youTubeSyncVideos)},
+	}, &playlist)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, item := range playlist.Items {
+		ids = append(ids, item.ContentDetails.VideoID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var videos struct {
+		Items []struct {
+			ID      string `json:"id"`
+			Snippet struct {
+				Title                string `json:"title"`
+				Description          string `json:"description"`
+				LiveBroadcastContent string `json:"liveBroadcastContent"`
+			} `json:"snippet"`
+			LiveStreamingDetails *struct {
+				ScheduledStartTime *time.Time `json:"scheduledStartTime"`
+				ScheduledEndTime   *time.Time `json:"scheduledEndTime"`
+				ActualStartTime    *time.Time `json:"actualStartTime"`
+				ActualEndTime      *time.Time `json:"actualEndTime"`
+			} `json:"liveStreamingDetails"`
+		} `json:"items"`
+	}
+	err = youTubeGet(ctx, "videos", url.Values{
+		"part": {"snippet,liveStreamingDetails"},
+		"id":   {strings.Join(ids, ",")},
+	}, &videos)
+	if err != nil {
+		return nil, err
+	}
+
+	var broadcasts []youTubeBroadcast
+	for _, video := range videos.Items {
+		details := video.LiveStreamingDetails
+		if details == nil {
+			continue // an ordinary upload
+		}
+		broadcast := youTubeBroadcast{
+			VideoID:     video.ID,
+			Title:       video.Snippet.Title,
+			Description: video.Snippet.Description,
+			State:       video.Snippet.LiveBroadcastContent,
+		}
+
+		switch {
+		case details.ActualStartTime != nil:
+			broadcast.StartsAt = *details.ActualStartTime
+		case details.ScheduledStartTime != nil:
+			broadcast.StartsAt = *details.ScheduledStartTime
+		default:
+			continue
+		}
+
+		switch {
+		case details.ActualEndTime != nil:
+			broadcast.EndsAt = *details.ActualEndTime
+		case details.ScheduledEndTime != nil && details.ScheduledEndTime.After(broadcast.StartsAt):
+			broadcast.EndsAt = *details.ScheduledEndTime
+		default:
+			broadcast.EndsAt = broadcast.StartsAt.Add(youTubeDefaultDuration)
+		}
+		if broadcast.State == "live" && details.ActualEndTime == nil {
+			broadcast.EndsAt = later(broadcast.EndsAt, now.Add(youTubeOverrun))
+		}
+		if !broadcast.StartsAt.Before(broadcast.EndsAt) {
+			broadcast.EndsAt = broadcast.StartsAt.Add(time.Minute)
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+	return broadcasts, nil
+}
+
+// later returns the later of two times.
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// syncYouTubeBroadcast updates the live of a broadcast, adopts a live whose
+// link staff already posted, or creates one for a broadcast that has not
+// ended.
+func syncYouTubeBroadcast(ctx context.Context, broadcast youTubeBroadcast) error {
+	startsAt, endsAt := broadcast.StartsAt.UTC(), broadcast.EndsAt.UTC()
+
+	live, err := scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+" FROM lives WHERE youtube_video_id = $1",
+		broadcast.VideoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		links := []string{
+			youTubeWatchURL(broadcast.VideoID),
+			"https://youtu.be/" + broadcast.VideoID,
+			"https://www.youtube.com/live/" + broadcast.VideoID,
+		}
+		live, err = scanLive(db.DB.QueryRowContext(ctx, "SELECT "+liveColumns+` FROM lives
+			WHERE youtube_video_id IS NULL AND archived_at IS NULL
+				AND EXISTS (SELECT 1 FROM jsonb_array_elements(links) l WHERE l->>'url' = ANY($1))
+			ORDER BY created_at LIMIT 1`, pq.Array(links)))
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if broadcast.State != "upcoming" && broadcast.State != "live" {
+			return nil
+		}
+		return createYouTubeLive(ctx, broadcast, startsAt, endsAt)
+	}
+	if err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+
+	if live.ArchivedAt != nil || (live.StartsAt.Equal(startsAt) && live.EndsAt.Equal(endsAt)) {
+		return nil
+	}
+	updated, err := scanLive(db.DB.QueryRowContext(ctx, `UPDATE lives
+		SET starts_at = $2, ends_at = $3, youtube_video_id = $4, version = version + 1
+		WHERE id = $1
+		RETURNING `+liveColumns, live.ID, startsAt, endsAt, broadcast.VideoID))
+	if err != nil {
+		return fmt.Errorf("error updating live %s: %w", live.ID, err)
+	}
+	return liveUpdated(ctx, updated)
+}
+
+func createYouTubeLive(ctx context.Context, broadcast youTubeBroadcast, startsAt, endsAt time.Time) error {
+	title := broadcast.Title
+	if words := strings.Fields(title); len(words) > youTubeTitleWords {
+		title = strings.Join(words[:youTubeTitleWords], " ")
+	}
+	live := models.Live{
+		ID:    uuid.New(),
+		Title: title,
+		Links: []models.LiveLink{{
+			Platform: models.LivePlatformYouTube,
+			URL:      youTubeWatchURL(broadcast.VideoID),
+			Primary:  true,
+		}},
+		Description: truncateDescription(broadcast.Description, validation.MaxExcerptLength),
+		StartsAt:    startsAt,
+		EndsAt:      endsAt,
+		Version:     1,
+		CreatedAt:   time.Now(),
+	}
+	if err := validation.ValidateLives(&live); err != nil {
+		log.Printf("Skipping YouTube broadcast %s: %v", broadcast.VideoID, err)
+		return nil
+	}
+
+	links, err := json.Marshal(live.Links)
+	if err != nil {
+		return err
+	}
+	result, err := db.DB.ExecContext(ctx, `INSERT INTO lives (id, title, links, description, starts_at, ends_at,
+			youtube_video_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (youtube_video_id) DO NOTHING`,
+		live.ID, live.Title, links, live.Description, live.StartsAt, live.EndsAt, broadcast.VideoID, live.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting live: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return nil // another instance synced it first
+	}
+	return liveCreated(ctx, live)
+}
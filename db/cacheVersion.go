@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// cacheVersionPrefix is the prefix of the Redis counters that version the
+// cache keys of each entity type.
+const cacheVersionPrefix = "cache_version:"
+
+// CacheKey returns the Redis key of a cached entity list, or of a single item
+// when id is set, e.g. "posts:v3" and "posts:v3:<id>". The keys embed the
+// entity's cache version, so BumpCacheVersion invalidates all of them at once.
+func CacheKey(ctx context.Context, entity, id string) (string, error) {
+	version, err := RedisClient.Get(ctx, cacheVersionPrefix+entity).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("error fetching %s cache version: %w", entity, err)
+	}
+	key := entity + ":v" + strconv.FormatInt(version, 10)
+	if id != "" {
+		key += ":" + id
+	}
+	return key, nil
+}
+
+// BumpCacheVersion invalidates every cached key of an entity type, e.g. after a
+// bulk import, without deleting them: readers move on to keys of the new
+// version and the old ones expire on their own. It returns the new version.
+func BumpCacheVersion(ctx context.Context, entity string) (int64, error) {
+	version, err := RedisClient.Incr(ctx, cacheVersionPrefix+entity).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error bumping %s cache version: %w", entity, err)
+	}
+	return version, nil
+}
+
+// FilteredListsKey returns the key of the Redis hash that caches the filtered
+// and sorted lists of an entity by their canonical query, next to its list
+// key. It stays outside the "<list key>:" namespace of cached items.
+func FilteredListsKey(listKey string) string {
+	return listKey + "-filtered"
+}
+
+// GetFilteredList returns the cached list of an entity type for a filter, or
+// redis.Nil when it is not cached.
+func GetFilteredList(ctx context.Context, entity, filter string) ([]byte, error) {
+	listKey, err := CacheKey(ctx, entity, "")
+	if err != nil {
+		return nil, err
+	}
+	return RedisClient.HGet(ctx, FilteredListsKey(listKey), filter).Bytes()
+}
+
+// SetFilteredList caches the list of an entity type for a filter. All
+// filtered lists of an entity expire together, ttl after the last one was
+// cached, and DeleteCacheKeys clears them with the full list.
+func SetFilteredList(ctx context.Context, entity, filter string, data []byte, ttl time.Duration) error {
+	listKey, err := CacheKey(ctx, entity, "")
+	if err != nil {
+		return err
+	}
+	key := FilteredListsKey(listKey)
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, filter, data)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error setting filtered %s cache: %w", entity, err)
+	}
+	return nil
+}
+
+// DeleteCacheKeys deletes the cached lists of an entity type and the cached
+// items with the given IDs.
+func DeleteCacheKeys(ctx context.Context, entity string, ids ...string) error {
+	listKey, err := CacheKey(ctx, entity, "")
+	if err != nil {
+		return err
+	}
+	keys := []string{listKey, FilteredListsKey(listKey)}
+	for _, id := range ids {
+		keys = append(keys, listKey+":"+id)
+	}
+	if err := RedisClient.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("error clearing %s cache: %w", entity, err)
+	}
+	return nil
+}
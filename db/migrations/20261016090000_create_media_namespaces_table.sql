@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE media_namespaces (
+                       namespace VARCHAR(63) PRIMARY KEY,
+                       bytes_used BIGINT NOT NULL DEFAULT 0 CHECK (bytes_used >= 0),
+                       quota_bytes BIGINT CHECK (quota_bytes >= 0),
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS media_namespaces;
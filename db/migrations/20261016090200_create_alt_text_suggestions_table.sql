@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE alt_text_suggestions (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       media_key VARCHAR(255) NOT NULL,
+                       provider VARCHAR(50) NOT NULL,
+                       suggestion TEXT NOT NULL,
+                       status VARCHAR(20) NOT NULL DEFAULT 'pending'
+                           CHECK (status IN ('pending', 'accepted', 'rejected')),
+                       alt_text TEXT,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       reviewed_at TIMESTAMP
+);
+
+CREATE INDEX idx_alt_text_suggestions_media_key ON alt_text_suggestions (media_key);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS alt_text_suggestions;
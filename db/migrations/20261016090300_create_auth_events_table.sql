@@ -0,0 +1,19 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE auth_events (
+                       id BIGSERIAL PRIMARY KEY,
+                       user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+                       username VARCHAR(255) NOT NULL,
+                       event VARCHAR(50) NOT NULL,
+                       ip_address VARCHAR(45),
+                       user_agent TEXT,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_auth_events_user_id_created_at ON auth_events (user_id, created_at DESC);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS auth_events;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE posts ADD COLUMN content_hash CHAR(64);
+
+-- Must match models.Post.ComputeContentHash: SHA-256 over the fields joined by 0x1F.
+UPDATE posts SET content_hash = encode(sha256(convert_to(
+    title || chr(31) || COALESCE(excerpt, '') || chr(31) || COALESCE(body, ''), 'UTF8')), 'hex');
+
+CREATE TABLE integrity_alerts (
+                       id BIGSERIAL PRIMARY KEY,
+                       entity VARCHAR(50) NOT NULL,
+                       entity_id UUID NOT NULL,
+                       expected_hash CHAR(64),
+                       actual_hash CHAR(64) NOT NULL,
+                       detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       resolved_at TIMESTAMP,
+                       resolved_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       changes_accepted BOOLEAN
+);
+
+CREATE UNIQUE INDEX idx_integrity_alerts_open ON integrity_alerts (entity, entity_id) WHERE resolved_at IS NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS integrity_alerts;
+ALTER TABLE posts DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE service_segments (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       live_id UUID NOT NULL REFERENCES lives (id) ON DELETE CASCADE,
+                       position INTEGER NOT NULL,
+                       title VARCHAR(255) NOT NULL,
+                       owner VARCHAR(255) NOT NULL DEFAULT '',
+                       duration_seconds INTEGER NOT NULL DEFAULT 0 CHECK (duration_seconds >= 0),
+                       notes TEXT NOT NULL DEFAULT '',
+                       attachments JSONB NOT NULL DEFAULT '[]',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CONSTRAINT service_segments_live_position_key UNIQUE (live_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS service_segments;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE songs (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL,
+                       author VARCHAR(255) NOT NULL DEFAULT '',
+                       ccli_number VARCHAR(10) NOT NULL DEFAULT '',
+                       song_key VARCHAR(4) NOT NULL DEFAULT '',
+                       lyrics_reference TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX songs_ccli_number_key ON songs (ccli_number) WHERE ccli_number <> '';
+
+-- Worship sets outlive their live so that CCLI usage stays reportable.
+CREATE TABLE worship_sets (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       live_id UUID REFERENCES lives (id) ON DELETE SET NULL,
+                       service_date DATE NOT NULL,
+                       notes TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX worship_sets_service_date_idx ON worship_sets (service_date);
+CREATE INDEX worship_sets_live_id_idx ON worship_sets (live_id);
+
+CREATE TABLE worship_set_songs (
+                       worship_set_id UUID NOT NULL REFERENCES worship_sets (id) ON DELETE CASCADE,
+                       song_id UUID NOT NULL REFERENCES songs (id) ON DELETE RESTRICT,
+                       position INTEGER NOT NULL,
+                       PRIMARY KEY (worship_set_id, position)
+);
+
+CREATE INDEX worship_set_songs_song_id_idx ON worship_set_songs (song_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS worship_set_songs;
+DROP TABLE IF EXISTS worship_sets;
+DROP TABLE IF EXISTS songs;
@@ -0,0 +1,64 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE courses (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL,
+                       description TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE lessons (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       course_id UUID NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                       position INTEGER NOT NULL,
+                       title VARCHAR(255) NOT NULL,
+                       content TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CONSTRAINT lessons_course_position_key UNIQUE (course_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE TABLE enrollments (
+                       course_id UUID NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       enrolled_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       completed_at TIMESTAMP,
+                       PRIMARY KEY (course_id, user_id)
+);
+
+CREATE INDEX idx_enrollments_user_id ON enrollments (user_id);
+
+CREATE TABLE lesson_completions (
+                       lesson_id UUID NOT NULL REFERENCES lessons (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       completed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (lesson_id, user_id)
+);
+
+-- Certificates are rendered by a background worker; pending rows are its queue.
+CREATE TABLE course_certificates (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       course_id UUID NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       status VARCHAR(20) NOT NULL DEFAULT 'pending'
+                           CHECK (status IN ('pending', 'ready', 'failed')),
+                       pdf BYTEA,
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       last_error TEXT,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       generated_at TIMESTAMP,
+                       UNIQUE (course_id, user_id)
+);
+
+CREATE INDEX idx_course_certificates_pending ON course_certificates (created_at) WHERE status = 'pending';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS course_certificates;
+DROP TABLE IF EXISTS lesson_completions;
+DROP TABLE IF EXISTS enrollments;
+DROP TABLE IF EXISTS lessons;
+DROP TABLE IF EXISTS courses;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Every refresh token issued since login shares the family_id of the login.
+-- A rotated token presented again means it was stolen, so the family is revoked.
+CREATE TABLE refresh_tokens (
+                       id VARCHAR(64) PRIMARY KEY,
+                       family_id UUID NOT NULL,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       expires_at TIMESTAMP NOT NULL,
+                       rotated_at TIMESTAMP,
+                       revoked_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS refresh_tokens;
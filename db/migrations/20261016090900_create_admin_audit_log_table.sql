@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE admin_audit_log (
+                       id BIGSERIAL PRIMARY KEY,
+                       admin_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       action VARCHAR(50) NOT NULL,
+                       method VARCHAR(10) NOT NULL,
+                       path TEXT NOT NULL,
+                       status INTEGER NOT NULL,
+                       ip_address VARCHAR(45),
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_admin_audit_log_admin_id_created_at ON admin_audit_log (admin_id, created_at DESC);
+CREATE INDEX idx_admin_audit_log_user_id_created_at ON admin_audit_log (user_id, created_at DESC);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS admin_audit_log;
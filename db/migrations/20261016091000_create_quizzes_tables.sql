@@ -0,0 +1,43 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE quizzes (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       course_id UUID NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                       title VARCHAR(255) NOT NULL,
+                       pass_percent INTEGER NOT NULL DEFAULT 70 CHECK (pass_percent BETWEEN 1 AND 100),
+                       max_attempts INTEGER NOT NULL DEFAULT 3 CHECK (max_attempts >= 0),
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_quizzes_course_id ON quizzes (course_id);
+
+CREATE TABLE quiz_questions (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       quiz_id UUID NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+                       position INTEGER NOT NULL,
+                       prompt TEXT NOT NULL,
+                       options JSONB NOT NULL,
+                       correct_option INTEGER NOT NULL,
+                       UNIQUE (quiz_id, position)
+);
+
+CREATE TABLE quiz_attempts (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       quiz_id UUID NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       score_percent INTEGER NOT NULL,
+                       passed BOOLEAN NOT NULL,
+                       answers JSONB NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_quiz_attempts_quiz_id_user_id ON quiz_attempts (quiz_id, user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS quiz_attempts;
+DROP TABLE IF EXISTS quiz_questions;
+DROP TABLE IF EXISTS quizzes;
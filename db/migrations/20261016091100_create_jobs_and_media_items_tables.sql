@@ -0,0 +1,66 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Background jobs processed by the workers in the jobs package.
+CREATE TABLE jobs (
+                       id UUID PRIMARY KEY,
+                       type VARCHAR(100) NOT NULL,
+                       payload JSONB NOT NULL DEFAULT '{}',
+                       status VARCHAR(20) NOT NULL DEFAULT 'queued'
+                           CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       max_attempts INTEGER NOT NULL DEFAULT 5,
+                       run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       last_error TEXT,
+                       result JSONB,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_jobs_status_run_at ON jobs (status, run_at);
+
+-- Files in the media library. The bytes live in the configured storage.
+CREATE TABLE media_items (
+                       id UUID PRIMARY KEY,
+                       namespace VARCHAR(63) NOT NULL REFERENCES media_namespaces (namespace),
+                       storage_key VARCHAR(512) NOT NULL UNIQUE,
+                       filename VARCHAR(255) NOT NULL,
+                       content_type VARCHAR(100) NOT NULL,
+                       size_bytes BIGINT NOT NULL,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_items_namespace ON media_items (namespace);
+
+-- Certificates are now rendered by the job queue and stored in the media
+-- library. Existing certificates are rendered again.
+DROP INDEX IF EXISTS idx_course_certificates_pending;
+
+ALTER TABLE course_certificates
+    DROP COLUMN pdf,
+    DROP COLUMN attempts,
+    DROP COLUMN last_error,
+    ADD COLUMN media_id UUID REFERENCES media_items (id) ON DELETE SET NULL;
+
+UPDATE course_certificates SET status = 'pending', generated_at = NULL;
+
+INSERT INTO jobs (id, type, payload)
+SELECT uuid_generate_v4(), 'course_certificate', json_build_object('certificate_id', id)
+FROM course_certificates;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE course_certificates
+    DROP COLUMN IF EXISTS media_id,
+    ADD COLUMN pdf BYTEA,
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_error TEXT;
+
+UPDATE course_certificates SET status = 'pending', generated_at = NULL;
+
+CREATE INDEX idx_course_certificates_pending ON course_certificates (created_at) WHERE status = 'pending';
+
+DROP TABLE IF EXISTS media_items;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,55 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE user_tags (
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       tag VARCHAR(50) NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (user_id, tag)
+);
+
+CREATE INDEX idx_user_tags_tag ON user_tags (tag);
+
+CREATE TABLE email_segments (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       name VARCHAR(100) NOT NULL UNIQUE,
+                       description TEXT NOT NULL DEFAULT '',
+                       rules JSONB NOT NULL DEFAULT '{}',
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE email_campaigns (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       subject VARCHAR(200) NOT NULL,
+                       text_body TEXT NOT NULL,
+                       html_body TEXT NOT NULL DEFAULT '',
+                       segment_id UUID REFERENCES email_segments (id) ON DELETE RESTRICT,
+                       status VARCHAR(20) NOT NULL DEFAULT 'draft'
+                           CHECK (status IN ('draft', 'queued', 'sending', 'sent', 'failed')),
+                       recipient_count INTEGER NOT NULL DEFAULT 0,
+                       last_error TEXT,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_email_campaigns_created_at ON email_campaigns (created_at);
+
+-- The audience is fixed when sending starts; queued_at records who has been
+-- handed to the mailer so a retried send never emails anyone twice.
+CREATE TABLE email_campaign_recipients (
+                       campaign_id UUID NOT NULL REFERENCES email_campaigns (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       queued_at TIMESTAMP,
+                       PRIMARY KEY (campaign_id, user_id)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS email_campaign_recipients;
+DROP TABLE IF EXISTS email_campaigns;
+DROP TABLE IF EXISTS email_segments;
+DROP TABLE IF EXISTS user_tags;
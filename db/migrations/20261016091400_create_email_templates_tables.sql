@@ -0,0 +1,32 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Templates named after a built-in email (e.g. password_changed) replace its
+-- copy; other templates can be used for campaigns.
+CREATE TABLE email_templates (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       name VARCHAR(100) NOT NULL UNIQUE,
+                       description TEXT NOT NULL DEFAULT '',
+                       variables TEXT[] NOT NULL DEFAULT '{}',
+                       current_version INTEGER NOT NULL DEFAULT 1,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every edit adds a version, so earlier copy can be reviewed and restored.
+CREATE TABLE email_template_versions (
+                       template_id UUID NOT NULL REFERENCES email_templates (id) ON DELETE CASCADE,
+                       version INTEGER NOT NULL,
+                       subject VARCHAR(200) NOT NULL,
+                       text_body TEXT NOT NULL,
+                       html_body TEXT NOT NULL,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (template_id, version)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS email_template_versions;
+DROP TABLE IF EXISTS email_templates;
@@ -0,0 +1,41 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE users ADD COLUMN email_tracking_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The token identifies a recipient in open and click tracking URLs. Tracked
+-- is false when the message went out without tracking, e.g. because the
+-- recipient opted out.
+ALTER TABLE email_campaign_recipients
+    ADD COLUMN token UUID NOT NULL DEFAULT uuid_generate_v4(),
+    ADD COLUMN tracked BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN opened_at TIMESTAMP,
+    ADD COLUMN open_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN clicked_at TIMESTAMP,
+    ADD COLUMN click_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX idx_email_campaign_recipients_token ON email_campaign_recipients (token);
+
+-- Links found in a campaign when it is sent. Tracked links point at their
+-- position, so the click endpoint only ever redirects to these URLs.
+CREATE TABLE email_campaign_links (
+                       campaign_id UUID NOT NULL REFERENCES email_campaigns (id) ON DELETE CASCADE,
+                       position INTEGER NOT NULL,
+                       url TEXT NOT NULL,
+                       clicks INTEGER NOT NULL DEFAULT 0,
+                       PRIMARY KEY (campaign_id, position)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS email_campaign_links;
+DROP INDEX IF EXISTS idx_email_campaign_recipients_token;
+ALTER TABLE email_campaign_recipients
+    DROP COLUMN IF EXISTS token,
+    DROP COLUMN IF EXISTS tracked,
+    DROP COLUMN IF EXISTS opened_at,
+    DROP COLUMN IF EXISTS open_count,
+    DROP COLUMN IF EXISTS clicked_at,
+    DROP COLUMN IF EXISTS click_count;
+ALTER TABLE users DROP COLUMN IF EXISTS email_tracking_opt_out;
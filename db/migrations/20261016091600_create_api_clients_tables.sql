@@ -0,0 +1,32 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Clients of the public API. Only a hash of the token is stored; the token
+-- itself is shown once, when the client is created.
+CREATE TABLE api_clients (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       name VARCHAR(100) NOT NULL,
+                       token_hash CHAR(64) NOT NULL UNIQUE,
+                       token_prefix VARCHAR(12) NOT NULL,
+                       rate_limit INTEGER NOT NULL DEFAULT 20 CHECK (rate_limit > 0),
+                       revoked_at TIMESTAMP,
+                       last_used_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_clients_user_id ON api_clients (user_id);
+
+CREATE TABLE api_client_usage (
+                       client_id UUID NOT NULL REFERENCES api_clients (id) ON DELETE CASCADE,
+                       day DATE NOT NULL,
+                       requests INTEGER NOT NULL DEFAULT 0,
+                       rejected INTEGER NOT NULL DEFAULT 0,
+                       PRIMARY KEY (client_id, day)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS api_client_usage;
+DROP TABLE IF EXISTS api_clients;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Usage is counted in Redis and rolled up into api_client_usage by a
+-- background job; monthly_quota caps the requests a client may make per
+-- calendar month (UTC).
+ALTER TABLE api_clients ADD COLUMN monthly_quota INTEGER NOT NULL DEFAULT 10000 CHECK (monthly_quota > 0);
+ALTER TABLE api_client_usage ADD COLUMN bytes BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE api_client_usage DROP COLUMN IF EXISTS bytes;
+ALTER TABLE api_clients DROP COLUMN IF EXISTS monthly_quota;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE posts ADD COLUMN slug VARCHAR(100);
+
+-- Must match utils.Slugify; later duplicates get -2, -3, ... like new posts.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    r RECORD;
+    base TEXT;
+    candidate TEXT;
+    n INTEGER;
+BEGIN
+    FOR r IN SELECT id, title FROM posts ORDER BY created_at, id LOOP
+        base := COALESCE(NULLIF(trim(BOTH '-' FROM left(regexp_replace(lower(r.title), '[^a-z0-9]+', '-', 'g'), 80)), ''), 'post');
+        candidate := base;
+        n := 1;
+        WHILE EXISTS (SELECT 1 FROM posts WHERE slug = candidate) LOOP
+            n := n + 1;
+            candidate := base || '-' || n;
+        END LOOP;
+        UPDATE posts SET slug = candidate WHERE id = r.id;
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX idx_posts_slug ON posts (slug);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_posts_slug;
+ALTER TABLE posts DROP COLUMN IF EXISTS slug;
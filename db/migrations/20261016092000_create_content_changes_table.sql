@@ -0,0 +1,61 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The latest change of every synced row, kept by triggers so that writes
+-- from anywhere are seen. deleted marks tombstones: rows that were removed or,
+-- for posts, are no longer published. TIMESTAMPTZ because sync clients send
+-- their own times back.
+CREATE TABLE content_changes (
+                       entity VARCHAR(50) NOT NULL,
+                       entity_id UUID NOT NULL,
+                       deleted BOOLEAN NOT NULL,
+                       first_seen_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+                       changed_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+                       PRIMARY KEY (entity, entity_id)
+);
+
+CREATE INDEX idx_content_changes_changed_at ON content_changes (changed_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION record_content_change() RETURNS TRIGGER AS $$
+DECLARE
+    row_id UUID;
+    is_deleted BOOLEAN;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_id := OLD.id;
+        is_deleted := TRUE;
+    ELSE
+        row_id := NEW.id;
+        is_deleted := FALSE;
+        IF TG_TABLE_NAME = 'posts' THEN
+            is_deleted := NEW.status <> 'published';
+        END IF;
+        -- Rows that were never visible need no tombstone.
+        IF is_deleted AND TG_OP = 'INSERT' THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    -- clock_timestamp() rather than NOW() so rows changed in one transaction
+    -- still get distinct times.
+    INSERT INTO content_changes (entity, entity_id, deleted)
+    VALUES (TG_TABLE_NAME, row_id, is_deleted)
+    ON CONFLICT (entity, entity_id) DO UPDATE SET deleted = EXCLUDED.deleted, changed_at = clock_timestamp();
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER posts_content_change AFTER INSERT OR UPDATE OR DELETE ON posts
+    FOR EACH ROW EXECUTE FUNCTION record_content_change();
+CREATE TRIGGER lives_content_change AFTER INSERT OR UPDATE OR DELETE ON lives
+    FOR EACH ROW EXECUTE FUNCTION record_content_change();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS lives_content_change ON lives;
+DROP TRIGGER IF EXISTS posts_content_change ON posts;
+DROP FUNCTION IF EXISTS record_content_change();
+DROP TABLE IF EXISTS content_changes;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Policy documents, meeting minutes and other files in the document library.
+-- The file lives in media_items; content_text is filled in by the
+-- document.extract job.
+CREATE TABLE documents (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       media_id UUID NOT NULL REFERENCES media_items (id),
+                       title VARCHAR(200) NOT NULL,
+                       content_text TEXT NOT NULL DEFAULT '',
+                       extraction_status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (extraction_status IN ('pending', 'done', 'failed')),
+                       extraction_error TEXT,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       search_vector TSVECTOR GENERATED ALWAYS AS (
+                           setweight(to_tsvector('english', title), 'A') ||
+                           setweight(to_tsvector('english', content_text), 'B')
+                       ) STORED
+);
+
+CREATE INDEX idx_documents_created_at ON documents (created_at);
+CREATE INDEX idx_documents_search_vector ON documents USING GIN (search_vector);
+
+ALTER TABLE posts ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', COALESCE(excerpt, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(body, '')), 'C')
+) STORED;
+
+CREATE INDEX idx_posts_search_vector ON posts USING GIN (search_vector);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
+DROP TABLE IF EXISTS documents;
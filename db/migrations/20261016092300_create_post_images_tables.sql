@@ -0,0 +1,68 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Images uploaded for posts. Both the image and its thumbnail live in
+-- media_items. unused_since is set while no post references the image, so
+-- images that stay unused can be purged.
+CREATE TABLE post_images (
+                       media_id UUID PRIMARY KEY REFERENCES media_items (id),
+                       thumbnail_media_id UUID NOT NULL UNIQUE REFERENCES media_items (id),
+                       width INTEGER NOT NULL,
+                       height INTEGER NOT NULL,
+                       unused_since TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_post_images_unused_since ON post_images (unused_since) WHERE unused_since IS NOT NULL;
+
+-- The images each post references, kept by a trigger on posts. The foreign
+-- key stops a referenced image from being deleted.
+CREATE TABLE post_media (
+                       post_id UUID NOT NULL,
+                       media_id UUID NOT NULL REFERENCES post_images (media_id),
+                       PRIMARY KEY (post_id, media_id)
+);
+
+CREATE INDEX idx_post_media_media_id ON post_media (media_id);
+
+-- Posts reference images by URL, and every image URL contains the media ID of
+-- the image or its thumbnail.
+-- +goose StatementBegin
+CREATE FUNCTION sync_post_media() RETURNS TRIGGER AS $$
+DECLARE
+    released UUID[];
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        WITH removed AS (DELETE FROM post_media WHERE post_id = OLD.id RETURNING media_id)
+        SELECT array_agg(media_id) INTO released FROM removed;
+    END IF;
+
+    IF TG_OP <> 'DELETE' THEN
+        INSERT INTO post_media (post_id, media_id)
+        SELECT DISTINCT NEW.id, i.media_id
+        FROM regexp_matches(lower(COALESCE(NEW.body, '')),
+            '[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}', 'g') AS m
+        JOIN post_images i ON m[1]::uuid IN (i.media_id, i.thumbnail_media_id);
+
+        UPDATE post_images SET unused_since = NULL
+        WHERE unused_since IS NOT NULL
+            AND media_id IN (SELECT media_id FROM post_media WHERE post_id = NEW.id);
+    END IF;
+
+    UPDATE post_images i SET unused_since = CURRENT_TIMESTAMP
+    WHERE i.media_id = ANY (released)
+        AND NOT EXISTS (SELECT 1 FROM post_media pm WHERE pm.media_id = i.media_id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER posts_sync_media AFTER INSERT OR UPDATE OF body OR DELETE ON posts
+    FOR EACH ROW EXECUTE FUNCTION sync_post_media();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS posts_sync_media ON posts;
+DROP FUNCTION IF EXISTS sync_post_media();
+DROP TABLE IF EXISTS post_media;
+DROP TABLE IF EXISTS post_images;
@@ -0,0 +1,45 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Old paths that moved, e.g. after a post's slug changed. Paths are
+-- site-relative ("/posts/old-slug") and stored without a trailing slash.
+CREATE TABLE redirects (
+                       from_path VARCHAR(500) PRIMARY KEY,
+                       to_path VARCHAR(500) NOT NULL,
+                       status_code SMALLINT NOT NULL DEFAULT 301 CHECK (status_code IN (301, 302, 307, 308)),
+                       automatic BOOLEAN NOT NULL DEFAULT FALSE,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CHECK (from_path <> to_path)
+);
+
+CREATE INDEX idx_redirects_to_path ON redirects (to_path);
+
+-- Renaming a post redirects its old path to the new one. Redirects that
+-- pointed at the old path are moved along so there are no chains, and a
+-- redirect away from the new path is dropped because the path is live again.
+-- +goose StatementBegin
+CREATE FUNCTION record_slug_redirect() RETURNS TRIGGER AS $$
+DECLARE
+    old_path VARCHAR(500) := '/posts/' || OLD.slug;
+    new_path VARCHAR(500) := '/posts/' || NEW.slug;
+BEGIN
+    DELETE FROM redirects WHERE from_path = new_path;
+    UPDATE redirects SET to_path = new_path WHERE to_path = old_path;
+    INSERT INTO redirects (from_path, to_path, automatic)
+    VALUES (old_path, new_path, TRUE)
+    ON CONFLICT (from_path) DO UPDATE SET to_path = EXCLUDED.to_path, status_code = 301, automatic = TRUE;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER posts_slug_redirect AFTER UPDATE OF slug ON posts
+    FOR EACH ROW WHEN (OLD.slug IS DISTINCT FROM NEW.slug) EXECUTE FUNCTION record_slug_redirect();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS posts_slug_redirect ON posts;
+DROP FUNCTION IF EXISTS record_slug_redirect();
+DROP TABLE IF EXISTS redirects;
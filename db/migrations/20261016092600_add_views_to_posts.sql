@@ -0,0 +1,79 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Views are counted in Redis and added here periodically.
+ALTER TABLE posts ADD COLUMN views BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_posts_views ON posts (views DESC) WHERE status = 'published' AND deleted_at IS NULL;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_content_change() RETURNS TRIGGER AS $$
+DECLARE
+    row_id UUID;
+    is_deleted BOOLEAN;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_id := OLD.id;
+        is_deleted := TRUE;
+    ELSE
+        -- Updates that only count views are not content changes.
+        IF TG_OP = 'UPDATE' AND to_jsonb(OLD) - 'views' = to_jsonb(NEW) - 'views' THEN
+            RETURN NULL;
+        END IF;
+        row_id := NEW.id;
+        is_deleted := FALSE;
+        IF TG_TABLE_NAME = 'posts' THEN
+            is_deleted := NEW.status <> 'published' OR NEW.deleted_at IS NOT NULL;
+        END IF;
+        -- Rows that were never visible need no tombstone.
+        IF is_deleted AND TG_OP = 'INSERT' THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    -- clock_timestamp() rather than NOW() so rows changed in one transaction
+    -- still get distinct times.
+    INSERT INTO content_changes (entity, entity_id, deleted)
+    VALUES (TG_TABLE_NAME, row_id, is_deleted)
+    ON CONFLICT (entity, entity_id) DO UPDATE SET deleted = EXCLUDED.deleted, changed_at = clock_timestamp();
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_content_change() RETURNS TRIGGER AS $$
+DECLARE
+    row_id UUID;
+    is_deleted BOOLEAN;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_id := OLD.id;
+        is_deleted := TRUE;
+    ELSE
+        row_id := NEW.id;
+        is_deleted := FALSE;
+        IF TG_TABLE_NAME = 'posts' THEN
+            is_deleted := NEW.status <> 'published' OR NEW.deleted_at IS NOT NULL;
+        END IF;
+        -- Rows that were never visible need no tombstone.
+        IF is_deleted AND TG_OP = 'INSERT' THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    -- clock_timestamp() rather than NOW() so rows changed in one transaction
+    -- still get distinct times.
+    INSERT INTO content_changes (entity, entity_id, deleted)
+    VALUES (TG_TABLE_NAME, row_id, is_deleted)
+    ON CONFLICT (entity, entity_id) DO UPDATE SET deleted = EXCLUDED.deleted, changed_at = clock_timestamp();
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP INDEX IF EXISTS idx_posts_views;
+ALTER TABLE posts DROP COLUMN IF EXISTS views;
@@ -0,0 +1,48 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- When each summary was last refreshed. Rows changed after refreshed_at are
+-- summarized by the next run.
+CREATE TABLE summary_refreshes (
+                       name VARCHAR(100) PRIMARY KEY,
+                       refreshed_at TIMESTAMP NOT NULL
+);
+
+-- Recipient rows remember when they last changed, so only campaigns with
+-- new sends, opens or clicks are summarized again.
+ALTER TABLE email_campaign_recipients ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_email_campaign_recipients_updated_at ON email_campaign_recipients (updated_at);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION touch_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at := clock_timestamp();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER email_campaign_recipients_touch BEFORE UPDATE ON email_campaign_recipients
+    FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+CREATE TABLE email_campaign_stats (
+                       campaign_id UUID PRIMARY KEY REFERENCES email_campaigns (id) ON DELETE CASCADE,
+                       sent INTEGER NOT NULL DEFAULT 0,
+                       tracked INTEGER NOT NULL DEFAULT 0,
+                       unique_opens INTEGER NOT NULL DEFAULT 0,
+                       opens INTEGER NOT NULL DEFAULT 0,
+                       unique_clicks INTEGER NOT NULL DEFAULT 0,
+                       clicks INTEGER NOT NULL DEFAULT 0,
+                       refreshed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS email_campaign_stats;
+DROP TRIGGER IF EXISTS email_campaign_recipients_touch ON email_campaign_recipients;
+DROP FUNCTION IF EXISTS touch_updated_at();
+DROP INDEX IF EXISTS idx_email_campaign_recipients_updated_at;
+ALTER TABLE email_campaign_recipients DROP COLUMN IF EXISTS updated_at;
+DROP TABLE IF EXISTS summary_refreshes;
@@ -0,0 +1,153 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- auth_events and admin_audit_log are partitioned by month of created_at, so
+-- old months can be dropped instead of deleted row by row. The scheduler
+-- creates upcoming partitions; rows without one land in the default
+-- partition and are moved out when their month's partition is created.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION create_monthly_partition(parent TEXT, month DATE) RETURNS TEXT AS $$
+DECLARE
+    first_day DATE := date_trunc('month', month)::date;
+    next_month DATE := (date_trunc('month', month) + INTERVAL '1 month')::date;
+    child TEXT := parent || '_' || to_char(month, 'YYYY_MM');
+BEGIN
+    IF to_regclass(child) IS NOT NULL THEN
+        RETURN child;
+    END IF;
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS INCLUDING CONSTRAINTS)', child, parent);
+    EXECUTE format('WITH moved AS (DELETE FROM %I WHERE created_at >= %L AND created_at < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', first_day, next_month, child);
+    EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)', parent, child, first_day, next_month);
+    RETURN child;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE auth_events RENAME TO auth_events_unpartitioned;
+ALTER INDEX auth_events_pkey RENAME TO auth_events_unpartitioned_pkey;
+DROP INDEX idx_auth_events_user_id_created_at;
+ALTER TABLE auth_events_unpartitioned ALTER COLUMN id DROP DEFAULT;
+
+CREATE TABLE auth_events (
+                       id BIGINT NOT NULL DEFAULT nextval('auth_events_id_seq'),
+                       user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+                       username VARCHAR(255) NOT NULL,
+                       event VARCHAR(50) NOT NULL,
+                       ip_address VARCHAR(45),
+                       user_agent TEXT,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE auth_events_id_seq OWNED BY auth_events.id;
+CREATE INDEX idx_auth_events_user_id_created_at ON auth_events (user_id, created_at DESC);
+CREATE TABLE auth_events_default PARTITION OF auth_events DEFAULT;
+
+INSERT INTO auth_events SELECT * FROM auth_events_unpartitioned;
+-- +goose StatementBegin
+DO $$
+DECLARE
+    months DATE[];
+    month DATE;
+BEGIN
+    SELECT array_agg(DISTINCT m) INTO months FROM (
+        SELECT date_trunc('month', created_at)::date AS m FROM auth_events_default
+        UNION ALL SELECT date_trunc('month', NOW())::date
+        UNION ALL SELECT date_trunc('month', NOW() + INTERVAL '1 month')::date
+    ) AS all_months;
+    FOREACH month IN ARRAY months LOOP
+        PERFORM create_monthly_partition('auth_events', month);
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+DROP TABLE auth_events_unpartitioned;
+
+ALTER TABLE admin_audit_log RENAME TO admin_audit_log_unpartitioned;
+ALTER INDEX admin_audit_log_pkey RENAME TO admin_audit_log_unpartitioned_pkey;
+DROP INDEX idx_admin_audit_log_admin_id_created_at;
+DROP INDEX idx_admin_audit_log_user_id_created_at;
+ALTER TABLE admin_audit_log_unpartitioned ALTER COLUMN id DROP DEFAULT;
+
+CREATE TABLE admin_audit_log (
+                       id BIGINT NOT NULL DEFAULT nextval('admin_audit_log_id_seq'),
+                       admin_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       action VARCHAR(50) NOT NULL,
+                       method VARCHAR(10) NOT NULL,
+                       path TEXT NOT NULL,
+                       status INTEGER NOT NULL,
+                       ip_address VARCHAR(45),
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE admin_audit_log_id_seq OWNED BY admin_audit_log.id;
+CREATE INDEX idx_admin_audit_log_admin_id_created_at ON admin_audit_log (admin_id, created_at DESC);
+CREATE INDEX idx_admin_audit_log_user_id_created_at ON admin_audit_log (user_id, created_at DESC);
+CREATE TABLE admin_audit_log_default PARTITION OF admin_audit_log DEFAULT;
+
+INSERT INTO admin_audit_log SELECT * FROM admin_audit_log_unpartitioned;
+-- +goose StatementBegin
+DO $$
+DECLARE
+    months DATE[];
+    month DATE;
+BEGIN
+    SELECT array_agg(DISTINCT m) INTO months FROM (
+        SELECT date_trunc('month', created_at)::date AS m FROM admin_audit_log_default
+        UNION ALL SELECT date_trunc('month', NOW())::date
+        UNION ALL SELECT date_trunc('month', NOW() + INTERVAL '1 month')::date
+    ) AS all_months;
+    FOREACH month IN ARRAY months LOOP
+        PERFORM create_monthly_partition('admin_audit_log', month);
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+DROP TABLE admin_audit_log_unpartitioned;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+CREATE TABLE auth_events_unpartitioned (
+                       id BIGINT PRIMARY KEY,
+                       user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+                       username VARCHAR(255) NOT NULL,
+                       event VARCHAR(50) NOT NULL,
+                       ip_address VARCHAR(45),
+                       user_agent TEXT,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO auth_events_unpartitioned SELECT * FROM auth_events;
+ALTER SEQUENCE auth_events_id_seq OWNED BY NONE;
+DROP TABLE auth_events;
+ALTER TABLE auth_events_unpartitioned RENAME TO auth_events;
+ALTER INDEX auth_events_unpartitioned_pkey RENAME TO auth_events_pkey;
+ALTER TABLE auth_events ALTER COLUMN id SET DEFAULT nextval('auth_events_id_seq');
+ALTER SEQUENCE auth_events_id_seq OWNED BY auth_events.id;
+CREATE INDEX idx_auth_events_user_id_created_at ON auth_events (user_id, created_at DESC);
+
+CREATE TABLE admin_audit_log_unpartitioned (
+                       id BIGINT PRIMARY KEY,
+                       admin_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       action VARCHAR(50) NOT NULL,
+                       method VARCHAR(10) NOT NULL,
+                       path TEXT NOT NULL,
+                       status INTEGER NOT NULL,
+                       ip_address VARCHAR(45),
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO admin_audit_log_unpartitioned SELECT * FROM admin_audit_log;
+ALTER SEQUENCE admin_audit_log_id_seq OWNED BY NONE;
+DROP TABLE admin_audit_log;
+ALTER TABLE admin_audit_log_unpartitioned RENAME TO admin_audit_log;
+ALTER INDEX admin_audit_log_unpartitioned_pkey RENAME TO admin_audit_log_pkey;
+ALTER TABLE admin_audit_log ALTER COLUMN id SET DEFAULT nextval('admin_audit_log_id_seq');
+ALTER SEQUENCE admin_audit_log_id_seq OWNED BY admin_audit_log.id;
+CREATE INDEX idx_admin_audit_log_admin_id_created_at ON admin_audit_log (admin_id, created_at DESC);
+CREATE INDEX idx_admin_audit_log_user_id_created_at ON admin_audit_log (user_id, created_at DESC);
+
+DROP FUNCTION IF EXISTS create_monthly_partition(TEXT, DATE);
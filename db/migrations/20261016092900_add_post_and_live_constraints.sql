@@ -0,0 +1,57 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The limits match validation.ValidatePost and validation.ValidateLives, so
+-- writes that bypass the API, such as imports and manual fixes, are held to
+-- the same rules. Word limits cannot be checked here; the character limits
+-- are set well above what the word limits allow.
+UPDATE posts SET excerpt = '' WHERE excerpt IS NULL;
+UPDATE posts SET body = '' WHERE body IS NULL;
+
+ALTER TABLE posts
+    ALTER COLUMN excerpt SET NOT NULL,
+    ALTER COLUMN body SET NOT NULL,
+    ADD CONSTRAINT posts_title_check CHECK (btrim(title) <> '') NOT VALID,
+    ADD CONSTRAINT posts_excerpt_check CHECK (btrim(excerpt) <> '' AND char_length(excerpt) <= 1000) NOT VALID,
+    ADD CONSTRAINT posts_body_check CHECK (btrim(body) <> '' AND char_length(body) <= 100000) NOT VALID,
+    ADD CONSTRAINT posts_slug_check CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$') NOT VALID;
+
+ALTER TABLE lives
+    ADD CONSTRAINT lives_title_check CHECK (btrim(title) <> '') NOT VALID,
+    ADD CONSTRAINT lives_link_check CHECK (link ~ '^https?://[^[:space:]]+$') NOT VALID;
+
+-- New writes are checked from now on. Existing rows are checked where they
+-- pass; a constraint that old rows break stays NOT VALID until they are
+-- fixed and it is validated by hand.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN SELECT conrelid::regclass AS tbl, conname FROM pg_constraint
+             WHERE conname IN ('posts_title_check', 'posts_excerpt_check', 'posts_body_check', 'posts_slug_check',
+                               'lives_title_check', 'lives_link_check') LOOP
+        BEGIN
+            EXECUTE format('ALTER TABLE %s VALIDATE CONSTRAINT %I', c.tbl, c.conname);
+        EXCEPTION WHEN check_violation THEN
+            RAISE NOTICE 'Constraint % on % is violated by existing rows and left NOT VALID', c.conname, c.tbl;
+        END;
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE lives
+    DROP CONSTRAINT IF EXISTS lives_link_check,
+    DROP CONSTRAINT IF EXISTS lives_title_check;
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_slug_check,
+    DROP CONSTRAINT IF EXISTS posts_body_check,
+    DROP CONSTRAINT IF EXISTS posts_excerpt_check,
+    DROP CONSTRAINT IF EXISTS posts_title_check,
+    ALTER COLUMN body DROP NOT NULL,
+    ALTER COLUMN excerpt DROP NOT NULL;
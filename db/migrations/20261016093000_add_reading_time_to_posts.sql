@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Estimated minutes to read the body, set by the API on every write.
+ALTER TABLE posts ADD COLUMN reading_time_minutes INTEGER NOT NULL DEFAULT 1 CHECK (reading_time_minutes > 0);
+
+-- Must match readingTimeMinutes: words as counted by validation.WordCount at
+-- 200 words a minute, rounded up. The backfill is not a content change.
+ALTER TABLE posts DISABLE TRIGGER posts_content_change;
+UPDATE posts SET reading_time_minutes = GREATEST(1, CEIL((SELECT COUNT(*) FROM regexp_matches(body, '\w+', 'g')) / 200.0));
+ALTER TABLE posts ENABLE TRIGGER posts_content_change;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE posts DROP COLUMN IF EXISTS reading_time_minutes;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Series group posts that belong together, such as the parts of a sermon
+-- series, in reading order.
+CREATE TABLE series (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL CHECK (btrim(title) <> ''),
+                       description TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A post is part of at most one series, so it has a single previous and
+-- next part.
+CREATE TABLE series_posts (
+                       series_id UUID NOT NULL REFERENCES series (id) ON DELETE CASCADE,
+                       post_id UUID NOT NULL UNIQUE REFERENCES posts (id) ON DELETE CASCADE,
+                       position INTEGER NOT NULL,
+                       PRIMARY KEY (series_id, position)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS series_posts;
+DROP TABLE IF EXISTS series;
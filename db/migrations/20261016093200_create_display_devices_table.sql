@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Kiosk and signage screens paired by an admin. Like API clients, only a
+-- hash of the token is stored; it stays NULL until the device has picked up
+-- its token after approval.
+CREATE TABLE display_devices (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       name VARCHAR(100) NOT NULL,
+                       token_hash CHAR(64) UNIQUE,
+                       approved_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       last_seen_at TIMESTAMP,
+                       revoked_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS display_devices;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Playlists of slides shown on signage displays. A playlist without a start
+-- is the default; a scheduled one takes over while it runs.
+CREATE TABLE signage_playlists (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       name VARCHAR(100) NOT NULL CHECK (btrim(name) <> ''),
+                       slides JSONB NOT NULL DEFAULT '[]',
+                       starts_at TIMESTAMP,
+                       ends_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
+
+CREATE INDEX idx_signage_playlists_schedule ON signage_playlists (starts_at, ends_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS signage_playlists;
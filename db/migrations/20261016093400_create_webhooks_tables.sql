@@ -0,0 +1,38 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Endpoints told about content changes, e.g. to rebuild the site or post to
+-- Discord. An empty events list subscribes to every event. The secret signs
+-- deliveries, so it is stored as is.
+CREATE TABLE webhooks (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       url VARCHAR(255) NOT NULL,
+                       secret CHAR(64) NOT NULL,
+                       events TEXT[] NOT NULL DEFAULT '{}',
+                       format VARCHAR(20) NOT NULL DEFAULT 'json' CHECK (format IN ('json', 'discord')),
+                       active BOOLEAN NOT NULL DEFAULT TRUE,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per delivery attempt. Retries of a delivery share its delivery_id.
+CREATE TABLE webhook_deliveries (
+                       id BIGSERIAL PRIMARY KEY,
+                       webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                       delivery_id UUID NOT NULL,
+                       event VARCHAR(50) NOT NULL,
+                       attempt INTEGER NOT NULL,
+                       status_code INTEGER,
+                       error TEXT,
+                       duration_ms INTEGER NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at DESC);
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Kiosks are display devices that may also record gifts and check-ins.
+ALTER TABLE display_devices
+    ADD COLUMN mode VARCHAR(20) NOT NULL DEFAULT 'display' CHECK (mode IN ('display', 'kiosk'));
+
+-- Gifts, in the currency's minor unit. Kiosks record them offline under an
+-- ID they generate, so resubmitting a batch never records a gift twice.
+CREATE TABLE donations (
+                       id UUID PRIMARY KEY,
+                       user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       donor_name VARCHAR(100) NOT NULL DEFAULT '',
+                       amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+                       currency CHAR(3) NOT NULL,
+                       fund VARCHAR(50) NOT NULL DEFAULT 'general',
+                       method VARCHAR(20) NOT NULL,
+                       status VARCHAR(20) NOT NULL DEFAULT 'completed' CHECK (status IN ('pending', 'completed', 'failed', 'refunded')),
+                       reference VARCHAR(100),
+                       device_id UUID REFERENCES display_devices (id) ON DELETE SET NULL,
+                       given_at TIMESTAMP NOT NULL,
+                       recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_donations_user_id ON donations (user_id, given_at DESC);
+CREATE INDEX idx_donations_given_at ON donations (given_at);
+
+-- Attendance at a service. A member checks in once per service and day, so
+-- two kiosks scanning the same card count once.
+CREATE TABLE check_ins (
+                       id UUID PRIMARY KEY,
+                       user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       name VARCHAR(100) NOT NULL DEFAULT '',
+                       service VARCHAR(100) NOT NULL DEFAULT '',
+                       device_id UUID REFERENCES display_devices (id) ON DELETE SET NULL,
+                       checked_in_at TIMESTAMP NOT NULL,
+                       recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_check_ins_user_service_day ON check_ins (user_id, service, (checked_in_at::date))
+    WHERE user_id IS NOT NULL;
+CREATE INDEX idx_check_ins_checked_in_at ON check_ins (checked_in_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS check_ins;
+DROP TABLE IF EXISTS donations;
+ALTER TABLE display_devices DROP COLUMN IF EXISTS mode;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A user's place in the church. Users without a row are visitors.
+CREATE TABLE memberships (
+                       user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+                       status VARCHAR(20) NOT NULL CHECK (status IN ('visitor', 'regular', 'member', 'inactive')),
+                       changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_memberships_status ON memberships (status, changed_at);
+
+-- Every status change, for pastoral follow-up and reporting.
+CREATE TABLE membership_transitions (
+                       id BIGSERIAL PRIMARY KEY,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       from_status VARCHAR(20) NOT NULL,
+                       to_status VARCHAR(20) NOT NULL,
+                       reason TEXT NOT NULL DEFAULT '',
+                       changed_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_membership_transitions_user_id ON membership_transitions (user_id, changed_at DESC);
+CREATE INDEX idx_membership_transitions_changed_at ON membership_transitions (changed_at);
+
+-- Courses, such as the membership class, that must be completed before a
+-- user can move to a status.
+CREATE TABLE membership_requirements (
+                       status VARCHAR(20) NOT NULL CHECK (status IN ('visitor', 'regular', 'member', 'inactive')),
+                       course_id UUID NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                       PRIMARY KEY (status, course_id)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS membership_requirements;
+DROP TABLE IF EXISTS membership_transitions;
+DROP TABLE IF EXISTS memberships;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Social card and search engine metadata. Empty values fall back to the
+-- post's own title and excerpt on the frontend. The limits match
+-- validation.ValidatePost.
+ALTER TABLE posts
+    ADD COLUMN cover_image_url VARCHAR(2048) NOT NULL DEFAULT '',
+    ADD COLUMN meta_title VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN meta_description VARCHAR(300) NOT NULL DEFAULT '',
+    ADD COLUMN canonical_url VARCHAR(2048) NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS canonical_url,
+    DROP COLUMN IF EXISTS meta_description,
+    DROP COLUMN IF EXISTS meta_title,
+    DROP COLUMN IF EXISTS cover_image_url;
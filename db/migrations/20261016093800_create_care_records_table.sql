@@ -0,0 +1,33 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Pastoral care: visits, calls and follow-ups staff log about members.
+-- Restricted records are only visible to their author, their assignee and
+-- admins; private notes only to the author and admins.
+CREATE TABLE care_records (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       member_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       kind VARCHAR(20) NOT NULL CHECK (kind IN ('visit', 'call', 'follow_up')),
+                       visibility VARCHAR(20) NOT NULL DEFAULT 'team' CHECK (visibility IN ('team', 'restricted')),
+                       summary VARCHAR(255) NOT NULL,
+                       notes TEXT NOT NULL DEFAULT '',
+                       private_notes TEXT NOT NULL DEFAULT '',
+                       assigned_to INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       occurred_at TIMESTAMP,
+                       due_at TIMESTAMP,
+                       completed_at TIMESTAMP,
+                       reminded_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CONSTRAINT care_records_due_at_check CHECK (kind <> 'follow_up' OR due_at IS NOT NULL)
+);
+
+CREATE INDEX idx_care_records_member_id ON care_records (member_id, created_at DESC);
+CREATE INDEX idx_care_records_assigned_to ON care_records (assigned_to);
+CREATE INDEX idx_care_records_overdue ON care_records (due_at) WHERE kind = 'follow_up' AND completed_at IS NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS care_records;
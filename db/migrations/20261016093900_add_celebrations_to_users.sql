@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Optional birthdays and anniversaries. Staff only see them, without the
+-- birth year, when the member chose to share them.
+ALTER TABLE users
+    ADD COLUMN birthday DATE,
+    ADD COLUMN anniversary DATE,
+    ADD COLUMN share_celebrations BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_users_share_celebrations ON users (id) WHERE share_celebrations;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_users_share_celebrations;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS share_celebrations,
+    DROP COLUMN IF EXISTS anniversary,
+    DROP COLUMN IF EXISTS birthday;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Every consent given or withdrawn, kept as evidence of when and how.
+CREATE TABLE consent_records (
+                       id BIGSERIAL PRIMARY KEY,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       purpose VARCHAR(30) NOT NULL,
+                       granted BOOLEAN NOT NULL,
+                       source VARCHAR(20) NOT NULL CHECK (source IN ('user', 'staff')),
+                       ip_address VARCHAR(45) NOT NULL DEFAULT '',
+                       user_agent VARCHAR(255) NOT NULL DEFAULT '',
+                       recorded_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_consent_records_user_id ON consent_records (user_id, recorded_at DESC);
+
+-- The current answer per purpose. Purposes without a row have their
+-- default, see models.ConsentPurposes.
+CREATE TABLE user_consents (
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       purpose VARCHAR(30) NOT NULL,
+                       granted BOOLEAN NOT NULL,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (user_id, purpose)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS user_consents;
+DROP TABLE IF EXISTS consent_records;
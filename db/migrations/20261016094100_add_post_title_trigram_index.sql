@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Serves GET /posts/suggest: substring and fuzzy matches on titles.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_posts_title_trgm ON posts USING gin (lower(title) gin_trgm_ops)
+    WHERE status = 'published' AND deleted_at IS NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_posts_title_trgm;
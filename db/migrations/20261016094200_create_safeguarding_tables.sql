@@ -0,0 +1,64 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Users appointed by an admin to handle safeguarding reports. Nobody else,
+-- admins included, can read them.
+CREATE TABLE safeguarding_officers (
+                       user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+                       appointed_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       appointed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The people involved and what happened are sealed in content with
+-- SAFEGUARDING_ENCRYPTION_KEY; only the fields needed to triage are plain.
+CREATE TABLE safeguarding_reports (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       category VARCHAR(20) NOT NULL CHECK (category IN ('abuse', 'neglect', 'self_harm', 'bullying', 'online', 'other')),
+                       status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'investigating', 'closed')),
+                       content BYTEA NOT NULL,
+                       reported_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       occurred_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_safeguarding_reports_status ON safeguarding_reports (status, created_at DESC);
+
+-- Every access to the reports. Rows keep their user and report IDs after
+-- either is deleted, and cannot be changed or removed.
+CREATE TABLE safeguarding_audit_log (
+                       id BIGSERIAL PRIMARY KEY,
+                       report_id UUID,
+                       user_id INTEGER NOT NULL,
+                       action VARCHAR(20) NOT NULL,
+                       reason TEXT NOT NULL DEFAULT '',
+                       ip_address VARCHAR(45) NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_safeguarding_audit_log_report_id ON safeguarding_audit_log (report_id, created_at DESC);
+CREATE INDEX idx_safeguarding_audit_log_user_id ON safeguarding_audit_log (user_id, created_at DESC);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION safeguarding_audit_log_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'safeguarding_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER safeguarding_audit_log_immutable
+    BEFORE UPDATE OR DELETE ON safeguarding_audit_log
+    FOR EACH ROW EXECUTE FUNCTION safeguarding_audit_log_immutable();
+
+CREATE TRIGGER safeguarding_audit_log_no_truncate
+    BEFORE TRUNCATE ON safeguarding_audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION safeguarding_audit_log_immutable();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS safeguarding_audit_log;
+DROP FUNCTION IF EXISTS safeguarding_audit_log_immutable();
+DROP TABLE IF EXISTS safeguarding_reports;
+DROP TABLE IF EXISTS safeguarding_officers;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Views per post and day, added by FlushPostViews, for trending scores.
+-- Days older than the trending window are purged by RefreshTrendingPosts.
+CREATE TABLE post_view_days (
+                       post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+                       day DATE NOT NULL,
+                       views INTEGER NOT NULL DEFAULT 0,
+                       PRIMARY KEY (post_id, day)
+);
+
+CREATE INDEX idx_post_view_days_day ON post_view_days (day);
+
+-- Reactions of signed-in readers, one of each kind per reader and post.
+CREATE TABLE post_reactions (
+                       post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       reaction VARCHAR(20) NOT NULL CHECK (reaction IN ('like', 'love', 'pray', 'amen')),
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (post_id, user_id, reaction)
+);
+
+CREATE INDEX idx_post_reactions_created_at ON post_reactions (created_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS post_reactions;
+DROP TABLE IF EXISTS post_view_days;
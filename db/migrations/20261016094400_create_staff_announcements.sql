@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Announcements to staff. Critical ones must be acknowledged by every staff
+-- member; those who have not are reminded by email until they do.
+CREATE TABLE staff_announcements (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL,
+                       body TEXT NOT NULL,
+                       critical BOOLEAN NOT NULL DEFAULT FALSE,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       reminded_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_staff_announcements_created_at ON staff_announcements (created_at DESC);
+
+CREATE TABLE staff_announcement_acknowledgements (
+                       announcement_id UUID NOT NULL REFERENCES staff_announcements (id) ON DELETE CASCADE,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       acknowledged_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (announcement_id, user_id)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS staff_announcement_acknowledgements;
+DROP TABLE IF EXISTS staff_announcements;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- updated_at is when a post's content last changed. It is set by the
+-- trigger, not by the API, and only for writes of content columns, so
+-- view counts and trashing do not move it. Existing posts start from their
+-- last tracked change.
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE posts p SET updated_at = COALESCE(
+    (SELECT c.changed_at FROM content_changes c WHERE c.entity = 'posts' AND c.entity_id = p.id),
+    p.created_at);
+
+CREATE TRIGGER posts_touch BEFORE UPDATE OF title, excerpt, body, status, slug,
+    cover_image_url, meta_title, meta_description, canonical_url ON posts
+    FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+-- created_at is when the post was created and never changes.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION keep_created_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.created_at := OLD.created_at;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER posts_keep_created_at BEFORE UPDATE OF created_at ON posts
+    FOR EACH ROW EXECUTE FUNCTION keep_created_at();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS posts_keep_created_at ON posts;
+DROP FUNCTION IF EXISTS keep_created_at();
+DROP TRIGGER IF EXISTS posts_touch ON posts;
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Members' requests to correct their stored data. Admins review them and
+-- either apply the proposed value or reject the request. applied_over is the
+-- value the correction replaced, kept as a record of the change.
+CREATE TABLE data_correction_requests (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       field VARCHAR(50) NOT NULL,
+                       value_at_request TEXT NOT NULL,
+                       proposed_value TEXT NOT NULL,
+                       reason TEXT NOT NULL DEFAULT '',
+                       status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'applied', 'rejected')),
+                       review_note TEXT NOT NULL DEFAULT '',
+                       applied_over TEXT,
+                       reviewed_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       reviewed_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One open request per member and field.
+CREATE UNIQUE INDEX idx_data_correction_requests_pending ON data_correction_requests (user_id, field) WHERE status = 'pending';
+CREATE INDEX idx_data_correction_requests_status ON data_correction_requests (status, created_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS data_correction_requests;
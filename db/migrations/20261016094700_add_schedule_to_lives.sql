@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Existing lives were posted when the stream began; they are taken to have
+-- run for two hours, so they all show as ended.
+ALTER TABLE lives
+    ADD COLUMN description TEXT NOT NULL DEFAULT '' CHECK (char_length(description) <= 1000),
+    ADD COLUMN starts_at TIMESTAMP,
+    ADD COLUMN ends_at TIMESTAMP;
+
+UPDATE lives SET starts_at = created_at, ends_at = created_at + INTERVAL '2 hours';
+
+ALTER TABLE lives
+    ALTER COLUMN starts_at SET NOT NULL,
+    ALTER COLUMN ends_at SET NOT NULL,
+    ADD CONSTRAINT lives_schedule_check CHECK (starts_at < ends_at);
+
+CREATE INDEX idx_lives_starts_at ON lives (starts_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_lives_starts_at;
+
+ALTER TABLE lives
+    DROP CONSTRAINT IF EXISTS lives_schedule_check,
+    DROP COLUMN IF EXISTS ends_at,
+    DROP COLUMN IF EXISTS starts_at,
+    DROP COLUMN IF EXISTS description;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Past services are browsed by preacher, matched without regard to case.
+ALTER TABLE lives
+    ADD COLUMN speaker VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN series_id UUID REFERENCES series (id) ON DELETE SET NULL,
+    ADD COLUMN passage VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_lives_speaker ON lives (lower(speaker)) WHERE speaker <> '';
+CREATE INDEX idx_lives_series_id ON lives (series_id) WHERE series_id IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_lives_series_id;
+DROP INDEX IF EXISTS idx_lives_speaker;
+
+ALTER TABLE lives
+    DROP COLUMN IF EXISTS passage,
+    DROP COLUMN IF EXISTS series_id,
+    DROP COLUMN IF EXISTS speaker;
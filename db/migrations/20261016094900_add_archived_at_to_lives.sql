@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Lives are archived by a background job some time after they end. Archived
+-- lives leave the main list for the paginated archive.
+ALTER TABLE lives ADD COLUMN archived_at TIMESTAMP;
+
+CREATE INDEX idx_lives_archived ON lives (starts_at DESC) WHERE archived_at IS NOT NULL;
+CREATE INDEX idx_lives_unarchived_ends_at ON lives (ends_at) WHERE archived_at IS NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_lives_unarchived_ends_at;
+DROP INDEX IF EXISTS idx_lives_archived;
+
+ALTER TABLE lives DROP COLUMN IF EXISTS archived_at;
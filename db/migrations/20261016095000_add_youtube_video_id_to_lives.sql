@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The YouTube broadcast a live was created from or matched to by the sync.
+ALTER TABLE lives ADD COLUMN youtube_video_id VARCHAR(20) UNIQUE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE lives DROP COLUMN IF EXISTS youtube_video_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Short codes for sharing a live over WhatsApp and SMS. A live has at most
+-- one, so every share of it is counted together.
+CREATE TABLE live_short_links (
+                       code VARCHAR(16) PRIMARY KEY,
+                       live_id UUID NOT NULL UNIQUE REFERENCES lives (id) ON DELETE CASCADE,
+                       clicks BIGINT NOT NULL DEFAULT 0,
+                       created_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS live_short_links;
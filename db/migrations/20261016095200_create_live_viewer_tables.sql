@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Viewers counted from player heartbeats. Redis holds the live counts; these
+-- tables keep them for reports once the Redis keys expire.
+CREATE TABLE live_viewer_minutes (
+                       live_id UUID NOT NULL REFERENCES lives (id) ON DELETE CASCADE,
+                       minute TIMESTAMP NOT NULL,
+                       viewers INTEGER NOT NULL CHECK (viewers >= 0),
+                       PRIMARY KEY (live_id, minute)
+);
+
+CREATE TABLE live_viewer_totals (
+                       live_id UUID PRIMARY KEY REFERENCES lives (id) ON DELETE CASCADE,
+                       unique_viewers INTEGER NOT NULL CHECK (unique_viewers >= 0),
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS live_viewer_totals;
+DROP TABLE IF EXISTS live_viewer_minutes;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Services are streamed to several platforms at once, so a live holds an
+-- array of {platform, url, primary} links instead of a single link.
+ALTER TABLE lives
+    ADD COLUMN links JSONB NOT NULL DEFAULT '[]';
+
+UPDATE lives SET links = jsonb_build_array(jsonb_build_object(
+    'platform', CASE
+        WHEN link ~* '^https?://([^/?#]*\.)?(youtube\.com|youtu\.be)([:/?#]|$)' THEN 'youtube'
+        WHEN link ~* '^https?://([^/?#]*\.)?(facebook\.com|fb\.watch)([:/?#]|$)' THEN 'facebook'
+        WHEN link ~* '^https?://([^/?#]*\.)?vimeo\.com([:/?#]|$)' THEN 'vimeo'
+        WHEN link ~* '^https?://([^/?#]*\.)?twitch\.tv([:/?#]|$)' THEN 'twitch'
+        ELSE 'other'
+    END,
+    'url', link,
+    'primary', true));
+
+ALTER TABLE lives
+    ALTER COLUMN links DROP DEFAULT,
+    ADD CONSTRAINT lives_links_check CHECK (jsonb_typeof(links) = 'array' AND jsonb_array_length(links) > 0),
+    DROP CONSTRAINT IF EXISTS lives_link_check,
+    DROP COLUMN link;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE lives
+    ADD COLUMN link VARCHAR(255);
+
+UPDATE lives SET link = (
+    SELECT l->>'url' FROM jsonb_array_elements(links) l
+    ORDER BY (l->>'primary')::boolean DESC LIMIT 1);
+
+ALTER TABLE lives
+    ALTER COLUMN link SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS lives_links_check,
+    DROP COLUMN links;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Church events, such as conferences and prayer nights, that are neither
+-- streamed nor written up. A recurring event repeats from starts_at/ends_at;
+-- last_ends_at is the end of its last occurrence, NULL while it repeats
+-- forever, so that upcoming and past events can be told apart in SQL.
+CREATE TABLE events (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL CHECK (btrim(title) <> ''),
+                       description TEXT NOT NULL DEFAULT '',
+                       location VARCHAR(255) NOT NULL DEFAULT '',
+                       starts_at TIMESTAMP NOT NULL,
+                       ends_at TIMESTAMP NOT NULL,
+                       registration_required BOOLEAN NOT NULL DEFAULT FALSE,
+                       registration_url VARCHAR(255) NOT NULL DEFAULT '',
+                       recurrence_frequency VARCHAR(10) CHECK (recurrence_frequency IN ('daily', 'weekly', 'monthly')),
+                       recurrence_interval INTEGER NOT NULL DEFAULT 1 CHECK (recurrence_interval > 0),
+                       recurrence_count INTEGER CHECK (recurrence_count > 0),
+                       recurrence_until TIMESTAMP,
+                       last_ends_at TIMESTAMP,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CHECK (starts_at < ends_at),
+                       CHECK (recurrence_frequency IS NOT NULL OR last_ends_at = ends_at)
+);
+
+CREATE INDEX idx_events_starts_at ON events (starts_at);
+CREATE INDEX idx_events_last_ends_at ON events (last_ends_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS events;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Sermons as preached, with their recordings. books holds the books of
+-- scripture_references, derived on write, so that sermons can be found by
+-- book however the references were typed.
+CREATE TABLE sermons (
+                       id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                       title VARCHAR(255) NOT NULL CHECK (btrim(title) <> ''),
+                       description TEXT NOT NULL DEFAULT '',
+                       speaker VARCHAR(100) NOT NULL DEFAULT '',
+                       series_id UUID REFERENCES series (id) ON DELETE SET NULL,
+                       preached_on DATE NOT NULL,
+                       audio_url VARCHAR(255) NOT NULL DEFAULT '',
+                       video_url VARCHAR(255) NOT NULL DEFAULT '',
+                       duration_seconds INTEGER NOT NULL DEFAULT 0 CHECK (duration_seconds >= 0),
+                       scripture_references TEXT[] NOT NULL DEFAULT '{}',
+                       books TEXT[] NOT NULL DEFAULT '{}',
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       CHECK (audio_url <> '' OR video_url <> '')
+);
+
+CREATE INDEX idx_sermons_preached_on ON sermons (preached_on);
+CREATE INDEX idx_sermons_speaker ON sermons (lower(speaker));
+CREATE INDEX idx_sermons_series_id ON sermons (series_id) WHERE series_id IS NOT NULL;
+CREATE INDEX idx_sermons_books ON sermons USING GIN (books);
+
+CREATE TRIGGER sermons_content_change AFTER INSERT OR UPDATE OR DELETE ON sermons
+    FOR EACH ROW EXECUTE FUNCTION record_content_change();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER IF EXISTS sermons_content_change ON sermons;
+DELETE FROM content_changes WHERE entity = 'sermons';
+DROP TABLE IF EXISTS sermons;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Online gifts are paid through a payment provider, which reports back by
+-- webhook under its own reference, such as a Stripe PaymentIntent ID. Kiosk
+-- gifts have no provider.
+ALTER TABLE donations
+    ADD COLUMN provider VARCHAR(20);
+
+CREATE UNIQUE INDEX idx_donations_provider_reference ON donations (provider, reference)
+    WHERE provider IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_donations_provider_reference;
+ALTER TABLE donations
+    DROP COLUMN IF EXISTS provider;
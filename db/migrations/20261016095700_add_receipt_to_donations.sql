@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- M-Pesa confirms a payment with a receipt number, which is what donors and
+-- the treasurer see on statements. A receipt is recorded once.
+ALTER TABLE donations
+    ADD COLUMN receipt VARCHAR(100);
+
+CREATE UNIQUE INDEX idx_donations_provider_receipt ON donations (provider, receipt)
+    WHERE receipt IS NOT NULL;
+
+-- Pending online gifts are reconciled with their provider when no callback
+-- arrives.
+CREATE INDEX idx_donations_pending ON donations (provider, recorded_at)
+    WHERE status = 'pending' AND provider IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS idx_donations_pending;
+DROP INDEX IF EXISTS idx_donations_provider_receipt;
+ALTER TABLE donations
+    DROP COLUMN IF EXISTS receipt;
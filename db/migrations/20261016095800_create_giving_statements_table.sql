@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Year-end giving statements, rendered by the job queue into the media
+-- library and downloaded through signed URLs.
+CREATE TABLE giving_statements (
+                       id UUID PRIMARY KEY,
+                       user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       year INTEGER NOT NULL,
+                       status VARCHAR(20) NOT NULL DEFAULT 'pending'
+                           CHECK (status IN ('pending', 'ready', 'failed')),
+                       media_id UUID REFERENCES media_items (id) ON DELETE SET NULL,
+                       requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       generated_at TIMESTAMP,
+                       UNIQUE (user_id, year)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS giving_statements;
@@ -0,0 +1,50 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Holds every entry of lives.links to what lives_link_check required of the
+-- single link it replaced, matching validation.ValidateLives: an http(s) URL
+-- of at most 255 characters on a known platform, with exactly one primary.
+-- The CASE keeps non-arrays away from jsonb_array_elements.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION live_links_valid(links JSONB) RETURNS BOOLEAN
+    LANGUAGE SQL IMMUTABLE AS $$
+    SELECT CASE WHEN jsonb_typeof(links) <> 'array' THEN FALSE ELSE
+        jsonb_array_length(links) BETWEEN 1 AND 10
+        AND NOT EXISTS (
+            SELECT 1 FROM jsonb_array_elements(links) l
+            WHERE jsonb_typeof(l) <> 'object'
+               OR jsonb_typeof(l->'url') IS DISTINCT FROM 'string'
+               OR NOT (l->>'url' ~ '^https?://[^[:space:]]+$')
+               OR char_length(l->>'url') > 255
+               OR l->>'platform' IS NULL
+               OR l->>'platform' NOT IN ('youtube', 'facebook', 'vimeo', 'twitch', 'other')
+               OR jsonb_typeof(l->'primary') IS DISTINCT FROM 'boolean')
+        AND (SELECT count(*) FROM jsonb_array_elements(links) l WHERE l->'primary' = 'true'::jsonb) = 1
+    END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE lives
+    DROP CONSTRAINT IF EXISTS lives_links_check,
+    ADD CONSTRAINT lives_links_check CHECK (live_links_valid(links)) NOT VALID;
+
+-- As with the other content constraints, rows that break it keep it NOT
+-- VALID until they are fixed and it is validated by hand.
+-- +goose StatementBegin
+DO $$
+BEGIN
+    ALTER TABLE lives VALIDATE CONSTRAINT lives_links_check;
+EXCEPTION WHEN check_violation THEN
+    RAISE NOTICE 'Constraint lives_links_check on lives is violated by existing rows and left NOT VALID';
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE lives
+    DROP CONSTRAINT IF EXISTS lives_links_check,
+    ADD CONSTRAINT lives_links_check CHECK (jsonb_typeof(links) = 'array' AND jsonb_array_length(links) > 0);
+
+DROP FUNCTION IF EXISTS live_links_valid(JSONB);
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Roles are compared exactly by StaffOnly and AdminOnly, so a role such as
+-- 'Admin' would silently deny access. Roles typed by hand are normalized;
+-- anything else falls back to the least privileged role.
+UPDATE users SET role = lower(btrim(role)) WHERE role <> lower(btrim(role));
+UPDATE users SET role = 'member' WHERE role NOT IN ('member', 'staff', 'admin');
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_check CHECK (role IN ('member', 'staff', 'admin'));
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_role_check;
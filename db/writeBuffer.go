@@ -0,0 +1,282 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// writeBufferPrefix is the prefix of the Redis lists that hold buffered rows.
+const writeBufferPrefix = "write_buffer:"
+
+// writeBufferBatch is the most rows a flush copies in one transaction.
+const writeBufferBatch = 1000
+
+// writeBufferClaimTimeout is how long a claimed batch may stay unflushed,
+// e.g. because its instance stopped, before another flush copies it.
+const writeBufferClaimTimeout = 10 * time.Minute
+
+// claimWriteBufferBatch moves up to ARGV[1] rows from the head of a buffer
+// (KEYS[1]) into a claim list (KEYS[2]) and records the claim at ARGV[2] in
+// the buffer's claims (KEYS[3]), all at once, so that concurrent flushes
+// never copy the same rows.
+var claimWriteBufferBatch = redis.NewScript(`
+local rows = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+if #rows > 0 then
+	redis.call('LTRIM', KEYS[1], #rows, -1)
+	redis.call('RPUSH', KEYS[2], unpack(rows))
+	redis.call('ZADD', KEYS[3], ARGV[2], KEYS[2])
+end
+return rows`)
+
+// WriteBuffer collects rows of a high-frequency, append-only table, such as
+// an audit log, in Redis so that requests do not wait for the INSERT.
+// FlushWriteBuffers copies them into Postgres in batches. Buffered rows are
+// not visible to queries until they are flushed.
+type WriteBuffer struct {
+	table   string
+	columns []string
+}
+
+var writeBuffers []*WriteBuffer
+
+// NewWriteBuffer registers a buffer for table. Rows are added with values in
+// the order of columns.
+func NewWriteBuffer(table string, columns ...string) *WriteBuffer {
+	buffer := &WriteBuffer{table: table, columns: columns}
+	writeBuffers = append(writeBuffers, buffer)
+	return buffer
+}
+
+// Add buffers a row. When Redis is unavailable the row is inserted directly,
+// so it is only lost when Postgres fails as well. Time values are stored
+// with their offset, like database/sql would send them.
+func (b *WriteBuffer) Add(ctx context.Context, values ...interface{}) error {
+	if len(values) != len(b.columns) {
+		return fmt.Errorf("%s: got %d values for %d columns", b.table, len(values), len(b.columns))
+	}
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			values[i] = t.Format(time.RFC3339Nano)
+		}
+	}
+
+	row, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("error encoding %s row: %w", b.table, err)
+	}
+	if err := RedisClient.RPush(ctx, writeBufferPrefix+b.table, row).Err(); err != nil {
+		log.Printf("Failed to buffer %s row, inserting it directly: %v", b.table, err)
+		return b.insert(ctx, values)
+	}
+	return nil
+}
+
+// FlushWriteBuffers copies every buffered row into Postgres. Each batch is
+// claimed before it is copied, so flushes may overlap, e.g. at shutdown or on
+// several instances. A claim is only dropped after its batch is committed,
+// so a crash in between may copy a batch twice but never loses it. A batch
+// that cannot be written, e.g. while Postgres is down, stays claimed and is
+// retried after writeBufferClaimTimeout.
+func FlushWriteBuffers(ctx context.Context) error {
+	var errs []error
+	for _, buffer := range writeBuffers {
+		if err := buffer.flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *WriteBuffer) flush(ctx context.Context) error {
+	key := writeBufferPrefix + b.table
+	claimsKey := writeBufferPrefix + "claims:" + b.table
+	if err := b.recoverClaims(ctx, claimsKey); err != nil {
+		return err
+	}
+	for {
+		claimKey := writeBufferPrefix + "claim:" + b.table + ":" + uuid.NewString()
+		rows, err := claimWriteBufferBatch.Run(ctx, RedisClient, []string{key, claimKey, claimsKey},
+			writeBufferBatch, time.Now().Unix()).StringSlice()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("error claiming buffered %s rows: %w", b.table, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		if err := b.copyRows(ctx, rows); err != nil {
+			return err
+		}
+		if err := b.releaseClaim(ctx, claimsKey, claimKey); err != nil {
+			return err
+		}
+		if len(rows) < writeBufferBatch {
+			return nil
+		}
+	}
+}
+
+// recoverClaims copies the batches of flushes that did not finish in time.
+// Only the flush that removes a claim from claimsKey copies its rows.
+func (b *WriteBuffer) recoverClaims(ctx context.Context, claimsKey string) error {
+	stale, err := RedisClient.ZRangeByScore(ctx, claimsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprint(time.Now().Add(-writeBufferClaimTimeout).Unix()),
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("error reading %s claims: %w", b.table, err)
+	}
+	for _, claimKey := range stale {
+		removed, err := RedisClient.ZRem(ctx, claimsKey, claimKey).Result()
+		if err != nil {
+			return fmt.Errorf("error taking over %s claim: %w", b.table, err)
+		}
+		if removed == 0 {
+			continue
+		}
+		rows, err := RedisClient.LRange(ctx, claimKey, 0, -1).Result()
+		if err != nil {
+			return fmt.Errorf("error reading claimed %s rows: %w", b.table, err)
+		}
+		log.Printf("Recovering %d %s rows of an unfinished flush", len(rows), b.table)
+		if err := b.copyRows(ctx, rows); err != nil {
+			// Claim the batch again, so that it is retried later.
+			if err := RedisClient.ZAdd(ctx, claimsKey, &redis.Z{Score: float64(time.Now().Unix()), Member: claimKey}).Err(); err != nil {
+				log.Printf("Failed to keep unfinished %s claim %s: %v", b.table, claimKey, err)
+			}
+			return err
+		}
+		if err := RedisClient.Del(ctx, claimKey).Err(); err != nil {
+			return fmt.Errorf("error removing flushed %s rows: %w", b.table, err)
+		}
+	}
+	return nil
+}
+
+// releaseClaim drops a claimed batch once it is copied.
+func (b *WriteBuffer) releaseClaim(ctx context.Context, claimsKey, claimKey string) error {
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, claimKey)
+		pipe.ZRem(ctx, claimsKey, claimKey)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error removing flushed %s rows: %w", b.table, err)
+	}
+	return nil
+}
+
+// copyRows copies buffered rows into the table, dropping the ones that
+// cannot be decoded or that Postgres rejects. Any other failure is returned,
+// and rows inserted before it may be copied again on the retry.
+func (b *WriteBuffer) copyRows(ctx context.Context, rows []string) error {
+	batch := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		values, err := decodeBufferedRow(row)
+		if err != nil || len(values) != len(b.columns) {
+			log.Printf("Dropping malformed buffered %s row %s", b.table, row)
+			continue
+		}
+		batch = append(batch, values)
+	}
+
+	err := b.copyBatch(ctx, batch)
+	if err == nil {
+		return nil
+	}
+	if !isRowError(err) {
+		return fmt.Errorf("error copying buffered %s rows: %w", b.table, err)
+	}
+
+	// One bad row, e.g. for a user deleted in the meantime, fails the
+	// whole COPY; insert row by row and skip the ones that are rejected.
+	log.Printf("Failed to copy %d %s rows, inserting them one by one: %v", len(batch), b.table, err)
+	for _, values := range batch {
+		err := b.insert(ctx, values)
+		if isRowError(err) {
+			log.Printf("Dropping buffered %s row: %v", b.table, err)
+		} else if err != nil {
+			return fmt.Errorf("error inserting buffered %s row: %w", b.table, err)
+		}
+	}
+	return nil
+}
+
+// isRowError reports whether Postgres rejected a row for its data, with a
+// data exception (class 22) or an integrity violation (class 23), rather
+// than failing to write anything.
+func isRowError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Class() {
+	case "22", "23":
+		return true
+	}
+	return false
+}
+
+// decodeBufferedRow decodes a row keeping numbers as written, so that large
+// IDs do not lose precision.
+func decodeBufferedRow(row string) ([]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(row)))
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if number, ok := value.(json.Number); ok {
+			values[i] = number.String()
+		}
+	}
+	return values, nil
+}
+
+func (b *WriteBuffer) copyBatch(ctx context.Context, batch [][]interface{}) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(b.table, b.columns...))
+	if err != nil {
+		return err
+	}
+	for _, values := range batch {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (b *WriteBuffer) insert(ctx context.Context, values []interface{}) error {
+	placeholders := make([]string, len(b.columns))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	_, err := DB.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		pq.QuoteIdentifier(b.table), strings.Join(b.columns, ", "), strings.Join(placeholders, ", ")), values...)
+	return err
+}
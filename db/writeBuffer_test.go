@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// mockDB replaces DB with a mock for the duration of the test and checks
+// that every expected statement ran.
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	previous := DB
+	DB = conn
+	t.Cleanup(func() {
+		DB = previous
+		conn.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet database expectations: %v", err)
+		}
+	})
+	return mock
+}
+
+func TestCopyRowsKeepsBatchWhenPostgresFails(t *testing.T) {
+	mock := mockDB(t)
+	refused := errors.New("dial tcp: connection refused")
+	mock.ExpectBegin().WillReturnError(refused)
+
+	buffer := &WriteBuffer{table: "auth_events", columns: []string{"user_id", "event"}}
+	if err := buffer.copyRows(context.Background(), []string{`[7,"login"]`}); !errors.Is(err, refused) {
+		t.Fatalf("copyRows() = %v, want %v", err, refused)
+	}
+}
+
+func TestCopyRowsDropsRejectedRows(t *testing.T) {
+	mock := mockDB(t)
+	fkViolation := &pq.Error{Code: "23503"}
+	mock.ExpectBegin()
+	mock.ExpectPrepare("COPY").ExpectExec().WillReturnError(fkViolation)
+	mock.ExpectRollback()
+	mock.ExpectExec("INSERT INTO").WithArgs("7", "login").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO").WithArgs("8", "login").WillReturnError(fkViolation)
+
+	buffer := &WriteBuffer{table: "auth_events", columns: []string{"user_id", "event"}}
+	if err := buffer.copyRows(context.Background(), []string{`[7,"login"]`, `[8,"login"]`, `not json`}); err != nil {
+		t.Fatalf("copyRows() = %v, want nil", err)
+	}
+}
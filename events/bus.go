@@ -0,0 +1,187 @@
+// Package events is the change feed of published content. Changes are
+// appended to a Redis stream, so every API instance sees them in the same
+// order and stream IDs serve as cursors for the SSE and long-poll endpoints.
+package events
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	streamKey = "updates"
+	// maxStreamLength bounds the stream. Clients whose cursor has been
+	// trimmed away are told to reload everything.
+	maxStreamLength = 10000
+)
+
+// Event types and actions.
+const (
+	TypePost   = "post"
+	TypeLive   = "live"
+	TypeSermon = "sermon"
+
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// ErrCursorExpired is returned for cursors older than the retained events.
+var ErrCursorExpired = errors.New("cursor is older than the retained events")
+
+// Event is a change to a piece of content. Clients fetch the content itself
+// from its endpoint.
+type Event struct {
+	Cursor string    `json:"cursor"`
+	Type   string    `json:"type"`
+	Action string    `json:"action"`
+	ID     string    `json:"id"`
+	At     time.Time `json:"at"`
+}
+
+// Publish appends a change to the feed. Failures are logged rather than
+// returned: the change itself has already been saved, and clients catch up
+// on their next full reload.
+func Publish(ctx context.Context, eventType, action, id string) {
+	data, err := json.Marshal(Event{Type: eventType, Action: action, ID: id, At: time.Now().UTC()})
+	if err == nil {
+		err = db.RedisClient.XAdd(context.WithoutCancel(ctx), &redis.XAddArgs{
+			Stream: streamKey,
+			MaxLen: maxStreamLength,
+			Approx: true,
+			Values: map[string]interface{}{"event": data},
+		}).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s %s event for %s: %v", eventType, action, id, err)
+	}
+}
+
+// Latest returns the cursor of the newest event, which clients start from.
+func Latest(ctx context.Context) (string, error) {
+	entries, err := db.RedisClient.XRevRangeN(ctx, streamKey, "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("error reading update stream: %w", err)
+	}
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+	return entries[0].ID, nil
+}
+
+// Since returns up to limit events after cursor, oldest first.
+func Since(ctx context.Context, cursor string, limit int64) ([]Event, error) {
+	if cursor != "0-0" {
+		oldest, err := db.RedisClient.XRangeN(ctx, streamKey, "-", "+", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error reading update stream: %w", err)
+		}
+		if len(oldest) > 0 && compareIDs(cursor, oldest[0].ID) < 0 {
+			return nil, ErrCursorExpired
+		}
+	}
+
+	entries, err := db.RedisClient.XRangeN(ctx, streamKey, "("+cursor, "+", limit).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading update stream: %w", err)
+	}
+
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		data, _ := entry.Values["event"].(string)
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		event.Cursor = entry.ID
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+var (
+	mu      sync.Mutex
+	changed = make(chan struct{})
+)
+
+// Changed returns a channel that is closed when the next event is published.
+func Changed() <-chan struct{} {
+	mu.Lock()
+	defer mu.Unlock()
+	return changed
+}
+
+func notify() {
+	mu.Lock()
+	close(changed)
+	changed = make(chan struct{})
+	mu.Unlock()
+}
+
+// Start watches the stream for new events until ctx is cancelled, waking
+// waiters on this instance. One blocking read per instance serves every
+// waiting client, so they do not each hold a Redis connection.
+func Start(ctx context.Context) {
+	go func() {
+		last := "$"
+		for ctx.Err() == nil {
+			streams, err := db.RedisClient.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{streamKey, last},
+				Block:   30 * time.Second,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Update stream: read failed: %v", err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			for _, stream := range streams {
+				if n := len(stream.Messages); n > 0 {
+					last = stream.Messages[n-1].ID
+				}
+			}
+			notify()
+		}
+	}()
+}
+
+// ValidCursor reports whether cursor has the form of a stream ID.
+func ValidCursor(cursor string) bool {
+	_, _, ok := parseID(cursor)
+	return ok
+}
+
+func parseID(id string) (ms, seq uint64, ok bool) {
+	msStr, seqStr, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err1 := strconv.ParseUint(msStr, 10, 64)
+	seq, err2 := strconv.ParseUint(seqStr, 10, 64)
+	return ms, seq, err1 == nil && err2 == nil
+}
+
+// compareIDs orders Redis stream IDs ("<ms>-<seq>").
+func compareIDs(a, b string) int {
+	aMs, aSeq, _ := parseID(a)
+	bMs, bSeq, _ := parseID(b)
+	if c := cmp.Compare(aMs, bMs); c != 0 {
+		return c
+	}
+	return cmp.Compare(aSeq, bSeq)
+}
@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	// DefaultMaxAttempts is how often a job is tried before it is marked failed.
+	DefaultMaxAttempts = 5
+	pollInterval       = 2 * time.Second
+	// staleAfter is how long a job may stay running before it is assumed to
+	// belong to a crashed instance and is picked up again.
+	staleAfter  = 10 * time.Minute
+	taskTimeout = 5 * time.Minute
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Task is a queued unit of work, stored in the jobs table so that it survives
+// restarts and can be processed by any API instance.
+type Task struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   *string         `json:"last_error"`
+	Result      json.RawMessage `json:"result"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// LastAttempt reports whether a failure of the current run is final.
+func (t *Task) LastAttempt() bool {
+	return t.Attempts >= t.MaxAttempts
+}
+
+// Handler processes a task. The returned value is stored as the task's result.
+type Handler func(ctx context.Context, task *Task) (any, error)
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so tasks can be enqueued in the
+// same transaction as the change that needs them.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Enqueue adds a task to the queue.
+func Enqueue(ctx context.Context, exec Execer, taskType string, payload any) (uuid.UUID, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error encoding job payload: %w", err)
+	}
+
+	id := uuid.New()
+	_, err = exec.ExecContext(ctx, `INSERT INTO jobs (id, type, payload, max_attempts) VALUES ($1, $2, $3, $4)`,
+		id, taskType, data, DefaultMaxAttempts)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error enqueuing job: %w", err)
+	}
+	return id, nil
+}
+
+// GetTask returns a task by ID.
+func GetTask(ctx context.Context, id uuid.UUID) (*Task, error) {
+	var task Task
+	var result []byte
+	err := db.DB.QueryRowContext(ctx, `SELECT id, type, payload, status, attempts, max_attempts, last_error, result,
+			created_at, updated_at
+		FROM jobs WHERE id = $1`, id).
+		Scan(&task.ID, &task.Type, &task.Payload, &task.Status, &task.Attempts, &task.MaxAttempts, &task.LastError,
+			&result, &task.CreatedAt, &task.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	if result != nil {
+		task.Result = result
+	}
+	return &task, nil
+}
+
+// Queue runs workers that process tasks from the jobs table.
+type Queue struct {
+	workers  int
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+// NewQueue creates a queue that processes up to workers tasks at once.
+func NewQueue(workers int) *Queue {
+	return &Queue{workers: workers, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler for a task type.
+func (q *Queue) Handle(taskType string, handler Handler) {
+	q.handlers[taskType] = handler
+}
+
+// Start launches the workers. They stop when ctx is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	types := make([]string, 0, len(q.handlers))
+	for taskType := range q.handlers {
+		types = append(types, taskType)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx, types)
+		}()
+	}
+	log.Printf("Job queue started with %d workers", q.workers)
+}
+
+// Wait blocks until every worker has stopped.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context, types []string) {
+	for {
+		task, err := claimTask(ctx, types)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Job queue: failed to claim job: %v", err)
+		}
+
+		if task == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		q.run(ctx, task)
+	}
+}
+
+// claimTask marks the oldest runnable task as running and returns it, or nil
+// when there is nothing to do. SKIP LOCKED lets workers on every instance
+// claim tasks concurrently without blocking each other.
+func claimTask(ctx context.Context, types []string) (*Task, error) {
+	var task Task
+	err := db.DB.QueryRowContext(ctx, `UPDATE jobs SET status = 'running', attempts = attempts + 1, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE type = ANY($1)
+				AND ((status = 'queued' AND run_at <= NOW())
+					OR (status = 'running' AND updated_at < NOW() - $2 * INTERVAL '1 second'))
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, type, payload, status, attempts, max_attempts, created_at, updated_at`,
+		pq.Array(types), staleAfter.Seconds()).
+		Scan(&task.ID, &task.Type, &task.Payload, &task.Status, &task.Attempts, &task.MaxAttempts,
+			&task.CreatedAt, &task.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (q *Queue) run(ctx context.Context, task *Task) {
+	taskCtx, cancel := context.WithTimeout(ctx, taskTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := q.handlers[task.Type](taskCtx, task)
+
+	// Record the outcome even if the queue is shutting down.
+	saveCtx := context.WithoutCancel(ctx)
+	if err != nil {
+		status := StatusQueued
+		if task.LastAttempt() {
+			status = StatusFailed
+		}
+		// Back off quadratically: 10s, 40s, 90s, ...
+		backoff := time.Duration(task.Attempts*task.Attempts) * 10 * time.Second
+		_, dbErr := db.DB.ExecContext(saveCtx, `UPDATE jobs SET status = $1, last_error = $2, run_at = NOW() + $3 * INTERVAL '1 second',
+			updated_at = NOW() WHERE id = $4`, status, err.Error(), backoff.Seconds(), task.ID)
+		if dbErr != nil {
+			log.Printf("Job %s (%s): failed to record failure: %v", task.ID, task.Type, dbErr)
+		}
+		log.Printf("Job %s (%s) attempt %d/%d failed after %s: %v",
+			task.ID, task.Type, task.Attempts, task.MaxAttempts, time.Since(start), err)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		data = nil
+	}
+	_, dbErr := db.DB.ExecContext(saveCtx, `UPDATE jobs SET status = 'succeeded', result = $1, last_error = NULL, updated_at = NOW()
+		WHERE id = $2`, data, task.ID)
+	if dbErr != nil {
+		log.Printf("Job %s (%s): failed to record success: %v", task.ID, task.Type, dbErr)
+		return
+	}
+	log.Printf("Job %s (%s) completed in %s", task.ID, task.Type, time.Since(start))
+}
+
+// stuckFilter matches running jobs that have not been updated for longer
+// than a run may take, e.g. because their instance was killed. $1 optionally
+// narrows them to a task type.
+const stuckFilter = `status = 'running' AND updated_at < NOW() - $2 * INTERVAL '1 second' AND ($1 = '' OR type = $1)`
+
+// CountStuck returns how many jobs, of taskType if set, are stuck running.
+func CountStuck(ctx context.Context, taskType string) (int64, error) {
+	var count int64
+	err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs WHERE "+stuckFilter, taskType, taskTimeout.Seconds()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error querying database: %w", err)
+	}
+	return count, nil
+}
+
+// RequeueStuck queues the stuck jobs to run now instead of waiting for
+// workers to reclaim them. The attempt they were stuck in still counts.
+func RequeueStuck(ctx context.Context, taskType string) (int64, error) {
+	result, err := db.DB.ExecContext(ctx, "UPDATE jobs SET status = 'queued', run_at = NOW(), updated_at = NOW() WHERE "+stuckFilter,
+		taskType, taskTimeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error requeuing jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
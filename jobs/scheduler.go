@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"jsmi-api/db"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work run by the Scheduler.
+type Job func(ctx context.Context) error
+
+type scheduledJob struct {
+	name    string
+	timeout time.Duration
+	next    func(now time.Time) time.Time
+	run     Job
+}
+
+// Scheduler runs jobs on fixed intervals or at a time of day. When several API
+// instances run at once, a Redis lock on each scheduled slot makes sure the
+// slot runs only once.
+type Scheduler struct {
+	jobs []scheduledJob
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates an empty Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers a job that runs once per interval. Slots are aligned to
+// multiples of interval, so every instance schedules the same ones.
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	s.jobs = append(s.jobs, scheduledJob{
+		name:    name,
+		timeout: interval,
+		next: func(now time.Time) time.Time {
+			return now.Truncate(interval).Add(interval)
+		},
+		run: job,
+	})
+}
+
+// Daily registers a job that runs every day at hour:minute UTC.
+func (s *Scheduler) Daily(name string, hour, minute int, job Job) {
+	s.jobs = append(s.jobs, scheduledJob{
+		name:    name,
+		timeout: time.Hour,
+		next: func(now time.Time) time.Time {
+			now = now.UTC()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.UTC)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			return next
+		},
+		run: job,
+	})
+}
+
+// Weekly registers a job that runs every week on the given weekday at
+// hour:minute UTC.
+func (s *Scheduler) Weekly(name string, weekday time.Weekday, hour, minute int, job Job) {
+	s.jobs = append(s.jobs, scheduledJob{
+		name:    name,
+		timeout: time.Hour,
+		next: func(now time.Time) time.Time {
+			now = now.UTC()
+			days := (int(weekday) - int(now.Weekday()) + 7) % 7
+			next := time.Date(now.Year(), now.Month(), now.Day()+days, hour, minute, 0, 0, time.UTC)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 7)
+			}
+			return next
+		},
+		run: job,
+	})
+}
+
+// Monthly registers a job that runs on the given day of every month at
+// hour:minute UTC. day must be between 1 and 28 so that it exists in every month.
+func (s *Scheduler) Monthly(name string, day, hour, minute int, job Job) {
+	s.jobs = append(s.jobs, scheduledJob{
+		name:    name,
+		timeout: time.Hour,
+		next: func(now time.Time) time.Time {
+			now = now.UTC()
+			next := time.Date(now.Year(), now.Month(), day, hour, minute, 0, 0, time.UTC)
+			if !next.After(now) {
+				next = next.AddDate(0, 1, 0)
+			}
+			return next
+		},
+		run: job,
+	})
+}
+
+// Start launches all registered jobs. They stop when ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job scheduledJob) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	log.Printf("Scheduler started with %d jobs", len(s.jobs))
+}
+
+// Wait blocks until every job loop has stopped.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job scheduledJob) {
+	for {
+		slot := job.next(time.Now())
+		timer := time.NewTimer(time.Until(slot))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			job.runOnce(ctx, slot)
+		}
+	}
+}
+
+// runOnce runs the job for slot unless another instance already claimed the
+// slot. The claim is kept until the next slot rather than released when the
+// run ends, so an instance whose timer fires a little later does not run
+// the slot again.
+func (job scheduledJob) runOnce(ctx context.Context, slot time.Time) {
+	lockKey := fmt.Sprintf("job_lock:%s:%d", job.name, slot.Unix())
+	acquired, err := db.RedisClient.SetNX(ctx, lockKey, time.Now().Unix(), job.next(slot).Sub(slot)).Result()
+	if err != nil {
+		log.Printf("Job %s: failed to acquire lock: %v", job.name, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, job.timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := job.run(jobCtx); err != nil {
+		log.Printf("Job %s failed after %s: %v", job.name, time.Since(start), err)
+		return
+	}
+	log.Printf("Job %s completed in %s", job.name, time.Since(start))
+}
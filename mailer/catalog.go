@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TemplateParts are the blocks of a template, in the order they are
+// translated.
+var TemplateParts = []string{"subject", "text", "html"}
+
+// BuiltinContent returns the source of a built-in template's blocks.
+func BuiltinContent(name string) (Content, bool) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return Content{}, false
+	}
+	block := func(part string) string {
+		t := tmpl.text.Lookup(part)
+		if t == nil || t.Tree == nil {
+			return ""
+		}
+		return strings.TrimSpace(t.Tree.Root.String())
+	}
+	return Content{Subject: block("subject"), Text: block("text"), HTML: block("html")}, true
+}
+
+// Part returns the named block of c.
+func (c Content) Part(part string) string {
+	switch part {
+	case "subject":
+		return c.Subject
+	case "text":
+		return c.Text
+	case "html":
+		return c.HTML
+	}
+	return ""
+}
+
+// SetPart replaces the named block of c.
+func (c *Content) SetPart(part, source string) {
+	switch part {
+	case "subject":
+		c.Subject = source
+	case "text":
+		c.Text = source
+	case "html":
+		c.HTML = source
+	}
+}
+
+var actionRegex = regexp.MustCompile(`(?s){{-?\s*(.*?)\s*-?}}`)
+
+// placeholders returns the template actions of source ({{.Name}}, {{if ...}},
+// {{end}}, ...), sorted.
+func placeholders(source string) []string {
+	var actions []string
+	for _, match := range actionRegex.FindAllStringSubmatch(source, -1) {
+		actions = append(actions, match[1])
+	}
+	slices.Sort(actions)
+	return actions
+}
+
+// CheckPlaceholders checks that a translation uses exactly the template
+// actions of its source. They may be reordered, as the grammar of the target
+// language requires, but not added, dropped or edited.
+func CheckPlaceholders(source, translation string) error {
+	want, got := placeholders(source), placeholders(translation)
+	for _, action := range want {
+		if i := slices.Index(got, action); i >= 0 {
+			got = slices.Delete(got, i, i+1)
+		} else {
+			return fmt.Errorf("placeholder {{%s}} is missing", action)
+		}
+	}
+	if len(got) > 0 {
+		return fmt.Errorf("unknown placeholder {{%s}}", got[0])
+	}
+	return nil
+}
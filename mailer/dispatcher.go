@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize   = 256
+	maxAttempts = 3
+	sendTimeout = 30 * time.Second
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Dispatcher sends messages in the background so that request handlers never
+// wait on the mail server. Failed sends are retried with backoff.
+type Dispatcher struct {
+	mailer Mailer
+	queue  chan Message
+	wg     sync.WaitGroup
+}
+
+var defaultDispatcher *Dispatcher
+
+// Init loads the configured mailer and starts the default dispatcher.
+func Init(workers int) error {
+	m, err := LoadMailer()
+	if err != nil {
+		return err
+	}
+	defaultDispatcher = NewDispatcher(m, workers)
+	return nil
+}
+
+// NewDispatcher starts a dispatcher with the given number of workers.
+func NewDispatcher(m Mailer, workers int) *Dispatcher {
+	d := &Dispatcher{mailer: m, queue: make(chan Message, queueSize)}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Enqueue queues a message for delivery without blocking.
+func (d *Dispatcher) Enqueue(msg Message) error {
+	select {
+	case d.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// EnqueueWait queues a message for delivery, waiting for room in the queue.
+// Bulk senders use it so that a large batch is throttled to the delivery rate
+// instead of failing with ErrQueueFull.
+func (d *Dispatcher) EnqueueWait(ctx context.Context, msg Message) error {
+	select {
+	case d.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages and waits for queued ones to be sent.
+func (d *Dispatcher) Close() {
+	close(d.queue)
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for msg := range d.queue {
+		d.deliver(msg)
+	}
+}
+
+func (d *Dispatcher) deliver(msg Message) {
+	backoff := time.Second
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := d.mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to send %q to %s (attempt %d/%d): %v", msg.Subject, msg.To, attempt, maxAttempts, err)
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 4
+		}
+	}
+}
+
+// SendTemplate renders a template and queues it on the default dispatcher.
+func SendTemplate(name, to string, data interface{}) error {
+	if defaultDispatcher == nil {
+		return errors.New("mailer is not initialized")
+	}
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return err
+	}
+	return defaultDispatcher.Enqueue(msg)
+}
+
+// Send queues a message on the default dispatcher, waiting for room in the queue.
+func Send(ctx context.Context, msg Message) error {
+	if defaultDispatcher == nil {
+		return errors.New("mailer is not initialized")
+	}
+	return defaultDispatcher.EnqueueWait(ctx, msg)
+}
+
+// Shutdown drains the default dispatcher.
+func Shutdown() {
+	if defaultDispatcher != nil {
+		defaultDispatcher.Close()
+	}
+}
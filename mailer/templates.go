@@ -0,0 +1,267 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// Each template file defines a "subject", a "text" and an "html" block. The
+// file is parsed twice so that the HTML part gets contextual escaping.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = map[string]emailTemplate{}
+
+func init() {
+	entries, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		path := "templates/" + entry.Name()
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		templates[name] = emailTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(templateFiles, path)),
+			html: htmltemplate.Must(htmltemplate.ParseFS(templateFiles, path)),
+		}
+	}
+}
+
+// Render builds a message addressed to "to" from the named template. An
+// edited version of the template is preferred; if it fails to render, the
+// built-in template is used so the email still goes out.
+func Render(name, to string, data interface{}) (Message, error) {
+	if content := editedContent(name); content != nil {
+		msg, err := RenderContent(*content, to, data)
+		if err == nil {
+			return msg, nil
+		}
+		log.Printf("Failed to render edited %s template, using the built-in one: %v", name, err)
+	}
+
+	tmpl, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s subject: %w", name, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s text body: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s HTML body: %w", name, err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: strings.TrimSpace(text.String()),
+		HTMLBody: strings.TrimSpace(html.String()),
+	}, nil
+}
+
+// Content is the source of a template edited outside the binary, e.g. through
+// the admin API. Subject and Text use text/template, HTML uses html/template.
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// ContentSource looks up the edited content of a template. It returns nil
+// when the template has not been edited.
+type ContentSource func(ctx context.Context, name string) (*Content, error)
+
+var contentSource ContentSource
+
+// contentLookupTimeout bounds how long Render waits for the content source
+// before falling back to the built-in template.
+const contentLookupTimeout = 5 * time.Second
+
+// SetContentSource makes Render prefer edited templates from source over the
+// built-in ones.
+func SetContentSource(source ContentSource) {
+	contentSource = source
+}
+
+// BuiltinTemplates lists the names of the templates shipped with the binary.
+func BuiltinTemplates() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuiltinVariables returns the fields a built-in template is rendered with,
+// or nil if there is no such template.
+func BuiltinVariables(name string) []string {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil
+	}
+	fields := map[string]bool{}
+	for _, t := range tmpl.text.Templates() {
+		if t.Tree != nil {
+			collectFields(t.Tree.Root, fields)
+		}
+	}
+	return sortedKeys(fields)
+}
+
+// editedContent returns the edited content of a template, or nil.
+func editedContent(name string) *Content {
+	if contentSource == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), contentLookupTimeout)
+	defer cancel()
+
+	content, err := contentSource(ctx, name)
+	if err != nil {
+		log.Printf("Failed to load edited %s template, using the built-in one: %v", name, err)
+		return nil
+	}
+	return content
+}
+
+// ParseContent checks that content parses and only uses the given variables.
+// It returns the variables the content uses.
+func ParseContent(content Content, variables []string) ([]string, error) {
+	allowed := map[string]bool{}
+	for _, variable := range variables {
+		allowed[variable] = true
+	}
+
+	used := map[string]bool{}
+	for part, source := range map[string]string{"subject": content.Subject, "text": content.Text, "html": content.HTML} {
+		tmpl, err := texttemplate.New(part).Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", part, err)
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				collectFields(t.Tree.Root, used)
+			}
+		}
+	}
+	if _, err := htmltemplate.New("html").Parse(content.HTML); err != nil {
+		return nil, fmt.Errorf("html: %w", err)
+	}
+
+	for field := range used {
+		if !allowed[field] {
+			return nil, fmt.Errorf("unknown variable %q", field)
+		}
+	}
+	return sortedKeys(used), nil
+}
+
+// RenderContent builds a message addressed to "to" from edited content.
+func RenderContent(content Content, to string, data interface{}) (Message, error) {
+	var subject, text, html bytes.Buffer
+
+	subjectTmpl, err := texttemplate.New("subject").Option("missingkey=error").Parse(content.Subject)
+	if err == nil {
+		err = subjectTmpl.Execute(&subject, data)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("error rendering subject: %w", err)
+	}
+
+	textTmpl, err := texttemplate.New("text").Option("missingkey=error").Parse(content.Text)
+	if err == nil {
+		err = textTmpl.Execute(&text, data)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("error rendering text body: %w", err)
+	}
+
+	htmlTmpl, err := htmltemplate.New("html").Option("missingkey=error").Parse(content.HTML)
+	if err == nil {
+		err = htmlTmpl.Execute(&html, data)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("error rendering HTML body: %w", err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: strings.TrimSpace(text.String()),
+		HTMLBody: strings.TrimSpace(html.String()),
+	}, nil
+}
+
+// collectFields records the top-level fields ({{.Name}}) used below node.
+// Fields inside range and with blocks are relative to a different dot and are
+// collected too, which is stricter than necessary but keeps the check simple.
+func collectFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, fields)
+	case *parse.IfNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, fields)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, fields)
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	}
+}
+
+func collectBranchFields(n *parse.BranchNode, fields map[string]bool) {
+	collectFields(n.Pipe, fields)
+	collectFields(n.List, fields)
+	collectFields(n.ElseList, fields)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
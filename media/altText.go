@@ -0,0 +1,252 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AltTextPending  = "pending"
+	AltTextAccepted = "accepted"
+	AltTextRejected = "rejected"
+
+	// maxAltTextLength keeps suggestions short enough for screen readers.
+	maxAltTextLength = 250
+)
+
+var (
+	ErrAltTextDisabled      = errors.New("alt text suggestions are not configured")
+	ErrSuggestionNotFound   = errors.New("alt text suggestion not found")
+	ErrSuggestionNotPending = errors.New("alt text suggestion has already been reviewed")
+)
+
+// AltTextProvider suggests alternative text describing an image.
+type AltTextProvider interface {
+	Name() string
+	SuggestAltText(ctx context.Context, image []byte, contentType string) (string, error)
+}
+
+// AltTextSuggestion is a provider suggestion waiting for, or after, editor review.
+type AltTextSuggestion struct {
+	ID         uuid.UUID  `json:"id"`
+	MediaKey   string     `json:"media_key"`
+	Provider   string     `json:"provider"`
+	Suggestion string     `json:"suggestion"`
+	Status     string     `json:"status"`
+	AltText    *string    `json:"alt_text"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+}
+
+// LoadAltTextProvider returns the provider configured through ALT_TEXT_PROVIDER,
+// or nil when suggestions are disabled.
+func LoadAltTextProvider() (AltTextProvider, error) {
+	switch provider := os.Getenv("ALT_TEXT_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "openai":
+		apiKey := os.Getenv("ALT_TEXT_API_KEY")
+		if apiKey == "" {
+			return nil, errors.New("ALT_TEXT_API_KEY environment variable is not set")
+		}
+		endpoint := os.Getenv("ALT_TEXT_API_URL")
+		if endpoint == "" {
+			endpoint = "https://api.openai.com/v1/chat/completions"
+		}
+		model := os.Getenv("ALT_TEXT_MODEL")
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		return &openAIAltTextProvider{
+			endpoint: endpoint,
+			apiKey:   apiKey,
+			model:    model,
+			client:   &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, errors.New("unsupported ALT_TEXT_PROVIDER: " + provider)
+	}
+}
+
+// openAIAltTextProvider talks to any OpenAI compatible chat completions API
+// that accepts image inputs.
+type openAIAltTextProvider struct {
+	endpoint string
+	apiKey   string
+	model    string
+	client   *http.Client
+}
+
+func (p *openAIAltTextProvider) Name() string {
+	return "openai:" + p.model
+}
+
+func (p *openAIAltTextProvider) SuggestAltText(ctx context.Context, image []byte, contentType string) (string, error) {
+	dataURL := "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image)
+	payload := map[string]interface{}{
+		"model":      p.model,
+		"max_tokens": 120,
+		"messages": []map[string]interface{}{
+			{
+				"role": "user",
+				"content": []map[string]interface{}{
+					{"type": "text", "text": "Write concise alt text (one sentence, under 125 characters) describing this image for a church website. Do not start with \"Image of\"."},
+					{"type": "image_url", "image_url": map[string]string{"url": dataURL}},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling alt text provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("alt text provider returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding alt text provider response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("alt text provider returned no suggestion")
+	}
+
+	return cleanAltText(result.Choices[0].Message.Content), nil
+}
+
+// cleanAltText trims quotes and whitespace and caps the suggestion length.
+func cleanAltText(text string) string {
+	text = strings.Trim(strings.TrimSpace(text), "\"'")
+	if runes := []rune(text); len(runes) > maxAltTextLength {
+		text = string(runes[:maxAltTextLength])
+	}
+	return text
+}
+
+// SuggestAltText asks the configured provider for alt text and stores the
+// result as a pending suggestion for the given media key.
+func SuggestAltText(ctx context.Context, mediaKey string, image []byte, contentType string) (*AltTextSuggestion, error) {
+	provider, err := LoadAltTextProvider()
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, ErrAltTextDisabled
+	}
+
+	text, err := provider.SuggestAltText(ctx, image, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return nil, errors.New("alt text provider returned an empty suggestion")
+	}
+
+	suggestion := &AltTextSuggestion{
+		ID:         uuid.New(),
+		MediaKey:   mediaKey,
+		Provider:   provider.Name(),
+		Suggestion: text,
+		Status:     AltTextPending,
+		CreatedAt:  time.Now(),
+	}
+	_, err = db.DB.ExecContext(ctx, `INSERT INTO alt_text_suggestions (id, media_key, provider, suggestion, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		suggestion.ID, suggestion.MediaKey, suggestion.Provider, suggestion.Suggestion, suggestion.Status, suggestion.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving alt text suggestion: %w", err)
+	}
+
+	return suggestion, nil
+}
+
+// ListAltTextSuggestions returns the suggestions for a media key, newest first.
+func ListAltTextSuggestions(ctx context.Context, mediaKey string) ([]AltTextSuggestion, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT id, media_key, provider, suggestion, status, alt_text, created_at, reviewed_at
+		FROM alt_text_suggestions WHERE media_key = $1 ORDER BY created_at DESC`, mediaKey)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []AltTextSuggestion{}
+	for rows.Next() {
+		var s AltTextSuggestion
+		if err := rows.Scan(&s.ID, &s.MediaKey, &s.Provider, &s.Suggestion, &s.Status, &s.AltText, &s.CreatedAt, &s.ReviewedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// ReviewAltTextSuggestion accepts or rejects a pending suggestion. When
+// accepting, altText may override the suggested wording; empty keeps it.
+func ReviewAltTextSuggestion(ctx context.Context, id uuid.UUID, status, altText string) (*AltTextSuggestion, error) {
+	if status != AltTextAccepted && status != AltTextRejected {
+		return nil, fmt.Errorf("invalid review status %q", status)
+	}
+
+	var s AltTextSuggestion
+	err := db.DB.QueryRowContext(ctx, `UPDATE alt_text_suggestions
+		SET status = $2,
+		    alt_text = CASE WHEN $2 = 'accepted' THEN COALESCE(NULLIF($3, ''), suggestion) END,
+		    reviewed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING id, media_key, provider, suggestion, status, alt_text, created_at, reviewed_at`,
+		id, status, cleanAltText(altText)).
+		Scan(&s.ID, &s.MediaKey, &s.Provider, &s.Suggestion, &s.Status, &s.AltText, &s.CreatedAt, &s.ReviewedAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error updating alt text suggestion: %w", err)
+		}
+		var exists bool
+		if err := db.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM alt_text_suggestions WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("error querying database: %w", err)
+		}
+		if exists {
+			return nil, ErrSuggestionNotPending
+		}
+		return nil, ErrSuggestionNotFound
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,226 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Usage identifies where an uploaded image will be displayed, which decides
+// the dimension rules it has to satisfy.
+type Usage string
+
+const (
+	UsageCover   Usage = "cover"
+	UsageGallery Usage = "gallery"
+	UsageAvatar  Usage = "avatar"
+)
+
+// DimensionRules describes the accepted size and aspect ratio for a usage.
+type DimensionRules struct {
+	MinWidth       int
+	MinHeight      int
+	MaxWidth       int
+	MaxHeight      int
+	MinAspectRatio float64
+	MaxAspectRatio float64
+	// SquareSize, when set, crops the image to its centre square and scales
+	// it down to at most SquareSize pixels per side.
+	SquareSize int
+}
+
+// usageRules holds the dimension rules for each supported usage.
+var usageRules = map[Usage]DimensionRules{
+	// Cover images are rendered as wide banners and social cards (1.91:1).
+	UsageCover: {
+		MinWidth:       1200,
+		MinHeight:      630,
+		MaxWidth:       6000,
+		MaxHeight:      4000,
+		MinAspectRatio: 1.5,
+		MaxAspectRatio: 2.0,
+	},
+	UsageGallery: {
+		MinWidth:       400,
+		MinHeight:      400,
+		MaxWidth:       8000,
+		MaxHeight:      8000,
+		MinAspectRatio: 0.5,
+		MaxAspectRatio: 2.5,
+	},
+	// Avatars are shown as small circles, so only the centre square is kept.
+	UsageAvatar: {
+		MinWidth:       128,
+		MinHeight:      128,
+		MaxWidth:       8000,
+		MaxHeight:      8000,
+		MinAspectRatio: 0.5,
+		MaxAspectRatio: 2.0,
+		SquareSize:     512,
+	},
+}
+
+const (
+	// MaxUploadBytes is the largest encoded image accepted for processing.
+	MaxUploadBytes = 10 << 20
+	// MaxPixels caps the decoded size of an image so that small, highly
+	// compressed files cannot expand into gigabytes of memory.
+	MaxPixels   = 40_000_000
+	jpegQuality = 90
+)
+
+var (
+	ErrUnsupportedUsage  = errors.New("unsupported image usage")
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrImageTooLarge     = errors.New("image exceeds the maximum allowed size")
+	ErrInvalidDimensions = errors.New("image dimensions are not allowed")
+)
+
+// ProcessedImage is a sanitized image ready to be stored.
+type ProcessedImage struct {
+	Data        []byte
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Processor validates and sanitizes uploaded images. Decoding is expensive,
+// so the number of images processed at the same time is bounded.
+type Processor struct {
+	slots chan struct{}
+}
+
+// NewProcessor creates a Processor that handles at most concurrency images at once.
+func NewProcessor(concurrency int) *Processor {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Processor{slots: make(chan struct{}, concurrency)}
+}
+
+// Process waits for a free slot and then runs ProcessImage.
+func (p *Processor) Process(ctx context.Context, r io.Reader, usage Usage) (*ProcessedImage, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	return ProcessImage(r, usage)
+}
+
+// ProcessImage validates an image against the rules for its usage, rejects
+// decompression bombs before decoding pixel data, applies the EXIF
+// orientation, crops and scales it if the usage asks for a square, and
+// re-encodes the image, which drops all EXIF/GPS metadata.
+func ProcessImage(r io.Reader, usage Usage) (*ProcessedImage, error) {
+	rules, ok := usageRules[usage]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedUsage, usage)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+	if len(data) > MaxUploadBytes {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", ErrImageTooLarge, MaxUploadBytes)
+	}
+
+	// Only the header is read here, so oversized images are rejected
+	// without allocating their pixel buffers.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if format != "jpeg" && format != "png" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	width, height := config.Width, config.Height
+	if orientation >= 5 {
+		// Orientations 5-8 swap the axes when displayed.
+		width, height = height, width
+	}
+	if err := rules.Check(width, height); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	img = applyOrientation(img, orientation)
+	if rules.SquareSize > 0 {
+		img = squareThumbnail(img, rules.SquareSize)
+	}
+
+	return encodeImage(img, format)
+}
+
+// Thumbnail scales a processed image down to fit within size pixels per side.
+func Thumbnail(processed *ProcessedImage, size int) (*ProcessedImage, error) {
+	img, _, err := image.Decode(bytes.NewReader(processed.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	return encodeImage(fitThumbnail(img, size), processed.Format)
+}
+
+// encodeImage encodes img in its original format.
+func encodeImage(img image.Image, format string) (*ProcessedImage, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	bounds := img.Bounds()
+	processed := &ProcessedImage{Format: format, Width: bounds.Dx(), Height: bounds.Dy()}
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		processed.ContentType = "image/jpeg"
+	case "png":
+		err = png.Encode(&buf, img)
+		processed.ContentType = "image/png"
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding image: %w", err)
+	}
+	processed.Data = buf.Bytes()
+
+	return processed, nil
+}
+
+// Check reports whether the given display dimensions satisfy the rules.
+func (d DimensionRules) Check(width, height int) error {
+	if width < d.MinWidth || height < d.MinHeight {
+		return fmt.Errorf("%w: %dx%d is smaller than the minimum %dx%d", ErrInvalidDimensions, width, height, d.MinWidth, d.MinHeight)
+	}
+	if width > d.MaxWidth || height > d.MaxHeight {
+		return fmt.Errorf("%w: %dx%d is larger than the maximum %dx%d", ErrInvalidDimensions, width, height, d.MaxWidth, d.MaxHeight)
+	}
+
+	ratio := float64(width) / float64(height)
+	if ratio < d.MinAspectRatio || ratio > d.MaxAspectRatio {
+		return fmt.Errorf("%w: aspect ratio %.2f is outside %.2f-%.2f", ErrInvalidDimensions, ratio, d.MinAspectRatio, d.MaxAspectRatio)
+	}
+
+	return nil
+}
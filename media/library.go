@@ -0,0 +1,140 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"jsmi-api/db"
+	"jsmi-api/storage"
+	"log"
+	"mime"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrItemNotFound = errors.New("media item not found")
+	extensionRegex  = regexp.MustCompile(`^\.[a-zA-Z0-9]{1,7}$`)
+)
+
+// Item is a file in the media library. The bytes live in the configured
+// storage under StorageKey; the row tracks ownership and quota usage.
+type Item struct {
+	ID          uuid.UUID `json:"id"`
+	Namespace   string    `json:"namespace"`
+	StorageKey  string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedBy   *int64    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Store saves data in the media library under namespace, counting it against
+// the namespace's quota.
+func Store(ctx context.Context, namespace, filename, contentType string, data []byte, createdBy *int64) (Item, error) {
+	item := Item{
+		ID:          uuid.New(),
+		Namespace:   namespace,
+		Filename:    path.Base(filename),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	item.StorageKey = namespace + "/" + item.ID.String() + extensionFor(contentType, filename)
+
+	if err := ReserveStorage(ctx, namespace, item.SizeBytes); err != nil {
+		return Item{}, err
+	}
+
+	if err := storage.Default().Put(ctx, item.StorageKey, contentType, data); err != nil {
+		releaseAfterFailure(namespace, item.SizeBytes)
+		return Item{}, fmt.Errorf("error storing media: %w", err)
+	}
+
+	_, err := db.DB.ExecContext(ctx, `INSERT INTO media_items
+		(id, namespace, storage_key, filename, content_type, size_bytes, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		item.ID, item.Namespace, item.StorageKey, item.Filename, item.ContentType, item.SizeBytes, item.CreatedBy, item.CreatedAt)
+	if err != nil {
+		if delErr := storage.Default().Delete(context.WithoutCancel(ctx), item.StorageKey); delErr != nil {
+			log.Printf("Failed to delete orphaned media %s: %v", item.StorageKey, delErr)
+		}
+		releaseAfterFailure(namespace, item.SizeBytes)
+		return Item{}, fmt.Errorf("error recording media: %w", err)
+	}
+
+	return item, nil
+}
+
+func releaseAfterFailure(namespace string, size int64) {
+	if err := ReleaseStorage(context.Background(), namespace, size); err != nil {
+		log.Printf("Failed to release %d bytes of namespace %s: %v", size, namespace, err)
+	}
+}
+
+// GetItem returns the metadata of a media library item.
+func GetItem(ctx context.Context, id uuid.UUID) (Item, error) {
+	var item Item
+	err := db.DB.QueryRowContext(ctx, `SELECT id, namespace, storage_key, filename, content_type, size_bytes, created_by, created_at
+		FROM media_items WHERE id = $1`, id).
+		Scan(&item.ID, &item.Namespace, &item.StorageKey, &item.Filename, &item.ContentType, &item.SizeBytes,
+			&item.CreatedBy, &item.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Item{}, ErrItemNotFound
+		}
+		return Item{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return item, nil
+}
+
+// Open returns a media library item and a reader for its bytes. The caller
+// must close the reader.
+func Open(ctx context.Context, id uuid.UUID) (Item, io.ReadCloser, error) {
+	item, err := GetItem(ctx, id)
+	if err != nil {
+		return Item{}, nil, err
+	}
+	reader, err := storage.Default().Open(ctx, item.StorageKey)
+	if err != nil {
+		return Item{}, nil, fmt.Errorf("error opening media %s: %w", item.ID, err)
+	}
+	return item, reader, nil
+}
+
+// DeleteItem removes an item from the library and gives its space back.
+func DeleteItem(ctx context.Context, id uuid.UUID) error {
+	var item Item
+	err := db.DB.QueryRowContext(ctx, "DELETE FROM media_items WHERE id = $1 RETURNING namespace, storage_key, size_bytes", id).
+		Scan(&item.Namespace, &item.StorageKey, &item.SizeBytes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrItemNotFound
+		}
+		return fmt.Errorf("error deleting media: %w", err)
+	}
+
+	if err := storage.Default().Delete(ctx, item.StorageKey); err != nil {
+		log.Printf("Failed to delete media %s from storage: %v", item.StorageKey, err)
+	}
+	return ReleaseStorage(ctx, item.Namespace, item.SizeBytes)
+}
+
+// extensionFor picks a file extension for the storage key, preferring the
+// original filename's extension.
+func extensionFor(contentType, filename string) string {
+	if ext := path.Ext(filename); extensionRegex.MatchString(ext) {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DefaultQuotaMB is used when MEDIA_DEFAULT_QUOTA_MB is not set.
+const DefaultQuotaMB = 1024
+
+var (
+	ErrInvalidNamespace = errors.New("invalid media namespace")
+	namespaceRegex      = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+)
+
+// QuotaError is returned when an upload would push a namespace over its quota.
+type QuotaError struct {
+	Namespace string
+	Used      int64
+	Quota     int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("storage quota exceeded for namespace %q: %d of %d bytes used, upload needs %d bytes",
+		e.Namespace, e.Used, e.Quota, e.Requested)
+}
+
+// NamespaceUsage reports the storage used by a media library namespace.
+type NamespaceUsage struct {
+	Namespace  string    `json:"namespace"`
+	BytesUsed  int64     `json:"bytes_used"`
+	QuotaBytes int64     `json:"quota_bytes"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ValidateNamespace checks that a namespace is a lowercase slug, e.g. "nairobi-youth".
+func ValidateNamespace(namespace string) error {
+	if !namespaceRegex.MatchString(namespace) {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+	}
+	return nil
+}
+
+// LoadDefaultQuota returns the default per-namespace quota in bytes from MEDIA_DEFAULT_QUOTA_MB.
+func LoadDefaultQuota() (int64, error) {
+	value := os.Getenv("MEDIA_DEFAULT_QUOTA_MB")
+	if value == "" {
+		return DefaultQuotaMB << 20, nil
+	}
+
+	mb, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || mb < 0 {
+		return 0, errors.New("MEDIA_DEFAULT_QUOTA_MB must be a non-negative integer")
+	}
+	return mb << 20, nil
+}
+
+// ReserveStorage records size bytes against a namespace, failing with a
+// *QuotaError if the namespace does not have enough space left. The check and
+// the increment happen in one statement, so concurrent uploads cannot overshoot.
+func ReserveStorage(ctx context.Context, namespace string, size int64) error {
+	if err := ValidateNamespace(namespace); err != nil {
+		return err
+	}
+	defaultQuota, err := LoadDefaultQuota()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.DB.ExecContext(ctx, "INSERT INTO media_namespaces (namespace) VALUES ($1) ON CONFLICT DO NOTHING", namespace); err != nil {
+		return fmt.Errorf("error creating media namespace: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, `UPDATE media_namespaces
+		SET bytes_used = bytes_used + $2, updated_at = NOW()
+		WHERE namespace = $1 AND bytes_used + $2 <= COALESCE(quota_bytes, $3)`,
+		namespace, size, defaultQuota)
+	if err != nil {
+		return fmt.Errorf("error reserving storage: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error reserving storage: %w", err)
+	}
+	if affected == 0 {
+		usage, err := GetNamespaceUsage(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		return &QuotaError{Namespace: namespace, Used: usage.BytesUsed, Quota: usage.QuotaBytes, Requested: size}
+	}
+
+	return nil
+}
+
+// ReleaseStorage gives back size bytes to a namespace after a file is deleted
+// or an upload fails after its space was reserved.
+func ReleaseStorage(ctx context.Context, namespace string, size int64) error {
+	_, err := db.DB.ExecContext(ctx, `UPDATE media_namespaces
+		SET bytes_used = GREATEST(bytes_used - $2, 0), updated_at = NOW()
+		WHERE namespace = $1`, namespace, size)
+	if err != nil {
+		return fmt.Errorf("error releasing storage: %w", err)
+	}
+	return nil
+}
+
+// SetQuota overrides the quota of a namespace. A nil quota restores the default.
+func SetQuota(ctx context.Context, namespace string, quotaBytes *int64) error {
+	if err := ValidateNamespace(namespace); err != nil {
+		return err
+	}
+
+	_, err := db.DB.ExecContext(ctx, `INSERT INTO media_namespaces (namespace, quota_bytes) VALUES ($1, $2)
+		ON CONFLICT (namespace) DO UPDATE SET quota_bytes = EXCLUDED.quota_bytes, updated_at = NOW()`,
+		namespace, quotaBytes)
+	if err != nil {
+		return fmt.Errorf("error setting quota: %w", err)
+	}
+	return nil
+}
+
+// GetNamespaceUsage returns the usage of a single namespace. Unknown
+// namespaces report zero usage and the default quota.
+func GetNamespaceUsage(ctx context.Context, namespace string) (NamespaceUsage, error) {
+	defaultQuota, err := LoadDefaultQuota()
+	if err != nil {
+		return NamespaceUsage{}, err
+	}
+
+	usage := NamespaceUsage{Namespace: namespace, QuotaBytes: defaultQuota}
+	err = db.DB.QueryRowContext(ctx, `SELECT bytes_used, COALESCE(quota_bytes, $2), updated_at
+		FROM media_namespaces WHERE namespace = $1`, namespace, defaultQuota).
+		Scan(&usage.BytesUsed, &usage.QuotaBytes, &usage.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return NamespaceUsage{}, fmt.Errorf("error querying namespace usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// ListNamespaceUsage returns the usage of every namespace, largest first.
+func ListNamespaceUsage(ctx context.Context) ([]NamespaceUsage, error) {
+	defaultQuota, err := LoadDefaultQuota()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT namespace, bytes_used, COALESCE(quota_bytes, $1), updated_at
+		FROM media_namespaces ORDER BY bytes_used DESC`, defaultQuota)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	usages := []NamespaceUsage{}
+	for rows.Next() {
+		var usage NamespaceUsage
+		if err := rows.Scan(&usage.Namespace, &usage.BytesUsed, &usage.QuotaBytes, &usage.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,76 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+// squareThumbnail crops the centre square of img and scales it down to at
+// most size pixels per side. Images smaller than size are only cropped.
+func squareThumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Point{
+		X: bounds.Min.X + (bounds.Dx()-side)/2,
+		Y: bounds.Min.Y + (bounds.Dy()-side)/2,
+	})
+
+	// Work on premultiplied pixels so transparent pixels do not bleed
+	// their colour into the averaged result.
+	src := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Src)
+	if side <= size {
+		return src
+	}
+
+	return boxResize(src, size, size)
+}
+
+// fitThumbnail scales img down to fit within size pixels per side, keeping
+// its aspect ratio. Images that already fit are returned unscaled.
+func fitThumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	if bounds.Dx() <= size && bounds.Dy() <= size {
+		return src
+	}
+
+	width, height := size, max(1, bounds.Dy()*size/bounds.Dx())
+	if bounds.Dy() > bounds.Dx() {
+		width, height = max(1, bounds.Dx()*size/bounds.Dy()), size
+	}
+	return boxResize(src, width, height)
+}
+
+// boxResize scales src down to width x height by averaging the block of
+// source pixels that maps onto each destination pixel.
+func boxResize(src *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0, y1 := dy*srcHeight/height, (dy+1)*srcHeight/height
+		for dx := 0; dx < width; dx++ {
+			x0, x1 := dx*srcWidth/width, (dx+1)*srcWidth/width
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
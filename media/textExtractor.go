@@ -0,0 +1,269 @@
+package media
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ContentTypePDF  = "application/pdf"
+	ContentTypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+	// MaxDocumentBytes is the largest document accepted by the document library.
+	MaxDocumentBytes = 20 << 20
+	// MaxExtractedText caps the indexed text well below PostgreSQL's 1MB
+	// tsvector limit; the start of a long document is enough to find it.
+	MaxExtractedText = 512 << 10
+)
+
+var (
+	ErrUnsupportedDocument = errors.New("unsupported document format")
+	ErrNoPDFExtractor      = errors.New("no PDF text extractor is available")
+)
+
+// DetectDocumentType returns the content type of a PDF or DOCX file. DOCX
+// files are zip archives, so they are recognised by extension and zip magic.
+func DetectDocumentType(data []byte, filename string) (string, error) {
+	switch detected := http.DetectContentType(data); {
+	case detected == ContentTypePDF:
+		return ContentTypePDF, nil
+	case detected == "application/zip" && strings.EqualFold(path.Ext(filename), ".docx"):
+		return ContentTypeDOCX, nil
+	}
+	return "", ErrUnsupportedDocument
+}
+
+// TextExtractor pulls the plain text out of a document for search indexing.
+type TextExtractor interface {
+	Name() string
+	ExtractText(ctx context.Context, data []byte, contentType string) (string, error)
+}
+
+// LoadTextExtractor returns the extractor for the document library. When
+// TIKA_URL is set PDFs go to an Apache Tika server, otherwise to pdftotext if
+// it is installed. DOCX files are always read in-process.
+func LoadTextExtractor() (TextExtractor, error) {
+	if tikaURL := os.Getenv("TIKA_URL"); tikaURL != "" {
+		if !strings.HasPrefix(tikaURL, "http://") && !strings.HasPrefix(tikaURL, "https://") {
+			return nil, errors.New("TIKA_URL must be an http or https URL")
+		}
+		return &localTextExtractor{pdf: &tikaClient{
+			endpoint: strings.TrimSuffix(tikaURL, "/") + "/tika",
+			client:   &http.Client{Timeout: 2 * time.Minute},
+		}}, nil
+	}
+	if binary, err := exec.LookPath("pdftotext"); err == nil {
+		return &localTextExtractor{pdf: &pdftotext{binary: binary}}, nil
+	}
+	return &localTextExtractor{}, nil
+}
+
+// pdfExtractor extracts the text of a PDF.
+type pdfExtractor interface {
+	name() string
+	extract(ctx context.Context, data []byte) (string, error)
+}
+
+type localTextExtractor struct {
+	pdf pdfExtractor
+}
+
+func (e *localTextExtractor) Name() string {
+	if e.pdf == nil {
+		return "docx"
+	}
+	return "docx+" + e.pdf.name()
+}
+
+func (e *localTextExtractor) ExtractText(ctx context.Context, data []byte, contentType string) (string, error) {
+	var (
+		text string
+		err  error
+	)
+	switch contentType {
+	case ContentTypeDOCX:
+		text, err = extractDOCXText(data)
+	case ContentTypePDF:
+		if e.pdf == nil {
+			return "", ErrNoPDFExtractor
+		}
+		text, err = e.pdf.extract(ctx, data)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedDocument, contentType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncateText(normalizeText(text), MaxExtractedText), nil
+}
+
+// extractDOCXText reads the paragraphs of word/document.xml.
+func extractDOCXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("error opening docx: %w", err)
+	}
+
+	var document *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			document = file
+			break
+		}
+	}
+	if document == nil {
+		return "", fmt.Errorf("%w: docx has no word/document.xml", ErrUnsupportedDocument)
+	}
+
+	reader, err := document.Open()
+	if err != nil {
+		return "", fmt.Errorf("error opening docx: %w", err)
+	}
+	defer reader.Close()
+
+	// Guard against zip bombs; the XML is far larger than its text.
+	decoder := xml.NewDecoder(io.LimitReader(reader, 20*MaxExtractedText))
+	var (
+		text   strings.Builder
+		inText bool
+	)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// A truncated document still yields the text read so far.
+			if text.Len() > 0 {
+				break
+			}
+			return "", fmt.Errorf("error reading docx: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+// pdftotext runs the poppler pdftotext binary.
+type pdftotext struct {
+	binary string
+}
+
+func (p *pdftotext) name() string {
+	return "pdftotext"
+}
+
+func (p *pdftotext) extract(ctx context.Context, data []byte) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.binary, "-enc", "UTF-8", "-q", "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("pdftotext failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// tikaClient talks to the /tika endpoint of an Apache Tika server.
+type tikaClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (t *tikaClient) name() string {
+	return "tika"
+}
+
+func (t *tikaClient) extract(ctx context.Context, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", ContentTypePDF)
+	req.Header.Set("Accept", "text/plain; charset=UTF-8")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling tika: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tika returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4*MaxExtractedText))
+	if err != nil {
+		return "", fmt.Errorf("error reading tika response: %w", err)
+	}
+	return string(body), nil
+}
+
+// normalizeText drops invalid UTF-8 and NUL bytes, which PostgreSQL rejects,
+// and collapses runs of blank lines.
+func normalizeText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r\f")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// truncateText cuts text to at most limit bytes without splitting a rune.
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
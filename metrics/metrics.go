@@ -0,0 +1,273 @@
+// Package metrics counts requests, server errors, rate-limit rejections and
+// cache lookups. Each instance counts in memory and adds its counts to a
+// Redis hash per day every minute, so reports see the totals of every API
+// instance.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+const (
+	keyPrefix     = "metrics:"
+	flushInterval = time.Minute
+	// retention is how long daily counts are kept.
+	retention = 15 * 24 * time.Hour
+
+	// Fields of the daily hash. Route fields are the prefix followed by the
+	// route template, e.g. "requests|/posts".
+	fieldRequestsPrefix    = "requests|"
+	fieldErrorsPrefix      = "errors|"
+	fieldDurationPrefix    = "duration_ms|"
+	fieldRateLimited       = "rate_limited"
+	fieldCacheHits         = "cache_hits"
+	fieldCacheMisses       = "cache_misses"
+	unmatchedRoute         = "(unmatched)"
+	streamingContentPrefix = "text/event-stream"
+)
+
+var (
+	mu     sync.Mutex
+	counts = map[string]int64{}
+)
+
+func add(field string, n int64) {
+	mu.Lock()
+	counts[field] += n
+	mu.Unlock()
+}
+
+// ObserveCache counts a cache lookup by the error of the Redis GET: nil is a
+// hit, redis.Nil a miss. Other errors are not counted.
+func ObserveCache(err error) {
+	switch {
+	case err == nil:
+		add(fieldCacheHits, 1)
+	case errors.Is(err, redis.Nil):
+		add(fieldCacheMisses, 1)
+	}
+}
+
+// Middleware counts every request by its route template, so that /posts?id=
+// for different posts is one endpoint. It must run after routing, as a
+// mux.Router middleware. 5xx responses count as errors, 429s as rate-limit
+// rejections. Event streams are counted but not timed.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		route = r.Method + " " + route
+
+		mu.Lock()
+		defer mu.Unlock()
+		counts[fieldRequestsPrefix+route]++
+		if recorder.status >= http.StatusInternalServerError {
+			counts[fieldErrorsPrefix+route]++
+		}
+		if recorder.status == http.StatusTooManyRequests {
+			counts[fieldRateLimited]++
+		}
+		if !recorder.streaming {
+			counts[fieldDurationPrefix+route] += time.Since(start).Milliseconds()
+		}
+	})
+}
+
+// statusRecorder remembers the status of a response. It passes Flush on, so
+// event streams keep working behind it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	streaming   bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+		r.streaming = strings.HasPrefix(r.Header().Get("Content-Type"), streamingContentPrefix)
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Start flushes the counts every minute until ctx is cancelled. Call Flush
+// once more on shutdown for the last requests.
+func Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Flush(ctx); err != nil {
+					log.Printf("Failed to flush metrics: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Flush adds the counts since the last flush to today's hash. Counts that
+// cannot be written are kept for the next flush.
+func Flush(ctx context.Context) error {
+	mu.Lock()
+	pending := counts
+	counts = map[string]int64{}
+	mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	key := dayKey(time.Now())
+	pipe := db.RedisClient.TxPipeline()
+	for field, n := range pending {
+		pipe.HIncrBy(ctx, key, field, n)
+	}
+	pipe.Expire(ctx, key, retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		mu.Lock()
+		for field, n := range pending {
+			counts[field] += n
+		}
+		mu.Unlock()
+		return fmt.Errorf("error writing metrics: %w", err)
+	}
+	return nil
+}
+
+func dayKey(t time.Time) string {
+	return keyPrefix + t.UTC().Format(time.DateOnly)
+}
+
+// Endpoint is the traffic of a route over a period.
+type Endpoint struct {
+	Route     string  `json:"route"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	// AverageMs is the mean response time; event streams are not timed.
+	AverageMs float64 `json:"average_ms"`
+}
+
+// Summary is the traffic of every instance over a period.
+type Summary struct {
+	From          time.Time  `json:"from"`
+	To            time.Time  `json:"to"`
+	Requests      int64      `json:"requests"`
+	Errors        int64      `json:"errors"`
+	ErrorRate     float64    `json:"error_rate"`
+	RateLimited   int64      `json:"rate_limited"`
+	CacheHits     int64      `json:"cache_hits"`
+	CacheMisses   int64      `json:"cache_misses"`
+	CacheHitRatio float64    `json:"cache_hit_ratio"`
+	Endpoints     []Endpoint `json:"endpoints"`
+}
+
+// Summarize adds up the daily counts of the days days up to and including
+// the day of to.
+func Summarize(ctx context.Context, to time.Time, days int) (Summary, error) {
+	to = to.UTC()
+	summary := Summary{From: to.AddDate(0, 0, 1-days).Truncate(24 * time.Hour), To: to}
+
+	pipe := db.RedisClient.Pipeline()
+	results := make([]*redis.StringStringMapCmd, days)
+	for i := range results {
+		results[i] = pipe.HGetAll(ctx, dayKey(to.AddDate(0, 0, -i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return Summary{}, fmt.Errorf("error reading metrics: %w", err)
+	}
+
+	endpoints := map[string]*Endpoint{}
+	durations := map[string]int64{}
+	endpoint := func(route string) *Endpoint {
+		if endpoints[route] == nil {
+			endpoints[route] = &Endpoint{Route: route}
+		}
+		return endpoints[route]
+	}
+	for _, result := range results {
+		for field, value := range result.Val() {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case field == fieldRateLimited:
+				summary.RateLimited += n
+			case field == fieldCacheHits:
+				summary.CacheHits += n
+			case field == fieldCacheMisses:
+				summary.CacheMisses += n
+			case strings.HasPrefix(field, fieldRequestsPrefix):
+				endpoint(strings.TrimPrefix(field, fieldRequestsPrefix)).Requests += n
+			case strings.HasPrefix(field, fieldErrorsPrefix):
+				endpoint(strings.TrimPrefix(field, fieldErrorsPrefix)).Errors += n
+			case strings.HasPrefix(field, fieldDurationPrefix):
+				durations[strings.TrimPrefix(field, fieldDurationPrefix)] += n
+			}
+		}
+	}
+
+	summary.Endpoints = make([]Endpoint, 0, len(endpoints))
+	for route, e := range endpoints {
+		if e.Requests > 0 {
+			e.ErrorRate = float64(e.Errors) / float64(e.Requests)
+			e.AverageMs = float64(durations[route]) / float64(e.Requests)
+		}
+		summary.Requests += e.Requests
+		summary.Errors += e.Errors
+		summary.Endpoints = append(summary.Endpoints, *e)
+	}
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+	if lookups := summary.CacheHits + summary.CacheMisses; lookups > 0 {
+		summary.CacheHitRatio = float64(summary.CacheHits) / float64(lookups)
+	}
+	return summary, nil
+}
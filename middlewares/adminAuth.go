@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"jsmi-api/db"
+	"net/http"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleStaff  = "staff"
+	RoleMember = "member"
+)
+
+// IsRole reports whether role is one of the roles users can have.
+func IsRole(role string) bool {
+	return role == RoleAdmin || role == RoleStaff || role == RoleMember
+}
+
+// AdminOnly only lets users with the admin role through. It must run after
+// TokenAuthMiddleware.
+func AdminOnly(next http.Handler) http.Handler {
+	return RequireRole(RoleAdmin)(next)
+}
+
+// StaffOnly lets staff members and admins through. It must run after
+// TokenAuthMiddleware.
+func StaffOnly(next http.Handler) http.Handler {
+	return RequireRole(RoleStaff, RoleAdmin)(next)
+}
+
+// RequireRole only lets users with one of the given roles through. The role is
+// read from the database on every request so that demoting a user takes
+// effect immediately.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			role, err := UserRole(r.Context(), userID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				HttpError(w, "Failed to check user role", http.StatusInternalServerError, err)
+				return
+			}
+
+			if !contains(roles, role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserRole reads a user's role from the database.
+func UserRole(ctx context.Context, userID int64) (string, error) {
+	var role string
+	err := db.DB.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	return role, err
+}
@@ -18,7 +18,9 @@ func LoadBearerTokenConfig() (string, error) {
 }
 
 // ValidateBearerToken validates the Bearer token in the Authorization header.
-func ValidateBearerToken() func(http.Handler) http.Handler {
+// Paths in public (e.g. email tracking links opened by mail clients) are
+// served without it; entries ending in a slash match every path below them.
+func ValidateBearerToken(public ...string) func(http.Handler) http.Handler {
 	// Load the Bearer token when the middleware is initialized
 	expectedBearerToken, err := LoadBearerTokenConfig()
 	if err != nil {
@@ -27,6 +29,11 @@ func ValidateBearerToken() func(http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublicPath(public, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Retrieve the Bearer token from the Authorization header
 			authHeader := r.Header.Get("Authorization")
 
@@ -59,6 +66,15 @@ func ValidateBearerToken() func(http.Handler) http.Handler {
 	}
 }
 
+func isPublicPath(public []string, path string) bool {
+	for _, p := range public {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
 // secureCompare performs a constant-time comparison of two strings.
 func secureCompare(a, b string) bool {
 	if len(a) != len(b) {
@@ -0,0 +1,231 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"jsmi-api/db"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientTokenHeaderName is the header public API clients send their token in.
+const ClientTokenHeaderName = "X-Client-Token"
+
+const (
+	clientTokenPrefix = "jsmi_"
+	clientCacheTTL    = time.Minute
+	// clientUsageTTL keeps daily usage in Redis long enough for the rollup
+	// job to copy it to Postgres even after a few failed runs.
+	clientUsageTTL = 7 * 24 * time.Hour
+)
+
+const clientIDContextKey contextKey = "api_client_id"
+
+// apiClient is the part of a client the middleware needs on every request.
+type apiClient struct {
+	ID           uuid.UUID
+	RateLimit    int
+	MonthlyQuota int
+}
+
+// GenerateClientToken returns a new public API token and the hash under which
+// it is stored.
+func GenerateClientToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = clientTokenPrefix + hex.EncodeToString(buf)
+	return token, HashClientToken(token), nil
+}
+
+// HashClientToken returns the stored form of a client token.
+func HashClientToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ForgetClientToken drops the cached lookup of a token, so that revoking a
+// client or changing its limits takes effect immediately.
+func ForgetClientToken(ctx context.Context, hash string) {
+	if err := db.RedisClient.Del(ctx, "api_client:"+hash).Err(); err != nil {
+		log.Printf("Failed to clear cached API client: %v", err)
+	}
+}
+
+// ClientIDFromContext returns the ID of the client authenticated by ClientTokenAuth.
+func ClientIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(clientIDContextKey).(uuid.UUID)
+	return id, ok
+}
+
+// ClientUsageKey is the Redis hash holding every client's usage on a day
+// (UTC). Its fields are "<client id>:requests", ":rejected", ":bytes" and
+// ":last_used" (Unix seconds).
+func ClientUsageKey(day time.Time) string {
+	return "api_usage:" + day.UTC().Format(time.DateOnly)
+}
+
+// ClientQuotaKey is the Redis counter of a client's requests in a month (UTC).
+func ClientQuotaKey(clientID uuid.UUID, month time.Time) string {
+	return "api_quota:" + clientID.String() + ":" + month.UTC().Format("2006-01")
+}
+
+// QuotaReset returns when the monthly quota covering t starts over.
+func QuotaReset(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ClientTokenAuth authenticates public API clients by the token in the
+// X-Client-Token header and enforces each client's per-minute rate limit and
+// monthly quota. Both are counted in Redis so that they hold across API
+// instances; usage is metered there too and rolled up into Postgres later.
+func ClientTokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(ClientTokenHeaderName)
+		if token == "" {
+			http.Error(w, "Client token is missing", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		client, err := lookupClient(ctx, HashClientToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Invalid client token", http.StatusUnauthorized)
+				return
+			}
+			HttpError(w, "Failed to check client token", http.StatusInternalServerError, err)
+			return
+		}
+
+		now := time.Now()
+		window := now.Truncate(time.Minute)
+		key := "api_client_rate:" + client.ID.String() + ":" + strconv.FormatInt(window.Unix(), 10)
+		count, err := db.RedisClient.Incr(ctx, key).Result()
+		if err != nil {
+			HttpError(w, "Failed to check rate limit", http.StatusInternalServerError, err)
+			return
+		}
+		if count == 1 {
+			db.RedisClient.Expire(ctx, key, 2*time.Minute)
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(client.RateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(int64(client.RateLimit)-count, 0), 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(window.Add(time.Minute).Unix(), 10))
+
+		if count > int64(client.RateLimit) {
+			recordClientUsage(ctx, client.ID, now, false, 0)
+			w.Header().Set("Retry-After", strconv.Itoa(int(window.Add(time.Minute).Sub(now).Seconds())+1))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		reset := QuotaReset(now)
+		quotaKey := ClientQuotaKey(client.ID, now)
+		used, err := db.RedisClient.Incr(ctx, quotaKey).Result()
+		if err != nil {
+			HttpError(w, "Failed to check quota", http.StatusInternalServerError, err)
+			return
+		}
+		if used == 1 {
+			db.RedisClient.ExpireAt(ctx, quotaKey, reset.Add(24*time.Hour))
+		}
+
+		w.Header().Set("X-Quota-Limit", strconv.Itoa(client.MonthlyQuota))
+		w.Header().Set("X-Quota-Remaining", strconv.FormatInt(max(int64(client.MonthlyQuota)-used, 0), 10))
+		w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if used > int64(client.MonthlyQuota) {
+			// Refused requests do not use up the quota.
+			db.RedisClient.Decr(ctx, quotaKey)
+			recordClientUsage(ctx, client.ID, now, false, 0)
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			http.Error(w, "Monthly quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		counter := &byteCounter{ResponseWriter: w}
+		next.ServeHTTP(counter, r.WithContext(context.WithValue(ctx, clientIDContextKey, client.ID)))
+		recordClientUsage(ctx, client.ID, now, true, counter.bytes)
+	})
+}
+
+// lookupClient returns the active client with the given token hash, or
+// sql.ErrNoRows.
+func lookupClient(ctx context.Context, hash string) (apiClient, error) {
+	cacheKey := "api_client:" + hash
+	if cached, err := db.RedisClient.HGetAll(ctx, cacheKey).Result(); err == nil && cached["id"] != "" {
+		id, idErr := uuid.Parse(cached["id"])
+		limit, limitErr := strconv.Atoi(cached["rate_limit"])
+		quota, quotaErr := strconv.Atoi(cached["monthly_quota"])
+		if idErr == nil && limitErr == nil && quotaErr == nil {
+			return apiClient{ID: id, RateLimit: limit, MonthlyQuota: quota}, nil
+		}
+	}
+
+	var client apiClient
+	err := db.DB.QueryRowContext(ctx, `SELECT c.id, c.rate_limit, c.monthly_quota
+		FROM api_clients c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1 AND c.revoked_at IS NULL AND u.status = 'active'`, hash).
+		Scan(&client.ID, &client.RateLimit, &client.MonthlyQuota)
+	if err != nil {
+		return apiClient{}, err
+	}
+
+	pipe := db.RedisClient.TxPipeline()
+	pipe.HSet(ctx, cacheKey, "id", client.ID.String(), "rate_limit", client.RateLimit, "monthly_quota", client.MonthlyQuota)
+	pipe.Expire(ctx, cacheKey, clientCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to cache API client: %v", err)
+	}
+	return client, nil
+}
+
+// recordClientUsage meters a request of a client in the day's usage hash.
+func recordClientUsage(ctx context.Context, clientID uuid.UUID, now time.Time, accepted bool, bytes int64) {
+	ctx = context.WithoutCancel(ctx)
+	key := ClientUsageKey(now)
+	prefix := clientID.String() + ":"
+
+	pipe := db.RedisClient.TxPipeline()
+	if accepted {
+		pipe.HIncrBy(ctx, key, prefix+"requests", 1)
+		pipe.HIncrBy(ctx, key, prefix+"bytes", bytes)
+		pipe.HSet(ctx, key, prefix+"last_used", now.Unix())
+	} else {
+		pipe.HIncrBy(ctx, key, prefix+"rejected", 1)
+	}
+	pipe.Expire(ctx, key, clientUsageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record API client usage: %v", err)
+	}
+}
+
+// byteCounter counts the bytes of a response body.
+type byteCounter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	n, err := b.ResponseWriter.Write(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (b *byteCounter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
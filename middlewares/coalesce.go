@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesceGroup shares in-flight responses between identical requests.
+var coalesceGroup singleflight.Group
+
+// coalescedResponse is a response recorded once and replayed to every
+// request that waited for it.
+type coalescedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *coalescedResponse) Header() http.Header { return c.header }
+
+func (c *coalescedResponse) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(b)
+}
+
+func (c *coalescedResponse) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+// isAnonymous reports whether a request carries no user credentials.
+func isAnonymous(r *http.Request) bool {
+	if r.Header.Get(ImpersonationHeaderName) != "" {
+		return false
+	}
+	cookie, err := r.Cookie(AuthCookies().AccessName)
+	return err != nil || cookie.Value == ""
+}
+
+// Coalesce runs identical concurrent anonymous GETs once and sends every
+// caller the same response, so a burst of hits on a public read, e.g. right
+// after a live service, costs a single pass through the handler. Requests are
+// identical when path, query and conditional headers match. Signed-in
+// requests, which may see more, always run on their own.
+//
+// Only wrap handlers that write a complete response; streams must not be
+// coalesced.
+func Coalesce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !isAnonymous(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "anonymous " + r.URL.Path + "?" + r.URL.RawQuery + " " + r.Header.Get("If-None-Match") + " " + r.Header.Get("If-Modified-Since")
+		result, _, _ := coalesceGroup.Do(key, func() (interface{}, error) {
+			// The leader's client may leave before the others are served.
+			recorded := &coalescedResponse{header: http.Header{}}
+			next.ServeHTTP(recorded, r.WithContext(context.WithoutCancel(r.Context())))
+			return recorded, nil
+		})
+
+		recorded := result.(*coalescedResponse)
+		for name, values := range recorded.header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		status := recorded.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write(recorded.body.Bytes())
+	})
+}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthCookieConfig holds the attributes of the auth cookies so that staging on
+// another subdomain and plain-HTTP local development work without code edits.
+type AuthCookieConfig struct {
+	Domain      string
+	Secure      bool
+	SameSite    http.SameSite
+	AccessName  string
+	RefreshName string
+	CSRFName    string
+}
+
+var (
+	authCookieConfig     AuthCookieConfig
+	authCookieConfigOnce sync.Once
+)
+
+// LoadAuthCookieConfig reads the cookie attributes from environment variables:
+// AUTH_COOKIE_DOMAIN, AUTH_COOKIE_SECURE (default true), AUTH_COOKIE_SAMESITE
+// (strict, lax or none; default strict) and AUTH_COOKIE_ACCESS_NAME,
+// AUTH_COOKIE_REFRESH_NAME and AUTH_COOKIE_CSRF_NAME.
+func LoadAuthCookieConfig() (AuthCookieConfig, error) {
+	config := AuthCookieConfig{
+		Domain:      os.Getenv("AUTH_COOKIE_DOMAIN"),
+		Secure:      true,
+		SameSite:    http.SameSiteStrictMode,
+		AccessName:  envOrDefault("AUTH_COOKIE_ACCESS_NAME", "access_token"),
+		RefreshName: envOrDefault("AUTH_COOKIE_REFRESH_NAME", "refresh_token"),
+		CSRFName:    envOrDefault("AUTH_COOKIE_CSRF_NAME", "csrf_token"),
+	}
+
+	switch value := strings.ToLower(os.Getenv("AUTH_COOKIE_SECURE")); value {
+	case "", "true", "1":
+	case "false", "0":
+		config.Secure = false
+	default:
+		return AuthCookieConfig{}, errors.New("AUTH_COOKIE_SECURE must be true or false")
+	}
+
+	switch value := strings.ToLower(os.Getenv("AUTH_COOKIE_SAMESITE")); value {
+	case "", "strict":
+	case "lax":
+		config.SameSite = http.SameSiteLaxMode
+	case "none":
+		config.SameSite = http.SameSiteNoneMode
+	default:
+		return AuthCookieConfig{}, errors.New("AUTH_COOKIE_SAMESITE must be strict, lax or none")
+	}
+
+	// Browsers reject SameSite=None cookies that are not Secure.
+	if config.SameSite == http.SameSiteNoneMode && !config.Secure {
+		return AuthCookieConfig{}, errors.New("AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE=true")
+	}
+
+	names := map[string]bool{config.AccessName: true, config.RefreshName: true, config.CSRFName: true}
+	if len(names) != 3 {
+		return AuthCookieConfig{}, errors.New("auth cookie names must be distinct")
+	}
+
+	return config, nil
+}
+
+// AuthCookies returns the auth cookie configuration, loading it on first use.
+func AuthCookies() AuthCookieConfig {
+	authCookieConfigOnce.Do(func() {
+		config, err := LoadAuthCookieConfig()
+		if err != nil {
+			log.Fatalf("Failed to load auth cookie config: %v", err)
+		}
+		authCookieConfig = config
+	})
+	return authCookieConfig
+}
+
+// NewCookie builds a cookie with the configured domain, Secure and SameSite attributes.
+func (c AuthCookieConfig) NewCookie(name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expires,
+		Domain:   c.Domain,
+		HttpOnly: httpOnly,
+		Secure:   c.Secure,
+		SameSite: c.SameSite,
+		Path:     "/",
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"jsmi-api/db"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeviceTokenHeaderName is the header paired display devices send their token in.
+const DeviceTokenHeaderName = "X-Device-Token"
+
+const (
+	deviceTokenPrefix = "jsmi_dev_"
+	deviceCacheTTL    = time.Minute
+	// deviceSeenInterval is how often a device's last_seen_at is written;
+	// screens poll all day, so not every request needs to touch the row.
+	deviceSeenInterval = 5 * time.Minute
+)
+
+const deviceIDContextKey contextKey = "display_device_id"
+
+// GenerateDeviceToken returns a new display device token and the hash under
+// which it is stored.
+func GenerateDeviceToken() (token, hash string, err error) {
+	token, _, err = GenerateClientToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = deviceTokenPrefix + token[len(clientTokenPrefix):]
+	return token, HashClientToken(token), nil
+}
+
+// ForgetDeviceToken drops the cached lookup of a device token, so that
+// revoking a device takes effect immediately.
+func ForgetDeviceToken(ctx context.Context, hash string) {
+	if err := db.RedisClient.Del(ctx, "display_device:"+hash).Err(); err != nil {
+		log.Printf("Failed to clear cached display device: %v", err)
+	}
+}
+
+// DeviceIDFromContext returns the ID of the device authenticated by DeviceTokenAuth.
+func DeviceIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(deviceIDContextKey).(uuid.UUID)
+	return id, ok
+}
+
+// DeviceTokenAuth authenticates paired display devices by the token in the
+// X-Device-Token header.
+func DeviceTokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(DeviceTokenHeaderName)
+		if token == "" {
+			http.Error(w, "Device token is missing", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		id, err := lookupDevice(ctx, HashClientToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Invalid device token", http.StatusUnauthorized)
+				return
+			}
+			HttpError(w, "Failed to check device token", http.StatusInternalServerError, err)
+			return
+		}
+
+		markDeviceSeen(ctx, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, deviceIDContextKey, id)))
+	})
+}
+
+// lookupDevice returns the ID of the active device with the given token
+// hash, or sql.ErrNoRows.
+func lookupDevice(ctx context.Context, hash string) (uuid.UUID, error) {
+	cacheKey := "display_device:" + hash
+	if cached, err := db.RedisClient.Get(ctx, cacheKey).Result(); err == nil {
+		if id, err := uuid.Parse(cached); err == nil {
+			return id, nil
+		}
+	}
+
+	var id uuid.UUID
+	err := db.DB.QueryRowContext(ctx, "SELECT id FROM display_devices WHERE token_hash = $1 AND revoked_at IS NULL", hash).Scan(&id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := db.RedisClient.Set(ctx, cacheKey, id.String(), deviceCacheTTL).Err(); err != nil {
+		log.Printf("Failed to cache display device: %v", err)
+	}
+	return id, nil
+}
+
+// markDeviceSeen updates a device's last_seen_at at most once per
+// deviceSeenInterval.
+func markDeviceSeen(ctx context.Context, id uuid.UUID) {
+	ok, err := db.RedisClient.SetNX(ctx, "display_device_seen:"+id.String(), 1, deviceSeenInterval).Result()
+	if err != nil || !ok {
+		return
+	}
+	if _, err := db.DB.ExecContext(ctx, "UPDATE display_devices SET last_seen_at = NOW() WHERE id = $1", id); err != nil {
+		log.Printf("Failed to update display device last seen: %v", err)
+	}
+}
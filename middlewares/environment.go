@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"os"
+)
+
+// EnvironmentHeaderName identifies non-production environments in responses,
+// so clients can show a preview banner.
+const EnvironmentHeaderName = "X-Environment"
+
+// EnvironmentProduction is the value of APP_ENV in production, and the
+// default when it is not set.
+const EnvironmentProduction = "production"
+
+// Environment returns the deployment environment from APP_ENV.
+func Environment() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return EnvironmentProduction
+}
+
+// IsProduction reports whether this is the production deployment.
+func IsProduction() bool {
+	return Environment() == EnvironmentProduction
+}
+
+// PreviewBanner returns the notice clients show outside production, from
+// PREVIEW_BANNER_TEXT, or "" in production.
+func PreviewBanner() string {
+	if IsProduction() {
+		return ""
+	}
+	if text := os.Getenv("PREVIEW_BANNER_TEXT"); text != "" {
+		return text
+	}
+	return "You are viewing the " + Environment() + " environment. Content here may not be final."
+}
+
+// EnvironmentMiddleware marks every response outside production with the
+// environment and asks search engines not to index it, so staging content
+// does not leak into search results.
+func EnvironmentMiddleware(next http.Handler) http.Handler {
+	env := Environment()
+	if env == EnvironmentProduction {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(EnvironmentHeaderName, env)
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -17,6 +17,13 @@ func RespondJSON(w http.ResponseWriter, data interface{}, status int) {
 	}
 }
 
+// RespondCreated answers a create with the stored resource and, in the
+// Location header, the URL it can be fetched from.
+func RespondCreated(w http.ResponseWriter, location string, data interface{}) {
+	w.Header().Set("Location", location)
+	RespondJSON(w, data, http.StatusCreated)
+}
+
 func HttpError(w http.ResponseWriter, message string, status int, err error) {
 	log.Printf("HTTP %d - %s: %v", status, message, err)
 	http.Error(w, message, status)
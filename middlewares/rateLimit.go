@@ -56,7 +56,8 @@ func (rl *RateLimiter) cleanup() {
 	}
 }
 
-func getClientIP(r *http.Request) string {
+// ClientIP returns the IP address of the client, honouring X-Forwarded-For.
+func ClientIP(r *http.Request) string {
 	xff := r.Header.Get("X-Forwarded-For")
 	if xff != "" {
 		ips := strings.Split(xff, ",")
@@ -79,7 +80,7 @@ func getClientIP(r *http.Request) string {
 
 func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientIP := getClientIP(r)
+		clientIP := ClientIP(r)
 		data, _ := rl.limits.LoadOrStore(clientIP, &clientData{
 			requests: 0,
 			timer: time.AfterFunc(rl.window, func() {
@@ -1,25 +1,70 @@
 package middlewares
 
 import (
+	"context"
 	"jsmi-api/utils"
 	"net/http"
 )
 
-// TokenAuthMiddleware is a middleware function that checks for a valid PASETO token
+type contextKey string
+
+const userIDContextKey contextKey = "user_id"
+
+// TokenAuthMiddleware is a middleware function that checks for a valid access token (PASETO or JWT).
+// Impersonation tokens are accepted from the X-Impersonation-Token header
+// only, and every request made with one is written to the admin audit log.
 func TokenAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("access_token")
-		if err != nil || cookie == nil || cookie.Value == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+		token := r.Header.Get(ImpersonationHeaderName)
+		impersonating := token != ""
+		if !impersonating {
+			cookie, err := r.Cookie(AuthCookies().AccessName)
+			if err != nil || cookie == nil || cookie.Value == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			token = cookie.Value
 		}
 
-		_, err = utils.ValidatePASETO(cookie.Value)
-		if err != nil {
+		claims, err := utils.ValidateAccessToken(token)
+		if err != nil || impersonating != (claims.ActingAdmin != 0) {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if rejectInactiveUser(w, r, claims.UserID) {
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDContextKey, claims.UserID)
+		if !impersonating {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		ctx = context.WithValue(ctx, actingAdminContextKey, claims.ActingAdmin)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		RecordAdminAudit(r, claims.ActingAdmin, claims.UserID, AuditImpersonatedRequest, recorder.status)
+	})
+}
+
+// UserIDFromContext returns the ID of the user authenticated by TokenAuthMiddleware.
+func UserIDFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(int64)
+	return userID, ok
+}
+
+// OptionalTokenAuth lets anonymous requests through without a user in the
+// context and authenticates everything else like TokenAuthMiddleware, for
+// endpoints that show signed-in users more.
+func OptionalTokenAuth(next http.Handler) http.Handler {
+	authenticated := TokenAuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAnonymous(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
 	})
 }
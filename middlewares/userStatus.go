@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsmi-api/db"
+	"jsmi-api/models"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// userStatusCacheTime keeps status lookups off the database for most
+// requests; suspensions invalidate the entry explicitly.
+const userStatusCacheTime = 5 * time.Minute
+
+type userStatusEntry struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+func userStatusCacheKey(userID int64) string {
+	return fmt.Sprintf("user_status:%d", userID)
+}
+
+// lookupUserStatus returns the cached account status of a user, loading it
+// from the database on a cache miss. It returns nil if the user does not exist.
+func lookupUserStatus(ctx context.Context, userID int64) (*userStatusEntry, error) {
+	cachedData, err := db.RedisClient.Get(ctx, userStatusCacheKey(userID)).Bytes()
+	if err == nil {
+		var entry userStatusEntry
+		if err := json.Unmarshal(cachedData, &entry); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cached user status: %w", err)
+		}
+		return &entry, nil
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error fetching user status from Redis cache: %w", err)
+	}
+
+	var entry userStatusEntry
+	err = db.DB.QueryRowContext(ctx, "SELECT username, status FROM users WHERE id = $1", userID).
+		Scan(&entry.Username, &entry.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error querying user status: %w", err)
+	}
+
+	jsonData, err := json.Marshal(entry)
+	if err == nil {
+		db.RedisClient.Set(ctx, userStatusCacheKey(userID), jsonData, userStatusCacheTime)
+	}
+
+	return &entry, nil
+}
+
+// DeleteUserStatusCache drops the cached account status of a user.
+func DeleteUserStatusCache(ctx context.Context, userID int64) error {
+	return db.RedisClient.Del(ctx, userStatusCacheKey(userID)).Err()
+}
+
+// rejectInactiveUser writes an error response and returns true if the user no
+// longer exists or is suspended. Cache entries of suspended users are purged.
+func rejectInactiveUser(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	ctx := r.Context()
+	entry, err := lookupUserStatus(ctx, userID)
+	if err != nil {
+		HttpError(w, "Failed to check account status", http.StatusInternalServerError, err)
+		return true
+	}
+	if entry == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return true
+	}
+
+	if entry.Status == models.UserStatusSuspended {
+		if err := db.RedisClient.Del(ctx, "user:"+entry.Username).Err(); err != nil {
+			HttpError(w, "Failed to clear user cache", http.StatusInternalServerError, err)
+			return true
+		}
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type AdminAuditEntry struct {
+	ID        int64     `json:"id"`
+	AdminID   *int64    `json:"admin_id"`
+	UserID    *int64    `json:"user_id"`
+	Action    string    `json:"action"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
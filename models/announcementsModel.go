@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StaffAnnouncement is an announcement to staff. Critical announcements must
+// be acknowledged by every staff member.
+type StaffAnnouncement struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Critical  bool      `json:"critical"`
+	CreatedBy *int64    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// AcknowledgedAt is when the caller acknowledged the announcement.
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+}
+
+// AnnouncementReceipt is a staff member's acknowledgement of an announcement;
+// AcknowledgedAt is nil while it is pending.
+type AnnouncementReceipt struct {
+	UserID         int64      `json:"user_id"`
+	Username       string     `json:"username"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+}
+
+// AnnouncementReceipts reports who has and who has not acknowledged an
+// announcement.
+type AnnouncementReceipts struct {
+	AnnouncementID uuid.UUID             `json:"announcement_id"`
+	Acknowledged   []AnnouncementReceipt `json:"acknowledged"`
+	Pending        []AnnouncementReceipt `json:"pending"`
+}
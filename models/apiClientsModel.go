@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIClient is an application registered for the public API. RateLimit is
+// the number of requests allowed per minute, MonthlyQuota per calendar month.
+type APIClient struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Name         string     `json:"name"`
+	TokenPrefix  string     `json:"token_prefix"`
+	RateLimit    int        `json:"rate_limit"`
+	MonthlyQuota int        `json:"monthly_quota"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Token is only set in the response that creates the client.
+	Token string `json:"token,omitempty"`
+}
+
+// APIClientUsage is the usage of a client on one day. Bytes counts response
+// bodies.
+type APIClientUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+	Rejected int    `json:"rejected"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// APIClientQuota is how much of its monthly quota a client has used.
+type APIClientQuota struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// APIClientUsageReport is the payload of the usage endpoints. Days lag
+// behind by up to the rollup interval; Quota is current.
+type APIClientUsageReport struct {
+	Quota APIClientQuota   `json:"quota"`
+	Days  []APIClientUsage `json:"days"`
+}
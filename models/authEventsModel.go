@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	AuthEventLoginSucceeded = "login_succeeded"
+	AuthEventLoginFailed    = "login_failed"
+	// AuthEventRefreshTokenReused is recorded when a rotated refresh token is
+	// presented again and its whole token family is revoked.
+	AuthEventRefreshTokenReused = "refresh_token_reused"
+)
+
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	UserID    *int64    `json:"-"`
+	Username  string    `json:"-"`
+	Event     string    `json:"event"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of care records.
+const (
+	CareKindVisit    = "visit"
+	CareKindCall     = "call"
+	CareKindFollowUp = "follow_up"
+)
+
+// Visibilities of care records. Team records are visible to all staff,
+// restricted ones only to their author, their assignee and admins.
+const (
+	CareVisibilityTeam       = "team"
+	CareVisibilityRestricted = "restricted"
+)
+
+// CareRecord is a visit, call or follow-up logged about a member.
+type CareRecord struct {
+	ID         uuid.UUID `json:"id"`
+	MemberID   int64     `json:"member_id"`
+	MemberName string    `json:"member_name"`
+	Kind       string    `json:"kind"`
+	Visibility string    `json:"visibility"`
+	Summary    string    `json:"summary"`
+	Notes      string    `json:"notes"`
+	// PrivateNotes is only sent to the author and admins.
+	PrivateNotes *string    `json:"private_notes,omitempty"`
+	AssignedTo   *int64     `json:"assigned_to"`
+	CreatedBy    *int64     `json:"created_by"`
+	OccurredAt   *time.Time `json:"occurred_at"`
+	// DueAt is when a follow-up should be done; it is required for them.
+	DueAt       *time.Time `json:"due_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
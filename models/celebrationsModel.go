@@ -0,0 +1,27 @@
+package models
+
+// Kinds of celebrations.
+const (
+	CelebrationBirthday    = "birthday"
+	CelebrationAnniversary = "anniversary"
+)
+
+// CelebrationSettings are a member's own birthday, anniversary and whether
+// staff may see them. Dates are YYYY-MM-DD; null removes them.
+type CelebrationSettings struct {
+	Birthday          *string `json:"birthday"`
+	Anniversary       *string `json:"anniversary"`
+	ShareCelebrations bool    `json:"share_celebrations"`
+}
+
+// Celebration is an upcoming birthday or anniversary of a member who shares
+// them. Birthdays never include the age.
+type Celebration struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Kind     string `json:"kind"`
+	// Date is the next occurrence, YYYY-MM-DD.
+	Date string `json:"date"`
+	// Years is only set for anniversaries.
+	Years *int `json:"years,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// WriteConflict is returned with 409 when a write was based on an outdated
+// version. Current is the stored resource and Fields lists where it differs
+// from the rejected write, so the client can merge and retry with
+// CurrentVersion.
+type WriteConflict struct {
+	Error          string          `json:"error"`
+	YourVersion    int             `json:"your_version"`
+	CurrentVersion int             `json:"current_version"`
+	Current        any             `json:"current"`
+	Fields         []FieldConflict `json:"fields"`
+}
+
+type FieldConflict struct {
+	Field  string `json:"field"`
+	Yours  any    `json:"yours"`
+	Theirs any    `json:"theirs"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Consent purposes.
+const (
+	ConsentPhotography    = "photography"
+	ConsentDataProcessing = "data_processing"
+	ConsentEmail          = "email"
+	ConsentSMS            = "sms"
+)
+
+// ConsentPurposes maps every purpose to the answer assumed until the user
+// gives one. Bulk email keeps working for existing members until they opt
+// out; photography and SMS need an explicit yes.
+var ConsentPurposes = map[string]bool{
+	ConsentPhotography:    false,
+	ConsentDataProcessing: true,
+	ConsentEmail:          true,
+	ConsentSMS:            false,
+}
+
+// Sources of consent records.
+const (
+	ConsentSourceUser  = "user"
+	ConsentSourceStaff = "staff"
+)
+
+// Consent is a user's current answer for a purpose. UpdatedAt is nil while
+// the default applies.
+type Consent struct {
+	Purpose   string     `json:"purpose"`
+	Granted   bool       `json:"granted"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ConsentRecord is one consent given or withdrawn.
+type ConsentRecord struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Purpose    string    `json:"purpose"`
+	Granted    bool      `json:"granted"`
+	Source     string    `json:"source"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	RecordedBy *int64    `json:"recorded_by"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CertificatePending = "pending"
+	CertificateReady   = "ready"
+	CertificateFailed  = "failed"
+)
+
+// Course is a class such as the membership or baptism class.
+type Course struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Lessons     []Lesson  `json:"lessons,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Lesson struct {
+	ID        uuid.UUID `json:"id"`
+	CourseID  uuid.UUID `json:"course_id"`
+	Position  int       `json:"position"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CourseProgress is a user's progress through a course they are enrolled in.
+type CourseProgress struct {
+	CourseID           uuid.UUID   `json:"course_id"`
+	CourseTitle        string      `json:"course_title"`
+	EnrolledAt         time.Time   `json:"enrolled_at"`
+	CompletedAt        *time.Time  `json:"completed_at"`
+	TotalLessons       int         `json:"total_lessons"`
+	CompletedLessonIDs []uuid.UUID `json:"completed_lesson_ids"`
+	TotalQuizzes       int         `json:"total_quizzes"`
+	PassedQuizIDs      []uuid.UUID `json:"passed_quiz_ids"`
+	PercentComplete    int         `json:"percent_complete"`
+	CertificateStatus  string      `json:"certificate_status,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "encoding/json"
+
+// Dashboard is the member app's home screen, one entry per section.
+type Dashboard struct {
+	Sections map[string]json.RawMessage `json:"sections"`
+	// Unavailable lists sections that failed to load; the others are still
+	// returned.
+	Unavailable []string `json:"unavailable"`
+}
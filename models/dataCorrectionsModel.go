@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of data correction requests.
+const (
+	CorrectionPending  = "pending"
+	CorrectionApplied  = "applied"
+	CorrectionRejected = "rejected"
+)
+
+// DataCorrectionRequest is a member's request to correct a field of their
+// stored data.
+type DataCorrectionRequest struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username,omitempty"`
+	Field    string    `json:"field"`
+	// CurrentValue is the stored value now, ValueAtRequest the one the member
+	// saw when asking; they differ when the field changed in the meantime.
+	CurrentValue   string `json:"current_value"`
+	ValueAtRequest string `json:"value_at_request"`
+	ProposedValue  string `json:"proposed_value"`
+	Reason         string `json:"reason"`
+	Status         string `json:"status"`
+	ReviewNote     string `json:"review_note"`
+	// AppliedOver is the value an applied correction replaced.
+	AppliedOver *string    `json:"applied_over,omitempty"`
+	ReviewedBy  *int64     `json:"reviewed_by"`
+	ReviewedAt  *time.Time `json:"reviewed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
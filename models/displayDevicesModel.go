@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Display device modes. Every device reads the display endpoints; kiosks
+// may also record gifts and check-ins.
+const (
+	DeviceModeDisplay = "display"
+	DeviceModeKiosk   = "kiosk"
+)
+
+// DisplayDevice is a kiosk or signage screen paired with the API. Its token
+// only grants access to the display endpoints.
+type DisplayDevice struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Mode       string     `json:"mode"`
+	ApprovedBy *int64     `json:"approved_by"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// DevicePairing is returned to a device that asks to be paired. The device
+// shows UserCode for an admin to approve and polls with DeviceCode, waiting
+// Interval seconds between polls, until it gets its token or ExpiresIn
+// seconds have passed.
+type DevicePairing struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	ExpiresIn  int    `json:"expires_in"`
+	Interval   int    `json:"interval"`
+}
+
+// DeviceToken is the credential a paired device receives, once.
+type DeviceToken struct {
+	DeviceID uuid.UUID `json:"device_id"`
+	Token    string    `json:"token"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Extraction statuses of a document's text.
+const (
+	ExtractionPending = "pending"
+	ExtractionDone    = "done"
+	ExtractionFailed  = "failed"
+)
+
+// Document is a file in the document library, such as a policy document or
+// meeting minutes. Its text is extracted in the background and indexed for
+// search.
+type Document struct {
+	ID               uuid.UUID `json:"id"`
+	MediaID          uuid.UUID `json:"media_id"`
+	Title            string    `json:"title"`
+	Filename         string    `json:"filename"`
+	ContentType      string    `json:"content_type"`
+	SizeBytes        int64     `json:"size_bytes"`
+	ExtractionStatus string    `json:"extraction_status"`
+	ExtractionError  *string   `json:"extraction_error"`
+	CreatedBy        *int64    `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// SearchResult is one hit of GET /search. Type is "post" or "document";
+// Snippet is plain text around the matched words; Slug is only set for posts.
+type SearchResult struct {
+	Type    string    `json:"type"`
+	ID      uuid.UUID `json:"id"`
+	Title   string    `json:"title"`
+	Slug    string    `json:"slug,omitempty"`
+	Snippet string    `json:"snippet"`
+	Rank    float64   `json:"rank"`
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Donation statuses. Gifts recorded at a kiosk are completed right away.
+const (
+	DonationStatusPending   = "pending"
+	DonationStatusCompleted = "completed"
+	DonationStatusFailed    = "failed"
+	DonationStatusRefunded  = "refunded"
+)
+
+// Payment providers of online gifts.
+const (
+	PaymentProviderStripe = "stripe"
+	PaymentProviderMpesa  = "mpesa"
+	PaymentProviderPayPal = "paypal"
+)
+
+// Donation is a gift. AmountCents is in the minor unit of Currency. UserID
+// is set when the donor is known; DeviceID when a kiosk recorded it, and
+// Provider when it was given online, with the provider's ID as Reference
+// and, for M-Pesa, the receipt number of the payment as Receipt.
+type Donation struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      *int64     `json:"user_id"`
+	DonorName   string     `json:"donor_name"`
+	AmountCents int64      `json:"amount_cents"`
+	Currency    string     `json:"currency"`
+	Fund        string     `json:"fund"`
+	Method      string     `json:"method"`
+	Status      string     `json:"status"`
+	Reference   *string    `json:"reference"`
+	Provider    *string    `json:"provider"`
+	Receipt     *string    `json:"receipt"`
+	DeviceID    *uuid.UUID `json:"device_id"`
+	GivenAt     time.Time  `json:"given_at"`
+	RecordedAt  time.Time  `json:"recorded_at"`
+}
+
+// DonationIntentRequest asks to start an online gift. Provider defaults to
+// Stripe; M-Pesa gifts name the Phone that is asked to pay.
+type DonationIntentRequest struct {
+	Provider    string `json:"provider"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Fund        string `json:"fund"`
+	DonorName   string `json:"donor_name"`
+	Phone       string `json:"phone"`
+}
+
+// DonationIntent is a started online gift. The client completes a Stripe
+// payment with ClientSecret; M-Pesa prompts the donor's phone, and Message
+// says so; PayPal donors approve the order at ApprovalURL before it is
+// captured. The gift stays pending until the provider confirms it.
+type DonationIntent struct {
+	DonationID   uuid.UUID `json:"donation_id"`
+	Provider     string    `json:"provider"`
+	Reference    string    `json:"reference"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	ApprovalURL  string    `json:"approval_url,omitempty"`
+	AmountCents  int64     `json:"amount_cents"`
+	Currency     string    `json:"currency"`
+	Fund         string    `json:"fund"`
+}
+
+// DonationOutcome is what the page that took an online gift learns about
+// it afterwards; it leaves out who gave.
+type DonationOutcome struct {
+	DonationID  uuid.UUID `json:"donation_id"`
+	Status      string    `json:"status"`
+	AmountCents int64     `json:"amount_cents"`
+	Currency    string    `json:"currency"`
+	Fund        string    `json:"fund"`
+}
+
+// GivingHistory is a page of a donor's gifts, newest first, with the
+// totals of the completed ones in the requested range.
+type GivingHistory struct {
+	Items   []Donation  `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+	Totals  []FundTotal `json:"totals"`
+}
+
+// FundTotal is what was given to a fund in a currency.
+type FundTotal struct {
+	Fund        string `json:"fund"`
+	Currency    string `json:"currency"`
+	AmountCents int64  `json:"amount_cents"`
+	Count       int    `json:"count"`
+}
+
+// CheckIn records someone attending a service, by member or by name.
+type CheckIn struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      *int64     `json:"user_id"`
+	Name        string     `json:"name"`
+	Service     string     `json:"service"`
+	DeviceID    *uuid.UUID `json:"device_id"`
+	CheckedInAt time.Time  `json:"checked_in_at"`
+	RecordedAt  time.Time  `json:"recorded_at"`
+}
+
+// KioskBatch is what a kiosk uploads when it is back online: everything it
+// recorded meanwhile, each under an ID the kiosk generated.
+type KioskBatch struct {
+	Donations []Donation `json:"donations"`
+	CheckIns  []CheckIn  `json:"check_ins"`
+}
+
+// Outcomes of a batch item. A duplicate was already recorded, e.g. by an
+// earlier upload of the same batch; a conflict shares its ID with a
+// different record. Kiosks may drop items that are accepted or duplicates.
+const (
+	KioskItemAccepted  = "accepted"
+	KioskItemDuplicate = "duplicate"
+	KioskItemConflict  = "conflict"
+	KioskItemRejected  = "rejected"
+)
+
+// KioskItemResult is the outcome of one batch item.
+type KioskItemResult struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// KioskBatchResult lists the outcome of every item, in upload order.
+type KioskBatchResult struct {
+	Donations []KioskItemResult `json:"donations"`
+	CheckIns  []KioskItemResult `json:"check_ins"`
+}
+
+const (
+	StatementPending = "pending"
+	StatementReady   = "ready"
+	StatementFailed  = "failed"
+)
+
+// GivingStatement is a donor's year-end giving statement. Once it is ready,
+// DownloadURL is a signed link to the PDF that works without the bearer
+// token until DownloadExpiresAt.
+type GivingStatement struct {
+	ID                uuid.UUID  `json:"id"`
+	Year              int        `json:"year"`
+	Status            string     `json:"status"`
+	RequestedAt       time.Time  `json:"requested_at"`
+	GeneratedAt       *time.Time `json:"generated_at"`
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// GivingStatementRequest asks for the statement of a year that has ended.
+type GivingStatementRequest struct {
+	Year int `json:"year"`
+}
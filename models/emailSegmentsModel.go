@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CampaignDraft   = "draft"
+	CampaignQueued  = "queued"
+	CampaignSending = "sending"
+	CampaignSent    = "sent"
+	CampaignFailed  = "failed"
+)
+
+// SegmentRules select the members of an email segment. Every rule that is set
+// must match; within a rule any of the listed values matches. Only active
+// members are ever included.
+type SegmentRules struct {
+	Tags               []string    `json:"tags,omitempty"`
+	ExcludeTags        []string    `json:"exclude_tags,omitempty"`
+	Roles              []string    `json:"roles,omitempty"`
+	EnrolledCourseIDs  []uuid.UUID `json:"enrolled_course_ids,omitempty"`
+	CompletedCourseIDs []uuid.UUID `json:"completed_course_ids,omitempty"`
+}
+
+// EmailSegment is a saved audience for email campaigns. Its members are
+// evaluated from the rules whenever the segment is used.
+type EmailSegment struct {
+	ID          uuid.UUID    `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Rules       SegmentRules `json:"rules"`
+	CreatedBy   *int64       `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// SegmentMember is a user matched by a segment.
+type SegmentMember struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// EmailCampaign is a bulk email sent to a segment, or to every active member
+// when SegmentID is nil.
+type EmailCampaign struct {
+	ID             uuid.UUID  `json:"id"`
+	Subject        string     `json:"subject"`
+	TextBody       string     `json:"text_body"`
+	HTMLBody       string     `json:"html_body"`
+	SegmentID      *uuid.UUID `json:"segment_id"`
+	Status         string     `json:"status"`
+	RecipientCount int        `json:"recipient_count"`
+	LastError      *string    `json:"last_error"`
+	CreatedBy      *int64     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at"`
+}
+
+// TagCount is a user tag and the number of users carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Users int    `json:"users"`
+}
+
+// EmailCampaignReport holds the delivery and engagement figures of a campaign.
+type EmailCampaignReport struct {
+	CampaignID   uuid.UUID        `json:"campaign_id"`
+	Sent         int              `json:"sent"`
+	Tracked      int              `json:"tracked"`
+	UniqueOpens  int              `json:"unique_opens"`
+	Opens        int              `json:"opens"`
+	UniqueClicks int              `json:"unique_clicks"`
+	Clicks       int              `json:"clicks"`
+	OpenRate     float64          `json:"open_rate"`
+	ClickRate    float64          `json:"click_rate"`
+	Links        []EmailLinkStats `json:"links"`
+}
+
+type EmailLinkStats struct {
+	URL    string `json:"url"`
+	Clicks int    `json:"clicks"`
+}
+
+// EmailStats summarizes recent campaign engagement for the admin dashboard.
+type EmailStats struct {
+	Campaigns    int     `json:"campaigns"`
+	Sent         int     `json:"sent"`
+	Tracked      int     `json:"tracked"`
+	UniqueOpens  int     `json:"unique_opens"`
+	UniqueClicks int     `json:"unique_clicks"`
+	OpenRate     float64 `json:"open_rate"`
+	ClickRate    float64 `json:"click_rate"`
+}
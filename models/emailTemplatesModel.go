@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailTemplate is an email template edited through the admin API. Subject
+// and TextBody use Go text/template syntax ({{.Username}}), HTMLBody uses
+// html/template, which escapes the variables it inserts.
+type EmailTemplate struct {
+	ID             uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Variables      []string  `json:"variables"`
+	Builtin        bool      `json:"builtin"`
+	CurrentVersion int       `json:"current_version"`
+	Subject        string    `json:"subject"`
+	TextBody       string    `json:"text_body"`
+	HTMLBody       string    `json:"html_body"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// EmailTemplateVersion is one saved revision of a template's content.
+type EmailTemplateVersion struct {
+	Version   int       `json:"version"`
+	Subject   string    `json:"subject"`
+	TextBody  string    `json:"text_body"`
+	HTMLBody  string    `json:"html_body"`
+	CreatedBy *int64    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RenderedEmail is the result of previewing a template.
+type RenderedEmail struct {
+	Subject  string `json:"subject"`
+	TextBody string `json:"text_body"`
+	HTMLBody string `json:"html_body"`
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How often a recurring event repeats.
+const (
+	EventFrequencyDaily   = "daily"
+	EventFrequencyWeekly  = "weekly"
+	EventFrequencyMonthly = "monthly"
+)
+
+// Event is a church event, such as a conference or a prayer night. An event
+// with a Recurrence repeats from its first occurrence, StartsAt to EndsAt.
+type Event struct {
+	ID                   uuid.UUID `json:"id"`
+	Title                string    `json:"title"`
+	Description          string    `json:"description"`
+	Location             string    `json:"location"`
+	StartsAt             time.Time `json:"starts_at"`
+	EndsAt               time.Time `json:"ends_at"`
+	RegistrationRequired bool      `json:"registration_required"`
+	// RegistrationURL is where to register, if not with the church office.
+	RegistrationURL string           `json:"registration_url"`
+	Recurrence      *EventRecurrence `json:"recurrence"`
+	// NextOccurrence is the current or next occurrence at the time of the
+	// response, or nil once the event is over.
+	NextOccurrence *EventOccurrence `json:"next_occurrence"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// EventRecurrence repeats an event every Interval days, weeks or months.
+// It stops after Count occurrences or at Until, whichever comes first, or
+// never when neither is set. A monthly event skips the months without its
+// day, like the 31st.
+type EventRecurrence struct {
+	Frequency string     `json:"frequency"`
+	Interval  int        `json:"interval"`
+	Count     int        `json:"count,omitempty"`
+	Until     *time.Time `json:"until"`
+}
+
+// EventOccurrence is one occurrence of an event.
+type EventOccurrence struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// candidate returns the start of the i-th repetition of the event, and
+// whether that date exists.
+func (e Event) candidate(i int) (time.Time, bool) {
+	r := e.Recurrence
+	switch r.Frequency {
+	case EventFrequencyDaily:
+		return e.StartsAt.AddDate(0, 0, i*r.Interval), true
+	case EventFrequencyWeekly:
+		return e.StartsAt.AddDate(0, 0, 7*i*r.Interval), true
+	default:
+		start := e.StartsAt.AddDate(0, i*r.Interval, 0)
+		return start, start.Day() == e.StartsAt.Day()
+	}
+}
+
+// period is the fixed time between repetitions, or 0 for monthly events.
+func (r EventRecurrence) period() time.Duration {
+	switch r.Frequency {
+	case EventFrequencyDaily:
+		return time.Duration(r.Interval) * 24 * time.Hour
+	case EventFrequencyWeekly:
+		return time.Duration(r.Interval) * 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// OccurrenceAt returns the occurrence that is on at now or comes next, or
+// nil when the event is over.
+func (e Event) OccurrenceAt(now time.Time) *EventOccurrence {
+	duration := e.EndsAt.Sub(e.StartsAt)
+	if e.Recurrence == nil {
+		if !e.EndsAt.After(now) {
+			return nil
+		}
+		return &EventOccurrence{StartsAt: e.StartsAt, EndsAt: e.EndsAt}
+	}
+
+	// Daily and weekly events skip straight to the repetitions around now.
+	i := 0
+	if period := e.Recurrence.period(); period > 0 && now.After(e.EndsAt) {
+		i = int(now.Sub(e.EndsAt) / period)
+	}
+	for n := i; ; i++ {
+		start, ok := e.candidate(i)
+		if e.Recurrence.Until != nil && start.After(*e.Recurrence.Until) {
+			return nil
+		}
+		if !ok {
+			continue
+		}
+		if e.Recurrence.Count > 0 && n >= e.Recurrence.Count {
+			return nil
+		}
+		n++
+		if end := start.Add(duration); end.After(now) {
+			return &EventOccurrence{StartsAt: start, EndsAt: end}
+		}
+	}
+}
+
+// OccurrencesBetween returns the occurrences that overlap from to to.
+func (e Event) OccurrencesBetween(from, to time.Time) []EventOccurrence {
+	occurrences := []EventOccurrence{}
+	for occurrence := e.OccurrenceAt(from); occurrence != nil && occurrence.StartsAt.Before(to); occurrence = e.OccurrenceAt(occurrence.EndsAt) {
+		occurrences = append(occurrences, *occurrence)
+	}
+	return occurrences
+}
+
+// LastEndsAt returns the end of the last occurrence, or nil when the event
+// repeats forever.
+func (e Event) LastEndsAt() *time.Time {
+	if e.Recurrence == nil {
+		return &e.EndsAt
+	}
+	if e.Recurrence.Count == 0 && e.Recurrence.Until == nil {
+		return nil
+	}
+
+	var last time.Time
+	for i, n := 0, 0; e.Recurrence.Count == 0 || n < e.Recurrence.Count; i++ {
+		start, ok := e.candidate(i)
+		if e.Recurrence.Until != nil && start.After(*e.Recurrence.Until) {
+			break
+		}
+		if ok {
+			last = start
+			n++
+		}
+	}
+	end := last.Add(e.EndsAt.Sub(e.StartsAt))
+	return &end
+}
+
+// CalendarEntry is an occurrence of an event as shown on the calendar.
+type CalendarEntry struct {
+	EventID  uuid.UUID `json:"event_id"`
+	Title    string    `json:"title"`
+	Location string    `json:"location"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IntegrityAlert struct {
+	ID              int64      `json:"id"`
+	Entity          string     `json:"entity"`
+	EntityID        uuid.UUID  `json:"entity_id"`
+	ExpectedHash    *string    `json:"expected_hash"`
+	ActualHash      string     `json:"actual_hash"`
+	DetectedAt      time.Time  `json:"detected_at"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+	ResolvedBy      *int64     `json:"resolved_by"`
+	ChangesAccepted *bool      `json:"changes_accepted"`
+}
@@ -6,9 +6,155 @@ import (
 	"github.com/google/uuid"
 )
 
+// Live statuses, derived from the schedule.
+const (
+	LiveStatusUpcoming = "upcoming"
+	LiveStatusLive     = "live"
+	LiveStatusEnded    = "ended"
+)
+
+// Platforms a live is streamed to. Links on other sites use
+// LivePlatformOther.
+const (
+	LivePlatformYouTube  = "youtube"
+	LivePlatformFacebook = "facebook"
+	LivePlatformVimeo    = "vimeo"
+	LivePlatformTwitch   = "twitch"
+	LivePlatformOther    = "other"
+)
+
+// LiveLink is where a live can be watched. Exactly one link of a live is
+// primary; it is the one short links and notifications point to.
+type LiveLink struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	Primary  bool   `json:"primary"`
+}
+
 type Live struct {
-	ID        uuid.UUID `json:"id"`
-	Title     string    `json:"title"`
-	Link      string    `json:"link"`
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Links       []LiveLink `json:"links"`
+	Description string     `json:"description"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at"`
+	Speaker     string     `json:"speaker"`
+	// SeriesID is the sermon series the service belongs to, if any.
+	SeriesID *uuid.UUID `json:"series_id"`
+	// Passage is the Bible reading, such as "John 3:16-21".
+	Passage string `json:"passage"`
+	// ArchivedAt is set by ArchiveEndedLives some time after the live ends.
+	ArchivedAt *time.Time `json:"archived_at"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// StatusAt returns whether the live is upcoming, live or ended at now. It is
+// not stored, so that a cached live is never out of date.
+func (l Live) StatusAt(now time.Time) string {
+	switch {
+	case now.Before(l.StartsAt):
+		return LiveStatusUpcoming
+	case now.Before(l.EndsAt):
+		return LiveStatusLive
+	default:
+		return LiveStatusEnded
+	}
+}
+
+// PrimaryLink returns the URL of the primary link, or of the first link if
+// none is marked primary.
+func (l Live) PrimaryLink() string {
+	for _, link := range l.Links {
+		if link.Primary {
+			return link.URL
+		}
+	}
+	if len(l.Links) > 0 {
+		return l.Links[0].URL
+	}
+	return ""
+}
+
+// LivePatch is the body of a partial live update. Fields left out, or null,
+// keep their stored value.
+type LivePatch struct {
+	Title       *string    `json:"title"`
+	Links       []LiveLink `json:"links"`
+	Description *string    `json:"description"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	Speaker     *string    `json:"speaker"`
+	SeriesID    *uuid.UUID `json:"series_id"`
+	Passage     *string    `json:"passage"`
+	// Version, when set, makes the patch conditional like a versioned update.
+	Version int `json:"version"`
+}
+
+// Apply copies the fields set in the patch onto live.
+func (p LivePatch) Apply(live *Live) {
+	if p.Title != nil {
+		live.Title = *p.Title
+	}
+	if p.Links != nil {
+		live.Links = p.Links
+	}
+	if p.Description != nil {
+		live.Description = *p.Description
+	}
+	if p.StartsAt != nil {
+		live.StartsAt = *p.StartsAt
+	}
+	if p.EndsAt != nil {
+		live.EndsAt = *p.EndsAt
+	}
+	if p.Speaker != nil {
+		live.Speaker = *p.Speaker
+	}
+	if p.SeriesID != nil {
+		live.SeriesID = p.SeriesID
+	}
+	if p.Passage != nil {
+		live.Passage = *p.Passage
+	}
+}
+
+// LiveShortLink is the short link of a live. Opening URL redirects to the
+// live's current primary link.
+type LiveShortLink struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	LiveID    uuid.UUID `json:"live_id"`
+	Clicks    int64     `json:"clicks"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// LiveViewerStats summarizes the viewers of a live, counted from player
+// heartbeats. Counts are HyperLogLog estimates, accurate to about 1%.
+type LiveViewerStats struct {
+	LiveID        uuid.UUID `json:"live_id"`
+	UniqueViewers int64     `json:"unique_viewers"`
+	// ConcurrentNow counts the viewers of the current minute; it is 0 once
+	// the live is over.
+	ConcurrentNow     int64              `json:"concurrent_now"`
+	PeakConcurrent    int64              `json:"peak_concurrent"`
+	PeakAt            *time.Time         `json:"peak_at"`
+	AverageConcurrent float64            `json:"average_concurrent"`
+	Minutes           []LiveViewerMinute `json:"minutes"`
+}
+
+// LiveViewerMinute is the number of viewers watching during a minute.
+type LiveViewerMinute struct {
+	Minute  time.Time `json:"minute"`
+	Viewers int64     `json:"viewers"`
+}
+
+// LiveChatToken signs a user into the chat room of a live until ExpiresAt.
+type LiveChatToken struct {
+	Token     string    `json:"token"`
+	Room      string    `json:"room"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PostImage is an image uploaded for use in posts. ReferenceCount is the
+// number of posts whose body links to the image or its thumbnail; referenced
+// images cannot be deleted.
+type PostImage struct {
+	ID             uuid.UUID  `json:"id"`
+	URL            string     `json:"url"`
+	ThumbnailID    uuid.UUID  `json:"thumbnail_id"`
+	ThumbnailURL   string     `json:"thumbnail_url"`
+	Filename       string     `json:"filename"`
+	ContentType    string     `json:"content_type"`
+	Width          int        `json:"width"`
+	Height         int        `json:"height"`
+	SizeBytes      int64      `json:"size_bytes"`
+	ReferenceCount int        `json:"reference_count"`
+	UnusedSince    *time.Time `json:"unused_since"`
+	CreatedBy      *int64     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
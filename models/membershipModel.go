@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Membership statuses. Users start as visitors.
+const (
+	MembershipVisitor  = "visitor"
+	MembershipRegular  = "regular"
+	MembershipMember   = "member"
+	MembershipInactive = "inactive"
+)
+
+// Membership is a user's current status and how they got there, newest
+// change first.
+type Membership struct {
+	UserID   int64                  `json:"user_id"`
+	Username string                 `json:"username"`
+	Email    string                 `json:"email"`
+	Status   string                 `json:"status"`
+	Since    time.Time              `json:"since"`
+	History  []MembershipTransition `json:"history,omitempty"`
+}
+
+// MembershipTransition is one status change.
+type MembershipTransition struct {
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username,omitempty"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ChangedBy  *int64    `json:"changed_by"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// MembershipRequirement lists the courses a user must complete before
+// moving to Status.
+type MembershipRequirement struct {
+	Status    string      `json:"status"`
+	CourseIDs []uuid.UUID `json:"course_ids"`
+}
+
+// MembershipSummary counts users by status, and the changes in a period.
+type MembershipSummary struct {
+	Counts      map[string]int `json:"counts"`
+	Transitions map[string]int `json:"transitions"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+}
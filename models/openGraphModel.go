@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// OpenGraph is the social preview of a resource: the Open Graph tags
+// (og:title, og:description, ...) with the matching Twitter Card.
+type OpenGraph struct {
+	Type        string `json:"type"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	URL         string `json:"url"`
+	SiteName    string `json:"site_name"`
+	// PublishedTime and ModifiedTime are the article:* tags of posts.
+	PublishedTime *time.Time  `json:"published_time,omitempty"`
+	ModifiedTime  *time.Time  `json:"modified_time,omitempty"`
+	Twitter       TwitterCard `json:"twitter"`
+}
+
+// TwitterCard holds the twitter:* tags.
+type TwitterCard struct {
+	Card        string `json:"card"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+}
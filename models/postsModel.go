@@ -1,14 +1,136 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/google/uuid"
 	"time"
 )
 
+// Post statuses. Only published posts are served to the public.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
 type Post struct {
-	ID        uuid.UUID `json:"id"`
-	Title     string    `json:"title"`
-	Excerpt   string    `json:"excerpt"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Excerpt     string     `json:"excerpt"`
+	Body        string     `json:"body"`
+	Status      string     `json:"status"`
+	Version     int        `json:"version"`
+	ContentHash string     `json:"-"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// UpdatedAt is when the content last changed, kept by the database.
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the post is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ReadingTimeMinutes is estimated from the body on every write.
+	ReadingTimeMinutes int `json:"reading_time_minutes"`
+	// Views is counted in Redis; it is filled in on reads, not cached.
+	Views int64 `json:"views"`
+	// The SEO fields are optional; the frontend falls back to the title,
+	// the excerpt and the post's own URL.
+	CoverImageURL   string `json:"cover_image_url"`
+	MetaTitle       string `json:"meta_title"`
+	MetaDescription string `json:"meta_description"`
+	CanonicalURL    string `json:"canonical_url"`
+}
+
+// ComputeContentHash returns the SHA-256 checksum of the post content. It is
+// stored whenever the API writes a post, so edits made directly in the
+// database can be detected later.
+func (p *Post) ComputeContentHash() string {
+	sum := sha256.Sum256([]byte(p.Title + "\x1f" + p.Excerpt + "\x1f" + p.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+// PostArchiveMonth is the number of posts published in a month.
+type PostArchiveMonth struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Count int `json:"count"`
+}
+
+// PostSuggestion is a title match for a search box.
+type PostSuggestion struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+	Slug  string    `json:"slug"`
+}
+
+// PostPatch is the body of a partial post update. Fields left out, or null,
+// keep their stored value; timestamps cannot be patched.
+type PostPatch struct {
+	Title   *string `json:"title"`
+	Slug    *string `json:"slug"`
+	Excerpt *string `json:"excerpt"`
+	Body    *string `json:"body"`
+	Status  *string `json:"status"`
+
+	CoverImageURL   *string `json:"cover_image_url"`
+	MetaTitle       *string `json:"meta_title"`
+	MetaDescription *string `json:"meta_description"`
+	CanonicalURL    *string `json:"canonical_url"`
+	// Version, when set, makes the patch conditional like a versioned update.
+	Version int `json:"version"`
+}
+
+// Apply copies the fields set in the patch onto post.
+func (p PostPatch) Apply(post *Post) {
+	if p.Title != nil {
+		post.Title = *p.Title
+	}
+	if p.Slug != nil {
+		post.Slug = *p.Slug
+	}
+	if p.Excerpt != nil {
+		post.Excerpt = *p.Excerpt
+	}
+	if p.Body != nil {
+		post.Body = *p.Body
+	}
+	if p.Status != nil {
+		post.Status = *p.Status
+	}
+	if p.CoverImageURL != nil {
+		post.CoverImageURL = *p.CoverImageURL
+	}
+	if p.MetaTitle != nil {
+		post.MetaTitle = *p.MetaTitle
+	}
+	if p.MetaDescription != nil {
+		post.MetaDescription = *p.MetaDescription
+	}
+	if p.CanonicalURL != nil {
+		post.CanonicalURL = *p.CanonicalURL
+	}
+}
+
+// PostStats summarizes posts that are not deleted for the admin dashboard.
+type PostStats struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	// PerMonth counts posts by the month they were published, or created
+	// for drafts, over the last twelve months, oldest first.
+	PerMonth []PostMonthCount `json:"per_month"`
+	// TopSeries lists the series with the most posts. Posts are not tagged,
+	// so series are the grouping the dashboard shows in place of tags.
+	TopSeries        []PostSeriesCount `json:"top_series"`
+	AverageWordCount float64           `json:"average_word_count"`
+}
+
+type PostMonthCount struct {
+	Month string `json:"month"`
+	Posts int    `json:"posts"`
+}
+
+type PostSeriesCount struct {
+	SeriesID string `json:"series_id"`
+	Title    string `json:"title"`
+	Posts    int    `json:"posts"`
 }
@@ -0,0 +1,27 @@
+package models
+
+// PublicConfig is the non-sensitive runtime configuration served to the
+// frontend so that it does not hardcode per-deployment differences.
+type PublicConfig struct {
+	Version        string          `json:"version"`
+	Environment    string          `json:"environment"`
+	PreviewBanner  string          `json:"preview_banner,omitempty"`
+	Branding       Branding        `json:"branding"`
+	FeatureFlags   map[string]bool `json:"feature_flags"`
+	ServiceTimes   []ServiceTime   `json:"service_times"`
+	EnabledModules []string        `json:"enabled_modules"`
+}
+
+type Branding struct {
+	Name         string `json:"name"`
+	Tagline      string `json:"tagline"`
+	LogoURL      string `json:"logo_url"`
+	PrimaryColor string `json:"primary_color"`
+}
+
+type ServiceTime struct {
+	Name     string `json:"name"`
+	Day      string `json:"day"`
+	Time     string `json:"time"`
+	Location string `json:"location"`
+}
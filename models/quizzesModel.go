@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quiz is an assessment that must be passed to complete its course.
+// MaxAttempts of 0 allows unlimited attempts.
+type Quiz struct {
+	ID          uuid.UUID      `json:"id"`
+	CourseID    uuid.UUID      `json:"course_id"`
+	Title       string         `json:"title"`
+	PassPercent int            `json:"pass_percent"`
+	MaxAttempts int            `json:"max_attempts"`
+	Questions   []QuizQuestion `json:"questions,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// QuizQuestion is a multiple choice question. CorrectOption indexes Options
+// and is only shown to admins.
+type QuizQuestion struct {
+	ID            uuid.UUID `json:"id"`
+	Position      int       `json:"position"`
+	Prompt        string    `json:"prompt"`
+	Options       []string  `json:"options"`
+	CorrectOption *int      `json:"correct_option,omitempty"`
+}
+
+// QuizAttempt is a graded submission. Answers maps question IDs to the index
+// of the chosen option.
+type QuizAttempt struct {
+	ID           uuid.UUID         `json:"id"`
+	QuizID       uuid.UUID         `json:"quiz_id"`
+	ScorePercent int               `json:"score_percent"`
+	Passed       bool              `json:"passed"`
+	Answers      map[uuid.UUID]int `json:"answers"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// QuizResult is returned after grading a submission. It says which answers
+// were correct without revealing the correct options.
+type QuizResult struct {
+	Attempt           QuizAttempt        `json:"attempt"`
+	Correct           map[uuid.UUID]bool `json:"correct"`
+	AttemptsRemaining *int               `json:"attempts_remaining"`
+	Progress          *CourseProgress    `json:"progress,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Redirect sends requests for a path that moved to its new location.
+// Automatic redirects are created when a post's slug changes.
+type Redirect struct {
+	FromPath   string    `json:"from_path"`
+	ToPath     string    `json:"to_path"`
+	StatusCode int       `json:"status_code"`
+	Automatic  bool      `json:"automatic"`
+	CreatedBy  *int64    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ResolvedPath is the answer of GET /resolve. Content paths come back with
+// StatusCode 200 and the content's type and ID; moved paths with the redirect
+// status code and Location.
+type ResolvedPath struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location,omitempty"`
+	Type       string `json:"type,omitempty"`
+	ID         string `json:"id,omitempty"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Safeguarding report statuses.
+const (
+	SafeguardingOpen          = "open"
+	SafeguardingInvestigating = "investigating"
+	SafeguardingClosed        = "closed"
+)
+
+// Actions recorded in the safeguarding audit log.
+const (
+	SafeguardingActionSubmit = "submit"
+	SafeguardingActionList   = "list"
+	SafeguardingActionView   = "view"
+	SafeguardingActionUpdate = "update"
+	SafeguardingActionExport = "export"
+)
+
+// SafeguardingContent is the sealed part of a report.
+type SafeguardingContent struct {
+	SubjectName string `json:"subject_name"`
+	Location    string `json:"location"`
+	Details     string `json:"details"`
+}
+
+// SafeguardingReport is an incident report. Content is only filled in for
+// officers reading a single report.
+type SafeguardingReport struct {
+	ID         uuid.UUID            `json:"id"`
+	Category   string               `json:"category"`
+	Status     string               `json:"status"`
+	Content    *SafeguardingContent `json:"content,omitempty"`
+	ReportedBy *int64               `json:"reported_by"`
+	OccurredAt *time.Time           `json:"occurred_at"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// SafeguardingSubmission is the body of a new report.
+type SafeguardingSubmission struct {
+	Category   string     `json:"category"`
+	OccurredAt *time.Time `json:"occurred_at"`
+	SafeguardingContent
+}
+
+// SafeguardingOfficer is a user appointed to handle reports.
+type SafeguardingOfficer struct {
+	UserID      int64     `json:"user_id"`
+	Username    string    `json:"username"`
+	AppointedBy *int64    `json:"appointed_by"`
+	AppointedAt time.Time `json:"appointed_at"`
+}
+
+// SafeguardingAccess is an entry of the safeguarding audit log.
+type SafeguardingAccess struct {
+	ID        int64      `json:"id"`
+	ReportID  *uuid.UUID `json:"report_id"`
+	UserID    int64      `json:"user_id"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason"`
+	IPAddress string     `json:"ip_address"`
+	CreatedAt time.Time  `json:"created_at"`
+}
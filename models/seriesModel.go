@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Series groups posts, such as the parts of a sermon series, in order.
+// PostIDs sets the order on writes; Posts lists the published parts on
+// reads.
+type Series struct {
+	ID          uuid.UUID    `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	PostIDs     []uuid.UUID  `json:"post_ids,omitempty"`
+	Posts       []SeriesPost `json:"posts"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// SeriesPost is a post as listed in a series. Position counts from 1 and
+// may skip numbers of parts that are not published.
+type SeriesPost struct {
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Slug     string    `json:"slug"`
+	Position int       `json:"position"`
+}
+
+// SeriesLinks places a post within its series for single-post responses.
+type SeriesLinks struct {
+	ID       uuid.UUID   `json:"id"`
+	Title    string      `json:"title"`
+	Previous *SeriesPost `json:"previous"`
+	Next     *SeriesPost `json:"next"`
+}
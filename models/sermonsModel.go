@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sermon is a sermon as preached, with its audio and video recordings.
+// PreachedOn is formatted as YYYY-MM-DD.
+type Sermon struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Speaker     string     `json:"speaker"`
+	SeriesID    *uuid.UUID `json:"series_id"`
+	PreachedOn  string     `json:"preached_on"`
+	AudioURL    string     `json:"audio_url"`
+	VideoURL    string     `json:"video_url"`
+	// DurationSeconds is the length of the recording, 0 when unknown.
+	DurationSeconds int `json:"duration_seconds"`
+	// ScriptureReferences are the passages preached on, such as
+	// "John 3:16-21"; Books are their books, derived on write.
+	ScriptureReferences []string  `json:"scripture_references"`
+	Books               []string  `json:"books"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
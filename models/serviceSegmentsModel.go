@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceSegment is one item of a live service's order of service.
+type ServiceSegment struct {
+	ID              uuid.UUID    `json:"id"`
+	LiveID          uuid.UUID    `json:"live_id"`
+	Position        int          `json:"position"`
+	Title           string       `json:"title"`
+	Owner           string       `json:"owner"`
+	DurationSeconds int          `json:"duration_seconds"`
+	Notes           string       `json:"notes"`
+	Attachments     []Attachment `json:"attachments"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+type Attachment struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Rundown is the full order of service of a live.
+type Rundown struct {
+	LiveID               uuid.UUID        `json:"live_id"`
+	TotalDurationSeconds int              `json:"total_duration_seconds"`
+	Segments             []ServiceSegment `json:"segments"`
+}
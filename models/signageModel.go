@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SignagePlaylist is a list of slides shown on signage displays. A playlist
+// without StartsAt is a default; a scheduled playlist replaces it between
+// StartsAt and EndsAt.
+type SignagePlaylist struct {
+	ID        uuid.UUID      `json:"id"`
+	Name      string         `json:"name"`
+	Slides    []SignageSlide `json:"slides"`
+	StartsAt  *time.Time     `json:"starts_at"`
+	EndsAt    *time.Time     `json:"ends_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// SignageSlide is one slide of a playlist. Kind is "announcement", "verse"
+// or "event". A slide with its own schedule is only shown while it runs.
+type SignageSlide struct {
+	Kind            string     `json:"kind"`
+	Title           string     `json:"title"`
+	Body            string     `json:"body,omitempty"`
+	ImageURL        string     `json:"image_url,omitempty"`
+	DurationSeconds int        `json:"duration_seconds"`
+	StartsAt        *time.Time `json:"starts_at,omitempty"`
+	EndsAt          *time.Time `json:"ends_at,omitempty"`
+}
+
+// SignageFeed is what displays poll: the slides of the active playlist that
+// are showing now. PlaylistID is nil when no playlist is active.
+type SignageFeed struct {
+	PlaylistID *uuid.UUID     `json:"playlist_id"`
+	Slides     []SignageSlide `json:"slides"`
+}
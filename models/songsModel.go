@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Song struct {
+	ID              uuid.UUID `json:"id"`
+	Title           string    `json:"title"`
+	Author          string    `json:"author"`
+	CCLINumber      string    `json:"ccli_number"`
+	Key             string    `json:"key"`
+	LyricsReference string    `json:"lyrics_reference"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WorshipSet is the list of songs sung at a service. ServiceDate is formatted
+// as YYYY-MM-DD and decides the CCLI reporting period the set belongs to.
+type WorshipSet struct {
+	ID          uuid.UUID   `json:"id"`
+	LiveID      *uuid.UUID  `json:"live_id"`
+	ServiceDate string      `json:"service_date"`
+	Notes       string      `json:"notes"`
+	SongIDs     []uuid.UUID `json:"song_ids,omitempty"`
+	Songs       []Song      `json:"songs"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// CCLIUsage is one line of a CCLI copy report: how many services used a song
+// within the reporting period.
+type CCLIUsage struct {
+	CCLINumber string `json:"ccli_number"`
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Uses       int    `json:"uses"`
+	FirstUsed  string `json:"first_used"`
+	LastUsed   string `json:"last_used"`
+}
+
+type CCLIReport struct {
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Songs []CCLIUsage `json:"songs"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EntityChanges lists the IDs of one entity type that changed since the
+// client's last sync. Deleted IDs are tombstones: the client drops them.
+type EntityChanges struct {
+	Created []uuid.UUID `json:"created"`
+	Updated []uuid.UUID `json:"updated"`
+	Deleted []uuid.UUID `json:"deleted"`
+}
+
+// SyncResponse is the payload of GET /sync. Clients send ServerTime as since
+// in their next sync. Reset means the changes cannot be listed, because since
+// is too old or too much changed, and the client must reload everything.
+type SyncResponse struct {
+	ServerTime time.Time                `json:"server_time"`
+	Reset      bool                     `json:"reset,omitempty"`
+	Entities   map[string]EntityChanges `json:"entities"`
+}
@@ -4,14 +4,36 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
+
 type User struct {
 	ID        int64  `json:"id"`
 	Username  string `json:"username"`
 	Email     string `json:"email"`
 	Password  string `json:"password"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
 	CreatedAt string `json:"created_at"`
 }
 
+// Profile is the public view of the authenticated user returned by /auth/me.
+type Profile struct {
+	ID                  int64   `json:"id"`
+	Username            string  `json:"username"`
+	Email               string  `json:"email"`
+	Role                string  `json:"role"`
+	Status              string  `json:"status"`
+	AvatarURL           *string `json:"avatar_url"`
+	EmailTrackingOptOut bool    `json:"email_tracking_opt_out"`
+	Birthday            *string `json:"birthday"`
+	Anniversary         *string `json:"anniversary"`
+	ShareCelebrations   bool    `json:"share_celebrations"`
+	CreatedAt           string  `json:"created_at"`
+}
+
 // HashPassword hashes the user's password
 func (u *User) HashPassword() error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
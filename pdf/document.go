@@ -0,0 +1,149 @@
+// Package pdf writes simple PDF documents using the standard Helvetica fonts,
+// which every PDF reader provides, so no fonts or external tools are needed.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page sizes in points.
+const (
+	A4Width  = 595.0
+	A4Height = 842.0
+)
+
+// Font is one of the standard PDF fonts.
+type Font string
+
+const (
+	Helvetica     Font = "F1"
+	HelveticaBold Font = "F2"
+)
+
+// Document is a PDF under construction. Drawing happens on the last page.
+type Document struct {
+	Width  float64
+	Height float64
+	pages  []*bytes.Buffer
+}
+
+// NewDocument creates a document with one empty page of the given size in points.
+func NewDocument(width, height float64) *Document {
+	d := &Document{Width: width, Height: height}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page; subsequent drawing goes to it.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages.
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *Document) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// Text draws text with its baseline starting at x, y, measured from the
+// bottom-left corner of the page.
+func (d *Document) Text(font Font, size, x, y float64, text string) {
+	fmt.Fprintf(d.page(), "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(text))
+}
+
+// CenteredText draws text horizontally centred on the page.
+func (d *Document) CenteredText(font Font, size, y float64, text string) {
+	d.Text(font, size, (d.Width-TextWidth(font, size, text))/2, y, text)
+}
+
+// RightAlignedText draws text ending at x.
+func (d *Document) RightAlignedText(font Font, size, x, y float64, text string) {
+	d.Text(font, size, x-TextWidth(font, size, text), y, text)
+}
+
+// Rect strokes a rectangle with the given line width.
+func (d *Document) Rect(x, y, width, height, lineWidth float64) {
+	fmt.Fprintf(d.page(), "%.2f w %.2f %.2f %.2f %.2f re S\n", lineWidth, x, y, width, height)
+}
+
+// Line strokes a straight line with the given line width.
+func (d *Document) Line(x1, y1, x2, y2, lineWidth float64) {
+	fmt.Fprintf(d.page(), "%.2f w %.2f %.2f m %.2f %.2f l S\n", lineWidth, x1, y1, x2, y2)
+}
+
+// Bytes renders the document.
+func (d *Document) Bytes() []byte {
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes
+	// two objects: the page and its content stream.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	for i, page := range d.pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", d.Width, d.Height, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.Bytes()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+// escape encodes text for a PDF string literal. Characters outside Latin-1
+// cannot be drawn with the standard fonts and are replaced with "?".
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// TextWidth estimates the width of text in points. Helvetica has no fixed
+// width, so average glyph widths are used; this is close enough for centring.
+func TextWidth(font Font, size float64, text string) float64 {
+	average := 0.52
+	if font == HelveticaBold {
+		average = 0.56
+	}
+	return float64(len([]rune(text))) * size * average
+}
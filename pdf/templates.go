@@ -0,0 +1,269 @@
+package pdf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Template names.
+const (
+	TemplateCourseCertificate = "course_certificate"
+	TemplateGivingStatement   = "giving_statement"
+	TemplateEventTicket       = "event_ticket"
+)
+
+const organisationName = "Jehovah Shammah Ministries International"
+
+var ErrUnknownTemplate = errors.New("unknown PDF template")
+
+// template decodes its data from JSON and draws the document.
+type template func(data json.RawMessage) (*Document, error)
+
+var templates = map[string]template{
+	TemplateCourseCertificate: decodeAndRender(renderCourseCertificate),
+	TemplateGivingStatement:   decodeAndRender(renderGivingStatement),
+	TemplateEventTicket:       decodeAndRender(renderEventTicket),
+}
+
+func decodeAndRender[T any](render func(T) (*Document, error)) template {
+	return func(data json.RawMessage) (*Document, error) {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("invalid template data: %w", err)
+		}
+		return render(v)
+	}
+}
+
+// HasTemplate reports whether a template with the given name exists.
+func HasTemplate(name string) bool {
+	_, ok := templates[name]
+	return ok
+}
+
+// Render fills the named template with data and returns the PDF.
+func Render(name string, data json.RawMessage) ([]byte, error) {
+	render, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTemplate, name)
+	}
+	doc, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Bytes(), nil
+}
+
+// CertificateData fills the course completion certificate.
+type CertificateData struct {
+	Name        string    `json:"name"`
+	CourseTitle string    `json:"course_title"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func renderCourseCertificate(data CertificateData) (*Document, error) {
+	if data.Name == "" || data.CourseTitle == "" {
+		return nil, errors.New("certificate needs a name and a course title")
+	}
+
+	doc := NewDocument(A4Height, A4Width)
+	doc.Rect(24, 24, doc.Width-48, doc.Height-48, 3)
+	doc.Rect(32, 32, doc.Width-64, doc.Height-64, 1)
+
+	doc.CenteredText(HelveticaBold, 34, 440, "Certificate of Completion")
+	doc.CenteredText(Helvetica, 16, 380, "This certifies that")
+	doc.CenteredText(HelveticaBold, 28, 330, data.Name)
+	doc.Line(doc.Width/2-180, 318, doc.Width/2+180, 318, 1)
+	doc.CenteredText(Helvetica, 16, 280, "has completed the course")
+	doc.CenteredText(HelveticaBold, 22, 240, data.CourseTitle)
+	doc.CenteredText(Helvetica, 14, 170, "Completed on "+data.CompletedAt.Format("2 January 2006"))
+	doc.CenteredText(Helvetica, 12, 90, organisationName)
+
+	return doc, nil
+}
+
+// GivingStatementData fills a donor's giving statement. Amounts are in the
+// currency's minor unit (e.g. cents). Lines are in Currency unless they name
+// their own. Letterhead lines, such as the ministry's address, are printed
+// under its name.
+type GivingStatementData struct {
+	DonorName  string       `json:"donor_name"`
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	Currency   string       `json:"currency"`
+	Letterhead []string     `json:"letterhead,omitempty"`
+	Lines      []GivingLine `json:"lines"`
+}
+
+type GivingLine struct {
+	Date     string `json:"date"`
+	Fund     string `json:"fund"`
+	Method   string `json:"method"`
+	Receipt  string `json:"receipt,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Amount   int64  `json:"amount"`
+}
+
+const (
+	givingLinesPerPage = 26
+	// maxLetterheadLines is what fits between the ministry's name and the
+	// statement's title.
+	maxLetterheadLines = 3
+	// givingFooterY is the baseline of the footer; the totals stay above it.
+	givingFooterY = 60
+)
+
+func renderGivingStatement(data GivingStatementData) (*Document, error) {
+	if data.DonorName == "" || data.Currency == "" {
+		return nil, errors.New("giving statement needs a donor name and a currency")
+	}
+	if len(data.Letterhead) > maxLetterheadLines {
+		return nil, fmt.Errorf("giving statement letterhead has at most %d lines", maxLetterheadLines)
+	}
+
+	doc := NewDocument(A4Width, A4Height)
+	// Totals are kept per currency and per fund, in the order first given.
+	type fundCurrency struct{ fund, currency string }
+	var (
+		currencies []string
+		funds      []fundCurrency
+		byCurrency = map[string]int64{}
+		byFund     = map[fundCurrency]int64{}
+	)
+	y := 0.0
+	for i, line := range data.Lines {
+		if i%givingLinesPerPage == 0 {
+			if i > 0 {
+				doc.AddPage()
+			}
+			y = givingStatementHeader(doc, data)
+		}
+		currency := line.Currency
+		if currency == "" {
+			currency = data.Currency
+		}
+		doc.Text(Helvetica, 10, 50, y, line.Date)
+		doc.Text(Helvetica, 10, 130, y, line.Fund)
+		doc.Text(Helvetica, 10, 230, y, line.Method)
+		doc.Text(Helvetica, 10, 320, y, line.Receipt)
+		doc.RightAlignedText(Helvetica, 10, 545, y, currency+" "+formatAmount(line.Amount))
+		y -= 18
+
+		if _, ok := byCurrency[currency]; !ok {
+			currencies = append(currencies, currency)
+		}
+		byCurrency[currency] += line.Amount
+		fund := fundCurrency{line.Fund, currency}
+		if _, ok := byFund[fund]; !ok {
+			funds = append(funds, fund)
+		}
+		byFund[fund] += line.Amount
+	}
+	if len(data.Lines) == 0 {
+		y = givingStatementHeader(doc, data)
+		doc.Text(Helvetica, 10, 50, y, "No gifts were recorded in this period.")
+		y -= 18
+		currencies = []string{data.Currency}
+	}
+
+	// The totals move to a page of their own when they do not fit.
+	rows := len(currencies)
+	if len(funds) > 1 {
+		rows += len(funds) + 2
+	}
+	if y-float64(rows)*16-24 < givingFooterY+20 {
+		doc.AddPage()
+		y = givingStatementHeader(doc, data)
+	}
+
+	doc.Line(50, y+8, 545, y+8, 1)
+	for _, currency := range currencies {
+		doc.Text(HelveticaBold, 11, 50, y-8, "Total")
+		doc.RightAlignedText(HelveticaBold, 11, 545, y-8, currency+" "+formatAmount(byCurrency[currency]))
+		y -= 16
+	}
+	if len(funds) > 1 {
+		y -= 16
+		doc.Text(HelveticaBold, 10, 50, y, "By fund")
+		y -= 16
+		for _, fund := range funds {
+			doc.Text(Helvetica, 10, 50, y, fund.fund)
+			doc.RightAlignedText(Helvetica, 10, 545, y, fund.currency+" "+formatAmount(byFund[fund]))
+			y -= 16
+		}
+	}
+	doc.Text(Helvetica, 9, 50, givingFooterY, "Thank you for your faithful giving. No goods or services were provided in exchange for these gifts.")
+
+	return doc, nil
+}
+
+// givingStatementHeader draws the letterhead and page header and returns the
+// y of the first line.
+func givingStatementHeader(doc *Document, data GivingStatementData) float64 {
+	doc.Text(HelveticaBold, 16, 50, 790, organisationName)
+	y := 774.0
+	for _, line := range data.Letterhead {
+		doc.Text(Helvetica, 9, 50, y, line)
+		y -= 12
+	}
+	doc.Line(50, 742, 545, 742, 1)
+	if doc.PageCount() > 1 {
+		doc.RightAlignedText(Helvetica, 9, 545, 790, fmt.Sprintf("Page %d", doc.PageCount()))
+	}
+
+	doc.Text(HelveticaBold, 18, 50, 712, "Giving Statement")
+	doc.Text(Helvetica, 11, 50, 690, "Donor: "+data.DonorName)
+	doc.Text(Helvetica, 11, 50, 674, "Period: "+data.From+" to "+data.To)
+
+	doc.Text(HelveticaBold, 10, 50, 646, "Date")
+	doc.Text(HelveticaBold, 10, 130, 646, "Fund")
+	doc.Text(HelveticaBold, 10, 230, 646, "Method")
+	doc.Text(HelveticaBold, 10, 320, 646, "Receipt")
+	doc.RightAlignedText(HelveticaBold, 10, 545, 646, "Amount")
+	doc.Line(50, 638, 545, 638, 1)
+	return 622
+}
+
+func formatAmount(minor int64) string {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// EventTicketData fills an event admission ticket.
+type EventTicketData struct {
+	EventTitle   string    `json:"event_title"`
+	StartsAt     time.Time `json:"starts_at"`
+	Location     string    `json:"location"`
+	AttendeeName string    `json:"attendee_name"`
+	TicketCode   string    `json:"ticket_code"`
+}
+
+func renderEventTicket(data EventTicketData) (*Document, error) {
+	if data.EventTitle == "" || data.TicketCode == "" {
+		return nil, errors.New("ticket needs an event title and a ticket code")
+	}
+
+	// A6 landscape fits a phone screen and prints on a quarter of an A4 sheet.
+	doc := NewDocument(420, 298)
+	doc.Rect(12, 12, doc.Width-24, doc.Height-24, 2)
+	doc.Text(Helvetica, 10, 30, 260, organisationName)
+	doc.Text(HelveticaBold, 20, 30, 228, data.EventTitle)
+	doc.Text(Helvetica, 12, 30, 196, data.StartsAt.Format("Monday 2 January 2006, 15:04"))
+	if data.Location != "" {
+		doc.Text(Helvetica, 12, 30, 178, data.Location)
+	}
+	if data.AttendeeName != "" {
+		doc.Text(Helvetica, 12, 30, 140, "Admit: "+data.AttendeeName)
+	}
+	doc.Line(30, 110, doc.Width-30, 110, 1)
+	doc.Text(Helvetica, 10, 30, 84, "Ticket code")
+	doc.Text(HelveticaBold, 24, 30, 56, data.TicketCode)
+
+	return doc, nil
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"jsmi-api/auth"
 	"jsmi-api/controllers"
 	"jsmi-api/db"
+	"jsmi-api/metrics"
 	"jsmi-api/middlewares"
 	"net/http"
 	"net/http/pprof"
@@ -16,16 +18,21 @@ func SetupRoutes(config *db.Config) http.Handler {
 	router := mux.NewRouter()
 	authHandler := &controllers.AuthHandler{
 		Config: config,
+		Users:  auth.NewUserService(db.DB, db.RedisClient),
 	}
 
 	// Apply global middlewares
 	router.Use(middlewares.CorsMiddleware(&middlewares.CorsConfig{
 		AllowedOrigins:   []string{"http://0.0.0.0:3000", "http://localhost:8000", "https://www.jehovahshammahministriesinternational.org"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", middlewares.CSRFHeaderName, middlewares.ImpersonationHeaderName, middlewares.ClientTokenHeaderName, middlewares.DeviceTokenHeaderName},
+		ExposedHeaders:   []string{middlewares.EnvironmentHeaderName, "ETag", "Location"},
 		AllowCredentials: true,
 	}))
+	router.Use(middlewares.EnvironmentMiddleware)
 	router.Use(middlewares.LoggingMiddleware)
+	router.Use(metrics.Middleware)
+	router.Use(middlewares.CSRFMiddleware("/auth/login", "/auth/register"))
 
 	// Initialize rate limiter and apply to all routes
 	rateLimiter := middlewares.NewRateLimiter(30, time.Minute, 2*time.Minute)
@@ -40,6 +47,46 @@ func SetupRoutes(config *db.Config) http.Handler {
 	controllers.SetupPostRoutes(protectedRouter)
 	controllers.SetupLiveRoutes(protectedRouter)
 	authHandler.SetupUserRoutes(protectedRouter)
+	controllers.SetupAdminRoutes(protectedRouter, authHandler)
+	controllers.SetupMediaRoutes(protectedRouter)
+	controllers.SetupConfigRoutes(protectedRouter)
+	controllers.SetupSongRoutes(protectedRouter)
+	controllers.SetupCourseRoutes(protectedRouter)
+	controllers.SetupUpdateRoutes(protectedRouter)
+	controllers.SetupSyncRoutes(protectedRouter)
+	controllers.SetupDocumentRoutes(protectedRouter)
+	controllers.SetupSearchRoutes(protectedRouter)
+	controllers.SetupRedirectRoutes(protectedRouter)
+	controllers.SetupSeriesRoutes(protectedRouter)
+	controllers.SetupMembershipRoutes(protectedRouter)
+	controllers.SetupCareRoutes(protectedRouter)
+	controllers.SetupCelebrationRoutes(protectedRouter)
+	controllers.SetupConsentRoutes(protectedRouter)
+	controllers.SetupSafeguardingRoutes(protectedRouter)
+	controllers.SetupAnnouncementRoutes(protectedRouter)
+	controllers.SetupOpenGraphRoutes(protectedRouter)
+	controllers.SetupEventRoutes(protectedRouter)
+	controllers.SetupSermonRoutes(protectedRouter)
+	controllers.SetupDonationRoutes(protectedRouter)
+	controllers.SetupDashboardRoutes(protectedRouter)
+
+	// The public API authenticates clients with their own tokens
+	controllers.SetupPublicAPIRoutes(router, protectedRouter)
+
+	// Paired display devices authenticate with their own tokens
+	controllers.SetupDisplayRoutes(router)
+
+	// Email tracking links are opened by mail clients without the bearer token
+	controllers.SetupEmailTrackingRoutes(router)
+
+	// Short links are opened from chat apps without the bearer token
+	controllers.SetupShortLinkRoutes(router)
+
+	// Payment providers sign their webhooks instead of sending the bearer token
+	controllers.SetupPaymentWebhookRoutes(router)
+
+	// Giving statements are downloaded through signed URLs without the bearer token
+	controllers.SetupStatementDownloadRoutes(router)
 
 	// Register pprof routes to enable profiling
 	router.HandleFunc("/debug/pprof/", pprof.Index)
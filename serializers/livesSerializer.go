@@ -0,0 +1,50 @@
+package serializers
+
+import (
+	"jsmi-api/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Live is the API payload of a live stream.
+type Live struct {
+	ID          uuid.UUID         `json:"id"`
+	Title       string            `json:"title"`
+	Links       []models.LiveLink `json:"links"`
+	Description string            `json:"description"`
+	StartsAt    time.Time         `json:"starts_at"`
+	EndsAt      time.Time         `json:"ends_at"`
+	Speaker     string            `json:"speaker"`
+	SeriesID    *uuid.UUID        `json:"series_id"`
+	Passage     string            `json:"passage"`
+	// Status is upcoming, live or ended at the time of the response.
+	Status     string     `json:"status"`
+	ArchivedAt *time.Time `json:"archived_at"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// FromLive serializes a live stream.
+func FromLive(live models.Live) Live {
+	return Live{
+		ID:          live.ID,
+		Title:       live.Title,
+		Links:       live.Links,
+		Description: live.Description,
+		StartsAt:    live.StartsAt,
+		EndsAt:      live.EndsAt,
+		Speaker:     live.Speaker,
+		SeriesID:    live.SeriesID,
+		Passage:     live.Passage,
+		Status:      live.StatusAt(time.Now()),
+		ArchivedAt:  live.ArchivedAt,
+		Version:     live.Version,
+		CreatedAt:   live.CreatedAt,
+	}
+}
+
+// Lives serializes a list of live streams.
+func Lives(lives []models.Live) []Live {
+	return List(lives, FromLive)
+}
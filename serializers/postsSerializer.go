@@ -0,0 +1,73 @@
+package serializers
+
+import (
+	"cmp"
+	"jsmi-api/models"
+	"jsmi-api/validation"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Post is the API payload of a post.
+type Post struct {
+	ID                 uuid.UUID  `json:"id"`
+	Title              string     `json:"title"`
+	Slug               string     `json:"slug"`
+	Excerpt            string     `json:"excerpt"`
+	Body               string     `json:"body"`
+	Status             string     `json:"status"`
+	Version            int        `json:"version"`
+	ReadingTimeMinutes int        `json:"reading_time_minutes"`
+	PublishedAt        *time.Time `json:"published_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	// DeletedAt is only sent for posts in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Views     int64      `json:"views"`
+
+	CoverImageURL   string `json:"cover_image_url"`
+	MetaTitle       string `json:"meta_title"`
+	MetaDescription string `json:"meta_description"`
+	CanonicalURL    string `json:"canonical_url"`
+	// Series is only sent in single-post responses of posts in a series.
+	Series *models.SeriesLinks `json:"series,omitempty"`
+	// AccessibilityWarnings are only sent when a write publishes the post.
+	AccessibilityWarnings []validation.FieldError `json:"accessibility_warnings,omitempty"`
+}
+
+// FromPost serializes a post.
+func FromPost(post models.Post) Post {
+	return Post{
+		ID:                 post.ID,
+		Title:              post.Title,
+		Slug:               post.Slug,
+		Excerpt:            post.Excerpt,
+		Body:               post.Body,
+		Status:             post.Status,
+		Version:            post.Version,
+		ReadingTimeMinutes: post.ReadingTimeMinutes,
+		PublishedAt:        post.PublishedAt,
+		CreatedAt:          post.CreatedAt,
+		// Posts cached before updated_at existed have none.
+		UpdatedAt:       cmp.Or(post.UpdatedAt, post.CreatedAt),
+		DeletedAt:       post.DeletedAt,
+		Views:           post.Views,
+		CoverImageURL:   post.CoverImageURL,
+		MetaTitle:       post.MetaTitle,
+		MetaDescription: post.MetaDescription,
+		CanonicalURL:    post.CanonicalURL,
+	}
+}
+
+// PostBatch is the response to a batch fetch of posts. Missing lists the
+// requested IDs that are not published posts.
+type PostBatch struct {
+	Posts   []Post   `json:"posts"`
+	Missing []string `json:"missing"`
+}
+
+// Posts serializes a list of posts.
+func Posts(posts []models.Post) []Post {
+	return List(posts, FromPost)
+}
@@ -0,0 +1,15 @@
+// Package serializers turns database models into API payloads. Handlers
+// respond with these types instead of the models, so that columns added to
+// a model, or fields it only needs internally, never reach clients by
+// accident and the JSON contract of each entity is written down in one place.
+package serializers
+
+// List serializes every item of a slice, keeping nil slices as empty JSON
+// arrays.
+func List[M any, R any](items []M, serialize func(M) R) []R {
+	result := make([]R, 0, len(items))
+	for _, item := range items {
+		result = append(result, serialize(item))
+	}
+	return result
+}
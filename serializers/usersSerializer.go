@@ -0,0 +1,26 @@
+package serializers
+
+import "jsmi-api/models"
+
+// User is the API payload of a user account. models.User carries the
+// password hash, it must never be sent as is.
+type User struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// FromUser serializes a user account.
+func FromUser(user models.User) User {
+	return User{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+	}
+}
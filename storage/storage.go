@@ -0,0 +1,82 @@
+// Package storage stores binary objects such as uploaded images and generated
+// documents behind a driver chosen at startup.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+	keyRegex      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,511}$`)
+)
+
+// Storage saves and reads objects by key. Keys are slash separated paths such
+// as "certificates/3f2c....pdf".
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStorage Storage
+	publicURL      string
+)
+
+// Init loads the configured storage driver as the default storage.
+func Init() error {
+	s, err := Load()
+	if err != nil {
+		return err
+	}
+	defaultStorage = s
+	publicURL = strings.TrimSuffix(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+	return nil
+}
+
+// PublicURL returns the URL under which clients can fetch an object directly,
+// or "" if STORAGE_PUBLIC_URL is not set and objects must be served by the API.
+func PublicURL(key string) string {
+	if publicURL == "" {
+		return ""
+	}
+	return publicURL + "/" + key
+}
+
+// Default returns the storage configured by Init.
+func Default() Storage {
+	return defaultStorage
+}
+
+// Load builds the storage selected by STORAGE_DRIVER. "local" (the default)
+// writes to the directory in STORAGE_LOCAL_DIR, defaulting to data/storage;
+// "s3" writes to the bucket configured by LoadS3Storage.
+func Load() (Storage, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/storage"
+		}
+		return NewLocalStorage(dir)
+	case "s3":
+		return LoadS3Storage()
+	default:
+		return nil, errors.New("unsupported STORAGE_DRIVER: " + driver)
+	}
+}
+
+// ValidateKey rejects keys that could escape the storage root.
+func ValidateKey(key string) error {
+	if !keyRegex.MatchString(key) || strings.Contains(key, "..") || strings.Contains(key, "//") {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// LoadEncryptionKey reads a 32-byte key, hex encoded, from the environment
+// variable name. It returns nil when the variable is not set.
+func LoadEncryptionKey(name string) ([]byte, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("%s must be %d hex characters", name, 2*chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+// Seal encrypts and authenticates plaintext with XChaCha20-Poly1305. The
+// random nonce is prepended to the result. additionalData, e.g. a row ID,
+// is authenticated but not stored, so a value copied to another row cannot
+// be opened there.
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts a value sealed by Seal with the same key and additional data.
+func Open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// JWTConfig holds the signing configuration for JWT compatibility mode.
+type JWTConfig struct {
+	Algorithm  string
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// jwtHeader is the JOSE header of the tokens we issue.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// jwtClaims carries the same claims as the PASETO tokens, plus the registered
+// exp/iat claims that third-party JWT consumers rely on.
+type jwtClaims struct {
+	CustomClaims
+	ExpiresAt int64 `json:"exp"`
+	IssuedAt  int64 `json:"iat"`
+}
+
+// LoadJWTConfig reads the JWT algorithm and keys from the environment variables.
+// HS256 uses JWT_SECRET; EdDSA uses a base64 encoded Ed25519 seed in JWT_PRIVATE_KEY.
+func LoadJWTConfig() (*JWTConfig, error) {
+	alg := os.Getenv("JWT_ALG")
+	if alg == "" {
+		alg = JWTAlgHS256
+	}
+
+	switch alg {
+	case JWTAlgHS256:
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("server configuration error: JWT_SECRET is not set")
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("JWT secret is too short")
+		}
+		return &JWTConfig{Algorithm: alg, Secret: []byte(secret)}, nil
+	case JWTAlgEdDSA:
+		encoded := os.Getenv("JWT_PRIVATE_KEY")
+		if encoded == "" {
+			return nil, errors.New("server configuration error: JWT_PRIVATE_KEY is not set")
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("JWT_PRIVATE_KEY is not valid base64: " + err.Error())
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("JWT_PRIVATE_KEY must be a 32 byte Ed25519 seed")
+		}
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		return &JWTConfig{
+			Algorithm:  alg,
+			PrivateKey: privateKey,
+			PublicKey:  privateKey.Public().(ed25519.PublicKey),
+		}, nil
+	default:
+		return nil, errors.New("unsupported JWT_ALG: " + alg)
+	}
+}
+
+// GenerateJWT generates a signed JWT with an expiration time
+func GenerateJWT(userID int64, expiration time.Duration) (string, error) {
+	config, err := LoadJWTConfig()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return signJWT(config, CustomClaims{
+		UserID: userID,
+		Expiry: now.Add(expiration),
+	}, now)
+}
+
+func signJWT(config *JWTConfig, claims CustomClaims, issuedAt time.Time) (string, error) {
+	return config.signClaims(jwtClaims{
+		CustomClaims: claims,
+		ExpiresAt:    claims.Expiry.Unix(),
+		IssuedAt:     issuedAt.Unix(),
+	})
+}
+
+// SignHS256JWT signs claims as an HS256 JWT with secret, for tokens that a
+// third party verifies with a secret shared with it, such as chat tokens.
+func SignHS256JWT(secret []byte, claims any) (string, error) {
+	config := &JWTConfig{Algorithm: JWTAlgHS256, Secret: secret}
+	return config.signClaims(claims)
+}
+
+func (c *JWTConfig) signClaims(claims any) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: c.Algorithm, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := c.sign([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ValidateJWT validates a JWT and returns the claims
+func ValidateJWT(tokenString string) (*CustomClaims, error) {
+	config, err := LoadJWTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	// Only accept the configured algorithm to prevent algorithm confusion.
+	if header.Alg != config.Algorithm {
+		return nil, errors.New("unexpected token algorithm")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	if !config.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+
+	// Check for token expiration
+	if time.Now().After(claims.Expiry) || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token has expired")
+	}
+
+	return &claims.CustomClaims, nil
+}
+
+func (c *JWTConfig) sign(signingInput []byte) []byte {
+	if c.Algorithm == JWTAlgEdDSA {
+		return ed25519.Sign(c.PrivateKey, signingInput)
+	}
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil)
+}
+
+func (c *JWTConfig) verify(signingInput, signature []byte) bool {
+	if c.Algorithm == JWTAlgEdDSA {
+		return ed25519.Verify(c.PublicKey, signingInput, signature)
+	}
+	return hmac.Equal(c.sign(signingInput), signature)
+}
@@ -13,6 +13,11 @@ import (
 type CustomClaims struct {
 	UserID int64     `json:"user_id"`
 	Expiry time.Time `json:"expiry"`
+	// TokenID identifies refresh tokens so that rotated tokens can be tracked.
+	TokenID string `json:"jti,omitempty"`
+	// ActingAdmin is set on impersonation tokens to the ID of the admin
+	// acting as UserID.
+	ActingAdmin int64 `json:"acting_admin,omitempty"`
 }
 
 // GetPasetoSecret retrieves the PASETO secret from the environment variables
@@ -42,14 +47,13 @@ func GeneratePASETO(userID int64, expiration time.Duration) (string, error) {
 		return "", err
 	}
 
-	now := time.Now()
-	expiry := now.Add(expiration)
-
-	claims := CustomClaims{
+	return encryptPASETO(symmetricKey, CustomClaims{
 		UserID: userID,
-		Expiry: expiry,
-	}
+		Expiry: time.Now().Add(expiration),
+	})
+}
 
+func encryptPASETO(symmetricKey []byte, claims CustomClaims) (string, error) {
 	v2 := paseto.NewV2()
 	token, err := v2.Encrypt(symmetricKey, claims, nil)
 	if err != nil {
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+const maxSlugLength = 80
+
+// Slugify turns a title into a URL slug: lowercase ASCII letters and digits
+// separated by single dashes. Other characters are dropped, so a title
+// without any falls back to fallback.
+func Slugify(title, fallback string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		return fallback
+	}
+	return slug
+}
+
+// NumberedSlug returns the n-th candidate for a slug that is already taken:
+// the slug itself for n = 1, then slug-2, slug-3, ...
+func NumberedSlug(slug string, n int) string {
+	if n <= 1 {
+		return slug
+	}
+	return slug + "-" + strconv.Itoa(n)
+}
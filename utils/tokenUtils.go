@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	TokenFormatPASETO = "paseto"
+	TokenFormatJWT    = "jwt"
+)
+
+// GetTokenFormat returns the configured token format from TOKEN_FORMAT.
+// PASETO is the default; JWT is available for tools that only understand JWTs.
+func GetTokenFormat() (string, error) {
+	format := os.Getenv("TOKEN_FORMAT")
+	switch format {
+	case "", TokenFormatPASETO:
+		return TokenFormatPASETO, nil
+	case TokenFormatJWT:
+		return TokenFormatJWT, nil
+	default:
+		return "", errors.New("unsupported TOKEN_FORMAT: " + format)
+	}
+}
+
+// CheckTokenConfig verifies that the keys for the configured token format are set.
+func CheckTokenConfig() (string, error) {
+	format, err := GetTokenFormat()
+	if err != nil {
+		return "", err
+	}
+
+	if format == TokenFormatJWT {
+		_, err = LoadJWTConfig()
+	} else {
+		_, err = GetPasetoSecret()
+	}
+	return format, err
+}
+
+// GenerateToken generates a token in the configured format with an expiration time
+func GenerateToken(userID int64, expiration time.Duration) (string, error) {
+	format, err := GetTokenFormat()
+	if err != nil {
+		return "", err
+	}
+
+	if format == TokenFormatJWT {
+		return GenerateJWT(userID, expiration)
+	}
+	return GeneratePASETO(userID, expiration)
+}
+
+// GenerateRefreshToken generates a refresh token that expires at expiry. Unlike
+// access tokens, refresh tokens carry a unique token ID, which is returned so
+// the caller can track the token for rotation.
+func GenerateRefreshToken(userID int64, expiry time.Time) (string, string, error) {
+	format, err := GetTokenFormat()
+	if err != nil {
+		return "", "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	claims := CustomClaims{
+		UserID:  userID,
+		Expiry:  expiry,
+		TokenID: hex.EncodeToString(b),
+	}
+
+	token, err := signClaims(format, claims)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, claims.TokenID, nil
+}
+
+// GenerateImpersonationToken generates an access token for userID that
+// records adminID as the admin acting on the user's behalf.
+func GenerateImpersonationToken(userID, adminID int64, expiration time.Duration) (string, error) {
+	format, err := GetTokenFormat()
+	if err != nil {
+		return "", err
+	}
+
+	return signClaims(format, CustomClaims{
+		UserID:      userID,
+		Expiry:      time.Now().Add(expiration),
+		ActingAdmin: adminID,
+	})
+}
+
+// signClaims creates a token in the given format carrying claims.
+func signClaims(format string, claims CustomClaims) (string, error) {
+	if format == TokenFormatJWT {
+		config, err := LoadJWTConfig()
+		if err != nil {
+			return "", err
+		}
+		return signJWT(config, claims, time.Now())
+	}
+
+	symmetricKey, err := GetPasetoSecret()
+	if err != nil {
+		return "", err
+	}
+	return encryptPASETO(symmetricKey, claims)
+}
+
+// ValidateToken validates a token in the configured format and returns the claims
+func ValidateToken(tokenString string) (*CustomClaims, error) {
+	format, err := GetTokenFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	if format == TokenFormatJWT {
+		return ValidateJWT(tokenString)
+	}
+	return ValidatePASETO(tokenString)
+}
+
+// ErrNotAccessToken is returned when a refresh token is used where an access
+// token is expected.
+var ErrNotAccessToken = errors.New("refresh tokens cannot be used as access tokens")
+
+// ValidateAccessToken validates an access token. Refresh tokens, which carry a
+// token ID, are rejected so that a revoked refresh token cannot stand in for
+// an access token.
+func ValidateAccessToken(tokenString string) (*CustomClaims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenID != "" {
+		return nil, ErrNotAccessToken
+	}
+	return claims, nil
+}
+
+// RefreshTokenLifetimes holds the refresh token lifetimes chosen by the
+// remember-me option at login.
+type RefreshTokenLifetimes struct {
+	Short time.Duration
+	Long  time.Duration
+}
+
+// LoadRefreshTokenLifetimes reads REFRESH_TOKEN_TTL_SHORT and
+// REFRESH_TOKEN_TTL_LONG (Go durations, e.g. "12h" or "720h"), defaulting to
+// 12 hours and 30 days.
+func LoadRefreshTokenLifetimes() (RefreshTokenLifetimes, error) {
+	lifetimes := RefreshTokenLifetimes{
+		Short: 12 * time.Hour,
+		Long:  30 * 24 * time.Hour,
+	}
+
+	if value := os.Getenv("REFRESH_TOKEN_TTL_SHORT"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return RefreshTokenLifetimes{}, errors.New("REFRESH_TOKEN_TTL_SHORT must be a positive duration")
+		}
+		lifetimes.Short = ttl
+	}
+
+	if value := os.Getenv("REFRESH_TOKEN_TTL_LONG"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return RefreshTokenLifetimes{}, errors.New("REFRESH_TOKEN_TTL_LONG must be a positive duration")
+		}
+		lifetimes.Long = ttl
+	}
+
+	if lifetimes.Long < lifetimes.Short {
+		return RefreshTokenLifetimes{}, errors.New("REFRESH_TOKEN_TTL_LONG must not be shorter than REFRESH_TOKEN_TTL_SHORT")
+	}
+
+	return lifetimes, nil
+}
+
+// For returns the refresh token lifetime for the given remember-me choice.
+func (l RefreshTokenLifetimes) For(rememberMe bool) time.Duration {
+	if rememberMe {
+		return l.Long
+	}
+	return l.Short
+}
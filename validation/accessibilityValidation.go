@@ -0,0 +1,111 @@
+package validation
+
+import (
+	"fmt"
+	"jsmi-api/models"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Accessibility rules. They are warnings: posts that break them are still
+// saved, and editors are shown what to fix.
+const (
+	RuleMissingAlt     = "missing_alt"
+	RuleFileNameAlt    = "file_name_alt"
+	RuleHeadingH1      = "heading_h1"
+	RuleHeadingSkipped = "heading_skipped"
+	RuleEmptyHeading   = "empty_heading"
+)
+
+var imageFileRegex = regexp.MustCompile(`(?i)^[\w-]+\.(jpe?g|png|gif|webp|svg)$`)
+
+// CheckPostAccessibility returns the accessibility problems of a post's body:
+// images without alt text, or with a file name for alt text, and headings
+// that are empty, use h1 (the post title is the page's h1) or skip a level.
+// An empty alt attribute marks a decorative image and is accepted.
+func CheckPostAccessibility(post models.Post) []FieldError {
+	var warnings ValidationError
+	root, err := html.Parse(strings.NewReader(post.Body))
+	if err != nil {
+		return nil
+	}
+
+	images, headingLevel := 0, 1
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Img:
+				images++
+				checkImageAlt(&warnings, images, n)
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				level := int(n.Data[1] - '0')
+				text := strings.TrimSpace(nodeText(n))
+				switch {
+				case level == 1:
+					warnings.Add("body", RuleHeadingH1, fmt.Sprintf("heading %q uses h1; start the post's headings at h2", text))
+				case level > headingLevel+1:
+					warnings.Add("body", RuleHeadingSkipped, fmt.Sprintf("heading %q is an h%d after an h%d; do not skip levels", text, level, headingLevel))
+				}
+				if text == "" {
+					warnings.Add("body", RuleEmptyHeading, fmt.Sprintf("an h%d heading has no text", level))
+				}
+				headingLevel = level
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return warnings.Errors
+}
+
+func checkImageAlt(warnings *ValidationError, number int, img *html.Node) {
+	src := attribute(img, "src")
+	name := path.Base(src)
+	alt, ok := attributeValue(img, "alt")
+	switch {
+	case !ok:
+		warnings.Add("body", RuleMissingAlt, fmt.Sprintf("image %d (%s) has no alt text", number, name))
+	case strings.EqualFold(strings.TrimSpace(alt), name) || imageFileRegex.MatchString(strings.TrimSpace(alt)):
+		warnings.Add("body", RuleFileNameAlt, fmt.Sprintf("image %d (%s) uses a file name as alt text", number, name))
+	}
+}
+
+func attribute(n *html.Node, key string) string {
+	value, _ := attributeValue(n, key)
+	return value
+}
+
+func attributeValue(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// nodeText returns the text inside n, including image alt text.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			b.WriteString(attribute(n, "alt"))
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return b.String()
+}
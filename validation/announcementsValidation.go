@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"errors"
+	"jsmi-api/models"
+)
+
+const maxAnnouncementBodyLength = 20000
+
+// ValidateStaffAnnouncement sanitizes a staff announcement in place and
+// validates it.
+func ValidateStaffAnnouncement(announcement *models.StaffAnnouncement) error {
+	announcement.Title = SanitizeText(announcement.Title)
+	announcement.Body = SanitizeHTML(announcement.Body)
+
+	if announcement.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateLength("title", announcement.Title, MaxTitleLength); err != nil {
+		return err
+	}
+	if announcement.Body == "" {
+		return errors.New("body is required")
+	}
+	return ValidateLength("body", announcement.Body, maxAnnouncementBodyLength)
+}
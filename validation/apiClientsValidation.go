@@ -0,0 +1,30 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+// ValidateAPIClientName validates the name developers give their client.
+func ValidateAPIClientName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	return nil
+}
+
+// ValidateDeviceName validates the name a display device is paired under.
+func ValidateDeviceName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	return nil
+}
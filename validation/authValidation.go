@@ -4,57 +4,77 @@ import (
 	"errors"
 	"fmt"
 	"jsmi-api/models"
+	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-// ValidationError represents custom validation errors.
-type ValidationError struct {
-	Errors []string
-}
-
-func (e *ValidationError) Error() string {
-	return "validation errors: " + strings.Join(e.Errors, ", ")
-}
-
 var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+	// Name fields as clients send them.
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// validatorRules maps validator tags to the rules of FieldError.
+var validatorRules = map[string]string{
+	"required": RuleRequired,
+	"min":      RuleTooShort,
+	"max":      RuleTooLong,
 }
 
+// ValidateUserData validates a user signing up. The error is a
+// *ValidationError listing every failing field.
 func ValidateUserData(user models.User) error {
-	var validationErrors []string
+	var errs ValidationError
 
 	// Validate using validator package
-	err := validate.Struct(user)
-	if err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			validationErrors = append(validationErrors, fmt.Sprintf("%s: %s", err.Field(), err.Tag()))
+	if err := validate.Struct(user); err != nil {
+		var fieldErrors validator.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			return err
+		}
+		for _, fieldError := range fieldErrors {
+			rule, ok := validatorRules[fieldError.Tag()]
+			if !ok {
+				rule = RuleInvalid
+			}
+			errs.Add(fieldError.Field(), rule, fmt.Sprintf("%s: %s", fieldError.Field(), fieldError.Tag()))
 		}
-		return &ValidationError{Errors: validationErrors}
 	}
 
 	// Additional custom validation
-	if len(user.Password) < 8 {
-		validationErrors = append(validationErrors, "password must be at least 8 characters long")
+	if !errs.Has("password") {
+		if len(user.Password) < 8 {
+			errs.Add("password", RuleTooShort, "password must be at least 8 characters long")
+		} else if !isComplexPassword(user.Password) {
+			errs.Add("password", RuleWeak, "password must include at least one uppercase letter, one lowercase letter, one digit, and one special character")
+		}
 	}
 
-	if !isComplexPassword(user.Password) {
-		validationErrors = append(validationErrors, "password must include at least one uppercase letter, one lowercase letter, one digit, and one special character")
-	}
+	return errs.Err()
+}
 
-	if len(validationErrors) > 0 {
-		return &ValidationError{Errors: validationErrors}
+// ValidateEmail checks that an email address is well formed.
+func ValidateEmail(email string) error {
+	if err := validate.Var(email, "required,email,max=255"); err != nil {
+		return ErrInvalidEmail
 	}
-
 	return nil
 }
 
 // Define static errors at the package level
 var (
+	ErrInvalidEmail       = errors.New("a valid email address is required")
 	ErrPasswordTooShort   = errors.New("new password must be at least 8 characters long")
 	ErrPasswordSameAsOld  = errors.New("new password must be different from the old password")
 	ErrPasswordNotComplex = errors.New("new password must include at least one uppercase letter, one lowercase letter, one digit, and one special character")
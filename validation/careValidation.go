@@ -0,0 +1,47 @@
+package validation
+
+import (
+	"errors"
+	"jsmi-api/models"
+	"strings"
+)
+
+const (
+	maxCareSummaryLength = 255
+	maxCareNotesLength   = 20000
+)
+
+// ValidateCareRecord validates a care record.
+func ValidateCareRecord(record models.CareRecord) error {
+	switch record.Kind {
+	case models.CareKindVisit, models.CareKindCall, models.CareKindFollowUp:
+	default:
+		return errors.New("kind must be visit, call or follow_up")
+	}
+	switch record.Visibility {
+	case models.CareVisibilityTeam, models.CareVisibilityRestricted:
+	default:
+		return errors.New("visibility must be team or restricted")
+	}
+	if record.MemberID <= 0 {
+		return errors.New("member_id is required")
+	}
+	if strings.TrimSpace(record.Summary) == "" {
+		return errors.New("summary is required")
+	}
+	if err := ValidateLength("summary", record.Summary, maxCareSummaryLength); err != nil {
+		return err
+	}
+	if err := ValidateLength("notes", record.Notes, maxCareNotesLength); err != nil {
+		return err
+	}
+	if record.PrivateNotes != nil {
+		if err := ValidateLength("private_notes", *record.PrivateNotes, maxCareNotesLength); err != nil {
+			return err
+		}
+	}
+	if record.Kind == models.CareKindFollowUp && record.DueAt == nil {
+		return errors.New("due_at is required for follow-ups")
+	}
+	return nil
+}
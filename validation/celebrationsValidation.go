@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"fmt"
+	"jsmi-api/models"
+	"time"
+)
+
+// ParseCelebrationSettings validates a member's celebration settings and
+// returns the parsed dates, nil where none is set.
+func ParseCelebrationSettings(settings models.CelebrationSettings, now time.Time) (*time.Time, *time.Time, error) {
+	birthday, err := parseCelebrationDate("birthday", settings.Birthday, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	anniversary, err := parseCelebrationDate("anniversary", settings.Anniversary, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return birthday, anniversary, nil
+}
+
+func parseCelebrationDate(field string, value *string, now time.Time) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", field)
+	}
+	if date.Year() < 1900 || date.After(now) {
+		return nil, fmt.Errorf("%s must be a date between 1900 and today", field)
+	}
+	return &date, nil
+}
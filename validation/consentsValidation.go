@@ -0,0 +1,28 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+// ValidateConsentChanges checks a set of consent answers keyed by purpose.
+func ValidateConsentChanges(changes map[string]bool) error {
+	if len(changes) == 0 {
+		return errors.New("at least one purpose is required")
+	}
+	for purpose := range changes {
+		if err := ValidateConsentPurpose(purpose); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateConsentPurpose checks that purpose is a known consent purpose.
+func ValidateConsentPurpose(purpose string) error {
+	if _, ok := models.ConsentPurposes[purpose]; !ok {
+		return fmt.Errorf("unknown consent purpose %q", purpose)
+	}
+	return nil
+}
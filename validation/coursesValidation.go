@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+// ValidateCourse sanitizes a course's details in place and validates them.
+func ValidateCourse(course *models.Course) error {
+	course.Title = SanitizeText(course.Title)
+	course.Description = SanitizeText(course.Description)
+
+	if course.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(course.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if err := ValidateWordCount(course.Description, 500); err != nil {
+		return fmt.Errorf("description %w", err)
+	}
+
+	return nil
+}
+
+// ValidateLesson sanitizes a lesson's content in place and validates it.
+func ValidateLesson(lesson *models.Lesson) error {
+	lesson.Title = SanitizeText(lesson.Title)
+	lesson.Content = SanitizeHTML(lesson.Content)
+
+	if lesson.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(lesson.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if err := ValidateWordCount(lesson.Content, 10000); err != nil {
+		return fmt.Errorf("content %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+	"time"
+)
+
+const maxCorrectionReasonLength = 2000
+
+// CorrectableFields are the fields of their data members can ask to have
+// corrected.
+var CorrectableFields = map[string]bool{"username": true, "birthday": true, "anniversary": true}
+
+// ValidateDataCorrectionRequest sanitizes a correction request in place and
+// validates it. Dates are proposed as YYYY-MM-DD; an empty value asks for
+// the date to be removed.
+func ValidateDataCorrectionRequest(request *models.DataCorrectionRequest, now time.Time) error {
+	request.ProposedValue = SanitizeText(request.ProposedValue)
+	request.Reason = SanitizeText(request.Reason)
+
+	if !CorrectableFields[request.Field] {
+		return errors.New("field must be username, birthday or anniversary")
+	}
+	if err := ValidateLength("reason", request.Reason, maxCorrectionReasonLength); err != nil {
+		return err
+	}
+
+	switch request.Field {
+	case "username":
+		if request.ProposedValue == "" {
+			return errors.New("proposed_value is required")
+		}
+		return ValidateLength("proposed_value", request.ProposedValue, 255)
+	default:
+		if request.ProposedValue == "" {
+			return nil
+		}
+		_, err := parseCelebrationDate(request.Field, &request.ProposedValue, now)
+		if err != nil {
+			return fmt.Errorf("proposed_value: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+// ValidateDocumentTitle validates the title of a document library upload.
+func ValidateDocumentTitle(title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return errors.New("title is required")
+	}
+	if len(title) > 200 {
+		return errors.New("title must be at most 200 characters")
+	}
+	return nil
+}
+
+// ValidateSearchQuery validates the q parameter of a search.
+func ValidateSearchQuery(query string) error {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return errors.New("q is required")
+	}
+	if len(query) > 200 {
+		return errors.New("q must be at most 200 characters")
+	}
+	return nil
+}
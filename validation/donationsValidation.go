@@ -0,0 +1,163 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDonationCents guards against typos on kiosk keypads.
+	maxDonationCents = 100_000_000
+	// maxOfflineAge is how old offline records may be when they arrive.
+	maxOfflineAge = 30 * 24 * time.Hour
+	// maxClockSkew allows for kiosk clocks that run a little fast.
+	maxClockSkew = 5 * time.Minute
+)
+
+// DonationFunds are the funds gifts can be designated to.
+var DonationFunds = map[string]bool{"general": true, "tithe": true, "offering": true, "missions": true, "building": true}
+
+// KioskDonationMethods are the ways of giving a kiosk can record.
+var KioskDonationMethods = map[string]bool{"cash": true, "card": true, "mpesa": true, "cheque": true}
+
+var currencyRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// mpesaPhoneRegex matches Safaricom numbers in international form without
+// the plus, as the Daraja API expects them.
+var mpesaPhoneRegex = regexp.MustCompile(`^254[17][0-9]{8}$`)
+
+// ValidateDonation validates a gift recorded at a kiosk.
+func ValidateDonation(donation models.Donation, now time.Time) error {
+	if donation.AmountCents <= 0 || donation.AmountCents > maxDonationCents {
+		return fmt.Errorf("amount_cents must be between 1 and %d", maxDonationCents)
+	}
+	if !currencyRegex.MatchString(donation.Currency) {
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	if !DonationFunds[donation.Fund] {
+		return errors.New("fund must be general, tithe, offering, missions or building")
+	}
+	if !KioskDonationMethods[donation.Method] {
+		return errors.New("method must be cash, card, mpesa or cheque")
+	}
+	if len(donation.DonorName) > 100 {
+		return errors.New("donor_name must be at most 100 characters")
+	}
+	if donation.Reference != nil && len(*donation.Reference) > 100 {
+		return errors.New("reference must be at most 100 characters")
+	}
+	return validateOfflineTime("given_at", donation.GivenAt, now)
+}
+
+// PayPalCurrencies are the currencies PayPal gifts can be given in. PayPal
+// does not take KES.
+var PayPalCurrencies = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "CAD": true, "AUD": true, "CHF": true, "SEK": true, "NOK": true, "DKK": true,
+}
+
+// ValidateDonationIntent normalizes and validates a request to give online.
+// The provider defaults to Stripe and the currency to the provider's entry
+// in defaultCurrencies. M-Pesa takes whole shillings only.
+func ValidateDonationIntent(request *models.DonationIntentRequest, defaultCurrencies map[string]string) error {
+	request.Provider = strings.ToLower(strings.TrimSpace(request.Provider))
+	if request.Provider == "" {
+		request.Provider = models.PaymentProviderStripe
+	}
+	request.Currency = strings.ToUpper(strings.TrimSpace(request.Currency))
+	if request.Currency == "" {
+		request.Currency = defaultCurrencies[request.Provider]
+	}
+	request.Fund = strings.ToLower(strings.TrimSpace(request.Fund))
+	if request.Fund == "" {
+		request.Fund = "general"
+	}
+	request.DonorName = SanitizeText(request.DonorName)
+
+	if request.AmountCents <= 0 || request.AmountCents > maxDonationCents {
+		return fmt.Errorf("amount_cents must be between 1 and %d", maxDonationCents)
+	}
+	if !currencyRegex.MatchString(request.Currency) {
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	if !DonationFunds[request.Fund] {
+		return errors.New("fund must be general, tithe, offering, missions or building")
+	}
+	if len(request.DonorName) > 100 {
+		return errors.New("donor_name must be at most 100 characters")
+	}
+
+	switch request.Provider {
+	case models.PaymentProviderStripe:
+		request.Phone = ""
+	case models.PaymentProviderPayPal:
+		request.Phone = ""
+		if !PayPalCurrencies[request.Currency] {
+			return errors.New("PayPal gifts must be in USD, EUR, GBP, CAD, AUD, CHF, SEK, NOK or DKK")
+		}
+	case models.PaymentProviderMpesa:
+		if request.Currency != "KES" {
+			return errors.New("M-Pesa gifts must be in KES")
+		}
+		if request.AmountCents%100 != 0 {
+			return errors.New("M-Pesa gifts must be whole shillings")
+		}
+		request.Phone = NormalizeMpesaPhone(request.Phone)
+		if !mpesaPhoneRegex.MatchString(request.Phone) {
+			return errors.New("phone must be a Safaricom number, such as 0712345678")
+		}
+	default:
+		return errors.New("provider must be stripe, mpesa or paypal")
+	}
+	return nil
+}
+
+// NormalizeMpesaPhone writes a Kenyan mobile number as 2547XXXXXXXX or
+// 2541XXXXXXXX, whether it was given as 07..., +2547... or 7....
+func NormalizeMpesaPhone(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '(' || r == ')' {
+			return -1
+		}
+		return r
+	}, phone)
+	phone = strings.TrimPrefix(phone, "+")
+	switch {
+	case strings.HasPrefix(phone, "0") && len(phone) == 10:
+		return "254" + phone[1:]
+	case len(phone) == 9:
+		return "254" + phone
+	}
+	return phone
+}
+
+// ValidateCheckIn validates a check-in recorded at a kiosk.
+func ValidateCheckIn(checkIn models.CheckIn, now time.Time) error {
+	if checkIn.UserID == nil && strings.TrimSpace(checkIn.Name) == "" {
+		return errors.New("user_id or name is required")
+	}
+	if len(checkIn.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	if len(checkIn.Service) > 100 {
+		return errors.New("service must be at most 100 characters")
+	}
+	return validateOfflineTime("checked_in_at", checkIn.CheckedInAt, now)
+}
+
+// validateOfflineTime checks when something was recorded offline.
+func validateOfflineTime(field string, t, now time.Time) error {
+	if t.IsZero() {
+		return fmt.Errorf("%s is required", field)
+	}
+	if t.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%s is in the future", field)
+	}
+	if now.Sub(t) > maxOfflineAge {
+		return fmt.Errorf("%s is too old to be accepted", field)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxSegmentRuleValues = 50
+	maxUserTags          = 30
+	maxCampaignBodyBytes = 200_000
+)
+
+var (
+	tagRegex     = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+	segmentRoles = map[string]bool{"member": true, "staff": true, "admin": true}
+)
+
+// ValidateTags checks that tags are lowercase slugs such as "youth" or "choir-2024".
+func ValidateTags(tags []string) error {
+	if len(tags) > maxUserTags {
+		return errors.New("too many tags")
+	}
+	for _, tag := range tags {
+		if !tagRegex.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: tags must be lowercase letters, digits and dashes", tag)
+		}
+	}
+	return nil
+}
+
+// ValidateEmailSegment validates a segment definition.
+func ValidateEmailSegment(segment models.EmailSegment) error {
+	name := strings.TrimSpace(segment.Name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > 100 {
+		return errors.New("name is too long")
+	}
+	if err := ValidateWordCount(segment.Description, 100); err != nil {
+		return fmt.Errorf("description %w", err)
+	}
+
+	rules := segment.Rules
+	for field, count := range map[string]int{
+		"tags":                 len(rules.Tags),
+		"exclude_tags":         len(rules.ExcludeTags),
+		"roles":                len(rules.Roles),
+		"enrolled_course_ids":  len(rules.EnrolledCourseIDs),
+		"completed_course_ids": len(rules.CompletedCourseIDs),
+	} {
+		if count > maxSegmentRuleValues {
+			return fmt.Errorf("%s has too many values", field)
+		}
+	}
+	for _, tags := range [][]string{rules.Tags, rules.ExcludeTags} {
+		for _, tag := range tags {
+			if !tagRegex.MatchString(tag) {
+				return fmt.Errorf("invalid tag %q", tag)
+			}
+		}
+	}
+	for _, role := range rules.Roles {
+		if !segmentRoles[role] {
+			return fmt.Errorf("invalid role %q", role)
+		}
+	}
+
+	return nil
+}
+
+// ValidateEmailCampaign validates a campaign before it is saved as a draft.
+func ValidateEmailCampaign(campaign models.EmailCampaign) error {
+	subject := strings.TrimSpace(campaign.Subject)
+	if subject == "" {
+		return errors.New("subject is required")
+	}
+	if len(subject) > 200 || strings.ContainsAny(subject, "\r\n") {
+		return errors.New("subject must be a single line of at most 200 characters")
+	}
+	if strings.TrimSpace(campaign.TextBody) == "" {
+		return errors.New("text_body is required")
+	}
+	if len(campaign.TextBody) > maxCampaignBodyBytes || len(campaign.HTMLBody) > maxCampaignBodyBytes {
+		return errors.New("campaign body is too long")
+	}
+	return nil
+}
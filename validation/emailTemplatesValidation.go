@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+	"regexp"
+	"strings"
+)
+
+var (
+	templateNameRegex     = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,99}$`)
+	templateVariableRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,49}$`)
+)
+
+const maxTemplateVariables = 50
+
+// ValidateEmailTemplate validates the fields of a template. Template syntax
+// and variable usage are checked by the mailer.
+func ValidateEmailTemplate(template models.EmailTemplate) error {
+	if !templateNameRegex.MatchString(template.Name) {
+		return errors.New("name must be lowercase letters, digits, dashes and underscores")
+	}
+	if err := ValidateWordCount(template.Description, 100); err != nil {
+		return fmt.Errorf("description %w", err)
+	}
+	if len(template.Variables) > maxTemplateVariables {
+		return errors.New("too many variables")
+	}
+	for _, variable := range template.Variables {
+		if !templateVariableRegex.MatchString(variable) {
+			return fmt.Errorf("invalid variable %q", variable)
+		}
+	}
+
+	subject := strings.TrimSpace(template.Subject)
+	if subject == "" {
+		return errors.New("subject is required")
+	}
+	if len(subject) > 200 || strings.ContainsAny(subject, "\r\n") {
+		return errors.New("subject must be a single line of at most 200 characters")
+	}
+	if strings.TrimSpace(template.TextBody) == "" {
+		return errors.New("text_body is required")
+	}
+	if len(template.TextBody) > maxCampaignBodyBytes || len(template.HTMLBody) > maxCampaignBodyBytes {
+		return errors.New("template body is too long")
+	}
+	return nil
+}
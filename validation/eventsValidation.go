@@ -0,0 +1,107 @@
+package validation
+
+import (
+	"fmt"
+	"jsmi-api/models"
+	"time"
+)
+
+// Limits of events, matching the columns.
+const (
+	MaxEventLocationLength = 255
+	// MaxEventRecurrenceCount and MaxEventRecurrenceSpan bound how far an
+	// event repeats when it does not repeat forever.
+	MaxEventRecurrenceCount = 1000
+	MaxEventRecurrenceSpan  = 10 * 365 * 24 * time.Hour
+	maxEventInterval        = 52
+)
+
+// ValidateEvent sanitizes an event in place and validates it, returning a
+// *ValidationError listing every failing field.
+func ValidateEvent(event *models.Event) error {
+	event.Title = SanitizeText(event.Title)
+	event.Description = SanitizeText(event.Description)
+	event.Location = SanitizeText(event.Location)
+	// The columns hold UTC without a zone.
+	event.StartsAt = event.StartsAt.UTC()
+	event.EndsAt = event.EndsAt.UTC()
+
+	var errs ValidationError
+	errs.checkRequired("title", event.Title)
+	errs.checkLength("title", event.Title, MaxTitleLength)
+	errs.checkWordCount("title", event.Title, 15)
+	errs.checkLength("description", event.Description, MaxExcerptLength)
+	errs.checkLength("location", event.Location, MaxEventLocationLength)
+
+	errs.checkLength("registration_url", event.RegistrationURL, MaxLinkLength)
+	if !errs.Has("registration_url") && event.RegistrationURL != "" && !IsValidURL(event.RegistrationURL) {
+		errs.Add("registration_url", RuleInvalidURL, "registration_url must be an http or https URL")
+	}
+	if event.RegistrationURL != "" && !event.RegistrationRequired {
+		errs.Add("registration_url", RuleInvalid, "registration_url needs registration_required")
+	}
+
+	if event.StartsAt.IsZero() {
+		errs.Add("starts_at", RuleRequired, "starts_at is required")
+	}
+	if event.EndsAt.IsZero() {
+		errs.Add("ends_at", RuleRequired, "ends_at is required")
+	} else if !event.StartsAt.IsZero() && !event.StartsAt.Before(event.EndsAt) {
+		errs.Add("ends_at", RuleInvalid, "ends_at must be after starts_at")
+	}
+
+	if event.Recurrence != nil {
+		validateEventRecurrence(&errs, event)
+	}
+
+	return errs.Err()
+}
+
+func validateEventRecurrence(errs *ValidationError, event *models.Event) {
+	r := event.Recurrence
+	switch r.Frequency {
+	case models.EventFrequencyDaily, models.EventFrequencyWeekly, models.EventFrequencyMonthly:
+	case "":
+		errs.Add("recurrence.frequency", RuleRequired, "recurrence.frequency is required")
+	default:
+		errs.Add("recurrence.frequency", RuleInvalid, "recurrence.frequency must be daily, weekly or monthly")
+	}
+
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 0 || r.Interval > maxEventInterval {
+		errs.Add("recurrence.interval", RuleInvalid,
+			fmt.Sprintf("recurrence.interval must be between 1 and %d", maxEventInterval))
+	}
+	if r.Count < 0 || r.Count > MaxEventRecurrenceCount {
+		errs.Add("recurrence.count", RuleInvalid,
+			fmt.Sprintf("recurrence.count must be between 1 and %d", MaxEventRecurrenceCount))
+	}
+
+	if r.Until != nil {
+		until := r.Until.UTC()
+		r.Until = &until
+		if !event.StartsAt.IsZero() && until.Before(event.StartsAt) {
+			errs.Add("recurrence.until", RuleInvalid, "recurrence.until must not be before starts_at")
+		} else if !event.StartsAt.IsZero() && until.Sub(event.StartsAt) > MaxEventRecurrenceSpan {
+			errs.Add("recurrence.until", RuleInvalid, "recurrence.until must be within 10 years of starts_at")
+		}
+	}
+
+	// An occurrence must end before the next one starts; months are taken
+	// at their shortest.
+	if errs.Has("recurrence.frequency") || errs.Has("recurrence.interval") || errs.Has("ends_at") {
+		return
+	}
+	days := r.Interval
+	switch r.Frequency {
+	case models.EventFrequencyWeekly:
+		days = 7 * r.Interval
+	case models.EventFrequencyMonthly:
+		days = 28 * r.Interval
+	}
+	if event.EndsAt.After(event.StartsAt.AddDate(0, 0, days)) {
+		errs.Add("ends_at", RuleInvalid, "ends_at must be before the next occurrence starts")
+	}
+}
@@ -4,44 +4,279 @@ import (
 	"errors"
 	"fmt"
 	"jsmi-api/models"
+	"jsmi-api/utils"
+	"log"
+	"net/netip"
 	"net/url"
-	"regexp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
 )
 
-// IsValidURL checks if a URL is valid
+// IsValidURL reports whether toTest is an absolute http or https URL. The
+// host may be a domain name, including an internationalized one, or an IP
+// address, with an optional port; credentials in the URL are refused.
 func IsValidURL(toTest string) bool {
-	u, err := url.ParseRequestURI(toTest)
-	if err != nil {
+	_, ok := parseHTTPURL(toTest)
+	return ok
+}
+
+// IsPublicURL is IsValidURL for URLs the server calls, such as webhooks. It
+// also refuses IP addresses and host names that are not on the internet.
+// Host names are checked again when they are resolved, see
+// utils.NewSafeHTTPClient.
+func IsPublicURL(toTest string) bool {
+	u, ok := parseHTTPURL(toTest)
+	if !ok {
 		return false
 	}
+	host := strings.ToLower(u.Hostname())
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return utils.IsPublicIP(ip)
+	}
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost") &&
+		!strings.HasSuffix(host, ".internal") && !strings.HasSuffix(host, ".local")
+}
+
+func parseHTTPURL(toTest string) (*url.URL, bool) {
+	if strings.ContainsAny(toTest, " \t\r\n") {
+		return nil, false
+	}
+	u, err := url.Parse(toTest)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Opaque != "" || u.User != nil {
+		return nil, false
+	}
+	if strings.HasSuffix(u.Host, ":") {
+		return nil, false
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, false
+		}
+	}
+
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return u, true
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || !strings.Contains(ascii, ".") {
+		return nil, false
+	}
+	// A top-level domain is never numeric; "1.2.3" is a mistyped address.
+	tld := ascii[strings.LastIndex(ascii, ".")+1:]
+	if strings.Trim(tld, "0123456789") == "" {
+		return nil, false
+	}
+	return u, true
+}
+
+// DefaultLiveStreamHosts are the streaming sites live links may point to
+// when LIVE_STREAM_HOSTS is not set.
+var DefaultLiveStreamHosts = []string{"youtube.com", "youtu.be", "facebook.com", "fb.watch", "vimeo.com", "twitch.tv"}
+
+var (
+	liveStreamHosts     []string
+	liveStreamHostsOnce sync.Once
+)
+
+// LoadLiveStreamHosts reads LIVE_STREAM_HOSTS, a comma-separated list of the
+// domains live links may point to. Subdomains such as www. are included.
+func LoadLiveStreamHosts() ([]string, error) {
+	value := os.Getenv("LIVE_STREAM_HOSTS")
+	if value == "" {
+		return DefaultLiveStreamHosts, nil
+	}
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil || !strings.Contains(ascii, ".") {
+			return nil, fmt.Errorf("LIVE_STREAM_HOSTS: %q is not a domain name", host)
+		}
+		hosts = append(hosts, ascii)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("LIVE_STREAM_HOSTS lists no domains")
+	}
+	return hosts, nil
+}
+
+func allowedLiveStreamHosts() []string {
+	liveStreamHostsOnce.Do(func() {
+		hosts, err := LoadLiveStreamHosts()
+		if err != nil {
+			log.Printf("Using the default live stream hosts: %v", err)
+			hosts = DefaultLiveStreamHosts
+		}
+		liveStreamHosts = hosts
+	})
+	return liveStreamHosts
+}
 
-	// Check if the scheme is valid (http, https)
-	if u.Scheme != "http" && u.Scheme != "https" {
+// IsLiveStreamURL reports whether link is a valid URL on one of the allowed
+// streaming hosts.
+func IsLiveStreamURL(link string) bool {
+	host, ok := liveLinkHost(link)
+	if !ok {
 		return false
 	}
+	for _, allowed := range allowedLiveStreamHosts() {
+		if inDomain(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Check if the host is valid using a regex
-	hostRegex := regexp.MustCompile(`^[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+// livePlatformDomains maps the sites of each known platform to it.
+var livePlatformDomains = map[string]string{
+	"youtube.com":  models.LivePlatformYouTube,
+	"youtu.be":     models.LivePlatformYouTube,
+	"facebook.com": models.LivePlatformFacebook,
+	"fb.watch":     models.LivePlatformFacebook,
+	"vimeo.com":    models.LivePlatformVimeo,
+	"twitch.tv":    models.LivePlatformTwitch,
+}
 
-	return hostRegex.MatchString(u.Host)
+// LivePlatformOf returns the platform a link is on, or
+// models.LivePlatformOther.
+func LivePlatformOf(link string) string {
+	host, ok := liveLinkHost(link)
+	if !ok {
+		return models.LivePlatformOther
+	}
+	for domain, platform := range livePlatformDomains {
+		if inDomain(host, domain) {
+			return platform
+		}
+	}
+	return models.LivePlatformOther
 }
 
-// ValidateLives validates a live post's content.
-func ValidateLives(live models.Live) error {
-	// Sanitize inputs
-	live.Title = SanitizeInput(live.Title)
+func isLivePlatform(platform string) bool {
+	switch platform {
+	case models.LivePlatformYouTube, models.LivePlatformFacebook, models.LivePlatformVimeo,
+		models.LivePlatformTwitch, models.LivePlatformOther:
+		return true
+	}
+	return false
+}
 
-	if live.Title == "" {
-		return errors.New("title is required")
+// liveLinkHost returns the host of link in ASCII.
+func liveLinkHost(link string) (string, bool) {
+	u, ok := parseHTTPURL(link)
+	if !ok {
+		return "", false
 	}
+	host, err := idna.Lookup.ToASCII(u.Hostname())
+	return host, err == nil
+}
+
+// inDomain reports whether host is domain or one of its subdomains.
+func inDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Limits of the service details of a live, matching the columns.
+const (
+	MaxLiveSpeakerLength = 100
+	MaxLivePassageLength = 100
+	// MaxLiveLinks is how many platforms a live can be streamed to.
+	MaxLiveLinks = 10
+)
+
+// ValidateLives sanitizes a live post's text fields and normalizes its
+// schedule to UTC in place, then validates it. The error is a
+// *ValidationError listing every failing field.
+func ValidateLives(live *models.Live) error {
+	live.Title = SanitizeText(live.Title)
+	live.Description = SanitizeText(live.Description)
+	live.Speaker = SanitizeText(live.Speaker)
+	live.Passage = SanitizeText(live.Passage)
+	// The columns hold UTC without a zone.
+	live.StartsAt = live.StartsAt.UTC()
+	live.EndsAt = live.EndsAt.UTC()
 
-	if err := ValidateWordCount(live.Title, 15); err != nil {
-		return fmt.Errorf("title %w", err)
+	var errs ValidationError
+	errs.checkRequired("title", live.Title)
+	errs.checkLength("title", live.Title, MaxTitleLength)
+	errs.checkWordCount("title", live.Title, 15)
+
+	validateLiveLinks(&errs, live.Links)
+
+	errs.checkLength("description", live.Description, MaxExcerptLength)
+	errs.checkLength("speaker", live.Speaker, MaxLiveSpeakerLength)
+	errs.checkLength("passage", live.Passage, MaxLivePassageLength)
+
+	if live.StartsAt.IsZero() {
+		errs.Add("starts_at", RuleRequired, "starts_at is required")
+	}
+	if live.EndsAt.IsZero() {
+		errs.Add("ends_at", RuleRequired, "ends_at is required")
+	} else if !live.StartsAt.IsZero() && !live.StartsAt.Before(live.EndsAt) {
+		errs.Add("ends_at", RuleInvalid, "ends_at must be after starts_at")
+	}
+
+	return errs.Err()
+}
+
+// validateLiveLinks normalizes the links of a live in place: platforms left
+// out are detected from the URL, and the first link is made primary if none
+// is.
+func validateLiveLinks(errs *ValidationError, links []models.LiveLink) {
+	if len(links) == 0 {
+		errs.Add("links", RuleRequired, "links is required")
+		return
+	}
+	if len(links) > MaxLiveLinks {
+		errs.Add("links", RuleInvalid, fmt.Sprintf("links must have at most %d entries", MaxLiveLinks))
+		return
 	}
 
-	if !IsValidURL(live.Link) {
-		return errors.New("invalid URL")
+	seen := make(map[string]bool, len(links))
+	primaries := 0
+	for i := range links {
+		link := &links[i]
+		link.URL = strings.TrimSpace(link.URL)
+		link.Platform = strings.ToLower(strings.TrimSpace(link.Platform))
+
+		field := fmt.Sprintf("links[%d].url", i)
+		errs.checkRequired(field, link.URL)
+		errs.checkLength(field, link.URL, MaxLinkLength)
+		switch {
+		case errs.Has(field):
+		case !IsValidURL(link.URL):
+			errs.Add(field, RuleInvalidURL, field+" must be an http or https URL")
+		case !IsLiveStreamURL(link.URL):
+			errs.Add(field, RuleInvalidURL, field+" must point to an allowed streaming site")
+		case seen[link.URL]:
+			errs.Add(field, RuleInvalid, field+" is listed twice")
+		}
+		seen[link.URL] = true
+
+		if link.Platform == "" {
+			link.Platform = LivePlatformOf(link.URL)
+		} else if !isLivePlatform(link.Platform) {
+			platformField := fmt.Sprintf("links[%d].platform", i)
+			errs.Add(platformField, RuleInvalid,
+				platformField+" must be youtube, facebook, vimeo, twitch or other")
+		}
+		if link.Primary {
+			primaries++
+		}
 	}
 
-	return nil
+	switch {
+	case primaries == 0:
+		links[0].Primary = true
+	case primaries > 1:
+		errs.Add("links", RuleInvalid, "only one link can be primary")
+	}
 }
@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+// MembershipStatuses are the statuses a user can have.
+var MembershipStatuses = map[string]bool{
+	models.MembershipVisitor:  true,
+	models.MembershipRegular:  true,
+	models.MembershipMember:   true,
+	models.MembershipInactive: true,
+}
+
+// ValidateMembershipStatus validates a status and the reason for moving to it.
+func ValidateMembershipStatus(status, reason string) error {
+	if !MembershipStatuses[status] {
+		return errors.New("status must be visitor, regular, member or inactive")
+	}
+	if err := ValidateWordCount(reason, 100); err != nil {
+		return fmt.Errorf("reason %w", err)
+	}
+	return nil
+}
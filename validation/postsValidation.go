@@ -5,37 +5,84 @@ import (
 	"fmt"
 	"jsmi-api/models"
 	"regexp"
-	"strings"
-	"unicode"
+	"unicode/utf8"
 )
 
-// ValidatePost validates a blog post's content.
-func ValidatePost(post models.Post) error {
-	// Sanitize inputs
-	post.Title = SanitizeInput(post.Title)
-	post.Excerpt = SanitizeInput(post.Excerpt)
-	post.Body = SanitizeInput(post.Body)
+// Character limits of posts and lives. The database enforces the same limits,
+// see the add_post_and_live_constraints migration.
+const (
+	MaxTitleLength   = 255
+	MaxExcerptLength = 1000
+	MaxBodyLength    = 100000
+	MaxLinkLength    = 255
 
-	if post.Title == "" {
-		return errors.New("title is required")
-	}
-	if post.Excerpt == "" {
-		return errors.New("excerpt is required")
-	}
-	if post.Body == "" {
-		return errors.New("body is required")
+	MaxMetaTitleLength       = 100
+	MaxMetaDescriptionLength = 300
+	MaxPostURLLength         = 2048
+)
+
+// ValidatePost sanitizes a blog post's text in place and validates it. The
+// error is a *ValidationError listing every failing field.
+func ValidatePost(post *models.Post) error {
+	post.Title = SanitizeText(post.Title)
+	post.Excerpt = SanitizeText(post.Excerpt)
+	post.Body = SanitizeHTML(post.Body)
+	post.MetaTitle = SanitizeText(post.MetaTitle)
+	post.MetaDescription = SanitizeText(post.MetaDescription)
+
+	var errs ValidationError
+	errs.checkRequired("title", post.Title)
+	errs.checkLength("title", post.Title, MaxTitleLength)
+	errs.checkWordCount("title", post.Title, 15)
+	errs.checkRequired("excerpt", post.Excerpt)
+	errs.checkLength("excerpt", post.Excerpt, MaxExcerptLength)
+	errs.checkWordCount("excerpt", post.Excerpt, 60)
+	errs.checkRequired("body", post.Body)
+	errs.checkLength("body", post.Body, MaxBodyLength)
+	errs.checkWordCount("body", post.Body, 10000)
+
+	if err := ValidatePostStatus(post.Status); err != nil {
+		errs.Add("status", RuleInvalid, err.Error())
 	}
 
-	if err := ValidateWordCount(post.Title, 15); err != nil {
-		return fmt.Errorf("title %w", err)
+	validatePostSEO(*post, &errs)
+	return errs.Err()
+}
+
+// validatePostSEO checks the optional cover image and metadata fields.
+func validatePostSEO(post models.Post, errs *ValidationError) {
+	errs.checkLength("meta_title", post.MetaTitle, MaxMetaTitleLength)
+	errs.checkLength("meta_description", post.MetaDescription, MaxMetaDescriptionLength)
+
+	urls := []struct{ field, value string }{
+		{"cover_image_url", post.CoverImageURL},
+		{"canonical_url", post.CanonicalURL},
 	}
-	if err := ValidateWordCount(post.Excerpt, 60); err != nil {
-		return fmt.Errorf("excerpt %w", err)
+	for _, u := range urls {
+		if u.value == "" {
+			continue
+		}
+		errs.checkLength(u.field, u.value, MaxPostURLLength)
+		if !errs.Has(u.field) && !IsValidURL(u.value) {
+			errs.Add(u.field, RuleInvalidURL, u.field+" must be an http or https URL")
+		}
 	}
-	if err := ValidateWordCount(post.Body, 10000); err != nil {
-		return fmt.Errorf("body %w", err)
+}
+
+// ValidatePostStatus checks that status is a known post status.
+func ValidatePostStatus(status string) error {
+	switch status {
+	case models.PostStatusDraft, models.PostStatusPublished, models.PostStatusArchived:
+		return nil
 	}
+	return errors.New("status must be draft, published or archived")
+}
 
+// ValidateLength checks that a field has at most limit characters.
+func ValidateLength(field, input string, limit int) error {
+	if utf8.RuneCountInString(input) > limit {
+		return fmt.Errorf("%s must be at most %d characters", field, limit)
+	}
 	return nil
 }
 
@@ -56,31 +103,3 @@ func ValidateWordCount(input string, limit int) error {
 	}
 	return nil
 }
-
-// SanitizeInput sanitizes user input by removing potentially harmful characters.
-func SanitizeInput(input string) string {
-	// Remove potentially harmful characters.
-	return removeUnsafeCharacters(input)
-}
-
-// removeUnsafeCharacters removes potentially harmful characters from the input.
-func removeUnsafeCharacters(input string) string {
-	var safeRunes []rune
-	for _, r := range input {
-		if isSafeCharacter(r) {
-			safeRunes = append(safeRunes, r)
-		}
-	}
-	return string(safeRunes)
-}
-
-// isSafeCharacter checks if a rune is a safe character (letters, digits, or safe symbols).
-func isSafeCharacter(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r) || isSafeSymbol(r)
-}
-
-// isSafeSymbol checks if a rune is a safe symbol.
-func isSafeSymbol(r rune) bool {
-	safeSymbols := " .,~-!/@#%*&$+÷€£¥×=;:?<>[]{}|\\\"'()"
-	return strings.ContainsRune(safeSymbols, r)
-}
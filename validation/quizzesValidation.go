@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+const (
+	maxQuizQuestions = 100
+	maxQuizOptions   = 10
+	maxQuizAttempts  = 100
+)
+
+// ValidateQuiz sanitizes a quiz in place and validates it along with its
+// questions and answer key.
+func ValidateQuiz(quiz *models.Quiz) error {
+	quiz.Title = SanitizeText(quiz.Title)
+	for i := range quiz.Questions {
+		quiz.Questions[i].Prompt = SanitizeText(quiz.Questions[i].Prompt)
+		for j := range quiz.Questions[i].Options {
+			quiz.Questions[i].Options[j] = SanitizeText(quiz.Questions[i].Options[j])
+		}
+	}
+
+	if quiz.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(quiz.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if quiz.PassPercent < 1 || quiz.PassPercent > 100 {
+		return errors.New("pass_percent must be between 1 and 100")
+	}
+	if quiz.MaxAttempts < 0 || quiz.MaxAttempts > maxQuizAttempts {
+		return errors.New("max_attempts must be between 0 and 100")
+	}
+
+	if len(quiz.Questions) == 0 {
+		return errors.New("questions are required")
+	}
+	if len(quiz.Questions) > maxQuizQuestions {
+		return errors.New("too many questions")
+	}
+	for i, question := range quiz.Questions {
+		if question.Prompt == "" {
+			return fmt.Errorf("question %d: prompt is required", i+1)
+		}
+		if err := ValidateWordCount(question.Prompt, 200); err != nil {
+			return fmt.Errorf("question %d: prompt %w", i+1, err)
+		}
+		if len(question.Options) < 2 || len(question.Options) > maxQuizOptions {
+			return fmt.Errorf("question %d: must have between 2 and %d options", i+1, maxQuizOptions)
+		}
+		for _, option := range question.Options {
+			if option == "" {
+				return fmt.Errorf("question %d: options must not be empty", i+1)
+			}
+		}
+		if question.CorrectOption == nil || *question.CorrectOption < 0 || *question.CorrectOption >= len(question.Options) {
+			return fmt.Errorf("question %d: correct_option must index one of the options", i+1)
+		}
+	}
+
+	return nil
+}
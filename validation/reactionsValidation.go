@@ -0,0 +1,14 @@
+package validation
+
+import "errors"
+
+// PostReactions are the reactions readers can leave on posts.
+var PostReactions = map[string]bool{"like": true, "love": true, "pray": true, "amen": true}
+
+// ValidatePostReaction checks that reaction is a known reaction.
+func ValidatePostReaction(reaction string) error {
+	if !PostReactions[reaction] {
+		return errors.New("reaction must be like, love, pray or amen")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"errors"
+	"jsmi-api/models"
+	"regexp"
+	"strings"
+)
+
+var (
+	slugRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	pathRegex = regexp.MustCompile(`^/[A-Za-z0-9._~!$&'()*+,;=:@%/-]*$`)
+)
+
+// ValidateSlug checks that a slug is lowercase letters and digits separated
+// by single dashes, like the slugs generated from titles.
+func ValidateSlug(slug string) error {
+	if !slugRegex.MatchString(slug) {
+		return errors.New("slug must be lowercase letters and digits separated by dashes")
+	}
+	if len(slug) > 80 {
+		return errors.New("slug must be at most 80 characters")
+	}
+	return nil
+}
+
+// NormalizePath validates a site-relative path and drops its query, fragment
+// and trailing slash, so "/posts/a/?ref=x" and "/posts/a" are the same path.
+func NormalizePath(path string) (string, error) {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+	if path == "" || !pathRegex.MatchString(path) || strings.Contains(path, "//") {
+		return "", errors.New("path must be a site-relative path starting with /")
+	}
+	if len(path) > 500 {
+		return "", errors.New("path must be at most 500 characters")
+	}
+	return path, nil
+}
+
+// ValidateRedirect validates a redirect with normalized paths.
+func ValidateRedirect(redirect models.Redirect) error {
+	if redirect.FromPath == "/" {
+		return errors.New("the home page cannot be redirected")
+	}
+	if redirect.FromPath == redirect.ToPath {
+		return errors.New("from_path and to_path must differ")
+	}
+	switch redirect.StatusCode {
+	case 301, 302, 307, 308:
+		return nil
+	}
+	return errors.New("status_code must be 301, 302, 307 or 308")
+}
@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+const (
+	maxSegmentDurationSeconds = 6 * 60 * 60
+	maxSegmentAttachments     = 20
+)
+
+// ValidateServiceSegment sanitizes an order of service segment in place and
+// validates it.
+func ValidateServiceSegment(segment *models.ServiceSegment) error {
+	segment.Title = SanitizeText(segment.Title)
+	segment.Owner = SanitizeText(segment.Owner)
+	segment.Notes = SanitizeText(segment.Notes)
+
+	if segment.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(segment.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if len(segment.Owner) > 255 {
+		return errors.New("owner is too long")
+	}
+	if err := ValidateWordCount(segment.Notes, 500); err != nil {
+		return fmt.Errorf("notes %w", err)
+	}
+	if segment.DurationSeconds < 0 || segment.DurationSeconds > maxSegmentDurationSeconds {
+		return errors.New("duration_seconds must be between 0 and 21600")
+	}
+
+	if len(segment.Attachments) > maxSegmentAttachments {
+		return errors.New("too many attachments")
+	}
+	for _, attachment := range segment.Attachments {
+		if attachment.Name == "" {
+			return errors.New("attachment name is required")
+		}
+		if !IsValidURL(attachment.URL) {
+			return fmt.Errorf("attachment %q has an invalid URL", attachment.Name)
+		}
+	}
+
+	return nil
+}
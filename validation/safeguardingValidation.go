@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"errors"
+	"jsmi-api/models"
+	"strings"
+	"time"
+)
+
+const (
+	maxSafeguardingDetailsLength = 20000
+	minExportReasonLength        = 10
+)
+
+// SafeguardingCategories are the kinds of incidents that can be reported.
+var SafeguardingCategories = map[string]bool{
+	"abuse": true, "neglect": true, "self_harm": true, "bullying": true, "online": true, "other": true,
+}
+
+// ValidateSafeguardingSubmission validates a new safeguarding report.
+func ValidateSafeguardingSubmission(submission models.SafeguardingSubmission, now time.Time) error {
+	if !SafeguardingCategories[submission.Category] {
+		return errors.New("category must be abuse, neglect, self_harm, bullying, online or other")
+	}
+	if strings.TrimSpace(submission.Details) == "" {
+		return errors.New("details is required")
+	}
+	if err := ValidateLength("details", submission.Details, maxSafeguardingDetailsLength); err != nil {
+		return err
+	}
+	if err := ValidateLength("subject_name", submission.SubjectName, 200); err != nil {
+		return err
+	}
+	if err := ValidateLength("location", submission.Location, 200); err != nil {
+		return err
+	}
+	if submission.OccurredAt != nil && submission.OccurredAt.After(now) {
+		return errors.New("occurred_at is in the future")
+	}
+	return nil
+}
+
+// ValidateSafeguardingStatus checks that status is a known report status.
+func ValidateSafeguardingStatus(status string) error {
+	switch status {
+	case models.SafeguardingOpen, models.SafeguardingInvestigating, models.SafeguardingClosed:
+		return nil
+	}
+	return errors.New("status must be open, investigating or closed")
+}
+
+// ValidateExportReason checks the reason an officer gives for an export.
+func ValidateExportReason(reason string) error {
+	if len(strings.TrimSpace(reason)) < minExportReasonLength {
+		return errors.New("reason must explain why the report is exported")
+	}
+	return ValidateLength("reason", reason, 1000)
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var (
+	// textPolicy removes all markup from plain text fields.
+	textPolicy = bluemonday.StrictPolicy()
+	// htmlPolicy keeps the formatting, links and images editors use in rich
+	// text such as post bodies and drops scripts, styles and event handlers.
+	htmlPolicy = newHTMLPolicy()
+)
+
+func newHTMLPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	// Rich text is written by staff, whose links need not be nofollow.
+	policy.RequireNoFollowOnLinks(false)
+	return policy
+}
+
+// SanitizeText removes HTML from a plain text field. Entities are decoded,
+// so the value is stored as the text the user typed and escaped on output;
+// decoding repeats until no markup is left, so encoded tags cannot survive.
+// Letters of any script and punctuation are kept.
+func SanitizeText(input string) string {
+	text := input
+	for {
+		sanitized := html.UnescapeString(textPolicy.Sanitize(text))
+		if sanitized == text {
+			return strings.TrimSpace(text)
+		}
+		text = sanitized
+	}
+}
+
+// SanitizeHTML removes unsafe markup from a rich text field.
+func SanitizeHTML(input string) string {
+	return strings.TrimSpace(htmlPolicy.Sanitize(input))
+}
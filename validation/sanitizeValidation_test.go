@@ -0,0 +1,29 @@
+package validation
+
+import "testing"
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"plain", "  Sunday service  ", "Sunday service"},
+		{"punctuation", "Tea & cake, 5 < 6 > 4", "Tea & cake, 5 < 6 > 4"},
+		{"entity", "Tom &amp; Jerry", "Tom & Jerry"},
+		{"tag", "<b>Youth</b> night<script>alert(1)</script>", "Youth night"},
+		{"encoded once", "&lt;img src=x onerror=alert(1)&gt;", ""},
+		{"encoded twice", "&amp;lt;img src=x onerror=alert(1)&amp;gt;", ""},
+		{"encoded three times", "&amp;amp;lt;img src=x onerror=alert(1)&amp;amp;gt;", ""},
+		{"encoded five times", "&amp;amp;amp;amp;lt;script&amp;amp;amp;amp;gt;alert(1)", ""},
+		{"numeric entities", "&#60;svg onload=alert(1)&#62;hi", "hi"},
+		{"swahili", "Karibu kwenye ibada ya Jumapili", "Karibu kwenye ibada ya Jumapili"},
+		{"non-latin scripts", "祈祷会 — صلاة — Молитва", "祈祷会 — صلاة — Молитва"},
+		{"emoji", "Praise 🙌", "Praise 🙌"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SanitizeText(test.input); got != test.want {
+				t.Errorf("SanitizeText(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bibleBooks lists the books of the Bible with the abbreviations people
+// type for them, written without spaces or dots.
+var bibleBooks = []struct {
+	name    string
+	aliases []string
+}{
+	{"Genesis", []string{"gen", "ge", "gn"}},
+	{"Exodus", []string{"exod", "exo", "ex"}},
+	{"Leviticus", []string{"lev", "le", "lv"}},
+	{"Numbers", []string{"num", "nu", "nm"}},
+	{"Deuteronomy", []string{"deut", "deu", "dt"}},
+	{"Joshua", []string{"josh", "jos"}},
+	{"Judges", []string{"judg", "jdg"}},
+	{"Ruth", []string{"ru"}},
+	{"1 Samuel", []string{"1sam", "1sa", "isamuel"}},
+	{"2 Samuel", []string{"2sam", "2sa", "iisamuel"}},
+	{"1 Kings", []string{"1kgs", "1ki", "ikings"}},
+	{"2 Kings", []string{"2kgs", "2ki", "iikings"}},
+	{"1 Chronicles", []string{"1chr", "1ch", "ichronicles"}},
+	{"2 Chronicles", []string{"2chr", "2ch", "iichronicles"}},
+	{"Ezra", []string{"ezr"}},
+	{"Nehemiah", []string{"neh", "ne"}},
+	{"Esther", []string{"esth", "est"}},
+	{"Job", []string{"jb"}},
+	{"Psalms", []string{"psalm", "pss", "psa", "ps"}},
+	{"Proverbs", []string{"prov", "pro", "pr"}},
+	{"Ecclesiastes", []string{"eccl", "eccles", "ecc", "qoh"}},
+	{"Song of Songs", []string{"songofsolomon", "song", "sos", "sg"}},
+	{"Isaiah", []string{"isa", "is"}},
+	{"Jeremiah", []string{"jer", "je"}},
+	{"Lamentations", []string{"lam", "la"}},
+	{"Ezekiel", []string{"ezek", "eze", "ezk"}},
+	{"Daniel", []string{"dan", "da", "dn"}},
+	{"Hosea", []string{"hos", "ho"}},
+	{"Joel", []string{"jl"}},
+	{"Amos", []string{"am"}},
+	{"Obadiah", []string{"obad", "ob"}},
+	{"Jonah", []string{"jon", "jnh"}},
+	{"Micah", []string{"mic", "mi"}},
+	{"Nahum", []string{"nah", "na"}},
+	{"Habakkuk", []string{"hab", "hb"}},
+	{"Zephaniah", []string{"zeph", "zep"}},
+	{"Haggai", []string{"hag", "hg"}},
+	{"Zechariah", []string{"zech", "zec"}},
+	{"Malachi", []string{"mal", "ml"}},
+	{"Matthew", []string{"matt", "mat", "mt"}},
+	{"Mark", []string{"mrk", "mk"}},
+	{"Luke", []string{"luk", "lk"}},
+	{"John", []string{"jhn", "jn"}},
+	{"Acts", []string{"act", "ac"}},
+	{"Romans", []string{"rom", "ro", "rm"}},
+	{"1 Corinthians", []string{"1cor", "1co", "icorinthians"}},
+	{"2 Corinthians", []string{"2cor", "2co", "iicorinthians"}},
+	{"Galatians", []string{"gal", "ga"}},
+	{"Ephesians", []string{"eph", "ephes"}},
+	{"Philippians", []string{"phil", "php"}},
+	{"Colossians", []string{"col"}},
+	{"1 Thessalonians", []string{"1thess", "1th", "ithessalonians"}},
+	{"2 Thessalonians", []string{"2thess", "2th", "iithessalonians"}},
+	{"1 Timothy", []string{"1tim", "1ti", "itimothy"}},
+	{"2 Timothy", []string{"2tim", "2ti", "iitimothy"}},
+	{"Titus", []string{"tit"}},
+	{"Philemon", []string{"phlm", "philem", "phm"}},
+	{"Hebrews", []string{"heb"}},
+	{"James", []string{"jas", "jm"}},
+	{"1 Peter", []string{"1pet", "1pe", "1pt", "ipeter"}},
+	{"2 Peter", []string{"2pet", "2pe", "2pt", "iipeter"}},
+	{"1 John", []string{"1jn", "1jhn", "ijohn"}},
+	{"2 John", []string{"2jn", "2jhn", "iijohn"}},
+	{"3 John", []string{"3jn", "3jhn", "iiijohn"}},
+	{"Jude", []string{"jud", "jd"}},
+	{"Revelation", []string{"rev", "re", "revelations"}},
+}
+
+// bibleBookNames maps the spaceless, lower-case names and abbreviations of
+// the books to their names.
+var bibleBookNames = func() map[string]string {
+	names := make(map[string]string)
+	for _, book := range bibleBooks {
+		names[strings.ToLower(strings.ReplaceAll(book.name, " ", ""))] = book.name
+		for _, alias := range book.aliases {
+			names[alias] = book.name
+		}
+	}
+	return names
+}()
+
+// scriptureRegex splits a reference such as "1 Cor. 13:4-7" into its book
+// and the chapter and verses.
+var scriptureRegex = regexp.MustCompile(`^((?:[1-3]|i{1,3})?\s*[a-z][a-z .]*?)\s*(\d[\d:,\-–\s]*(?:[a-z]\b)?)?$`)
+
+// ScriptureBook returns the name of the book a reference or book name such
+// as "Jn 3:16", "1 Cor. 13" or "psalm" is in, or false when it names no book
+// of the Bible.
+func ScriptureBook(reference string) (string, bool) {
+	match := scriptureRegex.FindStringSubmatch(strings.ToLower(strings.TrimSpace(reference)))
+	if match == nil {
+		return "", false
+	}
+	key := strings.NewReplacer(" ", "", ".", "").Replace(match[1])
+	name, ok := bibleBookNames[key]
+	return name, ok
+}
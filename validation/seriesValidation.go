@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+
+	"github.com/google/uuid"
+)
+
+const maxSeriesPosts = 100
+
+// ValidateSeries sanitizes a series in place and validates it and its list
+// of posts.
+func ValidateSeries(series *models.Series) error {
+	series.Title = SanitizeText(series.Title)
+	series.Description = SanitizeText(series.Description)
+
+	if err := ValidateLength("title", series.Title, MaxTitleLength); err != nil {
+		return err
+	}
+	if series.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(series.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if err := ValidateWordCount(series.Description, 200); err != nil {
+		return fmt.Errorf("description %w", err)
+	}
+	if len(series.PostIDs) > maxSeriesPosts {
+		return errors.New("too many posts")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(series.PostIDs))
+	for _, id := range series.PostIDs {
+		if seen[id] {
+			return errors.New("post_ids contains a post twice")
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
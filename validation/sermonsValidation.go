@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"fmt"
+	"jsmi-api/models"
+	"slices"
+)
+
+// Limits of sermons, matching the columns.
+const (
+	MaxSermonSpeakerLength     = 100
+	MaxSermonReferences        = 20
+	maxSermonReferenceLength   = 100
+	maxSermonDurationInSeconds = 24 * 60 * 60
+)
+
+// ValidateSermon sanitizes a sermon in place, derives its books from its
+// scripture references and validates it, returning a *ValidationError
+// listing every failing field.
+func ValidateSermon(sermon *models.Sermon) error {
+	sermon.Title = SanitizeText(sermon.Title)
+	sermon.Description = SanitizeText(sermon.Description)
+	sermon.Speaker = SanitizeText(sermon.Speaker)
+
+	var errs ValidationError
+	errs.checkRequired("title", sermon.Title)
+	errs.checkLength("title", sermon.Title, MaxTitleLength)
+	errs.checkWordCount("title", sermon.Title, 15)
+	errs.checkLength("description", sermon.Description, MaxExcerptLength)
+	errs.checkLength("speaker", sermon.Speaker, MaxSermonSpeakerLength)
+
+	errs.checkRequired("preached_on", sermon.PreachedOn)
+	if !errs.Has("preached_on") {
+		if _, err := ParseDate(sermon.PreachedOn); err != nil {
+			errs.Add("preached_on", RuleInvalid, "preached_on must be formatted as YYYY-MM-DD")
+		}
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+	}{{"audio_url", sermon.AudioURL}, {"video_url", sermon.VideoURL}} {
+		errs.checkLength(field.name, field.value, MaxLinkLength)
+		if !errs.Has(field.name) && field.value != "" && !IsValidURL(field.value) {
+			errs.Add(field.name, RuleInvalidURL, field.name+" must be an http or https URL")
+		}
+	}
+	if sermon.AudioURL == "" && sermon.VideoURL == "" {
+		errs.Add("audio_url", RuleRequired, "audio_url or video_url is required")
+	}
+
+	if sermon.DurationSeconds < 0 || sermon.DurationSeconds > maxSermonDurationInSeconds {
+		errs.Add("duration_seconds", RuleInvalid,
+			fmt.Sprintf("duration_seconds must be between 0 and %d", maxSermonDurationInSeconds))
+	}
+
+	validateSermonReferences(&errs, sermon)
+	return errs.Err()
+}
+
+func validateSermonReferences(errs *ValidationError, sermon *models.Sermon) {
+	if len(sermon.ScriptureReferences) > MaxSermonReferences {
+		errs.Add("scripture_references", RuleInvalid,
+			fmt.Sprintf("scripture_references must have at most %d entries", MaxSermonReferences))
+		return
+	}
+
+	references := make([]string, 0, len(sermon.ScriptureReferences))
+	books := []string{}
+	for i, reference := range sermon.ScriptureReferences {
+		reference = SanitizeText(reference)
+		field := fmt.Sprintf("scripture_references[%d]", i)
+		errs.checkRequired(field, reference)
+		errs.checkLength(field, reference, maxSermonReferenceLength)
+		if errs.Has(field) {
+			continue
+		}
+		book, ok := ScriptureBook(reference)
+		if !ok {
+			errs.Add(field, RuleInvalid, field+" must start with a book of the Bible")
+			continue
+		}
+		references = append(references, reference)
+		if !slices.Contains(books, book) {
+			books = append(books, book)
+		}
+	}
+	sermon.ScriptureReferences = references
+	sermon.Books = books
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+const (
+	maxSignageSlides         = 50
+	minSlideDurationSeconds  = 3
+	maxSlideDurationSeconds  = 300
+	defaultSlideDurationSecs = 10
+)
+
+var signageSlideKinds = map[string]bool{"announcement": true, "verse": true, "event": true}
+
+// ValidateSignagePlaylist sanitizes a playlist and its slides in place and
+// validates them.
+func ValidateSignagePlaylist(playlist *models.SignagePlaylist) error {
+	playlist.Name = SanitizeText(playlist.Name)
+	for i := range playlist.Slides {
+		playlist.Slides[i].Title = SanitizeText(playlist.Slides[i].Title)
+		playlist.Slides[i].Body = SanitizeText(playlist.Slides[i].Body)
+	}
+
+	if playlist.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(playlist.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	if playlist.StartsAt != nil && playlist.EndsAt != nil && !playlist.StartsAt.Before(*playlist.EndsAt) {
+		return errors.New("starts_at must be before ends_at")
+	}
+	if len(playlist.Slides) > maxSignageSlides {
+		return errors.New("too many slides")
+	}
+
+	for i, slide := range playlist.Slides {
+		if !signageSlideKinds[slide.Kind] {
+			return fmt.Errorf("slide %d: kind must be announcement, verse or event", i+1)
+		}
+		if slide.Title == "" {
+			return fmt.Errorf("slide %d: title is required", i+1)
+		}
+		if err := ValidateLength("title", slide.Title, MaxTitleLength); err != nil {
+			return fmt.Errorf("slide %d: %w", i+1, err)
+		}
+		if err := ValidateWordCount(slide.Body, 100); err != nil {
+			return fmt.Errorf("slide %d: body %w", i+1, err)
+		}
+		if slide.ImageURL != "" && !IsValidURL(slide.ImageURL) {
+			return fmt.Errorf("slide %d: image_url is not a valid URL", i+1)
+		}
+		if slide.DurationSeconds < minSlideDurationSeconds || slide.DurationSeconds > maxSlideDurationSeconds {
+			return fmt.Errorf("slide %d: duration_seconds must be between %d and %d", i+1, minSlideDurationSeconds, maxSlideDurationSeconds)
+		}
+		if slide.StartsAt != nil && slide.EndsAt != nil && !slide.StartsAt.Before(*slide.EndsAt) {
+			return fmt.Errorf("slide %d: starts_at must be before ends_at", i+1)
+		}
+	}
+
+	return nil
+}
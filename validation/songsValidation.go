@@ -0,0 +1,67 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+	"regexp"
+	"time"
+)
+
+const maxWorshipSetSongs = 30
+
+var (
+	ccliNumberRegex = regexp.MustCompile(`^[0-9]{1,10}$`)
+	songKeyRegex    = regexp.MustCompile(`^[A-G][#b]?m?$`)
+)
+
+// ValidateSong sanitizes a song of the worship library in place and
+// validates it.
+func ValidateSong(song *models.Song) error {
+	song.Title = SanitizeText(song.Title)
+	song.Author = SanitizeText(song.Author)
+
+	if song.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := ValidateWordCount(song.Title, 15); err != nil {
+		return fmt.Errorf("title %w", err)
+	}
+	if len(song.Author) > 255 {
+		return errors.New("author is too long")
+	}
+	if song.CCLINumber != "" && !ccliNumberRegex.MatchString(song.CCLINumber) {
+		return errors.New("ccli_number must be up to 10 digits")
+	}
+	if song.Key != "" && !songKeyRegex.MatchString(song.Key) {
+		return errors.New("key must be a note such as G, Bb or F#m")
+	}
+	if len(song.LyricsReference) > 2048 {
+		return errors.New("lyrics_reference is too long")
+	}
+
+	return nil
+}
+
+// ValidateWorshipSet validates a worship set before its songs are looked up.
+func ValidateWorshipSet(set models.WorshipSet) error {
+	if _, err := ParseDate(set.ServiceDate); err != nil {
+		return errors.New("service_date must be formatted as YYYY-MM-DD")
+	}
+	if err := ValidateWordCount(set.Notes, 500); err != nil {
+		return fmt.Errorf("notes %w", err)
+	}
+	if len(set.SongIDs) == 0 {
+		return errors.New("song_ids is required")
+	}
+	if len(set.SongIDs) > maxWorshipSetSongs {
+		return errors.New("too many songs")
+	}
+
+	return nil
+}
+
+// ParseDate parses a calendar date formatted as YYYY-MM-DD.
+func ParseDate(value string) (time.Time, error) {
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules a field can break. A FieldError's code joins the field and the rule,
+// e.g. title.too_long.
+const (
+	RuleRequired     = "required"
+	RuleTooLong      = "too_long"
+	RuleTooShort     = "too_short"
+	RuleTooManyWords = "too_many_words"
+	RuleInvalid      = "invalid"
+	RuleInvalidURL   = "invalid_url"
+	RuleReserved     = "reserved"
+	RuleWeak         = "weak"
+)
+
+// FieldError is a validation rule a field breaks.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field that failed validation, so that clients
+// can point at each of them.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		messages[i] = fieldError.Message
+	}
+	return "validation errors: " + strings.Join(messages, ", ")
+}
+
+// Add records that field breaks rule.
+func (e *ValidationError) Add(field, rule, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Rule: rule, Code: field + "." + rule, Message: message})
+}
+
+// Has reports whether field already failed, so later rules of a field are
+// only checked while the earlier ones pass.
+func (e *ValidationError) Has(field string) bool {
+	for _, fieldError := range e.Errors {
+		if fieldError.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns e if any field failed, otherwise nil.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// checkRequired records a required field that is empty.
+func (e *ValidationError) checkRequired(field, input string) {
+	if input == "" {
+		e.Add(field, RuleRequired, field+" is required")
+	}
+}
+
+// checkLength records a field with more than limit characters.
+func (e *ValidationError) checkLength(field, input string, limit int) {
+	if !e.Has(field) && utf8.RuneCountInString(input) > limit {
+		e.Add(field, RuleTooLong, fmt.Sprintf("%s must be at most %d characters", field, limit))
+	}
+}
+
+// checkWordCount records a field with more than limit words.
+func (e *ValidationError) checkWordCount(field, input string, limit int) {
+	if !e.Has(field) && WordCount(input) > limit {
+		e.Add(field, RuleTooManyWords, fmt.Sprintf("%s must be at most %d words", field, limit))
+	}
+}
@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"jsmi-api/models"
+)
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = map[string]bool{
+	"post.created":   true,
+	"post.updated":   true,
+	"post.published": true,
+	"post.deleted":   true,
+	"live.created":   true,
+	"live.updated":   true,
+	"live.deleted":   true,
+}
+
+// ValidateWebhook validates a webhook's endpoint, format and events.
+func ValidateWebhook(webhook models.Webhook) error {
+	if err := ValidateLength("url", webhook.URL, MaxLinkLength); err != nil {
+		return err
+	}
+	if !IsValidURL(webhook.URL) {
+		return errors.New("url must be an http or https URL")
+	}
+	if !IsPublicURL(webhook.URL) {
+		return errors.New("url must be reachable on the internet")
+	}
+	if webhook.Format != models.WebhookFormatJSON && webhook.Format != models.WebhookFormatDiscord {
+		return errors.New("format must be json or discord")
+	}
+
+	seen := make(map[string]bool, len(webhook.Events))
+	for _, event := range webhook.Events {
+		if !WebhookEvents[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+		if seen[event] {
+			return fmt.Errorf("event %q is listed twice", event)
+		}
+		seen[event] = true
+	}
+	return nil
+}